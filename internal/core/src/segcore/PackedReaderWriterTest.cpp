@@ -74,6 +74,7 @@ TEST(CPackedTest, PackedWriterAndReader) {
                                part_upload_size,
                                cgs,
                                &c_packed_writer,
+                               nullptr,
                                nullptr);
     EXPECT_EQ(c_status.error_code, 0);
     EXPECT_NE(c_packed_writer, nullptr);
@@ -95,12 +96,125 @@ TEST(CPackedTest, PackedWriterAndReader) {
     struct ArrowSchema c_read_schema;
     ASSERT_TRUE(arrow::ExportSchema(*schema, &c_read_schema).ok());
     CPackedReader c_packed_reader = nullptr;
-    c_status = NewPackedReader(
-        paths, 1, &c_read_schema, buffer_size, &c_packed_reader, nullptr);
+    c_status = NewPackedReader(paths,
+                               1,
+                               &c_read_schema,
+                               buffer_size,
+                               &c_packed_reader,
+                               nullptr,
+                               nullptr);
     EXPECT_EQ(c_status.error_code, 0);
     EXPECT_NE(c_packed_reader, nullptr);
 
     c_status = CloseReader(c_packed_reader);
     EXPECT_EQ(c_status.error_code, 0);
+
+    // readers opened on a filesystem handle outlive its close
+    CPackedFileSystem c_fs = nullptr;
+    c_status = NewPackedFileSystem(nullptr, &c_fs);
+    ASSERT_EQ(c_status.error_code, 0);
+    struct ArrowSchema c_fs_schema;
+    ASSERT_TRUE(arrow::ExportSchema(*schema, &c_fs_schema).ok());
+    c_status = NewPackedReaderWithFileSystem(paths,
+                                             1,
+                                             &c_fs_schema,
+                                             buffer_size,
+                                             c_fs,
+                                             &c_packed_reader,
+                                             nullptr,
+                                             nullptr);
+    ASSERT_EQ(c_status.error_code, 0);
+    c_status = ClosePackedFileSystem(c_fs);
+    EXPECT_EQ(c_status.error_code, 0);
+    CArrowArray c_fs_batch = nullptr;
+    CArrowSchema c_fs_batch_schema = nullptr;
+    c_status = ReadNext(c_packed_reader, &c_fs_batch, &c_fs_batch_schema);
+    ASSERT_EQ(c_status.error_code, 0);
+    ASSERT_NE(c_fs_batch, nullptr);
+    auto fs_batch = arrow::ImportRecordBatch(
+                        static_cast<struct ArrowArray*>(c_fs_batch),
+                        static_cast<struct ArrowSchema*>(c_fs_batch_schema))
+                        .ValueOrDie();
+    EXPECT_EQ(fs_batch->num_rows(), 5);
+    delete static_cast<struct ArrowArray*>(c_fs_batch);
+    delete static_cast<struct ArrowSchema*>(c_fs_batch_schema);
+    c_status = CloseReader(c_packed_reader);
+    EXPECT_EQ(c_status.error_code, 0);
+
+    // the column chunk is read by one coalesced request
+    struct ArrowSchema c_policy_schema;
+    ASSERT_TRUE(arrow::ExportSchema(*schema, &c_policy_schema).ok());
+    CReadPolicy read_policy{0, 1024 * 1024};
+    c_status = NewPackedReader(paths,
+                               1,
+                               &c_policy_schema,
+                               buffer_size,
+                               &c_packed_reader,
+                               nullptr,
+                               &read_policy);
+    ASSERT_EQ(c_status.error_code, 0);
+    CArrowArray c_batch = nullptr;
+    CArrowSchema c_batch_schema = nullptr;
+    c_status = ReadNext(c_packed_reader, &c_batch, &c_batch_schema);
+    ASSERT_EQ(c_status.error_code, 0);
+    ASSERT_NE(c_batch, nullptr);
+    auto policy_batch = arrow::ImportRecordBatch(
+                            static_cast<struct ArrowArray*>(c_batch),
+                            static_cast<struct ArrowSchema*>(c_batch_schema))
+                            .ValueOrDie();
+    EXPECT_EQ(policy_batch->num_rows(), 5);
+    delete static_cast<struct ArrowArray*>(c_batch);
+    delete static_cast<struct ArrowSchema*>(c_batch_schema);
+    int64_t ranges = 0, requests = 0, bytes_read = 0, wasted_bytes = 0;
+    c_status = GetPackedReaderReadStats(
+        c_packed_reader, &ranges, &requests, &bytes_read, &wasted_bytes);
+    EXPECT_EQ(c_status.error_code, 0);
+    EXPECT_GT(requests, 0);
+    EXPECT_GE(ranges, requests);
+    EXPECT_GT(bytes_read, 0);
+    EXPECT_EQ(wasted_bytes, 0);
+    c_status = CloseReader(c_packed_reader);
+    EXPECT_EQ(c_status.error_code, 0);
+
+    struct ArrowSchema c_row_group_schema;
+    ASSERT_TRUE(arrow::ExportSchema(*schema, &c_row_group_schema).ok());
+    CPackedRowGroupReader c_row_group_reader = nullptr;
+    c_status = NewPackedRowGroupReader(paths[0],
+                                       &c_row_group_schema,
+                                       buffer_size,
+                                       &c_row_group_reader,
+                                       nullptr);
+    ASSERT_EQ(c_status.error_code, 0);
+    int64_t row_groups = 0;
+    int64_t num_rows = 0;
+    c_status = GetPackedRowGroupCount(c_row_group_reader, &row_groups);
+    EXPECT_EQ(c_status.error_code, 0);
+    EXPECT_EQ(row_groups, 1);
+    c_status = GetPackedRowGroupNumRows(c_row_group_reader, 0, &num_rows);
+    EXPECT_EQ(c_status.error_code, 0);
+    EXPECT_EQ(num_rows, 5);
+    EXPECT_NE(SetPackedRowGroupRange(c_row_group_reader, 1, 1).error_code, 0);
+    EXPECT_EQ(SetPackedRowGroupRange(c_row_group_reader, 0, 1).error_code, 0);
+    CArrowArray c_array = nullptr;
+    CArrowSchema c_array_schema = nullptr;
+    c_status =
+        ReadNextPackedRowGroup(c_row_group_reader, &c_array, &c_array_schema);
+    ASSERT_EQ(c_status.error_code, 0);
+    ASSERT_NE(c_array, nullptr);
+    auto read = arrow::ImportRecordBatch(
+                    static_cast<struct ArrowArray*>(c_array),
+                    static_cast<struct ArrowSchema*>(c_array_schema))
+                    .ValueOrDie();
+    EXPECT_EQ(read->num_rows(), 5);
+    delete static_cast<struct ArrowArray*>(c_array);
+    delete static_cast<struct ArrowSchema*>(c_array_schema);
+    // the range is read
+    c_array = nullptr;
+    c_status =
+        ReadNextPackedRowGroup(c_row_group_reader, &c_array, &c_array_schema);
+    EXPECT_EQ(c_status.error_code, 0);
+    EXPECT_EQ(c_array, nullptr);
+    c_status = ClosePackedRowGroupReader(c_row_group_reader);
+    EXPECT_EQ(c_status.error_code, 0);
     FreeCColumnGroups(cgs);
 }
@@ -14,19 +14,158 @@
 
 #include "segcore/packed_reader_c.h"
 #include "milvus-storage/packed/reader.h"
+#include "milvus-storage/format/parquet/file_reader.h"
 #include "milvus-storage/filesystem/fs.h"
 #include "storage/PluginLoader.h"
+#include "storage/CoalescingFileSystem.h"
 #include "storage/KeyRetriever.h"
+#include "storage/ScratchBufferPool.h"
 #include "storage/StorageV2FSCache.h"
 
 #include <arrow/c/bridge.h>
 #include <arrow/filesystem/filesystem.h>
 #include <arrow/status.h>
+#include <arrow/table.h>
 #include <memory>
 #include "common/EasyAssert.h"
 #include "common/type_c.h"
 #include "monitor/scope_metric.h"
 
+namespace {
+
+// StorageConfigFs returns the filesystem cached for c_storage_config.
+std::shared_ptr<arrow::fs::FileSystem>
+StorageConfigFs(const CStorageConfig& c_storage_config) {
+    return milvus::storage::StorageV2FSCache::Instance().Get({
+        std::string(c_storage_config.address),
+        std::string(c_storage_config.bucket_name),
+        std::string(c_storage_config.access_key_id),
+        std::string(c_storage_config.access_key_value),
+        std::string(c_storage_config.root_path),
+        std::string(c_storage_config.storage_type),
+        std::string(c_storage_config.cloud_provider),
+        std::string(c_storage_config.iam_endpoint),
+        std::string(c_storage_config.log_level),
+        std::string(c_storage_config.region),
+        c_storage_config.useSSL,
+        std::string(c_storage_config.sslCACert),
+        c_storage_config.useIAM,
+        c_storage_config.useVirtualHost,
+        c_storage_config.requestTimeoutMs,
+        false,
+        std::string(c_storage_config.gcp_credential_json),
+        c_storage_config.use_custom_part_upload,
+        c_storage_config.max_connections,
+    });
+}
+
+// PackedFileSystemHandle is the filesystem behind a CPackedFileSystem.
+struct PackedFileSystemHandle {
+    std::shared_ptr<arrow::fs::FileSystem> fs;
+};
+
+// PackedReaderHandle is the reader behind a CPackedReader, with the pool of its
+// page and decompression buffers, reused across the column chunks and batches
+// it reads and closed after it, and the stats of its coalesced reads if opened
+// with a read policy.
+struct PackedReaderHandle {
+    milvus::storage::ScratchBufferPool* pool;
+    std::shared_ptr<milvus::storage::CoalescedReadStats> read_stats;
+    std::unique_ptr<milvus_storage::PackedRecordBatchReader> reader;
+
+    ~PackedReaderHandle() {
+        reader.reset();
+        pool->Close();
+    }
+};
+
+// NewPackedReaderHandle opens the reader of paths, whose scratch pool caches up
+// to buffer_size bytes of freed buffers, coalescing its reads by read_policy
+// unless nullptr.
+std::unique_ptr<PackedReaderHandle>
+NewPackedReaderHandle(std::shared_ptr<arrow::fs::FileSystem> fs,
+                      const std::vector<std::string>& paths,
+                      std::shared_ptr<arrow::Schema> schema,
+                      int64_t buffer_size,
+                      const CReadPolicy* read_policy) {
+    auto handle = std::make_unique<PackedReaderHandle>();
+    handle->pool = new milvus::storage::ScratchBufferPool(buffer_size);
+    if (read_policy != nullptr) {
+        handle->read_stats =
+            std::make_shared<milvus::storage::CoalescedReadStats>();
+        fs = std::make_shared<milvus::storage::CoalescingFileSystem>(
+            fs,
+            milvus::storage::ReadPolicy{read_policy->max_span,
+                                        read_policy->max_gap},
+            handle->read_stats);
+    }
+    handle->reader = std::make_unique<milvus_storage::PackedRecordBatchReader>(
+        fs,
+        paths,
+        schema,
+        buffer_size,
+        milvus::storage::GetReaderProperties(handle->pool));
+    return handle;
+}
+
+// PackedRowGroupReaderHandle is the reader behind a CPackedRowGroupReader,
+// reading the row groups [offset, offset + count) of a single column group
+// file, with the pool of its page and decompression buffers closed after it.
+// read counts the row groups read.
+struct PackedRowGroupReaderHandle {
+    milvus::storage::ScratchBufferPool* pool;
+    std::unique_ptr<milvus_storage::FileRowGroupReader> reader;
+    int64_t offset = 0;
+    int64_t count = 0;
+    int64_t read = 0;
+
+    ~PackedRowGroupReaderHandle() {
+        reader.reset();
+        pool->Close();
+    }
+
+    int64_t
+    row_groups() const {
+        return static_cast<int64_t>(
+            reader->file_metadata()->GetRowGroupMetadataVector().size());
+    }
+};
+
+CStatus
+NewPackedRowGroupReaderFromFs(std::shared_ptr<arrow::fs::FileSystem> fs,
+                              const char* path,
+                              struct ArrowSchema* schema,
+                              int64_t buffer_size,
+                              CPackedRowGroupReader* c_reader,
+                              CPluginContext* c_plugin_context) {
+    if (!fs) {
+        return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                      "[StorageV2] Failed to get filesystem");
+    }
+    auto trueSchema = arrow::ImportSchema(schema).ValueOrDie();
+    auto plugin_ptr =
+        milvus::storage::PluginLoader::GetInstance().getCipherPlugin();
+    if (plugin_ptr != nullptr && c_plugin_context != nullptr) {
+        plugin_ptr->Update(c_plugin_context->ez_id,
+                           c_plugin_context->collection_id,
+                           std::string(c_plugin_context->key));
+    }
+    auto handle = std::make_unique<PackedRowGroupReaderHandle>();
+    handle->pool = new milvus::storage::ScratchBufferPool(buffer_size);
+    handle->reader = std::make_unique<milvus_storage::FileRowGroupReader>(
+        fs,
+        std::string(path),
+        trueSchema,
+        buffer_size,
+        milvus::storage::GetReaderProperties(handle->pool));
+    handle->count = handle->row_groups();
+    handle->reader->SetRowGroupOffsetAndCount(0, handle->count);
+    *c_reader = handle.release();
+    return milvus::SuccessCStatus();
+}
+
+}  // namespace
+
 CStatus
 NewPackedReaderWithStorageConfig(char** paths,
                                  int64_t num_paths,
@@ -34,33 +173,14 @@ NewPackedReaderWithStorageConfig(char** paths,
                                  const int64_t buffer_size,
                                  CStorageConfig c_storage_config,
                                  CPackedReader* c_packed_reader,
-                                 CPluginContext* c_plugin_context) {
+                                 CPluginContext* c_plugin_context,
+                                 const CReadPolicy* read_policy) {
     SCOPE_CGO_CALL_METRIC();
 
     try {
         auto truePaths = std::vector<std::string>(paths, paths + num_paths);
 
-        auto trueFs = milvus::storage::StorageV2FSCache::Instance().Get({
-            std::string(c_storage_config.address),
-            std::string(c_storage_config.bucket_name),
-            std::string(c_storage_config.access_key_id),
-            std::string(c_storage_config.access_key_value),
-            std::string(c_storage_config.root_path),
-            std::string(c_storage_config.storage_type),
-            std::string(c_storage_config.cloud_provider),
-            std::string(c_storage_config.iam_endpoint),
-            std::string(c_storage_config.log_level),
-            std::string(c_storage_config.region),
-            c_storage_config.useSSL,
-            std::string(c_storage_config.sslCACert),
-            c_storage_config.useIAM,
-            c_storage_config.useVirtualHost,
-            c_storage_config.requestTimeoutMs,
-            false,
-            std::string(c_storage_config.gcp_credential_json),
-            c_storage_config.use_custom_part_upload,
-            c_storage_config.max_connections,
-        });
+        auto trueFs = StorageConfigFs(c_storage_config);
         if (!trueFs) {
             return milvus::FailureCStatus(
                 milvus::ErrorCode::FileReadFailed,
@@ -75,13 +195,9 @@ NewPackedReaderWithStorageConfig(char** paths,
                                std::string(c_plugin_context->key));
         }
 
-        auto reader = std::make_unique<milvus_storage::PackedRecordBatchReader>(
-            trueFs,
-            truePaths,
-            trueSchema,
-            buffer_size,
-            milvus::storage::GetReaderProperties());
-        *c_packed_reader = reader.release();
+        auto handle = NewPackedReaderHandle(
+            trueFs, truePaths, trueSchema, buffer_size, read_policy);
+        *c_packed_reader = handle.release();
         return milvus::SuccessCStatus();
     } catch (std::exception& e) {
         return milvus::FailureCStatus(&e);
@@ -94,7 +210,8 @@ NewPackedReader(char** paths,
                 struct ArrowSchema* schema,
                 const int64_t buffer_size,
                 CPackedReader* c_packed_reader,
-                CPluginContext* c_plugin_context) {
+                CPluginContext* c_plugin_context,
+                const CReadPolicy* read_policy) {
     SCOPE_CGO_CALL_METRIC();
 
     try {
@@ -116,13 +233,73 @@ NewPackedReader(char** paths,
                                std::string(c_plugin_context->key));
         }
 
-        auto reader = std::make_unique<milvus_storage::PackedRecordBatchReader>(
-            trueFs,
-            truePaths,
-            trueSchema,
-            buffer_size,
-            milvus::storage::GetReaderProperties());
-        *c_packed_reader = reader.release();
+        auto handle = NewPackedReaderHandle(
+            trueFs, truePaths, trueSchema, buffer_size, read_policy);
+        *c_packed_reader = handle.release();
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+NewPackedFileSystem(const CStorageConfig* c_storage_config,
+                    CPackedFileSystem* c_fs) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto fs = c_storage_config != nullptr
+                      ? StorageConfigFs(*c_storage_config)
+                      : milvus_storage::ArrowFileSystemSingleton::GetInstance()
+                            .GetArrowFileSystem();
+        if (!fs) {
+            return milvus::FailureCStatus(
+                milvus::ErrorCode::FileReadFailed,
+                "[StorageV2] Failed to get filesystem");
+        }
+        *c_fs = new PackedFileSystemHandle{std::move(fs)};
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+ClosePackedFileSystem(CPackedFileSystem c_fs) {
+    try {
+        delete static_cast<PackedFileSystemHandle*>(c_fs);
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+NewPackedReaderWithFileSystem(char** paths,
+                              int64_t num_paths,
+                              struct ArrowSchema* schema,
+                              const int64_t buffer_size,
+                              CPackedFileSystem c_fs,
+                              CPackedReader* c_packed_reader,
+                              CPluginContext* c_plugin_context,
+                              const CReadPolicy* read_policy) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto truePaths = std::vector<std::string>(paths, paths + num_paths);
+        auto trueFs = static_cast<PackedFileSystemHandle*>(c_fs)->fs;
+        auto trueSchema = arrow::ImportSchema(schema).ValueOrDie();
+        auto plugin_ptr =
+            milvus::storage::PluginLoader::GetInstance().getCipherPlugin();
+        if (plugin_ptr != nullptr && c_plugin_context != nullptr) {
+            plugin_ptr->Update(c_plugin_context->ez_id,
+                               c_plugin_context->collection_id,
+                               std::string(c_plugin_context->key));
+        }
+
+        auto handle = NewPackedReaderHandle(
+            trueFs, truePaths, trueSchema, buffer_size, read_policy);
+        *c_packed_reader = handle.release();
         return milvus::SuccessCStatus();
     } catch (std::exception& e) {
         return milvus::FailureCStatus(&e);
@@ -136,11 +313,9 @@ ReadNext(CPackedReader c_packed_reader,
     SCOPE_CGO_CALL_METRIC();
 
     try {
-        auto packed_reader =
-            static_cast<milvus_storage::PackedRecordBatchReader*>(
-                c_packed_reader);
+        auto handle = static_cast<PackedReaderHandle*>(c_packed_reader);
         std::shared_ptr<arrow::RecordBatch> record_batch;
-        auto status = packed_reader->ReadNext(&record_batch);
+        auto status = handle->reader->ReadNext(&record_batch);
         if (!status.ok()) {
             return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
                                           status.ToString());
@@ -173,11 +348,197 @@ CloseReader(CPackedReader c_packed_reader) {
     SCOPE_CGO_CALL_METRIC();
 
     try {
-        auto packed_reader =
-            static_cast<milvus_storage::PackedRecordBatchReader*>(
-                c_packed_reader);
-        packed_reader->Close();
-        delete packed_reader;
+        auto handle = static_cast<PackedReaderHandle*>(c_packed_reader);
+        handle->reader->Close();
+        delete handle;
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetPackedReaderScratchStats(CPackedReader c_packed_reader,
+                            int64_t* allocations,
+                            int64_t* reused) {
+    try {
+        auto handle = static_cast<PackedReaderHandle*>(c_packed_reader);
+        auto stats = handle->pool->stats();
+        *allocations = stats.allocations;
+        *reused = stats.reused;
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetPackedReaderReadStats(CPackedReader c_packed_reader,
+                         int64_t* ranges,
+                         int64_t* requests,
+                         int64_t* bytes_read,
+                         int64_t* wasted_bytes) {
+    try {
+        auto handle = static_cast<PackedReaderHandle*>(c_packed_reader);
+        auto stats = handle->read_stats;
+        *ranges = stats ? stats->ranges.load() : 0;
+        *requests = stats ? stats->requests.load() : 0;
+        *bytes_read = stats ? stats->bytes_read.load() : 0;
+        *wasted_bytes = stats ? stats->wasted_bytes.load() : 0;
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+NewPackedRowGroupReader(const char* path,
+                        struct ArrowSchema* schema,
+                        const int64_t buffer_size,
+                        CPackedRowGroupReader* c_reader,
+                        CPluginContext* c_plugin_context) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = milvus_storage::ArrowFileSystemSingleton::GetInstance()
+                          .GetArrowFileSystem();
+        return NewPackedRowGroupReaderFromFs(
+            trueFs, path, schema, buffer_size, c_reader, c_plugin_context);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+NewPackedRowGroupReaderWithStorageConfig(const char* path,
+                                         struct ArrowSchema* schema,
+                                         const int64_t buffer_size,
+                                         CStorageConfig c_storage_config,
+                                         CPackedRowGroupReader* c_reader,
+                                         CPluginContext* c_plugin_context) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        return NewPackedRowGroupReaderFromFs(StorageConfigFs(c_storage_config),
+                                             path,
+                                             schema,
+                                             buffer_size,
+                                             c_reader,
+                                             c_plugin_context);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetPackedRowGroupCount(CPackedRowGroupReader c_reader, int64_t* num) {
+    try {
+        auto handle = static_cast<PackedRowGroupReaderHandle*>(c_reader);
+        *num = handle->row_groups();
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetPackedRowGroupNumRows(CPackedRowGroupReader c_reader,
+                         int64_t row_group,
+                         int64_t* num_rows) {
+    try {
+        auto handle = static_cast<PackedRowGroupReaderHandle*>(c_reader);
+        auto metadata =
+            handle->reader->file_metadata()->GetRowGroupMetadataVector();
+        if (row_group < 0 ||
+            row_group >= static_cast<int64_t>(metadata.size())) {
+            return milvus::FailureCStatus(
+                milvus::ErrorCode::UnexpectedError,
+                "[StorageV2] row group " + std::to_string(row_group) +
+                    " out of range of " + std::to_string(metadata.size()));
+        }
+        *num_rows = metadata.Get(row_group).row_num();
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+SetPackedRowGroupRange(CPackedRowGroupReader c_reader,
+                       int64_t offset,
+                       int64_t count) {
+    try {
+        auto handle = static_cast<PackedRowGroupReaderHandle*>(c_reader);
+        auto total = handle->row_groups();
+        if (offset < 0 || count < 0 || offset + count > total) {
+            return milvus::FailureCStatus(
+                milvus::ErrorCode::UnexpectedError,
+                "[StorageV2] row groups [" + std::to_string(offset) + ", " +
+                    std::to_string(offset + count) + ") out of range of " +
+                    std::to_string(total));
+        }
+        handle->reader->SetRowGroupOffsetAndCount(offset, count);
+        handle->offset = offset;
+        handle->count = count;
+        handle->read = 0;
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+ReadNextPackedRowGroup(CPackedRowGroupReader c_reader,
+                       CArrowArray* out_array,
+                       CArrowSchema* out_schema) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto handle = static_cast<PackedRowGroupReaderHandle*>(c_reader);
+        if (handle->read >= handle->count) {
+            // end of the range
+            return milvus::SuccessCStatus();
+        }
+        std::shared_ptr<arrow::Table> table;
+        auto status = handle->reader->ReadNextRowGroup(&table);
+        if (!status.ok()) {
+            return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                          status.ToString());
+        }
+        handle->read++;
+        auto batch = table->CombineChunksToBatch();
+        if (!batch.ok()) {
+            return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                          batch.status().ToString());
+        }
+        std::unique_ptr<ArrowArray> arr = std::make_unique<ArrowArray>();
+        std::unique_ptr<ArrowSchema> schema = std::make_unique<ArrowSchema>();
+        status = arrow::ExportRecordBatch(
+            *batch.ValueOrDie(), arr.get(), schema.get());
+        if (!status.ok()) {
+            return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                          status.ToString());
+        }
+        *out_array = arr.release();
+        *out_schema = schema.release();
+        return milvus::SuccessCStatus();
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+ClosePackedRowGroupReader(CPackedRowGroupReader c_reader) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto handle = static_cast<PackedRowGroupReaderHandle*>(c_reader);
+        auto status = handle->reader->Close();
+        delete handle;
+        if (!status.ok()) {
+            return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                          status.ToString());
+        }
         return milvus::SuccessCStatus();
     } catch (std::exception& e) {
         return milvus::FailureCStatus(&e);
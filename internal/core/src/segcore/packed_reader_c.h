@@ -22,9 +22,21 @@ extern "C" {
 #include <arrow/c/abi.h>
 
 typedef void* CPackedReader;
+typedef void* CPackedFileSystem;
+typedef void* CPackedRowGroupReader;
 typedef void* CArrowArray;
 typedef void* CArrowSchema;
 
+/**
+ * @brief The policy coalescing the column chunk reads of a packed reader:
+ *        chunks closer than max_gap bytes are read at once, unless the read
+ *        would span more than max_span bytes, 0 for no cap.
+ */
+typedef struct CReadPolicy {
+    int64_t max_span;
+    int64_t max_gap;
+} CReadPolicy;
+
 CStatus
 NewPackedReaderWithStorageConfig(char** paths,
                                  int64_t num_paths,
@@ -32,7 +44,8 @@ NewPackedReaderWithStorageConfig(char** paths,
                                  const int64_t buffer_size,
                                  CStorageConfig c_storage_config,
                                  CPackedReader* c_packed_reader,
-                                 CPluginContext* c_plugin_context);
+                                 CPluginContext* c_plugin_context,
+                                 const CReadPolicy* read_policy);
 
 /**
  * @brief Open a packed reader to read needed columns in the specified path.
@@ -41,6 +54,9 @@ NewPackedReaderWithStorageConfig(char** paths,
  * @param schema The original schema of data.
  * @param buffer_size The max buffer size of the packed reader.
  * @param c_packed_reader The output pointer of the packed reader.
+ * @param c_plugin_context The context of the cipher plugin, or nullptr.
+ * @param read_policy The policy coalescing the reads of the files, or nullptr
+ *        to read each column chunk on its own.
  */
 CStatus
 NewPackedReader(char** paths,
@@ -48,7 +64,42 @@ NewPackedReader(char** paths,
                 struct ArrowSchema* schema,
                 const int64_t buffer_size,
                 CPackedReader* c_packed_reader,
-                CPluginContext* c_plugin_context);
+                CPluginContext* c_plugin_context,
+                const CReadPolicy* read_policy);
+
+/**
+ * @brief Get the filesystem of a storage config as a handle packed readers are
+ *        opened on, holding the filesystem and its connections until closed,
+ *        so that the readers of the same storage share them.
+ *
+ * @param c_storage_config The storage config, or nullptr for the filesystem
+ *        of the configured storage.
+ * @param c_fs The output pointer of the filesystem handle.
+ */
+CStatus
+NewPackedFileSystem(const CStorageConfig* c_storage_config,
+                    CPackedFileSystem* c_fs);
+
+/**
+ * @brief Release the filesystem handle, the readers opened on it keep the
+ *        filesystem until closed.
+ */
+CStatus
+ClosePackedFileSystem(CPackedFileSystem c_fs);
+
+/**
+ * @brief Open a packed reader as NewPackedReader does, on the filesystem of
+ *        c_fs.
+ */
+CStatus
+NewPackedReaderWithFileSystem(char** paths,
+                              int64_t num_paths,
+                              struct ArrowSchema* schema,
+                              const int64_t buffer_size,
+                              CPackedFileSystem c_fs,
+                              CPackedReader* c_packed_reader,
+                              CPluginContext* c_plugin_context,
+                              const CReadPolicy* read_policy);
 
 /**
  * @brief Read the next record batch from the packed reader.
@@ -71,6 +122,95 @@ ReadNext(CPackedReader c_packed_reader,
 CStatus
 CloseReader(CPackedReader c_packed_reader);
 
+/**
+ * @brief Get the allocations of the page and decompression buffers of the
+ *        packed reader, and how many of them reused a buffer freed before.
+ *
+ * @param c_packed_reader The packed reader.
+ * @param allocations The output number of buffers allocated.
+ * @param reused The output number of buffers allocated reusing a freed one.
+ */
+CStatus
+GetPackedReaderScratchStats(CPackedReader c_packed_reader,
+                            int64_t* allocations,
+                            int64_t* reused);
+
+/**
+ * @brief Get the reads of the packed reader opened with a read policy: the
+ *        reads asked by the parquet reader, the requests issued to storage for
+ *        them, the bytes read and the gap bytes read only to coalesce reads.
+ *        All are 0 without a read policy.
+ */
+CStatus
+GetPackedReaderReadStats(CPackedReader c_packed_reader,
+                         int64_t* ranges,
+                         int64_t* requests,
+                         int64_t* bytes_read,
+                         int64_t* wasted_bytes);
+
+/**
+ * @brief Open a reader of the row groups of a single packed column group file,
+ *        reading all of them until SetPackedRowGroupRange narrows the range.
+ *
+ * @param path The path of the column group file.
+ * @param schema The schema of the columns to read.
+ * @param buffer_size The max buffer size of the reader.
+ * @param c_reader The output pointer of the row group reader.
+ * @param c_plugin_context The context of the cipher plugin, or nullptr.
+ */
+CStatus
+NewPackedRowGroupReader(const char* path,
+                        struct ArrowSchema* schema,
+                        const int64_t buffer_size,
+                        CPackedRowGroupReader* c_reader,
+                        CPluginContext* c_plugin_context);
+
+CStatus
+NewPackedRowGroupReaderWithStorageConfig(const char* path,
+                                         struct ArrowSchema* schema,
+                                         const int64_t buffer_size,
+                                         CStorageConfig c_storage_config,
+                                         CPackedRowGroupReader* c_reader,
+                                         CPluginContext* c_plugin_context);
+
+/**
+ * @brief Get the number of row groups of the file, from its footer.
+ */
+CStatus
+GetPackedRowGroupCount(CPackedRowGroupReader c_reader, int64_t* num);
+
+/**
+ * @brief Get the number of rows of a row group of the file, from its footer.
+ */
+CStatus
+GetPackedRowGroupNumRows(CPackedRowGroupReader c_reader,
+                         int64_t row_group,
+                         int64_t* num_rows);
+
+/**
+ * @brief Restrict the reads to the row groups [offset, offset + count), seeking
+ *        to the first without reading the row groups before it.
+ */
+CStatus
+SetPackedRowGroupRange(CPackedRowGroupReader c_reader,
+                       int64_t offset,
+                       int64_t count);
+
+/**
+ * @brief Read the next row group of the range as a record batch, returning no
+ *        array at the end of the range.
+ */
+CStatus
+ReadNextPackedRowGroup(CPackedRowGroupReader c_reader,
+                       CArrowArray* out_array,
+                       CArrowSchema* out_schema);
+
+/**
+ * @brief Close the row group reader and release the resources.
+ */
+CStatus
+ClosePackedRowGroupReader(CPackedRowGroupReader c_reader);
+
 #ifdef __cplusplus
 }
 #endif
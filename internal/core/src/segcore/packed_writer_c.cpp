@@ -26,6 +26,7 @@
 #include "storage/StorageV2FSCache.h"
 
 #include <arrow/c/bridge.h>
+#include <parquet/arrow/reader.h>
 #include <arrow/filesystem/filesystem.h>
 #include <arrow/array.h>
 #include <arrow/record_batch.h>
@@ -35,6 +36,91 @@
 #include "common/type_c.h"
 #include "monitor/scope_metric.h"
 
+static void
+ApplyPackedWriterProperties(parquet::WriterProperties::Builder& builder,
+                            const CPackedWriterProperties* c_writer_properties) {
+    if (c_writer_properties == nullptr) {
+        return;
+    }
+    if (c_writer_properties->row_group_size > 0) {
+        builder.max_row_group_length(c_writer_properties->row_group_size);
+    }
+    for (int64_t i = 0; i < c_writer_properties->num_compressed_columns; ++i) {
+        const std::string path(c_writer_properties->compressed_columns[i]);
+        switch (c_writer_properties->compression_codecs[i]) {
+            case CPackedCompressionNone:
+                builder.compression(path, arrow::Compression::UNCOMPRESSED);
+                break;
+            case CPackedCompressionSnappy:
+                builder.compression(path, arrow::Compression::SNAPPY);
+                break;
+            case CPackedCompressionZstd:
+                builder.compression(path, arrow::Compression::ZSTD);
+                break;
+            case CPackedCompressionLZ4:
+                builder.compression(path, arrow::Compression::LZ4);
+                break;
+            default:
+                continue;
+        }
+        if (c_writer_properties->compression_levels[i] != 0) {
+            builder.compression_level(path,
+                                      c_writer_properties->compression_levels[i]);
+        }
+    }
+}
+
+// StorageConfigFs returns the filesystem cached for c_storage_config.
+static std::shared_ptr<arrow::fs::FileSystem>
+StorageConfigFs(const CStorageConfig& c_storage_config) {
+    return milvus::storage::StorageV2FSCache::Instance().Get({
+        std::string(c_storage_config.address),
+        std::string(c_storage_config.bucket_name),
+        std::string(c_storage_config.access_key_id),
+        std::string(c_storage_config.access_key_value),
+        std::string(c_storage_config.root_path),
+        std::string(c_storage_config.storage_type),
+        std::string(c_storage_config.cloud_provider),
+        std::string(c_storage_config.iam_endpoint),
+        std::string(c_storage_config.log_level),
+        std::string(c_storage_config.region),
+        c_storage_config.useSSL,
+        std::string(c_storage_config.sslCACert),
+        c_storage_config.useIAM,
+        c_storage_config.useVirtualHost,
+        c_storage_config.requestTimeoutMs,
+        false,
+        std::string(c_storage_config.gcp_credential_json),
+        c_storage_config.use_custom_part_upload,
+        c_storage_config.max_connections,
+    });
+}
+
+// OpenParquetFileFromFs opens the parquet file at path of fs, reading its footer.
+static CStatus
+OpenParquetFileFromFs(const std::shared_ptr<arrow::fs::FileSystem>& fs,
+                      const char* path,
+                      std::unique_ptr<parquet::arrow::FileReader>* reader) {
+    if (!fs) {
+        return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                      "[StorageV2] Failed to get filesystem");
+    }
+    auto input = fs->OpenInputFile(path);
+    if (!input.ok()) {
+        return milvus::FailureCStatus(milvus::ErrorCode::FileReadFailed,
+                                      "[StorageV2] Failed to open file: " +
+                                          input.status().ToString());
+    }
+    auto status = parquet::arrow::OpenFile(
+        input.ValueOrDie(), arrow::default_memory_pool(), reader);
+    if (!status.ok()) {
+        return milvus::FailureCStatus(
+            milvus::ErrorCode::FileReadFailed,
+            "[StorageV2] Failed to open parquet file: " + status.ToString());
+    }
+    return milvus::SuccessCStatus();
+}
+
 CStatus
 NewPackedWriterWithStorageConfig(struct ArrowSchema* schema,
                                  const int64_t buffer_size,
@@ -44,7 +130,8 @@ NewPackedWriterWithStorageConfig(struct ArrowSchema* schema,
                                  CColumnGroups column_groups,
                                  CStorageConfig c_storage_config,
                                  CPackedWriter* c_packed_writer,
-                                 CPluginContext* c_plugin_context) {
+                                 CPluginContext* c_plugin_context,
+                                 CPackedWriterProperties* c_writer_properties) {
     SCOPE_CGO_CALL_METRIC();
 
     try {
@@ -53,27 +140,7 @@ NewPackedWriterWithStorageConfig(struct ArrowSchema* schema,
         auto storage_config = milvus_storage::StorageConfig();
         storage_config.part_size = part_upload_size;
 
-        auto trueFs = milvus::storage::StorageV2FSCache::Instance().Get({
-            std::string(c_storage_config.address),
-            std::string(c_storage_config.bucket_name),
-            std::string(c_storage_config.access_key_id),
-            std::string(c_storage_config.access_key_value),
-            std::string(c_storage_config.root_path),
-            std::string(c_storage_config.storage_type),
-            std::string(c_storage_config.cloud_provider),
-            std::string(c_storage_config.iam_endpoint),
-            std::string(c_storage_config.log_level),
-            std::string(c_storage_config.region),
-            c_storage_config.useSSL,
-            std::string(c_storage_config.sslCACert),
-            c_storage_config.useIAM,
-            c_storage_config.useVirtualHost,
-            c_storage_config.requestTimeoutMs,
-            false,
-            std::string(c_storage_config.gcp_credential_json),
-            c_storage_config.use_custom_part_upload,
-            c_storage_config.max_connections,
-        });
+        auto trueFs = StorageConfigFs(c_storage_config);
         if (!trueFs) {
             return milvus::FailureCStatus(
                 milvus::ErrorCode::FileReadFailed,
@@ -107,6 +174,7 @@ NewPackedWriterWithStorageConfig(struct ArrowSchema* schema,
                     ->build());
         }
 
+        ApplyPackedWriterProperties(builder, c_writer_properties);
         auto writer_properties = builder.build();
         auto writer = std::make_unique<milvus_storage::PackedRecordBatchWriter>(
             trueFs,
@@ -132,7 +200,8 @@ NewPackedWriter(struct ArrowSchema* schema,
                 int64_t part_upload_size,
                 CColumnGroups column_groups,
                 CPackedWriter* c_packed_writer,
-                CPluginContext* c_plugin_context) {
+                CPluginContext* c_plugin_context,
+                CPackedWriterProperties* c_writer_properties) {
     SCOPE_CGO_CALL_METRIC();
 
     try {
@@ -176,6 +245,7 @@ NewPackedWriter(struct ArrowSchema* schema,
                     ->build());
         }
 
+        ApplyPackedWriterProperties(builder, c_writer_properties);
         auto writer_properties = builder.build();
         auto writer = std::make_unique<milvus_storage::PackedRecordBatchWriter>(
             trueFs,
@@ -297,27 +367,7 @@ GetFileSizeWithStorageConfig(const char* path,
     SCOPE_CGO_CALL_METRIC();
 
     try {
-        auto trueFs = milvus::storage::StorageV2FSCache::Instance().Get({
-            std::string(c_storage_config.address),
-            std::string(c_storage_config.bucket_name),
-            std::string(c_storage_config.access_key_id),
-            std::string(c_storage_config.access_key_value),
-            std::string(c_storage_config.root_path),
-            std::string(c_storage_config.storage_type),
-            std::string(c_storage_config.cloud_provider),
-            std::string(c_storage_config.iam_endpoint),
-            std::string(c_storage_config.log_level),
-            std::string(c_storage_config.region),
-            c_storage_config.useSSL,
-            std::string(c_storage_config.sslCACert),
-            c_storage_config.useIAM,
-            c_storage_config.useVirtualHost,
-            c_storage_config.requestTimeoutMs,
-            false,
-            std::string(c_storage_config.gcp_credential_json),
-            c_storage_config.use_custom_part_upload,
-            c_storage_config.max_connections,
-        });
+        auto trueFs = StorageConfigFs(c_storage_config);
 
         if (!trueFs) {
             return milvus::FailureCStatus(
@@ -337,4 +387,197 @@ GetFileSizeWithStorageConfig(const char* path,
     } catch (std::exception& e) {
         return milvus::FailureCStatus(&e);
     }
-}
\ No newline at end of file
+}
+
+// DeleteFileFromFs deletes path from fs, a missing file is not an error
+// so that cleaning up a partially written segment can be retried.
+static CStatus
+DeleteFileFromFs(const std::shared_ptr<arrow::fs::FileSystem>& fs,
+                 const char* path) {
+    if (!fs) {
+        return milvus::FailureCStatus(milvus::ErrorCode::FileWriteFailed,
+                                      "[StorageV2] Failed to get filesystem");
+    }
+    auto info = fs->GetFileInfo(path);
+    if (!info.ok()) {
+        return milvus::FailureCStatus(milvus::ErrorCode::FileWriteFailed,
+                                      "[StorageV2] Failed to get file info: " +
+                                          info.status().ToString());
+    }
+    if (info.ValueOrDie().type() == arrow::fs::FileType::NotFound) {
+        return milvus::SuccessCStatus();
+    }
+    auto status = fs->DeleteFile(path);
+    if (!status.ok()) {
+        return milvus::FailureCStatus(
+            milvus::ErrorCode::FileWriteFailed,
+            "[StorageV2] Failed to delete file: " + status.ToString());
+    }
+    return milvus::SuccessCStatus();
+}
+
+CStatus
+DeleteFile(const char* path) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = milvus_storage::ArrowFileSystemSingleton::GetInstance()
+                          .GetArrowFileSystem();
+        return DeleteFileFromFs(trueFs, path);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+DeleteFileWithStorageConfig(const char* path,
+                            CStorageConfig c_storage_config) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = StorageConfigFs(c_storage_config);
+        return DeleteFileFromFs(trueFs, path);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+// ReadFileSchemaFromFs exports the arrow schema stored in the footer of the
+// parquet file at path.
+static CStatus
+ReadFileSchemaFromFs(const std::shared_ptr<arrow::fs::FileSystem>& fs,
+                     const char* path,
+                     struct ArrowSchema* out_schema) {
+    std::unique_ptr<parquet::arrow::FileReader> reader;
+    auto opened = OpenParquetFileFromFs(fs, path, &reader);
+    if (opened.error_code != milvus::ErrorCode::Success) {
+        return opened;
+    }
+    std::shared_ptr<arrow::Schema> schema;
+    auto status = reader->GetSchema(&schema);
+    if (!status.ok()) {
+        return milvus::FailureCStatus(
+            milvus::ErrorCode::FileReadFailed,
+            "[StorageV2] Failed to read file schema: " + status.ToString());
+    }
+    status = arrow::ExportSchema(*schema, out_schema);
+    if (!status.ok()) {
+        return milvus::FailureCStatus(
+            milvus::ErrorCode::FileReadFailed,
+            "[StorageV2] Failed to export file schema: " + status.ToString());
+    }
+    return milvus::SuccessCStatus();
+}
+
+CStatus
+GetFileSchema(const char* path, struct ArrowSchema* out_schema) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = milvus_storage::ArrowFileSystemSingleton::GetInstance()
+                          .GetArrowFileSystem();
+        return ReadFileSchemaFromFs(trueFs, path, out_schema);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetFileSchemaWithStorageConfig(const char* path,
+                               CStorageConfig c_storage_config,
+                               struct ArrowSchema* out_schema) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = StorageConfigFs(c_storage_config);
+        return ReadFileSchemaFromFs(trueFs, path, out_schema);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+// ReadFileStatsFromFs reads the number of rows and the uncompressed size of the
+// row groups stored in the footer of the parquet file at path.
+static CStatus
+ReadFileStatsFromFs(const std::shared_ptr<arrow::fs::FileSystem>& fs,
+                    const char* path,
+                    int64_t* num_rows,
+                    int64_t* uncompressed_size) {
+    std::unique_ptr<parquet::arrow::FileReader> reader;
+    auto opened = OpenParquetFileFromFs(fs, path, &reader);
+    if (opened.error_code != milvus::ErrorCode::Success) {
+        return opened;
+    }
+    auto metadata = reader->parquet_reader()->metadata();
+    *num_rows = metadata->num_rows();
+    *uncompressed_size = 0;
+    for (int i = 0; i < metadata->num_row_groups(); ++i) {
+        *uncompressed_size += metadata->RowGroup(i)->total_byte_size();
+    }
+    return milvus::SuccessCStatus();
+}
+
+// ReadFileRowCountFromFs reads the number of rows stored in the footer of the
+// parquet file at path.
+static CStatus
+ReadFileRowCountFromFs(const std::shared_ptr<arrow::fs::FileSystem>& fs,
+                       const char* path,
+                       int64_t* num_rows) {
+    int64_t uncompressed_size;
+    return ReadFileStatsFromFs(fs, path, num_rows, &uncompressed_size);
+}
+
+CStatus
+GetFileRowCount(const char* path, int64_t* num_rows) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = milvus_storage::ArrowFileSystemSingleton::GetInstance()
+                          .GetArrowFileSystem();
+        return ReadFileRowCountFromFs(trueFs, path, num_rows);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetFileRowCountWithStorageConfig(const char* path,
+                                 CStorageConfig c_storage_config,
+                                 int64_t* num_rows) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = StorageConfigFs(c_storage_config);
+        return ReadFileRowCountFromFs(trueFs, path, num_rows);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetFileStats(const char* path, int64_t* num_rows, int64_t* uncompressed_size) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = milvus_storage::ArrowFileSystemSingleton::GetInstance()
+                          .GetArrowFileSystem();
+        return ReadFileStatsFromFs(trueFs, path, num_rows, uncompressed_size);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
+
+CStatus
+GetFileStatsWithStorageConfig(const char* path,
+                              CStorageConfig c_storage_config,
+                              int64_t* num_rows,
+                              int64_t* uncompressed_size) {
+    SCOPE_CGO_CALL_METRIC();
+
+    try {
+        auto trueFs = StorageConfigFs(c_storage_config);
+        return ReadFileStatsFromFs(trueFs, path, num_rows, uncompressed_size);
+    } catch (std::exception& e) {
+        return milvus::FailureCStatus(&e);
+    }
+}
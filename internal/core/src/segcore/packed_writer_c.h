@@ -25,6 +25,29 @@ extern "C" {
 
 typedef void* CPackedWriter;
 
+// CPackedCompressionCodec is the codec of a column written by a packed writer,
+// matching storagecommon.CompressionCodec.
+typedef enum CPackedCompressionCodec {
+    CPackedCompressionDefault = 0,
+    CPackedCompressionNone = 1,
+    CPackedCompressionSnappy = 2,
+    CPackedCompressionZstd = 3,
+    CPackedCompressionLZ4 = 4,
+} CPackedCompressionCodec;
+
+// CPackedWriterProperties tunes the parquet files written by a packed writer,
+// zero values keep the parquet defaults.
+typedef struct CPackedWriterProperties {
+    // max number of rows per row group
+    int64_t row_group_size;
+    // compression of the parquet columns at the dotted paths compressed_columns,
+    // a CPackedCompressionCodec and a level each, level 0 for the codec default
+    int64_t num_compressed_columns;
+    const char** compressed_columns;
+    const int32_t* compression_codecs;
+    const int32_t* compression_levels;
+} CPackedWriterProperties;
+
 CStatus
 NewPackedWriterWithStorageConfig(struct ArrowSchema* schema,
                                  const int64_t buffer_size,
@@ -34,7 +57,8 @@ NewPackedWriterWithStorageConfig(struct ArrowSchema* schema,
                                  CColumnGroups column_groups,
                                  CStorageConfig c_storage_config,
                                  CPackedWriter* c_packed_writer,
-                                 CPluginContext* c_plugin_context);
+                                 CPluginContext* c_plugin_context,
+                                 CPackedWriterProperties* c_writer_properties);
 
 CStatus
 NewPackedWriter(struct ArrowSchema* schema,
@@ -44,7 +68,8 @@ NewPackedWriter(struct ArrowSchema* schema,
                 int64_t part_upload_size,
                 CColumnGroups column_groups,
                 CPackedWriter* c_packed_writer,
-                CPluginContext* c_plugin_context);
+                CPluginContext* c_plugin_context,
+                CPackedWriterProperties* c_writer_properties);
 
 CStatus
 WriteRecordBatch(CPackedWriter c_packed_writer,
@@ -63,6 +88,37 @@ GetFileSizeWithStorageConfig(const char* path,
                              int64_t* size,
                              CStorageConfig c_storage_config);
 
+CStatus
+DeleteFile(const char* path);
+
+CStatus
+DeleteFileWithStorageConfig(const char* path, CStorageConfig c_storage_config);
+
+CStatus
+GetFileSchema(const char* path, struct ArrowSchema* out_schema);
+
+CStatus
+GetFileSchemaWithStorageConfig(const char* path,
+                               CStorageConfig c_storage_config,
+                               struct ArrowSchema* out_schema);
+
+CStatus
+GetFileRowCount(const char* path, int64_t* num_rows);
+
+CStatus
+GetFileRowCountWithStorageConfig(const char* path,
+                                 CStorageConfig c_storage_config,
+                                 int64_t* num_rows);
+
+CStatus
+GetFileStats(const char* path, int64_t* num_rows, int64_t* uncompressed_size);
+
+CStatus
+GetFileStatsWithStorageConfig(const char* path,
+                              CStorageConfig c_storage_config,
+                              int64_t* num_rows,
+                              int64_t* uncompressed_size);
+
 #ifdef __cplusplus
 }
 #endif
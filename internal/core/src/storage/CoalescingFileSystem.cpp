@@ -0,0 +1,400 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "storage/CoalescingFileSystem.h"
+
+#include <algorithm>
+#include <chrono>
+#include <cstring>
+#include <exception>
+
+#include <parquet/metadata.h>
+
+#include "log/Log.h"
+
+namespace milvus::storage {
+
+namespace {
+// kMaxLoaded is the number of coalesced reads done kept for the reads into
+// them, on top of those in flight.
+constexpr size_t kMaxLoaded = 2;
+// kFooterSize is the size of the metadata length and magic ending a parquet
+// file.
+constexpr int64_t kFooterSize = 8;
+
+// ChunkRanges returns the byte ranges of the column chunks of metadata.
+std::vector<ByteRange>
+ChunkRanges(const parquet::FileMetaData& metadata) {
+    std::vector<ByteRange> chunks;
+    for (int i = 0; i < metadata.num_row_groups(); ++i) {
+        auto row_group = metadata.RowGroup(i);
+        for (int j = 0; j < row_group->num_columns(); ++j) {
+            auto chunk = row_group->ColumnChunk(j);
+            auto offset = chunk->data_page_offset();
+            if (chunk->has_dictionary_page() &&
+                chunk->dictionary_page_offset() < offset) {
+                offset = chunk->dictionary_page_offset();
+            }
+            chunks.push_back({offset, chunk->total_compressed_size(), 0});
+        }
+    }
+    return chunks;
+}
+}  // namespace
+
+std::vector<ByteRange>
+CoalesceRanges(std::vector<ByteRange> ranges, const ReadPolicy& policy) {
+    std::sort(ranges.begin(),
+              ranges.end(),
+              [](const ByteRange& a, const ByteRange& b) {
+                  return a.offset < b.offset ||
+                         (a.offset == b.offset && a.length < b.length);
+              });
+    std::vector<ByteRange> reads;
+    for (const auto& r : ranges) {
+        if (r.length <= 0) {
+            continue;
+        }
+        if (!reads.empty()) {
+            auto& last = reads.back();
+            auto end = std::max(last.end(), r.end());
+            if (r.offset - last.end() <= policy.max_gap &&
+                (policy.max_span <= 0 ||
+                 end - last.offset <= policy.max_span)) {
+                last.gap += std::max<int64_t>(r.offset - last.end(), 0);
+                last.length = end - last.offset;
+                continue;
+            }
+        }
+        reads.push_back({r.offset, r.length, 0});
+    }
+    return reads;
+}
+
+CoalescingInputFile::CoalescingInputFile(
+    std::shared_ptr<arrow::io::RandomAccessFile> inner,
+    const ReadPolicy& policy,
+    std::shared_ptr<CoalescedReadStats> stats,
+    int64_t size)
+    : inner_(std::move(inner)),
+      policy_(policy),
+      stats_(std::move(stats)),
+      size_(size) {
+}
+
+arrow::Result<std::shared_ptr<CoalescingInputFile>>
+CoalescingInputFile::Make(std::shared_ptr<arrow::io::RandomAccessFile> inner,
+                          const ReadPolicy& policy,
+                          std::shared_ptr<CoalescedReadStats> stats) {
+    // the plan is made from the footer the parquet reader reads, not read twice
+    ARROW_ASSIGN_OR_RAISE(auto size, inner->GetSize());
+    return std::shared_ptr<CoalescingInputFile>(new CoalescingInputFile(
+        std::move(inner), policy, std::move(stats), size));
+}
+
+void
+CoalescingInputFile::PlanLocked(int64_t position,
+                                const std::shared_ptr<arrow::Buffer>& buffer) {
+    if (planned_) {
+        return;
+    }
+    // the parquet reader reads the footer from the end of the file backwards
+    if (position + buffer->size() == size_) {
+        footer_offset_ = position;
+        footer_ = buffer;
+    } else if (footer_ != nullptr &&
+               position + buffer->size() == footer_offset_) {
+        auto footer = arrow::ConcatenateBuffers({buffer, footer_});
+        if (!footer.ok()) {
+            return;
+        }
+        footer_offset_ = position;
+        footer_ = *footer;
+    } else {
+        return;
+    }
+    if (footer_->size() < kFooterSize) {
+        return;
+    }
+    auto tail = footer_->data() + footer_->size() - kFooterSize;
+    if (std::memcmp(tail + 4, "PAR1", 4) != 0) {
+        // e.g. an encrypted footer, the file is read without a plan
+        planned_ = true;
+        footer_.reset();
+        return;
+    }
+    uint32_t metadata_len = 0;
+    std::memcpy(&metadata_len, tail, sizeof(metadata_len));
+    if (footer_->size() < kFooterSize + metadata_len) {
+        return;
+    }
+    planned_ = true;
+    std::shared_ptr<parquet::FileMetaData> metadata;
+    try {
+        metadata = parquet::FileMetaData::Make(tail - metadata_len,
+                                               &metadata_len);
+    } catch (std::exception& e) {
+        LOG_WARN("[StorageV2] failed to plan coalesced reads: {}", e.what());
+        footer_.reset();
+        return;
+    }
+    footer_.reset();
+    reads_ = CoalesceRanges(ChunkRanges(*metadata), policy_);
+}
+
+void
+CoalescingInputFile::EvictLocked() {
+    auto ready = [](const Load& load) {
+        return load.buffer.wait_for(std::chrono::seconds(0)) ==
+               std::future_status::ready;
+    };
+    auto done = static_cast<size_t>(
+        std::count_if(loaded_.begin(), loaded_.end(), ready));
+    for (auto it = loaded_.begin(); it != loaded_.end() && done > kMaxLoaded;) {
+        if (ready(*it)) {
+            it = loaded_.erase(it);
+            --done;
+        } else {
+            ++it;
+        }
+    }
+}
+
+arrow::Status
+CoalescingInputFile::Close() {
+    std::lock_guard<std::mutex> lock(mutex_);
+    loaded_.clear();
+    return inner_->Close();
+}
+
+bool
+CoalescingInputFile::closed() const {
+    return inner_->closed();
+}
+
+arrow::Result<int64_t>
+CoalescingInputFile::Tell() const {
+    return position_;
+}
+
+arrow::Status
+CoalescingInputFile::Seek(int64_t position) {
+    position_ = position;
+    return arrow::Status::OK();
+}
+
+arrow::Result<int64_t>
+CoalescingInputFile::Read(int64_t nbytes, void* out) {
+    ARROW_ASSIGN_OR_RAISE(auto read, ReadAt(position_, nbytes, out));
+    position_ += read;
+    return read;
+}
+
+arrow::Result<std::shared_ptr<arrow::Buffer>>
+CoalescingInputFile::Read(int64_t nbytes) {
+    ARROW_ASSIGN_OR_RAISE(auto buffer, ReadAt(position_, nbytes));
+    position_ += buffer->size();
+    return buffer;
+}
+
+arrow::Result<int64_t>
+CoalescingInputFile::ReadAt(int64_t position, int64_t nbytes, void* out) {
+    ARROW_ASSIGN_OR_RAISE(auto buffer, ReadAt(position, nbytes));
+    std::memcpy(out, buffer->data(), buffer->size());
+    return buffer->size();
+}
+
+arrow::Result<std::shared_ptr<arrow::Buffer>>
+CoalescingInputFile::ReadAt(int64_t position, int64_t nbytes) {
+    stats_->ranges++;
+    ByteRange read;
+    size_t index = 0;
+    std::shared_future<LoadResult> pending;
+    std::promise<LoadResult> promise;
+    bool issue = false;
+    {
+        std::lock_guard<std::mutex> lock(mutex_);
+        // the coalesced read holding all of the range, if any
+        auto it = std::upper_bound(
+            reads_.begin(),
+            reads_.end(),
+            position,
+            [](int64_t p, const ByteRange& r) { return p < r.offset; });
+        if (it != reads_.begin() &&
+            position + nbytes <= std::prev(it)->end()) {
+            index = static_cast<size_t>(std::prev(it) - reads_.begin());
+            read = reads_[index];
+            for (const auto& load : loaded_) {
+                if (load.index == index) {
+                    pending = load.buffer;
+                }
+            }
+            if (!pending.valid()) {
+                pending = promise.get_future().share();
+                loaded_.push_back({index, pending});
+                EvictLocked();
+                issue = true;
+            }
+        }
+    }
+    if (!pending.valid()) {
+        ARROW_ASSIGN_OR_RAISE(auto buffer, inner_->ReadAt(position, nbytes));
+        stats_->requests++;
+        stats_->bytes_read += buffer->size();
+        std::lock_guard<std::mutex> lock(mutex_);
+        PlanLocked(position, buffer);
+        return buffer;
+    }
+    if (issue) {
+        // the reads into other spans go on while this one is read
+        auto loaded = inner_->ReadAt(read.offset, read.length);
+        if (loaded.ok()) {
+            stats_->requests++;
+            stats_->bytes_read += (*loaded)->size();
+            stats_->wasted_bytes += read.gap;
+        } else {
+            // a failed read is issued again by the next read into it
+            std::lock_guard<std::mutex> lock(mutex_);
+            loaded_.erase(std::remove_if(loaded_.begin(),
+                                         loaded_.end(),
+                                         [index](const Load& load) {
+                                             return load.index == index;
+                                         }),
+                          loaded_.end());
+        }
+        promise.set_value(std::move(loaded));
+    }
+    ARROW_ASSIGN_OR_RAISE(auto loaded, pending.get());
+    auto start = position - read.offset;
+    auto length = std::min(nbytes, loaded->size() - start);
+    return arrow::SliceBuffer(loaded, start, std::max<int64_t>(length, 0));
+}
+
+arrow::Result<int64_t>
+CoalescingInputFile::GetSize() {
+    return inner_->GetSize();
+}
+
+CoalescingFileSystem::CoalescingFileSystem(
+    std::shared_ptr<arrow::fs::FileSystem> base,
+    const ReadPolicy& policy,
+    std::shared_ptr<CoalescedReadStats> stats)
+    : arrow::fs::FileSystem(base->io_context()),
+      base_(std::move(base)),
+      policy_(policy),
+      stats_(std::move(stats)) {
+}
+
+std::string
+CoalescingFileSystem::type_name() const {
+    return base_->type_name();
+}
+
+bool
+CoalescingFileSystem::Equals(const arrow::fs::FileSystem& other) const {
+    return this == &other;
+}
+
+arrow::Result<std::string>
+CoalescingFileSystem::NormalizePath(std::string path) {
+    return base_->NormalizePath(std::move(path));
+}
+
+arrow::Result<arrow::fs::FileInfo>
+CoalescingFileSystem::GetFileInfo(const std::string& path) {
+    return base_->GetFileInfo(path);
+}
+
+arrow::Result<arrow::fs::FileInfoVector>
+CoalescingFileSystem::GetFileInfo(const arrow::fs::FileSelector& select) {
+    return base_->GetFileInfo(select);
+}
+
+arrow::Status
+CoalescingFileSystem::CreateDir(const std::string& path, bool recursive) {
+    return base_->CreateDir(path, recursive);
+}
+
+arrow::Status
+CoalescingFileSystem::DeleteDir(const std::string& path) {
+    return base_->DeleteDir(path);
+}
+
+arrow::Status
+CoalescingFileSystem::DeleteDirContents(const std::string& path,
+                                        bool missing_dir_ok) {
+    return base_->DeleteDirContents(path, missing_dir_ok);
+}
+
+arrow::Status
+CoalescingFileSystem::DeleteRootDirContents() {
+    return base_->DeleteRootDirContents();
+}
+
+arrow::Status
+CoalescingFileSystem::DeleteFile(const std::string& path) {
+    return base_->DeleteFile(path);
+}
+
+arrow::Status
+CoalescingFileSystem::Move(const std::string& src, const std::string& dest) {
+    return base_->Move(src, dest);
+}
+
+arrow::Status
+CoalescingFileSystem::CopyFile(const std::string& src,
+                               const std::string& dest) {
+    return base_->CopyFile(src, dest);
+}
+
+arrow::Result<std::shared_ptr<arrow::io::InputStream>>
+CoalescingFileSystem::OpenInputStream(const std::string& path) {
+    return base_->OpenInputStream(path);
+}
+
+arrow::Result<std::shared_ptr<arrow::io::RandomAccessFile>>
+CoalescingFileSystem::OpenInputFile(const std::string& path) {
+    ARROW_ASSIGN_OR_RAISE(auto inner, base_->OpenInputFile(path));
+    ARROW_ASSIGN_OR_RAISE(
+        auto file,
+        CoalescingInputFile::Make(std::move(inner), policy_, stats_));
+    return file;
+}
+
+arrow::Result<std::shared_ptr<arrow::io::RandomAccessFile>>
+CoalescingFileSystem::OpenInputFile(const arrow::fs::FileInfo& info) {
+    ARROW_ASSIGN_OR_RAISE(auto inner, base_->OpenInputFile(info));
+    ARROW_ASSIGN_OR_RAISE(
+        auto file,
+        CoalescingInputFile::Make(std::move(inner), policy_, stats_));
+    return file;
+}
+
+arrow::Result<std::shared_ptr<arrow::io::OutputStream>>
+CoalescingFileSystem::OpenOutputStream(
+    const std::string& path,
+    const std::shared_ptr<const arrow::KeyValueMetadata>& metadata) {
+    return base_->OpenOutputStream(path, metadata);
+}
+
+arrow::Result<std::shared_ptr<arrow::io::OutputStream>>
+CoalescingFileSystem::OpenAppendStream(
+    const std::string& path,
+    const std::shared_ptr<const arrow::KeyValueMetadata>& metadata) {
+    return base_->OpenAppendStream(path, metadata);
+}
+
+}  // namespace milvus::storage
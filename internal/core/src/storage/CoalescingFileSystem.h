@@ -0,0 +1,227 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#pragma once
+
+#include <atomic>
+#include <cstdint>
+#include <deque>
+#include <future>
+#include <memory>
+#include <mutex>
+#include <string>
+#include <utility>
+#include <vector>
+
+#include <arrow/buffer.h>
+#include <arrow/filesystem/filesystem.h>
+#include <arrow/io/interfaces.h>
+
+namespace milvus::storage {
+
+// ReadPolicy coalesces the column chunk reads of a parquet file into fewer
+// larger range reads: ranges closer than max_gap bytes are read at once, unless
+// the read would span more than max_span bytes, 0 for no cap.
+struct ReadPolicy {
+    int64_t max_span = 0;
+    int64_t max_gap = 0;
+};
+
+// ByteRange is a range of length bytes of a file from offset, with the gap
+// bytes between the column chunks it coalesces.
+struct ByteRange {
+    int64_t offset = 0;
+    int64_t length = 0;
+    int64_t gap = 0;
+
+    int64_t
+    end() const {
+        return offset + length;
+    }
+};
+
+// CoalesceRanges returns the reads of ranges under policy, in offset order.
+std::vector<ByteRange>
+CoalesceRanges(std::vector<ByteRange> ranges, const ReadPolicy& policy);
+
+// CoalescedReadStats count the reads of the files of a CoalescingFileSystem:
+// the reads asked by the parquet reader, the reads issued to the underlying
+// storage, the GETs of an object store, and the bytes these read, of which the
+// wasted ones were read only to coalesce the reads around them.
+struct CoalescedReadStats {
+    std::atomic<int64_t> ranges{0};
+    std::atomic<int64_t> requests{0};
+    std::atomic<int64_t> bytes_read{0};
+    std::atomic<int64_t> wasted_bytes{0};
+};
+
+// CoalescingInputFile serves the reads of a parquet file from the coalesced
+// reads of its column chunks, planned from the footer once the parquet reader
+// read it. A coalesced read is issued on the first read into it, without
+// holding the file locked, and kept for the reads after it: all those in flight
+// and the last two done, since the chunks of a row group are read in order. The
+// reads outside of the plan, such as those of the footer, are issued as they
+// are.
+class CoalescingInputFile : public arrow::io::RandomAccessFile {
+ public:
+    static arrow::Result<std::shared_ptr<CoalescingInputFile>>
+    Make(std::shared_ptr<arrow::io::RandomAccessFile> inner,
+         const ReadPolicy& policy,
+         std::shared_ptr<CoalescedReadStats> stats);
+
+    arrow::Status
+    Close() override;
+
+    bool
+    closed() const override;
+
+    arrow::Result<int64_t>
+    Tell() const override;
+
+    arrow::Status
+    Seek(int64_t position) override;
+
+    arrow::Result<int64_t>
+    Read(int64_t nbytes, void* out) override;
+
+    arrow::Result<std::shared_ptr<arrow::Buffer>>
+    Read(int64_t nbytes) override;
+
+    arrow::Result<int64_t>
+    ReadAt(int64_t position, int64_t nbytes, void* out) override;
+
+    arrow::Result<std::shared_ptr<arrow::Buffer>>
+    ReadAt(int64_t position, int64_t nbytes) override;
+
+    arrow::Result<int64_t>
+    GetSize() override;
+
+ private:
+    using LoadResult = arrow::Result<std::shared_ptr<arrow::Buffer>>;
+
+    // Load is the coalesced read of reads_[index], shared by the reads into it.
+    struct Load {
+        size_t index;
+        std::shared_future<LoadResult> buffer;
+    };
+
+    CoalescingInputFile(std::shared_ptr<arrow::io::RandomAccessFile> inner,
+                        const ReadPolicy& policy,
+                        std::shared_ptr<CoalescedReadStats> stats,
+                        int64_t size);
+
+    // PlanLocked adds buffer read at position to the footer read so far and
+    // plans the coalesced reads once it holds all the file metadata.
+    void
+    PlanLocked(int64_t position, const std::shared_ptr<arrow::Buffer>& buffer);
+
+    // EvictLocked drops the oldest coalesced reads done beyond the last two.
+    void
+    EvictLocked();
+
+    std::shared_ptr<arrow::io::RandomAccessFile> inner_;
+    ReadPolicy policy_;
+    std::shared_ptr<CoalescedReadStats> stats_;
+    int64_t size_;
+
+    std::mutex mutex_;
+    // footer_ is the tail of the file read from footer_offset_ until planned_.
+    bool planned_ = false;
+    int64_t footer_offset_ = 0;
+    std::shared_ptr<arrow::Buffer> footer_;
+    std::vector<ByteRange> reads_;
+    // loaded_ are the coalesced reads issued, oldest first.
+    std::deque<Load> loaded_;
+    int64_t position_ = 0;
+};
+
+// CoalescingFileSystem opens the input files of base as CoalescingInputFiles
+// under policy and counts their reads in stats; all other operations go to
+// base.
+class CoalescingFileSystem : public arrow::fs::FileSystem {
+ public:
+    CoalescingFileSystem(std::shared_ptr<arrow::fs::FileSystem> base,
+                         const ReadPolicy& policy,
+                         std::shared_ptr<CoalescedReadStats> stats);
+
+    using arrow::fs::FileSystem::GetFileInfo;
+    using arrow::fs::FileSystem::OpenInputFile;
+    using arrow::fs::FileSystem::OpenInputStream;
+
+    std::string
+    type_name() const override;
+
+    bool
+    Equals(const arrow::fs::FileSystem& other) const override;
+
+    arrow::Result<std::string>
+    NormalizePath(std::string path) override;
+
+    arrow::Result<arrow::fs::FileInfo>
+    GetFileInfo(const std::string& path) override;
+
+    arrow::Result<arrow::fs::FileInfoVector>
+    GetFileInfo(const arrow::fs::FileSelector& select) override;
+
+    arrow::Status
+    CreateDir(const std::string& path, bool recursive) override;
+
+    arrow::Status
+    DeleteDir(const std::string& path) override;
+
+    arrow::Status
+    DeleteDirContents(const std::string& path, bool missing_dir_ok) override;
+
+    arrow::Status
+    DeleteRootDirContents() override;
+
+    arrow::Status
+    DeleteFile(const std::string& path) override;
+
+    arrow::Status
+    Move(const std::string& src, const std::string& dest) override;
+
+    arrow::Status
+    CopyFile(const std::string& src, const std::string& dest) override;
+
+    arrow::Result<std::shared_ptr<arrow::io::InputStream>>
+    OpenInputStream(const std::string& path) override;
+
+    arrow::Result<std::shared_ptr<arrow::io::RandomAccessFile>>
+    OpenInputFile(const std::string& path) override;
+
+    arrow::Result<std::shared_ptr<arrow::io::RandomAccessFile>>
+    OpenInputFile(const arrow::fs::FileInfo& info) override;
+
+    arrow::Result<std::shared_ptr<arrow::io::OutputStream>>
+    OpenOutputStream(
+        const std::string& path,
+        const std::shared_ptr<const arrow::KeyValueMetadata>& metadata)
+        override;
+
+    arrow::Result<std::shared_ptr<arrow::io::OutputStream>>
+    OpenAppendStream(
+        const std::string& path,
+        const std::shared_ptr<const arrow::KeyValueMetadata>& metadata)
+        override;
+
+ private:
+    std::shared_ptr<arrow::fs::FileSystem> base_;
+    ReadPolicy policy_;
+    std::shared_ptr<CoalescedReadStats> stats_;
+};
+
+}  // namespace milvus::storage
@@ -0,0 +1,151 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <gtest/gtest.h>
+
+#include <cstring>
+#include <thread>
+
+#include <arrow/api.h>
+#include <arrow/io/memory.h>
+#include <parquet/arrow/reader.h>
+#include <parquet/arrow/writer.h>
+#include <parquet/file_reader.h>
+
+#include "storage/CoalescingFileSystem.h"
+
+using milvus::storage::ByteRange;
+using milvus::storage::CoalescedReadStats;
+using milvus::storage::CoalesceRanges;
+using milvus::storage::CoalescingInputFile;
+using milvus::storage::ReadPolicy;
+
+TEST(CoalescingFileSystem, CoalesceRanges) {
+    std::vector<ByteRange> chunks{
+        {100, 50, 0}, {0, 100, 0}, {160, 40, 0}, {1000, 10, 0}, {300, 0, 0}};
+
+    // adjacent and close chunks are read at once
+    auto reads = CoalesceRanges(chunks, ReadPolicy{0, 16});
+    ASSERT_EQ(reads.size(), 2);
+    EXPECT_EQ(reads[0].offset, 0);
+    EXPECT_EQ(reads[0].length, 200);
+    EXPECT_EQ(reads[0].gap, 10);
+    EXPECT_EQ(reads[1].offset, 1000);
+    EXPECT_EQ(reads[1].length, 10);
+
+    // the span caps the reads
+    reads = CoalesceRanges(chunks, ReadPolicy{150, 16});
+    ASSERT_EQ(reads.size(), 3);
+    EXPECT_EQ(reads[0].length, 150);
+    EXPECT_EQ(reads[1].offset, 160);
+
+    // no gap is read without a max gap
+    reads = CoalesceRanges(chunks, ReadPolicy{0, 0});
+    ASSERT_EQ(reads.size(), 3);
+    EXPECT_EQ(reads[0].gap, 0);
+}
+
+TEST(CoalescingFileSystem, PassesThroughWithoutFooter) {
+    auto data = std::string(64, 'x');
+    auto inner = std::make_shared<arrow::io::BufferReader>(
+        std::make_shared<arrow::Buffer>(data));
+    auto stats = std::make_shared<CoalescedReadStats>();
+    auto file =
+        CoalescingInputFile::Make(inner, ReadPolicy{0, 1024}, stats)
+            .ValueOrDie();
+    auto before = stats->requests.load();
+
+    auto buffer = file->ReadAt(8, 16).ValueOrDie();
+    EXPECT_EQ(buffer->size(), 16);
+    EXPECT_EQ(stats->requests.load(), before + 1);
+    ASSERT_TRUE(file->Seek(60).ok());
+    buffer = file->Read(16).ValueOrDie();
+    EXPECT_EQ(buffer->size(), 4);
+    EXPECT_EQ(file->Tell().ValueOrDie(), 64);
+}
+
+namespace {
+// ParquetFile returns a parquet file of a row group of two int64 columns.
+std::shared_ptr<arrow::Buffer>
+ParquetFile() {
+    arrow::Int64Builder a;
+    arrow::Int64Builder b;
+    for (int64_t i = 0; i < 1000; ++i) {
+        EXPECT_TRUE(a.Append(i).ok());
+        EXPECT_TRUE(b.Append(-i).ok());
+    }
+    auto schema = arrow::schema(
+        {arrow::field("a", arrow::int64()), arrow::field("b", arrow::int64())});
+    auto table = arrow::Table::Make(
+        schema, {a.Finish().ValueOrDie(), b.Finish().ValueOrDie()});
+    auto sink = arrow::io::BufferOutputStream::Create().ValueOrDie();
+    EXPECT_TRUE(parquet::arrow::WriteTable(
+                    *table, arrow::default_memory_pool(), sink, 1000)
+                    .ok());
+    return sink->Finish().ValueOrDie();
+}
+}  // namespace
+
+TEST(CoalescingFileSystem, PlansFromFooterReadByReader) {
+    auto data = ParquetFile();
+    auto inner = std::make_shared<arrow::io::BufferReader>(data);
+    auto stats = std::make_shared<CoalescedReadStats>();
+    auto file =
+        CoalescingInputFile::Make(inner, ReadPolicy{0, 1024 * 1024}, stats)
+            .ValueOrDie();
+    // the footer is only read by the parquet reader
+    EXPECT_EQ(stats->requests.load(), 0);
+
+    std::unique_ptr<parquet::arrow::FileReader> reader;
+    ASSERT_TRUE(parquet::arrow::OpenFile(
+                    file, arrow::default_memory_pool(), &reader)
+                    .ok());
+    auto footer_requests = stats->requests.load();
+    EXPECT_GT(footer_requests, 0);
+
+    // the column chunks of the row group are read at once
+    std::shared_ptr<arrow::Table> table;
+    ASSERT_TRUE(reader->ReadTable(&table).ok());
+    EXPECT_EQ(table->num_rows(), 1000);
+    EXPECT_EQ(stats->requests.load(), footer_requests + 1);
+}
+
+TEST(CoalescingFileSystem, ConcurrentReadsIntoSpan) {
+    auto data = ParquetFile();
+    auto inner = std::make_shared<arrow::io::BufferReader>(data);
+    auto stats = std::make_shared<CoalescedReadStats>();
+    auto file =
+        CoalescingInputFile::Make(inner, ReadPolicy{0, 1024 * 1024}, stats)
+            .ValueOrDie();
+    auto metadata = parquet::ReadMetaData(file);
+    auto chunk = metadata->RowGroup(0)->ColumnChunk(1);
+    auto offset = chunk->data_page_offset();
+    auto before = stats->requests.load();
+
+    // the reads into a span wait for the single read of it
+    std::vector<std::thread> threads;
+    for (int i = 0; i < 8; ++i) {
+        threads.emplace_back([&]() {
+            auto buffer = file->ReadAt(offset, 16).ValueOrDie();
+            EXPECT_EQ(
+                0, std::memcmp(buffer->data(), data->data() + offset, 16));
+        });
+    }
+    for (auto& thread : threads) {
+        thread.join();
+    }
+    EXPECT_EQ(stats->requests.load(), before + 1);
+}
@@ -18,9 +18,8 @@ KeyRetriever::GetKey(const std::string& key_metadata) {
 }
 
 parquet::ReaderProperties
-GetReaderProperties() {
-    parquet::ReaderProperties reader_properties =
-        parquet::default_reader_properties();
+GetReaderProperties(arrow::MemoryPool* pool) {
+    parquet::ReaderProperties reader_properties(pool);
     std::shared_ptr<milvus::storage::KeyRetriever> key_retriever =
         std::make_shared<milvus::storage::KeyRetriever>();
     parquet::FileDecryptionProperties::Builder builder;
@@ -10,6 +10,7 @@
 // or implied. See the License for the specific language governing permissions and limitations under the License
 
 #include "common/type_c.h"
+#include "arrow/memory_pool.h"
 #include "parquet/encryption/encryption.h"
 
 namespace milvus::storage {
@@ -20,8 +21,10 @@ class KeyRetriever : public parquet::DecryptionKeyRetriever {
     GetKey(const std::string& key_metadata) override;
 };
 
+// GetReaderProperties returns the properties of the parquet readers of packed files,
+// allocating their page and decompression buffers from pool.
 parquet::ReaderProperties
-GetReaderProperties();
+GetReaderProperties(arrow::MemoryPool* pool = arrow::default_memory_pool());
 
 std::string
 EncodeKeyMetadata(int64_t ez_id, int64_t collection_id, std::string key);
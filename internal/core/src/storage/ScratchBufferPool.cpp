@@ -0,0 +1,208 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "storage/ScratchBufferPool.h"
+
+#include <algorithm>
+#include <cstring>
+
+#include <arrow/buffer.h>
+
+namespace milvus::storage {
+
+namespace {
+// kMinSizeClass is the smallest buffer the pool caches; smaller requests are
+// rounded up to it.
+constexpr int64_t kMinSizeClass = 4096;
+}  // namespace
+
+ScratchBufferPool::ScratchBufferPool(int64_t capacity,
+                                     arrow::MemoryPool* parent)
+    : capacity_(capacity), parent_(parent) {
+}
+
+ScratchBufferPool::~ScratchBufferPool() {
+    std::lock_guard<std::mutex> lock(mutex_);
+    release_cached_locked();
+}
+
+int64_t
+ScratchBufferPool::size_class(int64_t size, int64_t alignment) const {
+    if (size <= 0 || size > capacity_ ||
+        alignment != arrow::kDefaultBufferAlignment) {
+        return 0;
+    }
+    int64_t cls = kMinSizeClass;
+    while (cls < size) {
+        cls <<= 1;
+    }
+    return cls;
+}
+
+arrow::Status
+ScratchBufferPool::Allocate(int64_t size, int64_t alignment, uint8_t** out) {
+    auto cls = size_class(size, alignment);
+    {
+        std::lock_guard<std::mutex> lock(mutex_);
+        if (cls != 0) {
+            auto it = cached_.find(cls);
+            if (it != cached_.end() && !it->second.empty()) {
+                *out = it->second.back();
+                it->second.pop_back();
+                cached_bytes_ -= cls;
+                ++stats_.reused;
+                ++stats_.allocations;
+                ++outstanding_;
+                bytes_allocated_ += cls;
+                total_bytes_ += cls;
+                max_memory_ = std::max(max_memory_, bytes_allocated_);
+                return arrow::Status::OK();
+            }
+        }
+    }
+    auto bytes = cls != 0 ? cls : size;
+    ARROW_RETURN_NOT_OK(parent_->Allocate(bytes, alignment, out));
+    std::lock_guard<std::mutex> lock(mutex_);
+    ++stats_.allocations;
+    ++outstanding_;
+    bytes_allocated_ += bytes;
+    total_bytes_ += bytes;
+    max_memory_ = std::max(max_memory_, bytes_allocated_);
+    return arrow::Status::OK();
+}
+
+arrow::Status
+ScratchBufferPool::Reallocate(int64_t old_size,
+                              int64_t new_size,
+                              int64_t alignment,
+                              uint8_t** ptr) {
+    auto old_cls = size_class(old_size, alignment);
+    auto new_cls = size_class(new_size, alignment);
+    if (old_cls != 0 && old_cls == new_cls) {
+        // the buffer already has room for new_size
+        return arrow::Status::OK();
+    }
+    if (old_cls == 0 && new_cls == 0) {
+        ARROW_RETURN_NOT_OK(
+            parent_->Reallocate(old_size, new_size, alignment, ptr));
+        std::lock_guard<std::mutex> lock(mutex_);
+        bytes_allocated_ += new_size - old_size;
+        total_bytes_ += std::max<int64_t>(new_size - old_size, 0);
+        max_memory_ = std::max(max_memory_, bytes_allocated_);
+        return arrow::Status::OK();
+    }
+    uint8_t* moved = nullptr;
+    ARROW_RETURN_NOT_OK(Allocate(new_size, alignment, &moved));
+    std::memcpy(moved, *ptr, std::min(old_size, new_size));
+    Free(*ptr, old_size, alignment);
+    *ptr = moved;
+    return arrow::Status::OK();
+}
+
+void
+ScratchBufferPool::Free(uint8_t* buffer, int64_t size, int64_t alignment) {
+    auto cls = size_class(size, alignment);
+    bool cached = false;
+    bool last = false;
+    {
+        std::lock_guard<std::mutex> lock(mutex_);
+        --outstanding_;
+        bytes_allocated_ -= cls != 0 ? cls : size;
+        if (cls != 0 && !closed_ && cached_bytes_ + cls <= capacity_) {
+            cached_[cls].push_back(buffer);
+            cached_bytes_ += cls;
+            cached = true;
+        }
+        last = closed_ && outstanding_ == 0;
+    }
+    if (!cached) {
+        parent_->Free(buffer, cls != 0 ? cls : size, alignment);
+    }
+    if (last) {
+        delete this;
+    }
+}
+
+void
+ScratchBufferPool::ReleaseUnused() {
+    {
+        std::lock_guard<std::mutex> lock(mutex_);
+        release_cached_locked();
+    }
+    parent_->ReleaseUnused();
+}
+
+void
+ScratchBufferPool::release_cached_locked() {
+    for (auto& [cls, buffers] : cached_) {
+        for (auto buffer : buffers) {
+            parent_->Free(buffer, cls, arrow::kDefaultBufferAlignment);
+        }
+    }
+    cached_.clear();
+    cached_bytes_ = 0;
+}
+
+int64_t
+ScratchBufferPool::bytes_allocated() const {
+    std::lock_guard<std::mutex> lock(mutex_);
+    return bytes_allocated_;
+}
+
+int64_t
+ScratchBufferPool::max_memory() const {
+    std::lock_guard<std::mutex> lock(mutex_);
+    return max_memory_;
+}
+
+int64_t
+ScratchBufferPool::total_bytes_allocated() const {
+    std::lock_guard<std::mutex> lock(mutex_);
+    return total_bytes_;
+}
+
+int64_t
+ScratchBufferPool::num_allocations() const {
+    std::lock_guard<std::mutex> lock(mutex_);
+    return stats_.allocations;
+}
+
+std::string
+ScratchBufferPool::backend_name() const {
+    return "scratch(" + parent_->backend_name() + ")";
+}
+
+ScratchBufferPool::Stats
+ScratchBufferPool::stats() const {
+    std::lock_guard<std::mutex> lock(mutex_);
+    return stats_;
+}
+
+void
+ScratchBufferPool::Close() {
+    bool last = false;
+    {
+        std::lock_guard<std::mutex> lock(mutex_);
+        closed_ = true;
+        release_cached_locked();
+        last = outstanding_ == 0;
+    }
+    if (last) {
+        delete this;
+    }
+}
+
+}  // namespace milvus::storage
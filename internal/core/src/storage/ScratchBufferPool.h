@@ -0,0 +1,129 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#pragma once
+
+#include <cstdint>
+#include <mutex>
+#include <string>
+#include <unordered_map>
+#include <vector>
+
+#include <arrow/memory_pool.h>
+
+namespace milvus::storage {
+
+// ScratchBufferPool is the memory pool of the page and decompression buffers of
+// a packed reader. The parquet page readers allocate a decompression buffer per
+// column chunk, so a reader of many row groups allocates and frees the same
+// sizes over and over; the pool keeps the freed buffers by power of two size
+// class, up to capacity bytes, and hands them out again instead of allocating
+// from the parent pool.
+//
+// The pool belongs to one reader and is closed with it by Close, which frees
+// the cached buffers. The buffers still allocated, such as those of batches not
+// released yet, are freed through the parent pool when they are, and the pool
+// deletes itself with the last of them, so a closed pool must not be used after
+// Close but for them.
+class ScratchBufferPool : public arrow::MemoryPool {
+ public:
+    // Stats are the allocations of the pool: all of them, and those served by a
+    // cached buffer.
+    struct Stats {
+        int64_t allocations = 0;
+        int64_t reused = 0;
+    };
+
+    explicit ScratchBufferPool(
+        int64_t capacity,
+        arrow::MemoryPool* parent = arrow::default_memory_pool());
+
+    ScratchBufferPool(const ScratchBufferPool&) = delete;
+    ScratchBufferPool&
+    operator=(const ScratchBufferPool&) = delete;
+
+    using arrow::MemoryPool::Allocate;
+    using arrow::MemoryPool::Free;
+    using arrow::MemoryPool::Reallocate;
+
+    arrow::Status
+    Allocate(int64_t size, int64_t alignment, uint8_t** out) override;
+
+    arrow::Status
+    Reallocate(int64_t old_size,
+               int64_t new_size,
+               int64_t alignment,
+               uint8_t** ptr) override;
+
+    void
+    Free(uint8_t* buffer, int64_t size, int64_t alignment) override;
+
+    void
+    ReleaseUnused() override;
+
+    int64_t
+    bytes_allocated() const override;
+
+    int64_t
+    max_memory() const override;
+
+    int64_t
+    total_bytes_allocated() const override;
+
+    int64_t
+    num_allocations() const override;
+
+    std::string
+    backend_name() const override;
+
+    Stats
+    stats() const;
+
+    // Close frees the cached buffers and deletes the pool, at once or with the
+    // last buffer still allocated.
+    void
+    Close();
+
+ private:
+    ~ScratchBufferPool() override;
+
+    // size_class returns the size a buffer of size is allocated with by the
+    // pool, or 0 if it is allocated by the parent pool as is.
+    int64_t
+    size_class(int64_t size, int64_t alignment) const;
+
+    void
+    release_cached_locked();
+
+    const int64_t capacity_;
+    arrow::MemoryPool* parent_;
+
+    mutable std::mutex mutex_;
+    std::unordered_map<int64_t, std::vector<uint8_t*>> cached_;
+    int64_t cached_bytes_ = 0;
+    // outstanding_ is the number of buffers allocated and not freed yet.
+    int64_t outstanding_ = 0;
+    bool closed_ = false;
+    // bytes_allocated_ are the bytes of the buffers allocated, rounded to the
+    // size classes, and max_memory_ their most, total_bytes_ all bytes ever
+    // allocated.
+    int64_t bytes_allocated_ = 0;
+    int64_t max_memory_ = 0;
+    int64_t total_bytes_ = 0;
+    Stats stats_;
+};
+
+}  // namespace milvus::storage
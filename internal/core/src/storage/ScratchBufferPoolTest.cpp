@@ -0,0 +1,53 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <gtest/gtest.h>
+
+#include "storage/ScratchBufferPool.h"
+
+using milvus::storage::ScratchBufferPool;
+
+TEST(ScratchBufferPool, ReusesFreedBuffers) {
+    auto parent = arrow::default_memory_pool();
+    auto before = parent->bytes_allocated();
+    auto pool = new ScratchBufferPool(1 << 20, parent);
+
+    uint8_t* first = nullptr;
+    ASSERT_TRUE(pool->Allocate(5000, &first).ok());
+    pool->Free(first, 5000);
+    // a buffer of the same size class is the one freed
+    uint8_t* second = nullptr;
+    ASSERT_TRUE(pool->Allocate(8000, &second).ok());
+    EXPECT_EQ(first, second);
+    ASSERT_TRUE(pool->Reallocate(8000, 8192, &second).ok());
+    EXPECT_EQ(first, second);
+
+    // larger than the capacity is never cached
+    uint8_t* large = nullptr;
+    ASSERT_TRUE(pool->Allocate(2 << 20, &large).ok());
+    pool->Free(large, 2 << 20);
+
+    auto stats = pool->stats();
+    EXPECT_EQ(stats.allocations, 3);
+    EXPECT_EQ(stats.reused, 1);
+    EXPECT_EQ(pool->bytes_allocated(), 8192);
+
+    // the pool is deleted with the last buffer still allocated after Close
+    pool->Close();
+    EXPECT_EQ(parent->bytes_allocated(), before + 8192);
+    pool->Free(second, 8192);
+    EXPECT_EQ(parent->bytes_allocated(), before);
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/cdata"
 	"github.com/apache/arrow/go/v17/arrow/memory"
 	"github.com/samber/lo"
 
@@ -237,6 +238,25 @@ func appendValueAt(builder array.Builder, a arrow.Array, idx int, defaultValue *
 	}
 }
 
+// ExportRecordToCData exports r through the Arrow C data interface into out and outSchema,
+// handing its buffers to a cgo consumer such as an index builder without copying them.
+// The buffers are not copied whether they were allocated by Go or by the packed reader
+// in C, so the consumer must not modify them.
+//
+// The export takes its own reference of r: the caller still releases r as usual, and the
+// buffers stay valid after that, and past the next read of the reader r came from, until
+// the consumer calls the release callbacks of out and outSchema. The consumer must call
+// each of them exactly once, or the record is never freed. Only the records of the arrow
+// readers and serializers can be exported.
+func ExportRecordToCData(r Record, out *cdata.CArrowArray, outSchema *cdata.CArrowSchema) error {
+	sar, ok := r.(*simpleArrowRecord)
+	if !ok {
+		return merr.WrapErrParameterInvalidMsg("record of type %T cannot be exported to the arrow C data interface", r)
+	}
+	cdata.ExportArrowRecordBatch(sar.r, out, outSchema)
+	return nil
+}
+
 // GenerateEmptyArrayFromSchema generate empty array from schema
 // If schema has default value, the array will bef filled with it.
 // Otherwise, null will be used instead.
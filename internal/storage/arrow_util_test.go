@@ -20,9 +20,15 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/cdata"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 )
 
 func TestGenerateEmptyArray(t *testing.T) {
@@ -231,3 +237,36 @@ func TestGenerateEmptyArray(t *testing.T) {
 		})
 	}
 }
+
+func TestExportRecordToCData(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+	}}
+	values := []*Value{
+		{Value: map[FieldID]any{common.RowIDField: int64(1), common.TimeStampField: int64(1), 100: []float32{1, 2}}},
+		{Value: map[FieldID]any{common.RowIDField: int64(2), common.TimeStampField: int64(1), 100: []float32{3, 4}}},
+	}
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	vectors := rec.Column(100).(*array.FixedSizeBinary).Value(1)
+
+	var out cdata.CArrowArray
+	var outSchema cdata.CArrowSchema
+	require.NoError(t, ExportRecordToCData(rec, &out, &outSchema))
+	// the export keeps the buffers alive past the release of the caller
+	rec.Release()
+
+	imported, err := cdata.ImportCRecordBatch(&out, &outSchema)
+	require.NoError(t, err)
+	defer imported.Release()
+	assert.Equal(t, int64(2), imported.NumRows())
+	assert.Equal(t, []int64{1, 2}, imported.Column(0).(*array.Int64).Int64Values())
+	exported := imported.Column(2).(*array.FixedSizeBinary).Value(1)
+	assert.Equal(t, vectors, exported)
+	assert.Same(t, &vectors[0], &exported[0])
+
+	err = ExportRecordToCData(&compositeRecord{}, &out, &outSchema)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
@@ -0,0 +1,202 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"unsafe"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// castagnoli is the CRC-32C table, computed with the CPU instructions where available.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// BatchChecksums is the sidecar of WithBatchChecksums, the CRC-32C of every field of every
+// batch written. Rows holds the rows of each batch, Fields the checksums of the batches
+// of each field in the same order.
+type BatchChecksums struct {
+	Rows   []int64              `json:"rows"`
+	Fields map[FieldID][]uint32 `json:"fields"`
+}
+
+// ReadBatchChecksums reads the sidecar of WithBatchChecksums at sidecarPath.
+func ReadBatchChecksums(ctx context.Context, cm ChunkManager, sidecarPath string) (*BatchChecksums, error) {
+	data, err := cm.Read(ctx, sidecarPath)
+	if err != nil {
+		return nil, merr.WrapErrIoFailed(sidecarPath, err)
+	}
+	sums := &BatchChecksums{}
+	if err := json.Unmarshal(data, sums); err != nil {
+		return nil, merr.WrapErrParameterInvalid("valid JSON", string(data), err.Error())
+	}
+	for fieldID, fieldSums := range sums.Fields {
+		if len(fieldSums) != len(sums.Rows) {
+			return nil, merr.WrapErrParameterInvalidMsg("batch checksums at %s hold %d checksums of field %d for %d batches",
+				sidecarPath, len(fieldSums), fieldID, len(sums.Rows))
+		}
+	}
+	return sums, nil
+}
+
+// addBatch appends the checksums of rec, whose columns are the fields in order.
+func (sums *BatchChecksums) addBatch(rec arrow.Record, fields []*schemapb.FieldSchema) {
+	if rec.NumRows() == 0 {
+		return
+	}
+	sums.Rows = append(sums.Rows, rec.NumRows())
+	for i, field := range fields {
+		sums.Fields[field.GetFieldID()] = append(sums.Fields[field.GetFieldID()], checksumColumn(0, rec.Column(i), 0, int(rec.NumRows())))
+	}
+}
+
+// checksumColumn updates crc with the values of the rows [from, to) of col. The checksum
+// of a range is the checksum of its parts in order, so that the batches written are
+// checked whatever the batches they are read in, and the same for the string layouts
+// and dictionary encoding a field is written or read in.
+func checksumColumn(crc uint32, col arrow.Array, from, to int) uint32 {
+	var scratch [4]byte
+	null := []byte{0xff}
+	writeBytes := func(b []byte) {
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(b)))
+		crc = crc32.Update(crc, castagnoli, scratch[:])
+		crc = crc32.Update(crc, castagnoli, b)
+	}
+	if dict, ok := col.(*array.Dictionary); ok {
+		for i := from; i < to; i++ {
+			if dict.IsNull(i) {
+				crc = crc32.Update(crc, castagnoli, null)
+				continue
+			}
+			idx := dict.GetValueIndex(i)
+			crc = checksumColumn(crc, dict.Dictionary(), idx, idx+1)
+		}
+		return crc
+	}
+	if fw, ok := col.DataType().(arrow.FixedWidthDataType); ok && fw.BitWidth()%8 == 0 {
+		width := fw.BitWidth() / 8
+		data := col.Data()
+		values := data.Buffers()[1].Bytes()
+		if col.NullN() == 0 {
+			return crc32.Update(crc, castagnoli, values[(data.Offset()+from)*width:(data.Offset()+to)*width])
+		}
+		for i := from; i < to; i++ {
+			if col.IsNull(i) {
+				crc = crc32.Update(crc, castagnoli, null)
+				continue
+			}
+			crc = crc32.Update(crc, castagnoli, values[(data.Offset()+i)*width:(data.Offset()+i+1)*width])
+		}
+		return crc
+	}
+	for i := from; i < to; i++ {
+		if col.IsNull(i) {
+			crc = crc32.Update(crc, castagnoli, null)
+			continue
+		}
+		switch c := col.(type) {
+		case *array.Boolean:
+			if c.Value(i) {
+				crc = crc32.Update(crc, castagnoli, []byte{1})
+			} else {
+				crc = crc32.Update(crc, castagnoli, []byte{0})
+			}
+		case interface{ Value(int) string }:
+			s := c.Value(i)
+			writeBytes(unsafe.Slice(unsafe.StringData(s), len(s)))
+		case interface{ Value(int) []byte }:
+			writeBytes(c.Value(i))
+		default:
+			s := col.ValueStr(i)
+			writeBytes(unsafe.Slice(unsafe.StringData(s), len(s)))
+		}
+	}
+	return crc
+}
+
+// batchChecksumVerifier checks the batches read from paths against the checksums of the
+// batches written, see WithChecksumVerification. The rows of the batch written checked
+// next are hashed into crcs as read, offset of them so far.
+type batchChecksumVerifier struct {
+	paths  []string
+	sums   *BatchChecksums
+	batch  int
+	offset int64
+	crcs   map[FieldID]uint32
+}
+
+func newBatchChecksumVerifier(paths []string, sums *BatchChecksums, field2Col map[FieldID]int) (*batchChecksumVerifier, error) {
+	for fieldID := range field2Col {
+		if _, ok := sums.Fields[fieldID]; !ok {
+			return nil, merr.WrapErrParameterInvalidMsg("packed files %v carry no checksums of field %d", paths, fieldID)
+		}
+	}
+	return &batchChecksumVerifier{paths: paths, sums: sums, crcs: make(map[FieldID]uint32)}, nil
+}
+
+// reset restarts the verification at the first row, for files reopened.
+func (v *batchChecksumVerifier) reset() {
+	v.batch, v.offset = 0, 0
+	clear(v.crcs)
+}
+
+// verify hashes the rows of rec, whose columns are at field2Col, failing with the batch
+// written whose checksum does not match once all its rows are read.
+func (v *batchChecksumVerifier) verify(rec arrow.Record, field2Col map[FieldID]int) error {
+	for from := int64(0); from < rec.NumRows(); {
+		if v.batch >= len(v.sums.Rows) {
+			return merr.WrapErrIoFailedReason(fmt.Sprintf("packed files %v hold more rows than the %d batches checksummed",
+				v.paths, len(v.sums.Rows)))
+		}
+		to := min(rec.NumRows(), from+v.sums.Rows[v.batch]-v.offset)
+		for fieldID, col := range field2Col {
+			v.crcs[fieldID] = checksumColumn(v.crcs[fieldID], rec.Column(col), int(from), int(to))
+		}
+		v.offset += to - from
+		from = to
+		if v.offset < v.sums.Rows[v.batch] {
+			continue
+		}
+		for fieldID, crc := range v.crcs {
+			if expected := v.sums.Fields[fieldID][v.batch]; crc != expected {
+				return merr.WrapErrIoFailedReason(fmt.Sprintf("checksum mismatch of field %d in batch %d of packed files %v, expected %08x, got %08x",
+					fieldID, v.batch, v.paths, expected, crc))
+			}
+		}
+		v.batch++
+		v.offset = 0
+		clear(v.crcs)
+	}
+	return nil
+}
+
+// finish fails if the files ended before all batches checksummed were read.
+func (v *batchChecksumVerifier) finish() error {
+	if v.batch < len(v.sums.Rows) {
+		return merr.WrapErrIoFailedReason(fmt.Sprintf("packed files %v ended in batch %d of the %d batches checksummed",
+			v.paths, v.batch, len(v.sums.Rows)))
+	}
+	return nil
+}
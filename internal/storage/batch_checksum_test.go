@@ -0,0 +1,165 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/objectstorage"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestChecksumColumn(t *testing.T) {
+	build := func(b array.Builder, values []string) {
+		for _, v := range values {
+			if v == "" {
+				b.AppendNull()
+				continue
+			}
+			switch b := b.(type) {
+			case *array.StringBuilder:
+				b.Append(v)
+			case *array.LargeStringBuilder:
+				b.Append(v)
+			}
+		}
+	}
+	values := []string{"a", "", "bc", "def"}
+	strs := array.NewStringBuilder(memory.DefaultAllocator)
+	build(strs, values)
+	str := strs.NewArray()
+	defer str.Release()
+	larges := array.NewLargeStringBuilder(memory.DefaultAllocator)
+	build(larges, values)
+	large := larges.NewArray()
+	defer large.Release()
+
+	whole := checksumColumn(0, str, 0, 4)
+	assert.Equal(t, whole, checksumColumn(checksumColumn(0, str, 0, 1), str, 1, 4))
+	assert.Equal(t, whole, checksumColumn(0, large, 0, 4))
+	assert.NotEqual(t, whole, checksumColumn(0, str, 1, 4))
+
+	ints := array.NewInt64Builder(memory.DefaultAllocator)
+	ints.AppendValues([]int64{1, 2, 3}, nil)
+	col := ints.NewArray()
+	defer col.Release()
+	slice := array.NewSlice(col, 1, 3)
+	defer slice.Release()
+	assert.Equal(t, checksumColumn(0, col, 1, 3), checksumColumn(0, slice, 0, 2))
+}
+
+func TestPackedBatchChecksums(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cm := NewLocalChunkManager(objectstorage.RootPath(dir))
+	paths := []string{"/tmp/batch_checksums/0"}
+	sidecar := path.Join(dir, "checksums")
+	// batches of 7 rows
+	writePackedTestSegment(t, paths, 20, WithBatchChecksums(cm, sidecar))
+	sums, err := ReadBatchChecksums(ctx, cm, sidecar)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{7, 7, 6}, sums.Rows)
+
+	readAll := func(opts ...PackedReaderOption) error {
+		reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024, nil, nil, opts...)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		for {
+			_, err := reader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	assert.NoError(t, readAll(WithChecksumVerification(cm, sidecar)))
+	assert.NoError(t, readAll(WithChecksumVerification(cm, sidecar), WithMaxRecordBytes(64)))
+
+	t.Run("retried close", func(t *testing.T) {
+		// the sidecar cannot be written under a regular file
+		blocker := path.Join(dir, "blocker")
+		require.NoError(t, os.WriteFile(blocker, nil, 0o600))
+		sidecar := path.Join(blocker, "checksums")
+		group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+		for i := range generateTestSchema().Fields {
+			group.Columns = append(group.Columns, i)
+		}
+		pw, err := NewPackedRecordWriter("", []string{"/tmp/batch_checksums/retried"}, generateTestSchema(), 1024*1024, 0,
+			[]storagecommon.ColumnGroup{group}, nil, nil, WithBatchChecksums(cm, sidecar))
+		require.NoError(t, err)
+		assert.Error(t, pw.Close())
+		// the native writer is not closed again
+		assert.Error(t, pw.Close())
+		require.NoError(t, os.Remove(blocker))
+		require.NoError(t, pw.Close())
+		sums, err := ReadBatchChecksums(ctx, cm, sidecar)
+		require.NoError(t, err)
+		assert.Empty(t, sums.Rows)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		corrupt := path.Join(dir, "corrupt")
+		sums.Fields[common.RowIDField][1] ^= 1
+		require.NoError(t, writeJSONSidecar(context.TODO(), cm, corrupt, sums))
+		sums.Fields[common.RowIDField][1] ^= 1
+		err := readAll(WithChecksumVerification(cm, corrupt))
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+		assert.ErrorContains(t, err, "field 0 in batch 1")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		longer := path.Join(dir, "longer")
+		padded := &BatchChecksums{Rows: append(append([]int64{}, sums.Rows...), 5), Fields: make(map[FieldID][]uint32)}
+		for fieldID, fieldSums := range sums.Fields {
+			padded.Fields[fieldID] = append(append([]uint32{}, fieldSums...), 0)
+		}
+		require.NoError(t, writeJSONSidecar(context.TODO(), cm, longer, padded))
+		assert.ErrorContains(t, readAll(WithChecksumVerification(cm, longer)), "ended in batch 3")
+	})
+
+	t.Run("no checksums", func(t *testing.T) {
+		err := readAll(WithChecksumVerification(cm, path.Join(dir, "missing")))
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+
+		invalid := path.Join(dir, "invalid")
+		require.NoError(t, writeSidecar(context.TODO(), cm, invalid, []byte("{")))
+		err = readAll(WithChecksumVerification(cm, invalid))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+		partial := path.Join(dir, "partial")
+		fieldSums := sums.Fields[common.RowIDField]
+		delete(sums.Fields, common.RowIDField)
+		require.NoError(t, writeJSONSidecar(context.TODO(), cm, partial, sums))
+		sums.Fields[common.RowIDField] = fieldSums
+		assert.ErrorContains(t, readAll(WithChecksumVerification(cm, partial)), "no checksums of field 0")
+	})
+}
@@ -74,7 +74,10 @@ type Value struct {
 	PK        PrimaryKey
 	Timestamp int64
 	IsDeleted bool
-	Value     interface{}
+	// Incomplete is set on the rows merged of partial updates without a base row, see
+	// WithIncompletePartials, which hold only the fields the updates set.
+	Incomplete bool
+	Value      interface{}
 }
 
 // Blob is a pack of key&value
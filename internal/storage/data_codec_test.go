@@ -100,6 +100,7 @@ func assertTestDataInternal(t *testing.T, i int, value *Value, lazy bool) {
 		&Int64PrimaryKey{Value: int64(i)},
 		int64(i),
 		false,
+		false,
 		map[FieldID]interface{}{
 			common.TimeStampField: int64(i),
 			common.RowIDField:     int64(i),
@@ -153,6 +154,7 @@ func assertTestAddedFieldData(t *testing.T, i int, value *Value) {
 		&Int64PrimaryKey{Value: int64(i)},
 		int64(i),
 		false,
+		false,
 		map[FieldID]interface{}{
 			common.TimeStampField: int64(i),
 			common.RowIDField:     int64(i),
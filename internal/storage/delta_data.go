@@ -18,6 +18,7 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"sync"
@@ -139,6 +140,65 @@ func NewDeltaDataWithData(pks PrimaryKeys, tss []uint64) (*DeltaData, error) {
 	return dd, nil
 }
 
+// DeleteSet is the latest delete timestamp of each deleted primary key, keyed by the
+// raw pk value for hash lookups while scanning rows.
+type DeleteSet struct {
+	pkTs map[any]Timestamp
+}
+
+func NewDeleteSet() *DeleteSet {
+	return &DeleteSet{pkTs: make(map[any]Timestamp)}
+}
+
+// NewDeleteSetFromDeltaData builds the delete set of all delete tuples in dd.
+func NewDeleteSetFromDeltaData(dd *DeltaData) *DeleteSet {
+	ds := NewDeleteSet()
+	for i := 0; i < int(dd.DeleteRowCount()); i++ {
+		ds.Add(dd.DeletePks().Get(i), dd.DeleteTimestamps()[i])
+	}
+	return ds
+}
+
+// Add records the delete of pk at ts, keeping the latest delete of a pk.
+func (ds *DeleteSet) Add(pk PrimaryKey, ts Timestamp) {
+	if old, ok := ds.pkTs[pk.GetValue()]; !ok || ts > old {
+		ds.pkTs[pk.GetValue()] = ts
+	}
+}
+
+// IsDeleted reports whether the row of raw pk value pk written at ts is deleted, by a
+// delete at or after ts. A nil delete set deletes nothing.
+func (ds *DeleteSet) IsDeleted(pk any, ts Timestamp) bool {
+	if ds == nil {
+		return false
+	}
+	deleteTs, ok := ds.pkTs[pk]
+	return ok && ts <= deleteTs
+}
+
+// NewDeleteSetFromReader builds the delete set of all delete logs read from reader, such
+// as the deltalog reader of CreateDeltalogReader.
+func NewDeleteSetFromReader(reader DeserializeReader[*DeleteLog]) (*DeleteSet, error) {
+	ds := NewDeleteSet()
+	for {
+		dl, err := reader.NextValue()
+		if err == io.EOF {
+			return ds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ds.Add((*dl).Pk, (*dl).Ts)
+	}
+}
+
+func (ds *DeleteSet) Len() int {
+	if ds == nil {
+		return 0
+	}
+	return len(ds.pkTs)
+}
+
 type DeleteLog struct {
 	Pk     PrimaryKey `json:"pk"`
 	Ts     uint64     `json:"ts"`
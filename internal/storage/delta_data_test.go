@@ -19,6 +19,8 @@ package storage
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
@@ -284,3 +286,29 @@ func (s *DeltaDataSuite) TestAppend() {
 func TestDeltaData(t *testing.T) {
 	suite.Run(t, new(DeltaDataSuite))
 }
+
+func TestDeleteSet(t *testing.T) {
+	dd, err := NewDeltaDataWithPkType(3, schemapb.DataType_VarChar)
+	require.NoError(t, err)
+	require.NoError(t, dd.Append(NewVarCharPrimaryKey("a"), 10))
+	require.NoError(t, dd.Append(NewVarCharPrimaryKey("a"), 5))
+	require.NoError(t, dd.Append(NewVarCharPrimaryKey("b"), 20))
+
+	ds := NewDeleteSetFromDeltaData(dd)
+	assert.Equal(t, 2, ds.Len())
+	assert.True(t, ds.IsDeleted("a", 9))
+	assert.True(t, ds.IsDeleted("a", 10))
+	assert.False(t, ds.IsDeleted("a", 11))
+	assert.True(t, ds.IsDeleted("b", 10))
+	assert.False(t, ds.IsDeleted("c", 0))
+
+	// a delete at ts 0 deletes the rows written at ts 0
+	ds.Add(NewVarCharPrimaryKey("c"), 0)
+	assert.Equal(t, 3, ds.Len())
+	assert.True(t, ds.IsDeleted("c", 0))
+	assert.False(t, ds.IsDeleted("c", 1))
+
+	var none *DeleteSet
+	assert.Equal(t, 0, none.Len())
+	assert.False(t, none.IsDeleted("a", 0))
+}
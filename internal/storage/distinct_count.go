@@ -0,0 +1,158 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// hllPrecision is the number of hash bits indexing the registers of a HyperLogLog sketch,
+// for 2^14 registers and a standard error of 1.04/sqrt(2^14), about 0.81%.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct 64-bit hashes added to it in a fixed 16KiB.
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	index := hash >> (64 - hllPrecision)
+	// the guard bit caps the rank if the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// mixHash is the finalizer of murmur3, spreading the bits of v over the whole hash.
+func mixHash(v uint64) uint64 {
+	v ^= v >> 33
+	v *= 0xff51afd7ed558ccd
+	v ^= v >> 33
+	v *= 0xc4ceb9fe1a85ec53
+	v ^= v >> 33
+	return v
+}
+
+// hashString is the FNV-1a hash of s, mixed by mixHash.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return mixHash(h)
+}
+
+// distinctCounter sketches the non-null values of fields, see WithDistinctCounts.
+type distinctCounter struct {
+	fields   []*schemapb.FieldSchema
+	sketches map[FieldID]*hyperLogLog
+}
+
+func newDistinctCounter(schema *schemapb.CollectionSchema, fieldIDs []FieldID) (*distinctCounter, error) {
+	c := &distinctCounter{sketches: make(map[FieldID]*hyperLogLog, len(fieldIDs))}
+	for _, fieldID := range fieldIDs {
+		field := typeutil.GetField(schema, fieldID)
+		if field == nil {
+			return nil, merr.WrapErrFieldNotFound(fieldID)
+		}
+		switch field.GetDataType() {
+		case schemapb.DataType_Bool, schemapb.DataType_Int8, schemapb.DataType_Int16, schemapb.DataType_Int32,
+			schemapb.DataType_Int64, schemapb.DataType_Timestamptz, schemapb.DataType_Float, schemapb.DataType_Double,
+			schemapb.DataType_VarChar, schemapb.DataType_String:
+		default:
+			return nil, merr.WrapErrParameterInvalidMsg("distinct count of field %d of type %s is not supported",
+				fieldID, field.GetDataType())
+		}
+		c.fields = append(c.fields, field)
+		c.sketches[fieldID] = &hyperLogLog{}
+	}
+	return c, nil
+}
+
+func (c *distinctCounter) add(rec Record) {
+	for _, field := range c.fields {
+		sketch := c.sketches[field.GetFieldID()]
+		col := rec.Column(field.GetFieldID())
+		add := func(hash func(i int) uint64) {
+			for i := 0; i < col.Len(); i++ {
+				if !col.IsNull(i) {
+					sketch.add(hash(i))
+				}
+			}
+		}
+		switch col := col.(type) {
+		case *array.Boolean:
+			add(func(i int) uint64 {
+				if col.Value(i) {
+					return mixHash(1)
+				}
+				return mixHash(0)
+			})
+		case *array.Int8:
+			add(func(i int) uint64 { return mixHash(uint64(col.Value(i))) })
+		case *array.Int16:
+			add(func(i int) uint64 { return mixHash(uint64(col.Value(i))) })
+		case *array.Int32:
+			add(func(i int) uint64 { return mixHash(uint64(col.Value(i))) })
+		case *array.Int64:
+			add(func(i int) uint64 { return mixHash(uint64(col.Value(i))) })
+		case *array.Float32:
+			add(func(i int) uint64 { return mixHash(uint64(math.Float32bits(col.Value(i)))) })
+		case *array.Float64:
+			add(func(i int) uint64 { return mixHash(math.Float64bits(col.Value(i))) })
+		case *array.String:
+			add(func(i int) uint64 { return hashString(col.Value(i)) })
+		case *array.LargeString:
+			add(func(i int) uint64 { return hashString(col.Value(i)) })
+		}
+	}
+}
+
+func (c *distinctCounter) counts() map[FieldID]uint64 {
+	counts := make(map[FieldID]uint64, len(c.sketches))
+	for fieldID, sketch := range c.sketches {
+		counts[fieldID] = sketch.estimate()
+	}
+	return counts
+}
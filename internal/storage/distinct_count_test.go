@@ -0,0 +1,93 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 200000} {
+		ints, strs := &hyperLogLog{}, &hyperLogLog{}
+		for round := 0; round < 2; round++ {
+			for i := 0; i < n; i++ {
+				ints.add(mixHash(uint64(i)))
+				strs.add(hashString(fmt.Sprint(i)))
+			}
+		}
+		assert.InDelta(t, n, ints.estimate(), 0.03*float64(n)+1, "%d ints", n)
+		assert.InDelta(t, n, strs.estimate(), 0.03*float64(n)+1, "%d strings", n)
+	}
+}
+
+func TestDistinctCounts(t *testing.T) {
+	t.Run("packed reader", func(t *testing.T) {
+		writePackedTestSegment(t, []string{"/tmp/distinct/0"}, 100)
+		schema := generateTestSchema()
+		reader, err := newPackedRecordReader([]string{"/tmp/distinct/0"}, schema, 1024, nil, nil,
+			WithDistinctCounts([]FieldID{10, 13, 16}))
+		require.NoError(t, err)
+		defer reader.Close()
+		_, err = reader.DistinctCounts()
+		assert.ErrorIs(t, err, merr.ErrServiceInternal)
+		for {
+			if _, err := reader.Next(); err != nil {
+				break
+			}
+		}
+		counts, err := reader.DistinctCounts()
+		require.NoError(t, err)
+		assert.Len(t, counts, 3)
+		assert.Equal(t, uint64(1), counts[10])
+		assert.InDelta(t, 100, counts[13], 2)
+		assert.InDelta(t, 100, counts[16], 2)
+
+		_, err = newPackedRecordReader([]string{"/tmp/distinct/0"}, schema, 1024, nil, nil, WithDistinctCounts([]FieldID{102}))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("nulls", func(t *testing.T) {
+		schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "tag", DataType: schemapb.DataType_VarChar, Nullable: true},
+		}}
+		var values []*Value
+		for i := 0; i < 10; i++ {
+			var tag any
+			if i%2 == 0 {
+				tag = fmt.Sprint(i % 4)
+			}
+			values = append(values, &Value{Value: map[FieldID]any{common.RowIDField: int64(i), common.TimeStampField: int64(1), 100: tag}})
+		}
+		rec, err := ValueSerializer(values, schema)
+		require.NoError(t, err)
+		defer rec.Release()
+		counter, err := newDistinctCounter(schema, []FieldID{100})
+		require.NoError(t, err)
+		counter.add(rec)
+		assert.Equal(t, map[FieldID]uint64{100: 2}, counter.counts())
+	})
+}
@@ -17,6 +17,13 @@
 package storage
 
 import (
+	"cmp"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
 	"github.com/cockroachdb/errors"
 	"go.uber.org/zap"
 
@@ -25,8 +32,11 @@ import (
 	"github.com/milvus-io/milvus/internal/util/bloomfilter"
 	"github.com/milvus-io/milvus/pkg/v2/common"
 	"github.com/milvus-io/milvus/pkg/v2/log"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
 )
 
 // FieldStats contains statistics data for any column
@@ -491,3 +501,314 @@ func DeserializeFieldStats(blob *Blob) ([]*FieldStats, error) {
 	}
 	return stats, nil
 }
+
+// ScalarFieldStats are the statistics of a scalar field over the packed files of a
+// segment computed by ComputeFieldStats, e.g. to build zone maps for predicate pushdown.
+type ScalarFieldStats struct {
+	FieldID FieldID
+	Type    schemapb.DataType
+	// Min and Max are nil if the field holds no non-null value. NaN values are ignored
+	// by all stats but the row count.
+	Min       ScalarFieldValue
+	Max       ScalarFieldValue
+	RowCount  int64
+	NullCount int64
+	// DistinctCount is the number of distinct non-null values, -1 unless computed
+	// with WithDistinctCount.
+	DistinctCount int64
+}
+
+// HasMinMax tells whether Min and Max are defined, which they are not for fields
+// holding only nulls and for empty segments. Skip decisions must not prune on them then.
+func (s *ScalarFieldStats) HasMinMax() bool {
+	return s.Min != nil && s.Max != nil
+}
+
+type computeFieldStatsOptions struct {
+	countDistinct bool
+}
+
+type ComputeFieldStatsOption func(*computeFieldStatsOptions)
+
+// WithDistinctCount makes ComputeFieldStats count the distinct values of each field,
+// holding every distinct value of the segment in memory.
+func WithDistinctCount() ComputeFieldStatsOption {
+	return func(o *computeFieldStatsOptions) {
+		o.countDistinct = true
+	}
+}
+
+// ComputeFieldStats computes the statistics of the scalar fields fieldIDs over the packed
+// files at paths. Only the columns of fieldIDs are read and the statistics are computed
+// from the arrow columns without deserializing values.
+func ComputeFieldStats(
+	paths []string,
+	schema *schemapb.CollectionSchema,
+	fieldIDs []FieldID,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...ComputeFieldStatsOption,
+) (map[FieldID]*ScalarFieldStats, error) {
+	options := &computeFieldStatsOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if len(fieldIDs) == 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("no field to compute stats of")
+	}
+	accumulators := make(map[FieldID]fieldStatsAccumulator, len(fieldIDs))
+	for _, fieldID := range fieldIDs {
+		field := typeutil.GetField(schema, fieldID)
+		if field == nil {
+			return nil, merr.WrapErrFieldNotFound(fieldID)
+		}
+		acc, err := newFieldStatsAccumulator(field.GetDataType(), options.countDistinct)
+		if err != nil {
+			return nil, err
+		}
+		accumulators[fieldID] = acc
+	}
+
+	reader, err := newPackedRecordReader(paths, projectSchema(schema, typeutil.NewSet(fieldIDs...)), bufferSize, storageConfig, storagePluginContext)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for fieldID, acc := range accumulators {
+			acc.add(rec.Column(fieldID))
+		}
+	}
+
+	stats := make(map[FieldID]*ScalarFieldStats, len(accumulators))
+	for fieldID, acc := range accumulators {
+		dataType := typeutil.GetField(schema, fieldID).GetDataType()
+		stats[fieldID] = acc.stats(fieldID, dataType)
+	}
+	return stats, nil
+}
+
+type fieldStatsAccumulator interface {
+	add(arr arrow.Array)
+	stats(fieldID FieldID, dataType schemapb.DataType) *ScalarFieldStats
+}
+
+func newFieldStatsAccumulator(dataType schemapb.DataType, countDistinct bool) (fieldStatsAccumulator, error) {
+	switch dataType {
+	case schemapb.DataType_Int8:
+		return newMinMaxAccumulator[int8](countDistinct), nil
+	case schemapb.DataType_Int16:
+		return newMinMaxAccumulator[int16](countDistinct), nil
+	case schemapb.DataType_Int32:
+		return newMinMaxAccumulator[int32](countDistinct), nil
+	case schemapb.DataType_Int64, schemapb.DataType_Timestamptz:
+		return newMinMaxAccumulator[int64](countDistinct), nil
+	case schemapb.DataType_Float:
+		return newMinMaxAccumulator[float32](countDistinct), nil
+	case schemapb.DataType_Double:
+		return newMinMaxAccumulator[float64](countDistinct), nil
+	case schemapb.DataType_String, schemapb.DataType_VarChar:
+		return newMinMaxAccumulator[string](countDistinct), nil
+	default:
+		return nil, merr.WrapErrParameterInvalidMsg("field stats of data type %s are not supported", dataType.String())
+	}
+}
+
+// minMaxAccumulator accumulates the stats of arrow arrays whose values are of type T.
+type minMaxAccumulator[T cmp.Ordered] struct {
+	min, max      T
+	seen          bool
+	rows          int64
+	nulls         int64
+	distinct      map[T]struct{}
+	countDistinct bool
+	// clone copies the smallest and largest values kept out of the buffers of the arrays
+	// added, which may be released once added.
+	clone func(T) T
+}
+
+func newMinMaxAccumulator[T cmp.Ordered](countDistinct bool) *minMaxAccumulator[T] {
+	acc := &minMaxAccumulator[T]{countDistinct: countDistinct, clone: identity[T]}
+	if clone, ok := any(strings.Clone).(func(T) T); ok {
+		acc.clone = clone
+	}
+	if countDistinct {
+		acc.distinct = make(map[T]struct{})
+	}
+	return acc
+}
+
+func (a *minMaxAccumulator[T]) add(arr arrow.Array) {
+	a.rows += int64(arr.Len())
+	a.nulls += int64(arr.NullN())
+	if a.countDistinct {
+		value := arrayValue[T](arr)
+		for i := 0; i < arr.Len(); i++ {
+			if arr.IsNull(i) {
+				continue
+			}
+			// NaN
+			if v := value(i); v == v {
+				a.distinct[v] = struct{}{}
+			}
+		}
+	}
+	low, high, seen := arrayMinMax[T](arr)
+	if !seen {
+		return
+	}
+	// the values of arr are copied once per array, not on every new smallest or largest
+	if !a.seen || low < a.min {
+		a.min = a.clone(low)
+	}
+	if !a.seen || high > a.max {
+		a.max = a.clone(high)
+	}
+	a.seen = true
+}
+
+// arrayValue returns the accessor of the values of arr, whose values are of type T, which
+// may be dictionary-encoded.
+func arrayValue[T any](arr arrow.Array) func(int) T {
+	if dict, ok := arr.(*array.Dictionary); ok {
+		values := dict.Dictionary().(interface{ Value(int) T })
+		return func(i int) T { return values.Value(dict.GetValueIndex(i)) }
+	}
+	return arr.(interface{ Value(int) T }).Value
+}
+
+// arrayMinMax returns the smallest and largest values of arr, whose values are of type T,
+// skipping nulls and NaNs, false if it holds none. Strings share the buffers of arr.
+func arrayMinMax[T cmp.Ordered](arr arrow.Array) (T, T, bool) {
+	value := arrayValue[T](arr)
+	var low, high T
+	seen := false
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			continue
+		}
+		v := value(i)
+		// NaN
+		if v != v {
+			continue
+		}
+		if !seen {
+			low, high, seen = v, v, true
+			continue
+		}
+		low = min(low, v)
+		high = max(high, v)
+	}
+	return low, high, seen
+}
+
+func (a *minMaxAccumulator[T]) stats(fieldID FieldID, dataType schemapb.DataType) *ScalarFieldStats {
+	stats := &ScalarFieldStats{
+		FieldID:       fieldID,
+		Type:          dataType,
+		RowCount:      a.rows,
+		NullCount:     a.nulls,
+		DistinctCount: -1,
+	}
+	if a.seen {
+		stats.Min = NewScalarFieldValue(dataType, a.min)
+		stats.Max = NewScalarFieldValue(dataType, a.max)
+	}
+	if a.countDistinct {
+		stats.DistinctCount = int64(len(a.distinct))
+	}
+	return stats
+}
+
+// SkipIndex is a min/max zone map of a segment, the stats of its fields over its row
+// groups, for skipping the row groups a predicate cannot match.
+type SkipIndex struct {
+	// ZoneRows are the rows of each zone, the row groups of the files in order.
+	ZoneRows []int64
+	// Zones holds the stats of the fields of zone i, the rows of row group i.
+	Zones []map[FieldID]*ScalarFieldStats
+}
+
+// skipIndexBuilder accumulates a SkipIndex over the records of a scan.
+type skipIndexBuilder struct {
+	fields []*schemapb.FieldSchema
+	// rowGroupRows are the rows of the row groups read, each a zone.
+	rowGroupRows []int64
+	zoneRows     []int64
+	zones        []map[FieldID]*ScalarFieldStats
+	// cur accumulates the zone of curRows rows so far.
+	cur     map[FieldID]fieldStatsAccumulator
+	curRows int64
+}
+
+func newSkipIndexBuilder(schema *schemapb.CollectionSchema, fieldIDs []FieldID, rowGroupRows []int64) (*skipIndexBuilder, error) {
+	b := &skipIndexBuilder{rowGroupRows: rowGroupRows}
+	for _, fieldID := range fieldIDs {
+		field := typeutil.GetField(schema, fieldID)
+		if field == nil {
+			return nil, merr.WrapErrFieldNotFound(fieldID)
+		}
+		if _, err := newFieldStatsAccumulator(field.GetDataType(), false); err != nil {
+			return nil, err
+		}
+		b.fields = append(b.fields, field)
+	}
+	return b, nil
+}
+
+func (b *skipIndexBuilder) add(rec Record) {
+	for offset := 0; offset < rec.Len(); {
+		if b.cur == nil {
+			b.cur = make(map[FieldID]fieldStatsAccumulator, len(b.fields))
+			for _, field := range b.fields {
+				// the types are checked by newSkipIndexBuilder
+				b.cur[field.GetFieldID()], _ = newFieldStatsAccumulator(field.GetDataType(), false)
+			}
+		}
+		n := int(min(b.zoneLimit()-b.curRows, int64(rec.Len()-offset)))
+		for _, field := range b.fields {
+			slice := array.NewSlice(rec.Column(field.GetFieldID()), int64(offset), int64(offset+n))
+			b.cur[field.GetFieldID()].add(slice)
+			slice.Release()
+		}
+		offset += n
+		b.curRows += int64(n)
+		if b.curRows == b.zoneLimit() {
+			b.flush()
+		}
+	}
+}
+
+// zoneLimit returns the rows of the zone accumulated, the rows past the row groups known
+// making up a last zone.
+func (b *skipIndexBuilder) zoneLimit() int64 {
+	if len(b.zones) < len(b.rowGroupRows) {
+		return b.rowGroupRows[len(b.zones)]
+	}
+	return math.MaxInt64
+}
+
+func (b *skipIndexBuilder) flush() {
+	zone := make(map[FieldID]*ScalarFieldStats, len(b.fields))
+	for _, field := range b.fields {
+		zone[field.GetFieldID()] = b.cur[field.GetFieldID()].stats(field.GetFieldID(), field.GetDataType())
+	}
+	b.zones = append(b.zones, zone)
+	b.zoneRows = append(b.zoneRows, b.curRows)
+	b.cur, b.curRows = nil, 0
+}
+
+func (b *skipIndexBuilder) finish() *SkipIndex {
+	if b.curRows > 0 {
+		b.flush()
+	}
+	return &SkipIndex{ZoneRows: b.zoneRows, Zones: b.zones}
+}
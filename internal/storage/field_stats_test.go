@@ -17,9 +17,14 @@
 package storage
 
 import (
+	"io"
+	"math"
 	"testing"
 
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
 	"github.com/milvus-io/milvus/internal/json"
@@ -721,3 +726,116 @@ func TestFindMaxVersion(t *testing.T) {
 	assert.Equal(t, int64(-1), version2)
 	assert.Equal(t, "", path2)
 }
+
+func TestComputeFieldStats(t *testing.T) {
+	size := 25
+	paths := []string{"/tmp/compute_field_stats/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	stats, err := ComputeFieldStats(paths, schema, []FieldID{11, 13, 14, 16, 101}, 1024, nil, nil, WithDistinctCount())
+	require.NoError(t, err)
+	require.Len(t, stats, 5)
+	assert.Equal(t, int8(1), stats[11].Min.GetValue())
+	assert.Equal(t, int8(25), stats[11].Max.GetValue())
+	assert.Equal(t, int64(25), stats[13].Max.GetValue())
+	assert.Equal(t, float32(1), stats[14].Min.GetValue())
+	assert.Equal(t, "1", stats[16].Min.GetValue())
+	assert.Equal(t, "9", stats[16].Max.GetValue())
+	assert.Equal(t, int32(25), stats[101].Max.GetValue())
+	for _, s := range stats {
+		assert.True(t, s.HasMinMax())
+		assert.Equal(t, int64(size), s.RowCount)
+		assert.Equal(t, int64(0), s.NullCount)
+		assert.Equal(t, int64(size), s.DistinctCount)
+	}
+
+	stats, err = ComputeFieldStats(paths, schema, []FieldID{13}, 1024, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), stats[13].DistinctCount)
+
+	_, err = ComputeFieldStats(paths, schema, []FieldID{999}, 1024, nil, nil)
+	assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+	_, err = ComputeFieldStats(paths, schema, []FieldID{102}, 1024, nil, nil)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	t.Run("nulls", func(t *testing.T) {
+		builder := array.NewFloat64Builder(memory.DefaultAllocator)
+		defer builder.Release()
+		builder.AppendNulls(3)
+		nulls := builder.NewArray()
+		defer nulls.Release()
+		builder.AppendValues([]float64{math.NaN(), 2, 1}, []bool{true, true, false})
+		mixed := builder.NewArray()
+		defer mixed.Release()
+
+		acc := newMinMaxAccumulator[float64](true)
+		acc.add(nulls)
+		s := acc.stats(15, schemapb.DataType_Double)
+		assert.False(t, s.HasMinMax())
+		assert.Equal(t, int64(3), s.NullCount)
+		assert.Equal(t, int64(0), s.DistinctCount)
+
+		acc.add(mixed)
+		s = acc.stats(15, schemapb.DataType_Double)
+		assert.True(t, s.HasMinMax())
+		assert.Equal(t, float64(2), s.Min.GetValue())
+		assert.Equal(t, float64(2), s.Max.GetValue())
+		assert.Equal(t, int64(6), s.RowCount)
+		assert.Equal(t, int64(4), s.NullCount)
+	})
+}
+
+func TestPackedRecordReaderSkipIndex(t *testing.T) {
+	size := 23
+	paths := []string{"/tmp/skip_index/0"}
+	writePackedTestSegment(t, paths, size, WithRowGroupSize(5))
+	schema := generateTestSchema()
+
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithSkipIndex([]FieldID{13, 16}))
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = reader.SkipIndex()
+	assert.Error(t, err)
+	for {
+		_, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	index, err := reader.SkipIndex()
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, 5, 5, 5, 3}, index.ZoneRows)
+	require.Len(t, index.Zones, 5)
+	for i, zone := range index.Zones {
+		first, last := int64(i*5+1), min(int64(i*5+5), int64(size))
+		assert.Equal(t, first, zone[13].Min.GetValue())
+		assert.Equal(t, last, zone[13].Max.GetValue())
+		assert.Equal(t, last-first+1, zone[13].RowCount)
+		assert.Equal(t, last-first+1, zone[16].RowCount)
+	}
+	assert.Equal(t, "10", index.Zones[1][16].Min.GetValue())
+	assert.Equal(t, "9", index.Zones[1][16].Max.GetValue())
+
+	_, err = newPackedRecordReader(paths, schema, 1024, nil, nil, WithSkipIndex([]FieldID{19}))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	t.Run("row group range", func(t *testing.T) {
+		reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithSkipIndex([]FieldID{13}), WithRowGroupRange(3, 2))
+		require.NoError(t, err)
+		defer reader.Close()
+		for {
+			_, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+		}
+		index, err := reader.SkipIndex()
+		require.NoError(t, err)
+		assert.Equal(t, []int64{5, 3}, index.ZoneRows)
+		assert.Equal(t, int64(16), index.Zones[0][13].Min.GetValue())
+		assert.Equal(t, int64(23), index.Zones[1][13].Max.GetValue())
+	})
+}
@@ -0,0 +1,117 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/atomic"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// WithFileLimiter holds a slot of limiter for every packed file of the reader until it is closed.
+func WithFileLimiter(limiter *FileLimiter) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.fileLimiter = limiter
+	}
+}
+
+// FileLimiter is a budget of packed files open at once shared by readers, see WithFileLimiter.
+type FileLimiter struct {
+	budget  int64
+	sem     *semaphore.Weighted
+	inUse   atomic.Int64
+	peak    atomic.Int64
+	waiting atomic.Int64
+}
+
+// FileLimiterStats is the usage of a FileLimiter.
+type FileLimiterStats struct {
+	Budget int64
+	// InUse is the number of files open, Peak the most open at once so far.
+	InUse int64
+	Peak  int64
+	// Waiting is the number of readers waiting for slots.
+	Waiting int64
+}
+
+// NewFileLimiter returns a limiter of budget files open at once.
+func NewFileLimiter(budget int64) *FileLimiter {
+	return &FileLimiter{budget: budget, sem: semaphore.NewWeighted(budget)}
+}
+
+func (l *FileLimiter) acquire(ctx context.Context, n int64) error {
+	if n > l.budget {
+		return merr.WrapErrParameterInvalidMsg("opening %d packed files exceeds the file budget %d", n, l.budget)
+	}
+	l.waiting.Inc()
+	err := l.sem.Acquire(ctx, n)
+	l.waiting.Dec()
+	if err != nil {
+		return merr.WrapErrServiceInternal(fmt.Sprintf("wait for %d packed file slots: %s", n, err.Error()))
+	}
+	inUse := l.inUse.Add(n)
+	for {
+		peak := l.peak.Load()
+		if inUse <= peak || l.peak.CompareAndSwap(peak, inUse) {
+			return nil
+		}
+	}
+}
+
+func (l *FileLimiter) release(n int64) {
+	l.inUse.Sub(n)
+	l.sem.Release(n)
+}
+
+// hold acquires n slots at once, waiting until ctx is done, nil for a nil limiter.
+func (l *FileLimiter) hold(ctx context.Context, n int64) (*fileSlots, error) {
+	if l == nil {
+		return nil, nil
+	}
+	if err := l.acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	return &fileSlots{limiter: l, files: n}, nil
+}
+
+// fileSlots are slots of a FileLimiter held by a reader until released.
+type fileSlots struct {
+	limiter *FileLimiter
+	files   int64
+}
+
+// release returns the slots once, it is a no-op on nil slots.
+func (s *fileSlots) release() {
+	if s != nil && s.limiter != nil {
+		s.limiter.release(s.files)
+		s.limiter = nil
+	}
+}
+
+// Stats returns the current usage of the limiter.
+func (l *FileLimiter) Stats() FileLimiterStats {
+	return FileLimiterStats{
+		Budget:  l.budget,
+		InUse:   l.inUse.Load(),
+		Peak:    l.peak.Load(),
+		Waiting: l.waiting.Load(),
+	}
+}
@@ -0,0 +1,198 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// WithDecodePool decodes the batches on the workers of pool, shared by many readers.
+func WithDecodePool(pool *DecodePool) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.decodePool = pool
+	}
+}
+
+// decodeErrorBatchReader locates the batch a read of the native reader failed at in its error.
+type decodeErrorBatchReader struct {
+	packedBatchReader
+	paths         []string
+	storageConfig *indexpb.StorageConfig
+	// rows counts the rows of the batches decoded so far.
+	rows int64
+}
+
+func (r *decodeErrorBatchReader) ReadNext() (arrow.Record, error) {
+	rec, err := r.packedBatchReader.ReadNext()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		wrap := merr.WrapErrIoDecodeFailed
+		if isNativeTransportError(err) {
+			wrap = merr.WrapErrIoFailed
+		}
+		return nil, wrap(strings.Join(r.paths, ","), fmt.Errorf("decode batch after row %d failed%s: %w", r.rows, r.offsets(), err))
+	}
+	r.rows += rec.NumRows()
+	return rec, nil
+}
+
+// offsets estimates the byte offset of the failed batch in each file, empty without footers.
+func (r *decodeErrorBatchReader) offsets() string {
+	offsets := make([]string, 0, len(r.paths))
+	for _, p := range r.paths {
+		size, err := packed.GetFileSize(p, r.storageConfig)
+		if err != nil {
+			return ""
+		}
+		rows, err := packed.GetFileRowCount(p, r.storageConfig)
+		if err != nil || rows <= 0 {
+			return ""
+		}
+		offsets = append(offsets, fmt.Sprintf("%s at about byte %d of %d", p, size*min(r.rows, rows)/rows, size))
+	}
+	return ", " + strings.Join(offsets, ", ")
+}
+
+// DecodePool is a pool of workers decoding the batches of the readers sharing it, see WithDecodePool.
+type DecodePool struct {
+	workers int
+
+	mu      sync.Mutex
+	readers int
+	tasks   chan func()
+	wg      sync.WaitGroup
+
+	busy    atomic.Int64
+	queued  atomic.Int64
+	decoded atomic.Int64
+}
+
+// DecodePoolStats is the usage of a DecodePool.
+type DecodePoolStats struct {
+	Workers int
+	// Readers are the readers open, Busy the workers decoding, Queued the reads waiting
+	Readers int
+	Busy    int64
+	Queued  int64
+	// Decoded is the number of batches decoded so far.
+	Decoded int64
+}
+
+// NewDecodePool returns a pool decoding up to workers batches at once.
+func NewDecodePool(workers int) *DecodePool {
+	return &DecodePool{workers: max(workers, 1)}
+}
+
+// register counts a reader, starting the workers for the first, and returns its queue.
+func (p *DecodePool) register() chan<- func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.readers == 0 {
+		p.tasks = make(chan func())
+		for i := 0; i < p.workers; i++ {
+			p.wg.Add(1)
+			go func(tasks <-chan func()) {
+				defer p.wg.Done()
+				for task := range tasks {
+					task()
+				}
+			}(p.tasks)
+		}
+	}
+	p.readers++
+	return p.tasks
+}
+
+// unregister uncounts a reader and stops the workers after the last one.
+func (p *DecodePool) unregister() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers--
+	if p.readers == 0 {
+		close(p.tasks)
+		p.tasks = nil
+		p.wg.Wait()
+	}
+}
+
+func (p *DecodePool) wrap(inner packedBatchReader) packedBatchReader {
+	return &pooledBatchReader{inner: inner, pool: p, tasks: p.register()}
+}
+
+// Stats returns the current usage of the pool.
+func (p *DecodePool) Stats() DecodePoolStats {
+	p.mu.Lock()
+	readers := p.readers
+	p.mu.Unlock()
+	return DecodePoolStats{
+		Workers: p.workers,
+		Readers: readers,
+		Busy:    p.busy.Load(),
+		Queued:  p.queued.Load(),
+		Decoded: p.decoded.Load(),
+	}
+}
+
+// pooledBatchReader reads the batches of inner on the workers of pool.
+type pooledBatchReader struct {
+	inner  packedBatchReader
+	pool   *DecodePool
+	tasks  chan<- func()
+	closed bool
+}
+
+func (r *pooledBatchReader) ReadNext() (arrow.Record, error) {
+	if r.closed {
+		// the queue of an unregistered reader may be closed already
+		return nil, merr.WrapErrServiceInternal("read of packed reader closed from its decode pool")
+	}
+	var rec arrow.Record
+	var err error
+	done := make(chan struct{})
+	r.pool.queued.Inc()
+	r.tasks <- func() {
+		r.pool.queued.Dec()
+		r.pool.busy.Inc()
+		defer close(done)
+		defer r.pool.busy.Dec()
+		rec, err = r.inner.ReadNext()
+		r.pool.decoded.Inc()
+	}
+	<-done
+	return rec, err
+}
+
+func (r *pooledBatchReader) Close() error {
+	err := r.inner.Close()
+	if !r.closed {
+		r.closed = true
+		r.pool.unregister()
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"os"
+	"path"
+
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// fileSyncer fsyncs the local files of a packed writer, see WithDurability.
+type fileSyncer struct {
+	durability DurabilityLevel
+	localFiles bool
+	paths      []string
+	// unsynced are the bytes written since the last sync, syncEvery the flush size.
+	unsynced  int64
+	syncEvery int64
+}
+
+func newFileSyncer(level DurabilityLevel, paths []string, local bool, bufferSize int64) fileSyncer {
+	return fileSyncer{durability: level, localFiles: local, paths: paths, syncEvery: bufferSize}
+}
+
+// syncFlushed accounts size written bytes and syncs the files once flushed, with DurabilityPerFlush.
+func (s *fileSyncer) syncFlushed(size int64) error {
+	if s.durability != DurabilityPerFlush || !s.localFiles {
+		return nil
+	}
+	s.unsynced += size
+	if s.unsynced < s.syncEvery {
+		return nil
+	}
+	s.unsynced = 0
+	return s.syncFiles(false)
+}
+
+// syncOnClose syncs the closed files and their directories, unless DurabilityNone.
+func (s *fileSyncer) syncOnClose() error {
+	if s.durability == DurabilityNone || !s.localFiles {
+		return nil
+	}
+	return s.syncFiles(true)
+}
+
+// syncFiles fsyncs the files, and on close their directories; files not created yet are skipped before.
+func (s *fileSyncer) syncFiles(closing bool) error {
+	syncPath := func(p string) error {
+		f, err := os.Open(p)
+		if err != nil {
+			if !closing && os.IsNotExist(err) {
+				return nil
+			}
+			return merr.WrapErrIoFailed(p, err)
+		}
+		defer f.Close()
+		if err := f.Sync(); err != nil {
+			return merr.WrapErrIoFailed(p, err)
+		}
+		return nil
+	}
+	for _, p := range s.paths {
+		if err := syncPath(p); err != nil {
+			return err
+		}
+	}
+	if !closing {
+		return nil
+	}
+	dirs := lo.Uniq(lo.Map(s.paths, func(p string, _ int) string { return path.Dir(p) }))
+	for _, dir := range dirs {
+		if err := syncPath(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DurabilityLevel is when the packed writer fsyncs its local files, see WithDurability.
+type DurabilityLevel int
+
+const (
+	// DurabilityNone leaves the files to the page cache of the OS.
+	DurabilityNone DurabilityLevel = iota
+	// DurabilityOnClose fsyncs the files and their directories on Close.
+	DurabilityOnClose
+	// DurabilityPerFlush also fsyncs the files every time the packed writer flushes.
+	DurabilityPerFlush
+)
+
+// WithDurability fsyncs the local files written at level, a no-op on object storages.
+func WithDurability(level DurabilityLevel) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.durability = level
+	}
+}
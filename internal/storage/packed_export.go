@@ -0,0 +1,258 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+type arrowTableOptions struct {
+	singleChunk bool
+}
+
+type ArrowTableOption func(*arrowTableOptions)
+
+// WithSingleChunkTable concatenates the batches of every column into a single chunk, copying them.
+func WithSingleChunkTable() ArrowTableOption {
+	return func(o *arrowTableOptions) {
+		o.singleChunk = true
+	}
+}
+
+// ReadAsArrowTable reads the segment at paths into an arrow table, which the caller must release.
+func ReadAsArrowTable(paths []string, schema *schemapb.CollectionSchema, bufferSize int64, opts ...ArrowTableOption) (arrow.Table, error) {
+	options := &arrowTableOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	arrowSchema, err := ConvertToArrowSchema(schema, true)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newPackedRecordReader(paths, schema, bufferSize, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var batches []arrow.Record
+	defer func() {
+		for _, batch := range batches {
+			batch.Release()
+		}
+	}()
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch := rec.(*simpleArrowRecord).r
+		batch.Retain()
+		batches = append(batches, batch)
+	}
+	if len(batches) > 0 {
+		// the batches read carry the metadata of the files
+		arrowSchema = batches[0].Schema()
+	}
+
+	var rows int64
+	for _, batch := range batches {
+		rows += batch.NumRows()
+	}
+	columns := make([]arrow.Column, 0, arrowSchema.NumFields())
+	defer func() {
+		for i := range columns {
+			columns[i].Release()
+		}
+	}()
+	for i, field := range arrowSchema.Fields() {
+		chunks := lo.Map(batches, func(batch arrow.Record, _ int) arrow.Array { return batch.Column(i) })
+		if options.singleChunk && len(chunks) > 1 {
+			concatenated, err := array.Concatenate(chunks, memory.DefaultAllocator)
+			if err != nil {
+				return nil, merr.WrapErrServiceInternal(fmt.Sprintf("concatenate column %s: %s", field.Name, err.Error()))
+			}
+			chunks = []arrow.Array{concatenated}
+			defer concatenated.Release()
+		}
+		chunked := arrow.NewChunked(field.Type, chunks)
+		columns = append(columns, *arrow.NewColumn(field, chunked))
+		chunked.Release()
+	}
+	return array.NewTable(arrowSchema, columns, rows), nil
+}
+
+// ReadVectorsInto drains and closes reader, copying the vectors of field into buf, and returns the rows copied.
+func ReadVectorsInto(reader RecordReader, field *schemapb.FieldSchema, buf []byte) (int, error) {
+	defer reader.Close()
+	if !typeutil.IsVectorType(field.GetDataType()) || field.GetDataType() == schemapb.DataType_SparseFloatVector ||
+		field.GetDataType() == schemapb.DataType_ArrayOfVector {
+		return 0, merr.WrapErrParameterInvalidMsg("field %d of type %s is not a dense vector field", field.GetFieldID(), field.GetDataType())
+	}
+	dim, err := typeutil.GetDim(field)
+	if err != nil {
+		return 0, err
+	}
+	rowBytes := serdeMap[field.GetDataType()].arrowType(int(dim), schemapb.DataType_None).(*arrow.FixedSizeBinaryType).ByteWidth
+	if len(buf)%rowBytes != 0 {
+		return 0, merr.WrapErrParameterInvalidMsg("buffer of %d bytes is not a multiple of the vector size %d", len(buf), rowBytes)
+	}
+	capacity := len(buf) / rowBytes
+
+	rows := 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		if rows+rec.Len() > capacity {
+			return rows, merr.WrapErrParameterInvalidMsg("buffer sized for %d vectors, reader holds more", capacity)
+		}
+		col := rec.Column(field.GetFieldID())
+		if col.NullN() > 0 {
+			return rows, merr.WrapErrParameterInvalidMsg("vector field %d holds nulls, which cannot be read into a contiguous buffer", field.GetFieldID())
+		}
+		dst := buf[rows*rowBytes : (rows+rec.Len())*rowBytes]
+		if fsb, ok := col.(*array.FixedSizeBinary); ok && fsb.DataType().(*arrow.FixedSizeBinaryType).ByteWidth == rowBytes {
+			offset := fsb.Data().Offset()
+			copy(dst, fsb.Data().Buffers()[1].Bytes()[offset*rowBytes:(offset+fsb.Len())*rowBytes])
+		} else {
+			for i := 0; i < rec.Len(); i++ {
+				value, ok := fixedSizeVectorBytes(col, i)
+				if !ok || len(value) != rowBytes {
+					return rows, merr.WrapErrServiceInternal(fmt.Sprintf("unexpected column type %s of vector field %d", col.DataType(), field.GetFieldID()))
+				}
+				copy(dst[i*rowBytes:], value)
+			}
+		}
+		rows += rec.Len()
+	}
+	if rows != capacity {
+		return rows, merr.WrapErrParameterInvalidMsg("read %d vectors into a buffer sized for %d", rows, capacity)
+	}
+	return rows, nil
+}
+
+// ReadFloatVectorsInto is ReadVectorsInto for float vector fields with a []float32 buffer.
+func ReadFloatVectorsInto(reader RecordReader, field *schemapb.FieldSchema, buf []float32) (int, error) {
+	if field.GetDataType() != schemapb.DataType_FloatVector {
+		reader.Close()
+		return 0, merr.WrapErrParameterInvalidMsg("field %d of type %s is not a float vector field", field.GetFieldID(), field.GetDataType())
+	}
+	return ReadVectorsInto(reader, field, arrow.Float32Traits.CastToBytes(buf))
+}
+
+// ExportVectorFieldToNumpy writes the vectors of fieldID of the segment at paths to w as a .npy file.
+func ExportVectorFieldToNumpy(paths []string, schema *schemapb.CollectionSchema, bufferSize int64, fieldID FieldID, w io.Writer) error {
+	field := typeutil.GetField(schema, fieldID)
+	if field == nil {
+		return merr.WrapErrFieldNotFound(fieldID)
+	}
+	var descr string
+	switch field.GetDataType() {
+	case schemapb.DataType_FloatVector:
+		descr = lo.Ternary(isLittleEndian(binary.NativeEndian), "<f4", ">f4")
+	case schemapb.DataType_BinaryVector:
+		descr = "|u1"
+	default:
+		return merr.WrapErrParameterInvalidMsg("field %d of type %s cannot be exported to numpy", fieldID, field.GetDataType())
+	}
+	dim, err := typeutil.GetDim(field)
+	if err != nil {
+		return err
+	}
+	columns := dim
+	if field.GetDataType() == schemapb.DataType_BinaryVector {
+		columns = dim / 8
+	}
+	rows, err := CountRows(paths, nil)
+	if err != nil {
+		return err
+	}
+
+	projected := projectSchema(schema, typeutil.NewSet(fieldID))
+	reader, err := newPackedRecordReader(paths, projected, bufferSize, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(numpyHeader(descr, rows, columns)); err != nil {
+		return err
+	}
+	var written int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		col := rec.Column(fieldID)
+		if col.NullN() > 0 {
+			return merr.WrapErrParameterInvalidMsg("vector field %d holds nulls, which cannot be exported to numpy", fieldID)
+		}
+		for i := 0; i < rec.Len(); i++ {
+			value, ok := fixedSizeVectorBytes(col, i)
+			if !ok {
+				return merr.WrapErrServiceInternal(fmt.Sprintf("unexpected column type %s of vector field %d", col.DataType(), fieldID))
+			}
+			if _, err := bw.Write(value); err != nil {
+				return err
+			}
+		}
+		written += int64(rec.Len())
+	}
+	if written != rows {
+		return merr.WrapErrIoFailedReason(fmt.Sprintf("packed files %v read %d vectors, %d counted for the numpy header", paths, written, rows))
+	}
+	return bw.Flush()
+}
+
+// numpyHeader returns the .npy 1.0 header of a 2-d array, padded to 64 bytes.
+func numpyHeader(descr string, rows, columns int64) []byte {
+	const magic = "\x93NUMPY\x01\x00"
+	dict := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%d, %d), }", descr, rows, columns)
+	// magic, the 2 bytes of the header length, the dict and the terminating newline
+	padding := (64 - (len(magic)+2+len(dict)+1)%64) % 64
+	header := dict + strings.Repeat(" ", padding) + "\n"
+	buf := make([]byte, 0, len(magic)+2+len(header))
+	buf = append(buf, magic...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(header)))
+	return append(buf, header...)
+}
@@ -0,0 +1,386 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// lazyColumnGroup is a column group of a lazy reader, decoded on the first access of its fields.
+type lazyColumnGroup struct {
+	fields []*schemapb.FieldSchema
+	open   func() (RecordReader, error)
+	// rowGroups and openAt seek the file of the group, nil if it cannot; rowGroupRows are cached
+	rowGroups    func() ([]int64, error)
+	openAt       func(offset, count int) (RecordReader, error)
+	rowGroupRows []int64
+	buffer       *columnBuffer
+	// position is the number of rows consumed from the group.
+	position int64
+}
+
+// lazyPackedRecordReader reads the primary key group eagerly and the others once a record accesses them.
+type lazyPackedRecordReader struct {
+	groups      []*lazyColumnGroup
+	field2Group map[FieldID]int
+	anchor      int
+	// sparseThreshold is the share of rows below which a group seeks, 0 to never seek
+	sparseThreshold float64
+
+	position int64
+	cur      *lazyRecord
+	// err is the first failure to decode a group, failing the reads from then on.
+	err error
+}
+
+var _ RecordReader = (*lazyPackedRecordReader)(nil)
+
+type lazyReaderOptions struct {
+	sparseThreshold float64
+}
+
+// LazyReaderOption configures NewLazyPackedRecordReader.
+type LazyReaderOption func(*lazyReaderOptions)
+
+// WithSparseSelectionThreshold seeks a group to the row group of the first row accessed when
+// less than threshold of the rows to catch up are accessed.
+func WithSparseSelectionThreshold(threshold float64) LazyReaderOption {
+	return func(o *lazyReaderOptions) {
+		o.sparseThreshold = threshold
+	}
+}
+
+// NewLazyPackedRecordReader reads the packed files of columnGroups at paths, decoding each group on first access.
+func NewLazyPackedRecordReader(
+	paths []string,
+	columnGroups []storagecommon.ColumnGroup,
+	schema *schemapb.CollectionSchema,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...LazyReaderOption,
+) (RecordReader, error) {
+	if len(paths) != len(columnGroups) {
+		return nil, merr.WrapErrParameterInvalid(len(columnGroups), len(paths), "paths length is not equal to column groups length for lazy packed reader")
+	}
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := newLazyColumnGroups(paths, columnGroups, schema, bufferSize, storageConfig, storagePluginContext)
+	if err != nil {
+		return nil, err
+	}
+	return newLazyRecordReader(groups, pkField.GetFieldID(), opts...)
+}
+
+// newLazyColumnGroups returns the lazy column groups of columnGroups at paths.
+func newLazyColumnGroups(
+	paths []string,
+	columnGroups []storagecommon.ColumnGroup,
+	schema *schemapb.CollectionSchema,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+) ([]*lazyColumnGroup, error) {
+	allFields := typeutil.GetAllFieldSchemas(schema)
+	groups := make([]*lazyColumnGroup, 0, len(columnGroups))
+	for i, columnGroup := range columnGroups {
+		fieldIDs := typeutil.NewSet[int64]()
+		for _, col := range columnGroup.Columns {
+			if col < 0 || col >= len(allFields) {
+				return nil, merr.WrapErrParameterInvalidMsg("column %d of column group %d out of range", col, columnGroup.GroupID)
+			}
+			fieldIDs.Insert(allFields[col].GetFieldID())
+		}
+		groupSchema := projectSchema(schema, fieldIDs)
+		path := paths[i]
+		groups = append(groups, &lazyColumnGroup{
+			fields: typeutil.GetAllFieldSchemas(groupSchema),
+			open: func() (RecordReader, error) {
+				return newPackedRecordReader([]string{path}, groupSchema, bufferSize, storageConfig, storagePluginContext)
+			},
+			rowGroups: func() ([]int64, error) {
+				arrowSchema, err := ConvertToArrowSchema(groupSchema, true)
+				if err != nil {
+					return nil, merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", groupSchema.Name, err.Error())
+				}
+				return rowGroupNumRows(path, arrowSchema, bufferSize, storageConfig, storagePluginContext)
+			},
+			openAt: func(offset, count int) (RecordReader, error) {
+				return newPackedRecordReader([]string{path}, groupSchema, bufferSize, storageConfig, storagePluginContext,
+					WithRowGroupRange(offset, count))
+			},
+		})
+	}
+	return groups, nil
+}
+
+// newLazyRecordReader reads groups lazily, driven by the eager group of anchorFieldID.
+func newLazyRecordReader(groups []*lazyColumnGroup, anchorFieldID FieldID, opts ...LazyReaderOption) (*lazyPackedRecordReader, error) {
+	options := &lazyReaderOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.sparseThreshold < 0 || options.sparseThreshold > 1 {
+		return nil, merr.WrapErrParameterInvalidMsg("sparse selection threshold %v of lazy reader out of [0, 1]", options.sparseThreshold)
+	}
+	field2Group := make(map[FieldID]int)
+	for i, group := range groups {
+		for _, field := range group.fields {
+			field2Group[field.GetFieldID()] = i
+		}
+	}
+	anchor, ok := field2Group[anchorFieldID]
+	if !ok {
+		return nil, merr.WrapErrParameterInvalidMsg("no column group holds field %d", anchorFieldID)
+	}
+	return &lazyPackedRecordReader{
+		groups:          groups,
+		field2Group:     field2Group,
+		anchor:          anchor,
+		sparseThreshold: options.sparseThreshold,
+	}, nil
+}
+
+func (lr *lazyPackedRecordReader) openGroup(group *lazyColumnGroup) error {
+	if group.buffer != nil {
+		return nil
+	}
+	inner, err := group.open()
+	if err != nil {
+		return err
+	}
+	group.buffer = &columnBuffer{inner: inner, fields: group.fields}
+	return nil
+}
+
+func (lr *lazyPackedRecordReader) Next() (Record, error) {
+	if lr.cur != nil {
+		lr.cur.expired = true
+		lr.cur.Release()
+		lr.cur = nil
+	}
+	if lr.err != nil {
+		return nil, lr.err
+	}
+	group := lr.groups[lr.anchor]
+	if err := lr.openGroup(group); err != nil {
+		return nil, err
+	}
+	if err := group.buffer.fill(1); err != nil {
+		return nil, err
+	}
+	if group.buffer.pendingRows == 0 {
+		return nil, io.EOF
+	}
+	// batches follow the batches of the anchor group
+	rows := group.buffer.pending[0].rows
+	arrays, err := group.buffer.take(rows)
+	if err != nil {
+		return nil, err
+	}
+	rec := &lazyRecord{
+		reader: lr,
+		start:  lr.position,
+		rows:   rows,
+		cols:   make(map[FieldID]arrow.Array),
+		ref:    1,
+	}
+	for i, field := range group.fields {
+		rec.cols[field.GetFieldID()] = arrays[i]
+	}
+	group.position += int64(rows)
+	lr.position += int64(rows)
+	lr.cur = rec
+	return rec, nil
+}
+
+// loadGroup decodes rows [start, start+rows) of the group at index g.
+func (lr *lazyPackedRecordReader) loadGroup(g int, start int64, rows int) ([]arrow.Array, error) {
+	group := lr.groups[g]
+	if err := lr.seekGroup(group, start, rows); err != nil {
+		return nil, err
+	}
+	if err := lr.openGroup(group); err != nil {
+		return nil, err
+	}
+	if group.position < start {
+		if err := group.buffer.skip(int(start - group.position)); err != nil {
+			return nil, merr.WrapErrServiceInternal(fmt.Sprintf("skip to row %d of column group %d failed: %s", start, g, err.Error()))
+		}
+		group.position = start
+	}
+	if err := group.buffer.fill(rows); err != nil {
+		return nil, err
+	}
+	if group.buffer.pendingRows < rows {
+		return nil, merr.WrapErrServiceInternal(fmt.Sprintf("column group %d holds fewer rows than the primary key group", g))
+	}
+	arrays, err := group.buffer.take(rows)
+	if err != nil {
+		return nil, err
+	}
+	group.position += int64(rows)
+	return arrays, nil
+}
+
+// seekGroup reopens group at the row group of row start if the rows accessed are sparse enough.
+func (lr *lazyPackedRecordReader) seekGroup(group *lazyColumnGroup, start int64, rows int) error {
+	if lr.sparseThreshold == 0 || group.openAt == nil || group.position >= start {
+		return nil
+	}
+	if float64(rows)/float64(start+int64(rows)-group.position) >= lr.sparseThreshold {
+		return nil
+	}
+	if group.rowGroupRows == nil {
+		rowGroupRows, err := group.rowGroups()
+		if err != nil {
+			return err
+		}
+		group.rowGroupRows = rowGroupRows
+	}
+	offset, first := 0, int64(0)
+	for offset < len(group.rowGroupRows) && first+group.rowGroupRows[offset] <= start {
+		first += group.rowGroupRows[offset]
+		offset++
+	}
+	decoded := group.position
+	if group.buffer != nil {
+		decoded += int64(group.buffer.pendingRows)
+	}
+	if first <= decoded {
+		return nil
+	}
+	if group.buffer != nil {
+		// a group failing to seek is read from its start again
+		err := group.buffer.Close()
+		group.buffer, group.position = nil, 0
+		if err != nil {
+			return err
+		}
+	}
+	inner, err := group.openAt(offset, len(group.rowGroupRows)-offset)
+	if err != nil {
+		return err
+	}
+	group.buffer = &columnBuffer{inner: inner, fields: group.fields}
+	group.position = first
+	return nil
+}
+
+func (lr *lazyPackedRecordReader) Close() error {
+	if lr.cur != nil {
+		lr.cur.expired = true
+		lr.cur.Release()
+		lr.cur = nil
+	}
+	var errs error
+	for _, group := range lr.groups {
+		if group.buffer != nil {
+			errs = merr.Combine(errs, group.buffer.Close())
+		}
+	}
+	return errs
+}
+
+// lazyRecord is a record of lazyPackedRecordReader decoding a group on first access.
+type lazyRecord struct {
+	reader  *lazyPackedRecordReader
+	start   int64
+	rows    int
+	cols    map[FieldID]arrow.Array
+	ref     int
+	expired bool
+	// err is the first load failure of Column.
+	err error
+}
+
+var _ Record = (*lazyRecord)(nil)
+
+// Load decodes the groups of fieldIDs, returning the failures Column only records.
+func (r *lazyRecord) Load(fieldIDs ...FieldID) error {
+	for _, fieldID := range fieldIDs {
+		if _, ok := r.cols[fieldID]; ok {
+			continue
+		}
+		g, ok := r.reader.field2Group[fieldID]
+		if !ok {
+			return merr.WrapErrFieldNotFound(fieldID)
+		}
+		if r.expired {
+			return merr.WrapErrServiceInternal(fmt.Sprintf("load field %d of a record the lazy reader has moved past", fieldID))
+		}
+		arrays, err := r.reader.loadGroup(g, r.start, r.rows)
+		if err != nil {
+			// the group is left amid a decode
+			if r.reader.err == nil {
+				r.reader.err = err
+			}
+			return err
+		}
+		for i, field := range r.reader.groups[g].fields {
+			r.cols[field.GetFieldID()] = arrays[i]
+		}
+	}
+	return nil
+}
+
+// Column returns nil if the field fails to load, see Err.
+func (r *lazyRecord) Column(i FieldID) arrow.Array {
+	if err := r.Load(i); err != nil {
+		if r.err == nil {
+			r.err = errors.Wrapf(err, "lazy load field %d", i)
+		}
+		return nil
+	}
+	return r.cols[i]
+}
+
+// Err returns the first failure of Column to load a field, nil if none failed.
+func (r *lazyRecord) Err() error {
+	return r.err
+}
+
+func (r *lazyRecord) Len() int {
+	return r.rows
+}
+
+func (r *lazyRecord) Release() {
+	r.ref--
+	if r.ref == 0 {
+		for _, col := range r.cols {
+			col.Release()
+		}
+		r.cols = nil
+	}
+}
+
+func (r *lazyRecord) Retain() {
+	r.ref++
+}
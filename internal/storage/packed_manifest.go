@@ -0,0 +1,95 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"io"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// PackedFileManifest describes the packed files produced by a single segment write.
+type PackedFileManifest struct {
+	RowNum       int64                       `json:"rowNum"`
+	ColumnGroups []PackedColumnGroupManifest `json:"columnGroups"`
+	PKRange      *PackedPKRange              `json:"pkRange,omitempty"`
+}
+
+// PackedColumnGroupManifest describes the file of one column group.
+type PackedColumnGroupManifest struct {
+	GroupID          typeutil.UniqueID `json:"groupID"`
+	Path             string            `json:"path"`
+	Columns          []int             `json:"columns"`
+	FieldIDs         []int64           `json:"fieldIDs"`
+	UncompressedSize uint64            `json:"uncompressedSize"`
+	CompressedSize   uint64            `json:"compressedSize"`
+}
+
+// PackedPKRange is the closed range of primary keys stored in a segment.
+type PackedPKRange struct {
+	PkType int64      `json:"pkType"`
+	Min    PrimaryKey `json:"min"`
+	Max    PrimaryKey `json:"max"`
+}
+
+func (r *PackedPKRange) UnmarshalJSON(data []byte) error {
+	var messageMap map[string]*json.RawMessage
+	if err := json.Unmarshal(data, &messageMap); err != nil {
+		return err
+	}
+	if messageMap["pkType"] == nil || messageMap["min"] == nil || messageMap["max"] == nil {
+		return merr.WrapErrParameterInvalidMsg("incomplete pk range in packed file manifest")
+	}
+	if err := json.Unmarshal(*messageMap["pkType"], &r.PkType); err != nil {
+		return err
+	}
+
+	switch schemapb.DataType(r.PkType) {
+	case schemapb.DataType_Int64:
+		r.Min, r.Max = &Int64PrimaryKey{}, &Int64PrimaryKey{}
+	case schemapb.DataType_VarChar:
+		r.Min, r.Max = &VarCharPrimaryKey{}, &VarCharPrimaryKey{}
+	default:
+		return merr.WrapErrParameterInvalidMsg("unsupported pk type %d in packed file manifest", r.PkType)
+	}
+
+	if err := json.Unmarshal(*messageMap["min"], r.Min); err != nil {
+		return err
+	}
+	return json.Unmarshal(*messageMap["max"], r.Max)
+}
+
+// ReadPackedFileManifest decodes a manifest written by packedRecordWriter.WriteManifest.
+func ReadPackedFileManifest(r io.Reader) (*PackedFileManifest, error) {
+	manifest := &PackedFileManifest{}
+	if err := json.NewDecoder(r).Decode(manifest); err != nil {
+		return nil, merr.WrapErrParameterInvalidMsg("decode packed file manifest failed: %s", err.Error())
+	}
+	return manifest, nil
+}
+
+// Paths returns the file paths in column group order.
+func (m *PackedFileManifest) Paths() []string {
+	paths := make([]string, 0, len(m.ColumnGroups))
+	for _, group := range m.ColumnGroups {
+		paths = append(paths, group.Path)
+	}
+	return paths
+}
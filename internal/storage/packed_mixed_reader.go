@@ -0,0 +1,377 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/samber/lo"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// newMixedPackedRecordReader zips the records of a packed reader per storage config, or per path with WithGroupReadParallelism.
+func newMixedPackedRecordReader(
+	paths []string,
+	schema *schemapb.CollectionSchema,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...PackedReaderOption,
+) (RecordReader, error) {
+	// held is set once the file slots of all groups are held, the readers of the groups taking none
+	held := false
+	options := &packedReaderOptions{
+		open: func(paths []string, schema *schemapb.CollectionSchema, storageConfig *indexpb.StorageConfig) (RecordReader, error) {
+			if held {
+				return newPackedRecordReader(paths, schema, bufferSize, storageConfig, storagePluginContext,
+					append(opts[:len(opts):len(opts)], WithFileLimiter(nil))...)
+			}
+			return newPackedRecordReader(paths, schema, bufferSize, storageConfig, storagePluginContext, opts...)
+		},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.fingerprint && options.fingerprintSchema == nil {
+		// the readers of the groups read projections of schema
+		opts = append(opts[:len(opts):len(opts)], WithSchemaFingerprintCheck(schema))
+	}
+	parallel := options.groupParallelism > 1 && len(paths) > 1
+	if options.resolver == nil && !parallel {
+		return options.open(paths, schema, storageConfig)
+	}
+
+	type storageGroup struct {
+		config   *indexpb.StorageConfig
+		paths    []string
+		fieldIDs typeutil.Set[int64]
+	}
+	var groups []*storageGroup
+	for i, p := range paths {
+		resolved, config := p, storageConfig
+		if options.resolver != nil {
+			var err error
+			if resolved, config, err = options.resolver(p); err != nil {
+				return nil, err
+			}
+		}
+		group, ok := lo.Find(groups, func(g *storageGroup) bool { return !parallel && proto.Equal(g.config, config) })
+		if !ok {
+			group = &storageGroup{config: config, fieldIDs: typeutil.NewSet[int64]()}
+			groups = append(groups, group)
+		}
+		group.paths = append(group.paths, resolved)
+		if i < len(options.pathFieldIDs) {
+			group.fieldIDs.Insert(options.pathFieldIDs[i]...)
+		}
+	}
+	if len(groups) == 1 {
+		return options.open(groups[0].paths, schema, groups[0].config)
+	}
+	if len(options.pathFieldIDs) != len(paths) {
+		return nil, merr.WrapErrParameterInvalid(len(paths), len(options.pathFieldIDs), "fields of each path are required to read paths with separate readers")
+	}
+
+	ctx := options.ctx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	slots, err := options.fileLimiter.hold(ctx, int64(len(paths)))
+	if err != nil {
+		return nil, err
+	}
+	held = true
+	buffers := make([]*columnBuffer, 0, len(groups))
+	closeAll := func() {
+		for _, buffer := range buffers {
+			buffer.Close()
+		}
+		slots.release()
+	}
+	for _, group := range groups {
+		groupSchema := projectSchema(schema, group.fieldIDs)
+		inner, err := options.open(group.paths, groupSchema, group.config)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		buffers = append(buffers, &columnBuffer{inner: inner, fields: typeutil.GetAllFieldSchemas(groupSchema)})
+	}
+	return &mixedPackedRecordReader{buffers: buffers, parallelism: options.groupParallelism, slots: slots}, nil
+}
+
+// mixedPackedRecordReader zips the records of readers row by row, batched as the first one.
+type mixedPackedRecordReader struct {
+	buffers []*columnBuffer
+	// parallelism bounds the buffers filled at once, at most 1 to fill them in turn.
+	parallelism int
+	cur         Record
+	// slots are the slots of WithFileLimiter held for the files of all buffers.
+	slots *fileSlots
+}
+
+var _ RecordReader = (*mixedPackedRecordReader)(nil)
+
+func (mr *mixedPackedRecordReader) Next() (Record, error) {
+	if mr.cur != nil {
+		mr.cur.Release()
+		mr.cur = nil
+	}
+	first := mr.buffers[0]
+	if err := mr.fill(1); err != nil {
+		return nil, err
+	}
+	if first.pendingRows == 0 {
+		return nil, io.EOF
+	}
+	rows := first.pending[0].rows
+	if err := mr.fill(rows); err != nil {
+		return nil, err
+	}
+
+	var fields []*schemapb.FieldSchema
+	var arrays []arrow.Array
+	for i, buffer := range mr.buffers {
+		var err error
+		if buffer.pendingRows < rows {
+			err = merr.WrapErrServiceInternal(fmt.Sprintf("packed files of reader %d hold fewer rows than the others", i))
+		}
+		var taken []arrow.Array
+		if err == nil {
+			taken, err = buffer.take(rows)
+		}
+		if err != nil {
+			for _, arr := range arrays {
+				arr.Release()
+			}
+			return nil, err
+		}
+		fields = append(fields, buffer.fields...)
+		arrays = append(arrays, taken...)
+	}
+	mr.cur = newRecordFromArrays(fields, arrays, rows)
+	return mr.cur, nil
+}
+
+// fill fills every buffer with at least n rows, up to parallelism at once.
+func (mr *mixedPackedRecordReader) fill(n int) error {
+	if mr.parallelism <= 1 {
+		for _, buffer := range mr.buffers {
+			if err := buffer.fill(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, len(mr.buffers))
+	var group errgroup.Group
+	group.SetLimit(mr.parallelism)
+	for i, buffer := range mr.buffers {
+		group.Go(func() error {
+			errs[i] = buffer.fill(n)
+			return nil
+		})
+	}
+	group.Wait()
+	// the error of the first buffer failing in path order, not in time
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mr *mixedPackedRecordReader) Close() error {
+	if mr.cur != nil {
+		mr.cur.Release()
+		mr.cur = nil
+	}
+	var errs error
+	for _, buffer := range mr.buffers {
+		errs = merr.Combine(errs, buffer.Close())
+	}
+	mr.slots.release()
+	return errs
+}
+
+// columnBuffer buffers the columns read from an inner reader to take rows out of them in any count.
+type columnBuffer struct {
+	inner  RecordReader
+	fields []*schemapb.FieldSchema
+
+	// pending holds the columns of inner records not taken yet, retained by the buffer.
+	pending     []pendingBatch
+	pendingRows int
+	eof         bool
+}
+
+type pendingBatch struct {
+	cols []arrow.Array
+	rows int
+}
+
+// fill reads from the inner reader until at least n rows are buffered or it is drained.
+func (cb *columnBuffer) fill(n int) error {
+	for !cb.eof && cb.pendingRows < n {
+		rec, err := cb.inner.Next()
+		if err == io.EOF {
+			cb.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		cb.push(rec)
+	}
+	return nil
+}
+
+// push buffers the columns of rec, retaining them.
+func (cb *columnBuffer) push(rec Record) {
+	if rec.Len() == 0 {
+		return
+	}
+	cols := make([]arrow.Array, len(cb.fields))
+	for i, field := range cb.fields {
+		cols[i] = rec.Column(field.FieldID)
+		cols[i].Retain()
+	}
+	cb.pending = append(cb.pending, pendingBatch{cols: cols, rows: rec.Len()})
+	cb.pendingRows += rec.Len()
+}
+
+// take removes the first n buffered rows and returns them as arrays owned by the caller.
+func (cb *columnBuffer) take(n int) ([]arrow.Array, error) {
+	if n > cb.pendingRows {
+		return nil, merr.WrapErrServiceInternal(fmt.Sprintf("take %d rows from column buffer holding %d rows", n, cb.pendingRows))
+	}
+	pieces := make([][]arrow.Array, len(cb.fields))
+	for remaining := n; remaining > 0; {
+		batch := &cb.pending[0]
+		if batch.rows <= remaining {
+			for i, col := range batch.cols {
+				pieces[i] = append(pieces[i], col)
+			}
+			remaining -= batch.rows
+			cb.pending = cb.pending[1:]
+			continue
+		}
+		for i, col := range batch.cols {
+			pieces[i] = append(pieces[i], array.NewSlice(col, 0, int64(remaining)))
+			batch.cols[i] = array.NewSlice(col, int64(remaining), int64(batch.rows))
+			col.Release()
+		}
+		batch.rows -= remaining
+		remaining = 0
+	}
+	cb.pendingRows -= n
+
+	arrays := make([]arrow.Array, len(cb.fields))
+	for i, colPieces := range pieces {
+		if len(colPieces) == 1 {
+			arrays[i] = colPieces[0]
+			continue
+		}
+		arr, err := array.Concatenate(colPieces, memory.DefaultAllocator)
+		for _, piece := range colPieces {
+			piece.Release()
+		}
+		if err != nil {
+			for _, taken := range arrays[:i] {
+				taken.Release()
+			}
+			for _, rest := range pieces[i+1:] {
+				for _, piece := range rest {
+					piece.Release()
+				}
+			}
+			return nil, merr.WrapErrServiceInternal(fmt.Sprintf("concatenate column of field %d failed: %s", cb.fields[i].FieldID, err.Error()))
+		}
+		arrays[i] = arr
+	}
+	return arrays, nil
+}
+
+// skip drops the next n rows.
+func (cb *columnBuffer) skip(n int) error {
+	for n > 0 {
+		if err := cb.fill(n); err != nil {
+			return err
+		}
+		if cb.pendingRows == 0 {
+			return io.EOF
+		}
+		taken := min(n, cb.pendingRows)
+		arrays, err := cb.take(taken)
+		if err != nil {
+			return err
+		}
+		for _, arr := range arrays {
+			arr.Release()
+		}
+		n -= taken
+	}
+	return nil
+}
+
+func (cb *columnBuffer) Close() error {
+	cb.release()
+	return cb.inner.Close()
+}
+
+// release drops the buffered rows.
+func (cb *columnBuffer) release() {
+	for _, batch := range cb.pending {
+		for _, col := range batch.cols {
+			col.Release()
+		}
+	}
+	cb.pending, cb.pendingRows = nil, 0
+}
+
+// newRecordFromArrays builds a record of fields from arrays, taking over their references.
+func newRecordFromArrays(fields []*schemapb.FieldSchema, arrays []arrow.Array, rows int) Record {
+	arrowFields := make([]arrow.Field, len(fields))
+	field2Col := make(map[FieldID]int, len(fields))
+	for i, field := range fields {
+		arrowFields[i] = arrow.Field{
+			Name:     field.GetName(),
+			Type:     arrays[i].DataType(),
+			Nullable: field.GetNullable(),
+		}
+		field2Col[field.FieldID] = i
+	}
+	rec := array.NewRecord(arrow.NewSchema(arrowFields, nil), arrays, int64(rows))
+	// NewRecord retains the arrays
+	for _, arr := range arrays {
+		arr.Release()
+	}
+	return NewSimpleArrowRecord(rec, field2Col)
+}
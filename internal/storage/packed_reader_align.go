@@ -0,0 +1,144 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"unsafe"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/bitutil"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+)
+
+// WithBufferAlignment aligns the values of the vector columns returned to alignment bytes, a power of two.
+func WithBufferAlignment(alignment int) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.alignment = alignment
+	}
+}
+
+// AlignmentStats counts the vector columns read with WithBufferAlignment.
+type AlignmentStats struct {
+	// Aligned is the number of columns returned as decoded, already aligned.
+	Aligned int64
+	// Copied are the columns copied into aligned buffers, CopiedBytes their bytes
+	Copied      int64
+	CopiedBytes int64
+}
+
+// alignBatchReader aligns the vector columns of the batches of inner to alignment bytes.
+type alignBatchReader struct {
+	inner     packedBatchReader
+	alignment int
+	stats     *AlignmentStats
+	// mem allocates the copied columns, the Go allocator if nil.
+	mem memory.Allocator
+	// aligned is the batch returned last with copied columns, released on the next read.
+	aligned arrow.Record
+}
+
+func newAlignBatchReader(inner packedBatchReader, alignment int, stats *AlignmentStats) *alignBatchReader {
+	return &alignBatchReader{inner: inner, alignment: alignment, stats: stats}
+}
+
+func (r *alignBatchReader) ReadNext() (arrow.Record, error) {
+	r.releaseAligned()
+	batch, err := r.inner.ReadNext()
+	if err != nil {
+		return nil, err
+	}
+	var cols []arrow.Array
+	for i, col := range batch.Columns() {
+		fixed, ok := col.(*array.FixedSizeBinary)
+		if !ok || fixed.Len() == 0 {
+			continue
+		}
+		if r.isAligned(fixed) {
+			r.stats.Aligned++
+			continue
+		}
+		if cols == nil {
+			cols = make([]arrow.Array, batch.NumCols())
+			copy(cols, batch.Columns())
+		}
+		cols[i] = r.alignColumn(fixed)
+		defer cols[i].Release()
+	}
+	if cols == nil {
+		return batch, nil
+	}
+	r.aligned = array.NewRecord(batch.Schema(), cols, batch.NumRows())
+	return r.aligned, nil
+}
+
+// fixedSizeValues returns the bytes of the values of col, from its first row.
+func fixedSizeValues(col *array.FixedSizeBinary) []byte {
+	width := col.DataType().(*arrow.FixedSizeBinaryType).ByteWidth
+	data := col.Data()
+	return data.Buffers()[1].Bytes()[data.Offset()*width : (data.Offset()+data.Len())*width]
+}
+
+func (r *alignBatchReader) isAligned(col *array.FixedSizeBinary) bool {
+	values := fixedSizeValues(col)
+	return len(values) == 0 || uintptr(unsafe.Pointer(&values[0]))%uintptr(r.alignment) == 0
+}
+
+// alignColumn copies col into an aligned buffer, its validity into a bitmap at offset zero.
+func (r *alignBatchReader) alignColumn(col *array.FixedSizeBinary) arrow.Array {
+	mem := r.mem
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	values := fixedSizeValues(col)
+	raw := memory.NewResizableBuffer(mem)
+	defer raw.Release()
+	raw.Resize(len(values) + r.alignment)
+	pad := 0
+	if mis := int(uintptr(unsafe.Pointer(&raw.Bytes()[0])) % uintptr(r.alignment)); mis != 0 {
+		pad = r.alignment - mis
+	}
+	buf := memory.SliceBuffer(raw, pad, len(values))
+	defer buf.Release()
+	copy(buf.Bytes(), values)
+	r.stats.Copied++
+	r.stats.CopiedBytes += int64(len(values))
+
+	var validity *memory.Buffer
+	data := col.Data()
+	if col.NullN() > 0 {
+		validity = memory.NewResizableBuffer(mem)
+		defer validity.Release()
+		validity.Resize(int(bitutil.BytesForBits(int64(col.Len()))))
+		bitutil.CopyBitmap(data.Buffers()[0].Bytes(), data.Offset(), col.Len(), validity.Bytes(), 0)
+	}
+	aligned := array.NewData(col.DataType(), col.Len(), []*memory.Buffer{validity, buf}, nil, col.NullN(), 0)
+	defer aligned.Release()
+	return array.MakeFromData(aligned)
+}
+
+func (r *alignBatchReader) releaseAligned() {
+	if r.aligned != nil {
+		r.aligned.Release()
+		r.aligned = nil
+	}
+}
+
+func (r *alignBatchReader) Close() error {
+	r.releaseAligned()
+	return r.inner.Close()
+}
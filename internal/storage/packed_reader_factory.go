@@ -0,0 +1,230 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sync"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// PackedReaderFactory opens the packed record readers of many segments of the same
+// storage with shared configuration, for scans opening thousands of readers. All readers
+// are opened on the native filesystem handle the factory holds until it and its readers
+// are closed, so they share the filesystem and its connections however the native storage
+// caches filesystems meanwhile. They share the retry budget and allocator too, and every
+// schema is converted to arrow once. It is safe for concurrent use. Closing a reader of
+// the factory closes its files only, the filesystem and what the factory shares are kept
+// for the next readers.
+type PackedReaderFactory struct {
+	bufferSize           int64
+	storageConfig        *indexpb.StorageConfig
+	storagePluginContext *indexcgopb.StoragePluginContext
+	mem                  memory.Allocator
+	retryBudget          *RetryBudget
+	// open opens the filesystem of the storage config.
+	open func(storageConfig *indexpb.StorageConfig) (*packed.FileSystem, error)
+
+	mu sync.Mutex
+	// fs is the filesystem of the readers, held by the factory until closed and by the
+	// readers open, nil once released.
+	fs     *packed.FileSystem
+	closed bool
+	// schemas are the arrow schemas of the latest version of each collection schema read.
+	schemas map[factorySchemaKey]*factorySchema
+	// readers is the number of readers open.
+	readers atomic.Int64
+}
+
+// factorySchemaKey identifies the collection of a schema.
+type factorySchemaKey struct {
+	dbName string
+	name   string
+}
+
+// factorySchema is the arrow schema converted of a collection schema.
+type factorySchema struct {
+	schema      *schemapb.CollectionSchema
+	arrowSchema *arrow.Schema
+}
+
+type PackedReaderFactoryOption func(*PackedReaderFactory)
+
+// WithFactoryStorageConfig opens the files of the readers with storageConfig and
+// storagePluginContext instead of the configured storage.
+func WithFactoryStorageConfig(storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext) PackedReaderFactoryOption {
+	return func(f *PackedReaderFactory) {
+		f.storageConfig = storageConfig
+		f.storagePluginContext = storagePluginContext
+	}
+}
+
+// WithFactoryAllocator allocates the buffers of the readers with mem, see
+// WithReadAllocator.
+func WithFactoryAllocator(mem memory.Allocator) PackedReaderFactoryOption {
+	return func(f *PackedReaderFactory) {
+		f.mem = mem
+	}
+}
+
+// WithFactoryRetryBudget retries the failed opens and reads of all readers out of budget,
+// see WithRetryBudget.
+func WithFactoryRetryBudget(budget *RetryBudget) PackedReaderFactoryOption {
+	return func(f *PackedReaderFactory) {
+		f.retryBudget = budget
+	}
+}
+
+// withFactoryOpen opens the filesystem with open, replaced in tests to count them.
+func withFactoryOpen(open func(storageConfig *indexpb.StorageConfig) (*packed.FileSystem, error)) PackedReaderFactoryOption {
+	return func(f *PackedReaderFactory) {
+		f.open = open
+	}
+}
+
+// NewPackedReaderFactory returns a factory of packed record readers of bufferSize.
+func NewPackedReaderFactory(bufferSize int64, opts ...PackedReaderFactoryOption) (*PackedReaderFactory, error) {
+	if bufferSize <= 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid buffer size %d of packed reader factory", bufferSize)
+	}
+	f := &PackedReaderFactory{
+		bufferSize: bufferSize,
+		mem:        memory.DefaultAllocator,
+		open:       packed.NewFileSystem,
+		schemas:    make(map[factorySchemaKey]*factorySchema),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	fs, err := f.open(f.storageConfig)
+	if err != nil {
+		return nil, err
+	}
+	f.fs = fs
+	return f, nil
+}
+
+// NewReader opens the reader of the column group files paths of a chunk of schema, as
+// newPackedRecordReader does with opts and the shared configuration of the factory. The
+// arrow schema of schema is kept until a schema of a newer version of its collection is
+// read, and reused for the same schema pointer, so pass the same schema to the readers of
+// a collection, not copies of it.
+func (f *PackedReaderFactory) NewReader(paths []string, schema *schemapb.CollectionSchema, opts ...PackedReaderOption) (RecordReader, error) {
+	fs, arrowSchema, err := f.acquire(schema)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]PackedReaderOption{WithReadAllocator(f.mem)}, opts...)
+	if f.retryBudget != nil {
+		opts = append(opts, WithRetryBudget(f.retryBudget))
+	}
+	opts = append(opts, func(o *packedReaderOptions) {
+		o.fileSystem = fs
+		o.arrowSchema = arrowSchema
+	})
+	reader, err := newPackedRecordReader(paths, schema, f.bufferSize, f.storageConfig, f.storagePluginContext, opts...)
+	if err != nil {
+		return nil, merr.Combine(err, f.release())
+	}
+	return &factoryRecordReader{RecordReader: reader, factory: f}, nil
+}
+
+// Readers returns the number of readers of the factory not closed yet.
+func (f *PackedReaderFactory) Readers() int64 {
+	return f.readers.Load()
+}
+
+// Close releases the filesystem of the factory once its readers still open are closed,
+// failing the readers opened next.
+func (f *PackedReaderFactory) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.releaseFileSystem()
+}
+
+// acquire holds the filesystem of the factory for a reader of schema, until release, and
+// returns it with the arrow schema of schema.
+func (f *PackedReaderFactory) acquire(schema *schemapb.CollectionSchema) (*packed.FileSystem, *arrow.Schema, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, nil, merr.WrapErrServiceInternal("packed reader factory is closed")
+	}
+	key := factorySchemaKey{dbName: schema.GetDbName(), name: schema.GetName()}
+	cached, ok := f.schemas[key]
+	if !ok || cached.schema != schema {
+		arrowSchema, err := ConvertToArrowSchema(schema, true)
+		if err != nil {
+			return nil, nil, merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", schema.Name, err.Error())
+		}
+		fresh := &factorySchema{schema: schema, arrowSchema: arrowSchema}
+		// the readers of an older version still being opened do not evict the newer one
+		if !ok || schema.GetVersion() >= cached.schema.GetVersion() {
+			f.schemas[key] = fresh
+		}
+		cached = fresh
+	}
+	f.readers.Inc()
+	return f.fs, cached.arrowSchema, nil
+}
+
+// release drops the hold of a reader closed on the filesystem.
+func (f *PackedReaderFactory) release() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readers.Dec()
+	return f.releaseFileSystem()
+}
+
+// releaseFileSystem closes the filesystem once the factory is closed and no reader holds
+// it, so that readers retrying their reads still reopen their files on it.
+func (f *PackedReaderFactory) releaseFileSystem() error {
+	if !f.closed || f.readers.Load() > 0 || f.fs == nil {
+		return nil
+	}
+	err := f.fs.Close()
+	f.fs = nil
+	return err
+}
+
+// factoryRecordReader releases the filesystem of its factory once closed.
+type factoryRecordReader struct {
+	RecordReader
+	factory *PackedReaderFactory
+	closed  bool
+}
+
+func (r *factoryRecordReader) Close() error {
+	err := r.RecordReader.Close()
+	if !r.closed {
+		r.closed = true
+		err = merr.Combine(err, r.factory.release())
+	}
+	return err
+}
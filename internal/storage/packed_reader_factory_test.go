@@ -0,0 +1,132 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestPackedReaderFactory(t *testing.T) {
+	size := 20
+	paths := []string{"/tmp/reader_factory/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	opens := 0
+	factory, err := NewPackedReaderFactory(1024, withFactoryOpen(func(storageConfig *indexpb.StorageConfig) (*packed.FileSystem, error) {
+		opens++
+		return packed.NewFileSystem(storageConfig)
+	}))
+	require.NoError(t, err)
+
+	var g errgroup.Group
+	for i := 0; i < 16; i++ {
+		g.Go(func() error {
+			for j := 0; j < 20; j++ {
+				reader, err := factory.NewReader(paths, schema)
+				if err != nil {
+					return err
+				}
+				// every other reader is closed after its first record
+				rows := 0
+				for {
+					rec, err := reader.Next()
+					if err == io.EOF {
+						assert.Equal(t, size, rows)
+						break
+					}
+					if err != nil {
+						reader.Close()
+						return err
+					}
+					rows += rec.Len()
+					if j%2 != 0 {
+						break
+					}
+				}
+				if err := reader.Close(); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	require.NoError(t, g.Wait())
+	// all readers were opened on the filesystem of the factory, kept past their close
+	assert.Equal(t, 1, opens)
+	assert.Equal(t, int64(0), factory.Readers())
+	assert.NotNil(t, factory.fs)
+	assert.Len(t, factory.schemas, 1)
+
+	t.Run("schema versions", func(t *testing.T) {
+		key := factorySchemaKey{name: schema.GetName()}
+		newer := proto.Clone(schema).(*schemapb.CollectionSchema)
+		newer.Version = schema.GetVersion() + 1
+		reader, err := factory.NewReader(paths, newer)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Same(t, newer, factory.schemas[key].schema)
+		// an older version does not evict the newer one
+		reader, err = factory.NewReader(paths, schema)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Same(t, newer, factory.schemas[key].schema)
+		assert.Len(t, factory.schemas, 1)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		reader, err := factory.NewReader(paths, schema)
+		require.NoError(t, err)
+		require.NoError(t, factory.Close())
+		// the reader open keeps the filesystem
+		assert.NotNil(t, factory.fs)
+		rows := 0
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			rows += rec.Len()
+		}
+		assert.Equal(t, size, rows)
+		require.NoError(t, reader.Close())
+		assert.Nil(t, factory.fs)
+		assert.Equal(t, int64(0), factory.Readers())
+
+		_, err = factory.NewReader(paths, schema)
+		assert.ErrorIs(t, err, merr.ErrServiceInternal)
+		assert.NoError(t, factory.Close())
+		assert.Equal(t, 1, opens)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewPackedReaderFactory(0)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
@@ -0,0 +1,213 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"slices"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/parquet/metadata"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// rowSelection drops the rows of the records read not selected, before they are returned.
+type rowSelection struct {
+	tsRange   *timestampRange
+	rowFilter func(rec Record, row int) bool
+	// rowGroupPruning, tsRowGroups and tsRowGroupsInRange hold the row groups selected by their stats, nil to keep all.
+	rowGroupPruning    *rowGroupMatch
+	tsRowGroups        *rowGroupMatch
+	tsRowGroupsInRange *rowGroupMatch
+}
+
+// initPruning reads the row group stats of the footers of paths, returning the first row of WithRowGroupRange.
+func (s *rowSelection) initPruning(ctx context.Context, schema *schemapb.CollectionSchema, paths []string,
+	arrowSchema *arrow.Schema, field2Col map[FieldID]int, options *packedReaderOptions, sketching bool,
+) (int64, error) {
+	if p := options.rowGroupPredicate; p != nil {
+		if err := p.validate(schema); err != nil {
+			return 0, err
+		}
+		if sketching {
+			return 0, merr.WrapErrParameterInvalidMsg("row groups cannot be pruned by a reader building a skip index or distinct counts")
+		}
+		ends, stats, err := rowGroupStats(ctx, p.cm, paths, arrowSchema.Field(field2Col[p.fieldID]).Name)
+		if err != nil {
+			return 0, err
+		}
+		if ends != nil {
+			s.rowGroupPruning = newRowGroupMatch(ends, stats, true, p.mayMatch)
+		}
+	}
+	if r := s.tsRange; r != nil && r.cm != nil {
+		col, ok := field2Col[common.TimeStampField]
+		if !ok {
+			return 0, merr.WrapErrParameterInvalidMsg("timestamp range of packed reader needs the timestamp field")
+		}
+		ends, stats, err := rowGroupStats(ctx, r.cm, paths, arrowSchema.Field(col).Name)
+		if err != nil {
+			return 0, err
+		}
+		if ends != nil {
+			s.tsRowGroups = newRowGroupMatch(ends, stats, true, r.mayHold)
+			s.tsRowGroupsInRange = newRowGroupMatch(ends, stats, false, r.holdsOnly)
+		}
+	}
+	var firstRow int64
+	for _, m := range []*rowGroupMatch{s.rowGroupPruning, s.tsRowGroups} {
+		if r := options.rowGroupRange; m != nil && r != nil && r.offset > 0 && r.offset <= len(m.ends) {
+			firstRow = m.ends[r.offset-1]
+		}
+	}
+	return firstRow, nil
+}
+
+// SetRowFilter drops the rows of the records read next failing filter, after WithTimestampRange, nil for none.
+func (s *rowSelection) SetRowFilter(filter func(rec Record, row int) bool) {
+	s.rowFilter = filter
+}
+
+// filtering tells whether the rows are filtered one by one.
+func (s *rowSelection) filtering() bool {
+	return s.tsRange != nil || s.rowFilter != nil
+}
+
+// filterRows returns the rows of rec kept by the filters, rec if all are, nil if none is.
+func (pr *packedRecordReader) filterRows(rec arrow.Record) (arrow.Record, error) {
+	r := NewSimpleArrowRecord(rec, pr.field2Col)
+	var keep []bool
+	kept := r.Len()
+	if pr.tsRange != nil {
+		tsCol, ok := r.Column(common.TimeStampField).(*array.Int64)
+		if !ok {
+			return nil, merr.WrapErrServiceInternal("timestamp range of packed reader needs the int64 timestamp column")
+		}
+		ts := tsCol.Int64Values()
+		// row groups out of the range were dropped by rowsMayMatch, those wholly in it are kept as is
+		inRange := pr.tsRowGroupsInRange != nil && pr.tsRowGroupsInRange.all(pr.rowsRead-rec.NumRows(), pr.rowsRead)
+		if !inRange {
+			keep = make([]bool, len(ts))
+			kept = 0
+			for i, t := range ts {
+				if keep[i] = pr.tsRange.contains(Timestamp(t)); keep[i] {
+					kept++
+				}
+			}
+		}
+	}
+	if pr.rowFilter != nil {
+		if keep == nil {
+			keep = make([]bool, r.Len())
+			for i := range keep {
+				keep[i] = true
+			}
+		}
+		kept = 0
+		for i := range keep {
+			if keep[i] = keep[i] && pr.rowFilter(r, i); keep[i] {
+				kept++
+			}
+		}
+	}
+	pr.position += rec.NumRows() - int64(kept)
+	if kept == 0 {
+		return nil, nil
+	}
+	if kept == r.Len() {
+		return rec, nil
+	}
+	fields := lo.Filter(typeutil.GetAllFieldSchemas(pr.schema), func(f *schemapb.FieldSchema, _ int) bool {
+		_, ok := pr.field2Col[f.GetFieldID()]
+		return ok
+	})
+	slices.SortFunc(fields, func(a, b *schemapb.FieldSchema) int {
+		return pr.field2Col[a.GetFieldID()] - pr.field2Col[b.GetFieldID()]
+	})
+	filtered, err := filterRecordRowsWith(pr.mem, r, fields, keep, kept)
+	if err != nil {
+		return nil, err
+	}
+	// rec may be the record sliced, whose buffers the filtered record retains
+	pr.releaseSliced()
+	pr.sliced = filtered.(*simpleArrowRecord).r
+	return pr.sliced, nil
+}
+
+// rowsMayMatch tells whether the rows [start, end) of the files may be selected by their row groups.
+func (s *rowSelection) rowsMayMatch(start, end int64) bool {
+	for _, m := range []*rowGroupMatch{s.rowGroupPruning, s.tsRowGroups} {
+		if m != nil && !m.any(start, end) {
+			return false
+		}
+	}
+	return true
+}
+
+// timestampRange is the inclusive range of WithTimestampRange, cm reading the footers, nil for none.
+type timestampRange struct {
+	cm       ChunkManager
+	min, max Timestamp
+}
+
+func (r *timestampRange) contains(ts Timestamp) bool {
+	return ts >= r.min && ts <= r.max
+}
+
+// mayHold tells whether stats of the timestamp column may hold a timestamp in the range.
+func (r *timestampRange) mayHold(stats metadata.TypedStatistics, _ int64) bool {
+	s, ok := stats.(*metadata.Int64Statistics)
+	if !ok || !s.HasMinMax() {
+		return true
+	}
+	return Timestamp(s.Max()) >= r.min && Timestamp(s.Min()) <= r.max
+}
+
+// holdsOnly tells whether stats of the timestamp column prove all timestamps are in the range.
+func (r *timestampRange) holdsOnly(stats metadata.TypedStatistics, _ int64) bool {
+	s, ok := stats.(*metadata.Int64Statistics)
+	if !ok || !s.HasMinMax() {
+		return false
+	}
+	return r.contains(Timestamp(s.Min())) && r.contains(Timestamp(s.Max()))
+}
+
+// WithTimestampRange returns only the rows of a timestamp in [minTs, maxTs], pruning row groups by the footers read through cm.
+func WithTimestampRange(cm ChunkManager, minTs, maxTs Timestamp) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.tsRange = &timestampRange{cm: cm, min: minTs, max: maxTs}
+	}
+}
+
+// rowGroupRange are the count row groups from offset on of a file.
+type rowGroupRange struct {
+	offset int
+	count  int
+}
+
+// WithRowGroupRange reads only count row groups from offset on of a single column group file, seeking by its footer.
+func WithRowGroupRange(offset, count int) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.rowGroupRange = &rowGroupRange{offset: offset, count: count}
+	}
+}
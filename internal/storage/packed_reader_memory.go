@@ -0,0 +1,154 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// recordBudget caps the bytes of the records returned and not released yet, see WithMaxTotalBytes.
+type recordBudget struct {
+	maxTotalBytes int64
+	outstanding   *atomic.Int64
+	// lastHook is the hook of the record returned last, whose reference the reader drops on the next read.
+	lastHook *releaseHook
+}
+
+func newRecordBudget(maxTotalBytes int64) recordBudget {
+	if maxTotalBytes <= 0 {
+		return recordBudget{}
+	}
+	return recordBudget{maxTotalBytes: maxTotalBytes, outstanding: atomic.NewInt64(0)}
+}
+
+// reserve counts rec to the outstanding bytes unless over the ceiling, a record is admitted alone though.
+func (b *recordBudget) reserve(rec arrow.Record) (*releaseHook, error) {
+	if b.maxTotalBytes <= 0 {
+		return nil, nil
+	}
+	size := int64(recordDataSize(rec))
+	outstanding := b.outstanding.Load()
+	if outstanding > 0 && outstanding+size > b.maxTotalBytes {
+		return nil, merr.WrapErrServiceMemoryLimitExceeded(float32(outstanding+size), float32(b.maxTotalBytes),
+			fmt.Sprintf("packed reader holds %d bytes of records not released, next record of %d rows takes %d bytes",
+				outstanding, rec.NumRows(), size))
+	}
+	b.outstanding.Add(size)
+	hook := newReleaseHook(func() { b.outstanding.Sub(size) })
+	b.lastHook = hook
+	return hook, nil
+}
+
+// dropLast drops the reference of the reader to the record returned last.
+func (b *recordBudget) dropLast() {
+	if b.lastHook != nil {
+		b.lastHook.release()
+		b.lastHook = nil
+	}
+}
+
+// OutstandingBytes returns the bytes of the records returned and not released yet, 0 without WithMaxTotalBytes.
+func (b *recordBudget) OutstandingBytes() int64 {
+	if b.outstanding == nil {
+		return 0
+	}
+	return b.outstanding.Load()
+}
+
+// WithMaxRecordBytes splits the batches larger than maxRecordBytes into zero-copy slices.
+func WithMaxRecordBytes(maxRecordBytes int64) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.maxRecordBytes = maxRecordBytes
+	}
+}
+
+// WithMaxTotalBytes fails reading a record that would hold more than maxTotalBytes of records not released.
+func WithMaxTotalBytes(maxTotalBytes int64) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.maxTotalBytes = maxTotalBytes
+	}
+}
+
+// splitBatchReader splits the batches of inner larger than maxBytes into slices.
+type splitBatchReader struct {
+	inner    packedBatchReader
+	maxBytes uint64
+	// batch is the batch being split from row offset on, piece the slice returned last
+	batch  arrow.Record
+	offset int64
+	piece  arrow.Record
+}
+
+func newSplitBatchReader(inner packedBatchReader, maxBytes int64) *splitBatchReader {
+	return &splitBatchReader{inner: inner, maxBytes: uint64(maxBytes)}
+}
+
+func recordDataSize(rec arrow.Record) uint64 {
+	var size uint64
+	for _, col := range rec.Columns() {
+		size += calculateActualDataSize(col)
+	}
+	return size
+}
+
+func (r *splitBatchReader) ReadNext() (arrow.Record, error) {
+	r.releasePiece()
+	if r.batch == nil || r.offset >= r.batch.NumRows() {
+		batch, err := r.inner.ReadNext()
+		if err != nil {
+			r.batch = nil
+			return nil, err
+		}
+		size := recordDataSize(batch)
+		if size <= r.maxBytes || batch.NumRows() <= 1 {
+			r.batch = nil
+			return batch, nil
+		}
+		r.batch, r.offset = batch, 0
+	}
+	// estimate the rows fitting by the average row size, halving them while the slice is too large
+	rows := r.batch.NumRows() - r.offset
+	rows = min(rows, max(1, int64(float64(r.batch.NumRows())*float64(r.maxBytes)/float64(recordDataSize(r.batch)))))
+	for {
+		r.piece = r.batch.NewSlice(r.offset, r.offset+rows)
+		if rows == 1 || recordDataSize(r.piece) <= r.maxBytes {
+			break
+		}
+		r.releasePiece()
+		rows /= 2
+	}
+	r.offset += rows
+	return r.piece, nil
+}
+
+func (r *splitBatchReader) releasePiece() {
+	if r.piece != nil {
+		r.piece.Release()
+		r.piece = nil
+	}
+}
+
+func (r *splitBatchReader) Close() error {
+	r.releasePiece()
+	r.batch = nil
+	return r.inner.Close()
+}
@@ -0,0 +1,223 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// StorageConfigResolver resolves the storage config and path to open a packed file path with.
+type StorageConfigResolver func(path string) (string, *indexpb.StorageConfig, error)
+
+// NewSchemeStorageConfigResolver resolves paths by their URI scheme, stripping it.
+func NewSchemeStorageConfigResolver(configs map[string]*indexpb.StorageConfig) StorageConfigResolver {
+	return func(p string) (string, *indexpb.StorageConfig, error) {
+		scheme, rest, ok := strings.Cut(p, "://")
+		if !ok {
+			scheme, rest = "", p
+		}
+		config, ok := configs[scheme]
+		if !ok {
+			return "", nil, merr.WrapErrParameterInvalidMsg("no storage config for scheme %q of path %s", scheme, p)
+		}
+		return rest, config, nil
+	}
+}
+
+type packedReaderOptions struct {
+	resolver     StorageConfigResolver
+	pathFieldIDs [][]int64
+	batchTimeout time.Duration
+	largeStrings bool
+	rewritePath  PathRewriter
+	replicas     [][]string
+	// dictionaryFields are the fields read dictionary-encoded.
+	dictionaryFields []FieldID
+	// rowGroupPredicate prunes the row groups read, see WithRowGroupPruning.
+	rowGroupPredicate *rowGroupPredicate
+	// rowGroupRange are the row groups read, see WithRowGroupRange, nil for all.
+	rowGroupRange *rowGroupRange
+	// readPolicy coalesces the reads of the native readers, see WithReadPolicy.
+	readPolicy *ReadPolicy
+	// skipIndexFields are the fields of the skip index built over the row groups.
+	skipIndexFields []FieldID
+	distinctFields  []FieldID
+	retryBudget     *RetryBudget
+	maxRecordBytes  int64
+	maxTotalBytes   int64
+	fingerprint     bool
+	// fingerprintSchema is the schema of WithSchemaFingerprintCheck, nil for the one read with
+	fingerprintSchema *schemapb.CollectionSchema
+	// groupRowCountCheck compares the footer row counts on open
+	groupRowCountCheck bool
+	alignment          int
+	// fileLimiter bounds the files open, see WithFileLimiter.
+	fileLimiter *FileLimiter
+	// groupParallelism bounds the column group files decoded at once
+	groupParallelism int
+	// decodePool decodes the batches of the packed files, see WithDecodePool.
+	decodePool *DecodePool
+	tsRange    *timestampRange
+	ctx        context.Context
+	observer   ProgressObserver
+	mem        memory.Allocator
+	// checksumCM reads the checksums at checksumPath, see WithChecksumVerification.
+	checksumCM   ChunkManager
+	checksumPath string
+	// fileSystem is the shared native filesystem of a PackedReaderFactory, nil for the storage config one
+	fileSystem *packed.FileSystem
+	// arrowSchema is the arrow schema converted by a PackedReaderFactory, nil to convert per reader
+	arrowSchema *arrow.Schema
+	// open opens the files of one storage, replaced in tests to mock remote storages.
+	open func(paths []string, schema *schemapb.CollectionSchema, storageConfig *indexpb.StorageConfig) (RecordReader, error)
+}
+
+// rewrite applies the path rewriter of WithPathRewriter to paths, if any.
+func (o *packedReaderOptions) rewrite(paths []string) []string {
+	if o.rewritePath == nil {
+		return paths
+	}
+	return lo.Map(paths, func(p string, _ int) string { return o.rewritePath(p) })
+}
+
+func (o *packedReaderOptions) validate(paths []string) error {
+	if a := o.alignment; a < 0 || a&(a-1) != 0 {
+		return merr.WrapErrParameterInvalidMsg("buffer alignment of packed reader must be a power of two, got %d", a)
+	}
+	if r := o.tsRange; r != nil && r.min > r.max {
+		return merr.WrapErrParameterInvalidMsg("invalid timestamp range [%d, %d] of packed reader", r.min, r.max)
+	}
+	if r := o.rowGroupRange; r != nil {
+		switch {
+		case r.offset < 0 || r.count < 0:
+			return merr.WrapErrParameterInvalidMsg("invalid row group range of offset %d and count %d of packed reader", r.offset, r.count)
+		case len(paths) != 1:
+			return merr.WrapErrParameterInvalidMsg("row group range of packed reader needs a single column group file, got %d", len(paths))
+		case o.checksumCM != nil:
+			return merr.WrapErrParameterInvalidMsg("row group range of packed reader cannot be verified by the batch checksums of all row groups")
+		case o.readPolicy != nil:
+			return merr.WrapErrParameterInvalidMsg("row group range of packed reader cannot coalesce its reads by a read policy")
+		}
+	}
+	if p := o.readPolicy; p != nil && (p.MaxSpan < 0 || p.MaxGap < 0) {
+		return merr.WrapErrParameterInvalidMsg("invalid read policy of packed reader, max span %d, max gap %d", p.MaxSpan, p.MaxGap)
+	}
+	return nil
+}
+
+type PackedReaderOption func(*packedReaderOptions)
+
+// WithStorageConfigResolver opens each path with its resolved storage config, pathFieldIDs listing the fields per path.
+func WithStorageConfigResolver(resolver StorageConfigResolver, pathFieldIDs [][]int64) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.resolver = resolver
+		o.pathFieldIDs = pathFieldIDs
+	}
+}
+
+// WithGroupReadParallelism reads every column group file with its own reader, up to parallelism at once.
+func WithGroupReadParallelism(parallelism int, pathFieldIDs [][]int64) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.groupParallelism = parallelism
+		o.pathFieldIDs = pathFieldIDs
+	}
+}
+
+// PathRewriter maps a stored path to the path to open it at.
+type PathRewriter func(path string) string
+
+// WithPathRewriter opens every packed file at the path rewritten by rewriter.
+func WithPathRewriter(rewriter PathRewriter) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.rewritePath = rewriter
+	}
+}
+
+// WithSchemaFingerprintCheck fails opening files whose schema fingerprint differs from the one of schema.
+func WithSchemaFingerprintCheck(schema *schemapb.CollectionSchema) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.fingerprint = true
+		o.fingerprintSchema = schema
+	}
+}
+
+// WithDictionaryReads reads the VarChar fields of fieldIDs as arrow dictionaries.
+func WithDictionaryReads(fieldIDs ...FieldID) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.dictionaryFields = append(o.dictionaryFields, fieldIDs...)
+	}
+}
+
+// WithLargeStringReads reads the string fields as arrow large strings.
+func WithLargeStringReads() PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.largeStrings = true
+	}
+}
+
+// ProgressObserver is notified of the batches read and written by the readers and writers it is set on.
+type ProgressObserver interface {
+	OnRead(rows int, bytes uint64)
+	OnWrite(rows int, bytes uint64)
+}
+
+// WithChecksumVerification checks every batch read against the checksums of WithBatchChecksums at sidecarPath.
+func WithChecksumVerification(cm ChunkManager, sidecarPath string) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.checksumCM = cm
+		o.checksumPath = sidecarPath
+	}
+}
+
+// WithReadAllocator allocates the buffers copied in Go with mem.
+func WithReadAllocator(mem memory.Allocator) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.mem = mem
+	}
+}
+
+// WithReadObserver calls OnRead of observer for every record returned by Next.
+func WithReadObserver(observer ProgressObserver) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.observer = observer
+	}
+}
+
+// WithReadContext fails the reads once ctx is done, closing the files.
+func WithReadContext(ctx context.Context) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithReadPolicy coalesces the column chunk reads of the native readers by policy, see ReadStats.
+func WithReadPolicy(policy ReadPolicy) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.readPolicy = &policy
+	}
+}
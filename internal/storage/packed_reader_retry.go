@@ -0,0 +1,390 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus/pkg/v2/log"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// WithPerBatchTimeout fails a read after timeout spent on a single batch.
+func WithPerBatchTimeout(timeout time.Duration) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.batchTimeout = timeout
+	}
+}
+
+// WithReplicaPaths fails a read over to the copies of the files at replicas, resuming at the row it stopped at.
+func WithReplicaPaths(replicas [][]string) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.replicas = replicas
+	}
+}
+
+// WithRetryBudget reopens the files on a transient failure and resumes at the row it stopped at, spending budget.
+func WithRetryBudget(budget *RetryBudget) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.retryBudget = budget
+	}
+}
+
+// timeoutBatchReader fails every read after one timed out, Close waiting for the pending read.
+type timeoutBatchReader struct {
+	inner   packedBatchReader
+	timeout time.Duration
+	paths   []string
+	err     error
+	// pending returns the read expired, nil if none.
+	pending <-chan batchReadResult
+}
+
+type batchReadResult struct {
+	rec arrow.Record
+	err error
+}
+
+func newTimeoutBatchReader(inner packedBatchReader, timeout time.Duration, paths []string) *timeoutBatchReader {
+	return &timeoutBatchReader{inner: inner, timeout: timeout, paths: paths}
+}
+
+func (r *timeoutBatchReader) ReadNext() (arrow.Record, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	done := make(chan batchReadResult, 1)
+	go func() {
+		rec, err := r.inner.ReadNext()
+		done <- batchReadResult{rec, err}
+	}()
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.rec, res.err
+	case <-timer.C:
+		r.err = merr.Combine(merr.WrapErrIoFailedReason(
+			fmt.Sprintf("read of packed files %v exceeds the batch timeout %s", r.paths, r.timeout)), context.DeadlineExceeded)
+		r.pending = done
+		return nil, r.err
+	}
+}
+
+func (r *timeoutBatchReader) Close() error {
+	if r.pending != nil {
+		if res := <-r.pending; res.rec != nil {
+			res.rec.Release()
+		}
+		r.pending = nil
+	}
+	return r.inner.Close()
+}
+
+// failoverBatchReader fails over to the next copy of the files on a read error, resuming at its row.
+type failoverBatchReader struct {
+	open     func(paths []string) (packedBatchReader, error)
+	replicas [][]string
+	cur      packedBatchReader
+	// rows are the rows returned so far, sliced the remainder of the skipped batch
+	rows   int64
+	sliced arrow.Record
+	// errs are the failures of the copies failed over from.
+	errs error
+}
+
+// newFailoverBatchReader opens the first copy of replicas it can.
+func newFailoverBatchReader(open func(paths []string) (packedBatchReader, error), replicas [][]string) (*failoverBatchReader, error) {
+	fr := &failoverBatchReader{open: open, replicas: replicas}
+	if err := fr.failover(nil); err != nil {
+		return nil, err
+	}
+	return fr, nil
+}
+
+// failover opens the next copy that opens, cause is the error that made the current copy fail.
+func (fr *failoverBatchReader) failover(cause error) error {
+	if fr.cur != nil {
+		fr.cur.Close()
+		fr.cur = nil
+	}
+	fr.errs = merr.Combine(fr.errs, cause)
+	for len(fr.replicas) > 0 {
+		paths := fr.replicas[0]
+		fr.replicas = fr.replicas[1:]
+		reader, err := fr.open(paths)
+		if err != nil {
+			log.Warn("failed to open replica of packed files", zap.Strings("paths", paths), zap.Error(err))
+			fr.errs = merr.Combine(fr.errs, err)
+			continue
+		}
+		if cause != nil {
+			log.Warn("fail over to replica of packed files", zap.Strings("paths", paths), zap.Int64("resumeRow", fr.rows), zap.Error(cause))
+		}
+		fr.cur = reader
+		return nil
+	}
+	return fr.errs
+}
+
+func (fr *failoverBatchReader) ReadNext() (arrow.Record, error) {
+	if fr.sliced != nil {
+		fr.sliced.Release()
+		fr.sliced = nil
+	}
+	if fr.cur == nil {
+		// all copies failed
+		return nil, fr.errs
+	}
+	// rows of the current copy to skip after a failover
+	skip := int64(0)
+	for {
+		rec, err := fr.cur.ReadNext()
+		if err == io.EOF && skip == 0 {
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			err = merr.WrapErrIoUnexpectEOF("replica of packed files", io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			if err := fr.failover(err); err != nil {
+				return nil, err
+			}
+			skip = fr.rows
+			continue
+		}
+		if skip >= rec.NumRows() {
+			skip -= rec.NumRows()
+			continue
+		}
+		if skip > 0 {
+			fr.sliced = rec.NewSlice(skip, rec.NumRows())
+			rec = fr.sliced
+		}
+		fr.rows += rec.NumRows()
+		return rec, nil
+	}
+}
+
+func (fr *failoverBatchReader) Close() error {
+	if fr.sliced != nil {
+		fr.sliced.Release()
+		fr.sliced = nil
+	}
+	if fr.cur != nil {
+		return fr.cur.Close()
+	}
+	return nil
+}
+
+// RetryBudget bounds the retries of the opens and reads of a scan, see WithRetryBudget.
+type RetryBudget struct {
+	retries        int64
+	remaining      atomic.Int64
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// maxAttempts caps the consecutive retries of a read, 0 for no cap
+	retryable   func(error) bool
+	maxAttempts int
+}
+
+type RetryBudgetOption func(*RetryBudget)
+
+// WithRetryable retries only the failures for which retryable returns true.
+func WithRetryable(retryable func(error) bool) RetryBudgetOption {
+	return func(b *RetryBudget) {
+		b.retryable = retryable
+	}
+}
+
+// WithMaxAttempts fails a read once retried maxAttempts times in a row.
+func WithMaxAttempts(maxAttempts int) RetryBudgetOption {
+	return func(b *RetryBudget) {
+		b.maxAttempts = maxAttempts
+	}
+}
+
+// NewRetryBudget returns a budget of retries with a backoff doubling from initialBackoff to maxBackoff.
+func NewRetryBudget(retries int64, initialBackoff, maxBackoff time.Duration, opts ...RetryBudgetOption) *RetryBudget {
+	b := &RetryBudget{
+		retries:        retries,
+		initialBackoff: initialBackoff,
+		maxBackoff:     max(initialBackoff, maxBackoff),
+		retryable:      IsTransientStorageError,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.remaining.Store(retries)
+	return b
+}
+
+// IsTransientStorageError tells whether err is a storage failure a retry may get past.
+func IsTransientStorageError(err error) bool {
+	return errors.IsAny(err, merr.ErrIoFailed, merr.ErrIoUnexpectEOF, context.DeadlineExceeded) || merr.IsRetryableErr(err)
+}
+
+// Remaining returns the number of retries left.
+func (b *RetryBudget) Remaining() int64 {
+	return max(b.remaining.Load(), 0)
+}
+
+// take spends a retry, it returns false if none is left.
+func (b *RetryBudget) take() bool {
+	return b.remaining.Dec() >= 0
+}
+
+// backoff returns the time to wait before the attempt-th consecutive retry, from 0.
+func (b *RetryBudget) backoff(attempt int) time.Duration {
+	backoff := b.initialBackoff
+	for i := 0; i < attempt && backoff < b.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, b.maxBackoff)
+}
+
+// retryBatchReader reopens the files on a failure within budget, resuming at the row it stopped at.
+type retryBatchReader struct {
+	open   func() (packedBatchReader, error)
+	budget *RetryBudget
+	cur    packedBatchReader
+	// rows are the rows returned so far, sliced the remainder of the skipped batch
+	rows   int64
+	sliced arrow.Record
+	// attempts counts the retries since the last read, err the failure exhausting the budget
+	attempts int
+	err      error
+}
+
+func newRetryBatchReader(open func() (packedBatchReader, error), budget *RetryBudget) (*retryBatchReader, error) {
+	rr := &retryBatchReader{open: open, budget: budget}
+	if err := rr.reopen(nil); err != nil {
+		return nil, err
+	}
+	return rr, nil
+}
+
+// reopen opens the files again, after backing off if cause is the failure retried.
+func (rr *retryBatchReader) reopen(cause error) error {
+	if rr.cur != nil {
+		rr.cur.Close()
+		rr.cur = nil
+	}
+	for {
+		if cause != nil {
+			if !rr.budget.retryable(cause) {
+				rr.err = cause
+				return cause
+			}
+			if rr.budget.maxAttempts > 0 && rr.attempts >= rr.budget.maxAttempts {
+				rr.err = errors.Wrapf(cause, "packed read failed after %d retries", rr.attempts)
+				return rr.err
+			}
+			if !rr.budget.take() {
+				rr.err = errors.Wrapf(cause, "retry budget of %d retries of the scan exhausted", rr.budget.retries)
+				return rr.err
+			}
+			backoff := rr.budget.backoff(rr.attempts)
+			rr.attempts++
+			log.Warn("retry packed files", zap.Int64("resumeRow", rr.rows), zap.Duration("backoff", backoff),
+				zap.Int64("remainingRetries", rr.budget.Remaining()), zap.Error(cause))
+			time.Sleep(backoff)
+		}
+		reader, err := rr.open()
+		if err == nil {
+			rr.cur = reader
+			return nil
+		}
+		cause = err
+	}
+}
+
+func (rr *retryBatchReader) ReadNext() (arrow.Record, error) {
+	if rr.sliced != nil {
+		rr.sliced.Release()
+		rr.sliced = nil
+	}
+	if rr.cur == nil {
+		return nil, rr.err
+	}
+	// rows of the reopened files to skip after a retry
+	skip := int64(0)
+	for {
+		rec, err := rr.cur.ReadNext()
+		if err == io.EOF && skip == 0 {
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			err = merr.WrapErrIoUnexpectEOF("retried packed files", io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			// the files stay open on failures not retried, as without retries
+			if !rr.budget.retryable(err) {
+				return nil, err
+			}
+			if err := rr.reopen(err); err != nil {
+				return nil, err
+			}
+			skip = rr.rows
+			continue
+		}
+		if skip >= rec.NumRows() {
+			skip -= rec.NumRows()
+			continue
+		}
+		if skip > 0 {
+			rr.sliced = rec.NewSlice(skip, rec.NumRows())
+			rec = rr.sliced
+		}
+		rr.rows += rec.NumRows()
+		rr.attempts = 0
+		return rec, nil
+	}
+}
+
+func (rr *retryBatchReader) Close() error {
+	if rr.sliced != nil {
+		rr.sliced.Release()
+		rr.sliced = nil
+	}
+	if rr.cur != nil {
+		return rr.cur.Close()
+	}
+	return nil
+}
+
+// nativeTransportErrorMarkers are the messages of the storage failures of the native reader.
+var nativeTransportErrorMarkers = []string{
+	"AWS Error", "When reading", "When getting information", "Error reading bytes from file",
+	"Connection", "connection", "timed out", "Timeout", "Couldn't connect",
+}
+
+// isNativeTransportError tells whether a failed native read is a failure of its storage.
+func isNativeTransportError(err error) bool {
+	msg := err.Error()
+	return lo.SomeBy(nativeTransportErrorMarkers, func(marker string) bool { return strings.Contains(msg, marker) })
+}
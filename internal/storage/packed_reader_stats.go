@@ -0,0 +1,149 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// readSummaries are the summaries built over the records read, each nil without its option.
+type readSummaries struct {
+	skipIndex *skipIndexBuilder
+	distinct  *distinctCounter
+	// eof is set once the reader returned io.EOF, completing skipIndex and distinct.
+	eof        bool
+	alignStats *AlignmentStats
+	readStats  *readStatsCollector
+}
+
+func newReadSummaries(options *packedReaderOptions) readSummaries {
+	var s readSummaries
+	if options.alignment > 0 {
+		s.alignStats = &AlignmentStats{}
+	}
+	if options.readPolicy != nil {
+		s.readStats = newReadStatsCollector()
+	}
+	return s
+}
+
+// initSketches builds the skip index over the zones of rowGroupRows and the distinct counts of options.
+func (s *readSummaries) initSketches(schema *schemapb.CollectionSchema, options *packedReaderOptions, rowGroupRows func() ([]int64, error)) error {
+	if len(options.skipIndexFields) > 0 {
+		rows, err := rowGroupRows()
+		if err != nil {
+			return err
+		}
+		if s.skipIndex, err = newSkipIndexBuilder(schema, options.skipIndexFields, rows); err != nil {
+			return err
+		}
+	}
+	if len(options.distinctFields) > 0 {
+		var err error
+		if s.distinct, err = newDistinctCounter(schema, options.distinctFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sketching tells whether the summaries need all rows read.
+func (s *readSummaries) sketching() bool {
+	return s.skipIndex != nil || s.distinct != nil
+}
+
+func (s *readSummaries) add(r Record) {
+	if s.skipIndex != nil {
+		s.skipIndex.add(r)
+	}
+	if s.distinct != nil {
+		s.distinct.add(r)
+	}
+}
+
+// checkProjection fails if the projection fieldSet drops a field summarized.
+func (s *readSummaries) checkProjection(fieldSet typeutil.Set[FieldID]) error {
+	if s.skipIndex != nil {
+		for _, field := range s.skipIndex.fields {
+			if !fieldSet.Contain(field.GetFieldID()) {
+				return merr.WrapErrParameterInvalidMsg("projection drops field %d of the skip index", field.GetFieldID())
+			}
+		}
+	}
+	if s.distinct != nil {
+		for _, field := range s.distinct.fields {
+			if !fieldSet.Contain(field.GetFieldID()) {
+				return merr.WrapErrParameterInvalidMsg("projection drops field %d of the distinct counts", field.GetFieldID())
+			}
+		}
+	}
+	return nil
+}
+
+// SkipIndex returns the zone map of WithSkipIndex once all records were read.
+func (s *readSummaries) SkipIndex() (*SkipIndex, error) {
+	if s.skipIndex == nil {
+		return nil, merr.WrapErrServiceInternal("packed reader was not opened with a skip index")
+	}
+	if !s.eof {
+		return nil, merr.WrapErrServiceInternal("skip index of packed reader is only complete once all records are read")
+	}
+	return s.skipIndex.finish(), nil
+}
+
+// DistinctCounts returns the estimated distinct counts of WithDistinctCounts once all records were read.
+func (s *readSummaries) DistinctCounts() (map[FieldID]uint64, error) {
+	if s.distinct == nil {
+		return nil, merr.WrapErrServiceInternal("packed reader was not opened with distinct counts")
+	}
+	if !s.eof {
+		return nil, merr.WrapErrServiceInternal("distinct counts of packed reader are only complete once all records are read")
+	}
+	return s.distinct.counts(), nil
+}
+
+// AlignmentStats returns the counts of the vector columns aligned by WithBufferAlignment so far.
+func (s *readSummaries) AlignmentStats() AlignmentStats {
+	if s.alignStats == nil {
+		return AlignmentStats{}
+	}
+	return *s.alignStats
+}
+
+// ReadStats returns the native reads of WithReadPolicy so far, reopened readers included.
+func (s *readSummaries) ReadStats() ReadStats {
+	if s.readStats == nil {
+		return ReadStats{}
+	}
+	return s.readStats.stats()
+}
+
+// WithSkipIndex builds a min/max zone map per row group of fieldIDs while reading, see SkipIndex.
+func WithSkipIndex(fieldIDs []FieldID) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.skipIndexFields = fieldIDs
+	}
+}
+
+// WithDistinctCounts sketches the distinct values of fieldIDs while reading, see DistinctCounts.
+func WithDistinctCounts(fieldIDs []FieldID) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.distinctFields = fieldIDs
+	}
+}
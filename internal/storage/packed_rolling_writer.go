@@ -0,0 +1,303 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/pkg/v2/log"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// WithMaxSegmentSize rolls a rolling writer over after the record crossing maxBytes uncompressed bytes.
+func WithMaxSegmentSize(maxBytes int64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.maxSegmentSize = maxBytes
+	}
+}
+
+// WithAdaptiveBufferSize adapts the buffer size of the segments of a rolling writer to targetFlushDuration.
+func WithAdaptiveBufferSize(minBufferSize, maxBufferSize int64, targetFlushDuration time.Duration) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.adaptiveBuffer = true
+		o.minBufferSize = minBufferSize
+		o.maxBufferSize = maxBufferSize
+		o.targetFlushDuration = targetFlushDuration
+	}
+}
+
+// RolledSegment is a segment completed by a RollingPackedSerializeWriter.
+type RolledSegment struct {
+	// Paths are the files of the column groups of the segment.
+	Paths               []string
+	RowNum              int64
+	WrittenUncompressed uint64
+	// Stats are the stats of the segment with WithSegmentStats, nil without it.
+	Stats *WrittenSegmentStats
+}
+
+// RollingPackedSerializeWriter writes values to a sequence of packed segments.
+type RollingPackedSerializeWriter struct {
+	*SerializeWriterImpl[*Value]
+	rw *rollingPackedRecordWriter
+}
+
+// NewRollingPackedSerializeWriter writes values to segments at pathsOf(segment), rolling over at
+// maxRowsPerSegment rows, 0 for no cap, or at the size of WithMaxSegmentSize.
+func NewRollingPackedSerializeWriter(bucketName string, pathsOf func(segment int) []string, schema *schemapb.CollectionSchema,
+	bufferSize int64, multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, maxRowsPerSegment int64,
+	batchSize int, opts ...PackedRecordWriterOption,
+) (*RollingPackedSerializeWriter, error) {
+	options := &packedRecordWriterOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if maxRowsPerSegment < 0 || (maxRowsPerSegment == 0 && options.maxSegmentSize <= 0) {
+		return nil, merr.WrapErrParameterInvalidMsg("max rows per segment of rolling writer must be positive, got %d", maxRowsPerSegment)
+	}
+	if options.autoRowIDs || options.bloomFilter || options.zeroVectorCM != nil || options.pkIndexCM != nil || options.checksumCM != nil {
+		return nil, merr.WrapErrParameterInvalidMsg("rolling writer cannot assign row ids or write bloom filters, zero vector placeholders, pk indexes or batch checksums")
+	}
+	if options.adaptiveBuffer && (options.minBufferSize <= 0 || options.minBufferSize > options.maxBufferSize || options.targetFlushDuration <= 0) {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid adaptive buffer size range [%d, %d] with target flush duration %s",
+			options.minBufferSize, options.maxBufferSize, options.targetFlushDuration)
+	}
+	effectiveBufferSize := bufferSize
+	if options.adaptiveBuffer {
+		effectiveBufferSize = min(max(bufferSize, options.minBufferSize), options.maxBufferSize)
+	}
+	rw := &rollingPackedRecordWriter{
+		bucketName:          bucketName,
+		pathsOf:             pathsOf,
+		schema:              schema,
+		multiPartUploadSize: multiPartUploadSize,
+		columnGroups:        columnGroups,
+		maxRows:             maxRowsPerSegment,
+		maxBytes:            options.maxSegmentSize,
+		adaptiveBuffer:      options.adaptiveBuffer,
+		minBufferSize:       options.minBufferSize,
+		maxBufferSize:       options.maxBufferSize,
+		targetFlushDuration: options.targetFlushDuration,
+		effectiveBufferSize: effectiveBufferSize,
+		// the segments are written by plain packed writers
+		opts: append(slices.Clone(opts), func(o *packedRecordWriterOptions) {
+			o.maxSegmentSize = 0
+			o.adaptiveBuffer = false
+		}),
+	}
+	return &RollingPackedSerializeWriter{
+		SerializeWriterImpl: NewSerializeRecordWriter(rw, func(v []*Value) (Record, error) {
+			return ValueSerializer(v, schema, options.serializerOptions...)
+		}, batchSize),
+		rw: rw,
+	}, nil
+}
+
+// CompletedSegments returns the segments closed so far, in write order.
+func (w *RollingPackedSerializeWriter) CompletedSegments() []RolledSegment {
+	return w.rw.completed
+}
+
+// Flush closes the segment being written, the next row opens the next one.
+func (w *RollingPackedSerializeWriter) Flush() error {
+	if err := w.SerializeWriterImpl.Flush(); err != nil {
+		return err
+	}
+	if w.rw.cur == nil {
+		return nil
+	}
+	return w.rw.rollover()
+}
+
+// GetEffectiveBufferSize returns the buffer size the next segment is opened with.
+func (w *RollingPackedSerializeWriter) GetEffectiveBufferSize() int64 {
+	return w.rw.effectiveBufferSize
+}
+
+// GetPaths returns the files of the segments written so far, in write order.
+func (w *RollingPackedSerializeWriter) GetPaths() []string {
+	var paths []string
+	for _, segment := range w.rw.completed {
+		paths = append(paths, segment.Paths...)
+	}
+	if w.rw.cur != nil {
+		paths = append(paths, w.rw.curPaths...)
+	}
+	return paths
+}
+
+// rollingPackedRecordWriter writes records to packed segments of at most maxRows rows and maxBytes bytes.
+type rollingPackedRecordWriter struct {
+	bucketName          string
+	pathsOf             func(segment int) []string
+	schema              *schemapb.CollectionSchema
+	multiPartUploadSize int64
+	columnGroups        []storagecommon.ColumnGroup
+	maxRows             int64
+	maxBytes            int64
+	opts                []PackedRecordWriterOption
+
+	// effectiveBufferSize is the buffer size of the next segment, see WithAdaptiveBufferSize.
+	adaptiveBuffer      bool
+	minBufferSize       int64
+	maxBufferSize       int64
+	targetFlushDuration time.Duration
+	effectiveBufferSize int64
+
+	// cur is the writer of the segment being written, nil before its first row.
+	cur           *packedRecordWriter
+	curPaths      []string
+	curRows       int64
+	curBufferSize int64
+	curWriteTime  time.Duration
+	completed     []RolledSegment
+}
+
+var _ RecordWriter = (*rollingPackedRecordWriter)(nil)
+
+// Write writes r and releases it, see packedRecordWriter.Write.
+func (rw *rollingPackedRecordWriter) Write(r Record) error {
+	err := rw.WriteBorrowed(r)
+	if _, ok := r.(*simpleArrowRecord); ok {
+		r.Release()
+	}
+	return err
+}
+
+// WriteBorrowed writes r without releasing it, slicing it at the segment boundaries.
+func (rw *rollingPackedRecordWriter) WriteBorrowed(r Record) error {
+	for offset := 0; offset < r.Len(); {
+		if rw.cur == nil {
+			if err := rw.open(); err != nil {
+				return err
+			}
+		}
+		n := r.Len() - offset
+		if rw.maxRows > 0 {
+			n = int(min(rw.maxRows-rw.curRows, int64(n)))
+		}
+		start := time.Now()
+		if offset == 0 && n == r.Len() {
+			if err := rw.cur.WriteBorrowed(r); err != nil {
+				return err
+			}
+		} else {
+			sar, ok := r.(*simpleArrowRecord)
+			if !ok {
+				return merr.WrapErrServiceInternal(fmt.Sprintf("rolling writer cannot split a record of type %T", r))
+			}
+			if err := rw.cur.Write(NewSimpleArrowRecord(sar.r.NewSlice(int64(offset), int64(offset+n)), sar.field2Col)); err != nil {
+				return err
+			}
+		}
+		rw.curWriteTime += time.Since(start)
+		offset += n
+		rw.curRows += int64(n)
+		if rw.curRows == rw.maxRows || (rw.maxBytes > 0 && rw.cur.GetWrittenUncompressed() >= uint64(rw.maxBytes)) {
+			if err := rw.rollover(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (rw *rollingPackedRecordWriter) open() error {
+	paths := rw.pathsOf(len(rw.completed))
+	w, err := NewPackedRecordWriter(rw.bucketName, paths, rw.schema, rw.effectiveBufferSize, rw.multiPartUploadSize, rw.columnGroups, nil, nil, rw.opts...)
+	if err != nil {
+		return err
+	}
+	rw.cur, rw.curPaths, rw.curRows = w, paths, 0
+	rw.curBufferSize, rw.curWriteTime = rw.effectiveBufferSize, 0
+	return nil
+}
+
+// rollover closes the segment being written and lists it as completed.
+func (rw *rollingPackedRecordWriter) rollover() error {
+	w := rw.cur
+	rw.cur = nil
+	start := time.Now()
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if rw.adaptiveBuffer {
+		// the native writer flushed once per buffer of data, the last one on close
+		flushes := max(1, int64(w.GetWrittenUncompressed())/rw.curBufferSize)
+		rw.adaptBufferSize((rw.curWriteTime + time.Since(start)) / time.Duration(flushes))
+	}
+	rw.completed = append(rw.completed, RolledSegment{
+		Paths:               rw.curPaths,
+		RowNum:              w.GetWrittenRowNum(),
+		WrittenUncompressed: w.GetWrittenUncompressed(),
+		Stats:               w.GetSegmentStats(),
+	})
+	return nil
+}
+
+// adaptBufferSize doubles the buffer size below half the target flush duration and halves it above.
+func (rw *rollingPackedRecordWriter) adaptBufferSize(flushDuration time.Duration) {
+	size := rw.effectiveBufferSize
+	switch {
+	case flushDuration > rw.targetFlushDuration:
+		size = max(size/2, rw.minBufferSize)
+	case flushDuration < rw.targetFlushDuration/2:
+		size = min(size*2, rw.maxBufferSize)
+	}
+	if size != rw.effectiveBufferSize {
+		log.Debug("rolling packed writer adapts buffer size",
+			zap.Int64("from", rw.effectiveBufferSize),
+			zap.Int64("to", size),
+			zap.Duration("flushDuration", flushDuration))
+		rw.effectiveBufferSize = size
+	}
+}
+
+func (rw *rollingPackedRecordWriter) GetWrittenUncompressed() uint64 {
+	var size uint64
+	for _, segment := range rw.completed {
+		size += segment.WrittenUncompressed
+	}
+	if rw.cur != nil {
+		size += rw.cur.GetWrittenUncompressed()
+	}
+	return size
+}
+
+// Close closes the segment being written, if any.
+func (rw *rollingPackedRecordWriter) Close() error {
+	if rw.cur == nil {
+		return nil
+	}
+	return rw.rollover()
+}
+
+// Abort aborts the segment being written, if any.
+func (rw *rollingPackedRecordWriter) Abort() error {
+	if rw.cur == nil {
+		return nil
+	}
+	w := rw.cur
+	rw.cur = nil
+	return w.Abort()
+}
@@ -0,0 +1,164 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import "github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+
+// rowOrder buffers the written rows to sort or regroup them, see WithSortKeys and WithDeterministicOutput.
+type rowOrder struct {
+	sortKeys   []SortKey
+	sortGlobal bool
+	sortBuffer []Record
+	// groupRows is the batch size of regroupBuffer, 0 to write the records as given.
+	groupRows     int
+	regroupBuffer *columnBuffer
+}
+
+func newRowOrder(fields []*schemapb.FieldSchema, options *packedRecordWriterOptions) rowOrder {
+	o := rowOrder{sortKeys: options.sortKeys, sortGlobal: options.sortGlobal}
+	if options.deterministicRows > 0 {
+		o.groupRows = int(options.deterministicRows)
+		o.regroupBuffer = &columnBuffer{fields: fields}
+	}
+	return o
+}
+
+func (o *rowOrder) releaseSortBuffer() {
+	for _, rec := range o.sortBuffer {
+		rec.Release()
+	}
+	o.sortBuffer = nil
+}
+
+func (o *rowOrder) release() {
+	o.releaseSortBuffer()
+	if o.regroupBuffer != nil {
+		o.regroupBuffer.release()
+	}
+}
+
+// writeOrdered writes r sorted by the sort keys, buffering it for the global sort.
+func (pw *packedRecordWriter) writeOrdered(r Record, release bool) error {
+	if len(pw.sortKeys) == 0 {
+		return pw.writeRecord(r, release)
+	}
+	if pw.sortGlobal {
+		r.Retain()
+		pw.sortBuffer = append(pw.sortBuffer, r)
+		pw.releaseWritten(r, release)
+		return nil
+	}
+	sorted, err := pw.sortRecords([]Record{r}, r.Len())
+	pw.releaseWritten(r, release)
+	if err != nil {
+		return err
+	}
+	return pw.writeSorted(sorted)
+}
+
+// sortRecords copies the rows of records in sort key order into batches of batchRows rows.
+func (pw *packedRecordWriter) sortRecords(records []Record, batchRows int) ([]Record, error) {
+	rows, err := sortRows(records, pw.sortKeys)
+	if err != nil {
+		return nil, err
+	}
+	var sorted []Record
+	rb := NewRecordBuilder(pw.schema)
+	for _, row := range rows {
+		if err := rb.Append(records[row.ri], row.i, row.i+1); err != nil {
+			for _, rec := range sorted {
+				rec.Release()
+			}
+			return nil, err
+		}
+		if rb.GetRowNum() >= batchRows {
+			sorted = append(sorted, rb.Build())
+		}
+	}
+	if rb.GetRowNum() > 0 {
+		sorted = append(sorted, rb.Build())
+	}
+	return sorted, nil
+}
+
+// writeSorted writes and releases the records built by sortRecords.
+func (pw *packedRecordWriter) writeSorted(sorted []Record) error {
+	for i, rec := range sorted {
+		if err := pw.writeRecord(rec, true); err != nil {
+			for _, rest := range sorted[i+1:] {
+				rest.Release()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// flushSortBuffer sorts and writes the records buffered for the global sort.
+func (pw *packedRecordWriter) flushSortBuffer() error {
+	if len(pw.sortBuffer) == 0 {
+		return nil
+	}
+	batchRows := 0
+	for _, rec := range pw.sortBuffer {
+		batchRows = max(batchRows, rec.Len())
+	}
+	sorted, err := pw.sortRecords(pw.sortBuffer, batchRows)
+	pw.releaseSortBuffer()
+	if err != nil {
+		return err
+	}
+	return pw.writeSorted(sorted)
+}
+
+func (pw *packedRecordWriter) writeRecord(r Record, release bool) error {
+	if pw.groupRows == 0 {
+		return pw.writeBatch(r, release)
+	}
+	pw.regroupBuffer.push(r)
+	pw.releaseWritten(r, release)
+	for pw.regroupBuffer.pendingRows >= pw.groupRows {
+		if err := pw.flushRegrouped(pw.groupRows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushRegrouped writes the first rows rows buffered for WithDeterministicOutput as one batch.
+func (pw *packedRecordWriter) flushRegrouped(rows int) error {
+	arrays, err := pw.regroupBuffer.take(rows)
+	if err != nil {
+		return err
+	}
+	return pw.writeBatch(newRecordFromArrays(pw.regroupBuffer.fields, arrays, rows), true)
+}
+
+// WithSortKeys orders the rows of each batch, or with global of the whole segment, by keys.
+func WithSortKeys(keys []SortKey, global bool) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.sortKeys = keys
+		o.sortGlobal = global
+	}
+}
+
+// WithDeterministicOutput writes byte-identical files for the same rows, in row groups of rowsPerGroup.
+func WithDeterministicOutput(rowsPerGroup int64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.deterministicRows = rowsPerGroup
+	}
+}
@@ -0,0 +1,237 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// RegroupPackedSegment rewrites the files srcPaths into dstPaths laid out as newColumnGroups.
+func RegroupPackedSegment(srcPaths, dstPaths []string, schema *schemapb.CollectionSchema,
+	newColumnGroups []storagecommon.ColumnGroup, bufferSize int64,
+) (int64, error) {
+	reader, err := newPackedRecordReader(srcPaths, schema, bufferSize, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	writer, err := NewPackedRecordWriter("", dstPaths, schema, bufferSize, packed.DefaultMultiPartUploadSize, newColumnGroups, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			// the reader owns its records
+			err = writer.WriteBorrowed(r)
+		}
+		if err != nil {
+			return 0, merr.Combine(err, writer.Abort())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return writer.GetWrittenRowNum(), nil
+}
+
+// TruncatePackedSegment rewrites the first n rows of the files srcPaths into dstPaths.
+func TruncatePackedSegment(srcPaths, dstPaths []string, schema *schemapb.CollectionSchema, n int64, bufferSize int64) (int64, error) {
+	if n < 0 {
+		return 0, merr.WrapErrParameterInvalidMsg("rows to truncate a segment to must not be negative, got %d", n)
+	}
+	columnGroups, err := readPackedColumnGroups(srcPaths)
+	if err != nil {
+		return 0, err
+	}
+	reader, err := newPackedRecordReader(srcPaths, schema, bufferSize, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	writer, err := NewPackedRecordWriter("", dstPaths, schema, bufferSize, packed.DefaultMultiPartUploadSize, columnGroups, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	for writer.GetWrittenRowNum() < n {
+		r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			remaining := n - writer.GetWrittenRowNum()
+			if int64(r.Len()) <= remaining {
+				// the reader owns its records
+				err = writer.WriteBorrowed(r)
+			} else {
+				sar := r.(*simpleArrowRecord)
+				err = writer.Write(NewSimpleArrowRecord(sar.r.NewSlice(0, remaining), sar.field2Col))
+			}
+		}
+		if err != nil {
+			return 0, merr.Combine(err, writer.Abort())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return writer.GetWrittenRowNum(), nil
+}
+
+// PartitionFunc maps the partition field value of a row, nil if null, to a partition.
+type PartitionFunc func(value any, numPartitions int) (int, error)
+
+// HashPartition routes the rows by the hash of an int64 or varchar value, nulls to partition 0.
+func HashPartition(value any, numPartitions int) (int, error) {
+	var hash uint32
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		var err error
+		if hash, err = typeutil.Hash32Int64(v); err != nil {
+			return 0, err
+		}
+	case string:
+		hash = typeutil.HashString2Uint32(v)
+	default:
+		return 0, merr.WrapErrParameterInvalidMsg("can not hash partition value of type %T", value)
+	}
+	return int(hash % uint32(numPartitions)), nil
+}
+
+// RepartitionSegment splits the rows of the files srcPaths into numPartitions segments by partitionFieldID.
+func RepartitionSegment(srcPaths []string, schema *schemapb.CollectionSchema, partitionFieldID FieldID,
+	numPartitions int, dstPathsPerPartition [][]string, columnGroups []storagecommon.ColumnGroup,
+	bufferSize int64, partition PartitionFunc,
+) ([]int64, error) {
+	if numPartitions <= 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("number of partitions must be positive, got %d", numPartitions)
+	}
+	if len(dstPathsPerPartition) != numPartitions {
+		return nil, merr.WrapErrParameterInvalid(numPartitions, len(dstPathsPerPartition), "destination paths per partition mismatch")
+	}
+	fields := typeutil.GetAllFieldSchemas(schema)
+	field, ok := lo.Find(fields, func(f *schemapb.FieldSchema) bool { return f.GetFieldID() == partitionFieldID })
+	if !ok {
+		return nil, merr.WrapErrFieldNotFound(partitionFieldID)
+	}
+	entry, ok := serdeMap[field.GetDataType()]
+	if !ok {
+		return nil, merr.WrapErrParameterInvalidMsg("unsupported partition field type %s", field.GetDataType().String())
+	}
+	dim, _ := typeutil.GetDim(field)
+	if partition == nil {
+		partition = HashPartition
+	}
+
+	reader, err := newPackedRecordReader(srcPaths, schema, bufferSize, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	writers := make([]*packedRecordWriter, 0, numPartitions)
+	abort := func(err error) ([]int64, error) {
+		for _, w := range writers {
+			err = merr.Combine(err, w.Abort())
+		}
+		return nil, err
+	}
+	for _, paths := range dstPathsPerPartition {
+		w, err := NewPackedRecordWriter("", paths, schema, bufferSize, packed.DefaultMultiPartUploadSize, columnGroups, nil, nil)
+		if err != nil {
+			return abort(err)
+		}
+		writers = append(writers, w)
+	}
+
+	targets := make([]int, 0)
+	counts := make([]int, numPartitions)
+	for {
+		r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return abort(err)
+		}
+		col := r.Column(partitionFieldID)
+		targets = targets[:0]
+		clear(counts)
+		for i := 0; i < r.Len(); i++ {
+			var value any
+			if !col.IsNull(i) {
+				value, ok = entry.deserialize(col, i, field.GetElementType(), int(dim), false)
+				if !ok {
+					return abort(merr.WrapErrServiceInternal(fmt.Sprintf("deserialize partition field %d at row %d failed", partitionFieldID, i)))
+				}
+			}
+			target, err := partition(value, numPartitions)
+			if err != nil {
+				return abort(err)
+			}
+			if target < 0 || target >= numPartitions {
+				return abort(merr.WrapErrParameterInvalidMsg("partition %d of row %d out of range [0, %d)", target, i, numPartitions))
+			}
+			targets = append(targets, target)
+			counts[target]++
+		}
+		for target, count := range counts {
+			if count == 0 {
+				continue
+			}
+			if count == r.Len() {
+				// the reader owns its records
+				if err := writers[target].WriteBorrowed(r); err != nil {
+					return abort(err)
+				}
+				break
+			}
+			keep := lo.Map(targets, func(t int, _ int) bool { return t == target })
+			part, err := filterRecordRows(r, fields, keep, count)
+			if err == nil {
+				err = writers[target].WriteBorrowed(part)
+				part.Release()
+			}
+			if err != nil {
+				return abort(err)
+			}
+		}
+	}
+	rows := make([]int64, numPartitions)
+	var errs []error
+	for i, w := range writers {
+		errs = append(errs, w.Close())
+		rows[i] = w.GetWrittenRowNum()
+	}
+	if err := merr.Combine(errs...); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,313 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// checkGroupRowCounts checks that the column group files at paths hold the same rows, see WithGroupRowCountCheck.
+func checkGroupRowCounts(paths []string, storageConfig *indexpb.StorageConfig) error {
+	if len(paths) < 2 {
+		return nil
+	}
+	_, err := groupRowCount(paths, storageConfig)
+	return err
+}
+
+// groupRowCount returns the rows of the footers of the files at paths, failing if they disagree.
+func groupRowCount(paths []string, storageConfig *indexpb.StorageConfig) (int64, error) {
+	counts := make([]int64, len(paths))
+	for i, p := range paths {
+		rows, err := packed.GetFileRowCount(p, storageConfig)
+		if err != nil {
+			return 0, merr.WrapErrIoFailed(p, err)
+		}
+		counts[i] = rows
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	if lo.EveryBy(counts, func(rows int64) bool { return rows == counts[0] }) {
+		return counts[0], nil
+	}
+	groups := make([]string, len(paths))
+	for i, p := range paths {
+		groups[i] = fmt.Sprintf("group %d %s: %d rows", i, p, counts[i])
+	}
+	return 0, merr.WrapErrIoFailedReason(fmt.Sprintf("row counts of packed column group files disagree, %s", strings.Join(groups, ", ")))
+}
+
+// CountRows returns the rows of the column group files at paths, read from their footers.
+func CountRows(paths []string, storageConfig *indexpb.StorageConfig) (int64, error) {
+	return groupRowCount(paths, storageConfig)
+}
+
+// PackedFileStats returns the rows and uncompressed bytes of the chunks at paths, read from their footers.
+func PackedFileStats(paths [][]string, storageConfig *indexpb.StorageConfig) (rows int64, uncompressedBytes int64, err error) {
+	for _, chunk := range paths {
+		for i, p := range chunk {
+			fileRows, fileBytes, err := packed.GetFileStats(p, storageConfig)
+			if err != nil {
+				return 0, 0, merr.WrapErrIoFailed(p, err)
+			}
+			if i == 0 {
+				rows += fileRows
+			}
+			uncompressedBytes += fileBytes
+		}
+	}
+	return rows, uncompressedBytes, nil
+}
+
+// ScanCostEstimate is the estimated cost of scanning a segment, see EstimateScanCost.
+type ScanCostEstimate struct {
+	Rows int64
+	// Files is the number of column group files holding fields of the projection.
+	Files int
+	// BytesToRead is the estimated compressed bytes read, DecodedBytes the estimated decoded ones.
+	BytesToRead  int64
+	DecodedBytes int64
+}
+
+// EstimateScanCost estimates the cost of scanning projection of the segment at paths from the footers of its files.
+func EstimateScanCost(paths []string, schema *schemapb.CollectionSchema, projection []FieldID, storageConfig *indexpb.StorageConfig) (ScanCostEstimate, error) {
+	fields := lo.SliceToMap(typeutil.GetAllFieldSchemas(schema), func(field *schemapb.FieldSchema) (FieldID, *schemapb.FieldSchema) {
+		return field.GetFieldID(), field
+	})
+	if len(projection) == 0 {
+		projection = CanonicalColumnOrder(schema)
+	}
+	projected := typeutil.NewSet(projection...)
+	width := func(field *schemapb.FieldSchema) (int64, error) {
+		size, err := typeutil.EstimateAvgSizePerRecord(&schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{field}})
+		if err != nil && typeutil.IsStringType(field.GetDataType()) {
+			return typeutil.DynamicFieldMaxLength / 2, nil
+		}
+		if err != nil {
+			return 0, merr.WrapErrParameterInvalidMsg("estimate size of field %d: %s", field.GetFieldID(), err.Error())
+		}
+		return int64(size), nil
+	}
+	var estimate ScanCostEstimate
+	for _, id := range projection {
+		field, ok := fields[id]
+		if !ok {
+			return ScanCostEstimate{}, merr.WrapErrParameterInvalidMsg("projected field %d is not in the schema", id)
+		}
+		w, err := width(field)
+		if err != nil {
+			return ScanCostEstimate{}, err
+		}
+		estimate.DecodedBytes += w
+	}
+	for i, p := range paths {
+		s, err := packed.GetFileSchema(p, storageConfig)
+		if err != nil {
+			return ScanCostEstimate{}, merr.WrapErrIoFailed(p, err)
+		}
+		var fileWidth, projectedWidth int64
+		for _, f := range s.Fields() {
+			value, _ := f.Metadata.GetValue(packed.ArrowFieldIdMetadataKey)
+			id, _ := strconv.ParseInt(value, 10, 64)
+			field, ok := fields[id]
+			if !ok {
+				// a field dropped from the schema still takes its share of the file
+				field, _, err = fieldSchemaOf(f)
+				if err != nil {
+					return ScanCostEstimate{}, errors.Wrapf(err, "read fields of packed file %s", p)
+				}
+			}
+			w, err := width(field)
+			if err != nil {
+				return ScanCostEstimate{}, err
+			}
+			fileWidth += w
+			if projected.Contain(id) {
+				projectedWidth += w
+			}
+		}
+		if i == 0 {
+			if estimate.Rows, err = packed.GetFileRowCount(p, storageConfig); err != nil {
+				return ScanCostEstimate{}, merr.WrapErrIoFailed(p, err)
+			}
+		}
+		if projectedWidth == 0 {
+			continue
+		}
+		size, err := packed.GetFileSize(p, storageConfig)
+		if err != nil {
+			return ScanCostEstimate{}, merr.WrapErrIoFailed(p, err)
+		}
+		estimate.Files++
+		estimate.BytesToRead += size * projectedWidth / fileWidth
+	}
+	estimate.DecodedBytes *= estimate.Rows
+	return estimate, nil
+}
+
+// countRows counts the rows of the files at paths by their pk column, calling visit, if any, on every batch.
+func countRows(
+	paths []string,
+	schema *schemapb.CollectionSchema,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+	visit func(pkCol arrow.Array),
+) (int64, error) {
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+	if err != nil {
+		return 0, err
+	}
+	pkSchema := &schemapb.CollectionSchema{
+		Name:   schema.GetName(),
+		Fields: []*schemapb.FieldSchema{pkField},
+	}
+	reader, err := newPackedRecordReader(paths, pkSchema, bufferSize, storageConfig, storagePluginContext)
+	if err != nil {
+		return 0, err
+	}
+
+	var rows int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return rows, reader.Close()
+		}
+		if err != nil {
+			return 0, merr.Combine(err, reader.Close())
+		}
+		rows += int64(rec.Len())
+		if visit != nil {
+			visit(rec.Column(pkField.GetFieldID()))
+		}
+	}
+}
+
+// SegmentContentHash returns a hash of the rows of the segment at paths independent of its layout and row order.
+func SegmentContentHash(paths []string, schema *schemapb.CollectionSchema, bufferSize int64) ([]byte, error) {
+	reader, err := newPackedRecordReader(paths, schema, bufferSize, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	fields := typeutil.GetAllFieldSchemas(schema)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].GetFieldID() < fields[j].GetFieldID() })
+	var rowHashes [][sha256.Size]byte
+	var buf bytes.Buffer
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		columns := lo.Map(fields, func(f *schemapb.FieldSchema, _ int) arrow.Array { return rec.Column(f.GetFieldID()) })
+		for i := 0; i < rec.Len(); i++ {
+			buf.Reset()
+			for c, col := range columns {
+				buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(fields[c].GetFieldID())))
+				if col.IsNull(i) {
+					buf.WriteByte(0)
+					continue
+				}
+				buf.WriteByte(1)
+				// the string form is the same for every physical layout of the value
+				value := col.ValueStr(i)
+				buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(value))))
+				buf.WriteString(value)
+			}
+			rowHashes = append(rowHashes, sha256.Sum256(buf.Bytes()))
+		}
+	}
+	sort.Slice(rowHashes, func(i, j int) bool { return bytes.Compare(rowHashes[i][:], rowHashes[j][:]) < 0 })
+	h := sha256.New()
+	for _, rowHash := range rowHashes {
+		h.Write(rowHash[:])
+	}
+	return h.Sum(nil), nil
+}
+
+// statPackedFile returns the size of the file at path and whether it exists.
+func statPackedFile(path string, storageConfig *indexpb.StorageConfig) (int64, bool, error) {
+	size, err := packed.GetFileSize(path, storageConfig)
+	if err != nil {
+		return 0, false, merr.WrapErrIoFailed(path, err)
+	}
+	return size, size >= 0, nil
+}
+
+// chunkExists tells whether all column group files of a chunk exist.
+func chunkExists(paths []string, storageConfig *indexpb.StorageConfig) bool {
+	for _, p := range paths {
+		if _, ok, err := statPackedFile(p, storageConfig); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateSegmentPaths checks that paths are the expectedGroups non-empty column group files of a segment.
+func ValidateSegmentPaths(paths []string, expectedGroups int, storageConfig *indexpb.StorageConfig) error {
+	if len(paths) != expectedGroups {
+		return merr.WrapErrParameterInvalid(expectedGroups, len(paths), fmt.Sprintf("segment paths %v do not match the column groups", paths))
+	}
+	var missing, empty []string
+	for _, p := range paths {
+		size, ok, err := statPackedFile(p, storageConfig)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !ok:
+			missing = append(missing, p)
+		case size == 0:
+			empty = append(empty, p)
+		}
+	}
+	if len(missing) > 0 || len(empty) > 0 {
+		return merr.WrapErrIoFailedReason(fmt.Sprintf("incomplete segment, missing files %v, empty files %v", missing, empty))
+	}
+	return nil
+}
+
+// WithGroupRowCountCheck fails opening column group files whose footers record different rows.
+func WithGroupRowCountCheck() PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.groupRowCountCheck = true
+	}
+}
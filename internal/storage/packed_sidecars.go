@@ -0,0 +1,284 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
+	"github.com/milvus-io/milvus/internal/util/bloomfilter"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// GetBloomFilterPath returns the path of the stats log of WithPKBloomFilter, empty without it.
+func (pw *packedRecordWriter) GetBloomFilterPath() string {
+	return pw.bloomPath
+}
+
+// GetPKBloomFilter returns the pk stats of WithPKBloomFilter once closed, nil before or without it.
+func (pw *packedRecordWriter) GetPKBloomFilter() *PrimaryKeyStats {
+	if !pw.closed {
+		return nil
+	}
+	return pw.pkStats
+}
+
+// writerSidecars are the files saved next to the segment on Close, each nil without its option.
+type writerSidecars struct {
+	// pkStats holds the bloom filter of WithPKBloomFilter, kept in memory without bloomCM.
+	pkStats   *PrimaryKeyStats
+	bloomCM   ChunkManager
+	bloomPath string
+
+	zeroVectors    *ZeroVectorRows
+	zeroVectorCM   ChunkManager
+	zeroVectorPath string
+
+	pkIndex     *pkIndexBuilder
+	pkIndexCM   ChunkManager
+	pkIndexPath string
+
+	checksums    *BatchChecksums
+	checksumCM   ChunkManager
+	checksumPath string
+}
+
+func newWriterSidecars(schema *schemapb.CollectionSchema, pkField *schemapb.FieldSchema, options *packedRecordWriterOptions) (writerSidecars, error) {
+	s := writerSidecars{
+		bloomCM:        options.bloomCM,
+		bloomPath:      options.bloomPath,
+		zeroVectorCM:   options.zeroVectorCM,
+		zeroVectorPath: options.zeroVectorPath,
+		pkIndexCM:      options.pkIndexCM,
+		pkIndexPath:    options.pkIndexPath,
+		checksumCM:     options.checksumCM,
+		checksumPath:   options.checksumPath,
+	}
+	if options.pkIndexCM != nil {
+		if options.pkIndexPath == "" {
+			return s, merr.WrapErrParameterInvalidMsg("pk index of packed writer lacks a sidecar path")
+		}
+		pkIndex, err := newPKIndexBuilder(pkField.GetDataType(), options.deterministicRows)
+		if err != nil {
+			return s, err
+		}
+		s.pkIndex = pkIndex
+	}
+	if options.checksumCM != nil {
+		if options.checksumPath == "" {
+			return s, merr.WrapErrParameterInvalidMsg("batch checksums of packed writer lack a sidecar path")
+		}
+		s.checksums = &BatchChecksums{Rows: []int64{}, Fields: make(map[FieldID][]uint32)}
+	}
+	if options.zeroVectorCM != nil {
+		field := typeutil.GetField(schema, options.zeroVectorField)
+		if field == nil {
+			return s, merr.WrapErrFieldNotFound(options.zeroVectorField)
+		}
+		if !typeutil.IsVectorType(field.GetDataType()) || options.zeroVectorPath == "" {
+			return s, merr.WrapErrParameterInvalidMsg("invalid zero vector placeholders of field %d [%s] at path %q",
+				field.GetFieldID(), field.GetDataType(), options.zeroVectorPath)
+		}
+		s.zeroVectors = &ZeroVectorRows{FieldID: options.zeroVectorField, RowIDs: []int64{}}
+	}
+	if options.bloomFilter {
+		if (options.bloomCM != nil && options.bloomPath == "") || options.bloomFPR < 0 || options.bloomFPR >= 1 {
+			return s, merr.WrapErrParameterInvalidMsg("invalid pk bloom filter at path %q with false positive rate %f",
+				options.bloomPath, options.bloomFPR)
+		}
+		capacity, fpr := options.bloomCapacity, options.bloomFPR
+		if capacity == 0 {
+			capacity = paramtable.Get().CommonCfg.BloomFilterSize.GetAsUint()
+		}
+		if fpr == 0 {
+			fpr = paramtable.Get().CommonCfg.MaxBloomFalsePositive.GetAsFloat()
+		}
+		bfType := paramtable.Get().CommonCfg.BloomFilterType.GetValue()
+		s.pkStats = &PrimaryKeyStats{
+			FieldID: pkField.GetFieldID(),
+			PkType:  int64(pkField.GetDataType()),
+			BFType:  bloomfilter.BFTypeFromString(bfType),
+			BF:      bloomfilter.NewBloomFilterWithType(capacity, fpr, bfType),
+		}
+	}
+	return s, nil
+}
+
+// add adds a written batch starting at row firstRow, of primary keys pkCol within [low, high].
+func (s *writerSidecars) add(rec arrow.Record, fields []*schemapb.FieldSchema, pkCol arrow.Array, low, high PrimaryKey, firstRow int64) {
+	if s.pkStats != nil {
+		s.addBloomFilter(pkCol)
+		if low != nil {
+			s.pkStats.UpdateMinMax(low)
+			s.pkStats.UpdateMinMax(high)
+		}
+	}
+	if s.pkIndex != nil {
+		s.pkIndex.add(pkCol, firstRow)
+	}
+	if s.checksums != nil {
+		s.checksums.addBatch(rec, fields)
+	}
+}
+
+func (s *writerSidecars) addBloomFilter(pkCol arrow.Array) {
+	switch col := pkCol.(type) {
+	case *array.Int64:
+		b := make([]byte, 8)
+		for i, v := range col.Int64Values() {
+			if col.IsValid(i) {
+				common.Endian.PutUint64(b, uint64(v))
+				s.pkStats.BF.Add(b)
+			}
+		}
+	case *array.String:
+		for i := 0; i < col.Len(); i++ {
+			if col.IsValid(i) {
+				s.pkStats.BF.AddString(col.Value(i))
+			}
+		}
+	}
+}
+
+// write saves the sidecars of the closed segment.
+func (s *writerSidecars) write(ctx context.Context) error {
+	if s.pkStats != nil && s.bloomCM != nil {
+		// the stats log read by ContainsAnyPK
+		sw := &StatsWriter{}
+		if err := sw.Generate(s.pkStats); err != nil {
+			return err
+		}
+		if err := writeSidecar(ctx, s.bloomCM, s.bloomPath, sw.GetBuffer()); err != nil {
+			return err
+		}
+	}
+	if s.zeroVectors != nil {
+		if err := writeJSONSidecar(ctx, s.zeroVectorCM, s.zeroVectorPath, s.zeroVectors); err != nil {
+			return err
+		}
+	}
+	if s.pkIndex != nil {
+		if err := writeJSONSidecar(ctx, s.pkIndexCM, s.pkIndexPath, s.pkIndex.finish()); err != nil {
+			return err
+		}
+	}
+	if s.checksums != nil {
+		if err := writeJSONSidecar(ctx, s.checksumCM, s.checksumPath, s.checksums); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sidecarContext returns the context of WithWriteContext, if any.
+func (pw *packedRecordWriter) sidecarContext() context.Context {
+	if pw.ctx == nil {
+		return context.TODO()
+	}
+	return pw.ctx
+}
+
+// WithZeroVectorPlaceholders writes null vectors of fieldID as zero vectors, listed in sidecarPath.
+func WithZeroVectorPlaceholders(fieldID FieldID, cm ChunkManager, sidecarPath string) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.zeroVectorField = fieldID
+		o.zeroVectorCM = cm
+		o.zeroVectorPath = sidecarPath
+	}
+}
+
+// ZeroVectorRows lists the rows written as zero vectors, see WithZeroVectorPlaceholders.
+type ZeroVectorRows struct {
+	FieldID FieldID `json:"fieldID"`
+	RowIDs  []int64 `json:"rowIDs"`
+}
+
+// writeSidecar saves data with cm to sidecarPath.
+func writeSidecar(ctx context.Context, cm ChunkManager, sidecarPath string, data []byte) error {
+	if err := cm.Write(ctx, sidecarPath, data); err != nil {
+		return merr.WrapErrIoFailed(sidecarPath, err)
+	}
+	return nil
+}
+
+// writeJSONSidecar saves v as JSON with cm to sidecarPath, see writeSidecar.
+func writeJSONSidecar(ctx context.Context, cm ChunkManager, sidecarPath string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return merr.WrapErrServiceInternal(fmt.Sprintf("marshal sidecar %s: %s", sidecarPath, err.Error()))
+	}
+	return writeSidecar(ctx, cm, sidecarPath, data)
+}
+
+// ReadZeroVectorRows reads the sidecar of WithZeroVectorPlaceholders at sidecarPath.
+func ReadZeroVectorRows(ctx context.Context, cm ChunkManager, sidecarPath string) (*ZeroVectorRows, error) {
+	data, err := cm.Read(ctx, sidecarPath)
+	if err != nil {
+		return nil, err
+	}
+	rows := &ZeroVectorRows{}
+	if err := json.Unmarshal(data, rows); err != nil {
+		return nil, merr.WrapErrParameterInvalid("valid JSON", string(data), err.Error())
+	}
+	return rows, nil
+}
+
+// WithPKIndex saves an index of the rows by primary key to sidecarPath on Close, see ReadPKIndex.
+func WithPKIndex(cm ChunkManager, sidecarPath string) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.pkIndexCM = cm
+		o.pkIndexPath = sidecarPath
+	}
+}
+
+// WithBatchChecksums saves the CRC-32C of every field of every batch to sidecarPath on Close.
+func WithBatchChecksums(cm ChunkManager, sidecarPath string) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.checksumCM = cm
+		o.checksumPath = sidecarPath
+	}
+}
+
+// WithPKBloomFilter saves a bloom filter of the primary keys as a pk stats log to bloomPath on Close.
+func WithPKBloomFilter(cm ChunkManager, bloomPath string, capacity uint, fpr float64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.bloomFilter = true
+		o.bloomCM = cm
+		o.bloomPath = bloomPath
+		o.bloomCapacity = capacity
+		o.bloomFPR = fpr
+	}
+}
+
+// WithInMemoryPKBloomFilter builds the bloom filter of WithPKBloomFilter without saving it.
+func WithInMemoryPKBloomFilter(capacity uint, fpr float64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.bloomFilter = true
+		o.bloomCM = nil
+		o.bloomPath = ""
+		o.bloomCapacity = capacity
+		o.bloomFPR = fpr
+	}
+}
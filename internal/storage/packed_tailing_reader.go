@@ -0,0 +1,68 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+)
+
+// NewTailingPackedRecordReader reads the chunks of chunkPaths while they are written, polling every
+// pollInterval for the next chunk and returning io.EOF after idleTimeout without one.
+func NewTailingPackedRecordReader(
+	ctx context.Context,
+	chunkPaths func(chunk int) []string,
+	schema *schemapb.CollectionSchema,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	pollInterval time.Duration,
+	idleTimeout time.Duration,
+) RecordReader {
+	chunk := 0
+	return &IterativeRecordReader{
+		iterate: func() (RecordReader, error) {
+			paths := chunkPaths(chunk)
+			deadline := time.Now().Add(idleTimeout)
+			for {
+				var openErr error
+				if chunkExists(paths, storageConfig) {
+					reader, err := newPackedRecordReader(paths, schema, bufferSize, storageConfig, nil)
+					if err == nil {
+						chunk++
+						return reader, nil
+					}
+					openErr = err
+				}
+				if !time.Now().Before(deadline) {
+					if openErr != nil {
+						return nil, openErr
+					}
+					return nil, io.EOF
+				}
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(min(pollInterval, time.Until(deadline))):
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,96 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// writeVerifier checks the closed files against the rows written, see WithVerifyAfterWrite.
+type writeVerifier struct {
+	verify    bool
+	verifyPKs bool
+	// pkChecksum is the pkChecksum of the primary keys written.
+	pkChecksum uint64
+}
+
+func (v *writeVerifier) add(pkCol arrow.Array) {
+	if v.verifyPKs {
+		v.pkChecksum += pkChecksum(pkCol)
+	}
+}
+
+// verifyWritten reads the closed files back and checks that they hold the rows written.
+func (pw *packedRecordWriter) verifyWritten() error {
+	var checksum uint64
+	var visit func(arrow.Array)
+	if pw.verifyPKs {
+		visit = func(pkCol arrow.Array) {
+			checksum += pkChecksum(pkCol)
+		}
+	}
+	rows, err := countRows(pw.truePaths, pw.schema, pw.bufferSize, pw.storageConfig, pw.storagePluginContext, visit)
+	if err != nil {
+		return merr.WrapErrIoFailed(strings.Join(pw.truePaths, ","), err)
+	}
+	if rows != pw.rowNum {
+		return merr.WrapErrIoFailedReason(fmt.Sprintf("packed files %v read back %d rows, %d written", pw.truePaths, rows, pw.rowNum))
+	}
+	if pw.verifyPKs && checksum != pw.pkChecksum {
+		return merr.WrapErrIoFailedReason(fmt.Sprintf("packed files %v read back primary keys not matching the written ones", pw.truePaths))
+	}
+	return nil
+}
+
+// pkChecksum sums the hashes of the primary keys in pkCol, independent of the batching.
+func pkChecksum(pkCol arrow.Array) uint64 {
+	var sum uint64
+	h := fnv.New64a()
+	switch col := pkCol.(type) {
+	case *array.Int64:
+		var buf [8]byte
+		for i := 0; i < col.Len(); i++ {
+			h.Reset()
+			binary.LittleEndian.PutUint64(buf[:], uint64(col.Value(i)))
+			h.Write(buf[:])
+			sum += h.Sum64()
+		}
+	case *array.String:
+		for i := 0; i < col.Len(); i++ {
+			h.Reset()
+			h.Write([]byte(col.Value(i)))
+			sum += h.Sum64()
+		}
+	}
+	return sum
+}
+
+// WithVerifyAfterWrite reads the files back on Close, checking the row count and optionally the primary keys.
+func WithVerifyAfterWrite(checksumPKs bool) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.verify = true
+		o.verifyPKs = checksumPKs
+	}
+}
@@ -0,0 +1,204 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow/memory"
+
+	"github.com/milvus-io/milvus/internal/storagecommon"
+)
+
+type packedRecordWriterOptions struct {
+	ctx            context.Context
+	observer       ProgressObserver
+	mem            memory.Allocator
+	maxSegmentSize int64
+	rowGroupSize   int64
+
+	adaptiveBuffer      bool
+	minBufferSize       int64
+	maxBufferSize       int64
+	targetFlushDuration time.Duration
+	strictBufferSize    bool
+	verify              bool
+	verifyPKs           bool
+
+	schemaGuard bool
+
+	autoRowIDs bool
+	rowIDBase  int64
+
+	largeStrings     bool
+	dictionaryFields []FieldID
+
+	sortKeys   []SortKey
+	sortGlobal bool
+
+	serializerOptions []ValueSerializerOption
+
+	durability DurabilityLevel
+
+	bloomFilter   bool
+	bloomCM       ChunkManager
+	bloomPath     string
+	bloomCapacity uint
+	bloomFPR      float64
+
+	zeroVectorField FieldID
+	zeroVectorCM    ChunkManager
+	zeroVectorPath  string
+
+	pkIndexCM   ChunkManager
+	pkIndexPath string
+
+	checksumCM   ChunkManager
+	checksumPath string
+
+	segmentStats bool
+
+	minCompressedSize int64
+
+	interceptor func(Record) (Record, error)
+
+	deterministicRows int64
+
+	schemaMetadata map[string]string
+
+	perGroupBufferSize []int64
+
+	compressionByGroup []storagecommon.CompressionSpec
+}
+
+type PackedRecordWriterOption func(*packedRecordWriterOptions)
+
+// WithRowGroupSize caps the rows per parquet row group of the written files.
+func WithRowGroupSize(rowGroupSize int64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.rowGroupSize = rowGroupSize
+	}
+}
+
+// WithStrictBufferSize fails writes of rows larger than the buffer size instead of warning.
+func WithStrictBufferSize(strict bool) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.strictBufferSize = strict
+	}
+}
+
+// WithSchemaGuard checks the files already at the paths with CheckSchemaCompatible before overwriting them.
+func WithSchemaGuard() PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.schemaGuard = true
+	}
+}
+
+// WithAutoRowIDs assigns the values lacking a row id the row ids base, base+1, ..., see AssignedRowIDs.
+func WithAutoRowIDs(base int64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.autoRowIDs = true
+		o.rowIDBase = base
+	}
+}
+
+// WithLargeStringColumns writes the string fields as large strings, read with WithLargeStringReads.
+func WithLargeStringColumns() PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.largeStrings = true
+	}
+}
+
+// WithDictionaryEncoding dictionary-encodes the VarChar fields of fieldIDs, read with WithDictionaryReads.
+func WithDictionaryEncoding(fieldIDs ...FieldID) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.dictionaryFields = append(o.dictionaryFields, fieldIDs...)
+	}
+}
+
+// WithRelaxedNullability writes the type defaults for nils of non-nullable fields, see WithNullTypeDefaults.
+func WithRelaxedNullability() PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.serializerOptions = append(o.serializerOptions, WithNullTypeDefaults())
+	}
+}
+
+// WithStrictNullability fails on nils of non-nullable fields with defaults too, see WithStrictNulls.
+func WithStrictNullability() PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.serializerOptions = append(o.serializerOptions, WithStrictNulls())
+	}
+}
+
+// WithSerializerOptions passes opts to the ValueSerializer of NewPackedSerializeWriter.
+func WithSerializerOptions(opts ...ValueSerializerOption) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.serializerOptions = append(o.serializerOptions, opts...)
+	}
+}
+
+// WithSchemaMetadata adds metadata to the arrow schema of the files, "milvus." keys are reserved.
+func WithSchemaMetadata(metadata map[string]string) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.schemaMetadata = metadata
+	}
+}
+
+// WithPerGroupBufferSize flushes the i-th column group at perGroupBufferSize[i] bytes.
+func WithPerGroupBufferSize(perGroupBufferSize []int64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.perGroupBufferSize = perGroupBufferSize
+	}
+}
+
+// WithCompressionByGroup compresses the i-th column group with compressionByGroup[i].
+func WithCompressionByGroup(compressionByGroup []storagecommon.CompressionSpec) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.compressionByGroup = compressionByGroup
+	}
+}
+
+// WithWriteContext fails the writes once ctx is done, the writer still has to be closed.
+func WithWriteContext(ctx context.Context) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithWriteAllocator allocates the buffers built by the writer in Go with mem.
+func WithWriteAllocator(mem memory.Allocator) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.mem = mem
+		o.serializerOptions = append(o.serializerOptions, WithBuilderAllocator(mem))
+	}
+}
+
+// WithWriteObserver notifies observer of the rows and bytes of every batch written.
+func WithWriteObserver(observer ProgressObserver) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.observer = observer
+	}
+}
+
+// WithRecordInterceptor rewrites every record written with interceptor, which borrows the record given.
+// The writer takes over the record returned, which must hold a column for every field.
+func WithRecordInterceptor(interceptor func(Record) (Record, error)) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.interceptor = interceptor
+	}
+}
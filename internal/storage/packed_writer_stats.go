@@ -0,0 +1,227 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// segmentStatsCollector collects the stats of the rows written by a packed writer.
+type segmentStatsCollector struct {
+	pkMin PrimaryKey
+	pkMax PrimaryKey
+	// fieldNulls and fieldRanges are kept with WithSegmentStats only.
+	fieldNulls  map[FieldID]int64
+	fieldRanges map[FieldID]fieldStatsAccumulator
+	// compactReason tells why the segment is below minCompressedSize, see WithSmallSegmentCompactionHint.
+	minCompressedSize int64
+	compactReason     string
+}
+
+func newSegmentStatsCollector(fields []*schemapb.FieldSchema, fieldStats bool, minCompressedSize int64) segmentStatsCollector {
+	s := segmentStatsCollector{minCompressedSize: minCompressedSize}
+	if !fieldStats {
+		return s
+	}
+	s.fieldNulls = make(map[FieldID]int64)
+	s.fieldRanges = make(map[FieldID]fieldStatsAccumulator)
+	for _, field := range fields {
+		s.fieldNulls[field.GetFieldID()] = 0
+		// the fields of other types only count their nulls
+		if acc, err := newFieldStatsAccumulator(field.GetDataType(), false); err == nil {
+			s.fieldRanges[field.GetFieldID()] = acc
+		}
+	}
+	return s
+}
+
+// pkBounds returns the min and max primary key of pkCol, nil if it holds none.
+func pkBounds(pkCol arrow.Array) (low, high PrimaryKey) {
+	switch col := pkCol.(type) {
+	case *array.Int64:
+		if smallest, largest, ok := arrayMinMax[int64](col); ok {
+			return NewInt64PrimaryKey(smallest), NewInt64PrimaryKey(largest)
+		}
+	case *array.String:
+		// the bounds are kept past the buffers of the batch
+		if smallest, largest, ok := arrayMinMax[string](col); ok {
+			return NewVarCharPrimaryKey(strings.Clone(smallest)), NewVarCharPrimaryKey(strings.Clone(largest))
+		}
+	}
+	return nil, nil
+}
+
+func (s *segmentStatsCollector) updatePKRange(low, high PrimaryKey) {
+	if low == nil {
+		return
+	}
+	if s.pkMin == nil || low.LT(s.pkMin) {
+		s.pkMin = low
+	}
+	if s.pkMax == nil || high.GT(s.pkMax) {
+		s.pkMax = high
+	}
+}
+
+func (s *segmentStatsCollector) updateFieldStats(r Record, fields []*schemapb.FieldSchema) {
+	if s.fieldNulls == nil {
+		return
+	}
+	for _, field := range fields {
+		col := r.Column(field.GetFieldID())
+		s.fieldNulls[field.GetFieldID()] += int64(col.NullN())
+		if acc, ok := s.fieldRanges[field.GetFieldID()]; ok {
+			acc.add(col)
+		}
+	}
+}
+
+func (s *segmentStatsCollector) writtenFieldStats(fields []*schemapb.FieldSchema) map[FieldID]WrittenFieldStats {
+	stats := make(map[FieldID]WrittenFieldStats, len(s.fieldNulls))
+	for _, field := range fields {
+		fieldStats := WrittenFieldStats{NullCount: s.fieldNulls[field.GetFieldID()]}
+		if acc, ok := s.fieldRanges[field.GetFieldID()]; ok {
+			ranges := acc.stats(field.GetFieldID(), field.GetDataType())
+			fieldStats.Min, fieldStats.Max = ranges.Min, ranges.Max
+		}
+		stats[field.GetFieldID()] = fieldStats
+	}
+	return stats
+}
+
+// checkCompressedSize hints the closed segment for compaction if below minCompressedSize.
+func (s *segmentStatsCollector) checkCompressedSize(rows int64, size uint64) {
+	if s.minCompressedSize > 0 && size < uint64(s.minCompressedSize) {
+		s.compactReason = fmt.Sprintf("segment of %d rows takes %d bytes, below the minimum of %d bytes",
+			rows, size, s.minCompressedSize)
+	}
+}
+
+// CompressionRatio returns the uncompressed to compressed bytes ratio, 0 before Close.
+func (pw *packedRecordWriter) CompressionRatio() float64 {
+	compressed := pw.GetWrittenCompressed()
+	if !pw.closed || compressed == 0 {
+		return 0
+	}
+	return float64(pw.writtenUncompressed) / float64(compressed)
+}
+
+// CompressionRatios returns the compression ratio of each field, that of its group, nil before Close.
+func (pw *packedRecordWriter) CompressionRatios() map[FieldID]float64 {
+	if !pw.closed {
+		return nil
+	}
+	allFields := typeutil.GetAllFieldSchemas(pw.schema)
+	ratios := make(map[FieldID]float64, len(allFields))
+	for _, columnGroup := range pw.columnGroups {
+		compressed := pw.columnGroupCompressed[columnGroup.GroupID]
+		if compressed == 0 {
+			continue
+		}
+		ratio := float64(pw.columnGroupUncompressed[columnGroup.GroupID]) / float64(compressed)
+		for _, col := range columnGroup.Columns {
+			ratios[allFields[col].GetFieldID()] = ratio
+		}
+	}
+	return ratios
+}
+
+// GetSegmentStats returns the stats of WithSegmentStats or WithSmallSegmentCompactionHint, nil without both.
+func (pw *packedRecordWriter) GetSegmentStats() *WrittenSegmentStats {
+	if pw.fieldNulls == nil && pw.minCompressedSize <= 0 {
+		return nil
+	}
+	stats := &WrittenSegmentStats{
+		RowCount:         pw.rowNum,
+		PKMin:            pw.pkMin,
+		PKMax:            pw.pkMax,
+		ShouldCompact:    pw.compactReason != "",
+		CompactionReason: pw.compactReason,
+	}
+	if pw.fieldNulls != nil {
+		stats.Fields = pw.writtenFieldStats(typeutil.GetAllFieldSchemas(pw.schema))
+	}
+	return stats
+}
+
+// FieldValueStats are the stats of a field returned by GetFieldStats.
+type FieldValueStats struct {
+	// Min and Max are the value range of numeric and string fields, nil for others.
+	Min       interface{}
+	Max       interface{}
+	NullCount int64
+	RowCount  int64
+}
+
+// GetFieldStats returns the stats of each field with WithSegmentStats, nil without it.
+func (pw *packedRecordWriter) GetFieldStats() map[FieldID]FieldValueStats {
+	if pw.fieldNulls == nil {
+		return nil
+	}
+	written := pw.writtenFieldStats(typeutil.GetAllFieldSchemas(pw.schema))
+	stats := make(map[FieldID]FieldValueStats, len(written))
+	for id, field := range written {
+		fieldStats := FieldValueStats{NullCount: field.NullCount, RowCount: pw.rowNum}
+		if field.Min != nil {
+			fieldStats.Min, fieldStats.Max = field.Min.GetValue(), field.Max.GetValue()
+		}
+		stats[id] = fieldStats
+	}
+	return stats
+}
+
+// WithSegmentStats collects the segment stats while writing, see GetSegmentStats.
+func WithSegmentStats() PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.segmentStats = true
+	}
+}
+
+// WithSmallSegmentCompactionHint flags segments below minCompressedSize bytes for compaction.
+func WithSmallSegmentCompactionHint(minCompressedSize int64) PackedRecordWriterOption {
+	return func(o *packedRecordWriterOptions) {
+		o.minCompressedSize = minCompressedSize
+	}
+}
+
+// WrittenSegmentStats are the stats of the rows written, see GetSegmentStats.
+type WrittenSegmentStats struct {
+	RowCount int64
+	// PKMin and PKMax are the range of the primary keys, nil if no row was written.
+	PKMin PrimaryKey
+	PKMax PrimaryKey
+	// Fields are the stats of each field, nil without WithSegmentStats.
+	Fields map[FieldID]WrittenFieldStats
+	// ShouldCompact flags a segment below WithSmallSegmentCompactionHint.
+	ShouldCompact    bool
+	CompactionReason string
+}
+
+// WrittenFieldStats are the stats of a field of WrittenSegmentStats.
+type WrittenFieldStats struct {
+	NullCount int64
+	// Min and Max are the value range of numeric and string fields, nil for others.
+	Min ScalarFieldValue
+	Max ScalarFieldValue
+}
@@ -0,0 +1,405 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/samber/lo"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// parallelPart is a range of the row groups of a chunk read by a worker of a
+// parallelPackedReader, all row groups of the chunk if count is negative.
+type parallelPart struct {
+	chunk  int
+	offset int
+	count  int
+}
+
+// parallelPackedReader reads the row group ranges of a segment with a pool of workers.
+type parallelPackedReader struct {
+	field2Col map[FieldID]int
+	ordered   bool
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	// failed is closed once a worker failed with err, which cancels the others.
+	failed   chan struct{}
+	failOnce sync.Once
+	err      error
+
+	// results are the records of all parts in the unordered mode, closed once all
+	// workers are done.
+	results chan arrow.Record
+	// parts are the records of every part in the ordered mode, each closed once its
+	// part is read. next is the part consumed, window holds a token per part the
+	// workers may read ahead of it.
+	parts  []chan arrow.Record
+	next   int
+	window chan struct{}
+
+	// cur is the record returned last, released on the next read.
+	cur arrow.Record
+}
+
+var _ RecordReader = (*parallelPackedReader)(nil)
+
+// NewParallelPackedReader reads the row groups of a segment, paths holding the column
+// group files of each chunk in order, with parallelism goroutines reading disjoint ranges
+// of row groups at once, for full scans of large segments. A chunk stored in a single
+// column group file is split into up to parallelism/len(paths) ranges of its row groups,
+// rounded up, each read by a packed reader seeking to its first row group, see
+// WithRowGroupRange, which reads the footer of the file once more on open. The row groups
+// of chunks of several column group files do not line up across the files, so these
+// chunks are read whole by one goroutine.
+//
+// If ordered is set the records are returned in the order of the segment, the workers
+// reading at most parallelism ranges ahead of the one consumed. Otherwise they are
+// returned as soon as read, in any order across ranges but in order within a range.
+// Either way at most 2*parallelism records are held in flight. Once a range fails to
+// read, the other workers are canceled and Next returns the error right away, and after
+// it again.
+func NewParallelPackedReader(paths [][]string, schema *schemapb.CollectionSchema, bufferSize int64,
+	parallelism int, ordered bool,
+) (RecordReader, error) {
+	return newParallelPackedReader(paths, schema, bufferSize, parallelism, ordered, parallelism, true)
+}
+
+// NewConcurrentPackedRecordReader reads the packed files paths, each holding all the
+// columns of its rows such as the files of a segment split across many objects, with
+// parallelism goroutines each reading a different file at once. The records are returned
+// as soon as read, whole, in any order across files but in order within a file. At most
+// parallelism records are held in flight, one per goroutine waiting for the consumer. Close
+// waits for the goroutines, which close their files, also once one of them failed.
+func NewConcurrentPackedRecordReader(paths []string, schema *schemapb.CollectionSchema, bufferSize int64,
+	parallelism int,
+) (RecordReader, error) {
+	chunks := lo.Map(paths, func(p string, _ int) []string { return []string{p} })
+	return newParallelPackedReader(chunks, schema, bufferSize, parallelism, false, 0, false)
+}
+
+// newParallelPackedReader is NewParallelPackedReader buffering up to resultBuffer records
+// read in the unordered mode, besides the record held by every worker, and reading every
+// chunk whole unless split.
+func newParallelPackedReader(paths [][]string, schema *schemapb.CollectionSchema, bufferSize int64,
+	parallelism int, ordered bool, resultBuffer int, split bool,
+) (RecordReader, error) {
+	if parallelism <= 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("parallelism of packed reader must be positive, got %d", parallelism)
+	}
+	splits := 1
+	if split && len(paths) > 0 {
+		splits = (parallelism + len(paths) - 1) / len(paths)
+	}
+	parts, err := splitParallelParts(paths, schema, bufferSize, splits)
+	if err != nil {
+		return nil, err
+	}
+	field2Col := make(map[FieldID]int)
+	for i, field := range typeutil.GetAllFieldSchemas(schema) {
+		field2Col[field.FieldID] = i
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pr := &parallelPackedReader{field2Col: field2Col, ordered: ordered, cancel: cancel, failed: make(chan struct{})}
+	fail := func(err error) {
+		pr.failOnce.Do(func() {
+			pr.err = err
+			close(pr.failed)
+			cancel()
+		})
+	}
+
+	// readPart sends the records of part to out, it returns false if the read failed
+	// or was canceled.
+	readPart := func(part parallelPart, out chan<- arrow.Record) bool {
+		var opts []PackedReaderOption
+		if part.count >= 0 {
+			opts = append(opts, WithRowGroupRange(part.offset, part.count))
+		}
+		reader, err := newPackedRecordReader(paths[part.chunk], schema, bufferSize, nil, nil, opts...)
+		if err != nil {
+			fail(err)
+			return false
+		}
+		defer reader.Close()
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return true
+			}
+			if err != nil {
+				fail(err)
+				return false
+			}
+			// the batch stays valid past the next read of the reader once retained
+			batch := rec.(*simpleArrowRecord).r
+			batch.Retain()
+			select {
+			case out <- batch:
+			case <-ctx.Done():
+				batch.Release()
+				return false
+			}
+		}
+	}
+
+	var dispatched atomic.Int64
+	if ordered {
+		pr.parts = make([]chan arrow.Record, len(parts))
+		for i := range pr.parts {
+			pr.parts[i] = make(chan arrow.Record, 1)
+		}
+		pr.window = make(chan struct{}, parallelism)
+		for i := 0; i < parallelism; i++ {
+			pr.window <- struct{}{}
+		}
+	} else {
+		pr.results = make(chan arrow.Record, resultBuffer)
+	}
+	for i := 0; i < parallelism; i++ {
+		pr.wg.Add(1)
+		go func() {
+			defer pr.wg.Done()
+			for {
+				if ordered {
+					select {
+					case <-pr.window:
+					case <-ctx.Done():
+						return
+					}
+				}
+				part := int(dispatched.Inc() - 1)
+				if part >= len(parts) {
+					return
+				}
+				if ordered {
+					ok := readPart(parts[part], pr.parts[part])
+					close(pr.parts[part])
+					if !ok {
+						return
+					}
+				} else if !readPart(parts[part], pr.results) {
+					return
+				}
+			}
+		}()
+	}
+	if !ordered {
+		go func() {
+			pr.wg.Wait()
+			close(pr.results)
+		}()
+	}
+	return pr, nil
+}
+
+// splitParallelParts splits every chunk of paths stored in a single column group file
+// into up to splits ranges of about the same number of row groups, by the footer of the
+// file, and keeps the other chunks whole.
+func splitParallelParts(paths [][]string, schema *schemapb.CollectionSchema, bufferSize int64, splits int) ([]parallelPart, error) {
+	parts := make([]parallelPart, 0, len(paths))
+	var arrowSchema *arrow.Schema
+	for chunk, files := range paths {
+		if splits <= 1 || len(files) != 1 {
+			parts = append(parts, parallelPart{chunk: chunk, count: -1})
+			continue
+		}
+		if arrowSchema == nil {
+			var err error
+			if arrowSchema, err = ConvertToArrowSchema(schema, true); err != nil {
+				return nil, merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", schema.Name, err.Error())
+			}
+		}
+		groups, err := packedRowGroupCount(files[0], arrowSchema, bufferSize)
+		if err != nil {
+			return nil, err
+		}
+		n := min(splits, groups)
+		if n <= 1 {
+			parts = append(parts, parallelPart{chunk: chunk, count: -1})
+			continue
+		}
+		offset := 0
+		for i := 0; i < n; i++ {
+			count := groups / n
+			if i < groups%n {
+				count++
+			}
+			parts = append(parts, parallelPart{chunk: chunk, offset: offset, count: count})
+			offset += count
+		}
+	}
+	return parts, nil
+}
+
+// packedRowGroupCount reads the number of row groups of the packed file path from its
+// footer.
+func packedRowGroupCount(path string, arrowSchema *arrow.Schema, bufferSize int64) (int, error) {
+	reader, err := packed.NewPackedRowGroupReader(path, arrowSchema, bufferSize, nil, nil)
+	if err != nil {
+		return 0, merr.WrapErrIoFailed(path, err)
+	}
+	defer reader.Close()
+	return reader.NumRowGroups()
+}
+
+// failure returns the error a worker failed with, nil if none did.
+func (pr *parallelPackedReader) failure() error {
+	select {
+	case <-pr.failed:
+		return pr.err
+	default:
+		return nil
+	}
+}
+
+func (pr *parallelPackedReader) Next() (Record, error) {
+	pr.releaseCur()
+	if err := pr.failure(); err != nil {
+		return nil, err
+	}
+	var rec arrow.Record
+	if pr.ordered {
+		for {
+			if pr.next >= len(pr.parts) {
+				return nil, io.EOF
+			}
+			var ok bool
+			select {
+			case rec, ok = <-pr.parts[pr.next]:
+			case <-pr.failed:
+				return nil, pr.err
+			}
+			if ok {
+				break
+			}
+			// the part is consumed, a worker may read one more ahead
+			pr.next++
+			pr.window <- struct{}{}
+		}
+	} else {
+		var ok bool
+		select {
+		case rec, ok = <-pr.results:
+		case <-pr.failed:
+			return nil, pr.err
+		}
+		if !ok {
+			// the workers are done, the last of them may have failed
+			if err := pr.failure(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+	}
+	pr.cur = rec
+	return NewSimpleArrowRecord(rec, pr.field2Col), nil
+}
+
+func (pr *parallelPackedReader) releaseCur() {
+	if pr.cur != nil {
+		pr.cur.Release()
+		pr.cur = nil
+	}
+}
+
+// Close stops the workers and releases the records read ahead.
+func (pr *parallelPackedReader) Close() error {
+	pr.cancel()
+	pr.releaseCur()
+	if pr.ordered {
+		pr.wg.Wait()
+		for _, part := range pr.parts {
+			select {
+			case rec, ok := <-part:
+				if ok {
+					rec.Release()
+				}
+			default:
+			}
+		}
+	} else {
+		for rec := range pr.results {
+			rec.Release()
+		}
+	}
+	return nil
+}
+
+// RecordOrErr is a record streamed by StreamRecords, or the error the read failed with.
+type RecordOrErr struct {
+	Record Record
+	Err    error
+}
+
+// StreamRecords reads the chunks of a segment, paths holding the column group files of
+// each chunk in order, on a goroutine pushing the records to the channel returned, for
+// composing the read with pipelines of goroutines. The records are retained for the
+// receiver, which must release them. The channel is closed at the end of the segment,
+// after the error a read failed with, or once ctx is done, in which case the record not
+// received yet is released. The files of the first chunk are opened before returning,
+// so that the errors of opening the segment are returned right away.
+func StreamRecords(ctx context.Context, paths [][]string, schema *schemapb.CollectionSchema, bufferSize int64) (<-chan RecordOrErr, error) {
+	out := make(chan RecordOrErr)
+	if len(paths) == 0 {
+		close(out)
+		return out, nil
+	}
+	first, err := newPackedRecordReader(paths[0], schema, bufferSize, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	reader := newIterativePackedRecordReader(paths[1:], schema, bufferSize, nil, nil)
+	reader.cur = first
+	go func() {
+		defer close(out)
+		defer reader.Close()
+		for ctx.Err() == nil {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return
+			}
+			item := RecordOrErr{Err: err}
+			if err == nil {
+				// the record stays valid past the next read of the reader once retained
+				rec.Retain()
+				item.Record = rec
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				if item.Record != nil {
+					item.Record.Release()
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,237 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestParallelPackedReader(t *testing.T) {
+	schema := generateTestSchema()
+	// chunk i holds the primary keys 1 to i+1
+	var paths [][]string
+	var expected []int64
+	for i := 0; i < 6; i++ {
+		chunk := []string{fmt.Sprintf("/tmp/parallel_reader/%d", i)}
+		writePackedTestSegment(t, chunk, i+1)
+		paths = append(paths, chunk)
+		for pk := int64(1); pk <= int64(i+1); pk++ {
+			expected = append(expected, pk)
+		}
+	}
+	readPKs := func(reader RecordReader) []int64 {
+		defer reader.Close()
+		var pks []int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return pks
+			}
+			require.NoError(t, err)
+			pks = append(pks, rec.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+		}
+	}
+
+	for _, parallelism := range []int{1, 2, 4, 10} {
+		reader, err := NewParallelPackedReader(paths, schema, 1024, parallelism, true)
+		require.NoError(t, err)
+		assert.Equal(t, expected, readPKs(reader), parallelism)
+
+		reader, err = NewParallelPackedReader(paths, schema, 1024, parallelism, false)
+		require.NoError(t, err)
+		pks := readPKs(reader)
+		sort.Slice(pks, func(i, j int) bool { return pks[i] < pks[j] })
+		sorted := append([]int64(nil), expected...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		assert.Equal(t, sorted, pks, parallelism)
+	}
+
+	t.Run("close early", func(t *testing.T) {
+		for _, ordered := range []bool{true, false} {
+			reader, err := NewParallelPackedReader(paths, schema, 1024, 2, ordered)
+			require.NoError(t, err)
+			_, err = reader.Next()
+			require.NoError(t, err)
+			assert.NoError(t, reader.Close())
+		}
+	})
+
+	t.Run("missing chunk", func(t *testing.T) {
+		withMissing := append(append(append([][]string{}, paths[:2]...), []string{"/tmp/parallel_reader/missing"}), paths...)
+		for _, ordered := range []bool{true, false} {
+			reader, err := NewParallelPackedReader(withMissing, schema, 1024, 2, ordered)
+			require.NoError(t, err)
+			var readErr error
+			for readErr == nil {
+				_, readErr = reader.Next()
+			}
+			assert.NotEqual(t, io.EOF, readErr, ordered)
+			// the error sticks rather than blocking on the parts never read
+			_, err = reader.Next()
+			assert.Equal(t, readErr, err, ordered)
+			assert.NoError(t, reader.Close())
+		}
+	})
+
+	t.Run("row group ranges", func(t *testing.T) {
+		chunk := [][]string{{"/tmp/parallel_reader/row_groups"}}
+		writePackedTestSegment(t, chunk[0], 60, WithRowGroupSize(5))
+		pks := lo.RangeFrom(int64(1), 60)
+		pf, err := file.OpenParquetFile(chunk[0][0], false)
+		require.NoError(t, err)
+		groups := pf.NumRowGroups()
+		pf.Close()
+		require.Greater(t, groups, 3)
+		for _, parallelism := range []int{1, 3, 8} {
+			reader, err := NewParallelPackedReader(chunk, schema, 1024, parallelism, true)
+			require.NoError(t, err)
+			// a single chunk is split into a range per worker
+			assert.Len(t, reader.(*parallelPackedReader).parts, min(parallelism, groups))
+			assert.Equal(t, pks, readPKs(reader), parallelism)
+
+			reader, err = NewParallelPackedReader(chunk, schema, 1024, parallelism, false)
+			require.NoError(t, err)
+			read := readPKs(reader)
+			sort.Slice(read, func(i, j int) bool { return read[i] < read[j] })
+			assert.Equal(t, pks, read, parallelism)
+		}
+
+		_, err = NewParallelPackedReader([][]string{{"/tmp/parallel_reader/missing"}}, schema, 1024, 2, true)
+		assert.Error(t, err)
+	})
+
+	_, err := NewParallelPackedReader(paths, schema, 1024, 0, true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestConcurrentPackedRecordReader(t *testing.T) {
+	schema := generateTestSchema()
+	// file i holds the primary keys 1 to i+1, read as a single record
+	var paths []string
+	for i := 0; i < 8; i++ {
+		path := fmt.Sprintf("/tmp/concurrent_reader/%d", i)
+		writePackedTestSegment(t, []string{path}, i+1)
+		paths = append(paths, path)
+	}
+
+	for _, parallelism := range []int{1, 3, 16} {
+		reader, err := NewConcurrentPackedRecordReader(paths, schema, 1024, parallelism)
+		require.NoError(t, err)
+		var lens []int
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			// the records stay whole
+			pks := rec.Column(common.RowIDField).(*array.Int64).Int64Values()
+			assert.Equal(t, lo.RangeFrom(int64(1), len(pks)), pks)
+			lens = append(lens, len(pks))
+		}
+		sort.Ints(lens)
+		assert.Equal(t, lo.RangeFrom(1, len(paths)), lens, parallelism)
+		require.NoError(t, reader.Close())
+	}
+
+	// the readers of the other files are closed along once one fails
+	reader, err := NewConcurrentPackedRecordReader(append([]string{"/tmp/concurrent_reader/missing"}, paths...), schema, 1024, 2)
+	require.NoError(t, err)
+	var readErr error
+	for readErr == nil {
+		_, readErr = reader.Next()
+	}
+	assert.NotEqual(t, io.EOF, readErr)
+	assert.NoError(t, reader.Close())
+
+	_, err = NewConcurrentPackedRecordReader(paths, schema, 1024, 0)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestStreamRecords(t *testing.T) {
+	schema := generateTestSchema()
+	var paths [][]string
+	var expected []int64
+	for i := 0; i < 3; i++ {
+		chunk := []string{fmt.Sprintf("/tmp/stream_records/%d", i)}
+		writePackedTestSegment(t, chunk, 10)
+		paths = append(paths, chunk)
+		for pk := int64(1); pk <= 10; pk++ {
+			expected = append(expected, pk)
+		}
+	}
+
+	t.Run("all", func(t *testing.T) {
+		records, err := StreamRecords(context.Background(), paths, schema, 1024)
+		require.NoError(t, err)
+		var pks []int64
+		for item := range records {
+			require.NoError(t, item.Err)
+			pks = append(pks, item.Record.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+			item.Record.Release()
+		}
+		assert.Equal(t, expected, pks)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		records, err := StreamRecords(ctx, paths, schema, 1024)
+		require.NoError(t, err)
+		item := <-records
+		require.NoError(t, item.Err)
+		item.Record.Release()
+		cancel()
+		// the stage stops and closes the channel
+		for item := range records {
+			item.Record.Release()
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := StreamRecords(context.Background(), [][]string{{"/tmp/stream_records/missing"}}, schema, 1024)
+		assert.Error(t, err)
+
+		records, err := StreamRecords(context.Background(), [][]string{paths[0], {"/tmp/stream_records/missing"}}, schema, 1024)
+		require.NoError(t, err)
+		var last RecordOrErr
+		for item := range records {
+			if item.Record != nil {
+				item.Record.Release()
+			}
+			last = item
+		}
+		assert.Error(t, last.Err)
+
+		records, err = StreamRecords(context.Background(), nil, schema, 1024)
+		require.NoError(t, err)
+		_, ok := <-records
+		assert.False(t, ok)
+	})
+}
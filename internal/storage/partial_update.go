@@ -0,0 +1,187 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"cmp"
+	"io"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// maxOrphanExamples is the number of primary keys of partial updates without a base row
+// named by the error of the reader.
+const maxOrphanExamples = 5
+
+// isPartialKeyField tells the fields every partial row carries, the row id, the timestamp
+// and the primary key the row is merged by.
+func isPartialKeyField(field *schemapb.FieldSchema) bool {
+	return field.GetFieldID() == common.RowIDField || field.GetFieldID() == common.TimeStampField || field.GetIsPrimaryKey()
+}
+
+// PartialSchema is the schema partial rows of schema are written with, see
+// WithPartialValues: all fields but the row id, the timestamp and the primary key are
+// nullable without a default value, the fields a row leaves unchanged being written as
+// null.
+func PartialSchema(schema *schemapb.CollectionSchema) *schemapb.CollectionSchema {
+	partial := proto.Clone(schema).(*schemapb.CollectionSchema)
+	relax := func(fields []*schemapb.FieldSchema) {
+		for _, field := range fields {
+			if !isPartialKeyField(field) {
+				field.Nullable = true
+				field.DefaultValue = nil
+			}
+		}
+	}
+	relax(partial.GetFields())
+	for _, structField := range partial.GetStructArrayFields() {
+		relax(structField.GetFields())
+	}
+	return partial
+}
+
+// PartialUpdates are the partial rows of upserts writing only the fields they change, see
+// WithPartialValues, by primary key in timestamp order, to overlay onto the rows they
+// update as these are read, see WithPartialUpdates. The rows merged are tracked for the
+// partial rows without a base row, so use one PartialUpdates per read.
+type PartialUpdates struct {
+	updates map[any][]*Value
+	// pks are the primary keys in the order first read, matched those of a base row read.
+	pks     []any
+	matched map[any]bool
+}
+
+// NewPartialUpdatesFromReader builds the partial updates of all values read from reader,
+// such as the NewPackedDeserializeReader of files written with PartialSchema. The values
+// are kept, so they must not be reused nor share the buffers of the records read. The
+// fields merged are not copied, see WithPartialUpdates.
+func NewPartialUpdatesFromReader(reader DeserializeReader[*Value]) (*PartialUpdates, error) {
+	pu := &PartialUpdates{updates: make(map[any][]*Value), matched: make(map[any]bool)}
+	for {
+		v, err := reader.NextValue()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if (*v).PK == nil {
+			return nil, merr.WrapErrParameterInvalidMsg("partial row %d carries no primary key", (*v).ID)
+		}
+		pk := (*v).PK.GetValue()
+		if _, ok := pu.updates[pk]; !ok {
+			pu.pks = append(pu.pks, pk)
+		}
+		pu.updates[pk] = append(pu.updates[pk], *v)
+	}
+	for _, updates := range pu.updates {
+		slices.SortStableFunc(updates, func(a, b *Value) int {
+			return cmp.Compare(a.Timestamp, b.Timestamp)
+		})
+	}
+	return pu, nil
+}
+
+// Len returns the number of primary keys updated.
+func (pu *PartialUpdates) Len() int {
+	return len(pu.pks)
+}
+
+// overlay sets the fields of the partial rows of the primary key of value newer than it
+// onto its map, in timestamp order, and its timestamp to the one of the newest. The
+// fields the partial rows leave unchanged, read as nil, keep the values of the base row.
+func (pu *PartialUpdates) overlay(value *Value) {
+	pk := value.PK.GetValue()
+	updates, ok := pu.updates[pk]
+	if !ok {
+		return
+	}
+	pu.matched[pk] = true
+	m := value.Value.(map[FieldID]interface{})
+	for _, update := range updates {
+		if update.Timestamp <= value.Timestamp {
+			continue
+		}
+		mergePartialRow(m, update)
+		value.Timestamp = update.Timestamp
+	}
+}
+
+// mergePartialRow sets the fields of update set onto m, but for the row id. The values
+// are set as they are, so m shares the slices and messages of update.
+func mergePartialRow(m map[FieldID]interface{}, update *Value) {
+	for fieldID, v := range update.Value.(map[FieldID]interface{}) {
+		if v != nil && fieldID != common.RowIDField {
+			m[fieldID] = v
+		}
+	}
+}
+
+// rejectPartialUpdates fails opts of WithPartialUpdates for the readers other than
+// NewPackedDeserializeReader: they drop rows the partial rows may apply to, or never
+// report the partial rows without a base row.
+func rejectPartialUpdates(opts []ValueDeserializerOption) error {
+	options := &valueDeserializerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.partials != nil || options.incompletePartials {
+		return merr.WrapErrParameterInvalidMsg("partial updates are only merged by NewPackedDeserializeReader")
+	}
+	return nil
+}
+
+// orphans returns the partial rows of the primary keys no base row was read of, merged,
+// and flagged Incomplete, or fails with them unless incomplete.
+func (pu *PartialUpdates) orphans(incomplete bool) ([]*Value, error) {
+	var orphans []any
+	for _, pk := range pu.pks {
+		if !pu.matched[pk] {
+			orphans = append(orphans, pk)
+		}
+	}
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+	if !incomplete {
+		return nil, merr.WrapErrParameterInvalidMsg("partial updates of %d primary keys have no base row, e.g. %v",
+			len(orphans), orphans[:min(len(orphans), maxOrphanExamples)])
+	}
+	values := make([]*Value, 0, len(orphans))
+	for _, pk := range orphans {
+		updates := pu.updates[pk]
+		m := make(map[FieldID]interface{})
+		for _, update := range updates {
+			mergePartialRow(m, update)
+		}
+		newest := updates[len(updates)-1]
+		m[common.RowIDField] = updates[0].Value.(map[FieldID]interface{})[common.RowIDField]
+		values = append(values, &Value{
+			ID:         updates[0].ID,
+			PK:         newest.PK,
+			Timestamp:  newest.Timestamp,
+			Incomplete: true,
+			Value:      m,
+		})
+	}
+	return values, nil
+}
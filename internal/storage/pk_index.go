@@ -0,0 +1,171 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// PKIndex is the sidecar of WithPKIndex, the rows of a segment sorted by primary key. A
+// single one of Int64PKs and VarCharPKs is set, by the type of the primary key, Rows holds
+// the row of each key in the segment. Duplicate keys stay in the order they were written.
+type PKIndex struct {
+	PKType     schemapb.DataType `json:"pkType"`
+	Int64PKs   []int64           `json:"int64PKs,omitempty"`
+	VarCharPKs []string          `json:"varCharPKs,omitempty"`
+	Rows       []int64           `json:"rows"`
+	// RowsPerGroup is the number of rows of the row groups of the segment, 0 if unknown.
+	RowsPerGroup int64 `json:"rowsPerGroup,omitempty"`
+}
+
+// PKLocation locates a row of a segment, see LookupByPK.
+type PKLocation struct {
+	// Row is the row in the segment, the rows a reader skips to reach it.
+	Row int64
+	// RowGroup is the row group holding the row and GroupOffset the row in the group, -1
+	// if the row groups of the segment are unknown.
+	RowGroup    int64
+	GroupOffset int64
+}
+
+// pkIndexBuilder collects the keys of the rows written for WithPKIndex.
+type pkIndexBuilder struct {
+	index *PKIndex
+}
+
+func newPKIndexBuilder(pkType schemapb.DataType, rowsPerGroup int64) (*pkIndexBuilder, error) {
+	if pkType != schemapb.DataType_Int64 && pkType != schemapb.DataType_VarChar {
+		return nil, merr.WrapErrParameterInvalidMsg("pk index does not support primary keys of type %s", pkType)
+	}
+	return &pkIndexBuilder{index: &PKIndex{PKType: pkType, Rows: []int64{}, RowsPerGroup: rowsPerGroup}}, nil
+}
+
+// add adds the keys of pkCol, written from row start of the segment on.
+func (b *pkIndexBuilder) add(pkCol arrow.Array, start int64) {
+	switch col := pkCol.(type) {
+	case *array.Int64:
+		b.index.Int64PKs = append(b.index.Int64PKs, col.Int64Values()...)
+	case *array.String:
+		for i := 0; i < col.Len(); i++ {
+			b.index.VarCharPKs = append(b.index.VarCharPKs, strings.Clone(col.Value(i)))
+		}
+	case *array.LargeString:
+		for i := 0; i < col.Len(); i++ {
+			b.index.VarCharPKs = append(b.index.VarCharPKs, strings.Clone(col.Value(i)))
+		}
+	}
+	for i := 0; i < pkCol.Len(); i++ {
+		b.index.Rows = append(b.index.Rows, start+int64(i))
+	}
+}
+
+// finish sorts the keys collected and returns the index.
+func (b *pkIndexBuilder) finish() *PKIndex {
+	index := b.index
+	if index.PKType == schemapb.DataType_Int64 {
+		sort.Stable(&pkIndexSorter[int64]{pks: index.Int64PKs, rows: index.Rows})
+	} else {
+		sort.Stable(&pkIndexSorter[string]{pks: index.VarCharPKs, rows: index.Rows})
+	}
+	return index
+}
+
+// pkIndexSorter sorts the keys of an index along with their rows.
+type pkIndexSorter[T int64 | string] struct {
+	pks  []T
+	rows []int64
+}
+
+func (s *pkIndexSorter[T]) Len() int           { return len(s.pks) }
+func (s *pkIndexSorter[T]) Less(i, j int) bool { return s.pks[i] < s.pks[j] }
+func (s *pkIndexSorter[T]) Swap(i, j int) {
+	s.pks[i], s.pks[j] = s.pks[j], s.pks[i]
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+}
+
+// ReadPKIndex reads the sidecar of WithPKIndex at sidecarPath.
+func ReadPKIndex(ctx context.Context, cm ChunkManager, sidecarPath string) (*PKIndex, error) {
+	data, err := cm.Read(ctx, sidecarPath)
+	if err != nil {
+		return nil, err
+	}
+	index := &PKIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, merr.WrapErrParameterInvalid("valid JSON", string(data), err.Error())
+	}
+	keys := len(index.Int64PKs)
+	if index.PKType == schemapb.DataType_VarChar {
+		keys = len(index.VarCharPKs)
+	}
+	if keys != len(index.Rows) {
+		return nil, merr.WrapErrParameterInvalidMsg("pk index at %s holds %d keys for %d rows", sidecarPath, keys, len(index.Rows))
+	}
+	return index, nil
+}
+
+// Lookup returns the location of the first row written of key pk, binary searching the
+// sorted keys, and whether the segment holds such a row.
+func (index *PKIndex) Lookup(pk PrimaryKey) (PKLocation, bool, error) {
+	var i int
+	var found bool
+	switch key := pk.GetValue().(type) {
+	case int64:
+		if index.PKType != schemapb.DataType_Int64 {
+			return PKLocation{}, false, merr.WrapErrParameterInvalidMsg("int64 key looked up in pk index of %s keys", index.PKType)
+		}
+		i = sort.Search(len(index.Int64PKs), func(i int) bool { return index.Int64PKs[i] >= key })
+		found = i < len(index.Int64PKs) && index.Int64PKs[i] == key
+	case string:
+		if index.PKType != schemapb.DataType_VarChar {
+			return PKLocation{}, false, merr.WrapErrParameterInvalidMsg("varchar key looked up in pk index of %s keys", index.PKType)
+		}
+		i = sort.Search(len(index.VarCharPKs), func(i int) bool { return index.VarCharPKs[i] >= key })
+		found = i < len(index.VarCharPKs) && index.VarCharPKs[i] == key
+	default:
+		return PKLocation{}, false, merr.WrapErrParameterInvalidMsg("unsupported primary key %v", pk.GetValue())
+	}
+	if !found {
+		return PKLocation{}, false, nil
+	}
+	location := PKLocation{Row: index.Rows[i], RowGroup: -1, GroupOffset: -1}
+	if index.RowsPerGroup > 0 {
+		location.RowGroup = location.Row / index.RowsPerGroup
+		location.GroupOffset = location.Row % index.RowsPerGroup
+	}
+	return location, true, nil
+}
+
+// LookupByPK reads the sidecar of WithPKIndex at sidecarPath and returns the location of
+// the row of key pk in its segment, so that a reader skips to the row rather than
+// scanning for it, and whether the segment holds such a row. Callers looking up several
+// keys should read the index once with ReadPKIndex.
+func LookupByPK(ctx context.Context, cm ChunkManager, sidecarPath string, pk PrimaryKey) (PKLocation, bool, error) {
+	index, err := ReadPKIndex(ctx, cm, sidecarPath)
+	if err != nil {
+		return PKLocation{}, false, err
+	}
+	return index.Lookup(pk)
+}
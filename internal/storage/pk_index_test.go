@@ -0,0 +1,128 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"math/rand"
+	"path"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/util/initcore"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/objectstorage"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
+)
+
+func TestPKIndex(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	ctx := context.Background()
+	dir := t.TempDir()
+	cm := NewLocalChunkManager(objectstorage.RootPath(dir))
+
+	t.Run("int64", func(t *testing.T) {
+		schema := generateTestSchema()
+		groups := []storagecommon.ColumnGroup{{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: lo.Range(len(schema.Fields))}}
+		blobs, err := generateTestData(20)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		rand.New(rand.NewSource(1)).Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+
+		sidecar := path.Join(dir, "int64_pk_index")
+		writer, err := NewPackedSerializeWriter("", []string{path.Join(dir, "int64", "0")}, schema, 1024*1024, 0, groups, 7,
+			WithPKIndex(cm, sidecar), WithDeterministicOutput(4))
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+
+		index, err := ReadPKIndex(ctx, cm, sidecar)
+		require.NoError(t, err)
+		assert.True(t, lo.IsSorted(index.Int64PKs))
+		for row, v := range values {
+			location, ok, err := LookupByPK(ctx, cm, sidecar, v.PK)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, PKLocation{Row: int64(row), RowGroup: int64(row / 4), GroupOffset: int64(row % 4)}, location)
+		}
+		_, ok, err := index.Lookup(NewInt64PrimaryKey(100))
+		require.NoError(t, err)
+		assert.False(t, ok)
+		_, _, err = index.Lookup(NewVarCharPrimaryKey("1"))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("varchar", func(t *testing.T) {
+		schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64},
+			{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "pk", DataType: schemapb.DataType_VarChar, IsPrimaryKey: true, TypeParams: []*commonpb.KeyValuePair{{Key: common.MaxLengthKey, Value: "16"}}},
+		}}
+		pks := []string{"m", "b", "z", "b", "k"}
+		values := lo.Map(pks, func(pk string, i int) *Value {
+			return &Value{Value: map[FieldID]any{common.RowIDField: int64(i), common.TimeStampField: int64(1), 100: pk}}
+		})
+		rec, err := ValueSerializer(values, schema)
+		require.NoError(t, err)
+		sidecar := path.Join(dir, "varchar_pk_index")
+		pw, err := NewPackedRecordWriter("", []string{path.Join(dir, "varchar", "0")}, schema, 1024, 0,
+			[]storagecommon.ColumnGroup{{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: []int{0, 1, 2}}}, nil, nil,
+			WithPKIndex(cm, sidecar))
+		require.NoError(t, err)
+		require.NoError(t, pw.Write(rec))
+		require.NoError(t, pw.Close())
+
+		index, err := ReadPKIndex(ctx, cm, sidecar)
+		require.NoError(t, err)
+		assert.Equal(t, &PKIndex{PKType: schemapb.DataType_VarChar, VarCharPKs: []string{"b", "b", "k", "m", "z"}, Rows: []int64{1, 3, 4, 0, 2}}, index)
+		// the first row written of a duplicate key, the row groups unknown
+		location, ok, err := index.Lookup(NewVarCharPrimaryKey("b"))
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, PKLocation{Row: 1, RowGroup: -1, GroupOffset: -1}, location)
+	})
+
+	t.Run("large strings", func(t *testing.T) {
+		builder := array.NewLargeStringBuilder(memory.DefaultAllocator)
+		builder.AppendValues([]string{"m", "b", "z"}, nil)
+		pkCol := builder.NewArray()
+		defer pkCol.Release()
+		b, err := newPKIndexBuilder(schemapb.DataType_VarChar, 0)
+		require.NoError(t, err)
+		b.add(pkCol, 10)
+		assert.Equal(t, &PKIndex{PKType: schemapb.DataType_VarChar, VarCharPKs: []string{"b", "m", "z"}, Rows: []int64{11, 10, 12}}, b.finish())
+	})
+
+	_, err := NewPackedRecordWriter("", []string{path.Join(dir, "invalid", "0")}, generateTestSchema(), 1024, 0,
+		[]storagecommon.ColumnGroup{{GroupID: storagecommon.DefaultShortColumnGroupID}}, nil, nil, WithPKIndex(cm, ""))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
@@ -17,9 +17,12 @@
 package storage
 
 import (
+	"cmp"
 	"fmt"
 	"strings"
 
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
 	"github.com/cockroachdb/errors"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
@@ -260,6 +263,42 @@ func (vcp *VarCharPrimaryKey) Size() int64 {
 	return int64(len(vcp.Value) + 8)
 }
 
+// PKComparator orders primary keys for the readers merging PK-sorted inputs, Compare
+// returning a negative number if a orders before b, zero if they are the same key and a
+// positive number otherwise. It decouples the merges from the concrete PK types.
+type PKComparator interface {
+	Compare(a, b PrimaryKey) int
+}
+
+// PKComparatorFunc adapts a function to a PKComparator.
+type PKComparatorFunc func(a, b PrimaryKey) int
+
+func (f PKComparatorFunc) Compare(a, b PrimaryKey) int {
+	return f(a, b)
+}
+
+var (
+	// DefaultPKComparator orders the keys of any type with their LT and EQ methods.
+	DefaultPKComparator PKComparator = PKComparatorFunc(func(a, b PrimaryKey) int {
+		switch {
+		case a.EQ(b):
+			return 0
+		case a.LT(b):
+			return -1
+		default:
+			return 1
+		}
+	})
+	// Int64PKComparator orders int64 keys, it panics on keys of other types.
+	Int64PKComparator PKComparator = PKComparatorFunc(func(a, b PrimaryKey) int {
+		return cmp.Compare(a.(*Int64PrimaryKey).Value, b.(*Int64PrimaryKey).Value)
+	})
+	// VarCharPKComparator orders VarChar keys, it panics on keys of other types.
+	VarCharPKComparator PKComparator = PKComparatorFunc(func(a, b PrimaryKey) int {
+		return strings.Compare(a.(*VarCharPrimaryKey).Value, b.(*VarCharPrimaryKey).Value)
+	})
+)
+
 func GenPrimaryKeyByRawData(data interface{}, pkType schemapb.DataType) (PrimaryKey, error) {
 	var result PrimaryKey
 	switch pkType {
@@ -278,6 +317,47 @@ func GenPrimaryKeyByRawData(data interface{}, pkType schemapb.DataType) (Primary
 	return result, nil
 }
 
+// GenPrimaryKeysFromArrow builds the primary keys of all rows of the int64 or string
+// primary key column col at once, allocating the keys of the batch together instead of
+// one by one. The keys of a batch share their backing array, which is only freed once no
+// key of the batch is referenced anymore. String keys reference the arrow buffers of col
+// unless shouldCopy is set. ok is false for columns of other types.
+func GenPrimaryKeysFromArrow(col arrow.Array, shouldCopy bool) (pks []PrimaryKey, ok bool, err error) {
+	if col.NullN() > 0 {
+		return nil, true, merr.WrapErrServiceInternal(fmt.Sprintf("primary key column holds %d nulls", col.NullN()))
+	}
+	pks = make([]PrimaryKey, col.Len())
+	switch col := col.(type) {
+	case *array.Int64:
+		keys := make([]Int64PrimaryKey, col.Len())
+		for i, value := range col.Int64Values() {
+			keys[i].Value = value
+			pks[i] = &keys[i]
+		}
+	case *array.String:
+		keys := make([]VarCharPrimaryKey, col.Len())
+		for i := range keys {
+			keys[i].Value = col.Value(i)
+			if shouldCopy {
+				keys[i].Value = strings.Clone(keys[i].Value)
+			}
+			pks[i] = &keys[i]
+		}
+	case *array.LargeString:
+		keys := make([]VarCharPrimaryKey, col.Len())
+		for i := range keys {
+			keys[i].Value = col.Value(i)
+			if shouldCopy {
+				keys[i].Value = strings.Clone(keys[i].Value)
+			}
+			pks[i] = &keys[i]
+		}
+	default:
+		return nil, false, nil
+	}
+	return pks, true, nil
+}
+
 func GenInt64PrimaryKeys(data ...int64) ([]PrimaryKey, error) {
 	pks := make([]PrimaryKey, len(data))
 	var err error
@@ -3,6 +3,8 @@ package storage
 import (
 	"testing"
 
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
@@ -82,6 +84,22 @@ func TestInt64PrimaryKey(t *testing.T) {
 	})
 }
 
+func TestPKComparators(t *testing.T) {
+	one, two := NewInt64PrimaryKey(1), NewInt64PrimaryKey(2)
+	a, b := NewVarCharPrimaryKey("a"), NewVarCharPrimaryKey("b")
+	for _, c := range []PKComparator{DefaultPKComparator, Int64PKComparator} {
+		assert.Negative(t, c.Compare(one, two))
+		assert.Positive(t, c.Compare(two, one))
+		assert.Zero(t, c.Compare(one, NewInt64PrimaryKey(1)))
+	}
+	for _, c := range []PKComparator{DefaultPKComparator, VarCharPKComparator} {
+		assert.Negative(t, c.Compare(a, b))
+		assert.Positive(t, c.Compare(b, a))
+		assert.Zero(t, c.Compare(a, NewVarCharPrimaryKey("a")))
+	}
+	assert.Panics(t, func() { Int64PKComparator.Compare(one, a) })
+}
+
 func TestParseFieldData2PrimaryKeys(t *testing.T) {
 	t.Run("int64 pk", func(t *testing.T) {
 		pkValues := []int64{1, 2}
@@ -219,3 +237,65 @@ func TestParsePrimaryKeysBatch2IDs(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestGenPrimaryKeysFromArrow(t *testing.T) {
+	int64Builder := array.NewInt64Builder(memory.DefaultAllocator)
+	int64Builder.AppendValues([]int64{3, 1, 2}, nil)
+	int64Col := int64Builder.NewArray()
+	defer int64Col.Release()
+	pks, ok, err := GenPrimaryKeysFromArrow(int64Col, false)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []PrimaryKey{NewInt64PrimaryKey(3), NewInt64PrimaryKey(1), NewInt64PrimaryKey(2)}, pks)
+
+	stringBuilder := array.NewStringBuilder(memory.DefaultAllocator)
+	stringBuilder.AppendValues([]string{"b", "a"}, nil)
+	stringCol := stringBuilder.NewArray()
+	defer stringCol.Release()
+	pks, ok, err = GenPrimaryKeysFromArrow(stringCol, true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []PrimaryKey{NewVarCharPrimaryKey("b"), NewVarCharPrimaryKey("a")}, pks)
+
+	int64Builder.AppendNull()
+	nullCol := int64Builder.NewArray()
+	defer nullCol.Release()
+	_, _, err = GenPrimaryKeysFromArrow(nullCol, false)
+	assert.Error(t, err)
+
+	floatBuilder := array.NewFloat32Builder(memory.DefaultAllocator)
+	floatBuilder.Append(1)
+	floatCol := floatBuilder.NewArray()
+	defer floatCol.Release()
+	_, ok, err = GenPrimaryKeysFromArrow(floatCol, false)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func BenchmarkGenPrimaryKeys(b *testing.B) {
+	builder := array.NewInt64Builder(memory.DefaultAllocator)
+	for i := 0; i < 65536; i++ {
+		builder.Append(int64(i))
+	}
+	col := builder.NewArray().(*array.Int64)
+	defer col.Release()
+
+	b.Run("per row", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for i := 0; i < col.Len(); i++ {
+				if _, err := GenPrimaryKeyByRawData(col.Value(i), schemapb.DataType_Int64); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batched", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			if _, _, err := GenPrimaryKeysFromArrow(col, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
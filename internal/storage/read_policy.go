@@ -0,0 +1,243 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/apache/arrow/go/v17/parquet/metadata"
+
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// ByteRange is a range of Length bytes of a file starting at Offset.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// End returns the offset past the last byte of the range.
+func (r ByteRange) End() int64 {
+	return r.Offset + r.Length
+}
+
+// ReadPolicy coalesces the byte ranges read from a file into fewer larger range reads,
+// which object stores serve faster than many small ones.
+type ReadPolicy struct {
+	// MaxSpan caps the length of a coalesced read, 0 for no cap. A single range longer
+	// than it is read as is.
+	MaxSpan int64
+	// MaxGap is the most bytes between two ranges read, and wasted, to coalesce them.
+	MaxGap int64
+}
+
+// Coalesce returns the reads of ranges under the policy, in order of offset. Ranges
+// overlapping or closer than MaxGap are read at once unless the read spans more than
+// MaxSpan.
+func (p ReadPolicy) Coalesce(ranges []ByteRange) []ByteRange {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b ByteRange) int {
+		return cmp.Or(cmp.Compare(a.Offset, b.Offset), cmp.Compare(a.Length, b.Length))
+	})
+	var reads []ByteRange
+	for _, r := range sorted {
+		if r.Length <= 0 {
+			continue
+		}
+		if n := len(reads); n > 0 {
+			last := &reads[n-1]
+			end := max(last.End(), r.End())
+			if r.Offset-last.End() <= p.MaxGap && (p.MaxSpan <= 0 || end-last.Offset <= p.MaxSpan) {
+				last.Length = end - last.Offset
+				continue
+			}
+		}
+		reads = append(reads, r)
+	}
+	return reads
+}
+
+// ReadStats tells the reads of a plan of PlanPackedReads, or those a packed reader of
+// WithReadPolicy issued.
+type ReadStats struct {
+	// Ranges is the number of column chunks, the reads without coalescing. Those of a
+	// reader are the reads asked by its parquet readers, the footer reads included.
+	Ranges int64
+	// Requests is the number of range reads, the GETs of an object store.
+	Requests int64
+	// BytesRead is the number of bytes read, WastedBytes those of the gaps between the
+	// column chunks read along.
+	BytesRead   int64
+	WastedBytes int64
+}
+
+// PlanPackedReads returns the range reads of the column chunks of the packed files paths,
+// read through cm, coalesced by policy, and their stats, from the footers of the files.
+// The reads of a file never span into another file, and the footers are not counted.
+// The native readers of WithReadPolicy plan and issue the same reads, counting the
+// requests they actually send; the plan tells the requests a policy saves before opening
+// a reader, to tune it per object store.
+func PlanPackedReads(ctx context.Context, cm ChunkManager, paths []string, policy ReadPolicy) ([][]ByteRange, ReadStats, error) {
+	if policy.MaxSpan < 0 || policy.MaxGap < 0 {
+		return nil, ReadStats{}, merr.WrapErrParameterInvalidMsg("invalid read policy, max span %d, max gap %d", policy.MaxSpan, policy.MaxGap)
+	}
+	plan := make([][]ByteRange, len(paths))
+	var stats ReadStats
+	for i, path := range paths {
+		ranges, err := packedColumnChunks(ctx, cm, path)
+		if err != nil {
+			return nil, ReadStats{}, err
+		}
+		plan[i] = policy.Coalesce(ranges)
+		stats.Ranges += int64(len(ranges))
+		stats.Requests += int64(len(plan[i]))
+		// the bytes of the chunks, counted once if they overlap, are those of the reads
+		// coalescing no gap
+		var readBytes, chunkBytes int64
+		for _, r := range plan[i] {
+			readBytes += r.Length
+		}
+		for _, r := range (ReadPolicy{}).Coalesce(ranges) {
+			chunkBytes += r.Length
+		}
+		stats.BytesRead += readBytes
+		stats.WastedBytes += readBytes - chunkBytes
+	}
+	return plan, stats, nil
+}
+
+// readPackedFooter reads the parquet footer of the packed file path through cm.
+func readPackedFooter(ctx context.Context, cm ChunkManager, path string) (*metadata.FileMetaData, error) {
+	reader, err := cm.Reader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	pf, err := file.NewParquetReader(reader)
+	if err != nil {
+		return nil, merr.WrapErrIoFailed(path, err)
+	}
+	defer pf.Close()
+	return pf.MetaData(), nil
+}
+
+// packedColumnChunks returns the byte ranges of the column chunks of the row groups of
+// the packed file path.
+func packedColumnChunks(ctx context.Context, cm ChunkManager, path string) ([]ByteRange, error) {
+	footer, err := readPackedFooter(ctx, cm, path)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []ByteRange
+	for i := 0; i < len(footer.GetRowGroups()); i++ {
+		rowGroup := footer.RowGroup(i)
+		for j := 0; j < rowGroup.NumColumns(); j++ {
+			chunk, err := rowGroup.ColumnChunk(j)
+			if err != nil {
+				return nil, merr.WrapErrIoFailed(path, err)
+			}
+			offset := chunk.DataPageOffset()
+			if chunk.HasDictionaryPage() && chunk.DictionaryPageOffset() < offset {
+				offset = chunk.DictionaryPageOffset()
+			}
+			ranges = append(ranges, ByteRange{Offset: offset, Length: chunk.TotalCompressedSize()})
+		}
+	}
+	return ranges, nil
+}
+
+// readStatsCollector sums the reads of the native readers of a packed reader, those
+// closed and those still open.
+type readStatsCollector struct {
+	mu     sync.Mutex
+	closed ReadStats
+	open   map[*readStatsBatchReader]struct{}
+}
+
+func newReadStatsCollector() *readStatsCollector {
+	return &readStatsCollector{open: make(map[*readStatsBatchReader]struct{})}
+}
+
+// nativeReadStats is implemented by the native readers opened with a read policy.
+type nativeReadStats interface {
+	ReadStats() (packed.ReadStats, error)
+}
+
+// track counts the reads of reader until it is closed.
+func (c *readStatsCollector) track(reader packedBatchReader) packedBatchReader {
+	native, ok := reader.(nativeReadStats)
+	if !ok {
+		return reader
+	}
+	tracked := &readStatsBatchReader{packedBatchReader: reader, native: native, collector: c}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.open[tracked] = struct{}{}
+	return tracked
+}
+
+func (c *readStatsCollector) stats() ReadStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.closed
+	for r := range c.open {
+		stats = stats.add(r.stats())
+	}
+	return stats
+}
+
+func (s ReadStats) add(other ReadStats) ReadStats {
+	return ReadStats{
+		Ranges:      s.Ranges + other.Ranges,
+		Requests:    s.Requests + other.Requests,
+		BytesRead:   s.BytesRead + other.BytesRead,
+		WastedBytes: s.WastedBytes + other.WastedBytes,
+	}
+}
+
+// readStatsBatchReader moves the reads of a native reader to the closed ones of its
+// collector as it closes, reading its stats before the native reader is freed.
+type readStatsBatchReader struct {
+	packedBatchReader
+	native    nativeReadStats
+	collector *readStatsCollector
+}
+
+// stats returns the reads of the native reader, zero if they cannot be read.
+func (r *readStatsBatchReader) stats() ReadStats {
+	s, err := r.native.ReadStats()
+	if err != nil {
+		return ReadStats{}
+	}
+	return ReadStats{Ranges: s.Ranges, Requests: s.Requests, BytesRead: s.BytesRead, WastedBytes: s.WastedBytes}
+}
+
+func (r *readStatsBatchReader) Close() error {
+	c := r.collector
+	c.mu.Lock()
+	if _, ok := c.open[r]; ok {
+		c.closed = c.closed.add(r.stats())
+		delete(c.open, r)
+	}
+	c.mu.Unlock()
+	return r.packedBatchReader.Close()
+}
@@ -0,0 +1,164 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/pkg/v2/objectstorage"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestReadPolicyCoalesce(t *testing.T) {
+	ranges := []ByteRange{{Offset: 30, Length: 10}, {Offset: 0, Length: 10}, {Offset: 10, Length: 5}, {Offset: 52, Length: 8}, {Offset: 100, Length: 0}}
+	tests := []struct {
+		policy ReadPolicy
+		want   []ByteRange
+	}{
+		{ReadPolicy{}, []ByteRange{{Offset: 0, Length: 15}, {Offset: 30, Length: 10}, {Offset: 52, Length: 8}}},
+		{ReadPolicy{MaxGap: 15}, []ByteRange{{Offset: 0, Length: 60}}},
+		{ReadPolicy{MaxGap: 15, MaxSpan: 40}, []ByteRange{{Offset: 0, Length: 40}, {Offset: 52, Length: 8}}},
+		// a range longer than the span is read as is
+		{ReadPolicy{MaxGap: 15, MaxSpan: 5}, []ByteRange{{Offset: 0, Length: 10}, {Offset: 10, Length: 5}, {Offset: 30, Length: 10}, {Offset: 52, Length: 8}}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.policy.Coalesce(ranges), "%+v", tt.policy)
+	}
+	// overlapping ranges are read once
+	assert.Equal(t, []ByteRange{{Offset: 0, Length: 20}}, ReadPolicy{}.Coalesce([]ByteRange{{Offset: 0, Length: 15}, {Offset: 5, Length: 15}}))
+}
+
+// writeReadPolicyTestSegment writes a segment of two column groups of a few row groups each.
+func writeReadPolicyTestSegment(t testing.TB) []string {
+	paths := []string{"/tmp/read_policy/0", "/tmp/read_policy/1"}
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(generateTestSchema().Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	writePackedTestSegmentWithGroups(t, paths, groups, 40, WithRowGroupSize(10))
+	return paths
+}
+
+func TestPlanPackedReads(t *testing.T) {
+	ctx := context.Background()
+	paths := writeReadPolicyTestSegment(t)
+	cm := NewLocalChunkManager(objectstorage.RootPath("/"))
+
+	plan, uncoalesced, err := PlanPackedReads(ctx, cm, paths, ReadPolicy{MaxSpan: 1})
+	require.NoError(t, err)
+	assert.Equal(t, uncoalesced.Ranges, uncoalesced.Requests)
+	assert.Zero(t, uncoalesced.WastedBytes)
+	assert.Len(t, plan, 2)
+
+	plan, coalesced, err := PlanPackedReads(ctx, cm, paths, ReadPolicy{MaxGap: 1 << 20})
+	require.NoError(t, err)
+	// a read per file
+	assert.Equal(t, int64(2), coalesced.Requests)
+	assert.Equal(t, uncoalesced.Ranges, coalesced.Ranges)
+	assert.Equal(t, uncoalesced.BytesRead+coalesced.WastedBytes, coalesced.BytesRead)
+	for i, path := range paths {
+		size, err := cm.Size(ctx, path)
+		require.NoError(t, err)
+		require.Len(t, plan[i], 1)
+		assert.Less(t, plan[i][0].End(), size)
+	}
+
+	_, _, err = PlanPackedReads(ctx, cm, paths, ReadPolicy{MaxGap: -1})
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, _, err = PlanPackedReads(ctx, cm, []string{"/tmp/read_policy/missing"}, ReadPolicy{})
+	assert.Error(t, err)
+}
+
+// readWithPolicy reads all rows of the segment of paths with policy, returning the reads
+// the native readers issued.
+func readWithPolicy(t testing.TB, paths []string, policy ReadPolicy) (int, ReadStats) {
+	reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024*1024, nil, nil, WithReadPolicy(policy))
+	require.NoError(t, err)
+	rows := 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		rows += rec.Len()
+	}
+	require.NoError(t, reader.Close())
+	return rows, reader.ReadStats()
+}
+
+func TestPackedReaderReadPolicy(t *testing.T) {
+	paths := writeReadPolicyTestSegment(t)
+
+	rows, uncoalesced := readWithPolicy(t, paths, ReadPolicy{MaxSpan: 1})
+	assert.Equal(t, 40, rows)
+	assert.Positive(t, uncoalesced.Requests)
+	assert.Zero(t, uncoalesced.WastedBytes)
+	rows, coalesced := readWithPolicy(t, paths, ReadPolicy{MaxGap: 1 << 20})
+	assert.Equal(t, 40, rows)
+	// the chunks of all row groups of a file are read by one GET
+	assert.Less(t, coalesced.Requests, uncoalesced.Requests)
+	assert.GreaterOrEqual(t, coalesced.Ranges, coalesced.Requests)
+
+	schema := generateTestSchema()
+	_, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithReadPolicy(ReadPolicy{MaxGap: -1}))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = newPackedRecordReader(paths[:1], schema, 1024, nil, nil, WithReadPolicy(ReadPolicy{}), WithRowGroupRange(0, 1))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func BenchmarkPackedReaderReadPolicy(b *testing.B) {
+	paths := writeReadPolicyTestSegment(b)
+	for _, policy := range []ReadPolicy{{MaxSpan: 1}, {MaxGap: 1 << 10, MaxSpan: 8 << 20}, {MaxGap: 1 << 20}} {
+		b.Run(fmt.Sprintf("gap=%d,span=%d", policy.MaxGap, policy.MaxSpan), func(b *testing.B) {
+			var stats ReadStats
+			for i := 0; i < b.N; i++ {
+				_, stats = readWithPolicy(b, paths, policy)
+			}
+			b.ReportMetric(float64(stats.Requests), "requests/op")
+			b.ReportMetric(float64(stats.BytesRead), "bytes-read/op")
+			b.ReportMetric(float64(stats.WastedBytes), "wasted-bytes/op")
+		})
+	}
+}
+
+func BenchmarkPlanPackedReads(b *testing.B) {
+	ctx := context.Background()
+	paths := writeReadPolicyTestSegment(b)
+	cm := NewLocalChunkManager(objectstorage.RootPath("/"))
+	for _, policy := range []ReadPolicy{{MaxSpan: 1}, {MaxGap: 1 << 10, MaxSpan: 8 << 20}, {MaxGap: 1 << 20}} {
+		b.Run(fmt.Sprintf("gap=%d,span=%d", policy.MaxGap, policy.MaxSpan), func(b *testing.B) {
+			var stats ReadStats
+			for i := 0; i < b.N; i++ {
+				var err error
+				if _, stats, err = PlanPackedReads(ctx, cm, paths, policy); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(stats.Requests), "requests")
+			b.ReportMetric(float64(stats.Ranges)/float64(stats.Requests), "ranges/request")
+			b.ReportMetric(float64(stats.WastedBytes), "wasted-bytes")
+		})
+	}
+}
@@ -0,0 +1,335 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// RecordToFieldData converts rec, a record of the fields of schema, into the columnar
+// protobuf field data of query results, without going through the per row values of the
+// deserializers. The fields missing from rec, e.g. projected out, are left out. The field
+// data copy the data of rec and stay valid once it is released: the numbers, strings and
+// dense vectors are copied once straight from the typed arrow buffers, the values of the
+// other types are deserialized as by the deserializers.
+//
+// The nulls of scalar fields hold the zero value in the data and are flagged in ValidData,
+// the nulls of vector fields are left out of the data, whose rows are those flagged valid.
+// As with the deserializers, the nulls of fields with a default value read as the default.
+func RecordToFieldData(rec Record, schema *schemapb.CollectionSchema) ([]*schemapb.FieldData, error) {
+	var result []*schemapb.FieldData
+	for _, field := range typeutil.GetAllFieldSchemas(schema) {
+		col := rec.Column(field.GetFieldID())
+		if col == nil {
+			continue
+		}
+		fieldData, err := columnToFieldData(field, col)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fieldData)
+	}
+	return result, nil
+}
+
+// columnValues returns the values of col, the column of field, as values of type T, the
+// zero value for the nulls, and the validity of every row, deserializing every value as
+// the deserializers do. It reads the columns of the types without typed values below.
+func columnValues[T any](field *schemapb.FieldSchema, col arrow.Array) ([]T, []bool, error) {
+	entry, ok := lookupSerdeEntry(field)
+	if !ok {
+		return nil, nil, merr.WrapErrServiceInternal(fmt.Sprintf("unexpected type %s", field.GetDataType()))
+	}
+	dim := 0
+	if typeutil.IsVectorType(field.GetDataType()) {
+		d, _ := typeutil.GetDim(field)
+		dim = int(d)
+	}
+	values := make([]T, col.Len())
+	valid := make([]bool, col.Len())
+	for i := range values {
+		var d any
+		if col.IsNull(i) {
+			if field.GetDefaultValue() == nil {
+				continue
+			}
+			d = GetDefaultValue(field)
+		} else if d, ok = entry.deserialize(col, i, field.GetElementType(), dim, true); !ok {
+			return nil, nil, merr.WrapErrServiceInternal(fmt.Sprintf("deserialize field %d of type %s at row %d failed",
+				field.GetFieldID(), field.GetDataType(), i))
+		}
+		v, ok := d.(T)
+		if !ok {
+			return nil, nil, merr.WrapErrServiceInternal(fmt.Sprintf("unexpected value %T of field %d of type %s",
+				d, field.GetFieldID(), field.GetDataType()))
+		}
+		values[i], valid[i] = v, true
+	}
+	return values, valid, nil
+}
+
+// typedValues returns the values of col, the column of field, read from the arrow array A
+// of values V and converted to T, the nulls taking the default value of field or the zero
+// value, and the validity of every row. The values are copied straight from the buffers
+// of col, without boxing them. It returns false if col is not an A.
+func typedValues[A interface{ Value(int) V }, V, T any](field *schemapb.FieldSchema, col arrow.Array, convert func(V) T) ([]T, []bool, bool) {
+	typed, ok := col.(A)
+	if !ok {
+		return nil, nil, false
+	}
+	var def T
+	hasDefault := false
+	if field.GetDefaultValue() != nil {
+		var v V
+		if v, hasDefault = GetDefaultValue(field).(V); hasDefault {
+			def = convert(v)
+		}
+	}
+	values := make([]T, col.Len())
+	valid := make([]bool, col.Len())
+	for i := range values {
+		if col.IsNull(i) {
+			if hasDefault {
+				values[i], valid[i] = def, true
+			}
+			continue
+		}
+		values[i], valid[i] = convert(typed.Value(i)), true
+	}
+	return values, valid, true
+}
+
+// scalarValues returns the values of col, the column of field, as typedValues does for
+// the arrow array A, falling back to columnValues for the columns of other arrays, such as
+// dictionary-encoded ones.
+func scalarValues[A interface{ Value(int) V }, V, T any](field *schemapb.FieldSchema, col arrow.Array, convert func(V) T) ([]T, []bool, error) {
+	if values, valid, ok := typedValues[A](field, col, convert); ok {
+		return values, valid, nil
+	}
+	values, valid, err := columnValues[V](field, col)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lo.Map(values, func(v V, _ int) T { return convert(v) }), valid, nil
+}
+
+func identity[T any](v T) T {
+	return v
+}
+
+// scalarFieldData returns the field data of the values of a scalar field.
+func scalarFieldData[T any](field *schemapb.FieldSchema, values []T, valid []bool, err error, wrap func([]T) *schemapb.ScalarField) (*schemapb.FieldData, error) {
+	if err != nil {
+		return nil, err
+	}
+	fieldData := &schemapb.FieldData{
+		Type:      field.GetDataType(),
+		FieldName: field.GetName(),
+		FieldId:   field.GetFieldID(),
+		Field:     &schemapb.FieldData_Scalars{Scalars: wrap(values)},
+	}
+	if field.GetNullable() {
+		fieldData.ValidData = valid
+	}
+	return fieldData, nil
+}
+
+// vectorFieldData returns the field data of the vectors of a vector field, the nulls left
+// out of the data.
+func vectorFieldData(field *schemapb.FieldSchema, vectors *schemapb.VectorField, valid []bool) *schemapb.FieldData {
+	fieldData := &schemapb.FieldData{
+		Type:      field.GetDataType(),
+		FieldName: field.GetName(),
+		FieldId:   field.GetFieldID(),
+		Field:     &schemapb.FieldData_Vectors{Vectors: vectors},
+	}
+	if field.GetNullable() {
+		fieldData.ValidData = valid
+	}
+	return fieldData
+}
+
+// denseVectorFieldData returns the field data of a dense vector field of col, whose rows
+// are width bytes, copying the bytes of the rows not null straight into the buffer dst
+// returns for the rows, without boxing any row.
+func denseVectorFieldData(field *schemapb.FieldSchema, col arrow.Array, width int, dst func(rows int) []byte,
+	wrap func() *schemapb.VectorField,
+) (*schemapb.FieldData, error) {
+	valid := make([]bool, col.Len())
+	data := dst(col.Len() - col.NullN())
+	offset := 0
+	for i := range valid {
+		if col.IsNull(i) {
+			continue
+		}
+		row, ok := fixedSizeVectorBytes(col, i)
+		if !ok || len(row) != width {
+			return nil, merr.WrapErrServiceInternal(fmt.Sprintf("deserialize field %d of type %s at row %d failed",
+				field.GetFieldID(), field.GetDataType(), i))
+		}
+		offset += copy(data[offset:], row)
+		valid[i] = true
+	}
+	vectors := wrap()
+	vectors.Dim, _ = typeutil.GetDim(field)
+	return vectorFieldData(field, vectors, valid), nil
+}
+
+func columnToFieldData(field *schemapb.FieldSchema, col arrow.Array) (*schemapb.FieldData, error) {
+	dim, _ := typeutil.GetDim(field)
+	switch field.GetDataType() {
+	case schemapb.DataType_Bool:
+		values, valid, err := scalarValues[*array.Boolean](field, col, identity[bool])
+		return scalarFieldData(field, values, valid, err, func(v []bool) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_BoolData{BoolData: &schemapb.BoolArray{Data: v}}}
+		})
+	case schemapb.DataType_Int8:
+		values, valid, err := scalarValues[*array.Int8](field, col, func(v int8) int32 { return int32(v) })
+		return scalarFieldData(field, values, valid, err, func(v []int32) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_IntData{IntData: &schemapb.IntArray{Data: v}}}
+		})
+	case schemapb.DataType_Int16:
+		values, valid, err := scalarValues[*array.Int16](field, col, func(v int16) int32 { return int32(v) })
+		return scalarFieldData(field, values, valid, err, func(v []int32) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_IntData{IntData: &schemapb.IntArray{Data: v}}}
+		})
+	case schemapb.DataType_Int32:
+		values, valid, err := scalarValues[*array.Int32](field, col, identity[int32])
+		return scalarFieldData(field, values, valid, err, func(v []int32) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_IntData{IntData: &schemapb.IntArray{Data: v}}}
+		})
+	case schemapb.DataType_Int64:
+		values, valid, err := scalarValues[*array.Int64](field, col, identity[int64])
+		return scalarFieldData(field, values, valid, err, func(v []int64) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_LongData{LongData: &schemapb.LongArray{Data: v}}}
+		})
+	case schemapb.DataType_Float:
+		values, valid, err := scalarValues[*array.Float32](field, col, identity[float32])
+		return scalarFieldData(field, values, valid, err, func(v []float32) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_FloatData{FloatData: &schemapb.FloatArray{Data: v}}}
+		})
+	case schemapb.DataType_Double:
+		values, valid, err := scalarValues[*array.Float64](field, col, identity[float64])
+		return scalarFieldData(field, values, valid, err, func(v []float64) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_DoubleData{DoubleData: &schemapb.DoubleArray{Data: v}}}
+		})
+	case schemapb.DataType_Timestamptz:
+		values, valid, err := scalarValues[*array.Int64](field, col, identity[int64])
+		return scalarFieldData(field, values, valid, err, func(v []int64) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_TimestamptzData{TimestamptzData: &schemapb.TimestamptzArray{Data: v}}}
+		})
+	case schemapb.DataType_VarChar, schemapb.DataType_String, schemapb.DataType_Text:
+		// the strings of the arrays share the buffers of col
+		values, valid, ok := typedValues[*array.LargeString](field, col, strings.Clone)
+		var err error
+		if !ok {
+			values, valid, err = scalarValues[*array.String](field, col, strings.Clone)
+		}
+		return scalarFieldData(field, values, valid, err, func(v []string) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_StringData{StringData: &schemapb.StringArray{Data: v}}}
+		})
+	case schemapb.DataType_JSON:
+		values, valid, err := columnValues[[]byte](field, col)
+		return scalarFieldData(field, values, valid, err, func(v [][]byte) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_JsonData{JsonData: &schemapb.JSONArray{Data: v}}}
+		})
+	case schemapb.DataType_Geometry:
+		values, valid, err := columnValues[[]byte](field, col)
+		return scalarFieldData(field, values, valid, err, func(v [][]byte) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_GeometryData{GeometryData: &schemapb.GeometryArray{Data: v}}}
+		})
+	case schemapb.DataType_Array:
+		values, valid, err := columnValues[*schemapb.ScalarField](field, col)
+		return scalarFieldData(field, values, valid, err, func(v []*schemapb.ScalarField) *schemapb.ScalarField {
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_ArrayData{ArrayData: &schemapb.ArrayArray{
+				Data:        v,
+				ElementType: field.GetElementType(),
+			}}}
+		})
+	case schemapb.DataType_FloatVector:
+		var data []float32
+		return denseVectorFieldData(field, col, int(dim)*4, func(rows int) []byte {
+			data = make([]float32, rows*int(dim))
+			return arrow.Float32Traits.CastToBytes(data)
+		}, func() *schemapb.VectorField {
+			return &schemapb.VectorField{Data: &schemapb.VectorField_FloatVector{FloatVector: &schemapb.FloatArray{Data: data}}}
+		})
+	case schemapb.DataType_BinaryVector, schemapb.DataType_Float16Vector, schemapb.DataType_BFloat16Vector, schemapb.DataType_Int8Vector:
+		width := map[schemapb.DataType]int{
+			schemapb.DataType_BinaryVector:   int(dim) / 8,
+			schemapb.DataType_Float16Vector:  int(dim) * 2,
+			schemapb.DataType_BFloat16Vector: int(dim) * 2,
+			schemapb.DataType_Int8Vector:     int(dim),
+		}[field.GetDataType()]
+		var data []byte
+		return denseVectorFieldData(field, col, width, func(rows int) []byte {
+			data = make([]byte, rows*width)
+			return data
+		}, func() *schemapb.VectorField {
+			switch field.GetDataType() {
+			case schemapb.DataType_BinaryVector:
+				return &schemapb.VectorField{Data: &schemapb.VectorField_BinaryVector{BinaryVector: data}}
+			case schemapb.DataType_Float16Vector:
+				return &schemapb.VectorField{Data: &schemapb.VectorField_Float16Vector{Float16Vector: data}}
+			case schemapb.DataType_BFloat16Vector:
+				return &schemapb.VectorField{Data: &schemapb.VectorField_Bfloat16Vector{Bfloat16Vector: data}}
+			default:
+				return &schemapb.VectorField{Data: &schemapb.VectorField_Int8Vector{Int8Vector: data}}
+			}
+		})
+	case schemapb.DataType_SparseFloatVector:
+		rows, valid, err := columnValues[[]byte](field, col)
+		if err != nil {
+			return nil, err
+		}
+		rows = lo.Filter(rows, func(_ []byte, i int) bool { return valid[i] })
+		sparse := &schemapb.SparseFloatArray{Contents: rows}
+		for _, row := range rows {
+			sparse.Dim = max(sparse.Dim, typeutil.SparseFloatRowDim(row))
+		}
+		// sparse vectors have no dim in their schema, the field data takes the one of the rows
+		return vectorFieldData(field, &schemapb.VectorField{
+			Dim:  sparse.GetDim(),
+			Data: &schemapb.VectorField_SparseFloatVector{SparseFloatVector: sparse},
+		}, valid), nil
+	case schemapb.DataType_ArrayOfVector:
+		rows, valid, err := columnValues[*schemapb.VectorField](field, col)
+		if err != nil {
+			return nil, err
+		}
+		rows = lo.Filter(rows, func(_ *schemapb.VectorField, i int) bool { return valid[i] })
+		return vectorFieldData(field, &schemapb.VectorField{
+			Dim: dim,
+			Data: &schemapb.VectorField_VectorArray{VectorArray: &schemapb.VectorArray{
+				Data:        rows,
+				ElementType: field.GetElementType(),
+				Dim:         dim,
+			}},
+		}, valid), nil
+	default:
+		return nil, merr.WrapErrServiceInternal(fmt.Sprintf("unsupported type %s of field %d", field.GetDataType(), field.GetFieldID()))
+	}
+}
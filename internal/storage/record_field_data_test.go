@@ -0,0 +1,112 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+)
+
+func TestRecordToFieldData(t *testing.T) {
+	t.Run("all types", func(t *testing.T) {
+		schema := generateTestSchema()
+		blobs, err := generateTestData(5)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		rec, err := ValueSerializer(values, schema)
+		require.NoError(t, err)
+		defer rec.Release()
+
+		fieldsData, err := RecordToFieldData(rec, schema)
+		require.NoError(t, err)
+		require.Len(t, fieldsData, len(schema.Fields))
+		byID := lo.SliceToMap(fieldsData, func(fd *schemapb.FieldData) (FieldID, *schemapb.FieldData) { return fd.GetFieldId(), fd })
+		column := func(fieldID FieldID) []any {
+			return lo.Map(values, func(v *Value, _ int) any { return v.Value.(map[FieldID]any)[fieldID] })
+		}
+		assert.Equal(t, column(13), lo.ToAnySlice(byID[13].GetScalars().GetLongData().GetData()))
+		assert.Equal(t, column(16), lo.ToAnySlice(byID[16].GetScalars().GetStringData().GetData()))
+		assert.Equal(t, column(101), lo.ToAnySlice(byID[101].GetScalars().GetIntData().GetData()))
+		assert.Equal(t, column(10), lo.ToAnySlice(byID[10].GetScalars().GetBoolData().GetData()))
+		assert.Equal(t, lo.Map(column(11), func(v any, _ int) int32 { return int32(v.(int8)) }), byID[11].GetScalars().GetIntData().GetData())
+		assert.Equal(t, lo.Flatten(lo.Map(column(102), func(v any, _ int) []float32 { return v.([]float32) })),
+			byID[102].GetVectors().GetFloatVector().GetData())
+		assert.Equal(t, int64(8), byID[102].GetVectors().GetDim())
+		assert.Equal(t, schemapb.DataType_FloatVector, byID[102].GetType())
+		assert.Equal(t, lo.Flatten(lo.Map(column(103), func(v any, _ int) []byte { return v.([]byte) })),
+			byID[103].GetVectors().GetBinaryVector())
+		assert.Equal(t, lo.Flatten(lo.Map(column(104), func(v any, _ int) []byte { return v.([]byte) })),
+			byID[104].GetVectors().GetFloat16Vector())
+		assert.Equal(t, column(14), lo.ToAnySlice(byID[14].GetScalars().GetFloatData().GetData()))
+		assert.Nil(t, byID[13].GetValidData())
+	})
+
+	t.Run("large strings", func(t *testing.T) {
+		paths := []string{"/tmp/record_field_data/0"}
+		writePackedTestSegment(t, paths, 5, WithLargeStringColumns())
+		schema := generateTestSchema()
+		readStrings := func(opts ...PackedReaderOption) []string {
+			reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, opts...)
+			require.NoError(t, err)
+			defer reader.Close()
+			rec, err := reader.Next()
+			require.NoError(t, err)
+			fieldsData, err := RecordToFieldData(rec, schema)
+			require.NoError(t, err)
+			byID := lo.SliceToMap(fieldsData, func(fd *schemapb.FieldData) (FieldID, *schemapb.FieldData) { return fd.GetFieldId(), fd })
+			return byID[16].GetScalars().GetStringData().GetData()
+		}
+		assert.Equal(t, []string{"1", "2", "3", "4", "5"}, readStrings(WithLargeStringReads()))
+	})
+
+	t.Run("nulls", func(t *testing.T) {
+		schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "int", DataType: schemapb.DataType_Int64, Nullable: true},
+			{FieldID: 101, Name: "vec", DataType: schemapb.DataType_FloatVector, Nullable: true, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+			{FieldID: 102, Name: "defaulted", DataType: schemapb.DataType_Int32, Nullable: true,
+				DefaultValue: &schemapb.ValueField{Data: &schemapb.ValueField_IntData{IntData: 7}}},
+		}}
+		rec, err := ValueSerializer([]*Value{
+			{Value: map[FieldID]any{common.RowIDField: int64(1), common.TimeStampField: int64(1), 100: int64(5), 101: nil, 102: nil}},
+			{Value: map[FieldID]any{common.RowIDField: int64(2), common.TimeStampField: int64(1), 100: nil, 101: []float32{1, 2}, 102: int32(3)}},
+		}, schema)
+		require.NoError(t, err)
+		defer rec.Release()
+
+		fieldsData, err := RecordToFieldData(rec, schema)
+		require.NoError(t, err)
+		require.Len(t, fieldsData, 5)
+		assert.Equal(t, []int64{5, 0}, fieldsData[2].GetScalars().GetLongData().GetData())
+		assert.Equal(t, []bool{true, false}, fieldsData[2].GetValidData())
+		assert.Equal(t, []float32{1, 2}, fieldsData[3].GetVectors().GetFloatVector().GetData())
+		assert.Equal(t, []bool{false, true}, fieldsData[3].GetValidData())
+		assert.Equal(t, []int32{7, 3}, fieldsData[4].GetScalars().GetIntData().GetData())
+		assert.Equal(t, []bool{true, true}, fieldsData[4].GetValidData())
+	})
+}
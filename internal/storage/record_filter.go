@@ -0,0 +1,353 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// FilterExpr is a row filter evaluated over the columns of a record at once, built with
+// FilterCompare, FilterAnd and FilterOr.
+type FilterExpr interface {
+	// eval returns the selection of the rows of rec matching the expression.
+	eval(rec Record) ([]bool, error)
+	// fieldIDs returns the fields the expression reads.
+	fieldIDs() []FieldID
+}
+
+// CompareOp is the operator of a FilterCompare expression.
+type CompareOp int
+
+const (
+	CompareEQ CompareOp = iota
+	CompareNE
+	CompareLT
+	CompareLE
+	CompareGT
+	CompareGE
+)
+
+func (op CompareOp) String() string {
+	switch op {
+	case CompareEQ:
+		return "=="
+	case CompareNE:
+		return "!="
+	case CompareLT:
+		return "<"
+	case CompareLE:
+		return "<="
+	case CompareGT:
+		return ">"
+	case CompareGE:
+		return ">="
+	}
+	return fmt.Sprintf("CompareOp(%d)", int(op))
+}
+
+// FilterCompare matches the rows whose value of field fieldID compares with op to value.
+// value is an int64 for the integer fields, a float64 for the float fields, a string for
+// the string fields and a bool for the bool fields, which only support CompareEQ and
+// CompareNE. Nulls match no comparison.
+func FilterCompare(fieldID FieldID, op CompareOp, value any) FilterExpr {
+	return &compareExpr{fieldID: fieldID, op: op, value: value}
+}
+
+// FilterAnd matches the rows matching all of exprs, and every row without exprs.
+func FilterAnd(exprs ...FilterExpr) FilterExpr {
+	return &logicalExpr{and: true, exprs: exprs}
+}
+
+// FilterOr matches the rows matching any of exprs, and no row without exprs.
+func FilterOr(exprs ...FilterExpr) FilterExpr {
+	return &logicalExpr{and: false, exprs: exprs}
+}
+
+type logicalExpr struct {
+	and   bool
+	exprs []FilterExpr
+}
+
+func (e *logicalExpr) fieldIDs() []FieldID {
+	var fieldIDs []FieldID
+	for _, expr := range e.exprs {
+		fieldIDs = append(fieldIDs, expr.fieldIDs()...)
+	}
+	return lo.Uniq(fieldIDs)
+}
+
+func (e *logicalExpr) eval(rec Record) ([]bool, error) {
+	selection := make([]bool, rec.Len())
+	for i := range selection {
+		selection[i] = e.and
+	}
+	for _, expr := range e.exprs {
+		selected, err := expr.eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		for i := range selection {
+			if e.and {
+				selection[i] = selection[i] && selected[i]
+			} else {
+				selection[i] = selection[i] || selected[i]
+			}
+		}
+	}
+	return selection, nil
+}
+
+type compareExpr struct {
+	fieldID FieldID
+	op      CompareOp
+	value   any
+}
+
+func (e *compareExpr) fieldIDs() []FieldID {
+	return []FieldID{e.fieldID}
+}
+
+func (e *compareExpr) eval(rec Record) ([]bool, error) {
+	col := rec.Column(e.fieldID)
+	if col == nil {
+		return nil, merr.WrapErrFieldNotFound(e.fieldID)
+	}
+	switch col := col.(type) {
+	case *array.Int8:
+		return compareInts(e, col, col.Int8Values())
+	case *array.Int16:
+		return compareInts(e, col, col.Int16Values())
+	case *array.Int32:
+		return compareInts(e, col, col.Int32Values())
+	case *array.Int64:
+		return compareInts(e, col, col.Int64Values())
+	case *array.Float32:
+		return compareFloats(e, col, col.Float32Values())
+	case *array.Float64:
+		return compareFloats(e, col, col.Float64Values())
+	case *array.String:
+		return compareStrings(e, col)
+	case *array.LargeString:
+		return compareStrings(e, col)
+	case *array.Boolean:
+		target, ok := e.value.(bool)
+		if !ok || (e.op != CompareEQ && e.op != CompareNE) {
+			return nil, e.invalid(col)
+		}
+		selection := make([]bool, col.Len())
+		for i := range selection {
+			selection[i] = col.IsValid(i) && (col.Value(i) == target) == (e.op == CompareEQ)
+		}
+		return selection, nil
+	default:
+		return nil, e.invalid(col)
+	}
+}
+
+func (e *compareExpr) invalid(col arrow.Array) error {
+	return merr.WrapErrParameterInvalidMsg("cannot compare field %d of type %s with %s %v", e.fieldID, col.DataType(), e.op, e.value)
+}
+
+func compareInts[T int8 | int16 | int32 | int64](e *compareExpr, col arrow.Array, values []T) ([]bool, error) {
+	target, ok := e.value.(int64)
+	if !ok {
+		return nil, e.invalid(col)
+	}
+	return compareValues(e, col, values, func(v T) int64 { return int64(v) }, target)
+}
+
+func compareFloats[T float32 | float64](e *compareExpr, col arrow.Array, values []T) ([]bool, error) {
+	target, ok := e.value.(float64)
+	if !ok {
+		return nil, e.invalid(col)
+	}
+	return compareValues(e, col, values, func(v T) float64 { return float64(v) }, target)
+}
+
+func compareStrings(e *compareExpr, col orderedColumn[string]) ([]bool, error) {
+	target, ok := e.value.(string)
+	if !ok {
+		return nil, e.invalid(col)
+	}
+	values := make([]string, col.Len())
+	for i := range values {
+		values[i] = col.Value(i)
+	}
+	return compareValues(e, col, values, func(v string) string { return v }, target)
+}
+
+// compareValues compares values, the values of col, converted by conv to target.
+func compareValues[T any, V cmp.Ordered](e *compareExpr, col arrow.Array, values []T, conv func(T) V, target V) ([]bool, error) {
+	var match func(v V) bool
+	switch e.op {
+	case CompareEQ:
+		match = func(v V) bool { return v == target }
+	case CompareNE:
+		match = func(v V) bool { return v != target }
+	case CompareLT:
+		match = func(v V) bool { return v < target }
+	case CompareLE:
+		match = func(v V) bool { return v <= target }
+	case CompareGT:
+		match = func(v V) bool { return v > target }
+	case CompareGE:
+		match = func(v V) bool { return v >= target }
+	default:
+		return nil, e.invalid(col)
+	}
+	selection := make([]bool, len(values))
+	for i, v := range values {
+		selection[i] = match(conv(v))
+	}
+	if col.NullN() > 0 {
+		for i := range selection {
+			selection[i] = selection[i] && col.IsValid(i)
+		}
+	}
+	return selection, nil
+}
+
+// NewPackedDeserializeReaderExpr is NewPackedDeserializeReader returning only the rows
+// matching expr. expr is evaluated over the columns of every batch read, and only the
+// matching rows are materialized into values.
+func NewPackedDeserializeReaderExpr(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, expr FilterExpr, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	if err := rejectPartialUpdates(opts); err != nil {
+		return nil, err
+	}
+	fields := typeutil.GetAllFieldSchemas(schema)
+	reader := newFilterRecordReader(newIterativePackedRecordReader(paths, schema, bufferSize, nil, nil), fields, newExprFilter(expr, fields))
+	return NewDeserializeReader(reader, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, shouldCopy, opts...)
+	}), nil
+}
+
+// NewPackedSelectiveDeserializeReader is NewPackedDeserializeReaderExpr for a chunk whose
+// column groups columnGroups are stored in separate files at paths, for filtered queries
+// whose predicate reads small scalar groups and whose payload lives in large vector
+// groups. The group holding the fields of expr, the smallest file of them if expr reads
+// several groups, drives the read and expr is evaluated over it first. The other groups
+// are read by a lazy reader, see NewLazyPackedRecordReader, only for the records holding
+// matching rows: a payload group is never opened if no row of the chunk matches, and is
+// not read past the last record holding a match. The packed reader cannot seek, so the
+// records of a payload group between two matching records are still decoded to catch up.
+func NewPackedSelectiveDeserializeReader(paths []string, columnGroups []storagecommon.ColumnGroup,
+	schema *schemapb.CollectionSchema, bufferSize int64, expr FilterExpr, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	if err := rejectPartialUpdates(opts); err != nil {
+		return nil, err
+	}
+	if len(paths) != len(columnGroups) {
+		return nil, merr.WrapErrParameterInvalid(len(columnGroups), len(paths), "paths length is not equal to column groups length for selective packed reader")
+	}
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := newLazyColumnGroups(paths, columnGroups, schema, bufferSize, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the predicate group of the smallest file drives the read, the primary key group
+	// without predicate fields
+	field2Group := make(map[FieldID]int)
+	for i, group := range groups {
+		for _, field := range group.fields {
+			field2Group[field.GetFieldID()] = i
+		}
+	}
+	anchor, anchorSize := pkField.GetFieldID(), int64(-1)
+	for _, fieldID := range expr.fieldIDs() {
+		g, ok := field2Group[fieldID]
+		if !ok {
+			return nil, merr.WrapErrFieldNotFound(fieldID)
+		}
+		size, err := packed.GetFileSize(paths[g], nil)
+		if err != nil {
+			return nil, err
+		}
+		if anchorSize < 0 || size < anchorSize {
+			anchor, anchorSize = fieldID, size
+		}
+	}
+	lazy, err := newLazyRecordReader(groups, anchor)
+	if err != nil {
+		return nil, err
+	}
+	fields := typeutil.GetAllFieldSchemas(schema)
+	reader := newFilterRecordReader(lazy, fields, newExprFilter(expr, fields))
+	return NewDeserializeReader(reader, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, shouldCopy, opts...)
+	}), nil
+}
+
+// exprFilter keeps the rows matching expr.
+type exprFilter struct {
+	expr FilterExpr
+	// fieldIDs are the fields of the records kept, loaded of the lazy records holding a
+	// match.
+	fieldIDs []FieldID
+}
+
+func newExprFilter(expr FilterExpr, fields []*schemapb.FieldSchema) *exprFilter {
+	return &exprFilter{
+		expr:     expr,
+		fieldIDs: lo.Map(fields, func(f *schemapb.FieldSchema, _ int) FieldID { return f.GetFieldID() }),
+	}
+}
+
+func (ef *exprFilter) done() bool {
+	return false
+}
+
+func (ef *exprFilter) keepRows(rec Record) ([]bool, int, error) {
+	// lazy records report the decode failures when loaded, Column returns nil on them
+	lazy, _ := rec.(*lazyRecord)
+	if lazy != nil {
+		if err := lazy.Load(ef.expr.fieldIDs()...); err != nil {
+			return nil, 0, err
+		}
+	}
+	keep, err := ef.expr.eval(rec)
+	if err != nil {
+		return nil, 0, err
+	}
+	kept := 0
+	for _, k := range keep {
+		if k {
+			kept++
+		}
+	}
+	if kept > 0 && lazy != nil {
+		if err := lazy.Load(ef.fieldIDs...); err != nil {
+			return nil, 0, err
+		}
+	}
+	return keep, kept, nil
+}
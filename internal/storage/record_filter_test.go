@@ -0,0 +1,130 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+func TestPackedDeserializeReaderExpr(t *testing.T) {
+	size := 20
+	paths := []string{"/tmp/expr_filter/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	read := func(expr FilterExpr) ([]int64, error) {
+		reader, err := NewPackedDeserializeReaderExpr([][]string{paths}, schema, 10*1024*1024, expr, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		return lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }), err
+	}
+	readPKs := func(expr FilterExpr) []int64 {
+		pks, err := read(expr)
+		require.NoError(t, err)
+		return pks
+	}
+
+	// every scalar field holds the primary key of the row
+	assert.Equal(t, []int64{3}, readPKs(FilterCompare(13, CompareEQ, int64(3))))
+	assert.Len(t, readPKs(FilterCompare(13, CompareNE, int64(3))), size-1)
+	assert.Equal(t, []int64{1, 2}, readPKs(FilterCompare(11, CompareLT, int64(3))))
+	assert.Equal(t, []int64{1, 2, 3}, readPKs(FilterCompare(12, CompareLE, int64(3))))
+	assert.Equal(t, []int64{19, 20}, readPKs(FilterCompare(101, CompareGT, int64(18))))
+	assert.Equal(t, []int64{18, 19, 20}, readPKs(FilterCompare(15, CompareGE, float64(18))))
+	assert.Equal(t, []int64{1, 10, 11}, readPKs(FilterCompare(16, CompareLT, "12")))
+	assert.Len(t, readPKs(FilterCompare(10, CompareEQ, true)), size)
+	assert.Empty(t, readPKs(FilterCompare(13, CompareGT, int64(1000))))
+
+	// 5 <= x < 8 or x == 15, and not the row 6
+	expr := FilterAnd(
+		FilterOr(
+			FilterAnd(FilterCompare(13, CompareGE, int64(5)), FilterCompare(14, CompareLT, float64(8))),
+			FilterCompare(17, CompareEQ, "15"),
+		),
+		FilterCompare(1, CompareNE, int64(6)),
+	)
+	assert.Equal(t, []int64{5, 7, 15}, readPKs(expr))
+	assert.Len(t, readPKs(FilterAnd()), size)
+	assert.Empty(t, readPKs(FilterOr()))
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := read(FilterCompare(13, CompareEQ, "3"))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = read(FilterCompare(10, CompareLT, true))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = read(FilterCompare(19, CompareEQ, int64(1)))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = read(FilterCompare(999, CompareEQ, int64(1)))
+		assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+	})
+}
+
+func TestPackedSelectiveDeserializeReader(t *testing.T) {
+	size := 30
+	schema := generateTestSchema()
+	// the scalars in one group, the vectors in another
+	groups := []storagecommon.ColumnGroup{{GroupID: 0}, {GroupID: 1}}
+	for i, field := range schema.Fields {
+		if typeutil.IsVectorType(field.GetDataType()) {
+			groups[1].Columns = append(groups[1].Columns, i)
+		} else {
+			groups[0].Columns = append(groups[0].Columns, i)
+		}
+	}
+	paths := []string{"/tmp/selective_reader/0", "/tmp/selective_reader/1"}
+	writePackedTestSegmentWithGroups(t, paths, groups, size)
+
+	read := func(expr FilterExpr) ([]*Value, error) {
+		reader, err := NewPackedSelectiveDeserializeReader(paths, groups, schema, 1024, expr, true)
+		if err != nil {
+			return nil, err
+		}
+		return ReadAllValues(reader)
+	}
+	for _, expr := range []FilterExpr{
+		FilterCompare(13, CompareEQ, int64(3)),
+		FilterCompare(13, CompareGT, int64(25)),
+		FilterOr(FilterCompare(11, CompareLT, int64(3)), FilterCompare(16, CompareEQ, "20")),
+		FilterCompare(13, CompareGT, int64(1000)),
+		FilterAnd(),
+	} {
+		expected, err := NewPackedDeserializeReaderExpr([][]string{paths}, schema, 1024, expr, true)
+		require.NoError(t, err)
+		expectedValues, err := ReadAllValues(expected)
+		require.NoError(t, err)
+		values, err := read(expr)
+		require.NoError(t, err)
+		require.Equal(t, len(expectedValues), len(values))
+		for i := range values {
+			assert.Equal(t, expectedValues[i].PK, values[i].PK)
+			assert.Equal(t, expectedValues[i].Value, values[i].Value)
+		}
+	}
+
+	_, err := read(FilterCompare(999, CompareEQ, int64(1)))
+	assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+	_, err = NewPackedSelectiveDeserializeReader(paths[:1], groups, schema, 1024, FilterAnd(), true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
@@ -0,0 +1,164 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/ipc"
+	"github.com/cockroachdb/errors"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// ipcEOS is the end-of-stream marker closing an arrow IPC stream.
+var ipcEOS = []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}
+
+// WriteRecordsToIPC drains reader and closes it, writing its records to w in the arrow
+// IPC stream format, e.g. to transfer segment data to another node without converting
+// it to values. The stream schema is the arrow schema of schema with the field ids as
+// names. It returns the number of rows written. The end-of-stream marker is only
+// written once all records are, so that ReadRecordsFromIPC detects a partial stream.
+func WriteRecordsToIPC(reader RecordReader, w io.Writer, schema *schemapb.CollectionSchema) (int64, error) {
+	defer reader.Close()
+	arrowSchema, err := ConvertToArrowSchema(schema, true)
+	if err != nil {
+		return 0, err
+	}
+	allFields := typeutil.GetAllFieldSchemas(schema)
+	writer := ipc.NewWriter(w, ipc.WithSchema(arrowSchema))
+
+	var rows int64
+	for {
+		r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		arrays := make([]arrow.Array, len(allFields))
+		for i, field := range allFields {
+			arrays[i] = r.Column(field.GetFieldID())
+			if arrays[i] == nil {
+				return rows, merr.WrapErrFieldNotFound(field.GetFieldID(), "field missing in record to stream")
+			}
+		}
+		rec := array.NewRecord(arrowSchema, arrays, int64(r.Len()))
+		err = writer.Write(rec)
+		rec.Release()
+		if err != nil {
+			return rows, merr.WrapErrIoFailedReason(err.Error())
+		}
+		rows += int64(r.Len())
+	}
+	if err := writer.Close(); err != nil {
+		return rows, merr.WrapErrIoFailedReason(err.Error())
+	}
+	return rows, nil
+}
+
+// ReadRecordsFromIPC reads the records of an arrow IPC stream written by
+// WriteRecordsToIPC. The stream schema is negotiated against schema by field id, the
+// columns may come in any order but must hold the same fields with the same types. A
+// stream ending without its end-of-stream marker, e.g. of a sender failing midway,
+// fails with an unexpected EOF instead of reading as a complete stream. The records
+// returned are valid until the next call to Next.
+func ReadRecordsFromIPC(r io.Reader, schema *schemapb.CollectionSchema) (RecordReader, error) {
+	tracker := &eosTrackingReader{r: r}
+	reader, err := ipc.NewReader(tracker)
+	if err != nil {
+		if errors.IsAny(err, io.EOF, io.ErrUnexpectedEOF) {
+			return nil, merr.WrapErrIoUnexpectEOF("arrow ipc stream", err)
+		}
+		return nil, merr.WrapErrParameterInvalidMsg("read arrow ipc stream schema failed: %s", err.Error())
+	}
+	if err := CheckSchemaCompatible(reader.Schema(), schema); err != nil {
+		reader.Release()
+		return nil, err
+	}
+	field2Col := make(map[FieldID]int, reader.Schema().NumFields())
+	for i, field := range reader.Schema().Fields() {
+		value, _ := field.Metadata.GetValue(packed.ArrowFieldIdMetadataKey)
+		id, _ := strconv.ParseInt(value, 10, 64)
+		field2Col[id] = i
+	}
+	return &ipcRecordReader{reader: reader, tracker: tracker, field2Col: field2Col}, nil
+}
+
+type ipcRecordReader struct {
+	reader    *ipc.Reader
+	tracker   *eosTrackingReader
+	field2Col map[FieldID]int
+}
+
+var _ RecordReader = (*ipcRecordReader)(nil)
+
+func (ir *ipcRecordReader) Next() (Record, error) {
+	if ir.reader.Next() {
+		return NewSimpleArrowRecord(ir.reader.Record(), ir.field2Col), nil
+	}
+	if err := ir.reader.Err(); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, merr.WrapErrIoUnexpectEOF("arrow ipc stream", err)
+		}
+		return nil, merr.WrapErrIoFailedReason(err.Error())
+	}
+	if eof := ir.tracker.unexpectedEOF(); eof != nil {
+		return nil, eof
+	}
+	return nil, io.EOF
+}
+
+func (ir *ipcRecordReader) Close() error {
+	ir.reader.Release()
+	return nil
+}
+
+// eosTrackingReader remembers the last bytes read from r, the ipc reader reads a stream
+// cut between two messages as a complete one.
+type eosTrackingReader struct {
+	r    io.Reader
+	tail []byte
+}
+
+func (t *eosTrackingReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.tail = append(t.tail, p[:n]...)
+		if len(t.tail) > len(ipcEOS) {
+			t.tail = t.tail[len(t.tail)-len(ipcEOS):]
+		}
+	}
+	return n, err
+}
+
+// unexpectedEOF returns an error unless the stream read so far ends with the
+// end-of-stream marker.
+func (t *eosTrackingReader) unexpectedEOF() error {
+	if bytes.Equal(t.tail, ipcEOS) {
+		return nil
+	}
+	return merr.WrapErrIoUnexpectEOF("arrow ipc stream", io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,102 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestRecordsIPC(t *testing.T) {
+	schema := generateTestSchema()
+	stream := func(sizes ...int) []byte {
+		buf := &bytes.Buffer{}
+		rows, err := WriteRecordsToIPC(newChunkedTestReader(t, sizes...), buf, schema)
+		require.NoError(t, err)
+		total := 0
+		for _, size := range sizes {
+			total += size
+		}
+		assert.Equal(t, int64(total), rows)
+		return buf.Bytes()
+	}
+	readPKs := func(data []byte) ([]int64, error) {
+		reader, err := ReadRecordsFromIPC(bytes.NewReader(data), schema)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		var pks []int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return pks, nil
+			}
+			if err != nil {
+				return pks, err
+			}
+			pkCol := rec.Column(common.RowIDField).(*array.Int64)
+			field13 := rec.Column(13).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, pkCol.Value(i), field13.Value(i))
+				pks = append(pks, pkCol.Value(i))
+			}
+		}
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		pks, err := readPKs(stream(3, 4))
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7}, pks)
+	})
+
+	t.Run("no records", func(t *testing.T) {
+		pks, err := readPKs(stream())
+		require.NoError(t, err)
+		assert.Empty(t, pks)
+	})
+
+	t.Run("partial stream", func(t *testing.T) {
+		data := stream(3, 4)
+		// without the end-of-stream marker, i.e. cut between two messages
+		pks, err := readPKs(data[:len(data)-len(ipcEOS)])
+		assert.ErrorIs(t, err, merr.ErrIoUnexpectEOF)
+		assert.Len(t, pks, 7)
+
+		// cut within a message
+		_, err = readPKs(data[:len(data)-len(ipcEOS)-1])
+		assert.ErrorIs(t, err, merr.ErrIoUnexpectEOF)
+
+		_, err = readPKs(nil)
+		assert.ErrorIs(t, err, merr.ErrIoUnexpectEOF)
+	})
+
+	t.Run("schema mismatch", func(t *testing.T) {
+		other := generateTestSchema()
+		other.Fields = other.Fields[:len(other.Fields)-1]
+		_, err := ReadRecordsFromIPC(bytes.NewReader(stream(3)), other)
+		assert.Error(t, err)
+	})
+}
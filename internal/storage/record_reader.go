@@ -1,15 +1,22 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
 	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/log"
 	"github.com/milvus-io/milvus/pkg/v2/proto/datapb"
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
@@ -22,52 +29,566 @@ type RecordReader interface {
 	Close() error
 }
 
+// packedBatchReader reads the batches of packed files, each valid until the next read.
+type packedBatchReader interface {
+	ReadNext() (arrow.Record, error)
+	Close() error
+}
+
+// packedRecordReader reads the batches of a packed reader as records without copying them.
 type packedRecordReader struct {
-	reader    *packed.PackedReader
+	reader packedBatchReader
+	// slots are the slots of WithFileLimiter held by the files of the reader.
+	slots     *fileSlots
 	field2Col map[FieldID]int
+
+	// peeked is the batch read ahead, peekedFiltered set if put back by Next once filtered.
+	peeked         arrow.Record
+	peekedErr      error
+	peekedFiltered bool
+
+	// position is the number of rows returned, filtered or skipped so far.
+	position int64
+	// batchPerRowGroup is set if the batches read are the row groups of the files.
+	batchPerRowGroup bool
+	// rowsRead counts the rows of the batches read from firstRow on, the first row of WithRowGroupRange.
+	rowsRead int64
+	firstRow int64
+
+	// open reopens the files for SetProjection, sliced is the remainder of a batch released on the next read.
+	schema *schemapb.CollectionSchema
+	open   func(arrowSchema *arrow.Schema) (packedBatchReader, error)
+	sliced arrow.Record
+
+	largeStrings     bool
+	dictionaryFields []FieldID
+	// fingerprint is the schema fingerprint of WithSchemaFingerprintCheck, empty for none.
+	fingerprint string
+
+	ctx       context.Context
+	observer  ProgressObserver
+	mem       memory.Allocator
+	checksums *batchChecksumVerifier
+
+	readSummaries
+	recordBudget
+	rowSelection
 }
 
 var _ RecordReader = (*packedRecordReader)(nil)
 
 func (pr *packedRecordReader) Next() (Record, error) {
-	rec, err := pr.reader.ReadNext()
+	pr.dropLast()
+	if pr.peeked == nil {
+		pr.releaseSliced()
+	}
+	var rec arrow.Record
+	var err error
+	for {
+		if err := pr.checkContext(); err != nil {
+			return nil, err
+		}
+		filtered := false
+		if pr.peeked != nil || pr.peekedErr != nil {
+			rec, err, filtered = pr.peeked, pr.peekedErr, pr.peekedFiltered
+			pr.peeked, pr.peekedErr, pr.peekedFiltered = nil, nil, false
+		} else {
+			rec, err = pr.readNext()
+		}
+		if err != nil {
+			pr.eof = err == io.EOF
+			return nil, err
+		}
+		if filtered {
+			break
+		}
+		if !pr.rowsMayMatch(pr.rowsRead-rec.NumRows(), pr.rowsRead) {
+			pr.position += rec.NumRows()
+			continue
+		}
+		if !pr.filtering() {
+			break
+		}
+		if rec, err = pr.filterRows(rec); err != nil {
+			return nil, err
+		}
+		if rec != nil {
+			break
+		}
+	}
+	hook, err := pr.reserve(rec)
 	if err != nil {
+		// read again once the consumers released their records
+		pr.peeked, pr.peekedFiltered = rec, true
 		return nil, err
 	}
-	return NewSimpleArrowRecord(rec, pr.field2Col), nil
+	pr.position += rec.NumRows()
+	if pr.observer != nil {
+		pr.observer.OnRead(int(rec.NumRows()), recordDataSize(rec))
+	}
+	r := NewSimpleArrowRecord(rec, pr.field2Col)
+	r.hook = hook
+	pr.readSummaries.add(r)
+	return r, nil
 }
 
-func (pr *packedRecordReader) Close() error {
+// checkContext returns the error of the done context of WithReadContext, closing the files at once.
+func (pr *packedRecordReader) checkContext() error {
+	if pr.ctx == nil || pr.ctx.Err() == nil {
+		return nil
+	}
+	pr.peeked, pr.peekedErr, pr.peekedFiltered = nil, nil, false
 	if pr.reader != nil {
-		return pr.reader.Close()
+		if err := pr.reader.Close(); err != nil {
+			log.Warn("failed to close packed reader of canceled read", zap.Error(err))
+		}
+		pr.reader = nil
+	}
+	return merr.Combine(merr.WrapErrServiceInternal("packed read canceled"), pr.ctx.Err())
+}
+
+// readNext reads the next non-empty batch, the zero-row batch of an empty segment reading as io.EOF.
+func (pr *packedRecordReader) readNext() (arrow.Record, error) {
+	for {
+		rec, err := pr.reader.ReadNext()
+		if err == io.EOF && pr.checksums != nil {
+			if finishErr := pr.checksums.finish(); finishErr != nil {
+				return nil, finishErr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		pr.rowsRead += rec.NumRows()
+		if rec.NumRows() == 0 {
+			continue
+		}
+		if pr.checksums != nil {
+			if err := pr.checksums.verify(rec, pr.field2Col); err != nil {
+				return nil, err
+			}
+		}
+		return rec, nil
+	}
+}
+
+// SetProjection restricts the records read next to fieldIDs, reopening the files; records returned before are invalid.
+func (pr *packedRecordReader) SetProjection(fieldIDs []FieldID) error {
+	if pr.open == nil {
+		return merr.WrapErrServiceInternal("projection is not supported by this packed reader")
+	}
+	if len(fieldIDs) == 0 {
+		return merr.WrapErrParameterInvalidMsg("projection of packed reader must hold at least one field")
+	}
+	if err := pr.checkContext(); err != nil {
+		return err
+	}
+	fieldSet := typeutil.NewSet(fieldIDs...)
+	if err := pr.checkProjection(fieldSet); err != nil {
+		return err
+	}
+	if pr.tsRange != nil && !fieldSet.Contain(common.TimeStampField) {
+		return merr.WrapErrParameterInvalidMsg("projection drops the timestamp field of the timestamp range")
+	}
+	projected := projectSchema(pr.schema, fieldSet)
+	allFields := typeutil.GetAllFieldSchemas(projected)
+	for _, fieldID := range fieldIDs {
+		if !lo.ContainsBy(allFields, func(f *schemapb.FieldSchema) bool { return f.GetFieldID() == fieldID }) {
+			return merr.WrapErrFieldNotFound(fieldID)
+		}
+	}
+	arrowSchema, err := ConvertToArrowSchema(projected, true)
+	if err != nil {
+		return merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", projected.Name, err.Error())
+	}
+	if pr.largeStrings {
+		arrowSchema = largeStringSchema(arrowSchema)
+	}
+	arrowSchema = dictionarySchema(arrowSchema, projected, pr.dictionaryFields)
+	reader, err := pr.open(arrowSchema)
+	if err != nil {
+		return err
+	}
+	pr.releaseSliced()
+	pr.peeked, pr.peekedErr, pr.peekedFiltered = nil, nil, false
+	if err := pr.reader.Close(); err != nil {
+		reader.Close()
+		return err
+	}
+	pr.reader = reader
+	pr.field2Col = make(map[FieldID]int, len(allFields))
+	for i, field := range allFields {
+		pr.field2Col[field.GetFieldID()] = i
+	}
+	if pr.checksums != nil {
+		pr.checksums.reset()
+	}
+	pr.rowsRead = pr.firstRow
+
+	for skipped := int64(0); skipped < pr.position; {
+		rec, err := pr.readNext()
+		if err != nil {
+			if err == io.EOF {
+				err = merr.WrapErrServiceInternal(fmt.Sprintf("packed files hold fewer rows than the %d read before the projection", pr.position))
+			}
+			pr.peekedErr = err
+			return err
+		}
+		if rest := pr.position - skipped; rest < rec.NumRows() {
+			pr.sliced = rec.NewSlice(rest, rec.NumRows())
+			pr.peeked = pr.sliced
+		}
+		skipped += rec.NumRows()
+	}
+	return nil
+}
+
+// SkipRowGroups skips the first k row groups of a single column group file before any record is returned.
+func (pr *packedRecordReader) SkipRowGroups(k int) error {
+	switch {
+	case k < 0:
+		return merr.WrapErrParameterInvalidMsg("row groups to skip must not be negative, got %d", k)
+	case !pr.batchPerRowGroup:
+		return merr.WrapErrParameterInvalidMsg("row groups can only be skipped in a single packed file read without splitting its batches")
+	case pr.sketching():
+		return merr.WrapErrParameterInvalidMsg("row groups cannot be skipped by a reader building a skip index or distinct counts")
+	case pr.rowGroupPruning != nil:
+		return merr.WrapErrParameterInvalidMsg("row groups cannot be skipped by a reader pruning row groups")
+	case pr.position > 0 || pr.sliced != nil:
+		return merr.WrapErrParameterInvalidMsg("row groups can only be skipped before the first record is read")
+	}
+	if err := pr.checkContext(); err != nil {
+		return err
+	}
+	for skipped := 0; skipped < k; skipped++ {
+		var rec arrow.Record
+		var err error
+		if pr.peeked != nil || pr.peekedErr != nil {
+			rec, err = pr.peeked, pr.peekedErr
+			pr.peeked, pr.peekedErr, pr.peekedFiltered = nil, nil, false
+		} else {
+			rec, err = pr.readNext()
+		}
+		if err != nil {
+			pr.eof = err == io.EOF
+			return err
+		}
+		pr.position += rec.NumRows()
+	}
+	// read the row group after the skipped ones ahead, to tell the end of the files
+	if pr.peeked == nil && pr.peekedErr == nil {
+		pr.peeked, pr.peekedErr = pr.readNext()
+	}
+	if pr.peekedErr != nil {
+		pr.eof = pr.peekedErr == io.EOF
+		return pr.peekedErr
 	}
 	return nil
 }
 
+func (pr *packedRecordReader) releaseSliced() {
+	if pr.sliced != nil {
+		pr.sliced.Release()
+		pr.sliced = nil
+	}
+}
+
+// Position returns the rows returned, filtered or skipped so far, for resuming a scan.
+func (pr *packedRecordReader) Position() int64 {
+	return pr.position
+}
+
+// peek reads the first batch ahead to validate the arrow schema of the files against expected.
+func (pr *packedRecordReader) peek(paths []string, expected *arrow.Schema) error {
+	rec, err := pr.readNext()
+	if err != nil {
+		pr.peekedErr = err
+		return nil
+	}
+	if err := checkPackedFormatVersion(paths, rec.Schema()); err != nil {
+		return err
+	}
+	if err := checkPackedSerdeVersion(paths, rec.Schema()); err != nil {
+		return err
+	}
+	if pr.fingerprint != "" {
+		if err := checkSchemaFingerprint(paths, rec.Schema(), pr.fingerprint); err != nil {
+			return err
+		}
+	}
+	if diffs := diffArrowSchema(expected, rec.Schema()); len(diffs) > 0 {
+		return merr.WrapErrParameterInvalidMsg("arrow schema mismatch in packed files %v: %s", paths, strings.Join(diffs, "; "))
+	}
+	pr.peeked = rec
+	return nil
+}
+
+func (pr *packedRecordReader) Close() error {
+	pr.observer = nil
+	pr.dropLast()
+	pr.releaseSliced()
+	var err error
+	if pr.reader != nil {
+		err = pr.reader.Close()
+	}
+	// released once the files are closed, which a timed out read defers
+	pr.slots.release()
+	return err
+}
+
 func newPackedRecordReader(
 	paths []string,
 	schema *schemapb.CollectionSchema,
 	bufferSize int64,
 	storageConfig *indexpb.StorageConfig,
 	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...PackedReaderOption,
 ) (*packedRecordReader, error) {
-	arrowSchema, err := ConvertToArrowSchema(schema, true)
-	if err != nil {
-		return nil, merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", schema.Name, err.Error())
+	options := &packedReaderOptions{mem: memory.DefaultAllocator}
+	for _, opt := range opts {
+		opt(options)
+	}
+	paths = options.rewrite(paths)
+	if err := options.validate(paths); err != nil {
+		return nil, err
 	}
+	summaries := newReadSummaries(options)
+	arrowSchema := options.arrowSchema
+	if arrowSchema == nil {
+		var err error
+		if arrowSchema, err = ConvertToArrowSchema(schema, true); err != nil {
+			return nil, merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", schema.Name, err.Error())
+		}
+	}
+	if options.largeStrings {
+		arrowSchema = largeStringSchema(arrowSchema)
+	}
+	if err := checkDictionaryFields(schema, options.dictionaryFields); err != nil {
+		return nil, err
+	}
+	arrowSchema = dictionarySchema(arrowSchema, schema, options.dictionaryFields)
 	field2Col := make(map[FieldID]int)
 	allFields := typeutil.GetAllFieldSchemas(schema)
 	for i, field := range allFields {
 		field2Col[field.FieldID] = i
 	}
-	reader, err := packed.NewPackedReader(paths, arrowSchema, bufferSize, storageConfig, storagePluginContext)
+	open := newBatchReaderOpener(paths, bufferSize, storageConfig, storagePluginContext, options, summaries.readStats, summaries.alignStats)
+	ctx := options.ctx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	// the slots of all files are held at once until Close so that readers sharing a limiter never deadlock
+	slots, err := options.fileLimiter.hold(ctx, int64(len(paths)))
 	if err != nil {
 		return nil, err
 	}
-	return &packedRecordReader{
-		reader:    reader,
-		field2Col: field2Col,
-	}, nil
+	reader, err := open(arrowSchema)
+	if err != nil {
+		slots.release()
+		// name the missing column group file if that is why the reader failed to open
+		for _, p := range paths {
+			if _, sizeErr := packed.GetFileSize(p, storageConfig); sizeErr != nil {
+				return nil, merr.WrapErrIoKeyNotFound(p, fmt.Sprintf("packed column group file is missing or unreadable: %s", sizeErr.Error()))
+			}
+		}
+		return nil, err
+	}
+	pr := &packedRecordReader{
+		reader:           reader,
+		slots:            slots,
+		field2Col:        field2Col,
+		schema:           schema,
+		open:             open,
+		largeStrings:     options.largeStrings,
+		dictionaryFields: options.dictionaryFields,
+		batchPerRowGroup: len(paths) == 1 && options.maxRecordBytes <= 0,
+		ctx:              options.ctx,
+		observer:         options.observer,
+		mem:              options.mem,
+		readSummaries:    summaries,
+		recordBudget:     newRecordBudget(options.maxTotalBytes),
+		rowSelection:     rowSelection{tsRange: options.tsRange},
+	}
+	if options.fingerprint {
+		full := options.fingerprintSchema
+		if full == nil {
+			full = schema
+		}
+		pr.fingerprint = SchemaFingerprint(full)
+	}
+	rowGroupRows := func() ([]int64, error) {
+		rows, err := rowGroupNumRows(paths[0], arrowSchema, bufferSize, storageConfig, storagePluginContext)
+		if r := options.rowGroupRange; err == nil && r != nil {
+			rows = rows[r.offset : r.offset+r.count]
+		}
+		return rows, err
+	}
+	if err := pr.initSketches(schema, options, rowGroupRows); err != nil {
+		pr.Close()
+		return nil, err
+	}
+	if options.checksumCM != nil {
+		if pr.checksums, err = openChecksumVerifier(options, paths, field2Col); err != nil {
+			pr.Close()
+			return nil, err
+		}
+	}
+	if pr.firstRow, err = pr.initPruning(ctx, schema, paths, arrowSchema, field2Col, options, pr.sketching()); err != nil {
+		pr.Close()
+		return nil, err
+	}
+	pr.rowsRead = pr.firstRow
+	if err := pr.peek(paths, arrowSchema); err != nil {
+		pr.Close()
+		return nil, err
+	}
+	return pr, nil
+}
+
+// newBatchReaderOpener returns the opener of the native readers of paths wrapped by the readers of options.
+func newBatchReaderOpener(paths []string, bufferSize int64, storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext, options *packedReaderOptions,
+	readStats *readStatsCollector, alignStats *AlignmentStats,
+) func(*arrow.Schema) (packedBatchReader, error) {
+	openPaths := func(paths []string, arrowSchema *arrow.Schema) (packedBatchReader, error) {
+		var packedReader packedBatchReader
+		var err error
+		if r := options.rowGroupRange; r != nil {
+			packedReader, err = openRowGroupRange(paths[0], arrowSchema, bufferSize, storageConfig, storagePluginContext, *r)
+		} else {
+			packedReader, err = openPackedReader(paths, arrowSchema, bufferSize, storageConfig, storagePluginContext, options)
+			if err == nil && readStats != nil {
+				packedReader = readStats.track(packedReader)
+			}
+		}
+		if err == nil && options.groupRowCountCheck {
+			if err = checkGroupRowCounts(paths, storageConfig); err != nil {
+				packedReader.Close()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		var reader packedBatchReader = &decodeErrorBatchReader{
+			packedBatchReader: packedReader,
+			paths:             paths,
+			storageConfig:     storageConfig,
+		}
+		if options.decodePool != nil {
+			reader = options.decodePool.wrap(reader)
+		}
+		if options.batchTimeout > 0 {
+			return newTimeoutBatchReader(reader, options.batchTimeout, paths), nil
+		}
+		return reader, nil
+	}
+	openCopies := func(arrowSchema *arrow.Schema) (packedBatchReader, error) {
+		if len(options.replicas) == 0 {
+			return openPaths(paths, arrowSchema)
+		}
+		replicas := lo.Map(options.replicas, func(replica []string, _ int) []string { return options.rewrite(replica) })
+		return newFailoverBatchReader(func(paths []string) (packedBatchReader, error) {
+			return openPaths(paths, arrowSchema)
+		}, append([][]string{paths}, replicas...))
+	}
+	return func(arrowSchema *arrow.Schema) (packedBatchReader, error) {
+		var reader packedBatchReader
+		var err error
+		if options.retryBudget != nil {
+			reader, err = newRetryBatchReader(func() (packedBatchReader, error) { return openCopies(arrowSchema) }, options.retryBudget)
+		} else {
+			reader, err = openCopies(arrowSchema)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if options.maxRecordBytes > 0 {
+			reader = newSplitBatchReader(reader, options.maxRecordBytes)
+		}
+		// aligned last, the slices of the split batches start at any row
+		if alignStats != nil {
+			aligned := newAlignBatchReader(reader, options.alignment, alignStats)
+			aligned.mem = options.mem
+			reader = aligned
+		}
+		return reader, nil
+	}
+}
+
+// openPackedReader opens the native reader of paths on the filesystem and read policy of the options.
+func openPackedReader(paths []string, schema *arrow.Schema, bufferSize int64, storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext, options *packedReaderOptions,
+) (packedBatchReader, error) {
+	var opts []packed.ReaderOption
+	if p := options.readPolicy; p != nil {
+		opts = append(opts, packed.WithReadPolicy(p.MaxSpan, p.MaxGap))
+	}
+	if options.fileSystem != nil {
+		opts = append(opts, packed.WithFileSystem(options.fileSystem))
+	}
+	reader, err := packed.NewPackedReader(paths, schema, bufferSize, storageConfig, storagePluginContext, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// openRowGroupRange opens the reader of the row groups r of the single file path, seeking by its footer.
+func openRowGroupRange(path string, schema *arrow.Schema, bufferSize int64, storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext, r rowGroupRange,
+) (packedBatchReader, error) {
+	reader, err := packed.NewPackedRowGroupReader(path, schema, bufferSize, storageConfig, storagePluginContext)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := reader.NumRowGroups()
+	if err == nil && r.offset+r.count > groups {
+		err = merr.WrapErrParameterInvalidMsg("row groups [%d, %d) out of the %d row groups of packed file %s",
+			r.offset, r.offset+r.count, groups, path)
+	}
+	if err == nil {
+		err = reader.SetRange(r.offset, r.count)
+	}
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// rowGroupNumRows returns the rows of every row group of the file at path, read from its footer.
+func rowGroupNumRows(path string, schema *arrow.Schema, bufferSize int64, storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+) ([]int64, error) {
+	reader, err := packed.NewPackedRowGroupReader(path, schema, bufferSize, storageConfig, storagePluginContext)
+	if err != nil {
+		return nil, merr.WrapErrIoFailed(path, err)
+	}
+	defer reader.Close()
+	groups, err := reader.NumRowGroups()
+	if err != nil {
+		return nil, merr.WrapErrIoFailed(path, err)
+	}
+	rows := make([]int64, groups)
+	for g := range rows {
+		if rows[g], err = reader.RowGroupNumRows(g); err != nil {
+			return nil, merr.WrapErrIoFailed(path, err)
+		}
+	}
+	return rows, nil
+}
+
+// openChecksumVerifier reads the checksums of WithChecksumVerification, failing if there are none.
+func openChecksumVerifier(options *packedReaderOptions, paths []string, field2Col map[FieldID]int) (*batchChecksumVerifier, error) {
+	ctx := options.ctx
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	sums, err := ReadBatchChecksums(ctx, options.checksumCM, options.checksumPath)
+	if err != nil {
+		return nil, err
+	}
+	return newBatchChecksumVerifier(paths, sums, field2Col)
 }
 
 func NewRecordReaderFromManifest(manifest string,
@@ -123,6 +644,7 @@ func newIterativePackedRecordReader(
 	bufferSize int64,
 	storageConfig *indexpb.StorageConfig,
 	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...PackedReaderOption,
 ) *IterativeRecordReader {
 	chunk := 0
 	return &IterativeRecordReader{
@@ -132,11 +654,35 @@ func newIterativePackedRecordReader(
 			}
 			currentPaths := paths[chunk]
 			chunk++
+			if len(opts) > 0 {
+				return newMixedPackedRecordReader(currentPaths, schema, bufferSize, storageConfig, storagePluginContext, opts...)
+			}
 			return newPackedRecordReader(currentPaths, schema, bufferSize, storageConfig, storagePluginContext)
 		},
 	}
 }
 
+// NewPackedRecordReader reads the chunks of a segment, paths holding the column group files of each
+// chunk, as records owned by the reader and valid until the next Next.
+func NewPackedRecordReader(
+	paths [][]string,
+	schema *schemapb.CollectionSchema,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...PackedReaderOption,
+) (RecordReader, error) {
+	reader := newIterativePackedRecordReader(paths, schema, bufferSize, storageConfig, storagePluginContext, opts...)
+	if len(paths) > 0 {
+		first, err := reader.iterate()
+		if err != nil {
+			return nil, err
+		}
+		reader.cur = first
+	}
+	return reader, nil
+}
+
 type ManifestReader struct {
 	fieldBinlogs []*datapb.FieldBinlog
 	manifest     string
@@ -0,0 +1,2274 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/objectstorage"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+func TestCountRows(t *testing.T) {
+	t.Run("count", func(t *testing.T) {
+		size := 25
+		paths := []string{"/tmp/count_rows/0"}
+		writePackedTestSegment(t, paths, size)
+
+		rows, err := CountRows(paths, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), rows)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := CountRows([]string{"/tmp/count_rows/missing"}, nil)
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+	})
+}
+
+func TestPackedFileStats(t *testing.T) {
+	paths := [][]string{{"/tmp/file_stats/0"}, {"/tmp/file_stats/1"}}
+	writePackedTestSegment(t, paths[0], 25)
+	writePackedTestSegment(t, paths[1], 10)
+
+	rows, size, err := PackedFileStats(paths[:1], nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), rows)
+	assert.Positive(t, size)
+
+	total, totalSize, err := PackedFileStats(paths, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(35), total)
+	assert.Greater(t, totalSize, size)
+
+	// the rows of the column groups of a chunk are counted once
+	grouped := []string{"/tmp/file_stats/grouped/0", "/tmp/file_stats/grouped/1"}
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(generateTestSchema().Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	writePackedTestSegmentWithGroups(t, grouped, groups, 12)
+	groupedRows, groupedSize, err := PackedFileStats([][]string{grouped}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), groupedRows)
+	_, firstSize, err := PackedFileStats([][]string{grouped[:1]}, nil)
+	require.NoError(t, err)
+	assert.Greater(t, groupedSize, firstSize)
+
+	_, _, err = PackedFileStats([][]string{{"/tmp/file_stats/missing"}}, nil)
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+}
+
+func TestPackedRecordReaderPosition(t *testing.T) {
+	size := 25
+	paths := []string{"/tmp/position/0"}
+	writePackedTestSegment(t, paths, size)
+
+	reader, err := newPackedRecordReader(paths, generateTestSchema(), 10*1024*1024, nil, nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.Equal(t, int64(0), reader.Position())
+
+	var rows int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		rows += int64(rec.Len())
+		assert.Equal(t, rows, reader.Position())
+	}
+	assert.Equal(t, int64(size), reader.Position())
+}
+
+func TestEstimateScanCost(t *testing.T) {
+	paths := []string{"/tmp/scan_cost/0", "/tmp/scan_cost/1"}
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(generateTestSchema().Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	pw := writePackedTestSegmentWithGroups(t, paths, groups, 30)
+	schema := generateTestSchema()
+
+	// decodedBytes reads the bytes of the columns of projection actually decoded
+	decodedBytes := func(projection []FieldID) int64 {
+		reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		var size int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return size
+			}
+			require.NoError(t, err)
+			for _, id := range projection {
+				size += int64(calculateActualDataSize(rec.Column(id)))
+			}
+		}
+	}
+
+	internal := []FieldID{common.RowIDField, common.TimeStampField}
+	estimate, err := EstimateScanCost(paths, schema, internal, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), estimate.Rows)
+	assert.Equal(t, 1, estimate.Files)
+	assert.Equal(t, int64(pw.GetColumnGroupWrittenCompressed(0)), estimate.BytesToRead)
+	// the validity bitmaps aside, the fixed width columns decode as estimated
+	assert.InEpsilon(t, decodedBytes(internal), estimate.DecodedBytes, 0.1)
+
+	// the fields share the bytes of their file
+	fixed := []FieldID{13, 102}
+	estimate, err = EstimateScanCost(paths, schema, fixed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, estimate.Files)
+	assert.Positive(t, estimate.BytesToRead)
+	assert.Less(t, estimate.BytesToRead, int64(pw.GetColumnGroupWrittenCompressed(1)))
+	assert.InEpsilon(t, decodedBytes(fixed), estimate.DecodedBytes, 0.1)
+
+	estimate, err = EstimateScanCost(paths, schema, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, estimate.Files)
+	assert.Equal(t, int64(pw.GetWrittenCompressed()), estimate.BytesToRead)
+
+	_, err = EstimateScanCost(paths, schema, []FieldID{999}, nil)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestNewPackedRecordReader(t *testing.T) {
+	paths := [][]string{{"/tmp/public_reader/0"}, {"/tmp/public_reader/1"}}
+	writePackedTestSegment(t, paths[0], 10)
+	writePackedTestSegment(t, paths[1], 4)
+	schema := generateTestSchema()
+
+	reader, err := NewPackedRecordReader(paths, schema, 1024, nil, nil)
+	require.NoError(t, err)
+	var retained []Record
+	var pks []int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		for _, field := range schema.Fields {
+			assert.NotNil(t, rec.Column(field.GetFieldID()), field.GetFieldID())
+		}
+		pks = append(pks, rec.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+		rec.Retain()
+		retained = append(retained, rec)
+	}
+	require.NoError(t, reader.Close())
+	assert.Equal(t, append(lo.RangeFrom(int64(1), 10), lo.RangeFrom(int64(1), 4)...), pks)
+	// the records retained stay valid past the reads and the close
+	assert.Equal(t, int64(1), retained[0].Column(common.RowIDField).(*array.Int64).Value(0))
+	for _, rec := range retained {
+		rec.Release()
+	}
+
+	_, err = NewPackedRecordReader([][]string{{"/tmp/public_reader/missing"}}, schema, 1024, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestPackedRecordReaderReadContext(t *testing.T) {
+	paths := []string{"/tmp/read_context/0"}
+	writePackedTestSegment(t, paths, 30, WithRowGroupSize(5))
+	schema := generateTestSchema()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithReadContext(ctx))
+	require.NoError(t, err)
+	_, err = reader.Next()
+	require.NoError(t, err)
+	cancel()
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, merr.IsCanceledOrTimeout(err))
+	// the packed files are closed at once
+	assert.Nil(t, reader.reader)
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, reader.SetProjection([]FieldID{common.RowIDField}), context.Canceled)
+	require.NoError(t, reader.Close())
+
+	deserializer, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDeserializeContext(ctx))
+	require.NoError(t, err)
+	_, err = deserializer.NextValue()
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, deserializer.Close())
+}
+
+// countingObserver sums the rows and bytes it is notified of.
+type countingObserver struct {
+	readRows, writtenRows   int
+	readBytes, writtenBytes uint64
+	reads, writes           int
+}
+
+func (o *countingObserver) OnRead(rows int, bytes uint64) {
+	o.reads++
+	o.readRows += rows
+	o.readBytes += bytes
+}
+
+func (o *countingObserver) OnWrite(rows int, bytes uint64) {
+	o.writes++
+	o.writtenRows += rows
+	o.writtenBytes += bytes
+}
+
+func TestPackedProgressObserver(t *testing.T) {
+	paths := []string{"/tmp/progress_observer/0"}
+	observer := &countingObserver{}
+	// batches of 7 rows
+	pw := writePackedTestSegment(t, paths, 20, WithWriteObserver(observer))
+	assert.Equal(t, 3, observer.writes)
+	assert.Equal(t, 20, observer.writtenRows)
+	assert.Equal(t, pw.GetWrittenUncompressed(), observer.writtenBytes)
+	assert.Nil(t, pw.observer)
+
+	reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024, nil, nil, WithReadObserver(observer))
+	require.NoError(t, err)
+	var bytes uint64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		bytes += recordDataSize(rec.(*simpleArrowRecord).r)
+	}
+	assert.Equal(t, 20, observer.readRows)
+	assert.Equal(t, bytes, observer.readBytes)
+	require.NoError(t, reader.Close())
+	// no calls once closed
+	assert.Nil(t, reader.observer)
+}
+
+func TestPackedAllocators(t *testing.T) {
+	paths := []string{"/tmp/allocators/0"}
+	mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	writePackedTestSegment(t, paths, 30, WithLargeStringColumns(), WithWriteAllocator(mem))
+	mem.AssertSize(t, 0)
+
+	reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024, nil, nil,
+		WithTimestampRange(nil, 8, 17), WithReadAllocator(mem))
+	require.NoError(t, err)
+	rec, err := reader.Next()
+	require.NoError(t, err)
+	assert.Positive(t, rec.Len())
+	// the rows left by the filter are copied with mem
+	assert.Positive(t, mem.CurrentAlloc())
+	require.NoError(t, reader.Close())
+	mem.AssertSize(t, 0)
+
+	t.Run("serializer", func(t *testing.T) {
+		blobs, err := generateTestData(10)
+		require.NoError(t, err)
+		deserializer, err := NewBinlogDeserializeReader(generateTestSchema(), MakeBlobsReader(blobs), false)
+		require.NoError(t, err)
+		defer deserializer.Close()
+		values, err := ReadAllValues(deserializer)
+		require.NoError(t, err)
+		rec, err := ValueSerializer(values, generateTestSchema(), WithBuilderAllocator(mem))
+		require.NoError(t, err)
+		assert.Positive(t, mem.CurrentAlloc())
+		rec.Release()
+		mem.AssertSize(t, 0)
+	})
+}
+
+func TestPackedRecordReaderRowFilter(t *testing.T) {
+	paths := []string{"/tmp/row_filter/0"}
+	writePackedTestSegment(t, paths, 30, WithRowGroupSize(5))
+	schema := generateTestSchema()
+	// readTimestamps returns the timestamps of the rows read, which are their row ids
+	readTimestamps := func(t *testing.T, reader *packedRecordReader) []int64 {
+		var ts []int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			ts = append(ts, rec.Column(common.TimeStampField).(*array.Int64).Int64Values()...)
+			assert.Equal(t, ts[len(ts)-rec.Len():], rec.Column(common.RowIDField).(*array.Int64).Int64Values())
+		}
+		assert.Equal(t, int64(30), reader.Position())
+		return ts
+	}
+
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithTimestampRange(nil, 8, 17))
+	require.NoError(t, err)
+	assert.Equal(t, lo.RangeFrom(int64(8), 10), readTimestamps(t, reader))
+	require.NoError(t, reader.Close())
+
+	reader, err = newPackedRecordReader(paths, schema, 1024, nil, nil, WithTimestampRange(nil, 8, 17))
+	require.NoError(t, err)
+	reader.SetRowFilter(func(rec Record, row int) bool {
+		return rec.Column(common.RowIDField).(*array.Int64).Value(row)%2 == 0
+	})
+	assert.Equal(t, []int64{8, 10, 12, 14, 16}, readTimestamps(t, reader))
+	require.NoError(t, reader.Close())
+
+	// a range out of the segment reads no row
+	reader, err = newPackedRecordReader(paths, schema, 1024, nil, nil, WithTimestampRange(nil, 100, 200))
+	require.NoError(t, err)
+	assert.Empty(t, readTimestamps(t, reader))
+	assert.ErrorIs(t, reader.SetProjection([]FieldID{common.RowIDField}), merr.ErrParameterInvalid)
+	require.NoError(t, reader.Close())
+
+	_, err = newPackedRecordReader(paths, schema, 1024, nil, nil, WithTimestampRange(nil, 2, 1))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	t.Run("footer stats", func(t *testing.T) {
+		cm := NewLocalChunkManager(objectstorage.RootPath("/"))
+		reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithTimestampRange(cm, 8, 17))
+		require.NoError(t, err)
+		// the row groups of 5 rows of timestamps 1 to 30
+		assert.Equal(t, []bool{false, true, true, true, false, false}, reader.tsRowGroups.matches)
+		assert.Equal(t, []bool{false, false, true, false, false, false}, reader.tsRowGroupsInRange.matches)
+		assert.Equal(t, lo.RangeFrom(int64(8), 10), readTimestamps(t, reader))
+		require.NoError(t, reader.Close())
+	})
+
+	deserializer, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithReadTimestampRange(nil, 20, 22))
+	require.NoError(t, err)
+	values, err := ReadAllValues(deserializer)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20, 21, 22}, lo.Map(values, func(v *Value, _ int) int64 { return v.ID }))
+	require.NoError(t, deserializer.Close())
+	_, err = NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithReadTimestampRange(nil, 2, 1))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedRecordReaderSkipRowGroups(t *testing.T) {
+	paths := []string{"/tmp/skip_row_groups/0"}
+	writePackedTestSegment(t, paths, 23, WithRowGroupSize(5))
+	schema := generateTestSchema()
+	pf, err := file.OpenParquetFile(paths[0], false)
+	require.NoError(t, err)
+	// rowsBefore[k] is the number of rows of the first k row groups
+	rowsBefore := []int64{0}
+	for i := 0; i < pf.NumRowGroups(); i++ {
+		rowsBefore = append(rowsBefore, rowsBefore[i]+pf.MetaData().RowGroup(i).NumRows())
+	}
+	groups := pf.NumRowGroups()
+	pf.Close()
+	require.Greater(t, groups, 2)
+
+	readPKs := func(reader *packedRecordReader) []int64 {
+		var pks []int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return pks
+			}
+			require.NoError(t, err)
+			pks = append(pks, rec.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+		}
+	}
+	open := func(opts ...PackedReaderOption) *packedRecordReader {
+		reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { reader.Close() })
+		return reader
+	}
+	all := readPKs(open())
+
+	for _, k := range []int{0, 2, groups - 1} {
+		reader := open()
+		require.NoError(t, reader.SkipRowGroups(k))
+		assert.Equal(t, rowsBefore[k], reader.Position())
+		assert.Equal(t, all[rowsBefore[k]:], readPKs(reader))
+	}
+	reader := open()
+	assert.ErrorIs(t, reader.SkipRowGroups(groups), io.EOF)
+	assert.Equal(t, rowsBefore[groups], reader.Position())
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.ErrorIs(t, open().SkipRowGroups(groups+1), io.EOF)
+
+	reader = open()
+	_, err = reader.Next()
+	require.NoError(t, err)
+	assert.ErrorIs(t, reader.SkipRowGroups(1), merr.ErrParameterInvalid)
+	assert.ErrorIs(t, open(WithMaxRecordBytes(1024)).SkipRowGroups(1), merr.ErrParameterInvalid)
+
+	t.Run("row group range", func(t *testing.T) {
+		for _, r := range [][2]int{{0, groups}, {1, 2}, {groups - 1, 1}} {
+			reader := open(WithRowGroupRange(r[0], r[1]))
+			assert.Equal(t, all[rowsBefore[r[0]]:rowsBefore[r[0]+r[1]]], readPKs(reader), r)
+			assert.Equal(t, rowsBefore[r[0]+r[1]]-rowsBefore[r[0]], reader.Position(), r)
+		}
+		assert.Empty(t, readPKs(open(WithRowGroupRange(groups, 0))))
+		for _, r := range [][2]int{{-1, 1}, {0, groups + 1}, {groups, 1}} {
+			_, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithRowGroupRange(r[0], r[1]))
+			assert.ErrorIs(t, err, merr.ErrParameterInvalid, r)
+		}
+		_, err := newPackedRecordReader(append(paths, paths[0]), schema, 1024, nil, nil, WithRowGroupRange(0, 1))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestPackedRecordReaderRowGroupPruning(t *testing.T) {
+	paths := []string{"/tmp/row_group_pruning/0"}
+	writePackedTestSegment(t, paths, 30, WithRowGroupSize(10))
+	schema := generateTestSchema()
+	cm := NewLocalChunkManager(objectstorage.RootPath("/"))
+
+	// the batches are the row groups, of increasing timestamps
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil)
+	require.NoError(t, err)
+	var groupTs [][]int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		groupTs = append(groupTs, slices.Clone(rec.Column(common.TimeStampField).(*array.Int64).Int64Values()))
+	}
+	reader.Close()
+	require.Len(t, groupTs, 3)
+	target := groupTs[1][len(groupTs[1])/2]
+
+	readTs := func(paths []string, opts ...PackedReaderOption) ([]int64, int) {
+		reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, opts...)
+		require.NoError(t, err)
+		deserialized := 0
+		values := NewDeserializeReader(reader, func(r Record, v []*Value) error {
+			deserialized += r.Len()
+			return ValueDeserializerWithSchema(r, v, schema, true)
+		})
+		defer values.Close()
+		var ts []int64
+		for {
+			v, err := values.NextValue()
+			if err == io.EOF {
+				assert.Equal(t, int64(30), reader.Position())
+				return ts, deserialized
+			}
+			require.NoError(t, err)
+			ts = append(ts, (*v).Timestamp)
+		}
+	}
+	ts, deserialized := readTs(paths, WithRowGroupPruning(cm, common.TimeStampField, CompareEQ, target))
+	assert.Equal(t, groupTs[1], ts)
+	assert.Equal(t, len(groupTs[1]), deserialized)
+
+	ts, _ = readTs(paths, WithRowGroupPruning(cm, common.TimeStampField, CompareGT, groupTs[1][len(groupTs[1])-1]))
+	assert.Equal(t, groupTs[2], ts)
+	_, deserialized = readTs(paths, WithRowGroupPruning(cm, common.TimeStampField, CompareNE, target))
+	assert.Equal(t, 30, deserialized)
+	_, deserialized = readTs(paths, WithRowGroupPruning(cm, common.TimeStampField, CompareLT, groupTs[0][0]))
+	assert.Zero(t, deserialized)
+
+	t.Run("split batches", func(t *testing.T) {
+		// batches of a row each are mapped to their row groups by their rows
+		ts, deserialized := readTs(paths, WithMaxRecordBytes(1), WithRowGroupPruning(cm, common.TimeStampField, CompareEQ, target))
+		assert.Equal(t, groupTs[1], ts)
+		assert.Equal(t, len(groupTs[1]), deserialized)
+	})
+
+	t.Run("several column groups", func(t *testing.T) {
+		// the timestamps are in the first file, whose row groups cover the rows of both
+		groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+		for i := 2; i < len(schema.Fields); i++ {
+			groups[1].Columns = append(groups[1].Columns, i)
+		}
+		grouped := []string{"/tmp/row_group_pruning/grouped/0", "/tmp/row_group_pruning/grouped/1"}
+		writePackedTestSegmentWithGroups(t, grouped, groups, 30, WithRowGroupSize(10))
+		ts, deserialized := readTs(grouped, WithMaxRecordBytes(1), WithRowGroupPruning(cm, common.TimeStampField, CompareEQ, target))
+		assert.Equal(t, groupTs[1], ts)
+		assert.Equal(t, len(groupTs[1]), deserialized)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, opt := range []PackedReaderOption{
+			WithRowGroupPruning(cm, common.TimeStampField, CompareEQ, "1"),
+			WithRowGroupPruning(cm, 10, CompareLT, true),
+			WithRowGroupPruning(cm, 999, CompareEQ, int64(1)),
+		} {
+			_, err := newPackedRecordReader(paths, schema, 1024, nil, nil, opt)
+			assert.Error(t, err)
+		}
+		_, err := newPackedRecordReader(paths, schema, 1024, nil, nil,
+			WithRowGroupPruning(cm, common.TimeStampField, CompareEQ, target), WithSkipIndex([]FieldID{common.TimeStampField}))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestPackedRecordReaderPathRewriter(t *testing.T) {
+	writePackedTestSegment(t, []string{"/tmp/path_rewriter/new/0"}, 10)
+	rewriter := func(p string) string {
+		return strings.Replace(p, "/tmp/path_rewriter/old/", "/tmp/path_rewriter/new/", 1)
+	}
+
+	reader, err := newPackedRecordReader([]string{"/tmp/path_rewriter/old/0"}, generateTestSchema(), 1024, nil, nil, WithPathRewriter(rewriter))
+	require.NoError(t, err)
+	defer reader.Close()
+	rec, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, 10, rec.Len())
+
+	_, err = newPackedRecordReader([]string{"/tmp/path_rewriter/old/0"}, generateTestSchema(), 1024, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestSegmentContentHash(t *testing.T) {
+	schema := generateTestSchema()
+	src := []string{"/tmp/content_hash/src"}
+	writePackedTestSegment(t, src, 20)
+	hash, err := SegmentContentHash(src, schema, 1024)
+	require.NoError(t, err)
+	again, err := SegmentContentHash(src, schema, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	// another layout of the same rows
+	multi := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		multi[1].Columns = append(multi[1].Columns, i)
+	}
+	regrouped := []string{"/tmp/content_hash/regrouped/0", "/tmp/content_hash/regrouped/1"}
+	_, err = RegroupPackedSegment(src, regrouped, schema, multi, 1024)
+	require.NoError(t, err)
+	regroupedHash, err := SegmentContentHash(regrouped, schema, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, hash, regroupedHash)
+
+	other := []string{"/tmp/content_hash/other"}
+	writePackedTestSegment(t, other, 19)
+	otherHash, err := SegmentContentHash(other, schema, 1024)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, otherHash)
+}
+
+func TestPackedRecordReaderSetProjection(t *testing.T) {
+	size := 25
+	paths := []string{"/tmp/set_projection/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+	projection := []FieldID{common.RowIDField, 13}
+
+	// readPKs reads the remaining rows, checking that only the projection is decoded
+	readPKs := func(reader *packedRecordReader) []int64 {
+		var pks []int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return pks
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(projection)), rec.(*simpleArrowRecord).r.NumCols())
+			pkCol := rec.Column(common.RowIDField).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, pkCol.Value(i), rec.Column(13).(*array.Int64).Value(i))
+				pks = append(pks, pkCol.Value(i))
+			}
+		}
+	}
+	expected := lo.RangeFrom(int64(1), size)
+
+	t.Run("before first batch", func(t *testing.T) {
+		reader, err := newPackedRecordReader(paths, schema, 10*1024*1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		require.NoError(t, reader.SetProjection(projection))
+		assert.Equal(t, expected, readPKs(reader))
+	})
+
+	t.Run("between batches", func(t *testing.T) {
+		reader, err := newPackedRecordReader(paths, schema, 10*1024*1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		read := rec.Len()
+		require.NoError(t, reader.SetProjection(projection))
+		assert.Equal(t, int64(read), reader.Position())
+		// all rows may come in one batch
+		assert.Equal(t, expected[read:], append([]int64{}, readPKs(reader)...))
+	})
+
+	t.Run("mid batch", func(t *testing.T) {
+		reader, err := newPackedRecordReader(paths, schema, 10*1024*1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		// the rows returned so far end within the first batch of the reopened files
+		reader.position = 10
+		require.NoError(t, reader.SetProjection(projection))
+		assert.Equal(t, expected[10:], readPKs(reader))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		reader, err := newPackedRecordReader(paths, schema, 10*1024*1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.ErrorIs(t, reader.SetProjection([]FieldID{999}), merr.ErrFieldNotFound)
+		assert.Error(t, reader.SetProjection(nil))
+		// the reader keeps its projection
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(schema.Fields)), rec.(*simpleArrowRecord).r.NumCols())
+	})
+}
+
+func TestTailingPackedRecordReader(t *testing.T) {
+	dir := "/tmp/tailing"
+	require.NoError(t, os.RemoveAll(dir))
+	chunkPaths := func(chunk int) []string {
+		return []string{fmt.Sprintf("%s/%d", dir, chunk)}
+	}
+	writePackedTestSegment(t, chunkPaths(0), 5)
+	// chunk 1 is moved into place while the reader waits for it
+	staged := []string{dir + "/staged"}
+	writePackedTestSegment(t, staged, 7)
+
+	countRows := func(reader RecordReader) (int, error) {
+		rows := 0
+		for {
+			rec, err := reader.Next()
+			if err != nil {
+				return rows, err
+			}
+			rows += rec.Len()
+		}
+	}
+
+	reader := NewTailingPackedRecordReader(context.Background(), chunkPaths, generateTestSchema(), 1024, nil, 10*time.Millisecond, 300*time.Millisecond)
+	defer reader.Close()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Rename(staged[0], chunkPaths(1)[0])
+	}()
+	start := time.Now()
+	rows, err := countRows(reader)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 12, rows)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// tailing resumes after io.EOF
+	writePackedTestSegment(t, chunkPaths(2), 3)
+	rows, err = countRows(reader)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 3, rows)
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		reader := NewTailingPackedRecordReader(ctx, chunkPaths, generateTestSchema(), 1024, nil, 10*time.Millisecond, time.Hour)
+		defer reader.Close()
+		time.AfterFunc(50*time.Millisecond, cancel)
+		rows, err := countRows(reader)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 15, rows)
+	})
+}
+
+// newChunkedTestReader returns a reader yielding one record per chunk size,
+// with primary keys 1..sum(sizes).
+func newChunkedTestReader(t *testing.T, sizes ...int) RecordReader {
+	var chunks [][]*Blob
+	seed := 1
+	for _, size := range sizes {
+		blobs, err := generateTestDataWithSeed(seed, size)
+		require.NoError(t, err)
+		chunk, err := MakeBlobsReader(blobs)()
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+		seed += size
+	}
+	pos := 0
+	return newIterativeCompositeBinlogRecordReader(generateTestSchema(), nil, func() ([]*Blob, error) {
+		if pos >= len(chunks) {
+			return nil, io.EOF
+		}
+		pos++
+		return chunks[pos-1], nil
+	})
+}
+
+func TestCoalescingRecordReader(t *testing.T) {
+	readAll := func(reader RecordReader) []int {
+		var lens []int
+		lastPK := int64(0)
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return lens
+			}
+			require.NoError(t, err)
+			pks := rec.Column(common.RowIDField).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, lastPK+1, pks.Value(i))
+				lastPK = pks.Value(i)
+			}
+			assert.Equal(t, rec.Len(), rec.Column(102).Len())
+			lens = append(lens, rec.Len())
+		}
+	}
+
+	t.Run("coalesce small batches", func(t *testing.T) {
+		reader, err := NewCoalescingRecordReader(newChunkedTestReader(t, 2, 2, 2, 10, 1, 3, 3), generateTestSchema(), 5, 6)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, []int{6, 10, 4, 3}, readAll(reader))
+	})
+
+	t.Run("max rows", func(t *testing.T) {
+		reader, err := NewCoalescingRecordReader(newChunkedTestReader(t, 3, 3, 1), generateTestSchema(), 4, 4)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, []int{3, 4}, readAll(reader))
+	})
+
+	t.Run("close with pending records", func(t *testing.T) {
+		reader, err := NewCoalescingRecordReader(newChunkedTestReader(t, 3, 3, 1), generateTestSchema(), 4, 4)
+		require.NoError(t, err)
+		_, err = reader.Next()
+		require.NoError(t, err)
+		assert.NoError(t, reader.Close())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewCoalescingRecordReader(newChunkedTestReader(t, 1), generateTestSchema(), 0, 4)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = NewCoalescingRecordReader(newChunkedTestReader(t, 1), generateTestSchema(), 5, 4)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+// BenchmarkCoalescingRecordReader compares deserializing a segment of many small row
+// groups as read and coalesced into larger batches.
+func BenchmarkCoalescingRecordReader(b *testing.B) {
+	paths := []string{"/tmp/bench_coalescing_reader/0"}
+	writePackedTestSegment(b, paths, 2000, WithRowGroupSize(8))
+	schema := generateTestSchema()
+	for _, coalesce := range []bool{false, true} {
+		b.Run(fmt.Sprintf("coalesce=%t", coalesce), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var reader RecordReader
+				reader, err := newPackedRecordReader(paths, schema, 1024*1024, nil, nil)
+				require.NoError(b, err)
+				if coalesce {
+					reader, err = NewCoalescingRecordReader(reader, schema, 256, 512)
+					require.NoError(b, err)
+				}
+				values := NewDeserializeReader(reader, func(r Record, v []*Value) error {
+					return ValueDeserializerWithSchema(r, v, schema, false)
+				})
+				for {
+					_, err := values.NextValue()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(b, err)
+				}
+				require.NoError(b, values.Close())
+			}
+		})
+	}
+}
+
+func TestRebatchRecordReader(t *testing.T) {
+	readAll := func(reader RecordReader) []int {
+		var lens []int
+		lastPK := int64(0)
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return lens
+			}
+			require.NoError(t, err)
+			pks := rec.Column(common.RowIDField).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, lastPK+1, pks.Value(i))
+				lastPK = pks.Value(i)
+			}
+			assert.Equal(t, rec.Len(), rec.Column(102).Len())
+			lens = append(lens, rec.Len())
+		}
+	}
+
+	t.Run("split and merge", func(t *testing.T) {
+		reader, err := NewRebatchRecordReader(newChunkedTestReader(t, 3, 5, 4), generateTestSchema(), 5)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, []int{5, 5, 2}, readAll(reader))
+	})
+
+	t.Run("split large batch", func(t *testing.T) {
+		reader, err := NewRebatchRecordReader(newChunkedTestReader(t, 10), generateTestSchema(), 3)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, []int{3, 3, 3, 1}, readAll(reader))
+	})
+
+	t.Run("exact multiple", func(t *testing.T) {
+		reader, err := NewRebatchRecordReader(newChunkedTestReader(t, 2, 2, 2), generateTestSchema(), 3)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, []int{3, 3}, readAll(reader))
+	})
+
+	t.Run("invalid target", func(t *testing.T) {
+		_, err := NewRebatchRecordReader(newChunkedTestReader(t, 1), generateTestSchema(), 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestLazyPackedRecordReader(t *testing.T) {
+	schema := generateTestSchema()
+	// newGroup returns a column group of fieldIDs read in batches of batchSize,
+	// counting how many times it is opened.
+	newGroup := func(batchSize int, opened *int, fieldIDs ...int64) *lazyColumnGroup {
+		groupSchema := projectSchema(schema, typeutil.NewSet(fieldIDs...))
+		return &lazyColumnGroup{
+			fields: typeutil.GetAllFieldSchemas(groupSchema),
+			open: func() (RecordReader, error) {
+				*opened++
+				return NewRebatchRecordReader(newChunkedTestReader(t, 3, 5, 4), groupSchema, batchSize)
+			},
+		}
+	}
+
+	t.Run("load on access", func(t *testing.T) {
+		var pkOpened, otherOpened int
+		reader, err := newLazyRecordReader([]*lazyColumnGroup{
+			newGroup(4, &pkOpened, common.RowIDField, common.TimeStampField),
+			newGroup(3, &otherOpened, 13, 16),
+		}, common.RowIDField)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		var lens []int
+		for i := 0; ; i++ {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			lens = append(lens, rec.Len())
+			// skip the second batch to make the other group catch up
+			if i == 1 {
+				continue
+			}
+			pks := rec.Column(common.RowIDField).(*array.Int64)
+			values := rec.Column(13).(*array.Int64)
+			strs := rec.Column(16).(*array.String)
+			require.Equal(t, rec.Len(), values.Len())
+			for j := 0; j < rec.Len(); j++ {
+				assert.Equal(t, pks.Value(j), values.Value(j))
+				assert.Equal(t, fmt.Sprint(pks.Value(j)), strs.Value(j))
+			}
+		}
+		assert.Equal(t, []int{4, 4, 4}, lens)
+		assert.Equal(t, 1, pkOpened)
+		assert.Equal(t, 1, otherOpened)
+	})
+
+	t.Run("never accessed", func(t *testing.T) {
+		var pkOpened, otherOpened int
+		reader, err := newLazyRecordReader([]*lazyColumnGroup{
+			newGroup(5, &pkOpened, common.RowIDField, common.TimeStampField),
+			newGroup(5, &otherOpened, 13, 16),
+		}, common.RowIDField)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		rows := 0
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			rows += rec.Column(common.RowIDField).Len()
+		}
+		assert.Equal(t, 12, rows)
+		assert.Equal(t, 0, otherOpened)
+	})
+
+	t.Run("load after next", func(t *testing.T) {
+		var pkOpened, otherOpened int
+		reader, err := newLazyRecordReader([]*lazyColumnGroup{
+			newGroup(4, &pkOpened, common.RowIDField, common.TimeStampField),
+			newGroup(4, &otherOpened, 13, 16),
+		}, common.RowIDField)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		rec.Retain()
+		defer rec.Release()
+		_, err = reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, 4, rec.Column(common.RowIDField).Len())
+		assert.Error(t, rec.(*lazyRecord).Load(13))
+		assert.Error(t, rec.(*lazyRecord).Load(1000))
+	})
+
+	t.Run("decode failure", func(t *testing.T) {
+		var pkOpened int
+		failing := newGroup(4, new(int), 13, 16)
+		failing.open = func() (RecordReader, error) {
+			return nil, merr.WrapErrIoFailed("/tmp/lazy/1", errors.New("decode"))
+		}
+		reader, err := newLazyRecordReader([]*lazyColumnGroup{
+			newGroup(4, &pkOpened, common.RowIDField, common.TimeStampField),
+			failing,
+		}, common.RowIDField)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		assert.NotNil(t, rec.Column(common.RowIDField))
+		assert.NoError(t, rec.(*lazyRecord).Err())
+		assert.Nil(t, rec.Column(13))
+		assert.ErrorIs(t, rec.(*lazyRecord).Err(), merr.ErrIoFailed)
+		_, err = reader.Next()
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+	})
+
+	t.Run("no pk group", func(t *testing.T) {
+		var opened int
+		_, err := newLazyRecordReader([]*lazyColumnGroup{newGroup(4, &opened, 13)}, common.RowIDField)
+		assert.Error(t, err)
+	})
+
+	t.Run("sparse selection", func(t *testing.T) {
+		// seekGroup is newGroup of row groups of 4 rows, recording the row groups opened at
+		seekGroup := func(opened *int, seeks *[]int) *lazyColumnGroup {
+			group := newGroup(4, opened, 13, 16)
+			groupSchema := projectSchema(schema, typeutil.NewSet[int64](13, 16))
+			group.rowGroups = func() ([]int64, error) {
+				return []int64{4, 4, 4}, nil
+			}
+			group.openAt = func(offset, count int) (RecordReader, error) {
+				*seeks = append(*seeks, offset)
+				reader, err := NewRebatchRecordReader(newChunkedTestReader(t, 3, 5, 4), groupSchema, 4)
+				require.NoError(t, err)
+				for i := 0; i < offset; i++ {
+					_, err := reader.Next()
+					require.NoError(t, err)
+				}
+				return reader, nil
+			}
+			return group
+		}
+		read := func(threshold float64) (int, []int) {
+			var pkOpened, otherOpened int
+			var seeks []int
+			reader, err := newLazyRecordReader([]*lazyColumnGroup{
+				newGroup(4, &pkOpened, common.RowIDField, common.TimeStampField),
+				seekGroup(&otherOpened, &seeks),
+			}, common.RowIDField, WithSparseSelectionThreshold(threshold))
+			require.NoError(t, err)
+			defer reader.Close()
+			for i := 0; ; i++ {
+				rec, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				// only the last record is accessed
+				if i < 2 {
+					continue
+				}
+				pks := rec.Column(common.RowIDField).(*array.Int64)
+				values := rec.Column(13).(*array.Int64)
+				for j := 0; j < rec.Len(); j++ {
+					assert.Equal(t, pks.Value(j), values.Value(j))
+				}
+			}
+			return otherOpened, seeks
+		}
+		// a third of the rows caught up is below the threshold
+		opened, seeks := read(0.5)
+		assert.Equal(t, 0, opened)
+		assert.Equal(t, []int{2}, seeks)
+		opened, seeks = read(0.25)
+		assert.Equal(t, 1, opened)
+		assert.Empty(t, seeks)
+		opened, seeks = read(0)
+		assert.Equal(t, 1, opened)
+		assert.Empty(t, seeks)
+
+		_, err := newLazyRecordReader([]*lazyColumnGroup{newGroup(4, &opened, common.RowIDField)}, common.RowIDField,
+			WithSparseSelectionThreshold(1.5))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestMixedPackedRecordReader(t *testing.T) {
+	size := 12
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	writePackedTestSegmentWithGroups(t, []string{"/tmp/mixed/0", "/tmp/mixed/1"}, groups, size)
+	groupFields := func(group storagecommon.ColumnGroup) []int64 {
+		return lo.Map(group.Columns, func(col int, _ int) int64 { return schema.Fields[col].GetFieldID() })
+	}
+	pathFieldIDs := [][]int64{groupFields(groups[0]), groupFields(groups[1])}
+
+	s3Config := &indexpb.StorageConfig{StorageType: "remote", BucketName: "bucket"}
+	resolver := NewSchemeStorageConfigResolver(map[string]*indexpb.StorageConfig{
+		"file": nil,
+		"s3":   s3Config,
+	})
+	var s3Paths []string
+	// mock the s3 storage with in memory batches of 5 rows
+	mockS3 := func(o *packedReaderOptions) {
+		open := o.open
+		o.open = func(paths []string, groupSchema *schemapb.CollectionSchema, storageConfig *indexpb.StorageConfig) (RecordReader, error) {
+			if storageConfig != s3Config {
+				return open(paths, groupSchema, storageConfig)
+			}
+			s3Paths = append(s3Paths, paths...)
+			return NewRebatchRecordReader(newChunkedTestReader(t, size), groupSchema, 5)
+		}
+	}
+
+	t.Run("across storages", func(t *testing.T) {
+		reader, err := newMixedPackedRecordReader([]string{"file:///tmp/mixed/0", "s3://bucket/mixed/1"}, schema, 10*1024*1024, nil, nil,
+			WithStorageConfigResolver(resolver, pathFieldIDs), mockS3)
+		require.NoError(t, err)
+		defer reader.Close()
+
+		rows := 0
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			pks := rec.Column(common.RowIDField).(*array.Int64)
+			values := rec.Column(13).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, int64(rows+i+1), pks.Value(i))
+				assert.Equal(t, pks.Value(i), values.Value(i))
+			}
+			rows += rec.Len()
+		}
+		assert.Equal(t, size, rows)
+		assert.Equal(t, []string{"bucket/mixed/1"}, s3Paths)
+	})
+
+	t.Run("single storage", func(t *testing.T) {
+		reader, err := newMixedPackedRecordReader([]string{"file:///tmp/mixed/0", "file:///tmp/mixed/1"}, schema, 10*1024*1024, nil, nil,
+			WithStorageConfigResolver(resolver, nil))
+		require.NoError(t, err)
+		defer reader.Close()
+		_, ok := reader.(*packedRecordReader)
+		assert.True(t, ok)
+	})
+
+	t.Run("missing path fields", func(t *testing.T) {
+		_, err := newMixedPackedRecordReader([]string{"file:///tmp/mixed/0", "s3://bucket/mixed/1"}, schema, 10*1024*1024, nil, nil,
+			WithStorageConfigResolver(resolver, nil), mockS3)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown scheme", func(t *testing.T) {
+		_, err := newMixedPackedRecordReader([]string{"gs://bucket/mixed/0"}, schema, 10*1024*1024, nil, nil,
+			WithStorageConfigResolver(resolver, nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("group parallelism", func(t *testing.T) {
+		var opened int
+		countOpens := func(o *packedReaderOptions) {
+			open := o.open
+			o.open = func(paths []string, groupSchema *schemapb.CollectionSchema, storageConfig *indexpb.StorageConfig) (RecordReader, error) {
+				opened++
+				return open(paths, groupSchema, storageConfig)
+			}
+		}
+		reader, err := newMixedPackedRecordReader([]string{"/tmp/mixed/0", "/tmp/mixed/1"}, schema, 10*1024*1024, nil, nil,
+			WithGroupReadParallelism(2, pathFieldIDs), countOpens)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, 2, opened)
+
+		rows := 0
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			pks := rec.Column(common.RowIDField).(*array.Int64)
+			values := rec.Column(13).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, int64(rows+i+1), pks.Value(i))
+				assert.Equal(t, pks.Value(i), values.Value(i))
+			}
+			rows += rec.Len()
+		}
+		assert.Equal(t, size, rows)
+	})
+
+	t.Run("group parallelism error", func(t *testing.T) {
+		errGroup := errors.New("group read failed")
+		failSecond := func(o *packedReaderOptions) {
+			open := o.open
+			o.open = func(paths []string, groupSchema *schemapb.CollectionSchema, storageConfig *indexpb.StorageConfig) (RecordReader, error) {
+				if paths[0] == "/tmp/mixed/1" {
+					return &failingRecordReader{err: errGroup}, nil
+				}
+				return open(paths, groupSchema, storageConfig)
+			}
+		}
+		reader, err := newMixedPackedRecordReader([]string{"/tmp/mixed/0", "/tmp/mixed/1"}, schema, 10*1024*1024, nil, nil,
+			WithGroupReadParallelism(2, pathFieldIDs), failSecond)
+		require.NoError(t, err)
+		_, err = reader.Next()
+		assert.ErrorIs(t, err, errGroup)
+		// the batch of the first group read meanwhile is released on close
+		assert.NoError(t, reader.Close())
+
+		_, err = newMixedPackedRecordReader([]string{"/tmp/mixed/0", "/tmp/mixed/1"}, schema, 10*1024*1024, nil, nil,
+			WithGroupReadParallelism(2, nil))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+// failingRecordReader fails every read with err.
+type failingRecordReader struct {
+	err error
+}
+
+func (r *failingRecordReader) Next() (Record, error) {
+	return nil, r.err
+}
+
+func (r *failingRecordReader) Close() error {
+	return nil
+}
+
+func TestDecodeErrorBatchReader(t *testing.T) {
+	missing := "/tmp/decode_error/missing"
+	reader := &decodeErrorBatchReader{
+		packedBatchReader: newBatchSliceReader([]int{5, 5}, 2, merr.SegcoreError(2001, "invalid page header")),
+		paths:             []string{missing},
+	}
+	for i := 0; i < 2; i++ {
+		rec, err := reader.ReadNext()
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), rec.NumRows())
+	}
+	_, err := reader.ReadNext()
+	assert.ErrorIs(t, err, merr.ErrIoDecodeFailed)
+	assert.False(t, IsTransientStorageError(err))
+	assert.ErrorContains(t, err, missing)
+	assert.ErrorContains(t, err, "after row 10")
+	assert.ErrorContains(t, err, "invalid page header")
+
+	transport := &decodeErrorBatchReader{
+		packedBatchReader: newBatchSliceReader([]int{5}, 0, merr.SegcoreError(2001, "IOError: When reading from 'a': AWS Error NETWORK_CONNECTION")),
+		paths:             []string{missing},
+	}
+	_, err = transport.ReadNext()
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.True(t, IsTransientStorageError(err))
+
+	clean := &decodeErrorBatchReader{packedBatchReader: newBatchSliceReader([]int{5}, -1, nil)}
+	_, err = clean.ReadNext()
+	require.NoError(t, err)
+	_, err = clean.ReadNext()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadVectorsInto(t *testing.T) {
+	schema := generateTestSchema()
+	field := typeutil.GetField(schema, 102)
+	dim := 8
+	rows := 10
+
+	var expected []float32
+	reader := newChunkedTestReader(t, 3, 4, 3)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		for i := 0; i < rec.Len(); i++ {
+			value, ok := serdeMap[schemapb.DataType_FloatVector].deserialize(rec.Column(102), i, schemapb.DataType_None, dim, true)
+			require.True(t, ok)
+			expected = append(expected, value.([]float32)...)
+		}
+	}
+	require.NoError(t, reader.Close())
+
+	// rebatching slices the vector columns at non-zero offsets
+	newReader := func() RecordReader {
+		reader, err := NewRebatchRecordReader(newChunkedTestReader(t, 3, 4, 3), schema, 4)
+		require.NoError(t, err)
+		return reader
+	}
+
+	t.Run("float32 buffer", func(t *testing.T) {
+		buf := make([]float32, rows*dim)
+		n, err := ReadFloatVectorsInto(newReader(), field, buf)
+		require.NoError(t, err)
+		assert.Equal(t, rows, n)
+		assert.Equal(t, expected, buf)
+	})
+
+	t.Run("byte buffer", func(t *testing.T) {
+		buf := make([]byte, rows*dim*4)
+		n, err := ReadVectorsInto(newReader(), field, buf)
+		require.NoError(t, err)
+		assert.Equal(t, rows, n)
+		assert.Equal(t, expected, arrow.Float32Traits.CastFromBytes(buf))
+	})
+
+	t.Run("buffer size mismatch", func(t *testing.T) {
+		_, err := ReadFloatVectorsInto(newReader(), field, make([]float32, (rows-1)*dim))
+		assert.Error(t, err)
+		_, err = ReadFloatVectorsInto(newReader(), field, make([]float32, (rows+1)*dim))
+		assert.Error(t, err)
+		_, err = ReadVectorsInto(newReader(), field, make([]byte, rows*dim*4+1))
+		assert.Error(t, err)
+	})
+
+	t.Run("not dense vector", func(t *testing.T) {
+		_, err := ReadVectorsInto(newReader(), typeutil.GetField(schema, 106), make([]byte, 0))
+		assert.Error(t, err)
+		_, err = ReadFloatVectorsInto(newReader(), typeutil.GetField(schema, 104), make([]float32, 0))
+		assert.Error(t, err)
+	})
+}
+
+// batchSliceReader is a packedBatchReader over the batches of int64 ranges, failing
+// with err after failAfter batches if err is set.
+type batchSliceReader struct {
+	batches   []arrow.Record
+	failAfter int
+	err       error
+	closed    bool
+}
+
+func newBatchSliceReader(sizes []int, failAfter int, err error) *batchSliceReader {
+	r := &batchSliceReader{failAfter: failAfter, err: err}
+	start := int64(0)
+	for _, size := range sizes {
+		builder := array.NewInt64Builder(memory.DefaultAllocator)
+		builder.AppendValues(lo.RangeFrom(start, size), nil)
+		col := builder.NewArray()
+		builder.Release()
+		schema := arrow.NewSchema([]arrow.Field{{Name: "0", Type: arrow.PrimitiveTypes.Int64}}, nil)
+		r.batches = append(r.batches, array.NewRecord(schema, []arrow.Array{col}, int64(size)))
+		col.Release()
+		start += int64(size)
+	}
+	return r
+}
+
+func (r *batchSliceReader) ReadNext() (arrow.Record, error) {
+	if r.err != nil && r.failAfter == 0 {
+		return nil, r.err
+	}
+	r.failAfter--
+	if len(r.batches) == 0 {
+		return nil, io.EOF
+	}
+	rec := r.batches[0]
+	r.batches = r.batches[1:]
+	return rec, nil
+}
+
+func (r *batchSliceReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+// newVectorBatch builds a batch of rows vectors of 32 bytes, starting at row offset of
+// an aligned buffer.
+func newVectorBatch(rows, offset int, nulls bool) arrow.Record {
+	builder := array.NewFixedSizeBinaryBuilder(memory.DefaultAllocator, &arrow.FixedSizeBinaryType{ByteWidth: 32})
+	defer builder.Release()
+	for i := 0; i < rows+offset; i++ {
+		if nulls && i%2 == 0 {
+			builder.AppendNull()
+			continue
+		}
+		builder.Append(bytes.Repeat([]byte{byte(i)}, 32))
+	}
+	col := builder.NewArray()
+	defer col.Release()
+	schema := arrow.NewSchema([]arrow.Field{{Name: "0", Type: col.DataType(), Nullable: nulls}}, nil)
+	rec := array.NewRecord(schema, []arrow.Array{col}, int64(rows+offset))
+	defer rec.Release()
+	return rec.NewSlice(int64(offset), int64(rows+offset))
+}
+
+func TestFileLimiter(t *testing.T) {
+	paths := []string{"/tmp/file_limiter/0", "/tmp/file_limiter/1"}
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(generateTestSchema().Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	writePackedTestSegmentWithGroups(t, paths, groups, 10)
+	schema := generateTestSchema()
+	limiter := NewFileLimiter(3)
+	open := func(ctx context.Context) (*packedRecordReader, error) {
+		return newPackedRecordReader(paths, schema, 1024, nil, nil, WithReadContext(ctx), WithFileLimiter(limiter))
+	}
+
+	first, err := open(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, FileLimiterStats{Budget: 3, InUse: 2, Peak: 2}, limiter.Stats())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = open(ctx)
+	assert.ErrorIs(t, err, merr.ErrServiceInternal)
+	assert.Equal(t, int64(0), limiter.Stats().Waiting)
+
+	// a waiting reader opens once the first one is closed
+	opened := make(chan error, 1)
+	go func() {
+		reader, err := open(context.Background())
+		if err == nil {
+			err = reader.Close()
+		}
+		opened <- err
+	}()
+	assert.Eventually(t, func() bool { return limiter.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	_, err = first.Next()
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
+	require.NoError(t, <-opened)
+	assert.Equal(t, FileLimiterStats{Budget: 3, InUse: 0, Peak: 2}, limiter.Stats())
+
+	_, err = newPackedRecordReader(paths, schema, 1024, nil, nil, WithFileLimiter(NewFileLimiter(1)))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	t.Run("groups", func(t *testing.T) {
+		// the readers of the groups take the slots of both files at once
+		pathFieldIDs := [][]int64{{common.RowIDField, common.TimeStampField}, {}}
+		for _, field := range schema.Fields[2:] {
+			pathFieldIDs[1] = append(pathFieldIDs[1], field.GetFieldID())
+		}
+		reader, err := newMixedPackedRecordReader(paths, schema, 1024, nil, nil,
+			WithGroupReadParallelism(2, pathFieldIDs), WithFileLimiter(limiter))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), limiter.Stats().InUse)
+		_, err = reader.Next()
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, int64(0), limiter.Stats().InUse)
+	})
+}
+
+// countingBatchReader reads the batches of inner slowly, counting the reads running at once.
+type countingBatchReader struct {
+	packedBatchReader
+	running *atomic.Int64
+	peak    *atomic.Int64
+}
+
+func (r *countingBatchReader) ReadNext() (arrow.Record, error) {
+	running := r.running.Inc()
+	defer r.running.Dec()
+	for peak := r.peak.Load(); running > peak && !r.peak.CompareAndSwap(peak, running); peak = r.peak.Load() {
+	}
+	time.Sleep(5 * time.Millisecond)
+	return r.packedBatchReader.ReadNext()
+}
+
+func TestDecodePool(t *testing.T) {
+	t.Run("shared by readers", func(t *testing.T) {
+		paths := []string{"/tmp/decode_pool/0"}
+		writePackedTestSegment(t, paths, 20, WithRowGroupSize(5))
+		pool := NewDecodePool(2)
+		readers := make([]*packedRecordReader, 3)
+		for i := range readers {
+			var err error
+			readers[i], err = newPackedRecordReader(paths, generateTestSchema(), 1024, nil, nil, WithDecodePool(pool))
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 3, pool.Stats().Readers)
+
+		rows := make([]int, len(readers))
+		var wg sync.WaitGroup
+		for i, reader := range readers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					rec, err := reader.Next()
+					if err != nil {
+						assert.ErrorIs(t, err, io.EOF)
+						return
+					}
+					rows[i] += rec.Len()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, []int{20, 20, 20}, rows)
+		for _, reader := range readers {
+			require.NoError(t, reader.Close())
+		}
+		stats := pool.Stats()
+		assert.Equal(t, DecodePoolStats{Workers: 2, Decoded: stats.Decoded}, stats)
+		assert.GreaterOrEqual(t, stats.Decoded, int64(3*4))
+
+		// the workers start again for the next reader
+		reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024, nil, nil, WithDecodePool(pool))
+		require.NoError(t, err)
+		_, err = reader.Next()
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Zero(t, pool.Stats().Readers)
+	})
+
+	t.Run("bounds decodes", func(t *testing.T) {
+		pool := NewDecodePool(2)
+		running, peak := atomic.NewInt64(0), atomic.NewInt64(0)
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			reader := pool.wrap(&countingBatchReader{packedBatchReader: newBatchSliceReader([]int{1, 1, 1}, -1, nil), running: running, peak: peak})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer reader.Close()
+				for {
+					if _, err := reader.ReadNext(); err != nil {
+						assert.ErrorIs(t, err, io.EOF)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, peak.Load(), int64(2))
+		assert.Equal(t, DecodePoolStats{Workers: 2, Decoded: 5 * 4}, pool.Stats())
+	})
+
+	t.Run("read after close", func(t *testing.T) {
+		pool := NewDecodePool(1)
+		reader := pool.wrap(newBatchSliceReader([]int{1}, -1, nil))
+		require.NoError(t, reader.Close())
+		_, err := reader.ReadNext()
+		assert.ErrorIs(t, err, merr.ErrServiceInternal)
+		assert.Zero(t, pool.Stats().Readers)
+	})
+}
+
+func TestAlignBatchReader(t *testing.T) {
+	t.Run("align", func(t *testing.T) {
+		inner := &batchSliceReader{batches: []arrow.Record{newVectorBatch(10, 0, false), newVectorBatch(10, 1, true)}}
+		stats := &AlignmentStats{}
+		reader := newAlignBatchReader(inner, 64, stats)
+		defer reader.Close()
+
+		rec, err := reader.ReadNext()
+		require.NoError(t, err)
+		assert.Same(t, inner.batches[0].Column(0), rec.Column(0))
+		assert.Equal(t, AlignmentStats{Aligned: 1}, *stats)
+
+		expected := newVectorBatch(10, 1, true)
+		defer expected.Release()
+		require.False(t, reader.isAligned(expected.Column(0).(*array.FixedSizeBinary)))
+		rec, err = reader.ReadNext()
+		require.NoError(t, err)
+		col := rec.Column(0).(*array.FixedSizeBinary)
+		assert.True(t, reader.isAligned(col))
+		assert.True(t, array.Equal(expected.Column(0), col))
+		assert.Equal(t, AlignmentStats{Aligned: 1, Copied: 1, CopiedBytes: 320}, *stats)
+
+		_, err = reader.ReadNext()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("packed files", func(t *testing.T) {
+		paths := []string{"/tmp/align_batch_reader/0"}
+		writePackedTestSegment(t, paths, 100)
+		_, err := newPackedRecordReader(paths, generateTestSchema(), 1024*1024, nil, nil, WithBufferAlignment(48))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+		reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024*1024, nil, nil,
+			WithBufferAlignment(64), WithMaxRecordBytes(1024))
+		require.NoError(t, err)
+		defer reader.Close()
+		check := newAlignBatchReader(nil, 64, &AlignmentStats{})
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			assert.True(t, check.isAligned(rec.Column(102).(*array.FixedSizeBinary)))
+			assert.True(t, check.isAligned(rec.Column(103).(*array.FixedSizeBinary)))
+		}
+		stats := reader.AlignmentStats()
+		assert.Positive(t, stats.Aligned+stats.Copied)
+	})
+}
+
+func BenchmarkAlignBatchReader(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		offset int
+	}{{"aligned", 0}, {"unaligned", 1}} {
+		b.Run(bc.name, func(b *testing.B) {
+			batch := newVectorBatch(4096, bc.offset, false)
+			defer batch.Release()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				reader := newAlignBatchReader(&batchSliceReader{batches: []arrow.Record{batch}}, 64, &AlignmentStats{})
+				_, err := reader.ReadNext()
+				require.NoError(b, err)
+				require.NoError(b, reader.Close())
+			}
+		})
+	}
+}
+
+func TestFailoverBatchReader(t *testing.T) {
+	readAll := func(reader packedBatchReader) ([]int64, error) {
+		var values []int64
+		for {
+			rec, err := reader.ReadNext()
+			if err != nil {
+				return values, err
+			}
+			values = append(values, rec.Column(0).(*array.Int64).Int64Values()...)
+		}
+	}
+	openFrom := func(readers map[string]*batchSliceReader) func(paths []string) (packedBatchReader, error) {
+		return func(paths []string) (packedBatchReader, error) {
+			reader, ok := readers[paths[0]]
+			if !ok {
+				return nil, merr.WrapErrIoKeyNotFound(paths[0])
+			}
+			return reader, nil
+		}
+	}
+	replicas := [][]string{{"primary"}, {"missing"}, {"replica"}}
+
+	t.Run("fail over mid scan", func(t *testing.T) {
+		readers := map[string]*batchSliceReader{
+			"primary": newBatchSliceReader([]int{5, 5, 5}, 2, merr.WrapErrIoFailedReason("primary degraded")),
+			"replica": newBatchSliceReader([]int{7, 8}, 0, nil),
+		}
+		reader, err := newFailoverBatchReader(openFrom(readers), replicas)
+		require.NoError(t, err)
+		values, err := readAll(reader)
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, lo.RangeFrom(int64(0), 15), values)
+		assert.True(t, readers["primary"].closed)
+		assert.NoError(t, reader.Close())
+		assert.True(t, readers["replica"].closed)
+	})
+
+	t.Run("primary missing", func(t *testing.T) {
+		readers := map[string]*batchSliceReader{"replica": newBatchSliceReader([]int{7, 8}, 0, nil)}
+		reader, err := newFailoverBatchReader(openFrom(readers), replicas)
+		require.NoError(t, err)
+		values, err := readAll(reader)
+		assert.Equal(t, io.EOF, err)
+		assert.Len(t, values, 15)
+	})
+
+	t.Run("all replicas fail", func(t *testing.T) {
+		readers := map[string]*batchSliceReader{
+			"primary": newBatchSliceReader([]int{5, 5, 5}, 1, merr.WrapErrIoFailedReason("primary degraded")),
+			// shorter than the rows already read
+			"replica": newBatchSliceReader([]int{3}, 0, nil),
+		}
+		reader, err := newFailoverBatchReader(openFrom(readers), replicas)
+		require.NoError(t, err)
+		values, err := readAll(reader)
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+		assert.ErrorIs(t, err, merr.ErrIoUnexpectEOF)
+		assert.Len(t, values, 5)
+
+		_, err = newFailoverBatchReader(openFrom(nil), replicas)
+		assert.ErrorIs(t, err, merr.ErrIoKeyNotFound)
+	})
+}
+
+func TestRetryBatchReader(t *testing.T) {
+	readAll := func(reader packedBatchReader) ([]int64, error) {
+		var values []int64
+		for {
+			rec, err := reader.ReadNext()
+			if err != nil {
+				return values, err
+			}
+			values = append(values, rec.Column(0).(*array.Int64).Int64Values()...)
+		}
+	}
+	degraded := merr.WrapErrIoFailedReason("storage degraded")
+	// openEach returns the readers in turn, failing to open past the last one
+	openEach := func(readers ...*batchSliceReader) func() (packedBatchReader, error) {
+		return func() (packedBatchReader, error) {
+			if len(readers) == 0 {
+				return nil, degraded
+			}
+			reader := readers[0]
+			readers = readers[1:]
+			return reader, nil
+		}
+	}
+
+	t.Run("resume after retries", func(t *testing.T) {
+		budget := NewRetryBudget(3, time.Millisecond, 2*time.Millisecond)
+		first := newBatchSliceReader([]int{5, 5, 5}, 2, degraded)
+		second := newBatchSliceReader([]int{7, 8}, 0, nil)
+		reader, err := newRetryBatchReader(openEach(first, second), budget)
+		require.NoError(t, err)
+		values, err := readAll(reader)
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, lo.RangeFrom(int64(0), 15), values)
+		assert.True(t, first.closed)
+		assert.Equal(t, int64(2), budget.Remaining())
+		assert.NoError(t, reader.Close())
+		assert.True(t, second.closed)
+	})
+
+	t.Run("budget shared across readers", func(t *testing.T) {
+		budget := NewRetryBudget(2, time.Millisecond, time.Millisecond)
+		reader, err := newRetryBatchReader(openEach(newBatchSliceReader([]int{5}, 0, degraded), newBatchSliceReader([]int{5}, 0, nil)), budget)
+		require.NoError(t, err)
+		values, err := readAll(reader)
+		assert.Equal(t, io.EOF, err)
+		assert.Len(t, values, 5)
+		require.NoError(t, reader.Close())
+
+		// the second reader fails to open again and again
+		reader, err = newRetryBatchReader(openEach(newBatchSliceReader([]int{5}, 0, degraded)), budget)
+		require.NoError(t, err)
+		_, err = reader.ReadNext()
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+		assert.ErrorContains(t, err, "retry budget of 2 retries of the scan exhausted")
+		assert.Equal(t, int64(0), budget.Remaining())
+		_, err2 := reader.ReadNext()
+		assert.Equal(t, err, err2)
+		require.NoError(t, reader.Close())
+
+		_, err = newRetryBatchReader(openEach(), budget)
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		budget := NewRetryBudget(3, time.Millisecond, time.Millisecond)
+		invalid := merr.WrapErrParameterInvalidMsg("schema mismatch")
+		first := newBatchSliceReader([]int{5, 5}, 1, invalid)
+		reader, err := newRetryBatchReader(openEach(first), budget)
+		require.NoError(t, err)
+		values, err := readAll(reader)
+		assert.Equal(t, invalid, err)
+		assert.Len(t, values, 5)
+		assert.False(t, first.closed)
+		assert.Equal(t, int64(3), budget.Remaining())
+		require.NoError(t, reader.Close())
+
+		// a predicate retries other failures
+		budget = NewRetryBudget(3, time.Millisecond, time.Millisecond, WithRetryable(func(err error) bool {
+			return errors.Is(err, merr.ErrParameterInvalid)
+		}))
+		reader, err = newRetryBatchReader(openEach(newBatchSliceReader([]int{5, 5}, 1, invalid), newBatchSliceReader([]int{5, 5}, 0, nil)), budget)
+		require.NoError(t, err)
+		values, err = readAll(reader)
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, lo.RangeFrom(int64(0), 10), values)
+		require.NoError(t, reader.Close())
+
+		assert.True(t, IsTransientStorageError(merr.WrapErrIoFailedReason("connection reset")))
+		assert.True(t, IsTransientStorageError(context.DeadlineExceeded))
+		assert.False(t, IsTransientStorageError(io.EOF))
+		assert.False(t, IsTransientStorageError(invalid))
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		budget := NewRetryBudget(10, time.Millisecond, time.Millisecond, WithMaxAttempts(2))
+		reader, err := newRetryBatchReader(openEach(newBatchSliceReader([]int{5}, 0, degraded)), budget)
+		require.NoError(t, err)
+		_, err = reader.ReadNext()
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+		assert.ErrorContains(t, err, "after 2 retries")
+		assert.Equal(t, int64(8), budget.Remaining())
+		require.NoError(t, reader.Close())
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		budget := NewRetryBudget(10, time.Millisecond, 5*time.Millisecond)
+		assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond},
+			lo.Map([]int{0, 1, 2, 3, 10}, func(attempt int, _ int) time.Duration { return budget.backoff(attempt) }))
+	})
+}
+
+func TestPackedRecordReaderCorruptFileNotRetried(t *testing.T) {
+	p := "/tmp/corrupt_not_retried/0"
+	writePackedTestSegment(t, []string{p}, 20)
+	// overwrite the column chunks, keeping the footer the files are opened with
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	for i := 4; i < len(data)-8-footerLen; i++ {
+		data[i] = 0xab
+	}
+	require.NoError(t, os.WriteFile(p, data, 0o644))
+
+	attempts := 0
+	budget := NewRetryBudget(3, time.Millisecond, time.Millisecond, WithRetryable(func(err error) bool {
+		attempts++
+		return IsTransientStorageError(err)
+	}))
+	reader, err := newPackedRecordReader([]string{p}, generateTestSchema(), 1024, nil, nil, WithRetryBudget(budget))
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, merr.ErrIoDecodeFailed)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, int64(3), budget.Remaining())
+}
+
+func TestSplitBatchReader(t *testing.T) {
+	t.Run("split", func(t *testing.T) {
+		// 8 bytes per row, the batch of 3 rows fits
+		reader := newSplitBatchReader(newBatchSliceReader([]int{100, 3, 50}, 0, nil), 80)
+		var values []int64
+		var lens []int64
+		for {
+			rec, err := reader.ReadNext()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			assert.LessOrEqual(t, recordDataSize(rec), uint64(80))
+			values = append(values, rec.Column(0).(*array.Int64).Int64Values()...)
+			lens = append(lens, rec.NumRows())
+		}
+		assert.Equal(t, lo.RangeFrom(int64(0), 153), values)
+		assert.Equal(t, []int64{10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 3, 10, 10, 10, 10, 10}, lens)
+		assert.NoError(t, reader.Close())
+	})
+
+	t.Run("row over the cap", func(t *testing.T) {
+		reader := newSplitBatchReader(newBatchSliceReader([]int{3}, 0, nil), 4)
+		for i := 0; i < 3; i++ {
+			rec, err := reader.ReadNext()
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), rec.NumRows())
+		}
+		_, err := reader.ReadNext()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("packed files", func(t *testing.T) {
+		size := 200
+		paths := []string{"/tmp/split_batch_reader/0"}
+		writePackedTestSegment(t, paths, size)
+		reader, err := newPackedRecordReader(paths, generateTestSchema(), 10*1024*1024, nil, nil, WithMaxRecordBytes(1024))
+		require.NoError(t, err)
+		defer reader.Close()
+		var pks []int64
+		records := 0
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			assert.LessOrEqual(t, recordDataSize(rec.(*simpleArrowRecord).r), uint64(1024))
+			pks = append(pks, rec.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+			records++
+		}
+		assert.Equal(t, lo.RangeFrom(int64(1), size), pks)
+		assert.Greater(t, records, 1)
+	})
+}
+
+func TestFieldBytesRecordReader(t *testing.T) {
+	size := 20
+	paths := []string{"/tmp/field_bytes_reader/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	inner, err := newPackedRecordReader(paths, schema, 10*1024*1024, nil, nil)
+	require.NoError(t, err)
+	reader := NewFieldBytesRecordReader(inner, schema)
+	defer reader.Close()
+	for {
+		_, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	counts := reader.BytesPerField()
+	assert.ElementsMatch(t, CanonicalColumnOrder(schema), lo.Keys(counts))
+	// 8 bytes per int64, and at most a validity bit per row
+	assert.GreaterOrEqual(t, counts[13], uint64(8*size))
+	assert.LessOrEqual(t, counts[13], uint64(8*size+size))
+	// the float vectors are of dim 8
+	assert.GreaterOrEqual(t, counts[102], uint64(32*size))
+
+	t.Run("projected", func(t *testing.T) {
+		projected := projectSchema(schema, typeutil.NewSet[int64](common.RowIDField))
+		inner, err := newPackedRecordReader(paths, projected, 10*1024*1024, nil, nil)
+		require.NoError(t, err)
+		reader := NewFieldBytesRecordReader(inner, projected)
+		defer reader.Close()
+		_, err = reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, []FieldID{common.RowIDField}, lo.Keys(reader.BytesPerField()))
+	})
+}
+
+// slowBatchReader is a packedBatchReader whose reads block until unblocked.
+type slowBatchReader struct {
+	unblock chan struct{}
+	closed  chan struct{}
+	reads   atomic.Int32
+}
+
+func (r *slowBatchReader) ReadNext() (arrow.Record, error) {
+	r.reads.Inc()
+	<-r.unblock
+	return nil, io.EOF
+}
+
+func (r *slowBatchReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestTimeoutBatchReader(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		inner := &slowBatchReader{unblock: make(chan struct{}), closed: make(chan struct{})}
+		close(inner.unblock)
+		reader := newTimeoutBatchReader(inner, time.Second, []string{"/tmp/slow/0"})
+		_, err := reader.ReadNext()
+		assert.Equal(t, io.EOF, err)
+		assert.NoError(t, reader.Close())
+		assert.True(t, isClosed(inner.closed))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		inner := &slowBatchReader{unblock: make(chan struct{}), closed: make(chan struct{})}
+		pr := &packedRecordReader{reader: newTimeoutBatchReader(inner, 10*time.Millisecond, []string{"/tmp/slow/0"})}
+
+		_, err := pr.Next()
+		require.Error(t, err)
+		assert.NotEqual(t, io.EOF, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+
+		// poisoned without reading again
+		_, err = pr.Next()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int32(1), inner.reads.Load())
+
+		// Close waits for the pending read to return to close the inner reader
+		closed := make(chan error, 1)
+		go func() {
+			closed <- pr.Close()
+		}()
+		assert.Never(t, func() bool { return len(closed) > 0 }, 50*time.Millisecond, time.Millisecond)
+		assert.False(t, isClosed(inner.closed))
+		close(inner.unblock)
+		assert.NoError(t, <-closed)
+		assert.True(t, isClosed(inner.closed))
+	})
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestReadAsArrowTable(t *testing.T) {
+	paths := []string{"/tmp/arrow_table/0"}
+	writePackedTestSegment(t, paths, 20, WithRowGroupSize(5))
+	schema := generateTestSchema()
+	pkCol := lo.IndexOf(lo.Map(typeutil.GetAllFieldSchemas(schema), func(f *schemapb.FieldSchema, _ int) FieldID { return f.GetFieldID() }), common.RowIDField)
+
+	readPKs := func(table arrow.Table) []int64 {
+		var pks []int64
+		for _, chunk := range table.Column(pkCol).Data().Chunks() {
+			pks = append(pks, chunk.(*array.Int64).Int64Values()...)
+		}
+		return pks
+	}
+	expected := lo.RangeFrom(int64(1), 20)
+
+	table, err := ReadAsArrowTable(paths, schema, 1024)
+	require.NoError(t, err)
+	defer table.Release()
+	assert.Equal(t, int64(20), table.NumRows())
+	assert.Equal(t, int64(len(schema.Fields)), table.NumCols())
+	assert.Equal(t, expected, readPKs(table))
+
+	t.Run("single chunk", func(t *testing.T) {
+		table, err := ReadAsArrowTable(paths, schema, 1024, WithSingleChunkTable())
+		require.NoError(t, err)
+		defer table.Release()
+		for i := 0; i < int(table.NumCols()); i++ {
+			assert.Len(t, table.Column(i).Data().Chunks(), 1)
+		}
+		assert.Equal(t, expected, readPKs(table))
+	})
+
+	t.Run("empty segment", func(t *testing.T) {
+		empty := []string{"/tmp/arrow_table/empty"}
+		writePackedTestSegment(t, empty, 0)
+		table, err := ReadAsArrowTable(empty, schema, 1024)
+		require.NoError(t, err)
+		defer table.Release()
+		assert.Equal(t, int64(0), table.NumRows())
+		assert.Equal(t, int64(len(schema.Fields)), table.NumCols())
+	})
+}
+
+func TestPackedRecordReaderFormatVersion(t *testing.T) {
+	schema := generateTestSchema()
+	defer func(version packedFormatVersion) { currentPackedFormatVersion = version }(currentPackedFormatVersion)
+
+	// a newer minor version reads with the current code path
+	currentPackedFormatVersion = packedFormatVersion{major: supportedPackedFormatMajor, minor: 99}
+	minor := []string{"/tmp/format_version/minor"}
+	writePackedTestSegment(t, minor, 10)
+	rows, err := CountRows(minor, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rows)
+
+	currentPackedFormatVersion = packedFormatVersion{major: supportedPackedFormatMajor + 1}
+	major := []string{"/tmp/format_version/major"}
+	writePackedTestSegment(t, major, 10)
+	_, err = newPackedRecordReader(major, schema, 1024, nil, nil)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	assert.ErrorContains(t, err, currentPackedFormatVersion.String())
+}
+
+func TestPackedSerdeVersion(t *testing.T) {
+	paths := []string{"/tmp/serde_version/0"}
+	writePackedTestSegment(t, paths, 10)
+	version, err := ReadPackedSerdeVersion(paths)
+	require.NoError(t, err)
+	assert.Equal(t, SerdeVersion, version)
+
+	reader, err := newPackedRecordReader(paths, generateTestSchema(), 1024, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	// the tag is storage metadata, not custom one
+	metadata, err := ReadPackedSchemaMetadata(paths)
+	require.NoError(t, err)
+	assert.NotContains(t, metadata, serdeVersionKey)
+
+	_, err = ReadPackedSerdeVersion(nil)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedRecordReaderMaxTotalBytes(t *testing.T) {
+	paths := []string{"/tmp/max_total_bytes/0"}
+	writePackedTestSegment(t, paths, 20, WithRowGroupSize(5))
+	schema := generateTestSchema()
+
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil)
+	require.NoError(t, err)
+	var sizes []int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, int64(recordDataSize(rec.(*simpleArrowRecord).r)))
+	}
+	reader.Close()
+	require.Greater(t, len(sizes), 2)
+
+	reader, err = newPackedRecordReader(paths, schema, 1024, nil, nil, WithMaxTotalBytes(sizes[0]+sizes[1]))
+	require.NoError(t, err)
+	defer reader.Close()
+	var retained []Record
+	rows := 0
+	for i := 0; i < 2; i++ {
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		rec.Retain()
+		retained = append(retained, rec)
+		rows += rec.Len()
+	}
+	assert.Equal(t, sizes[0]+sizes[1], reader.OutstandingBytes())
+
+	// the consumer holds both records, the third one exceeds the ceiling
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, merr.ErrServiceMemoryLimitExceeded)
+	assert.Equal(t, sizes[0]+sizes[1], reader.OutstandingBytes())
+
+	// the record failing the read is read again once the records are released
+	for _, rec := range retained {
+		rec.Release()
+	}
+	assert.Zero(t, reader.OutstandingBytes())
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		rows += rec.Len()
+	}
+	assert.Equal(t, 20, rows)
+	assert.Zero(t, reader.OutstandingBytes())
+
+	// a record larger than the ceiling is read while no other is outstanding
+	small, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithMaxTotalBytes(1))
+	require.NoError(t, err)
+	defer small.Close()
+	rec, err := small.Next()
+	require.NoError(t, err)
+	rec.Retain()
+	_, err = small.Next()
+	assert.ErrorIs(t, err, merr.ErrServiceMemoryLimitExceeded)
+	rows = rec.Len()
+	rec.Release()
+	for {
+		rec, err := small.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		rows += rec.Len()
+	}
+	assert.Equal(t, 20, rows)
+
+	// a filtered record put back over the ceiling is returned as filtered, once
+	filteredReader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithMaxTotalBytes(1))
+	require.NoError(t, err)
+	defer filteredReader.Close()
+	filtered := 0
+	filteredReader.SetRowFilter(func(rec Record, row int) bool {
+		filtered++
+		return rec.Column(common.RowIDField).(*array.Int64).Value(row)%2 == 0
+	})
+	rec, err = filteredReader.Next()
+	require.NoError(t, err)
+	rec.Retain()
+	ids := slices.Clone(rec.Column(common.RowIDField).(*array.Int64).Int64Values())
+	_, err = filteredReader.Next()
+	assert.ErrorIs(t, err, merr.ErrServiceMemoryLimitExceeded)
+	rec.Release()
+	for {
+		rec, err := filteredReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		ids = append(ids, rec.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+	}
+	assert.Equal(t, 20, filtered)
+	assert.Equal(t, []int64{2, 4, 6, 8, 10, 12, 14, 16, 18, 20}, ids)
+	assert.Equal(t, int64(20), filteredReader.Position())
+}
+
+func TestPackedRecordReaderSchemaFingerprint(t *testing.T) {
+	paths := []string{"/tmp/schema_fingerprint/0"}
+	writePackedTestSegment(t, paths, 10)
+	schema := generateTestSchema()
+
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil, WithSchemaFingerprintCheck(nil))
+	require.NoError(t, err)
+	reader.Close()
+
+	// the array elements change type, which the arrow layout of arrays does not show
+	drifted := generateTestSchema()
+	typeutil.GetField(drifted, 18).ElementType = schemapb.DataType_VarChar
+	reader, err = newPackedRecordReader(paths, drifted, 1024, nil, nil)
+	require.NoError(t, err)
+	reader.Close()
+	_, err = newPackedRecordReader(paths, drifted, 1024, nil, nil, WithSchemaFingerprintCheck(nil))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	assert.ErrorContains(t, err, "fingerprint")
+
+	t.Run("projection", func(t *testing.T) {
+		projected := projectSchema(schema, typeutil.NewSet[int64](common.RowIDField, common.TimeStampField))
+		_, err := newPackedRecordReader(paths, projected, 1024, nil, nil, WithSchemaFingerprintCheck(nil))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		reader, err := newPackedRecordReader(paths, projected, 1024, nil, nil, WithSchemaFingerprintCheck(schema))
+		require.NoError(t, err)
+		defer reader.Close()
+		_, err = reader.Next()
+		require.NoError(t, err)
+		_, err = newPackedRecordReader(paths, projected, 1024, nil, nil, WithSchemaFingerprintCheck(drifted))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestExportVectorFieldToNumpy(t *testing.T) {
+	paths := []string{"/tmp/export_numpy/0"}
+	writePackedTestSegment(t, paths, 10)
+	schema := generateTestSchema()
+
+	// parse returns the header dict and the data of a .npy file
+	parse := func(npy []byte) (string, []byte) {
+		require.Equal(t, "\x93NUMPY\x01\x00", string(npy[:8]))
+		headerLen := int(binary.LittleEndian.Uint16(npy[8:10]))
+		require.Zero(t, (10+headerLen)%64)
+		header := string(npy[10 : 10+headerLen])
+		require.True(t, strings.HasSuffix(header, "\n"))
+		return strings.TrimSpace(header), npy[10+headerLen:]
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportVectorFieldToNumpy(paths, schema, 1024, 102, &buf))
+	header, data := parse(buf.Bytes())
+	assert.Equal(t, "{'descr': '<f4', 'fortran_order': False, 'shape': (10, 8), }", header)
+	vectors := arrow.Float32Traits.CastFromBytes(data)
+	require.Len(t, vectors, 80)
+	for i, v := range vectors {
+		assert.Equal(t, float32(i/8+1), v)
+	}
+
+	buf.Reset()
+	require.NoError(t, ExportVectorFieldToNumpy(paths, schema, 1024, 103, &buf))
+	header, data = parse(buf.Bytes())
+	assert.Equal(t, "{'descr': '|u1', 'fortran_order': False, 'shape': (10, 1), }", header)
+	assert.Equal(t, bytes.Repeat([]byte{0xff}, 10), data)
+
+	assert.ErrorIs(t, ExportVectorFieldToNumpy(paths, schema, 1024, 104, &buf), merr.ErrParameterInvalid)
+	assert.ErrorIs(t, ExportVectorFieldToNumpy(paths, schema, 1024, 999, &buf), merr.ErrFieldNotFound)
+}
+
+// BenchmarkPackedRecordReader reports the page and decompression buffers allocated
+// reading a compressed segment of many row groups, and those the scratch pool of the
+// reader could not serve from the buffers freed before.
+func BenchmarkPackedRecordReader(b *testing.B) {
+	paths := []string{"/tmp/bench_packed_reader/0"}
+	writePackedTestSegment(b, paths, 1000, WithRowGroupSize(100))
+	arrowSchema, err := ConvertToArrowSchema(generateTestSchema(), true)
+	require.NoError(b, err)
+	var scratchAllocs, scratchReused int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := packed.NewPackedReader(paths, arrowSchema, 1024*1024, nil, nil)
+		require.NoError(b, err)
+		for {
+			_, err := reader.ReadNext()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(b, err)
+		}
+		allocations, reused, err := reader.ScratchStats()
+		require.NoError(b, err)
+		scratchAllocs += allocations
+		scratchReused += reused
+		require.NoError(b, reader.Close())
+	}
+	b.ReportMetric(float64(scratchAllocs)/float64(b.N), "scratch-allocs/op")
+	b.ReportMetric(float64(scratchAllocs-scratchReused)/float64(b.N), "scratch-new-allocs/op")
+}
+
+func TestValidateSegmentPaths(t *testing.T) {
+	paths := []string{"/tmp/validate_paths/0", "/tmp/validate_paths/1"}
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(generateTestSchema().Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	writePackedTestSegmentWithGroups(t, paths, groups, 10)
+	assert.NoError(t, ValidateSegmentPaths(paths, 2, nil))
+
+	err := ValidateSegmentPaths(paths, 3, nil)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	require.NoError(t, os.WriteFile("/tmp/validate_paths/empty", nil, 0o644))
+	err = ValidateSegmentPaths([]string{paths[0], "/tmp/validate_paths/missing", "/tmp/validate_paths/empty"}, 3, nil)
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.ErrorContains(t, err, "missing files [/tmp/validate_paths/missing]")
+	assert.ErrorContains(t, err, "empty files [/tmp/validate_paths/empty]")
+}
+
+func TestPackedRecordReaderGroupRowCounts(t *testing.T) {
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	full := []string{"/tmp/group_row_counts/full/0", "/tmp/group_row_counts/full/1"}
+	partial := []string{"/tmp/group_row_counts/partial/0", "/tmp/group_row_counts/partial/1"}
+	writePackedTestSegmentWithGroups(t, full, groups, 10)
+	writePackedTestSegmentWithGroups(t, partial, groups, 7)
+
+	rows, err := packed.GetFileRowCount(full[1], nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rows)
+	reader, err := newPackedRecordReader(full, schema, 1024, nil, nil, WithGroupRowCountCheck())
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	// the group files of a segment and of its partial write
+	mixed := []string{full[0], partial[1]}
+	reader, err = newPackedRecordReader(mixed, schema, 1024, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	_, err = newPackedRecordReader(mixed, schema, 1024, nil, nil, WithGroupRowCountCheck())
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+	assert.ErrorContains(t, err, "group 0 /tmp/group_row_counts/full/0: 10 rows")
+	assert.ErrorContains(t, err, "group 1 /tmp/group_row_counts/partial/1: 7 rows")
+	_, err = CountRows(mixed, nil)
+	assert.ErrorContains(t, err, "group 1 /tmp/group_row_counts/partial/1: 7 rows")
+}
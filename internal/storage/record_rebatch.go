@@ -0,0 +1,241 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"maps"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// rebatchRecordReader re-slices the records of an inner reader into records of targetRows rows.
+type rebatchRecordReader struct {
+	buffer     *columnBuffer
+	targetRows int
+	cur        Record
+}
+
+var _ RecordReader = (*rebatchRecordReader)(nil)
+
+// NewRebatchRecordReader wraps inner so that Next returns records of targetRows rows.
+func NewRebatchRecordReader(inner RecordReader, schema *schemapb.CollectionSchema, targetRows int) (RecordReader, error) {
+	if targetRows <= 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("target rows of rebatch reader must be positive, got %d", targetRows)
+	}
+	return &rebatchRecordReader{
+		buffer: &columnBuffer{
+			inner:  inner,
+			fields: typeutil.GetAllFieldSchemas(schema),
+		},
+		targetRows: targetRows,
+	}, nil
+}
+
+func (rr *rebatchRecordReader) Next() (Record, error) {
+	if rr.cur != nil {
+		rr.cur.Release()
+		rr.cur = nil
+	}
+	if err := rr.buffer.fill(rr.targetRows); err != nil {
+		return nil, err
+	}
+	if rr.buffer.pendingRows == 0 {
+		return nil, io.EOF
+	}
+	rows := min(rr.targetRows, rr.buffer.pendingRows)
+	arrays, err := rr.buffer.take(rows)
+	if err != nil {
+		return nil, err
+	}
+	rr.cur = newRecordFromArrays(rr.buffer.fields, arrays, rows)
+	return rr.cur, nil
+}
+
+func (rr *rebatchRecordReader) Close() error {
+	if rr.cur != nil {
+		rr.cur.Release()
+		rr.cur = nil
+	}
+	return rr.buffer.Close()
+}
+
+// coalescingRecordReader concatenates the small records of an inner reader, see NewCoalescingRecordReader.
+type coalescingRecordReader struct {
+	inner   RecordReader
+	fields  []*schemapb.FieldSchema
+	minRows int
+	maxRows int
+
+	// pending are the records of the next coalesced record, next the record read ahead
+	pending     []Record
+	pendingRows int
+	next        Record
+	// cur is the record returned last, released on the next read.
+	cur Record
+}
+
+var _ RecordReader = (*coalescingRecordReader)(nil)
+
+// NewCoalescingRecordReader wraps inner so that consecutive records of fewer than minRows rows are
+// concatenated into records of at most maxRows rows.
+func NewCoalescingRecordReader(inner RecordReader, schema *schemapb.CollectionSchema, minRows, maxRows int) (RecordReader, error) {
+	if minRows <= 0 || maxRows < minRows {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid rows [%d, %d] of coalescing reader", minRows, maxRows)
+	}
+	return &coalescingRecordReader{
+		inner:   inner,
+		fields:  typeutil.GetAllFieldSchemas(schema),
+		minRows: minRows,
+		maxRows: maxRows,
+	}, nil
+}
+
+func (cr *coalescingRecordReader) Next() (Record, error) {
+	cr.releaseCur()
+	for {
+		rec := cr.next
+		cr.next = nil
+		if rec == nil {
+			r, err := cr.inner.Next()
+			if err == io.EOF {
+				if len(cr.pending) > 0 {
+					return cr.coalesce()
+				}
+				return nil, io.EOF
+			}
+			if err != nil {
+				return nil, err
+			}
+			// the records stay valid past the next read of inner once retained
+			r.Retain()
+			rec = r
+		}
+		if len(cr.pending) == 0 && rec.Len() >= cr.minRows {
+			cr.cur = rec
+			return rec, nil
+		}
+		if len(cr.pending) > 0 && cr.pendingRows+rec.Len() > cr.maxRows {
+			cr.next = rec
+			return cr.coalesce()
+		}
+		cr.pending = append(cr.pending, rec)
+		cr.pendingRows += rec.Len()
+		if cr.pendingRows >= cr.minRows {
+			return cr.coalesce()
+		}
+	}
+}
+
+// coalesce concatenates the pending records into the record returned.
+func (cr *coalescingRecordReader) coalesce() (Record, error) {
+	pending, rows := cr.pending, cr.pendingRows
+	cr.pending, cr.pendingRows = nil, 0
+	if len(pending) == 1 {
+		cr.cur = pending[0]
+		return cr.cur, nil
+	}
+	defer func() {
+		for _, rec := range pending {
+			rec.Release()
+		}
+	}()
+	arrays := make([]arrow.Array, 0, len(cr.fields))
+	pieces := make([]arrow.Array, len(pending))
+	for _, field := range cr.fields {
+		for i, rec := range pending {
+			pieces[i] = rec.Column(field.FieldID)
+		}
+		arr, err := array.Concatenate(pieces, memory.DefaultAllocator)
+		if err != nil {
+			for _, done := range arrays {
+				done.Release()
+			}
+			return nil, merr.WrapErrServiceInternal(fmt.Sprintf("concatenate column of field %d failed: %s", field.FieldID, err.Error()))
+		}
+		arrays = append(arrays, arr)
+	}
+	cr.cur = newRecordFromArrays(cr.fields, arrays, rows)
+	return cr.cur, nil
+}
+
+func (cr *coalescingRecordReader) releaseCur() {
+	if cr.cur != nil {
+		cr.cur.Release()
+		cr.cur = nil
+	}
+}
+
+func (cr *coalescingRecordReader) Close() error {
+	cr.releaseCur()
+	for _, rec := range cr.pending {
+		rec.Release()
+	}
+	cr.pending, cr.pendingRows = nil, 0
+	if cr.next != nil {
+		cr.next.Release()
+		cr.next = nil
+	}
+	return cr.inner.Close()
+}
+
+// FieldBytesRecordReader counts the bytes of every field read through the reader it wraps.
+type FieldBytesRecordReader struct {
+	inner  RecordReader
+	fields []*schemapb.FieldSchema
+	bytes  map[FieldID]uint64
+}
+
+var _ RecordReader = (*FieldBytesRecordReader)(nil)
+
+// NewFieldBytesRecordReader wraps inner, which must not be a lazy reader.
+func NewFieldBytesRecordReader(inner RecordReader, schema *schemapb.CollectionSchema) *FieldBytesRecordReader {
+	return &FieldBytesRecordReader{
+		inner:  inner,
+		fields: typeutil.GetAllFieldSchemas(schema),
+		bytes:  make(map[FieldID]uint64),
+	}
+}
+
+func (fr *FieldBytesRecordReader) Next() (Record, error) {
+	rec, err := fr.inner.Next()
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fr.fields {
+		if col := rec.Column(field.GetFieldID()); col != nil {
+			fr.bytes[field.GetFieldID()] += calculateActualDataSize(col)
+		}
+	}
+	return rec, nil
+}
+
+// BytesPerField returns the bytes read per field, complete once Next returned io.EOF.
+func (fr *FieldBytesRecordReader) BytesPerField() map[FieldID]uint64 {
+	return maps.Clone(fr.bytes)
+}
+
+func (fr *FieldBytesRecordReader) Close() error {
+	return fr.inner.Close()
+}
@@ -0,0 +1,150 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// RecordTransform reshapes a record as it streams through MapRecordReader.
+// It must not release its input, it either returns the input or a new record.
+type RecordTransform func(Record) (Record, error)
+
+type mapRecordReader struct {
+	inner RecordReader
+	fn    RecordTransform
+	// cur is the last record returned by fn if it is a new one, owned by the reader.
+	cur Record
+}
+
+var _ RecordReader = (*mapRecordReader)(nil)
+
+// MapRecordReader applies fn to each record of inner. A new record returned by fn is
+// released on the next call of Next, the same way inner records are.
+func MapRecordReader(inner RecordReader, fn RecordTransform) RecordReader {
+	return &mapRecordReader{
+		inner: inner,
+		fn:    fn,
+	}
+}
+
+func (mr *mapRecordReader) Next() (Record, error) {
+	if mr.cur != nil {
+		mr.cur.Release()
+		mr.cur = nil
+	}
+	rec, err := mr.inner.Next()
+	if err != nil {
+		return nil, err
+	}
+	out, err := mr.fn(rec)
+	if err != nil {
+		return nil, err
+	}
+	if out != rec {
+		mr.cur = out
+	}
+	return out, nil
+}
+
+func (mr *mapRecordReader) Close() error {
+	if mr.cur != nil {
+		mr.cur.Release()
+		mr.cur = nil
+	}
+	return mr.inner.Close()
+}
+
+// ChainRecordTransforms applies fns in order, releasing intermediate records.
+func ChainRecordTransforms(fns ...RecordTransform) RecordTransform {
+	return func(r Record) (Record, error) {
+		cur := r
+		for _, fn := range fns {
+			out, err := fn(cur)
+			if out != cur && cur != r {
+				cur.Release()
+			}
+			if err != nil {
+				return nil, err
+			}
+			cur = out
+		}
+		return cur, nil
+	}
+}
+
+// DropFields returns a transform removing the columns of fieldIDs.
+func DropFields(fieldIDs ...FieldID) RecordTransform {
+	dropped := typeutil.NewSet(fieldIDs...)
+	return func(r Record) (Record, error) {
+		return reshapeSimpleRecord(r, func(fieldID FieldID, field arrow.Field) (arrow.Field, bool) {
+			return field, !dropped.Contain(fieldID)
+		})
+	}
+}
+
+// RenameFields returns a transform renaming the arrow fields of the columns in names,
+// so that records written out carry the new names.
+func RenameFields(names map[FieldID]string) RecordTransform {
+	return func(r Record) (Record, error) {
+		return reshapeSimpleRecord(r, func(fieldID FieldID, field arrow.Field) (arrow.Field, bool) {
+			if name, ok := names[fieldID]; ok {
+				field.Name = name
+			}
+			return field, true
+		})
+	}
+}
+
+// reshapeSimpleRecord builds a new record sharing the columns of r, keeping the columns
+// fn accepts with the arrow field fn returns for them.
+func reshapeSimpleRecord(r Record, fn func(fieldID FieldID, field arrow.Field) (arrow.Field, bool)) (Record, error) {
+	sr, ok := r.(*simpleArrowRecord)
+	if !ok {
+		return nil, merr.WrapErrServiceInternal(fmt.Sprintf("record transform needs an arrow record, got %T", r))
+	}
+	col2Field := make(map[int]FieldID, len(sr.field2Col))
+	for fieldID, col := range sr.field2Col {
+		col2Field[col] = fieldID
+	}
+
+	schema := sr.r.Schema()
+	fields := make([]arrow.Field, 0, schema.NumFields())
+	cols := make([]arrow.Array, 0, schema.NumFields())
+	field2Col := make(map[FieldID]int, len(sr.field2Col))
+	for i, field := range schema.Fields() {
+		fieldID, mapped := col2Field[i]
+		if mapped {
+			var keep bool
+			if field, keep = fn(fieldID, field); !keep {
+				continue
+			}
+			field2Col[fieldID] = len(cols)
+		}
+		fields = append(fields, field)
+		cols = append(cols, sr.r.Column(i))
+	}
+	metadata := schema.Metadata()
+	rec := array.NewRecord(arrow.NewSchema(fields, &metadata), cols, sr.r.NumRows())
+	return NewSimpleArrowRecord(rec, field2Col), nil
+}
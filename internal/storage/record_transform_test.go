@@ -0,0 +1,83 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/pkg/v2/common"
+)
+
+func TestMapRecordReader(t *testing.T) {
+	newReader := func(fn RecordTransform) RecordReader {
+		inner, err := NewRebatchRecordReader(newChunkedTestReader(t, 5, 5), generateTestSchema(), 4)
+		require.NoError(t, err)
+		return MapRecordReader(inner, fn)
+	}
+
+	t.Run("drop and rename", func(t *testing.T) {
+		reader := newReader(ChainRecordTransforms(DropFields(102, 103), RenameFields(map[FieldID]string{13: "renamed"})))
+		defer reader.Close()
+
+		rows := 0
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			assert.Panics(t, func() { rec.Column(102) })
+			assert.Panics(t, func() { rec.Column(103) })
+			pks := rec.Column(common.RowIDField).(*array.Int64)
+			values := rec.Column(13).(*array.Int64)
+			for i := 0; i < rec.Len(); i++ {
+				assert.Equal(t, pks.Value(i), values.Value(i))
+			}
+			schema := rec.(*simpleArrowRecord).ArrowSchema()
+			assert.Equal(t, len(generateTestSchema().Fields)-2, schema.NumFields())
+			assert.NotEmpty(t, schema.FieldIndices("renamed"))
+			rows += rec.Len()
+		}
+		assert.Equal(t, 10, rows)
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		reader := newReader(func(r Record) (Record, error) { return r, nil })
+		defer reader.Close()
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, 4, rec.Len())
+	})
+
+	t.Run("transform error", func(t *testing.T) {
+		reader := newReader(func(r Record) (Record, error) { return nil, errors.New("mock error") })
+		defer reader.Close()
+		_, err := reader.Next()
+		assert.Error(t, err)
+	})
+
+	t.Run("not arrow record", func(t *testing.T) {
+		_, err := DropFields(102)(&selectiveRecord{})
+		assert.Error(t, err)
+	})
+}
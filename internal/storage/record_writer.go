@@ -17,18 +17,29 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/cockroachdb/errors"
 	"github.com/samber/lo"
+	"go.uber.org/zap"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
 	"github.com/milvus-io/milvus/internal/storagecommon"
 	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/log"
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
@@ -52,9 +63,135 @@ type packedRecordWriter struct {
 	columnGroupCompressed   map[typeutil.UniqueID]uint64
 	outputManifest          string
 	storageConfig           *indexpb.StorageConfig
+	storagePluginContext    *indexcgopb.StoragePluginContext
+	// truePaths are the paths handed to the packed writer, in column group order
+	truePaths []string
+
+	pkField *schemapb.FieldSchema
+	closed  bool
+	aborted bool
+	// filesClosed is set once the packed writer is closed, not to close it again on Abort.
+	filesClosed bool
+
+	// strictBufferSize rejects rows larger than bufferSize, else they are warned once.
+	strictBufferSize bool
+	bufferSizeWarned bool
+	largeStrings     bool
+	// serializerOptions are passed to ValueSerializer by NewPackedSerializeWriter.
+	serializerOptions []ValueSerializerOption
+
+	interceptor func(Record) (Record, error)
+	ctx         context.Context
+	observer    ProgressObserver
+	mem         memory.Allocator
+
+	rowIDAssigner
+	rowOrder
+	segmentStatsCollector
+	writerSidecars
+	writeVerifier
+	fileSyncer
 }
 
+// Write writes r and releases it if it is an arrow record, see checkRecord for the records accepted.
 func (pw *packedRecordWriter) Write(r Record) error {
+	return pw.write(r, true)
+}
+
+// WriteBorrowed writes r without releasing it, the caller keeps its reference.
+func (pw *packedRecordWriter) WriteBorrowed(r Record) error {
+	return pw.write(r, false)
+}
+
+func (pw *packedRecordWriter) write(r Record, release bool) error {
+	if pw.ctx != nil && pw.ctx.Err() != nil {
+		pw.releaseWritten(r, release)
+		return merr.Combine(merr.WrapErrServiceInternal("packed write canceled"), pw.ctx.Err())
+	}
+	if pw.interceptor != nil {
+		out, err := pw.intercept(r)
+		if out != r {
+			pw.releaseWritten(r, release)
+			// the writer owns the records returned by the interceptor
+			r, release = out, true
+		}
+		if err != nil {
+			if r != nil {
+				pw.releaseWritten(r, release)
+			}
+			return err
+		}
+	}
+	if err := pw.checkRecord(r); err != nil {
+		pw.releaseWritten(r, release)
+		return err
+	}
+	return pw.writeOrdered(r, release)
+}
+
+// intercept rewrites r with the interceptor of WithRecordInterceptor and checks the result.
+func (pw *packedRecordWriter) intercept(r Record) (Record, error) {
+	out, err := pw.interceptor(r)
+	if err != nil {
+		return out, err
+	}
+	if out == nil {
+		return nil, merr.WrapErrServiceInternal("record interceptor of packed writer returned no record")
+	}
+	for _, field := range typeutil.GetAllFieldSchemas(pw.schema) {
+		col := out.Column(field.GetFieldID())
+		if col == nil || col.Len() != out.Len() {
+			return out, merr.WrapErrParameterInvalidMsg("record returned by the record interceptor of packed writer lacks a column of %d rows for field %d",
+				out.Len(), field.GetFieldID())
+		}
+	}
+	return out, nil
+}
+
+// checkRecord checks that r holds a column of the writer schema type for every field, in schema order.
+func (pw *packedRecordWriter) checkRecord(r Record) error {
+	sar, isArrow := r.(*simpleArrowRecord)
+	if isArrow && int(sar.r.NumCols()) != pw.arrowSchema.NumFields() {
+		return merr.WrapErrParameterInvalid(pw.arrowSchema.NumFields(), int(sar.r.NumCols()), "number of columns of record written to packed writer")
+	}
+	for i, field := range typeutil.GetAllFieldSchemas(pw.schema) {
+		var col arrow.Array
+		if isArrow {
+			if c, ok := sar.field2Col[field.GetFieldID()]; ok && c != i {
+				return merr.WrapErrParameterInvalidMsg("field %d of record written to packed writer is column %d instead of %d", field.GetFieldID(), c, i)
+			}
+			col = sar.r.Column(i)
+		} else {
+			col = r.Column(field.GetFieldID())
+		}
+		if col == nil {
+			return merr.WrapErrParameterInvalidMsg("record written to packed writer lacks field %d", field.GetFieldID())
+		}
+		if col.Len() != r.Len() {
+			return merr.WrapErrParameterInvalidMsg("field %d of record written to packed writer holds %d rows of the %d of the record",
+				field.GetFieldID(), col.Len(), r.Len())
+		}
+		expected := pw.arrowSchema.Field(i).Type
+		got := col.DataType()
+		isString := arrow.TypeEqual(got, arrow.BinaryTypes.String)
+		// large strings are rejected with a hint by matchStringLayout
+		if !arrow.TypeEqual(got, expected) && !arrow.TypeEqual(got, arrow.BinaryTypes.LargeString) &&
+			!(isString && (expected.ID() == arrow.DICTIONARY || expected.ID() == arrow.LARGE_STRING)) {
+			return merr.WrapErrParameterInvalid(expected.String(), got.String(),
+				fmt.Sprintf("type of field %d of record written to packed writer", field.GetFieldID()))
+		}
+	}
+	return nil
+}
+
+// releaseWritten releases r taken over by Write, see Write.
+func (pw *packedRecordWriter) releaseWritten(r Record, release bool) {
+	if _, ok := r.(*simpleArrowRecord); ok && release {
+		r.Release()
+	}
+}
+
+func (pw *packedRecordWriter) writeBatch(r Record, release bool) error {
 	var rec arrow.Record
 	sar, ok := r.(*simpleArrowRecord)
 	if !ok {
@@ -65,13 +202,37 @@ func (pw *packedRecordWriter) Write(r Record) error {
 			arrays[i] = r.Column(field.FieldID)
 		}
 		rec = array.NewRecord(pw.arrowSchema, arrays, int64(r.Len()))
+		defer rec.Release()
 	} else {
 		rec = sar.r
+		if release {
+			defer rec.Release()
+		}
 	}
-	pw.rowNum += int64(r.Len())
+
+	rec, err := pw.matchStringLayout(rec)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+
+	sizes := make([]uint64, rec.NumCols())
+	var recordSize uint64
 	for col, arr := range rec.Columns() {
 		// size := arr.Data().SizeInBytes()
-		size := calculateActualDataSize(arr)
+		sizes[col] = calculateActualDataSize(arr)
+		recordSize += sizes[col]
+	}
+	if err := pw.checkRowSize(recordSize, r.Len()); err != nil {
+		return err
+	}
+	if err := pw.writer.WriteRecordBatch(rec); err != nil {
+		return err
+	}
+
+	// the rows are only accounted for once written
+	pw.rowNum += int64(r.Len())
+	for col, size := range sizes {
 		pw.writtenUncompressed += size
 		for _, columnGroup := range pw.columnGroups {
 			if lo.Contains(columnGroup.Columns, col) {
@@ -80,8 +241,109 @@ func (pw *packedRecordWriter) Write(r Record) error {
 			}
 		}
 	}
-	defer rec.Release()
-	return pw.writer.WriteRecordBatch(rec)
+	allFields := typeutil.GetAllFieldSchemas(pw.schema)
+	pkCol := r.Column(pw.pkField.GetFieldID())
+	low, high := pkBounds(pkCol)
+	pw.updatePKRange(low, high)
+	pw.updateFieldStats(r, allFields)
+	pw.writerSidecars.add(rec, allFields, pkCol, low, high, pw.rowNum-int64(r.Len()))
+	pw.writeVerifier.add(pkCol)
+	if pw.observer != nil {
+		pw.observer.OnWrite(r.Len(), recordSize)
+	}
+	return pw.syncFlushed(int64(recordSize))
+}
+
+// matchStringLayout returns rec, retained, with its string columns in the layout of the writer schema.
+func (pw *packedRecordWriter) matchStringLayout(rec arrow.Record) (arrow.Record, error) {
+	convert := false
+	for i, col := range rec.Columns() {
+		switch {
+		case arrow.TypeEqual(col.DataType(), pw.arrowSchema.Field(i).Type):
+		case arrow.TypeEqual(col.DataType(), arrow.BinaryTypes.String) && pw.arrowSchema.Field(i).Type.ID() == arrow.DICTIONARY:
+			convert = true
+		case arrow.TypeEqual(col.DataType(), arrow.BinaryTypes.String) && pw.largeStrings:
+			convert = true
+		case arrow.TypeEqual(col.DataType(), arrow.BinaryTypes.LargeString):
+			return nil, merr.WrapErrParameterInvalidMsg("string column %s exceeds 2GB within a batch, write it with WithLargeStringColumns",
+				pw.arrowSchema.Field(i).Name)
+		}
+	}
+	if !convert {
+		rec.Retain()
+		return rec, nil
+	}
+	arrays := make([]arrow.Array, rec.NumCols())
+	for i, col := range rec.Columns() {
+		if dt, ok := pw.arrowSchema.Field(i).Type.(*arrow.DictionaryType); ok && !arrow.TypeEqual(col.DataType(), dt) {
+			encoded, err := dictionaryEncode(pw.mem, col, dt)
+			if err != nil {
+				return nil, err
+			}
+			arrays[i] = encoded
+		} else if pw.largeStrings {
+			arrays[i] = widenStrings(pw.mem, col)
+		} else {
+			col.Retain()
+			arrays[i] = col
+		}
+		defer arrays[i].Release()
+	}
+	return array.NewRecord(pw.arrowSchema, arrays, rec.NumRows()), nil
+}
+
+// rowIDAssigner assigns the row ids of the serialized values, see WithAutoRowIDs.
+type rowIDAssigner struct {
+	autoRowIDs bool
+	rowIDBase  int64
+	nextRowID  int64
+}
+
+// assignRowIDs assigns the next row ids to the values of v lacking one.
+func (a *rowIDAssigner) assignRowIDs(v []*Value) error {
+	if !a.autoRowIDs {
+		return nil
+	}
+	for _, value := range v {
+		m := value.Value.(map[FieldID]any)
+		if id, ok := m[common.RowIDField]; ok && id != nil {
+			continue
+		}
+		if a.nextRowID == math.MaxInt64 {
+			return merr.WrapErrServiceInternal(fmt.Sprintf("row ids assigned from %d are exhausted", a.rowIDBase))
+		}
+		m[common.RowIDField] = a.nextRowID
+		value.ID = a.nextRowID
+		a.nextRowID++
+	}
+	return nil
+}
+
+// AssignedRowIDs returns the range [start, end) of the row ids assigned, final once closed.
+func (a *rowIDAssigner) AssignedRowIDs() (start, end int64) {
+	return a.rowIDBase, a.nextRowID
+}
+
+// checkRowSize detects rows larger than the write buffer, which flush on every row.
+func (pw *packedRecordWriter) checkRowSize(recordSize uint64, rows int) error {
+	if rows == 0 || pw.bufferSize <= 0 {
+		return nil
+	}
+	rowSize := recordSize / uint64(rows)
+	if rowSize <= uint64(pw.bufferSize) {
+		return nil
+	}
+	if pw.strictBufferSize {
+		return merr.WrapErrParameterInvalidMsg("estimated row size %d exceeds packed writer buffer size %d, use a larger buffer size", rowSize, pw.bufferSize)
+	}
+	if !pw.bufferSizeWarned {
+		log.Warn("estimated row size exceeds packed writer buffer size, writer will flush on every row, consider a larger buffer size",
+			zap.Uint64("rowSize", rowSize),
+			zap.Int64("bufferSize", pw.bufferSize),
+			zap.String("collection", pw.schema.GetName()))
+		pw.bufferSizeWarned = true
+	}
+	return nil
 }
 
 func (pw *packedRecordWriter) GetWrittenUncompressed() uint64 {
@@ -95,6 +357,15 @@ func (pw *packedRecordWriter) GetColumnGroupWrittenUncompressed(columnGroup type
 	return 0
 }
 
+// GetWrittenCompressed returns the size of the written files, 0 before Close.
+func (pw *packedRecordWriter) GetWrittenCompressed() uint64 {
+	var size uint64
+	for _, groupSize := range pw.columnGroupCompressed {
+		size += groupSize
+	}
+	return size
+}
+
 func (pw *packedRecordWriter) GetColumnGroupWrittenCompressed(columnGroup typeutil.UniqueID) uint64 {
 	if size, ok := pw.columnGroupCompressed[columnGroup]; ok {
 		return size
@@ -109,6 +380,34 @@ func (pw *packedRecordWriter) GetWrittenPaths(columnGroup typeutil.UniqueID) str
 	return ""
 }
 
+// ColumnGroupInfo is the file of a column group, see GetColumnGroupLayout.
+type ColumnGroupInfo struct {
+	GroupID typeutil.UniqueID
+	Path    string
+	// Columns are the column indices of the group in the schema, FieldIDs their fields.
+	Columns  []int
+	FieldIDs []FieldID
+}
+
+func (info ColumnGroupInfo) String() string {
+	return fmt.Sprintf("[GroupID: %d, Path: %s, ColumnIndices: %v, FieldIDs: %v]", info.GroupID, info.Path, info.Columns, info.FieldIDs)
+}
+
+// GetColumnGroupLayout returns the file and fields of every column group, in column group order.
+func (pw *packedRecordWriter) GetColumnGroupLayout() []ColumnGroupInfo {
+	allFields := typeutil.GetAllFieldSchemas(pw.schema)
+	return lo.Map(pw.columnGroups, func(columnGroup storagecommon.ColumnGroup, _ int) ColumnGroupInfo {
+		return ColumnGroupInfo{
+			GroupID: columnGroup.GroupID,
+			Path:    pw.pathsMap[columnGroup.GroupID],
+			Columns: columnGroup.Columns,
+			FieldIDs: lo.Map(columnGroup.Columns, func(col int, _ int) FieldID {
+				return allFields[col].GetFieldID()
+			}),
+		}
+	})
+}
+
 func (pw *packedRecordWriter) GetWrittenManifest() string {
 	return pw.outputManifest
 }
@@ -118,9 +417,17 @@ func (pw *packedRecordWriter) GetWrittenRowNum() int64 {
 }
 
 func (pw *packedRecordWriter) Close() error {
+	if pw.aborted {
+		return nil
+	}
 	if pw.writer != nil {
-		err := pw.writer.Close()
-		if err != nil {
+		// a Close retried after a failure past the native close does not close it again
+		if !pw.filesClosed {
+			if err := pw.closeFiles(); err != nil {
+				return err
+			}
+		}
+		if err := pw.syncOnClose(); err != nil {
 			return err
 		}
 		for id, fpath := range pw.pathsMap {
@@ -131,6 +438,156 @@ func (pw *packedRecordWriter) Close() error {
 			}
 			pw.columnGroupCompressed[id] = uint64(size)
 		}
+		pw.checkCompressedSize(pw.rowNum, pw.GetWrittenCompressed())
+		if pw.verify {
+			if err := pw.verifyWritten(); err != nil {
+				return err
+			}
+		}
+		if err := pw.writerSidecars.write(pw.sidecarContext()); err != nil {
+			return err
+		}
+	}
+	pw.closed = true
+	pw.observer = nil
+	return nil
+}
+
+// Abort closes the writer and deletes the files written so far, a no-op after Close.
+func (pw *packedRecordWriter) Abort() error {
+	if pw.closed || pw.aborted {
+		return nil
+	}
+	pw.aborted = true
+	pw.observer = nil
+	pw.rowOrder.release()
+	var errs error
+	if pw.writer != nil {
+		// the packed writer is closed unless closed already and its files removed
+		if err := pw.writer.Abort(); err != nil {
+			errs = merr.WrapErrIoFailedReason(err.Error(), "abort packed writer")
+		}
+	}
+	pw.writer = nil
+	return errs
+}
+
+// closeFiles flushes the rows buffered and closes the native writer.
+func (pw *packedRecordWriter) closeFiles() error {
+	if err := pw.flushSortBuffer(); err != nil {
+		return err
+	}
+	if pw.groupRows > 0 && pw.regroupBuffer.pendingRows > 0 {
+		if err := pw.flushRegrouped(pw.regroupBuffer.pendingRows); err != nil {
+			return err
+		}
+	}
+	if pw.rowNum == 0 {
+		if err := pw.writeEmptyBatch(); err != nil {
+			return err
+		}
+	}
+	err := pw.writer.Close()
+	pw.filesClosed = true
+	return err
+}
+
+// writeEmptyBatch writes a zero-row batch, so that empty segments still lay out their files.
+func (pw *packedRecordWriter) writeEmptyBatch() error {
+	arrays := make([]arrow.Array, len(pw.arrowSchema.Fields()))
+	for i, field := range pw.arrowSchema.Fields() {
+		builder := array.NewBuilder(pw.mem, field.Type)
+		arrays[i] = builder.NewArray()
+		builder.Release()
+	}
+	rec := array.NewRecord(pw.arrowSchema, arrays, 0)
+	for _, arr := range arrays {
+		arr.Release()
+	}
+	defer rec.Release()
+	return pw.writer.WriteRecordBatch(rec)
+}
+
+// WriteManifest serializes the metadata of the written files as JSON into w, after Close.
+func (pw *packedRecordWriter) WriteManifest(w io.Writer) error {
+	if !pw.closed {
+		return merr.WrapErrServiceInternal("packed record writer must be closed before writing manifest")
+	}
+	manifest := &PackedFileManifest{
+		RowNum:       pw.rowNum,
+		ColumnGroups: make([]PackedColumnGroupManifest, 0, len(pw.columnGroups)),
+	}
+	for _, info := range pw.GetColumnGroupLayout() {
+		manifest.ColumnGroups = append(manifest.ColumnGroups, PackedColumnGroupManifest{
+			GroupID:          info.GroupID,
+			Path:             info.Path,
+			Columns:          info.Columns,
+			FieldIDs:         info.FieldIDs,
+			UncompressedSize: pw.columnGroupUncompressed[info.GroupID],
+			CompressedSize:   pw.columnGroupCompressed[info.GroupID],
+		})
+	}
+	if pw.pkMin != nil {
+		manifest.PKRange = &PackedPKRange{
+			PkType: int64(pw.pkField.GetDataType()),
+			Min:    pw.pkMin,
+			Max:    pw.pkMax,
+		}
+	}
+	return json.NewEncoder(w).Encode(manifest)
+}
+
+// checkExistingSchema checks the existing file of each column group against schema, if any.
+func checkExistingSchema(
+	paths []string,
+	schema *schemapb.CollectionSchema,
+	columnGroups []storagecommon.ColumnGroup,
+	storageConfig *indexpb.StorageConfig,
+) error {
+	allFields := typeutil.GetAllFieldSchemas(schema)
+	for i, columnGroup := range columnGroups {
+		_, ok, err := statPackedFile(paths[i], storageConfig)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		fieldIDs := typeutil.NewSet(lo.Map(columnGroup.Columns, func(col int, _ int) int64 {
+			return allFields[col].GetFieldID()
+		})...)
+		existing, err := packed.GetFileSchema(paths[i], storageConfig)
+		if err != nil {
+			return merr.WrapErrIoFailed(paths[i], err)
+		}
+		if err := CheckSchemaCompatible(existing, projectSchema(schema, fieldIDs)); err != nil {
+			return errors.Wrapf(err, "overwrite packed file %s", paths[i])
+		}
+	}
+	return nil
+}
+
+// validateColumnGroups checks that columnGroups assign each column to exactly one group.
+func validateColumnGroups(columnGroups []storagecommon.ColumnGroup, numColumns int) error {
+	groupOf := make(map[int]int64, numColumns)
+	for _, group := range columnGroups {
+		for _, column := range group.Columns {
+			if column < 0 || column >= numColumns {
+				return merr.WrapErrParameterInvalid(fmt.Sprintf("column in [0, %d)", numColumns), strconv.Itoa(column),
+					fmt.Sprintf("column %d of column group %d is out of range", column, group.GroupID))
+			}
+			if other, ok := groupOf[column]; ok {
+				return merr.WrapErrParameterInvalid("column in a single group", strconv.Itoa(column),
+					fmt.Sprintf("column %d is in both column groups %d and %d", column, other, group.GroupID))
+			}
+			groupOf[column] = group.GroupID
+		}
+	}
+	for column := 0; column < numColumns; column++ {
+		if _, ok := groupOf[column]; !ok {
+			return merr.WrapErrParameterInvalid("column in a group", strconv.Itoa(column),
+				fmt.Sprintf("column %d is in no column group", column))
+		}
 	}
 	return nil
 }
@@ -144,18 +601,93 @@ func NewPackedRecordWriter(
 	columnGroups []storagecommon.ColumnGroup,
 	storageConfig *indexpb.StorageConfig,
 	storagePluginContext *indexcgopb.StoragePluginContext,
+	opts ...PackedRecordWriterOption,
 ) (*packedRecordWriter, error) {
+	options := &packedRecordWriterOptions{mem: memory.DefaultAllocator}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	// Validate PK field exists before proceeding
-	_, err := typeutil.GetPrimaryFieldSchema(schema)
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
 	if err != nil {
 		return nil, err
 	}
 
+	// a single path for several column groups is the prefix of conventional group paths
+	if len(paths) == 1 && len(columnGroups) > 1 {
+		paths = GenColumnGroupPaths(paths[0], len(columnGroups))
+	}
+	if len(paths) != len(columnGroups) {
+		return nil, merr.WrapErrParameterInvalid(len(paths), len(columnGroups),
+			"paths length is not equal to column groups length for packed record writer")
+	}
+
+	if options.maxSegmentSize > 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("max segment size only applies to rolling packed writers")
+	}
+	if options.adaptiveBuffer {
+		return nil, merr.WrapErrParameterInvalidMsg("adaptive buffer size only applies to rolling packed writers")
+	}
+	sidecars, err := newWriterSidecars(schema, pkField, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.deterministicRows < 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid deterministic output of %d rows per group", options.deterministicRows)
+	}
+	if options.deterministicRows > 0 {
+		options.rowGroupSize = options.deterministicRows
+	}
+
+	if options.perGroupBufferSize != nil && len(options.perGroupBufferSize) != len(columnGroups) {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid per group buffer sizes %v for %d column groups",
+			options.perGroupBufferSize, len(columnGroups))
+	}
+
+	if options.compressionByGroup != nil {
+		if len(options.compressionByGroup) != len(columnGroups) {
+			return nil, merr.WrapErrParameterInvalidMsg("invalid compressions %v for %d column groups",
+				options.compressionByGroup, len(columnGroups))
+		}
+		for i, spec := range options.compressionByGroup {
+			if err := spec.Validate(); err != nil {
+				return nil, merr.WrapErrParameterInvalidMsg("invalid compression of column group %d: %s", columnGroups[i].GroupID, err.Error())
+			}
+		}
+	}
+
 	arrowSchema, err := ConvertToArrowSchema(schema, false)
 	if err != nil {
 		return nil, merr.WrapErrServiceInternal(
 			fmt.Sprintf("can not convert collection schema %s to arrow schema: %s", schema.Name, err.Error()))
 	}
+	if err := validateColumnGroups(columnGroups, arrowSchema.NumFields()); err != nil {
+		return nil, err
+	}
+	if options.largeStrings {
+		arrowSchema = largeStringSchema(arrowSchema)
+	}
+	if err := checkDictionaryFields(schema, options.dictionaryFields); err != nil {
+		return nil, err
+	}
+	arrowSchema = dictionarySchema(arrowSchema, schema, options.dictionaryFields)
+	arrowSchema = withPackedFormatVersion(arrowSchema, currentPackedFormatVersion)
+	arrowSchema = withSchemaMetadata(arrowSchema, serdeVersionKey, strconv.Itoa(SerdeVersion))
+	arrowSchema = withSchemaMetadata(arrowSchema, schemaFingerprintKey, SchemaFingerprint(schema))
+	// sorted for the files of equal metadata to be identical
+	metadataKeys := lo.Keys(options.schemaMetadata)
+	sort.Strings(metadataKeys)
+	for _, key := range metadataKeys {
+		if strings.HasPrefix(key, reservedMetadataPrefix) {
+			return nil, merr.WrapErrParameterInvalidMsg("schema metadata key %s of packed writer is reserved", key)
+		}
+		arrowSchema = withSchemaMetadata(arrowSchema, key, options.schemaMetadata[key])
+	}
+	if options.deterministicRows > 0 {
+		arrowSchema = sortSchemaMetadata(arrowSchema)
+	}
 	// if storage config is not passed, use common config
 	storageType := paramtable.Get().CommonCfg.StorageType.GetValue()
 	if storageConfig != nil {
@@ -169,7 +701,14 @@ func NewPackedRecordWriter(
 		}
 		return path.Join(bucketName, p)
 	})
-	writer, err := packed.NewPackedWriter(truePaths, arrowSchema, bufferSize, multiPartUploadSize, columnGroups, storageConfig, storagePluginContext)
+	if options.schemaGuard {
+		if err := checkExistingSchema(truePaths, schema, columnGroups, storageConfig); err != nil {
+			return nil, err
+		}
+	}
+	writer, err := packed.NewPackedWriter(truePaths, arrowSchema, bufferSize, multiPartUploadSize, columnGroups, storageConfig, storagePluginContext,
+		packed.WithRowGroupSize(options.rowGroupSize), packed.WithGroupBufferSizes(options.perGroupBufferSize),
+		packed.WithGroupCompressions(options.compressionByGroup))
 	if err != nil {
 		return nil, merr.WrapErrServiceInternal(
 			fmt.Sprintf("can not new packed record writer %s", err.Error()))
@@ -177,16 +716,13 @@ func NewPackedRecordWriter(
 	columnGroupUncompressed := make(map[typeutil.UniqueID]uint64)
 	columnGroupCompressed := make(map[typeutil.UniqueID]uint64)
 	pathsMap := make(map[typeutil.UniqueID]string)
-	if len(paths) != len(columnGroups) {
-		return nil, merr.WrapErrParameterInvalid(len(paths), len(columnGroups),
-			"paths length is not equal to column groups length for packed record writer")
-	}
 	for i, columnGroup := range columnGroups {
 		columnGroupUncompressed[columnGroup.GroupID] = 0
 		columnGroupCompressed[columnGroup.GroupID] = 0
 		pathsMap[columnGroup.GroupID] = paths[i]
 	}
-	return &packedRecordWriter{
+	allFields := typeutil.GetAllFieldSchemas(schema)
+	pw := &packedRecordWriter{
 		writer:                  writer,
 		schema:                  schema,
 		arrowSchema:             arrowSchema,
@@ -197,7 +733,27 @@ func NewPackedRecordWriter(
 		columnGroupUncompressed: columnGroupUncompressed,
 		columnGroupCompressed:   columnGroupCompressed,
 		storageConfig:           storageConfig,
-	}, nil
+		storagePluginContext:    storagePluginContext,
+		truePaths:               truePaths,
+		pkField:                 pkField,
+		strictBufferSize:        options.strictBufferSize,
+		largeStrings:            options.largeStrings,
+		serializerOptions:       options.serializerOptions,
+		interceptor:             options.interceptor,
+		ctx:                     options.ctx,
+		observer:                options.observer,
+		mem:                     options.mem,
+		rowIDAssigner:           rowIDAssigner{autoRowIDs: options.autoRowIDs, rowIDBase: options.rowIDBase, nextRowID: options.rowIDBase},
+		rowOrder:                newRowOrder(allFields, options),
+		segmentStatsCollector:   newSegmentStatsCollector(allFields, options.segmentStats, options.minCompressedSize),
+		writerSidecars:          sidecars,
+		writeVerifier:           writeVerifier{verify: options.verify, verifyPKs: options.verifyPKs},
+		fileSyncer:              newFileSyncer(options.durability, truePaths, storageType == "local", bufferSize),
+	}
+	if pw.zeroVectors != nil {
+		pw.serializerOptions = append(pw.serializerOptions, WithZeroNullVectors(options.zeroVectorField, &pw.zeroVectors.RowIDs))
+	}
+	return pw, nil
 }
 
 type packedRecordManifestWriter struct {
@@ -355,16 +911,112 @@ func NewPackedRecordManifestWriter(
 	}, nil
 }
 
+const columnGroupPathPrefix = "group_"
+
+// GenColumnGroupPaths returns the paths prefix/group_0 to prefix/group_{numGroups-1}.
+func GenColumnGroupPaths(prefix string, numGroups int) []string {
+	paths := make([]string, numGroups)
+	for i := range paths {
+		paths[i] = path.Join(prefix, columnGroupPathPrefix+strconv.Itoa(i))
+	}
+	return paths
+}
+
+// ParseColumnGroupPath is the inverse of GenColumnGroupPaths.
+func ParseColumnGroupPath(p string) (string, int, error) {
+	prefix, name := path.Split(p)
+	indexStr, ok := strings.CutPrefix(name, columnGroupPathPrefix)
+	if !ok {
+		return "", 0, merr.WrapErrParameterInvalidMsg("path %s is not a column group path", p)
+	}
+	index, err := strconv.Atoi(indexStr)
+	if err != nil || index < 0 || strconv.Itoa(index) != indexStr {
+		return "", 0, merr.WrapErrParameterInvalidMsg("invalid column group index in path %s", p)
+	}
+	return path.Clean(prefix), index, nil
+}
+
 // Deprecated, todo remove
 func NewPackedSerializeWriter(bucketName string, paths []string, schema *schemapb.CollectionSchema, bufferSize int64,
-	multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, batchSize int,
+	multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, batchSize int, opts ...PackedRecordWriterOption,
 ) (*SerializeWriterImpl[*Value], error) {
-	packedRecordWriter, err := NewPackedRecordWriter(bucketName, paths, schema, bufferSize, multiPartUploadSize, columnGroups, nil, nil)
+	packedRecordWriter, err := NewPackedRecordWriter(bucketName, paths, schema, bufferSize, multiPartUploadSize, columnGroups, nil, nil, opts...)
 	if err != nil {
 		return nil, merr.WrapErrServiceInternal(
 			fmt.Sprintf("can not new packed record writer %s", err.Error()))
 	}
 	return NewSerializeRecordWriter(packedRecordWriter, func(v []*Value) (Record, error) {
-		return ValueSerializer(v, schema)
+		if err := packedRecordWriter.assignRowIDs(v); err != nil {
+			return nil, err
+		}
+		return ValueSerializer(v, schema, packedRecordWriter.serializerOptions...)
 	}, batchSize), nil
 }
+
+// NewPackedPartialSerializeWriter writes the partial values of upserts, see WithPartialValues.
+func NewPackedPartialSerializeWriter(bucketName string, paths []string, schema *schemapb.CollectionSchema, bufferSize int64,
+	multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, batchSize int, opts ...PackedRecordWriterOption,
+) (*SerializeWriterImpl[*Value], error) {
+	opts = append(opts[:len(opts):len(opts)], WithSerializerOptions(WithPartialValues()))
+	return NewPackedSerializeWriter(bucketName, paths, PartialSchema(schema), bufferSize, multiPartUploadSize, columnGroups, batchSize, opts...)
+}
+
+// NewPackedSerializeWriterWithBatchBytes serializes batches of about batchBytes bytes, see EstimateRowBytes.
+func NewPackedSerializeWriterWithBatchBytes(bucketName string, paths []string, schema *schemapb.CollectionSchema, bufferSize int64,
+	multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, batchBytes int64, varLenBytes int64, opts ...PackedRecordWriterOption,
+) (*SerializeWriterImpl[*Value], error) {
+	if batchBytes <= 0 || varLenBytes < 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid batch bytes %d with variable length bytes %d", batchBytes, varLenBytes)
+	}
+	rowBytes, err := EstimateRowBytes(schema, varLenBytes)
+	if err != nil {
+		return nil, err
+	}
+	packedRecordWriter, err := NewPackedRecordWriter(bucketName, paths, schema, bufferSize, multiPartUploadSize, columnGroups, nil, nil, opts...)
+	if err != nil {
+		return nil, merr.WrapErrServiceInternal(
+			fmt.Sprintf("can not new packed record writer %s", err.Error()))
+	}
+	return NewSerializeRecordWriterWithBatchBytes(packedRecordWriter, func(v []*Value) (Record, error) {
+		if err := packedRecordWriter.assignRowIDs(v); err != nil {
+			return nil, err
+		}
+		return ValueSerializer(v, schema, packedRecordWriter.serializerOptions...)
+	}, batchBytes, rowBytes), nil
+}
+
+// EstimateRowBytes estimates the row size of schema, counting varLenBytes per variable length field.
+func EstimateRowBytes(schema *schemapb.CollectionSchema, varLenBytes int64) (int64, error) {
+	var size int64
+	for _, field := range typeutil.GetAllFieldSchemas(schema) {
+		switch field.GetDataType() {
+		case schemapb.DataType_Bool, schemapb.DataType_Int8:
+			size++
+		case schemapb.DataType_Int16:
+			size += 2
+		case schemapb.DataType_Int32, schemapb.DataType_Float:
+			size += 4
+		case schemapb.DataType_Int64, schemapb.DataType_Double, schemapb.DataType_Timestamptz:
+			size += 8
+		case schemapb.DataType_FloatVector, schemapb.DataType_BinaryVector, schemapb.DataType_Float16Vector,
+			schemapb.DataType_BFloat16Vector, schemapb.DataType_Int8Vector:
+			dim, err := typeutil.GetDim(field)
+			if err != nil {
+				return 0, merr.WrapErrParameterInvalidMsg("no dim of vector field %d: %s", field.GetFieldID(), err.Error())
+			}
+			switch field.GetDataType() {
+			case schemapb.DataType_FloatVector:
+				size += dim * 4
+			case schemapb.DataType_BinaryVector:
+				size += dim / 8
+			case schemapb.DataType_Float16Vector, schemapb.DataType_BFloat16Vector:
+				size += dim * 2
+			default:
+				size += dim
+			}
+		default:
+			size += varLenBytes
+		}
+	}
+	return size, nil
+}
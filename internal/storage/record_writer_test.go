@@ -0,0 +1,1465 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/util/initcore"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/objectstorage"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// writePackedTestSegment writes size rows generated by generateTestData into
+// a single column group at paths and returns the closed writer.
+func writePackedTestSegment(t testing.TB, paths []string, size int, opts ...PackedRecordWriterOption) *packedRecordWriter {
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(generateTestSchema().Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	return writePackedTestSegmentWithGroups(t, paths, []storagecommon.ColumnGroup{group}, size, opts...)
+}
+
+// writePackedTestSegmentWithGroups is writePackedTestSegment with one file per column group.
+func writePackedTestSegmentWithGroups(t testing.TB, paths []string, groups []storagecommon.ColumnGroup, size int, opts ...PackedRecordWriterOption) *packedRecordWriter {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+
+	blobs, err := generateTestData(size)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), false)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	pw, err := NewPackedRecordWriter("", paths, schema, 10*1024*1024, 0, groups, nil, nil, opts...)
+	require.NoError(t, err)
+	writer := NewSerializeRecordWriter(pw, func(v []*Value) (Record, error) {
+		return ValueSerializer(v, schema)
+	}, 7)
+	for i := 0; i < size; i++ {
+		value, err := reader.NextValue()
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteValue(*value))
+	}
+	require.NoError(t, writer.Close())
+	return pw
+}
+
+func TestPackedRecordWriterManifest(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		size := 10
+		pw := writePackedTestSegment(t, []string{"/tmp/manifest/0"}, size)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, pw.WriteManifest(buf))
+
+		manifest, err := ReadPackedFileManifest(buf)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), manifest.RowNum)
+		assert.Equal(t, []string{"/tmp/manifest/0"}, manifest.Paths())
+		require.Len(t, manifest.ColumnGroups, 1)
+		group := manifest.ColumnGroups[0]
+		assert.Equal(t, storagecommon.DefaultShortColumnGroupID, group.GroupID)
+		assert.Len(t, group.FieldIDs, len(generateTestSchema().Fields))
+		assert.Contains(t, group.FieldIDs, common.RowIDField)
+		assert.Equal(t, pw.GetColumnGroupWrittenUncompressed(group.GroupID), group.UncompressedSize)
+		assert.Equal(t, pw.GetColumnGroupWrittenCompressed(group.GroupID), group.CompressedSize)
+		require.NotNil(t, manifest.PKRange)
+		assert.True(t, manifest.PKRange.Min.EQ(NewInt64PrimaryKey(1)))
+		assert.True(t, manifest.PKRange.Max.EQ(NewInt64PrimaryKey(int64(size))))
+	})
+
+	t.Run("not closed", func(t *testing.T) {
+		pw := &packedRecordWriter{}
+		assert.Error(t, pw.WriteManifest(&bytes.Buffer{}))
+	})
+}
+
+func TestPackedRecordWriterRowGroupSize(t *testing.T) {
+	size := 25
+	paths := []string{"/tmp/row_group_size/0"}
+	writePackedTestSegment(t, paths, size, WithRowGroupSize(10))
+
+	reader, err := file.OpenParquetFile(paths[0], false)
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.Equal(t, int64(size), reader.NumRows())
+	assert.GreaterOrEqual(t, reader.NumRowGroups(), 3)
+	for i := 0; i < reader.NumRowGroups(); i++ {
+		assert.LessOrEqual(t, reader.MetaData().RowGroup(i).NumRows(), int64(10))
+	}
+}
+
+func TestPackedRecordWriterCheckRowSize(t *testing.T) {
+	t.Run("warn", func(t *testing.T) {
+		pw := &packedRecordWriter{bufferSize: 100, schema: generateTestSchema()}
+		assert.NoError(t, pw.checkRowSize(200, 2))
+		assert.False(t, pw.bufferSizeWarned)
+		assert.NoError(t, pw.checkRowSize(202, 2))
+		assert.True(t, pw.bufferSizeWarned)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		pw := &packedRecordWriter{bufferSize: 100, schema: generateTestSchema(), strictBufferSize: true}
+		assert.NoError(t, pw.checkRowSize(0, 0))
+		assert.NoError(t, pw.checkRowSize(100, 1))
+		assert.Error(t, pw.checkRowSize(101, 1))
+	})
+}
+
+func TestColumnGroupPaths(t *testing.T) {
+	paths := GenColumnGroupPaths("/tmp/prefix", 3)
+	assert.Equal(t, []string{"/tmp/prefix/group_0", "/tmp/prefix/group_1", "/tmp/prefix/group_2"}, paths)
+	for i, p := range paths {
+		prefix, index, err := ParseColumnGroupPath(p)
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp/prefix", prefix)
+		assert.Equal(t, i, index)
+	}
+
+	for _, p := range []string{"/tmp/prefix/0", "/tmp/prefix/group_", "/tmp/prefix/group_x", "/tmp/prefix/group_01", "/tmp/prefix/group_-1"} {
+		_, _, err := ParseColumnGroupPath(p)
+		assert.Error(t, err, p)
+	}
+}
+
+func TestPackedRecordWriterInvalidColumnGroups(t *testing.T) {
+	schema := generateTestSchema()
+	all := make([]int, len(schema.Fields))
+	for i := range all {
+		all[i] = i
+	}
+	for _, tc := range []struct {
+		name   string
+		groups []storagecommon.ColumnGroup
+		err    string
+	}{
+		{"out of range", []storagecommon.ColumnGroup{{GroupID: 0, Columns: append(all[:len(all):len(all)], len(all))}},
+			fmt.Sprintf("column %d of column group 0 is out of range", len(all))},
+		{"negative", []storagecommon.ColumnGroup{{GroupID: 3, Columns: append([]int{-1}, all...)}},
+			"column -1 of column group 3 is out of range"},
+		{"duplicate", []storagecommon.ColumnGroup{{GroupID: 0, Columns: all}, {GroupID: 1, Columns: []int{1}}},
+			"column 1 is in both column groups 0 and 1"},
+		{"missing", []storagecommon.ColumnGroup{{GroupID: 0, Columns: all[:2]}, {GroupID: 1, Columns: all[3:]}},
+			"column 2 is in no column group"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := make([]string, len(tc.groups))
+			for i := range paths {
+				paths[i] = fmt.Sprintf("/tmp/invalid_column_groups/%d", i)
+			}
+			_, err := NewPackedRecordWriter("", paths, schema, 1024, 0, tc.groups, nil, nil)
+			assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestPackedRecordWriterPathPrefix(t *testing.T) {
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	pw := writePackedTestSegmentWithGroups(t, []string{"/tmp/path_prefix"}, groups, 10)
+
+	paths := GenColumnGroupPaths("/tmp/path_prefix", len(groups))
+	for i, group := range groups {
+		assert.Equal(t, paths[i], pw.GetWrittenPaths(group.GroupID))
+	}
+	rows, err := CountRows(paths, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rows)
+}
+
+func TestPackedRecordWriterAbort(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+
+	t.Run("abort midway", func(t *testing.T) {
+		paths := []string{"/tmp/abort/0"}
+		writer, err := NewPackedSerializeWriter("", paths, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, 3)
+		require.NoError(t, err)
+		blobs, err := generateTestData(10)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		defer reader.Close()
+		for i := 0; i < 5; i++ {
+			value, err := reader.NextValue()
+			require.NoError(t, err)
+			require.NoError(t, writer.WriteValue(*value))
+		}
+
+		require.NoError(t, writer.Abort())
+		_, err = os.Stat(paths[0])
+		assert.True(t, os.IsNotExist(err))
+		// idempotent
+		assert.NoError(t, writer.Abort())
+		assert.NoError(t, writer.rw.Close())
+	})
+
+	t.Run("abort after close", func(t *testing.T) {
+		paths := []string{"/tmp/abort/1"}
+		pw := writePackedTestSegment(t, paths, 10)
+		assert.NoError(t, pw.Abort())
+		_, err := os.Stat(paths[0])
+		assert.NoError(t, err)
+	})
+}
+
+// countingRecord counts the releases of an arrow record.
+type countingRecord struct {
+	arrow.Record
+	released int
+}
+
+func (r *countingRecord) Release() {
+	r.released++
+	r.Record.Release()
+}
+
+func TestPackedRecordWriterWriteBorrowed(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+
+	size := 10
+	blobs, err := generateTestData(size)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	serialized, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	sar := serialized.(*simpleArrowRecord)
+	counting := &countingRecord{Record: sar.r}
+	rec := NewSimpleArrowRecord(counting, sar.field2Col)
+
+	// fan the record out to two writers, then hand it over to a third one
+	paths := []string{"/tmp/write_borrowed/0", "/tmp/write_borrowed/1", "/tmp/write_borrowed/2"}
+	for i, p := range paths {
+		pw, err := NewPackedRecordWriter("", []string{p}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, nil, nil)
+		require.NoError(t, err)
+		if i < 2 {
+			require.NoError(t, pw.WriteBorrowed(rec))
+			assert.Equal(t, 0, counting.released)
+			assert.Equal(t, size, rec.Column(common.RowIDField).Len())
+		} else {
+			require.NoError(t, pw.Write(rec))
+			assert.Equal(t, 1, counting.released)
+		}
+		require.NoError(t, pw.Close())
+	}
+
+	for _, p := range paths {
+		rows, err := CountRows([]string{p}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), rows)
+	}
+}
+
+func TestPackedRecordWriterVerifyAfterWrite(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+
+	t.Run("verified", func(t *testing.T) {
+		pw := writePackedTestSegment(t, []string{"/tmp/verify/0"}, 10, WithVerifyAfterWrite(true))
+		assert.Equal(t, int64(10), pw.GetWrittenRowNum())
+	})
+
+	t.Run("empty segment", func(t *testing.T) {
+		writePackedTestSegment(t, []string{"/tmp/verify/1"}, 0, WithVerifyAfterWrite(true))
+	})
+
+	newWriter := func(path string, checksumPKs bool) *packedRecordWriter {
+		schema := generateTestSchema()
+		group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+		for i := 0; i < len(schema.Fields); i++ {
+			group.Columns = append(group.Columns, i)
+		}
+		pw, err := NewPackedRecordWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, nil, nil,
+			WithVerifyAfterWrite(checksumPKs))
+		require.NoError(t, err)
+		blobs, err := generateTestData(10)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		rec, err := ValueSerializer(values, schema)
+		require.NoError(t, err)
+		require.NoError(t, pw.Write(rec))
+		return pw
+	}
+
+	t.Run("row count mismatch", func(t *testing.T) {
+		pw := newWriter("/tmp/verify/2", false)
+		pw.rowNum++
+		assert.Error(t, pw.Close())
+	})
+
+	t.Run("pk mismatch", func(t *testing.T) {
+		pw := newWriter("/tmp/verify/3", true)
+		pw.pkChecksum++
+		assert.Error(t, pw.Close())
+
+		// without the checksum only the row count is verified
+		pw = newWriter("/tmp/verify/4", false)
+		pw.pkChecksum++
+		assert.NoError(t, pw.Close())
+	})
+}
+
+func TestPackedRecordWriterDurability(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	dir := t.TempDir()
+
+	for i, level := range []DurabilityLevel{DurabilityNone, DurabilityOnClose, DurabilityPerFlush} {
+		paths := []string{path.Join(dir, strconv.Itoa(i))}
+		pw := writePackedTestSegment(t, paths, 20, WithDurability(level))
+		assert.Equal(t, level, pw.durability)
+		assert.True(t, pw.localFiles)
+		rows, err := CountRows(paths, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(20), rows)
+	}
+
+	t.Run("per flush", func(t *testing.T) {
+		file := path.Join(dir, "flushed")
+		require.NoError(t, os.WriteFile(file, []byte("data"), 0o644))
+		pw := &packedRecordWriter{durability: DurabilityPerFlush, localFiles: true, syncEvery: 100, truePaths: []string{file}}
+		require.NoError(t, pw.syncFlushed(60))
+		assert.Equal(t, int64(60), pw.unsynced)
+		require.NoError(t, pw.syncFlushed(60))
+		assert.Equal(t, int64(0), pw.unsynced)
+
+		// files not created yet are skipped until close
+		pw.truePaths = append(pw.truePaths, path.Join(dir, "missing"))
+		assert.NoError(t, pw.syncFiles(false))
+		assert.ErrorIs(t, pw.syncFiles(true), merr.ErrIoFailed)
+	})
+
+	t.Run("object storage", func(t *testing.T) {
+		pw := &packedRecordWriter{durability: DurabilityPerFlush, syncEvery: 1, truePaths: []string{path.Join(dir, "missing")}}
+		assert.NoError(t, pw.syncFlushed(10))
+		assert.Equal(t, int64(0), pw.unsynced)
+	})
+}
+
+func TestPackedRecordWriterPKBloomFilter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cm := NewLocalChunkManager(objectstorage.RootPath(dir))
+	bloomPath := path.Join(dir, "stats", "1")
+
+	pw := writePackedTestSegment(t, []string{path.Join(dir, "0")}, 20, WithPKBloomFilter(cm, bloomPath, 100, 0.001))
+	assert.Equal(t, bloomPath, pw.GetBloomFilterPath())
+	ok, err := ContainsAnyPK(ctx, cm, bloomPath, []PrimaryKey{NewInt64PrimaryKey(100), NewInt64PrimaryKey(5)})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = ContainsAnyPK(ctx, cm, bloomPath, []PrimaryKey{NewInt64PrimaryKey(0), NewInt64PrimaryKey(21)})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	pw = writePackedTestSegment(t, []string{path.Join(dir, "2")}, 20)
+	assert.Empty(t, pw.GetBloomFilterPath())
+
+	assert.Nil(t, pw.GetPKBloomFilter())
+
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: []int{0}}
+	_, err = NewPackedRecordWriter("", []string{path.Join(dir, "3")}, generateTestSchema(), 1024, 0,
+		[]storagecommon.ColumnGroup{group}, nil, nil, WithPKBloomFilter(cm, bloomPath, 0, 1.5))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	t.Run("in memory", func(t *testing.T) {
+		pw := writePackedTestSegment(t, []string{path.Join(dir, "4")}, 20, WithInMemoryPKBloomFilter(100, 0.001))
+		assert.Empty(t, pw.GetBloomFilterPath())
+		stats := pw.GetPKBloomFilter()
+		require.NotNil(t, stats)
+		assert.Equal(t, int64(schemapb.DataType_Int64), stats.PkType)
+		pks := &PkStatistics{PkFilter: stats.BF, MinPK: stats.MinPk, MaxPK: stats.MaxPk}
+		assert.True(t, pks.PkExist(NewInt64PrimaryKey(5)))
+		assert.False(t, pks.PkExist(NewInt64PrimaryKey(21)))
+
+		// the in-memory filter matches the one saved as a stats log
+		saved := pw
+		pw = writePackedTestSegment(t, []string{path.Join(dir, "5")}, 20, WithPKBloomFilter(cm, path.Join(dir, "stats", "5"), 100, 0.001))
+		assert.Equal(t, saved.GetPKBloomFilter().BF, pw.GetPKBloomFilter().BF)
+	})
+}
+
+func TestPackedRecordWriterZeroVectorPlaceholders(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	ctx := context.Background()
+	dir := t.TempDir()
+	cm := NewLocalChunkManager(objectstorage.RootPath(dir))
+	sidecar := path.Join(dir, "zero_vectors")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := range schema.Fields {
+		group.Columns = append(group.Columns, i)
+	}
+	groups := []storagecommon.ColumnGroup{group}
+
+	blobs, err := generateTestData(10)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	for _, i := range []int{2, 7} {
+		values[i].Value.(map[FieldID]any)[102] = nil
+	}
+
+	paths := []string{path.Join(dir, "0")}
+	writer, err := NewPackedSerializeWriter("", paths, schema, 1024*1024, 0, groups, 4, WithZeroVectorPlaceholders(102, cm, sidecar))
+	require.NoError(t, err)
+	for _, v := range values {
+		require.NoError(t, writer.WriteValue(v))
+	}
+	require.NoError(t, writer.Close())
+
+	rows, err := ReadZeroVectorRows(ctx, cm, sidecar)
+	require.NoError(t, err)
+	assert.Equal(t, &ZeroVectorRows{FieldID: 102, RowIDs: []int64{values[2].ID, values[7].ID}}, rows)
+	read, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024*1024, true)
+	require.NoError(t, err)
+	readValues, err := ReadAllValues(read)
+	require.NoError(t, err)
+	require.Len(t, readValues, 10)
+	assert.Equal(t, make([]float32, 8), readValues[2].Value.(map[FieldID]any)[102])
+	assert.NotEqual(t, make([]float32, 8), readValues[3].Value.(map[FieldID]any)[102])
+
+	// without the placeholders the nils of the non-nullable vector fail
+	writer, err = NewPackedSerializeWriter("", []string{path.Join(dir, "1")}, schema, 1024*1024, 0, groups, 4)
+	require.NoError(t, err)
+	for _, v := range values {
+		if err = writer.WriteValue(v); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	require.NoError(t, writer.Abort())
+
+	_, err = NewPackedRecordWriter("", []string{path.Join(dir, "2")}, schema, 1024, 0, groups, nil, nil,
+		WithZeroVectorPlaceholders(13, cm, sidecar))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedRecordWriterSchemaMetadata(t *testing.T) {
+	dir := t.TempDir()
+	metadata := map[string]string{"collection_id": "1", "segment_id": "2", "ingested_at": "2024-01-01T00:00:00Z"}
+	paths := []string{path.Join(dir, "0")}
+	writePackedTestSegment(t, paths, 10, WithSchemaMetadata(metadata))
+	read, err := ReadPackedSchemaMetadata(paths)
+	require.NoError(t, err)
+	assert.Equal(t, metadata, read)
+	rows, err := CountRows(paths, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rows)
+
+	paths = []string{path.Join(dir, "1")}
+	writePackedTestSegment(t, paths, 10)
+	read, err = ReadPackedSchemaMetadata(paths)
+	require.NoError(t, err)
+	assert.Empty(t, read)
+
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: []int{0}}
+	_, err = NewPackedRecordWriter("", []string{path.Join(dir, "2")}, generateTestSchema(), 1024, 0,
+		[]storagecommon.ColumnGroup{group}, nil, nil, WithSchemaMetadata(map[string]string{schemaFingerprintKey: "0"}))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = ReadPackedSchemaMetadata([]string{path.Join(dir, "missing")})
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+}
+
+func TestPackedRecordWriterSchemaGuard(t *testing.T) {
+	paths := []string{"/tmp/schema_guard/0"}
+	writePackedTestSegment(t, paths, 10)
+	newWriter := func(paths []string, schema *schemapb.CollectionSchema) error {
+		group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+		for i := 0; i < len(schema.Fields); i++ {
+			group.Columns = append(group.Columns, i)
+		}
+		pw, err := NewPackedRecordWriter("", paths, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, nil, nil, WithSchemaGuard())
+		if err == nil {
+			assert.NoError(t, pw.Abort())
+		}
+		return err
+	}
+
+	t.Run("same schema", func(t *testing.T) {
+		writePackedTestSegment(t, paths, 10, WithSchemaGuard())
+	})
+
+	t.Run("changed schema", func(t *testing.T) {
+		schema := generateTestSchema()
+		for _, field := range schema.Fields {
+			if field.GetFieldID() == 13 {
+				field.DataType = schemapb.DataType_Int32
+			}
+		}
+		assert.Error(t, newWriter(paths, schema))
+
+		schema = generateTestSchema()
+		schema.Fields = schema.Fields[:len(schema.Fields)-1]
+		assert.Error(t, newWriter(paths, schema))
+
+		// the existing files are left untouched
+		rows, err := CountRows(paths, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), rows)
+	})
+
+	t.Run("no existing file", func(t *testing.T) {
+		assert.NoError(t, newWriter([]string{"/tmp/schema_guard/absent"}, generateTestSchema()))
+	})
+}
+
+func TestPackedRecordWriterCompressionRatios(t *testing.T) {
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	assert.Nil(t, (&packedRecordWriter{}).CompressionRatios())
+	assert.Zero(t, (&packedRecordWriter{writtenUncompressed: 10}).CompressionRatio())
+
+	pw := writePackedTestSegmentWithGroups(t, []string{"/tmp/compression_ratios"}, groups, 100)
+	ratios := pw.CompressionRatios()
+	require.Len(t, ratios, len(schema.Fields))
+	for _, group := range groups {
+		expected := float64(pw.GetColumnGroupWrittenUncompressed(group.GroupID)) / float64(pw.GetColumnGroupWrittenCompressed(group.GroupID))
+		for _, col := range group.Columns {
+			assert.Equal(t, expected, ratios[schema.Fields[col].GetFieldID()])
+		}
+	}
+	assert.Greater(t, ratios[common.RowIDField], 0.0)
+	assert.Equal(t, float64(pw.GetWrittenUncompressed())/float64(pw.GetWrittenCompressed()), pw.CompressionRatio())
+}
+
+func TestPackedRecordWriterColumnGroupLayout(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 102, Columns: []int{13}}, {GroupID: 2}}
+	for i := 2; i < len(schema.Fields); i++ {
+		if i != 13 {
+			groups[2].Columns = append(groups[2].Columns, i)
+		}
+	}
+	paths := []string{"/tmp/column_group_layout/0", "/tmp/column_group_layout/102", "/tmp/column_group_layout/2"}
+	pw, err := NewPackedRecordWriter("", paths, schema, 1024, 0, groups, nil, nil)
+	require.NoError(t, err)
+	defer pw.Abort()
+
+	layout := pw.GetColumnGroupLayout()
+	require.Len(t, layout, len(groups))
+	for i, info := range layout {
+		assert.Equal(t, groups[i].GroupID, info.GroupID)
+		assert.Equal(t, paths[i], info.Path)
+		assert.Equal(t, groups[i].Columns, info.Columns)
+		assert.Equal(t, lo.Map(groups[i].Columns, func(col int, _ int) FieldID { return schema.Fields[col].GetFieldID() }), info.FieldIDs)
+	}
+	assert.Equal(t, []FieldID{common.TimeStampField, common.RowIDField}, layout[0].FieldIDs)
+	assert.Equal(t, []FieldID{102}, layout[1].FieldIDs)
+	assert.Equal(t, "[GroupID: 102, Path: /tmp/column_group_layout/102, ColumnIndices: [13], FieldIDs: [102]]", layout[1].String())
+}
+
+func TestRegroupPackedSegment(t *testing.T) {
+	schema := generateTestSchema()
+	single := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		single.Columns = append(single.Columns, i)
+	}
+	multi := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		multi[1].Columns = append(multi[1].Columns, i)
+	}
+	readValues := func(paths []string) []*Value {
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return values
+	}
+
+	src := []string{"/tmp/regroup/src"}
+	writePackedTestSegment(t, src, 100)
+	expected := readValues(src)
+	require.Len(t, expected, 100)
+
+	dst := []string{"/tmp/regroup/multi/0", "/tmp/regroup/multi/1"}
+	rows, err := RegroupPackedSegment(src, dst, schema, multi, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), rows)
+	assert.Equal(t, expected, readValues(dst))
+
+	back := []string{"/tmp/regroup/single"}
+	rows, err = RegroupPackedSegment(dst, back, schema, []storagecommon.ColumnGroup{single}, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), rows)
+	assert.Equal(t, expected, readValues(back))
+
+	_, err = RegroupPackedSegment(src, []string{"/tmp/regroup/a", "/tmp/regroup/b", "/tmp/regroup/c"}, schema, multi, 1024)
+	assert.Error(t, err)
+}
+
+func TestPackedRecordWriterSegmentStats(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "int32", DataType: schemapb.DataType_Int32, Nullable: true},
+		{FieldID: 101, Name: "name", DataType: schemapb.DataType_VarChar},
+		{FieldID: 102, Name: "score", DataType: schemapb.DataType_Double, Nullable: true},
+		{FieldID: 103, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+	}}
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: []int{0, 1, 2, 3, 4, 5}}
+	newValue := func(pk int64, i32 any, name string, score any) *Value {
+		return &Value{Value: map[FieldID]any{
+			common.RowIDField: pk, common.TimeStampField: int64(1), 100: i32, 101: name, 102: score, 103: []float32{1, 2},
+		}}
+	}
+	batches := [][]*Value{
+		{newValue(5, int32(3), "m", nil), newValue(2, nil, "b", 1.5)},
+		{newValue(9, int32(-4), "z", math.NaN()), newValue(7, nil, "k", -2.0)},
+	}
+
+	pw, err := NewPackedRecordWriter("", []string{"/tmp/segment_stats/0"}, schema, 1024, 0,
+		[]storagecommon.ColumnGroup{group}, nil, nil, WithSegmentStats())
+	require.NoError(t, err)
+	for _, batch := range batches {
+		rec, err := ValueSerializer(batch, schema)
+		require.NoError(t, err)
+		require.NoError(t, pw.Write(rec))
+	}
+	require.NoError(t, pw.Close())
+
+	stats := pw.GetSegmentStats()
+	require.NotNil(t, stats)
+	assert.Equal(t, int64(4), stats.RowCount)
+	assert.Equal(t, int64(2), stats.PKMin.GetValue())
+	assert.Equal(t, int64(9), stats.PKMax.GetValue())
+	assert.Len(t, stats.Fields, len(schema.Fields))
+	assert.Equal(t, WrittenFieldStats{NullCount: 2, Min: NewInt32FieldValue(-4), Max: NewInt32FieldValue(3)}, stats.Fields[100])
+	assert.Equal(t, WrittenFieldStats{Min: NewVarCharFieldValue("b"), Max: NewVarCharFieldValue("z")}, stats.Fields[101])
+	assert.Equal(t, WrittenFieldStats{NullCount: 1, Min: NewDoubleFieldValue(-2), Max: NewDoubleFieldValue(1.5)}, stats.Fields[102])
+	assert.Equal(t, WrittenFieldStats{}, stats.Fields[103])
+
+	fields := pw.GetFieldStats()
+	assert.Len(t, fields, len(schema.Fields))
+	assert.Equal(t, FieldValueStats{Min: int32(-4), Max: int32(3), NullCount: 2, RowCount: 4}, fields[100])
+	assert.Equal(t, FieldValueStats{Min: "b", Max: "z", RowCount: 4}, fields[101])
+	assert.Equal(t, FieldValueStats{Min: -2.0, Max: 1.5, NullCount: 1, RowCount: 4}, fields[102])
+	// vectors only count their rows
+	assert.Equal(t, FieldValueStats{RowCount: 4}, fields[103])
+
+	// records written with dictionary-encoded columns count their decoded values
+	pw, err = NewPackedRecordWriter("", []string{"/tmp/segment_stats/2"}, schema, 1024, 0,
+		[]storagecommon.ColumnGroup{group}, nil, nil, WithSegmentStats(), WithDictionaryEncoding(101))
+	require.NoError(t, err)
+	for _, batch := range batches {
+		rec, err := ValueSerializer(batch, schema)
+		require.NoError(t, err)
+		sar := rec.(*simpleArrowRecord)
+		encoded, err := dictionaryEncode(memory.DefaultAllocator, sar.r.Column(3), pw.arrowSchema.Field(3).Type.(*arrow.DictionaryType))
+		require.NoError(t, err)
+		cols := slices.Clone(sar.r.Columns())
+		cols[3] = encoded
+		require.NoError(t, pw.Write(NewSimpleArrowRecord(array.NewRecord(pw.arrowSchema, cols, sar.r.NumRows()), sar.field2Col)))
+		encoded.Release()
+		rec.Release()
+	}
+	require.NoError(t, pw.Close())
+	assert.Equal(t, WrittenFieldStats{Min: NewVarCharFieldValue("b"), Max: NewVarCharFieldValue("z")}, pw.GetSegmentStats().Fields[101])
+	assert.Equal(t, FieldValueStats{Min: "b", Max: "z", RowCount: 4}, pw.GetFieldStats()[101])
+
+	plain := writePackedTestSegment(t, []string{"/tmp/segment_stats/1"}, 10)
+	assert.Nil(t, plain.GetSegmentStats())
+	assert.Nil(t, plain.GetFieldStats())
+}
+
+func TestPackedRecordWriterWriteContext(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	blobs, err := generateTestData(10)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: lo.Range(len(schema.Fields))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pw, err := NewPackedRecordWriter("", []string{"/tmp/write_context/0"}, schema, 1024, 0,
+		[]storagecommon.ColumnGroup{group}, nil, nil, WithWriteContext(ctx))
+	require.NoError(t, err)
+	rec, err := ValueSerializer(values[:5], schema)
+	require.NoError(t, err)
+	require.NoError(t, pw.Write(rec))
+	cancel()
+	rec, err = ValueSerializer(values[5:], schema)
+	require.NoError(t, err)
+	err = pw.Write(rec)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, pw.Close())
+	assert.Equal(t, int64(5), pw.GetWrittenRowNum())
+}
+
+func TestPackedRecordWriterSmallSegmentCompactionHint(t *testing.T) {
+	pw := writePackedTestSegment(t, []string{"/tmp/compaction_hint/0"}, 10, WithSmallSegmentCompactionHint(1<<30))
+	size := pw.GetWrittenCompressed()
+	assert.Equal(t, pw.GetColumnGroupWrittenCompressed(storagecommon.DefaultShortColumnGroupID), size)
+	stats := pw.GetSegmentStats()
+	require.NotNil(t, stats)
+	assert.Equal(t, int64(10), stats.RowCount)
+	assert.Nil(t, stats.Fields)
+	assert.True(t, stats.ShouldCompact)
+	assert.Contains(t, stats.CompactionReason, strconv.FormatUint(size, 10))
+
+	pw = writePackedTestSegment(t, []string{"/tmp/compaction_hint/1"}, 10, WithSmallSegmentCompactionHint(int64(size)), WithSegmentStats())
+	stats = pw.GetSegmentStats()
+	require.NotNil(t, stats)
+	assert.NotEmpty(t, stats.Fields)
+	assert.False(t, stats.ShouldCompact)
+	assert.Empty(t, stats.CompactionReason)
+}
+
+func TestPackedRecordWriterWriteArrowRecords(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	fields := typeutil.GetAllFieldSchemas(schema)
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := range fields {
+		group.Columns = append(group.Columns, i)
+	}
+	blobs, err := generateTestData(10)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	defer rec.Release()
+
+	// columns builds a record of the columns of rec, rewritten by rewrite
+	columns := func(rewrite func(fields []*schemapb.FieldSchema, arrays []arrow.Array) ([]*schemapb.FieldSchema, []arrow.Array)) Record {
+		arrays := make([]arrow.Array, len(fields))
+		for i, field := range fields {
+			arrays[i] = rec.Column(field.GetFieldID())
+			arrays[i].Retain()
+		}
+		fs, arrays := rewrite(append([]*schemapb.FieldSchema{}, fields...), arrays)
+		return newRecordFromArrays(fs, arrays, rec.Len())
+	}
+	ints := array.NewInt32Builder(memory.DefaultAllocator)
+	defer ints.Release()
+	for i := 0; i < rec.Len(); i++ {
+		ints.Append(int32(i))
+	}
+	wrongType := ints.NewArray()
+	defer wrongType.Release()
+
+	path := "/tmp/write_arrow_records/0"
+	pw, err := NewPackedRecordWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, nil, nil)
+	require.NoError(t, err)
+	for name, bad := range map[string]Record{
+		"dropped": columns(func(fs []*schemapb.FieldSchema, arrays []arrow.Array) ([]*schemapb.FieldSchema, []arrow.Array) {
+			arrays[len(arrays)-1].Release()
+			return fs[:len(fs)-1], arrays[:len(arrays)-1]
+		}),
+		"swapped": columns(func(fs []*schemapb.FieldSchema, arrays []arrow.Array) ([]*schemapb.FieldSchema, []arrow.Array) {
+			fs[2], fs[3] = fs[3], fs[2]
+			arrays[2], arrays[3] = arrays[3], arrays[2]
+			return fs, arrays
+		}),
+		"wrong type": columns(func(fs []*schemapb.FieldSchema, arrays []arrow.Array) ([]*schemapb.FieldSchema, []arrow.Array) {
+			arrays[5].Release()
+			wrongType.Retain()
+			arrays[5] = wrongType
+			return fs, arrays
+		}),
+	} {
+		assert.ErrorIs(t, pw.Write(bad), merr.ErrParameterInvalid, name)
+	}
+	assert.Zero(t, pw.GetWrittenUncompressed())
+
+	expected := uint64(0)
+	for _, field := range fields {
+		expected += calculateActualDataSize(rec.Column(field.GetFieldID()))
+	}
+	rec.Retain()
+	require.NoError(t, pw.Write(rec))
+	require.NoError(t, pw.Close())
+	assert.Equal(t, expected, pw.GetWrittenUncompressed())
+	assert.Equal(t, int64(10), pw.GetWrittenRowNum())
+	rows, err := CountRows([]string{path}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), rows)
+}
+
+func TestPackedRecordWriterRecordInterceptor(t *testing.T) {
+	schema := generateTestSchema()
+	fields := typeutil.GetAllFieldSchemas(schema)
+	// doubled rewrites the int32 field to twice the primary key
+	intercepted := 0
+	doubled := func(r Record) (Record, error) {
+		intercepted++
+		builder := array.NewInt32Builder(memory.DefaultAllocator)
+		defer builder.Release()
+		pks := r.Column(common.RowIDField).(*array.Int64)
+		for i := 0; i < r.Len(); i++ {
+			builder.Append(int32(2 * pks.Value(i)))
+		}
+		arrays := make([]arrow.Array, len(fields))
+		for i, field := range fields {
+			if field.GetFieldID() == 101 {
+				arrays[i] = builder.NewArray()
+				continue
+			}
+			arrays[i] = r.Column(field.GetFieldID())
+			arrays[i].Retain()
+		}
+		return newRecordFromArrays(fields, arrays, r.Len()), nil
+	}
+	paths := []string{"/tmp/record_interceptor/0"}
+	writePackedTestSegment(t, paths, 20, WithRecordInterceptor(doubled))
+	assert.Equal(t, 3, intercepted)
+
+	reader, err := newPackedRecordReader(paths, schema, 1024, nil, nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	rows := 0
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		pks, doubledCol := rec.Column(common.RowIDField).(*array.Int64), rec.Column(101).(*array.Int32)
+		for i := 0; i < rec.Len(); i++ {
+			assert.Equal(t, int32(2*pks.Value(i)), doubledCol.Value(i))
+		}
+		rows += rec.Len()
+	}
+	assert.Equal(t, 20, rows)
+
+	blobs, err := generateTestData(5)
+	require.NoError(t, err)
+	valueReader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	all, err := ReadAllValues(valueReader)
+	require.NoError(t, err)
+	write := func(interceptor func(Record) (Record, error)) error {
+		pw, err := NewPackedRecordWriter("", []string{"/tmp/record_interceptor/1"}, schema, 1024, 0,
+			[]storagecommon.ColumnGroup{{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: lo.Range(len(fields))}},
+			nil, nil, WithRecordInterceptor(interceptor))
+		require.NoError(t, err)
+		defer pw.Close()
+		rec, err := ValueSerializer(all, schema)
+		require.NoError(t, err)
+		return pw.Write(rec)
+	}
+	assert.ErrorIs(t, write(func(Record) (Record, error) { return nil, merr.ErrServiceInternal }), merr.ErrServiceInternal)
+	// the record returned lacks the columns of the schema
+	err = write(func(r Record) (Record, error) {
+		col := r.Column(fields[0].GetFieldID())
+		col.Retain()
+		return newRecordFromArrays(fields[:1], []arrow.Array{col}, r.Len()), nil
+	})
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedRecordWriterDeterministicOutput(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	blobs, err := generateTestData(50)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+
+	// write batches the values differently every time
+	write := func(p string, batchSize int) []byte {
+		pw, err := NewPackedRecordWriter("", []string{p}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, nil, nil,
+			WithDeterministicOutput(16), WithSchemaMetadata(map[string]string{"b": "2", "a": "1"}))
+		require.NoError(t, err)
+		writer := NewSerializeRecordWriter(pw, func(v []*Value) (Record, error) {
+			return ValueSerializer(v, schema)
+		}, batchSize)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+		assert.Equal(t, int64(len(values)), pw.GetWrittenRowNum())
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return data
+	}
+	first := write("/tmp/deterministic/0", 7)
+	assert.Equal(t, first, write("/tmp/deterministic/1", 7))
+	assert.Equal(t, first, write("/tmp/deterministic/2", 13))
+
+	rows, err := CountRows([]string{"/tmp/deterministic/2"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(values)), rows)
+
+	_, err = NewPackedRecordWriter("", []string{"/tmp/deterministic/3"}, schema, 1024, 0, []storagecommon.ColumnGroup{group}, nil, nil,
+		WithDeterministicOutput(-1))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedRecordWriterPerGroupBufferSize(t *testing.T) {
+	size := 30
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	paths := []string{"/tmp/per_group_buffer/0", "/tmp/per_group_buffer/1"}
+	pw := writePackedTestSegmentWithGroups(t, paths, groups, size, WithPerGroupBufferSize([]int64{64 * 1024 * 1024, 0}))
+	assert.Equal(t, int64(size), pw.GetWrittenRowNum())
+
+	reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	assert.Equal(t, lo.RangeFrom(int64(1), size), lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }))
+	for _, v := range values {
+		assert.Equal(t, strconv.FormatInt(v.PK.GetValue().(int64), 10), v.Value.(map[FieldID]any)[16])
+	}
+
+	_, err = NewPackedRecordWriter("", paths, schema, 1024, 0, groups, nil, nil, WithPerGroupBufferSize([]int64{1024}))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedRecordWriterCompressionByGroup(t *testing.T) {
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	write := func(name string, compression storagecommon.CompressionSpec) *packedRecordWriter {
+		paths := []string{"/tmp/compression_by_group/" + name + "/0", "/tmp/compression_by_group/" + name + "/1"}
+		pw := writePackedTestSegmentWithGroups(t, paths, groups, 100,
+			WithCompressionByGroup([]storagecommon.CompressionSpec{{}, compression}))
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		assert.Len(t, values, 100)
+		return pw
+	}
+	none := write("none", storagecommon.CompressionSpec{Codec: storagecommon.CompressionNone})
+	zstd := write("zstd", storagecommon.CompressionSpec{Codec: storagecommon.CompressionZstd, Level: 9})
+	assert.Equal(t, none.GetColumnGroupWrittenCompressed(0), zstd.GetColumnGroupWrittenCompressed(0))
+	assert.Greater(t, none.GetColumnGroupWrittenCompressed(1), zstd.GetColumnGroupWrittenCompressed(1))
+	assert.Greater(t, none.GetWrittenCompressed(), zstd.GetWrittenCompressed())
+
+	paths := []string{"/tmp/compression_by_group/invalid/0", "/tmp/compression_by_group/invalid/1"}
+	for _, compressions := range [][]storagecommon.CompressionSpec{
+		{{Codec: storagecommon.CompressionZstd}},
+		{{}, {Codec: storagecommon.CompressionSnappy, Level: 3}},
+		{{}, {Codec: 42}},
+	} {
+		_, err := NewPackedRecordWriter("", paths, schema, 1024, 0, groups, nil, nil, WithCompressionByGroup(compressions))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	}
+}
+
+func TestRepartitionSegment(t *testing.T) {
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	groups := []storagecommon.ColumnGroup{group}
+	readPKs := func(paths []string) []int64 {
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) })
+	}
+
+	src := []string{"/tmp/repartition/src"}
+	writePackedTestSegment(t, src, 100)
+
+	t.Run("custom partition", func(t *testing.T) {
+		dst := [][]string{{"/tmp/repartition/mod/0"}, {"/tmp/repartition/mod/1"}, {"/tmp/repartition/mod/2"}}
+		rows, err := RepartitionSegment(src, schema, common.RowIDField, 3, dst, groups, 1024, func(value any, n int) (int, error) {
+			return int(value.(int64) % int64(n)), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{33, 34, 33}, rows)
+		for i, paths := range dst {
+			pks := readPKs(paths)
+			assert.Len(t, pks, int(rows[i]))
+			for _, pk := range pks {
+				assert.Equal(t, int64(i), pk%3)
+			}
+		}
+	})
+
+	t.Run("skewed partition", func(t *testing.T) {
+		dst := [][]string{{"/tmp/repartition/skew/0"}, {"/tmp/repartition/skew/1"}}
+		rows, err := RepartitionSegment(src, schema, common.RowIDField, 2, dst, groups, 1024, func(any, int) (int, error) {
+			return 1, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{0, 100}, rows)
+		assert.Empty(t, readPKs(dst[0]))
+		assert.Equal(t, lo.RangeFrom(int64(1), 100), readPKs(dst[1]))
+	})
+
+	t.Run("hash partition", func(t *testing.T) {
+		dst := [][]string{{"/tmp/repartition/hash/0"}, {"/tmp/repartition/hash/1"}}
+		rows, err := RepartitionSegment(src, schema, common.RowIDField, 2, dst, groups, 1024, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), rows[0]+rows[1])
+		for i, paths := range dst {
+			for _, pk := range readPKs(paths) {
+				target, err := HashPartition(pk, 2)
+				require.NoError(t, err)
+				assert.Equal(t, i, target)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dst := [][]string{{"/tmp/repartition/bad/0"}, {"/tmp/repartition/bad/1"}}
+		_, err := RepartitionSegment(src, schema, common.RowIDField, 3, dst, groups, 1024, nil)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = RepartitionSegment(src, schema, 999, 2, dst, groups, 1024, nil)
+		assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+		_, err = RepartitionSegment(src, schema, common.RowIDField, 2, dst, groups, 1024, func(any, int) (int, error) {
+			return 2, nil
+		})
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = RepartitionSegment(src, schema, 14, 2, dst, groups, 1024, nil)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestTruncatePackedSegment(t *testing.T) {
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	readValues := func(paths []string) []*Value {
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return values
+	}
+
+	src := []string{"/tmp/truncate/src/0", "/tmp/truncate/src/1"}
+	writePackedTestSegmentWithGroups(t, src, groups, 100)
+	expected := readValues(src)
+
+	// cut in the middle of the batches of 7 rows
+	dst := []string{"/tmp/truncate/50/0", "/tmp/truncate/50/1"}
+	rows, err := TruncatePackedSegment(src, dst, schema, 50, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), rows)
+	assert.Equal(t, expected[:50], readValues(dst))
+	fields, err := ReadPackedFields(dst[:1])
+	require.NoError(t, err)
+	assert.Len(t, fields, 2)
+
+	rows, err = TruncatePackedSegment(src, []string{"/tmp/truncate/all/0", "/tmp/truncate/all/1"}, schema, 1000, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), rows)
+	assert.Equal(t, expected, readValues([]string{"/tmp/truncate/all/0", "/tmp/truncate/all/1"}))
+
+	rows, err = TruncatePackedSegment(src, []string{"/tmp/truncate/empty/0", "/tmp/truncate/empty/1"}, schema, 0, 1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rows)
+	assert.Empty(t, readValues([]string{"/tmp/truncate/empty/0", "/tmp/truncate/empty/1"}))
+
+	_, err = TruncatePackedSegment(src, dst, schema, -1, 1024)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedSerializeWriterAutoRowIDs(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	blobs, err := generateTestData(10)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	// rows 3 and 7 keep their row ids
+	for i, v := range values {
+		if i != 3 && i != 7 {
+			delete(v.Value.(map[FieldID]any), common.RowIDField)
+		}
+	}
+
+	path := "/tmp/auto_row_ids/0"
+	writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0,
+		[]storagecommon.ColumnGroup{group}, 3, WithAutoRowIDs(1000))
+	require.NoError(t, err)
+	for _, v := range values {
+		require.NoError(t, writer.WriteValue(v))
+	}
+	require.NoError(t, writer.Close())
+	start, end := writer.AssignedRowIDs()
+	assert.Equal(t, int64(1000), start)
+	assert.Equal(t, int64(1008), end)
+
+	deserializer, err := NewPackedDeserializeReader([][]string{{path}}, schema, 1024, true)
+	require.NoError(t, err)
+	read, err := ReadAllValues(deserializer)
+	require.NoError(t, err)
+	var rowIDs []int64
+	for _, v := range read {
+		rowIDs = append(rowIDs, v.Value.(map[FieldID]any)[common.RowIDField].(int64))
+	}
+	assert.Equal(t, []int64{1000, 1001, 1002, 4, 1003, 1004, 1005, 8, 1006, 1007}, rowIDs)
+
+	t.Run("disabled", func(t *testing.T) {
+		writer, err := NewPackedSerializeWriter("", []string{"/tmp/auto_row_ids/1"}, schema, 10*1024*1024, 0,
+			[]storagecommon.ColumnGroup{group}, 3)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		start, end := writer.AssignedRowIDs()
+		assert.Equal(t, start, end)
+	})
+}
+
+func TestPackedSerializeWriterWithBatchBytes(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	size, err := EstimateRowBytes(schema, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(109), size)
+	size, err = EstimateRowBytes(schema, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(159), size)
+
+	blobs, err := generateTestData(100)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+
+	path := "/tmp/batch_bytes/0"
+	// the estimate of the variable length fields is far off, batches start at a row
+	writer, err := NewPackedSerializeWriterWithBatchBytes("", []string{path}, schema, 10*1024*1024, 0,
+		[]storagecommon.ColumnGroup{group}, 4096, 1<<20)
+	require.NoError(t, err)
+	assert.Equal(t, 1, writer.batchSize)
+	for _, v := range values {
+		require.NoError(t, writer.WriteValue(v))
+	}
+	require.NoError(t, writer.Close())
+	rowBytes := float64(writer.rw.GetWrittenUncompressed()) / float64(len(values))
+	assert.InDelta(t, 4096/rowBytes, float64(writer.batchSize), 4096/rowBytes/2)
+
+	read, err := NewPackedDeserializeReader([][]string{{path}}, schema, 1024, true)
+	require.NoError(t, err)
+	readValues, err := ReadAllValues(read)
+	require.NoError(t, err)
+	pkOf := func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }
+	assert.Equal(t, lo.Map(values, pkOf), lo.Map(readValues, pkOf))
+
+	_, err = NewPackedSerializeWriterWithBatchBytes("", []string{path}, schema, 1024, 0, []storagecommon.ColumnGroup{group}, 0, 10)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedSerializeWriterSortKeys(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	blobs, err := generateTestData(10)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+
+	write := func(path string, opts ...PackedRecordWriterOption) []int64 {
+		writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0,
+			[]storagecommon.ColumnGroup{group}, 3, opts...)
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+
+		deserializer, err := NewPackedDeserializeReader([][]string{{path}}, schema, 1024, true)
+		require.NoError(t, err)
+		read, err := ReadAllValues(deserializer)
+		require.NoError(t, err)
+		require.Len(t, read, len(values))
+		var got []int64
+		for _, v := range read {
+			got = append(got, v.Value.(map[FieldID]any)[13].(int64))
+		}
+		return got
+	}
+	keys := []SortKey{{FieldID: 13, Descending: true}}
+
+	t.Run("per batch", func(t *testing.T) {
+		got := write("/tmp/sort_keys/0", WithSortKeys(keys, false))
+		assert.Equal(t, []int64{3, 2, 1, 6, 5, 4, 9, 8, 7, 10}, got)
+	})
+
+	t.Run("global", func(t *testing.T) {
+		got := write("/tmp/sort_keys/1", WithSortKeys(keys, true))
+		assert.Equal(t, []int64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, got)
+	})
+
+	t.Run("unsupported key", func(t *testing.T) {
+		writer, err := NewPackedSerializeWriter("", []string{"/tmp/sort_keys/2"}, schema, 10*1024*1024, 0,
+			[]storagecommon.ColumnGroup{group}, 3, WithSortKeys([]SortKey{{FieldID: 19}}, true))
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		assert.Error(t, writer.Close())
+	})
+}
+
+func TestRollingPackedSerializeWriter(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	groups := []storagecommon.ColumnGroup{group}
+	pathsOf := func(segment int) []string {
+		return []string{"/tmp/rolling/" + strconv.Itoa(segment)}
+	}
+
+	size := 25
+	blobs, err := generateTestData(size)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+
+	// batches of 7 values cross the segment boundaries
+	w, err := NewRollingPackedSerializeWriter("", pathsOf, schema, 10*1024*1024, 0, groups, 10, 7, WithSegmentStats())
+	require.NoError(t, err)
+	for _, v := range values {
+		require.NoError(t, w.WriteValue(v))
+	}
+	require.NoError(t, w.Close())
+
+	segments := w.CompletedSegments()
+	require.Len(t, segments, 3)
+	start := int64(1)
+	for i, segment := range segments {
+		assert.Equal(t, pathsOf(i), segment.Paths)
+		assert.Equal(t, []int64{10, 10, 5}[i], segment.RowNum)
+		assert.Positive(t, segment.WrittenUncompressed)
+		require.NotNil(t, segment.Stats)
+		assert.Equal(t, start, segment.Stats.PKMin.GetValue())
+
+		reader, err := NewPackedDeserializeReader([][]string{segment.Paths}, schema, 1024, true)
+		require.NoError(t, err)
+		read, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		assert.Equal(t, lo.RangeFrom(start, int(segment.RowNum)), lo.Map(read, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }))
+		start += segment.RowNum
+	}
+
+	// a writer closed without rows writes no segment
+	w, err = NewRollingPackedSerializeWriter("", pathsOf, schema, 1024, 0, groups, 10, 7)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Empty(t, w.CompletedSegments())
+
+	// a segment past the size ends with the record crossing it, whole
+	sizedPathsOf := func(segment int) []string {
+		return []string{"/tmp/rolling_sized/" + strconv.Itoa(segment)}
+	}
+	w, err = NewRollingPackedSerializeWriter("", sizedPathsOf, schema, 1024, 0, groups, 0, 7, WithMaxSegmentSize(1))
+	require.NoError(t, err)
+	for _, v := range values {
+		require.NoError(t, w.WriteValue(v))
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, []int64{7, 7, 7, 4}, lo.Map(w.CompletedSegments(), func(segment RolledSegment, _ int) int64 { return segment.RowNum }))
+	assert.Equal(t, lo.FlatMap(lo.Range(4), func(i int, _ int) []string { return sizedPathsOf(i) }), w.GetPaths())
+
+	// a flush closes the segment being written, the writer stays usable
+	flushedPathsOf := func(segment int) []string {
+		return []string{"/tmp/rolling_flushed/" + strconv.Itoa(segment)}
+	}
+	w, err = NewRollingPackedSerializeWriter("", flushedPathsOf, schema, 1024, 0, groups, 10, 7)
+	require.NoError(t, err)
+	for _, v := range values[:5] {
+		require.NoError(t, w.WriteValue(v))
+	}
+	require.NoError(t, w.Flush())
+	flushed, err := NewPackedDeserializeReader([][]string{flushedPathsOf(0)}, schema, 1024, true)
+	require.NoError(t, err)
+	read, err := ReadAllValues(flushed)
+	require.NoError(t, err)
+	assert.Len(t, read, 5)
+	// a flush without rows since the last one writes no segment
+	require.NoError(t, w.Flush())
+	for _, v := range values[5:] {
+		require.NoError(t, w.WriteValue(v))
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, []int64{5, 10, 10}, lo.Map(w.CompletedSegments(), func(segment RolledSegment, _ int) int64 { return segment.RowNum }))
+
+	_, err = NewRollingPackedSerializeWriter("", pathsOf, schema, 1024, 0, groups, 0, 7)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = NewRollingPackedSerializeWriter("", pathsOf, schema, 1024, 0, groups, 10, 7, WithAutoRowIDs(1))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = NewPackedRecordWriter("", pathsOf(0), schema, 1024, 0, groups, nil, nil, WithMaxSegmentSize(1))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestRollingPackedSerializeWriterAdaptiveBufferSize(t *testing.T) {
+	t.Run("adapt", func(t *testing.T) {
+		rw := &rollingPackedRecordWriter{
+			adaptiveBuffer:      true,
+			minBufferSize:       100,
+			maxBufferSize:       400,
+			targetFlushDuration: 100 * time.Millisecond,
+			effectiveBufferSize: 200,
+		}
+		rw.adaptBufferSize(80 * time.Millisecond)
+		assert.Equal(t, int64(200), rw.effectiveBufferSize)
+		rw.adaptBufferSize(10 * time.Millisecond)
+		assert.Equal(t, int64(400), rw.effectiveBufferSize)
+		rw.adaptBufferSize(10 * time.Millisecond)
+		assert.Equal(t, int64(400), rw.effectiveBufferSize)
+		rw.adaptBufferSize(time.Second)
+		assert.Equal(t, int64(200), rw.effectiveBufferSize)
+		rw.adaptBufferSize(time.Second)
+		rw.adaptBufferSize(time.Second)
+		assert.Equal(t, int64(100), rw.effectiveBufferSize)
+	})
+
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	groups := []storagecommon.ColumnGroup{group}
+	pathsOf := func(segment int) []string {
+		return []string{"/tmp/rolling_adaptive/" + strconv.Itoa(segment)}
+	}
+
+	t.Run("write", func(t *testing.T) {
+		blobs, err := generateTestData(20)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+
+		// flushes far below an hour grow the buffer of every next segment up to the cap
+		w, err := NewRollingPackedSerializeWriter("", pathsOf, schema, 1024, 0, groups, 5, 5,
+			WithAdaptiveBufferSize(1024, 4096, time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1024), w.GetEffectiveBufferSize())
+		for _, v := range values {
+			require.NoError(t, w.WriteValue(v))
+		}
+		require.NoError(t, w.Close())
+		assert.Len(t, w.CompletedSegments(), 4)
+		assert.Equal(t, int64(4096), w.GetEffectiveBufferSize())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewRollingPackedSerializeWriter("", pathsOf, schema, 1024, 0, groups, 5, 5,
+			WithAdaptiveBufferSize(2048, 1024, time.Second))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = NewPackedRecordWriter("", pathsOf(0), schema, 1024, 0, groups, nil, nil,
+			WithAdaptiveBufferSize(1024, 2048, time.Second))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
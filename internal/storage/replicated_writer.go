@@ -0,0 +1,185 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// replicaWriter writes a replica of a ReplicatedPackedWriter, *packedRecordWriter writing
+// it to storage.
+type replicaWriter interface {
+	WriteBorrowed(r Record) error
+	GetWrittenUncompressed() uint64
+	Close() error
+	Abort() error
+}
+
+// ReplicatedPackedWriter writes the same segment to several replicas, each with its own
+// packed writer, succeeding as long as a quorum of them does.
+type ReplicatedPackedWriter struct {
+	replicas []replicaWriter
+	quorum   int
+	// errs are the errors the replicas failed with, by replica. A failed replica is aborted
+	// and not written to anymore.
+	errs []error
+}
+
+var _ RecordWriter = (*ReplicatedPackedWriter)(nil)
+
+// NewReplicatedPackedWriter writes a segment to len(pathSets) replicas for write side
+// redundancy, replica i to the column group files pathSets[i] of the storage of
+// storageConfigs[i], e.g. two independent buckets. Every write is fanned out to the
+// replicas concurrently and succeeds once quorum replicas wrote it, the replicas failing
+// are aborted, deleting their files, and reported by ReplicaErrors. Close waits for every
+// replica still written to flush its files, and fails unless quorum replicas did.
+func NewReplicatedPackedWriter(bucketName string, pathSets [][]string, storageConfigs []*indexpb.StorageConfig,
+	schema *schemapb.CollectionSchema, bufferSize int64, multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup,
+	quorum int, opts ...PackedRecordWriterOption,
+) (*ReplicatedPackedWriter, error) {
+	if len(pathSets) != len(storageConfigs) {
+		return nil, merr.WrapErrParameterInvalid(len(pathSets), len(storageConfigs),
+			"path sets length is not equal to storage configs length for replicated packed writer")
+	}
+	replicas := make([]replicaWriter, 0, len(pathSets))
+	for i, paths := range pathSets {
+		writer, err := NewPackedRecordWriter(bucketName, paths, schema, bufferSize, multiPartUploadSize, columnGroups,
+			storageConfigs[i], nil, opts...)
+		if err != nil {
+			for _, replica := range replicas {
+				err = merr.Combine(err, replica.Abort())
+			}
+			return nil, err
+		}
+		replicas = append(replicas, writer)
+	}
+	return newReplicatedPackedWriter(replicas, quorum)
+}
+
+func newReplicatedPackedWriter(replicas []replicaWriter, quorum int) (*ReplicatedPackedWriter, error) {
+	if quorum <= 0 || quorum > len(replicas) {
+		abortErr := merr.Combine(lo.Map(replicas, func(replica replicaWriter, _ int) error { return replica.Abort() })...)
+		return nil, merr.Combine(merr.WrapErrParameterInvalidMsg("quorum %d of replicated packed writer is not in [1, %d]",
+			quorum, len(replicas)), abortErr)
+	}
+	return &ReplicatedPackedWriter{
+		replicas: replicas,
+		quorum:   quorum,
+		errs:     make([]error, len(replicas)),
+	}, nil
+}
+
+// fanOut runs fn on the replicas not failed yet concurrently, aborting the replicas it
+// fails on, deleting their partial files, and fails unless quorum replicas are left. r,
+// if not nil, is the record fn writes, retained for every replica until fn returns.
+func (rw *ReplicatedPackedWriter) fanOut(op string, r Record, fn func(replica replicaWriter) error) error {
+	var wg sync.WaitGroup
+	for i, replica := range rw.replicas {
+		if rw.errs[i] != nil {
+			continue
+		}
+		if r != nil {
+			r.Retain()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r != nil {
+				defer r.Release()
+			}
+			if err := fn(replica); err != nil {
+				rw.errs[i] = merr.Combine(errors.Wrapf(err, "%s replica %d", op, i), replica.Abort())
+			}
+		}()
+	}
+	wg.Wait()
+	acked := 0
+	for _, err := range rw.errs {
+		if err == nil {
+			acked++
+		}
+	}
+	if acked < rw.quorum {
+		return merr.Combine(append([]error{merr.WrapErrServiceInternal(
+			fmt.Sprintf("%s of replicated packed writer acked by %d replicas, less than the quorum %d", op, acked, rw.quorum))},
+			lo.Compact(rw.errs)...)...)
+	}
+	return nil
+}
+
+// Write writes r to the replicas, taking over the reference of the caller as
+// packedRecordWriter.Write does.
+func (rw *ReplicatedPackedWriter) Write(r Record) error {
+	defer func() {
+		if _, ok := r.(*simpleArrowRecord); ok {
+			r.Release()
+		}
+	}()
+	return rw.WriteBorrowed(r)
+}
+
+// WriteBorrowed writes r to the replicas without releasing it.
+func (rw *ReplicatedPackedWriter) WriteBorrowed(r Record) error {
+	return rw.fanOut("write", r, func(replica replicaWriter) error {
+		return replica.WriteBorrowed(r)
+	})
+}
+
+// GetWrittenUncompressed returns the uncompressed bytes written to a replica, the same
+// for all replicas written to.
+func (rw *ReplicatedPackedWriter) GetWrittenUncompressed() uint64 {
+	for i, replica := range rw.replicas {
+		if rw.errs[i] == nil {
+			return replica.GetWrittenUncompressed()
+		}
+	}
+	return 0
+}
+
+// ReplicaErrors returns the errors the replicas failed with, by replica, nil for the
+// replicas written successfully so far.
+func (rw *ReplicatedPackedWriter) ReplicaErrors() []error {
+	return rw.errs
+}
+
+// Close flushes and closes every replica still written to, the replicas failing to close
+// are aborted as the failed writes are.
+func (rw *ReplicatedPackedWriter) Close() error {
+	return rw.fanOut("close", nil, func(replica replicaWriter) error {
+		return replica.Close()
+	})
+}
+
+// Abort aborts every replica still written to, deleting their files.
+func (rw *ReplicatedPackedWriter) Abort() error {
+	var errs error
+	for i, replica := range rw.replicas {
+		if rw.errs[i] == nil {
+			errs = merr.Combine(errs, replica.Abort())
+		}
+	}
+	return errs
+}
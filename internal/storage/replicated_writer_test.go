@@ -0,0 +1,157 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"io"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// failingReplica fails its failAt-th write, or its close if failClose.
+type failingReplica struct {
+	failAt    int
+	failClose bool
+	writes    int
+	aborted   bool
+}
+
+func (r *failingReplica) WriteBorrowed(Record) error {
+	r.writes++
+	if r.writes == r.failAt {
+		return merr.WrapErrIoFailedReason("replica unavailable")
+	}
+	return nil
+}
+
+func (r *failingReplica) GetWrittenUncompressed() uint64 { return 0 }
+
+func (r *failingReplica) Close() error {
+	if r.failClose {
+		return merr.WrapErrIoFailedReason("replica unavailable")
+	}
+	return nil
+}
+
+func (r *failingReplica) Abort() error {
+	r.aborted = true
+	return nil
+}
+
+func TestReplicatedPackedWriter(t *testing.T) {
+	schema := generateTestSchema()
+	src := []string{"/tmp/replicated_writer/src"}
+	writePackedTestSegment(t, src, 30)
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := range schema.Fields {
+		group.Columns = append(group.Columns, i)
+	}
+	groups := []storagecommon.ColumnGroup{group}
+	copySegment := func(rw *ReplicatedPackedWriter) error {
+		reader, err := newPackedRecordReader(src, schema, 1024*1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return rw.Close()
+			}
+			require.NoError(t, err)
+			if err := rw.WriteBorrowed(rec); err != nil {
+				return err
+			}
+		}
+	}
+	dir := t.TempDir()
+
+	t.Run("replicas", func(t *testing.T) {
+		pathSets := [][]string{{path.Join(dir, "a", "0")}, {path.Join(dir, "b", "0")}}
+		rw, err := NewReplicatedPackedWriter("", pathSets, []*indexpb.StorageConfig{nil, nil}, schema, 1024*1024, 0, groups, 2)
+		require.NoError(t, err)
+		require.NoError(t, copySegment(rw))
+		assert.Equal(t, []error{nil, nil}, rw.ReplicaErrors())
+		assert.Positive(t, rw.GetWrittenUncompressed())
+		for _, paths := range pathSets {
+			rows, err := CountRows(paths, nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(30), rows)
+		}
+	})
+
+	t.Run("failing replica under quorum", func(t *testing.T) {
+		paths := []string{path.Join(dir, "c", "0")}
+		writer, err := NewPackedRecordWriter("", paths, schema, 1024*1024, 0, groups, nil, nil)
+		require.NoError(t, err)
+		failing := &failingReplica{failAt: 1}
+		rw, err := newReplicatedPackedWriter([]replicaWriter{failing, writer}, 1)
+		require.NoError(t, err)
+		require.NoError(t, copySegment(rw))
+		assert.True(t, failing.aborted)
+		assert.Equal(t, 1, failing.writes)
+		assert.ErrorIs(t, rw.ReplicaErrors()[0], merr.ErrIoFailed)
+		assert.NoError(t, rw.ReplicaErrors()[1])
+		rows, err := CountRows(paths, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(30), rows)
+	})
+
+	t.Run("quorum lost", func(t *testing.T) {
+		paths := []string{path.Join(dir, "d", "0")}
+		writer, err := NewPackedRecordWriter("", paths, schema, 1024*1024, 0, groups, nil, nil)
+		require.NoError(t, err)
+		rw, err := newReplicatedPackedWriter([]replicaWriter{&failingReplica{failAt: 1}, writer}, 2)
+		require.NoError(t, err)
+		err = copySegment(rw)
+		assert.ErrorIs(t, err, merr.ErrServiceInternal)
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+		require.NoError(t, rw.Abort())
+		if size, err := packed.GetFileSize(paths[0], nil); err == nil {
+			assert.Negative(t, size)
+		}
+	})
+
+	t.Run("failing close under quorum", func(t *testing.T) {
+		paths := []string{path.Join(dir, "f", "0")}
+		writer, err := NewPackedRecordWriter("", paths, schema, 1024*1024, 0, groups, nil, nil)
+		require.NoError(t, err)
+		failing := &failingReplica{failClose: true}
+		rw, err := newReplicatedPackedWriter([]replicaWriter{failing, writer}, 1)
+		require.NoError(t, err)
+		require.NoError(t, copySegment(rw))
+		assert.True(t, failing.aborted)
+		assert.Positive(t, failing.writes)
+		assert.ErrorIs(t, rw.ReplicaErrors()[0], merr.ErrIoFailed)
+		assert.NoError(t, rw.ReplicaErrors()[1])
+	})
+
+	t.Run("invalid quorum", func(t *testing.T) {
+		failing := &failingReplica{}
+		_, err := newReplicatedPackedWriter([]replicaWriter{failing}, 2)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		assert.True(t, failing.aborted)
+		_, err = NewReplicatedPackedWriter("", [][]string{{path.Join(dir, "e", "0")}}, nil, schema, 1024, 0, groups, 1)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
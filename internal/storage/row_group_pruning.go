@@ -0,0 +1,228 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/apache/arrow/go/v17/parquet/metadata"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// rowGroupPredicate is the predicate of WithRowGroupPruning, compared as by
+// FilterCompare against the min/max stats of the row groups.
+type rowGroupPredicate struct {
+	cm      ChunkManager
+	fieldID FieldID
+	op      CompareOp
+	value   any
+}
+
+// WithRowGroupPruning drops the row groups whose min/max stats in the parquet footer,
+// read through cm, prove that no row of them compares with op to value on field fieldID,
+// value typed as by FilterCompare. The batches read are mapped to the row groups of the
+// file holding the field by their rows, and dropped if all the row groups they hold are:
+// these are never returned, and so never deserialized, but the native reader, which
+// cannot seek, still reads them. The rows of the batches kept are returned as is, a row
+// filter still has to select the matching ones. Row groups without stats of the field are
+// kept, as are all rows of files not holding the field. The rows dropped count to
+// Position. It cannot be combined
+// with WithSkipIndex or WithDistinctCounts, which cover every row.
+func WithRowGroupPruning(cm ChunkManager, fieldID FieldID, op CompareOp, value any) PackedReaderOption {
+	return func(o *packedReaderOptions) {
+		o.rowGroupPredicate = &rowGroupPredicate{cm: cm, fieldID: fieldID, op: op, value: value}
+	}
+}
+
+// validate checks that the predicate compares field of schema to a value of its type.
+func (p *rowGroupPredicate) validate(schema *schemapb.CollectionSchema) error {
+	field := typeutil.GetField(schema, p.fieldID)
+	if field == nil {
+		return merr.WrapErrFieldNotFound(p.fieldID)
+	}
+	var ok bool
+	switch field.GetDataType() {
+	case schemapb.DataType_Int8, schemapb.DataType_Int16, schemapb.DataType_Int32, schemapb.DataType_Int64:
+		_, ok = p.value.(int64)
+	case schemapb.DataType_Float, schemapb.DataType_Double:
+		_, ok = p.value.(float64)
+	case schemapb.DataType_VarChar, schemapb.DataType_String:
+		_, ok = p.value.(string)
+	case schemapb.DataType_Bool:
+		_, ok = p.value.(bool)
+		ok = ok && (p.op == CompareEQ || p.op == CompareNE)
+	}
+	if !ok || p.op < CompareEQ || p.op > CompareGE {
+		return merr.WrapErrParameterInvalidMsg("cannot prune row groups of field %d of type %s with %s %v",
+			p.fieldID, field.GetDataType(), p.op, p.value)
+	}
+	return nil
+}
+
+// rowGroupStats returns, for every row group of the first of the packed files paths
+// holding column, read through cm, the row past its last and its stats of column, nil for
+// the row groups without. The column group files of a segment hold the same rows, so the
+// row groups of one of them cover the rows of all. It returns nil if no file holds column.
+func rowGroupStats(ctx context.Context, cm ChunkManager, paths []string, column string) ([]int64, []metadata.TypedStatistics, error) {
+	for _, path := range paths {
+		footer, err := readPackedFooter(ctx, cm, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		col := footer.Schema.ColumnIndexByName(column)
+		if col < 0 {
+			continue
+		}
+		ends := make([]int64, len(footer.GetRowGroups()))
+		stats := make([]metadata.TypedStatistics, len(ends))
+		var rows int64
+		for i := range ends {
+			rowGroup := footer.RowGroup(i)
+			rows += rowGroup.NumRows()
+			ends[i] = rows
+			chunk, err := rowGroup.ColumnChunk(col)
+			if err != nil {
+				return nil, nil, merr.WrapErrIoFailed(path, err)
+			}
+			if set, err := chunk.StatsSet(); err != nil || !set {
+				continue
+			}
+			if s, err := chunk.Statistics(); err == nil {
+				stats[i] = s
+			}
+		}
+		return ends, stats, nil
+	}
+	return nil, nil, nil
+}
+
+// rowGroupMatch maps the rows read from the files to the row groups of one of them, see
+// rowGroupStats, ends being the row past the last of each, and tells the row groups
+// matching a condition on their stats.
+type rowGroupMatch struct {
+	ends    []int64
+	matches []bool
+}
+
+// newRowGroupMatch returns the row groups of ends whose stats, if any, match, those
+// without stats matching unless matchUnknown is false.
+func newRowGroupMatch(ends []int64, stats []metadata.TypedStatistics, matchUnknown bool,
+	match func(stats metadata.TypedStatistics, rows int64) bool,
+) *rowGroupMatch {
+	m := &rowGroupMatch{ends: ends, matches: make([]bool, len(ends))}
+	var start int64
+	for i, end := range ends {
+		m.matches[i] = matchUnknown
+		if stats[i] != nil {
+			m.matches[i] = match(stats[i], end-start)
+		}
+		start = end
+	}
+	return m
+}
+
+// any tells whether one of the row groups holding the rows [start, end) matches, the rows
+// past the row groups matching.
+func (m *rowGroupMatch) any(start, end int64) bool {
+	// from the first row group ending past start
+	for g, _ := slices.BinarySearch(m.ends, start+1); g < len(m.ends); g++ {
+		if m.matches[g] {
+			return true
+		}
+		if m.ends[g] >= end {
+			return false
+		}
+	}
+	return true
+}
+
+// all tells whether all the row groups holding the rows [start, end) match, the rows past
+// the row groups not matching.
+func (m *rowGroupMatch) all(start, end int64) bool {
+	for g, _ := slices.BinarySearch(m.ends, start+1); g < len(m.ends); g++ {
+		if !m.matches[g] {
+			return false
+		}
+		if m.ends[g] >= end {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatch tells whether a row of the rows of stats may match the predicate, false only if
+// the stats prove none does. Nulls match no comparison.
+func (p *rowGroupPredicate) mayMatch(stats metadata.TypedStatistics, rows int64) bool {
+	if stats.HasNullCount() && stats.NullCount() >= rows {
+		return false
+	}
+	if !stats.HasMinMax() {
+		return true
+	}
+	switch s := stats.(type) {
+	case *metadata.Int32Statistics:
+		return rangeMayMatch(p.op, int64(s.Min()), int64(s.Max()), p.value.(int64))
+	case *metadata.Int64Statistics:
+		return rangeMayMatch(p.op, s.Min(), s.Max(), p.value.(int64))
+	case *metadata.Float32Statistics:
+		// the NaNs left out of the stats are unequal to any value
+		if p.op == CompareNE {
+			return true
+		}
+		return rangeMayMatch(p.op, float64(s.Min()), float64(s.Max()), p.value.(float64))
+	case *metadata.Float64Statistics:
+		if p.op == CompareNE {
+			return true
+		}
+		return rangeMayMatch(p.op, s.Min(), s.Max(), p.value.(float64))
+	case *metadata.ByteArrayStatistics:
+		return rangeMayMatch(p.op, string(s.Min()), string(s.Max()), p.value.(string))
+	case *metadata.BooleanStatistics:
+		toInt := func(b bool) int64 {
+			if b {
+				return 1
+			}
+			return 0
+		}
+		return rangeMayMatch(p.op, toInt(s.Min()), toInt(s.Max()), toInt(p.value.(bool)))
+	}
+	return true
+}
+
+// rangeMayMatch tells whether a value within [lo, hi] may compare with op to target.
+func rangeMayMatch[V cmp.Ordered](op CompareOp, lo, hi, target V) bool {
+	switch op {
+	case CompareEQ:
+		return lo <= target && target <= hi
+	case CompareNE:
+		return lo != target || hi != target
+	case CompareLT:
+		return lo < target
+	case CompareLE:
+		return lo <= target
+	case CompareGT:
+		return hi > target
+	case CompareGE:
+		return hi >= target
+	}
+	return true
+}
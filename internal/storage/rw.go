@@ -23,6 +23,7 @@ import (
 	sio "io"
 	"path"
 	"sort"
+	"strings"
 
 	"github.com/samber/lo"
 
@@ -69,6 +70,7 @@ type rwOptions struct {
 	storageConfig       *indexpb.StorageConfig
 	neededFields        typeutil.Set[int64]
 	useLoonFFI          bool
+	storageResolver     StorageConfigResolver
 }
 
 func (o *rwOptions) validate() error {
@@ -171,6 +173,15 @@ func WithUseLoonFFI(useLoonFFI bool) RwOption {
 	}
 }
 
+// WithStorageResolver reads the column group files of a StorageV2 segment each from the
+// storage resolved for its path, for segments spread across storages during a tier
+// migration. Paths carrying a scheme are passed to the resolver without the bucket prefix.
+func WithStorageResolver(resolver StorageConfigResolver) RwOption {
+	return func(options *rwOptions) {
+		options.storageResolver = resolver
+	}
+}
+
 func makeBlobsReader(ctx context.Context, binlogs []*datapb.FieldBinlog, downloader downloaderFn) (ChunkedBlobsReader, error) {
 	if len(binlogs) == 0 {
 		return func() ([]*Blob, error) {
@@ -283,6 +294,14 @@ func NewBinlogRecordReader(ctx context.Context, binlogs []*datapb.FieldBinlog, s
 			return binlogs[i].GetFieldID() < binlogs[j].GetFieldID()
 		})
 
+		readSchema := schema
+		if rwOptions.neededFields != nil {
+			binlogs, readSchema = selectColumnGroupBinlogs(binlogs, schema, rwOptions.neededFields)
+			if len(binlogs) == 0 {
+				return nil, merr.WrapErrParameterInvalidMsg("no column group contains needed fields %v", rwOptions.neededFields.Collect())
+			}
+		}
+
 		binlogLists := lo.Map(binlogs, func(fieldBinlog *datapb.FieldBinlog, _ int) []*datapb.Binlog {
 			return fieldBinlog.GetBinlogs()
 		})
@@ -291,14 +310,24 @@ func NewBinlogRecordReader(ctx context.Context, binlogs []*datapb.FieldBinlog, s
 		for _, binlogs := range binlogLists {
 			for j, binlog := range binlogs {
 				logPath := binlog.GetLogPath()
-				if rwOptions.storageConfig.StorageType != "local" {
+				hasScheme := rwOptions.storageResolver != nil && strings.Contains(logPath, "://")
+				if rwOptions.storageConfig.StorageType != "local" && !hasScheme {
 					logPath = path.Join(bucketName, logPath)
 				}
 				paths[j] = append(paths[j], logPath)
 			}
 		}
-		// FIXME: add needed fields support
-		rr = newIterativePackedRecordReader(paths, schema, rwOptions.bufferSize, rwOptions.storageConfig, pluginContext)
+		var packedOpts []PackedReaderOption
+		if rwOptions.storageResolver != nil {
+			pathFieldIDs := lo.Map(binlogs, func(fieldBinlog *datapb.FieldBinlog, _ int) []int64 {
+				if len(fieldBinlog.GetChildFields()) > 0 {
+					return fieldBinlog.GetChildFields()
+				}
+				return []int64{fieldBinlog.GetFieldID()}
+			})
+			packedOpts = append(packedOpts, WithStorageConfigResolver(rwOptions.storageResolver, pathFieldIDs))
+		}
+		rr = newIterativePackedRecordReader(paths, readSchema, rwOptions.bufferSize, rwOptions.storageConfig, pluginContext, packedOpts...)
 	default:
 		return nil, merr.WrapErrServiceInternal(fmt.Sprintf("unsupported storage version %d", rwOptions.version))
 	}
@@ -308,6 +337,28 @@ func NewBinlogRecordReader(ctx context.Context, binlogs []*datapb.FieldBinlog, s
 	return rr, nil
 }
 
+// selectColumnGroupBinlogs keeps the column groups holding any of neededFields and
+// projects schema to the fields of the kept groups, so that files of groups not needed
+// are never opened. It falls back to reading all groups if the binlogs carry no
+// child fields to tell the group layout.
+func selectColumnGroupBinlogs(binlogs []*datapb.FieldBinlog, schema *schemapb.CollectionSchema, neededFields typeutil.Set[int64],
+) ([]*datapb.FieldBinlog, *schemapb.CollectionSchema) {
+	for _, fieldBinlog := range binlogs {
+		if len(fieldBinlog.GetChildFields()) == 0 {
+			return binlogs, schema
+		}
+	}
+	readFields := typeutil.NewSet[int64]()
+	selected := lo.Filter(binlogs, func(fieldBinlog *datapb.FieldBinlog, _ int) bool {
+		if !lo.SomeBy(fieldBinlog.GetChildFields(), func(fieldID int64) bool { return neededFields.Contain(fieldID) }) {
+			return false
+		}
+		readFields.Insert(fieldBinlog.GetChildFields()...)
+		return true
+	})
+	return selected, projectSchema(schema, readFields)
+}
+
 func NewManifestRecordReader(ctx context.Context, manifestPath string, schema *schemapb.CollectionSchema, option ...RwOption) (rr RecordReader, err error) {
 	rwOptions := DefaultReaderOptions()
 	for _, opt := range option {
@@ -20,6 +20,7 @@ import (
 	"context"
 	"io"
 	"math"
+	"os"
 	"strconv"
 	"sync/atomic"
 	"testing"
@@ -198,6 +199,92 @@ func (s *PackedBinlogRecordSuite) TestPackedBinlogRecordIntegration() {
 	s.NoError(err)
 }
 
+func (s *PackedBinlogRecordSuite) TestMissingColumnGroupFile() {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	s.mockBinlogIO.EXPECT().Upload(mock.Anything, mock.Anything).Return(nil)
+	rows := 100
+	columnGroups := []storagecommon.ColumnGroup{
+		{
+			GroupID: 0,
+			Columns: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 14, 15, 16, 17},
+			Fields:  []int64{0, 1, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 101, 103, 104, 105, 106},
+		},
+		{
+			GroupID: 102,
+			Columns: []int{13},
+			Fields:  []int64{102},
+		},
+	}
+	wOption := []RwOption{
+		WithUploader(func(ctx context.Context, kvs map[string][]byte) error {
+			return s.mockBinlogIO.Upload(ctx, kvs)
+		}),
+		WithVersion(StorageV2),
+		WithMultiPartUploadSize(0),
+		WithBufferSize(1 * 1024 * 1024), // 1MB
+		WithColumnGroups(columnGroups),
+		WithStorageConfig(s.storageConfig),
+	}
+	w, err := NewBinlogRecordWriter(s.ctx, s.collectionID, s.partitionID, s.segmentID, s.schema, s.logIDAlloc, s.chunkSize, s.maxRowNum, wOption...)
+	s.NoError(err)
+
+	blobs, err := generateTestData(rows)
+	s.NoError(err)
+	reader, err := NewBinlogDeserializeReader(generateTestSchema(), MakeBlobsReader(blobs), false)
+	s.NoError(err)
+	defer reader.Close()
+	for i := 1; i <= rows; i++ {
+		value, err := reader.NextValue()
+		s.NoError(err)
+		rec, err := ValueSerializer([]*Value{*value}, s.schema)
+		s.NoError(err)
+		s.NoError(w.Write(rec))
+	}
+	s.NoError(w.Close())
+
+	fieldBinlogs, _, _, _ := w.GetLogs()
+	binlogs := SortFieldBinlogs(fieldBinlogs)
+	var missingPath string
+	for _, fieldBinlog := range binlogs {
+		if fieldBinlog.GetFieldID() == 102 {
+			missingPath = fieldBinlog.GetBinlogs()[0].GetLogPath()
+		}
+	}
+	s.NotEmpty(missingPath)
+	s.NoError(os.Remove(missingPath))
+
+	s.Run("projection skips missing group", func() {
+		r, err := NewBinlogRecordReader(s.ctx, binlogs, s.schema,
+			WithVersion(StorageV2),
+			WithStorageConfig(s.storageConfig),
+			WithNeededFields(typeutil.NewSet[int64](common.RowIDField, 13)))
+		s.NoError(err)
+		defer r.Close()
+		readRows := 0
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			s.NoError(err)
+			s.Equal(rec.Len(), rec.Column(13).Len())
+			readRows += rec.Len()
+		}
+		s.Equal(rows, readRows)
+	})
+
+	s.Run("needed group missing", func() {
+		r, err := NewBinlogRecordReader(s.ctx, binlogs, s.schema,
+			WithVersion(StorageV2),
+			WithStorageConfig(s.storageConfig),
+			WithNeededFields(typeutil.NewSet[int64](common.RowIDField, 102)))
+		s.NoError(err)
+		defer r.Close()
+		_, err = r.Next()
+		s.ErrorContains(err, missingPath)
+	})
+}
+
 func (s *PackedBinlogRecordSuite) TestGenerateBM25Stats() {
 	s.mockBinlogIO.EXPECT().Upload(mock.Anything, mock.Anything).Return(nil)
 	s.schema = genCollectionSchemaWithBM25()
@@ -2,21 +2,48 @@ package storage
 
 import (
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
+	"github.com/milvus-io/milvus/internal/storagecommon"
 	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
 )
 
+// checkVectorDim checks that dim sizes the values of the vector field, a non-positive dim
+// would otherwise surface as a failed or panicking decode of the column.
+func checkVectorDim(field *schemapb.FieldSchema, dim int) error {
+	if dim <= 0 {
+		return merr.WrapErrParameterInvalid("positive dim", strconv.Itoa(dim), fmt.Sprintf("invalid dim of vector field [%s]", field.GetName()))
+	}
+	if field.DataType == schemapb.DataType_BinaryVector && dim%8 != 0 {
+		return merr.WrapErrParameterInvalid("dim divisible by 8", strconv.Itoa(dim), fmt.Sprintf("invalid dim of binary vector field [%s]", field.GetName()))
+	}
+	return nil
+}
+
+// ConvertToArrowSchema converts schema into the arrow schema of its packed files. The
+// columns are in the order of CanonicalColumnOrder.
 func ConvertToArrowSchema(schema *schemapb.CollectionSchema, useFieldID bool) (*arrow.Schema, error) {
 	fieldCount := typeutil.GetTotalFieldsNum(schema)
 	arrowFields := make([]arrow.Field, 0, fieldCount)
 	appendArrowField := func(field *schemapb.FieldSchema) error {
-		if serdeMap[field.DataType].arrowType == nil {
+		entry, ok := lookupSerdeEntry(field)
+		if !ok || entry.arrowType == nil {
 			return merr.WrapErrParameterInvalidMsg("unknown field data type [%s] for field [%s]", field.DataType, field.GetName())
 		}
 		var dim int
@@ -28,6 +55,9 @@ func ConvertToArrowSchema(schema *schemapb.CollectionSchema, useFieldID bool) (*
 			if err != nil {
 				return merr.WrapErrParameterInvalidMsg("dim not found in field [%s] params", field.GetName())
 			}
+			if err := checkVectorDim(field, dim); err != nil {
+				return err
+			}
 		default:
 			dim = 0
 		}
@@ -37,7 +67,7 @@ func ConvertToArrowSchema(schema *schemapb.CollectionSchema, useFieldID bool) (*
 			elementType = field.GetElementType()
 		}
 
-		arrowType := serdeMap[field.DataType].arrowType(dim, elementType)
+		arrowType := entry.arrowType(dim, elementType)
 		arrowField := ConvertToArrowField(field, arrowType, useFieldID)
 
 		// Add extra metadata for ArrayOfVector
@@ -48,7 +78,7 @@ func ConvertToArrowSchema(schema *schemapb.CollectionSchema, useFieldID bool) (*
 			)
 		}
 
-		arrowFields = append(arrowFields, arrowField)
+		arrowFields = append(arrowFields, withFieldSchemaMetadata(arrowField, field, len(arrowFields)))
 		return nil
 	}
 	for _, field := range schema.GetFields() {
@@ -68,6 +98,174 @@ func ConvertToArrowSchema(schema *schemapb.CollectionSchema, useFieldID bool) (*
 	return arrow.NewSchema(arrowFields, nil), nil
 }
 
+// The metadata keys of the arrow fields of ConvertToArrowSchema inverting the conversion,
+// see ReadPackedFields.
+const (
+	arrowFieldColumnKey      = "milvus.column"
+	arrowFieldDataTypeKey    = "milvus.data_type"
+	arrowFieldElementTypeKey = "milvus.element_type"
+	arrowFieldTypeParamsKey  = "milvus.type_params"
+	arrowFieldPrimaryKeyKey  = "milvus.primary_key"
+)
+
+// withFieldSchemaMetadata stamps f, the arrow field of field at column, with the metadata
+// ReadPackedFields reconstructs field from.
+func withFieldSchemaMetadata(f arrow.Field, field *schemapb.FieldSchema, column int) arrow.Field {
+	keys := append([]string(nil), f.Metadata.Keys()...)
+	values := append([]string(nil), f.Metadata.Values()...)
+	add := func(key, value string) {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	add(arrowFieldColumnKey, strconv.Itoa(column))
+	add(arrowFieldDataTypeKey, strconv.Itoa(int(field.GetDataType())))
+	if field.GetElementType() != schemapb.DataType_None {
+		add(arrowFieldElementTypeKey, strconv.Itoa(int(field.GetElementType())))
+	}
+	if len(field.GetTypeParams()) > 0 {
+		params := lo.Map(field.GetTypeParams(), func(kv *commonpb.KeyValuePair, _ int) [2]string {
+			return [2]string{kv.GetKey(), kv.GetValue()}
+		})
+		// marshaling string pairs cannot fail
+		data, _ := json.Marshal(params)
+		add(arrowFieldTypeParamsKey, string(data))
+	}
+	if field.GetIsPrimaryKey() {
+		add(arrowFieldPrimaryKeyKey, "true")
+	}
+	f.Metadata = arrow.NewMetadata(keys, values)
+	return f
+}
+
+// fieldSchemaOf reconstructs the field schema of f and its column index from the metadata
+// of withFieldSchemaMetadata.
+func fieldSchemaOf(f arrow.Field) (*schemapb.FieldSchema, int, error) {
+	intValue := func(key string) (int, bool, error) {
+		value, ok := f.Metadata.GetValue(key)
+		if !ok {
+			return 0, false, nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, false, merr.WrapErrParameterInvalidMsg("field [%s] has invalid %s %s", f.Name, key, value)
+		}
+		return v, true, nil
+	}
+	fieldID, ok, err := intValue(packed.ArrowFieldIdMetadataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return nil, 0, merr.WrapErrParameterInvalidMsg("field [%s] has no field id", f.Name)
+	}
+	column, ok, err := intValue(arrowFieldColumnKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	dataType, hasType, err := intValue(arrowFieldDataTypeKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok || !hasType {
+		return nil, 0, merr.WrapErrParameterInvalidMsg("field [%s] has no milvus field metadata, written before packed files recorded it", f.Name)
+	}
+	elementType, _, err := intValue(arrowFieldElementTypeKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	field := &schemapb.FieldSchema{
+		FieldID:     int64(fieldID),
+		Name:        f.Name,
+		DataType:    schemapb.DataType(dataType),
+		ElementType: schemapb.DataType(elementType),
+		Nullable:    f.Nullable,
+	}
+	if value, ok := f.Metadata.GetValue(arrowFieldTypeParamsKey); ok {
+		var params [][2]string
+		if err := json.Unmarshal([]byte(value), &params); err != nil {
+			return nil, 0, merr.WrapErrParameterInvalidMsg("field [%s] has invalid type params %s", f.Name, value)
+		}
+		field.TypeParams = lo.Map(params, func(kv [2]string, _ int) *commonpb.KeyValuePair {
+			return &commonpb.KeyValuePair{Key: kv[0], Value: kv[1]}
+		})
+	}
+	_, field.IsPrimaryKey = f.Metadata.GetValue(arrowFieldPrimaryKeyKey)
+	return field, column, nil
+}
+
+// ReadPackedFields reconstructs the fields of a segment from the arrow schemas of its
+// packed files at paths, the files of its column groups, for tooling that has the files
+// but not the collection schema. The fields are returned in the column order of the
+// writer: the field ID, name, data type, element type, type params such as dim and
+// max_length, nullability and primary key are recovered, the sub-fields of struct array
+// fields are returned as plain fields without their struct. Files written before the
+// metadata was recorded fail.
+func ReadPackedFields(paths []string) ([]*schemapb.FieldSchema, error) {
+	type column struct {
+		field *schemapb.FieldSchema
+		index int
+	}
+	var columns []column
+	seen := typeutil.NewSet[int64]()
+	for _, p := range paths {
+		s, err := packed.GetFileSchema(p, nil)
+		if err != nil {
+			return nil, merr.WrapErrIoFailed(p, err)
+		}
+		for _, f := range s.Fields() {
+			field, index, err := fieldSchemaOf(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read fields of packed file %s", p)
+			}
+			if seen.Contain(field.GetFieldID()) {
+				return nil, merr.WrapErrParameterInvalidMsg("field %d in more than one packed file", field.GetFieldID())
+			}
+			seen.Insert(field.GetFieldID())
+			columns = append(columns, column{field: field, index: index})
+		}
+	}
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].index < columns[j].index })
+	return lo.Map(columns, func(c column, _ int) *schemapb.FieldSchema { return c.field }), nil
+}
+
+// readPackedColumnGroups returns the column group laid out in each of the packed files at
+// paths, by the column of every field recorded in the file metadata, see ReadPackedFields.
+// The group ids are the indexes of the paths since the files do not record them.
+func readPackedColumnGroups(paths []string) ([]storagecommon.ColumnGroup, error) {
+	groups := make([]storagecommon.ColumnGroup, len(paths))
+	for i, p := range paths {
+		s, err := packed.GetFileSchema(p, nil)
+		if err != nil {
+			return nil, merr.WrapErrIoFailed(p, err)
+		}
+		groups[i].GroupID = int64(i)
+		for _, f := range s.Fields() {
+			_, index, err := fieldSchemaOf(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read column groups of packed file %s", p)
+			}
+			groups[i].Columns = append(groups[i].Columns, index)
+		}
+	}
+	return groups, nil
+}
+
+// CanonicalColumnOrder returns the field IDs of schema in the order of the columns of
+// ConvertToArrowSchema, the fields of the schema followed by the fields of its struct
+// array fields, the order records index their columns in.
+//
+// The order is the one of the schema rather than of the field IDs: the column groups of
+// packed files address the columns by index, so sorting them would break reading the
+// segments already written. A field added to a collection is appended to its fields,
+// which keeps the indices of the fields before it but shifts the columns of the struct
+// array fields, so consumers caching indices across schema versions should check them
+// against this order, or look the columns up by field ID with Record.Column.
+func CanonicalColumnOrder(schema *schemapb.CollectionSchema) []FieldID {
+	return lo.Map(typeutil.GetAllFieldSchemas(schema), func(field *schemapb.FieldSchema, _ int) FieldID {
+		return field.GetFieldID()
+	})
+}
+
 func ConvertToArrowField(field *schemapb.FieldSchema, dataType arrow.DataType, useFieldID bool) arrow.Field {
 	f := arrow.Field{
 		Type:     dataType,
@@ -84,3 +282,507 @@ func ConvertToArrowField(field *schemapb.FieldSchema, dataType arrow.DataType, u
 	}
 	return f
 }
+
+// packedFormatVersionKey is the arrow schema metadata key holding the format version of
+// packed files, as major.minor. Files written before the version was recorded lack it and
+// are of version 1.0.
+const packedFormatVersionKey = "milvus.packed.format_version"
+
+// packedFormatVersion is a format version of packed files. Minor versions only add to the
+// layout in ways older readers can ignore, a major version breaks it.
+type packedFormatVersion struct {
+	major int
+	minor int
+}
+
+func (v packedFormatVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// supportedPackedFormatMajor is the latest major version of packed files this reader
+// reads. currentPackedFormatVersion is the version of the files written.
+const supportedPackedFormatMajor = 1
+
+var currentPackedFormatVersion = packedFormatVersion{major: 1, minor: 0}
+
+// withPackedFormatVersion returns s with the metadata recording version.
+func withPackedFormatVersion(s *arrow.Schema, version packedFormatVersion) *arrow.Schema {
+	return withSchemaMetadata(s, packedFormatVersionKey, version.String())
+}
+
+// serdeVersionKey is the arrow schema metadata key holding the serde version of packed
+// files, see SerdeVersion.
+const serdeVersionKey = "milvus.serde_version"
+
+// SerdeVersion is the version of the rules the values are serialized into the columns of
+// the packed files written with, e.g. the encoding of the vectors, recorded apart from the
+// format version of the file layout. A change of the rules bumps it, so that the readers
+// deserialize the files by the rules they were written with rather than misreading them.
+// Files written before the version was recorded lack it and are of serde version 1.
+const SerdeVersion = 1
+
+// packedSerdeVersionOf returns the serde version recorded in the schema of packed files.
+func packedSerdeVersionOf(s *arrow.Schema) (int, error) {
+	value, ok := s.Metadata().GetValue(serdeVersionKey)
+	if !ok {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version <= 0 {
+		return 0, merr.WrapErrParameterInvalidMsg("invalid packed serde version %s", value)
+	}
+	return version, nil
+}
+
+// checkPackedSerdeVersion fails on packed files of schema s of a serde version newer than
+// the reader supports. All versions supported deserialize alike for now, the readers are
+// to dispatch on the version once the serde rules change.
+func checkPackedSerdeVersion(paths []string, s *arrow.Schema) error {
+	version, err := packedSerdeVersionOf(s)
+	if err != nil {
+		return err
+	}
+	if version > SerdeVersion {
+		return merr.WrapErrParameterInvalid(fmt.Sprintf("serde version up to %d", SerdeVersion), strconv.Itoa(version),
+			fmt.Sprintf("packed files %v are of an unsupported serde version", paths))
+	}
+	return nil
+}
+
+// ReadPackedSerdeVersion returns the serde version of the packed files at paths, see
+// SerdeVersion, from the file of their first column group.
+func ReadPackedSerdeVersion(paths []string) (int, error) {
+	if len(paths) == 0 {
+		return 0, merr.WrapErrParameterInvalidMsg("no packed files to read the serde version from")
+	}
+	s, err := packed.GetFileSchema(paths[0], nil)
+	if err != nil {
+		return 0, merr.WrapErrIoFailed(paths[0], err)
+	}
+	return packedSerdeVersionOf(s)
+}
+
+// reservedMetadataPrefix prefixes the schema and field metadata keys of packed files used
+// by the storage itself.
+const reservedMetadataPrefix = "milvus."
+
+// ReadPackedSchemaMetadata returns the custom schema metadata of the packed files at paths
+// written with WithSchemaMetadata, e.g. the provenance of a segment, from the file of its
+// first column group. The metadata of the storage itself is left out.
+func ReadPackedSchemaMetadata(paths []string) (map[string]string, error) {
+	if len(paths) == 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("no packed files to read the schema metadata from")
+	}
+	s, err := packed.GetFileSchema(paths[0], nil)
+	if err != nil {
+		return nil, merr.WrapErrIoFailed(paths[0], err)
+	}
+	metadata := make(map[string]string)
+	for i, key := range s.Metadata().Keys() {
+		if !strings.HasPrefix(key, reservedMetadataPrefix) {
+			metadata[key] = s.Metadata().Values()[i]
+		}
+	}
+	return metadata, nil
+}
+
+// withSchemaMetadata returns s with the schema metadata key set to value.
+func withSchemaMetadata(s *arrow.Schema, key, value string) *arrow.Schema {
+	metadata := s.Metadata()
+	keys := append(append([]string(nil), metadata.Keys()...), key)
+	values := append(append([]string(nil), metadata.Values()...), value)
+	metadata = arrow.NewMetadata(keys, values)
+	return arrow.NewSchema(s.Fields(), &metadata)
+}
+
+// sortSchemaMetadata returns s with its metadata sorted by key.
+func sortSchemaMetadata(s *arrow.Schema) *arrow.Schema {
+	metadata := s.Metadata()
+	keys := append([]string(nil), metadata.Keys()...)
+	sort.Strings(keys)
+	values := lo.Map(keys, func(key string, _ int) string {
+		value, _ := metadata.GetValue(key)
+		return value
+	})
+	metadata = arrow.NewMetadata(keys, values)
+	return arrow.NewSchema(s.Fields(), &metadata)
+}
+
+// packedFormatVersionOf returns the format version recorded in the schema of packed files.
+func packedFormatVersionOf(s *arrow.Schema) (packedFormatVersion, error) {
+	value, ok := s.Metadata().GetValue(packedFormatVersionKey)
+	if !ok {
+		return packedFormatVersion{major: 1}, nil
+	}
+	var version packedFormatVersion
+	major, minor, found := strings.Cut(value, ".")
+	var err error
+	if version.major, err = strconv.Atoi(major); err == nil && found {
+		version.minor, err = strconv.Atoi(minor)
+	}
+	if err != nil || !found {
+		return packedFormatVersion{}, merr.WrapErrParameterInvalidMsg("invalid packed format version %s", value)
+	}
+	return version, nil
+}
+
+// checkPackedFormatVersion dispatches on the format version of packed files of schema s,
+// failing on major versions newer than the reader supports.
+func checkPackedFormatVersion(paths []string, s *arrow.Schema) error {
+	version, err := packedFormatVersionOf(s)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version.major <= supportedPackedFormatMajor:
+		// minor versions read as the latest one supported of their major
+		return nil
+	default:
+		return merr.WrapErrParameterInvalid(fmt.Sprintf("format version up to %d.x", supportedPackedFormatMajor), version.String(),
+			fmt.Sprintf("packed files %v are of an unsupported format version", paths))
+	}
+}
+
+const schemaFingerprintKey = "milvus.schema_fingerprint"
+
+// SchemaFingerprint returns a hash of the layout of the fields of schema, their field
+// IDs, data types, element types and dims, independent of the field order and of the
+// names and other properties not changing the layout. The packed writer records it in
+// the files, for the readers of WithSchemaFingerprintCheck.
+func SchemaFingerprint(schema *schemapb.CollectionSchema) string {
+	fields := typeutil.GetAllFieldSchemas(schema)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].GetFieldID() < fields[j].GetFieldID() })
+	h := fnv.New64a()
+	for _, field := range fields {
+		// fields without a dim hash a zero dim
+		dim, _ := GetDimFromParams(field.GetTypeParams())
+		fmt.Fprintf(h, "%d:%d:%d:%d;", field.GetFieldID(), field.GetDataType(), field.GetElementType(), dim)
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// checkSchemaFingerprint checks the fingerprint recorded in the schema s of packed files
+// against expected, files written before it was recorded pass.
+func checkSchemaFingerprint(paths []string, s *arrow.Schema, expected string) error {
+	stored, ok := s.Metadata().GetValue(schemaFingerprintKey)
+	if !ok {
+		return nil
+	}
+	if stored != expected {
+		return merr.WrapErrParameterInvalid(expected, stored,
+			fmt.Sprintf("schema fingerprint of packed files %v does not match the schema read with, the collection schema drifted from the data", paths))
+	}
+	return nil
+}
+
+// largeStringSchema returns s with its string fields widened to large strings, whose
+// 64-bit offsets address columns of more than 2GB per batch.
+func largeStringSchema(s *arrow.Schema) *arrow.Schema {
+	fields := s.Fields()
+	for i, field := range fields {
+		if arrow.TypeEqual(field.Type, arrow.BinaryTypes.String) {
+			fields[i].Type = arrow.BinaryTypes.LargeString
+		}
+	}
+	metadata := s.Metadata()
+	return arrow.NewSchema(fields, &metadata)
+}
+
+// dictionarySchema returns s, the arrow schema of schema, with the string columns of the
+// fields of fieldIDs dictionary-encoded, see WithDictionaryEncoding.
+func dictionarySchema(s *arrow.Schema, schema *schemapb.CollectionSchema, fieldIDs []FieldID) *arrow.Schema {
+	if len(fieldIDs) == 0 {
+		return s
+	}
+	fields := s.Fields()
+	for i, field := range typeutil.GetAllFieldSchemas(schema) {
+		if lo.Contains(fieldIDs, field.GetFieldID()) {
+			fields[i].Type = &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+		}
+	}
+	metadata := s.Metadata()
+	return arrow.NewSchema(fields, &metadata)
+}
+
+// checkDictionaryFields checks that the fields of fieldIDs are string fields of schema
+// other than its primary key, the only fields that can be dictionary-encoded.
+func checkDictionaryFields(schema *schemapb.CollectionSchema, fieldIDs []FieldID) error {
+	for _, fieldID := range fieldIDs {
+		field := typeutil.GetField(schema, fieldID)
+		if field == nil {
+			return merr.WrapErrFieldNotFound(fieldID)
+		}
+		if dt := field.GetDataType(); dt != schemapb.DataType_VarChar && dt != schemapb.DataType_String || field.GetIsPrimaryKey() {
+			return merr.WrapErrParameterInvalidMsg("field %d [%s] of type %s cannot be dictionary-encoded, only string fields other than the primary key can",
+				fieldID, field.GetName(), field.GetDataType())
+		}
+	}
+	return nil
+}
+
+// dictionaryEncode returns arr, a string array, dictionary-encoded as of type dt with
+// buffers of mem.
+func dictionaryEncode(mem memory.Allocator, arr arrow.Array, dt *arrow.DictionaryType) (arrow.Array, error) {
+	strs, ok := arr.(*array.String)
+	if !ok {
+		return nil, merr.WrapErrParameterInvalidMsg("cannot dictionary-encode a column of type %s", arr.DataType())
+	}
+	builder := array.NewDictionaryBuilder(mem, dt).(*array.BinaryDictionaryBuilder)
+	defer builder.Release()
+	builder.Reserve(strs.Len())
+	for i := 0; i < strs.Len(); i++ {
+		if strs.IsNull(i) {
+			builder.AppendNull()
+			continue
+		}
+		if err := builder.AppendString(strs.Value(i)); err != nil {
+			return nil, merr.WrapErrServiceInternal(fmt.Sprintf("dictionary-encode string column: %s", err.Error()))
+		}
+	}
+	return builder.NewArray(), nil
+}
+
+// widenStrings returns arr as a large string array of buffers of mem if it is a string
+// array, and arr retained otherwise.
+func widenStrings(mem memory.Allocator, arr arrow.Array) arrow.Array {
+	strs, ok := arr.(*array.String)
+	if !ok {
+		arr.Retain()
+		return arr
+	}
+	builder := array.NewLargeStringBuilder(mem)
+	defer builder.Release()
+	builder.Reserve(strs.Len())
+	builder.ReserveData(len(strs.ValueBytes()))
+	for i := 0; i < strs.Len(); i++ {
+		if strs.IsNull(i) {
+			builder.AppendNull()
+		} else {
+			builder.Append(strs.Value(i))
+		}
+	}
+	return builder.NewArray()
+}
+
+// diffArrowSchema lists the field-by-field differences (name, type and nullability)
+// between the expected arrow schema and the actual one, empty if they match. A numeric
+// column stored narrower than expected, which the deserializer widens losslessly, is no
+// difference.
+func diffArrowSchema(expected, actual *arrow.Schema) []string {
+	diffs := make([]string, 0)
+	if expected.NumFields() != actual.NumFields() {
+		diffs = append(diffs, fmt.Sprintf("field count: expected %d, actual %d", expected.NumFields(), actual.NumFields()))
+	}
+	for i := 0; i < expected.NumFields() && i < actual.NumFields(); i++ {
+		e, a := expected.Field(i), actual.Field(i)
+		if e.Name != a.Name {
+			diffs = append(diffs, fmt.Sprintf("field %d name: expected %s, actual %s", i, e.Name, a.Name))
+		}
+		if !arrow.TypeEqual(e.Type, a.Type) && !isArrowWidening(a.Type, e.Type) {
+			diffs = append(diffs, fmt.Sprintf("field %d [%s] type: expected %s, actual %s", i, e.Name, e.Type, a.Type))
+		}
+		if e.Nullable != a.Nullable {
+			diffs = append(diffs, fmt.Sprintf("field %d [%s] nullable: expected %t, actual %t", i, e.Name, e.Nullable, a.Nullable))
+		}
+	}
+	return diffs
+}
+
+// isArrowWidening tells whether a numeric column stored as type from is read as type to by
+// the lossless widening of the deserializer, see upcastFields.
+func isArrowWidening(from, to arrow.DataType) bool {
+	stored, ok := numericColumnTypes[from.ID()]
+	if !ok {
+		return false
+	}
+	read, ok := numericColumnTypes[to.ID()]
+	return ok && isLosslessWidening(stored, read)
+}
+
+// CheckSchemaCompatible checks that the arrow schema of existing packed files holds the
+// same fields, matched by field ID, with the same types and nullability as schema, so that
+// overwriting the files with ones of schema cannot leave a segment of mixed layouts.
+func CheckSchemaCompatible(existing *arrow.Schema, schema *schemapb.CollectionSchema) error {
+	expected, err := ConvertToArrowSchema(schema, true)
+	if err != nil {
+		return err
+	}
+	fieldsByID := func(s *arrow.Schema) (map[int64]arrow.Field, error) {
+		fields := make(map[int64]arrow.Field, s.NumFields())
+		for _, field := range s.Fields() {
+			value, ok := field.Metadata.GetValue(packed.ArrowFieldIdMetadataKey)
+			if !ok {
+				return nil, merr.WrapErrParameterInvalidMsg("field [%s] of existing packed files has no field id", field.Name)
+			}
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, merr.WrapErrParameterInvalidMsg("field [%s] of existing packed files has invalid field id %s", field.Name, value)
+			}
+			fields[id] = field
+		}
+		return fields, nil
+	}
+	existingFields, err := fieldsByID(existing)
+	if err != nil {
+		return err
+	}
+	expectedFields, err := fieldsByID(expected)
+	if err != nil {
+		return err
+	}
+
+	ids := lo.Union(lo.Keys(existingFields), lo.Keys(expectedFields))
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	diffs := make([]string, 0)
+	for _, id := range ids {
+		e, inExpected := expectedFields[id]
+		a, inExisting := existingFields[id]
+		switch {
+		case !inExisting:
+			diffs = append(diffs, fmt.Sprintf("field %d not in existing files", id))
+		case !inExpected:
+			diffs = append(diffs, fmt.Sprintf("field %d not in new schema", id))
+		case !arrow.TypeEqual(e.Type, a.Type):
+			diffs = append(diffs, fmt.Sprintf("field %d type: existing %s, new %s", id, a.Type, e.Type))
+		case e.Nullable != a.Nullable:
+			diffs = append(diffs, fmt.Sprintf("field %d nullable: existing %t, new %t", id, a.Nullable, e.Nullable))
+		}
+	}
+	if len(diffs) > 0 {
+		return merr.WrapErrParameterInvalidMsg("schema of collection [%s] is incompatible with existing packed files: %s",
+			schema.GetName(), strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// readPackedFileSchemas returns the arrow schemas of the packed files at paths, the column
+// group files of a chunk, read with storageConfig.
+func readPackedFileSchemas(paths []string, storageConfig *indexpb.StorageConfig) ([]*arrow.Schema, error) {
+	schemas := make([]*arrow.Schema, 0, len(paths))
+	for _, p := range paths {
+		s, err := packed.GetFileSchema(p, storageConfig)
+		if err != nil {
+			return nil, merr.WrapErrIoFailed(p, err)
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas, nil
+}
+
+// packedChunkFields returns the fields of schema stored dictionary-encoded and the fields
+// missing from the packed files of the chunks at paths, read with storageConfig, see
+// packedDictionaryFields and missingPackedFields. The chunks are read with one schema, so
+// every chunk is checked to store and miss the same fields as the first one: a segment
+// whose chunks were written with different schemas fails rather than reading the fields
+// of some chunks as their default value.
+func packedChunkFields(paths [][]string, schema *schemapb.CollectionSchema, storageConfig *indexpb.StorageConfig) ([]FieldID, []*schemapb.FieldSchema, error) {
+	var dictionary []FieldID
+	var missing []*schemapb.FieldSchema
+	for i, chunk := range paths {
+		fileSchemas, err := readPackedFileSchemas(chunk, storageConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the fields dropped from schema since are not read
+		chunkDictionary := lo.Filter(packedDictionaryFields(fileSchemas), func(fieldID FieldID, _ int) bool {
+			return typeutil.GetField(schema, fieldID) != nil
+		})
+		chunkMissing, err := missingPackedFields(fileSchemas, schema)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			dictionary, missing = chunkDictionary, chunkMissing
+			continue
+		}
+		if !sameElements(dictionary, chunkDictionary) || !sameElements(missing, chunkMissing) {
+			return nil, nil, merr.WrapErrParameterInvalidMsg("chunk %d of packed segment holds other fields than its first chunk", i)
+		}
+	}
+	return dictionary, missing, nil
+}
+
+// sameElements tells whether a and b hold the same elements, in any order.
+func sameElements[T comparable](a, b []T) bool {
+	left, right := lo.Difference(a, b)
+	return len(left) == 0 && len(right) == 0
+}
+
+// packedDictionaryFields returns the fields whose columns are stored dictionary-encoded in
+// the packed files of fileSchemas, see WithDictionaryEncoding.
+func packedDictionaryFields(fileSchemas []*arrow.Schema) []FieldID {
+	var fieldIDs []FieldID
+	for _, s := range fileSchemas {
+		for _, f := range s.Fields() {
+			if f.Type.ID() != arrow.DICTIONARY {
+				continue
+			}
+			if value, ok := f.Metadata.GetValue(packed.ArrowFieldIdMetadataKey); ok {
+				if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+					fieldIDs = append(fieldIDs, id)
+				}
+			}
+		}
+	}
+	return fieldIDs
+}
+
+// missingPackedFields returns the fields of schema that the packed files of fileSchemas, the
+// column group files of a chunk, do not hold, such as the fields added to the collection
+// after the files were written, diffing ConvertToArrowSchema of schema against the arrow
+// schemas of the files. The fields missing must be nullable or have a default value to be
+// filled in on read.
+func missingPackedFields(fileSchemas []*arrow.Schema, schema *schemapb.CollectionSchema) ([]*schemapb.FieldSchema, error) {
+	expected, err := ConvertToArrowSchema(schema, true)
+	if err != nil {
+		return nil, err
+	}
+	stored := typeutil.NewSet[int64]()
+	for _, s := range fileSchemas {
+		for _, f := range s.Fields() {
+			if value, ok := f.Metadata.GetValue(packed.ArrowFieldIdMetadataKey); ok {
+				if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+					stored.Insert(id)
+				}
+			}
+		}
+	}
+	fields := make(map[int64]*schemapb.FieldSchema)
+	for _, field := range typeutil.GetAllFieldSchemas(schema) {
+		fields[field.GetFieldID()] = field
+	}
+	var missing []*schemapb.FieldSchema
+	for _, f := range expected.Fields() {
+		value, _ := f.Metadata.GetValue(packed.ArrowFieldIdMetadataKey)
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || stored.Contain(id) {
+			continue
+		}
+		field := fields[id]
+		if !field.GetNullable() && field.GetDefaultValue() == nil {
+			return nil, merr.WrapErrParameterInvalidMsg("field %d missing from packed files is neither nullable nor has a default value", id)
+		}
+		missing = append(missing, field)
+	}
+	return missing, nil
+}
+
+// projectSchema returns a copy of schema keeping only the fields in fieldIDs,
+// struct array fields are kept with the selected sub-fields only.
+func projectSchema(schema *schemapb.CollectionSchema, fieldIDs typeutil.Set[int64]) *schemapb.CollectionSchema {
+	projected := proto.Clone(schema).(*schemapb.CollectionSchema)
+	projected.Fields = lo.Filter(projected.GetFields(), func(field *schemapb.FieldSchema, _ int) bool {
+		return fieldIDs.Contain(field.GetFieldID())
+	})
+	structFields := make([]*schemapb.StructArrayFieldSchema, 0, len(projected.GetStructArrayFields()))
+	for _, structField := range projected.GetStructArrayFields() {
+		structField.Fields = lo.Filter(structField.GetFields(), func(field *schemapb.FieldSchema, _ int) bool {
+			return fieldIDs.Contain(field.GetFieldID())
+		})
+		if len(structField.Fields) > 0 {
+			structFields = append(structFields, structField)
+		}
+	}
+	projected.StructArrayFields = structFields
+	return projected
+}
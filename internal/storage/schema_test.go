@@ -17,12 +17,24 @@
 package storage
 
 import (
+	"strconv"
 	"testing"
 
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/internal/util/initcore"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
 )
 
 func TestConvertArrowSchema(t *testing.T) {
@@ -87,3 +99,318 @@ func TestConvertArrowSchemaWithoutDim(t *testing.T) {
 	_, err := ConvertToArrowSchema(schema, false)
 	assert.Error(t, err)
 }
+
+func TestConvertArrowSchemaInvalidDim(t *testing.T) {
+	for _, tc := range []struct {
+		dataType schemapb.DataType
+		dim      string
+	}{
+		{schemapb.DataType_FloatVector, "0"},
+		{schemapb.DataType_Float16Vector, "-8"},
+		{schemapb.DataType_Int8Vector, "abc"},
+		{schemapb.DataType_BinaryVector, "12"},
+	} {
+		schema := &schemapb.CollectionSchema{
+			Fields: []*schemapb.FieldSchema{
+				{FieldID: 1, Name: "pk", DataType: schemapb.DataType_Int64},
+				{FieldID: 2, Name: "vec", DataType: tc.dataType, TypeParams: []*commonpb.KeyValuePair{{Key: "dim", Value: tc.dim}}},
+			},
+		}
+		_, err := ConvertToArrowSchema(schema, true)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid, tc.dim)
+		assert.ErrorContains(t, err, "vec", tc.dim)
+
+		_, err = newPackedRecordReader([]string{"/tmp/invalid_dim/0"}, schema, 1024, nil, nil)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid, tc.dim)
+		assert.ErrorContains(t, err, "vec", tc.dim)
+	}
+}
+
+func TestDiffArrowSchema(t *testing.T) {
+	expected := arrow.NewSchema([]arrow.Field{
+		{Name: "0", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "100", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	t.Run("identical", func(t *testing.T) {
+		assert.Empty(t, diffArrowSchema(expected, expected))
+	})
+
+	t.Run("field differences", func(t *testing.T) {
+		actual := arrow.NewSchema([]arrow.Field{
+			{Name: "1", Type: arrow.PrimitiveTypes.Int64},
+			{Name: "100", Type: arrow.BinaryTypes.Binary, Nullable: false},
+		}, nil)
+		diffs := diffArrowSchema(expected, actual)
+		assert.Len(t, diffs, 3)
+		assert.Contains(t, diffs[0], "name")
+		assert.Contains(t, diffs[1], "type")
+		assert.Contains(t, diffs[2], "nullable")
+	})
+
+	t.Run("widened", func(t *testing.T) {
+		// stored narrower than read, upcast by the deserializer
+		actual := arrow.NewSchema([]arrow.Field{
+			{Name: "0", Type: arrow.PrimitiveTypes.Int32},
+			{Name: "100", Type: arrow.BinaryTypes.String, Nullable: true},
+		}, nil)
+		assert.Empty(t, diffArrowSchema(expected, actual))
+		narrowed := arrow.NewSchema([]arrow.Field{{Name: "0", Type: arrow.PrimitiveTypes.Int32}}, nil)
+		assert.Len(t, diffArrowSchema(narrowed, arrow.NewSchema(expected.Fields()[:1], nil)), 1)
+	})
+
+	t.Run("field count", func(t *testing.T) {
+		actual := arrow.NewSchema(expected.Fields()[:1], nil)
+		diffs := diffArrowSchema(expected, actual)
+		assert.Len(t, diffs, 1)
+		assert.Contains(t, diffs[0], "field count")
+	})
+}
+
+func TestCheckSchemaCompatible(t *testing.T) {
+	newSchema := func() *schemapb.CollectionSchema {
+		return &schemapb.CollectionSchema{
+			Name: "test",
+			Fields: []*schemapb.FieldSchema{
+				{FieldID: 100, Name: "pk", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+				{FieldID: 101, Name: "name", DataType: schemapb.DataType_VarChar, Nullable: true},
+			},
+		}
+	}
+	existing, err := ConvertToArrowSchema(newSchema(), false)
+	assert.NoError(t, err)
+
+	t.Run("compatible", func(t *testing.T) {
+		// names may differ, fields are matched by id
+		assert.NoError(t, CheckSchemaCompatible(existing, newSchema()))
+	})
+
+	t.Run("type changed", func(t *testing.T) {
+		schema := newSchema()
+		schema.Fields[0].DataType = schemapb.DataType_Int32
+		assert.ErrorContains(t, CheckSchemaCompatible(existing, schema), "field 100 type")
+	})
+
+	t.Run("nullable changed", func(t *testing.T) {
+		schema := newSchema()
+		schema.Fields[1].Nullable = false
+		assert.ErrorContains(t, CheckSchemaCompatible(existing, schema), "field 101 nullable")
+	})
+
+	t.Run("field added", func(t *testing.T) {
+		schema := newSchema()
+		schema.Fields = append(schema.Fields, &schemapb.FieldSchema{FieldID: 102, Name: "age", DataType: schemapb.DataType_Int64})
+		assert.ErrorContains(t, CheckSchemaCompatible(existing, schema), "field 102 not in existing files")
+	})
+
+	t.Run("field dropped", func(t *testing.T) {
+		schema := newSchema()
+		schema.Fields = schema.Fields[:1]
+		assert.ErrorContains(t, CheckSchemaCompatible(existing, schema), "field 101 not in new schema")
+	})
+
+	t.Run("no field id", func(t *testing.T) {
+		noID := arrow.NewSchema([]arrow.Field{{Name: "pk", Type: arrow.PrimitiveTypes.Int64}}, nil)
+		assert.Error(t, CheckSchemaCompatible(noID, newSchema()))
+	})
+}
+
+func TestProjectSchema(t *testing.T) {
+	schema := &schemapb.CollectionSchema{
+		Name: "test",
+		Fields: []*schemapb.FieldSchema{
+			{FieldID: 100, Name: "pk", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: 101, Name: "vec", DataType: schemapb.DataType_FloatVector},
+		},
+		StructArrayFields: []*schemapb.StructArrayFieldSchema{
+			{FieldID: 102, Name: "struct", Fields: []*schemapb.FieldSchema{
+				{FieldID: 103, Name: "sub0", DataType: schemapb.DataType_Array},
+				{FieldID: 104, Name: "sub1", DataType: schemapb.DataType_Array},
+			}},
+			{FieldID: 105, Name: "struct1", Fields: []*schemapb.FieldSchema{
+				{FieldID: 106, Name: "sub2", DataType: schemapb.DataType_Array},
+			}},
+		},
+	}
+
+	projected := projectSchema(schema, typeutil.NewSet[int64](100, 104))
+	assert.Equal(t, "test", projected.GetName())
+	assert.Equal(t, []int64{100, 104}, lo.Map(typeutil.GetAllFieldSchemas(projected), func(field *schemapb.FieldSchema, _ int) int64 {
+		return field.GetFieldID()
+	}))
+	// original schema untouched
+	assert.Len(t, schema.GetFields(), 2)
+	assert.Len(t, schema.GetStructArrayFields()[0].GetFields(), 2)
+}
+
+func TestCanonicalColumnOrder(t *testing.T) {
+	schema := &schemapb.CollectionSchema{
+		Fields: []*schemapb.FieldSchema{
+			{FieldID: 100, Name: "pk", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: 0, Name: "row_id", DataType: schemapb.DataType_Int64},
+			{FieldID: 102, Name: "name", DataType: schemapb.DataType_VarChar},
+			{FieldID: 101, Name: "age", DataType: schemapb.DataType_Int32},
+		},
+		StructArrayFields: []*schemapb.StructArrayFieldSchema{
+			{FieldID: 103, Name: "struct", Fields: []*schemapb.FieldSchema{
+				{FieldID: 104, Name: "sub", DataType: schemapb.DataType_Array, ElementType: schemapb.DataType_Int32},
+			}},
+		},
+	}
+	columnIDs := func(s *arrow.Schema) []FieldID {
+		return lo.Map(s.Fields(), func(field arrow.Field, _ int) FieldID {
+			id, err := strconv.ParseInt(field.Name, 10, 64)
+			assert.NoError(t, err)
+			return id
+		})
+	}
+
+	order := CanonicalColumnOrder(schema)
+	assert.Equal(t, []FieldID{100, 0, 102, 101, 104}, order)
+	for i := 0; i < 3; i++ {
+		arrowSchema, err := ConvertToArrowSchema(schema, true)
+		assert.NoError(t, err)
+		assert.Equal(t, order, columnIDs(arrowSchema))
+	}
+
+	// a field added to the schema keeps the indices of the fields before it, the struct
+	// array fields move after it
+	schema.Fields = append(schema.Fields, &schemapb.FieldSchema{FieldID: 105, Name: "added", DataType: schemapb.DataType_Double, Nullable: true})
+	extended := CanonicalColumnOrder(schema)
+	assert.Equal(t, []FieldID{100, 0, 102, 101, 105, 104}, extended)
+	arrowSchema, err := ConvertToArrowSchema(schema, true)
+	assert.NoError(t, err)
+	assert.Equal(t, extended, columnIDs(arrowSchema))
+}
+
+func TestReadPackedFields(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := &schemapb.CollectionSchema{
+		Fields: []*schemapb.FieldSchema{
+			{FieldID: 0, Name: "row_id", DataType: schemapb.DataType_Int64},
+			{FieldID: 1, Name: "timestamp", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "pk", DataType: schemapb.DataType_VarChar, IsPrimaryKey: true, TypeParams: []*commonpb.KeyValuePair{
+				{Key: common.MaxLengthKey, Value: "64"},
+			}},
+			{FieldID: 101, Name: "age", DataType: schemapb.DataType_Int32, Nullable: true},
+			{FieldID: 102, Name: "tags", DataType: schemapb.DataType_Array, ElementType: schemapb.DataType_Int64, TypeParams: []*commonpb.KeyValuePair{
+				{Key: common.MaxCapacityKey, Value: "16"},
+			}},
+			{FieldID: 103, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{
+				{Key: common.DimKey, Value: "8"},
+			}},
+		},
+	}
+
+	arrowSchema, err := ConvertToArrowSchema(schema, false)
+	require.NoError(t, err)
+	for i, f := range arrowSchema.Fields() {
+		field, column, err := fieldSchemaOf(f)
+		require.NoError(t, err)
+		assert.Equal(t, i, column)
+		assert.True(t, proto.Equal(schema.Fields[i], field), field.String())
+	}
+
+	// the vector lives in a group of its own, written first
+	groups := []storagecommon.ColumnGroup{{GroupID: 1, Columns: []int{5}}, {GroupID: 0, Columns: []int{0, 1, 2, 3, 4}}}
+	paths := []string{"/tmp/read_packed_fields/1", "/tmp/read_packed_fields/0"}
+	writer, err := NewPackedRecordWriter("", paths, schema, 1024*1024, 0, groups, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	fields, err := ReadPackedFields(paths)
+	require.NoError(t, err)
+	require.Len(t, fields, len(schema.Fields))
+	for i, field := range fields {
+		assert.True(t, proto.Equal(schema.Fields[i], field), field.String())
+	}
+
+	t.Run("without metadata", func(t *testing.T) {
+		f := arrow.Field{Name: "legacy", Type: arrow.PrimitiveTypes.Int64,
+			Metadata: arrow.NewMetadata([]string{packed.ArrowFieldIdMetadataKey}, []string{"100"})}
+		_, _, err := fieldSchemaOf(f)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := ReadPackedFields([]string{"/tmp/read_packed_fields/missing"})
+		assert.Error(t, err)
+	})
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	schema := func() *schemapb.CollectionSchema {
+		return &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: 100, Name: "pk", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: 101, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{
+				{Key: common.DimKey, Value: "8"},
+			}},
+			{FieldID: 102, Name: "tags", DataType: schemapb.DataType_Array, ElementType: schemapb.DataType_Int64},
+		}}
+	}
+	fingerprint := SchemaFingerprint(schema())
+	assert.Equal(t, fingerprint, SchemaFingerprint(schema()))
+
+	// names and field order do not change the layout
+	renamed := schema()
+	renamed.Fields[0].Name = "id"
+	renamed.Fields[0], renamed.Fields[2] = renamed.Fields[2], renamed.Fields[0]
+	assert.Equal(t, fingerprint, SchemaFingerprint(renamed))
+
+	for name, drift := range map[string]func(s *schemapb.CollectionSchema){
+		"field id":     func(s *schemapb.CollectionSchema) { s.Fields[0].FieldID = 103 },
+		"data type":    func(s *schemapb.CollectionSchema) { s.Fields[0].DataType = schemapb.DataType_VarChar },
+		"dim":          func(s *schemapb.CollectionSchema) { s.Fields[1].TypeParams[0].Value = "16" },
+		"element type": func(s *schemapb.CollectionSchema) { s.Fields[2].ElementType = schemapb.DataType_Float },
+		"added field": func(s *schemapb.CollectionSchema) {
+			s.Fields = append(s.Fields, &schemapb.FieldSchema{FieldID: 103, DataType: schemapb.DataType_Bool})
+		},
+	} {
+		drifted := schema()
+		drift(drifted)
+		assert.NotEqual(t, fingerprint, SchemaFingerprint(drifted), name)
+	}
+}
+
+func TestPackedFormatVersion(t *testing.T) {
+	s := arrow.NewSchema([]arrow.Field{{Name: "a", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	version, err := packedFormatVersionOf(s)
+	assert.NoError(t, err)
+	assert.Equal(t, packedFormatVersion{major: 1}, version)
+
+	version, err = packedFormatVersionOf(withPackedFormatVersion(s, packedFormatVersion{major: 3, minor: 12}))
+	assert.NoError(t, err)
+	assert.Equal(t, packedFormatVersion{major: 3, minor: 12}, version)
+
+	for _, value := range []string{"", "1", "1.x", "a.0"} {
+		metadata := arrow.NewMetadata([]string{packedFormatVersionKey}, []string{value})
+		_, err := packedFormatVersionOf(arrow.NewSchema(s.Fields(), &metadata))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid, value)
+	}
+
+	assert.NoError(t, checkPackedFormatVersion(nil, withPackedFormatVersion(s, packedFormatVersion{major: 1, minor: 5})))
+	err = checkPackedFormatVersion(nil, withPackedFormatVersion(s, packedFormatVersion{major: 2}))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	assert.ErrorContains(t, err, "2.0")
+	assert.ErrorContains(t, err, "1.x")
+}
+
+func TestPackedSerdeVersionOf(t *testing.T) {
+	s := arrow.NewSchema([]arrow.Field{{Name: "a", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	// files written before the tag are of version 1
+	version, err := packedSerdeVersionOf(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.NoError(t, checkPackedSerdeVersion(nil, s))
+
+	version, err = packedSerdeVersionOf(withSchemaMetadata(s, serdeVersionKey, strconv.Itoa(SerdeVersion)))
+	assert.NoError(t, err)
+	assert.Equal(t, SerdeVersion, version)
+
+	err = checkPackedSerdeVersion([]string{"/tmp/a"}, withSchemaMetadata(s, serdeVersionKey, strconv.Itoa(SerdeVersion+1)))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	for _, value := range []string{"", "0", "x"} {
+		err := checkPackedSerdeVersion(nil, withSchemaMetadata(s, serdeVersionKey, value))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	}
+}
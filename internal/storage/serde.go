@@ -23,6 +23,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
@@ -30,9 +31,11 @@ import (
 	"github.com/apache/arrow/go/v17/parquet"
 	"github.com/apache/arrow/go/v17/parquet/compress"
 	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+	"go.uber.org/atomic"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/json"
 	"github.com/milvus-io/milvus/pkg/v2/common"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
@@ -102,6 +105,33 @@ type serdeEntry struct {
 	serialize func(b array.Builder, v any, elementType schemapb.DataType) bool
 }
 
+// fixedSizeVectorBytes returns the raw bytes of vector i of a, stored either as
+// FixedSizeBinary or, as some writers encode vectors, as a FixedSizeList of fixed
+// width values.
+func fixedSizeVectorBytes(a arrow.Array, i int) ([]byte, bool) {
+	switch arr := a.(type) {
+	case *array.FixedSizeBinary:
+		if i < arr.Len() {
+			return arr.Value(i), true
+		}
+	case *array.FixedSizeList:
+		if i >= arr.Len() {
+			return nil, false
+		}
+		values := arr.ListValues()
+		fixedWidth, ok := values.DataType().(arrow.FixedWidthDataType)
+		if !ok || fixedWidth.BitWidth()%8 != 0 || values.NullN() > 0 {
+			return nil, false
+		}
+		width := int64(fixedWidth.BitWidth() / 8)
+		start, end := arr.ValueOffsets(i)
+		offset := int64(values.Data().Offset())
+		buffer := values.Data().Buffers()[1].Bytes()
+		return buffer[(offset+start)*width : (offset+end)*width], true
+	}
+	return nil, false
+}
+
 var serdeMap = func() map[schemapb.DataType]serdeEntry {
 	m := make(map[schemapb.DataType]serdeEntry)
 	m[schemapb.DataType_Bool] = serdeEntry{
@@ -328,22 +358,44 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 			if a.IsNull(i) {
 				return nil, true
 			}
-			if arr, ok := a.(*array.String); ok && i < arr.Len() {
-				value := arr.Value(i)
-				if shouldCopy {
-					return strings.Clone(value), true
+			var value string
+			switch arr := a.(type) {
+			case *array.String:
+				if i >= arr.Len() {
+					return nil, false
 				}
-				return value, true
+				value = arr.Value(i)
+			case *array.LargeString:
+				if i >= arr.Len() {
+					return nil, false
+				}
+				value = arr.Value(i)
+			case *array.Dictionary:
+				// the columns written with WithDictionaryEncoding
+				dict, ok := arr.Dictionary().(*array.String)
+				if !ok || i >= arr.Len() {
+					return nil, false
+				}
+				value = dict.Value(arr.GetValueIndex(i))
+			default:
+				return nil, false
 			}
-			return nil, false
+			if shouldCopy {
+				return strings.Clone(value), true
+			}
+			return value, true
 		},
 		serialize: func(b array.Builder, v any, _ schemapb.DataType) bool {
 			if v == nil {
 				b.AppendNull()
 				return true
 			}
-			if builder, ok := b.(*array.StringBuilder); ok {
-				if v, ok := v.(string); ok {
+			if v, ok := v.(string); ok {
+				switch builder := b.(type) {
+				case *array.StringBuilder:
+					builder.Append(v)
+					return true
+				case *array.LargeStringBuilder:
 					builder.Append(v)
 					return true
 				}
@@ -402,6 +454,10 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 			}
 			if arr, ok := a.(*array.Binary); ok && i < arr.Len() {
 				value := arr.Value(i)
+				if value == nil {
+					// an empty value, e.g. a sparse vector of no element, is not a null
+					value = []byte{}
+				}
 				if shouldCopy {
 					result := make([]byte, len(value))
 					copy(result, value)
@@ -421,6 +477,11 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 					builder.Append(vv)
 					return true
 				}
+				// JSON values read with WithRawJSON
+				if vv, ok := v.(json.RawMessage); ok {
+					builder.Append(vv)
+					return true
+				}
 				if vv, ok := v.(*schemapb.ScalarField); ok {
 					if bytes, err := proto.Marshal(vv); err == nil {
 						builder.Append(bytes)
@@ -537,16 +598,16 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 		if a.IsNull(i) {
 			return nil, true
 		}
-		if arr, ok := a.(*array.FixedSizeBinary); ok && i < arr.Len() {
-			value := arr.Value(i)
-			if shouldCopy {
-				result := make([]byte, len(value))
-				copy(result, value)
-				return result, true
-			}
-			return value, true
+		value, ok := fixedSizeVectorBytes(a, i)
+		if !ok {
+			return nil, false
 		}
-		return nil, false
+		if shouldCopy {
+			result := make([]byte, len(value))
+			copy(result, value)
+			return result, true
+		}
+		return value, true
 	}
 	fixedSizeSerializer := func(b array.Builder, v any, _ schemapb.DataType) bool {
 		if v == nil {
@@ -554,7 +615,8 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 			return true
 		}
 		if builder, ok := b.(*array.FixedSizeBinaryBuilder); ok {
-			if v, ok := v.([]byte); ok {
+			// the builder panics on a vector of another byte width than the column's
+			if v, ok := v.([]byte); ok && len(v) == builder.Type().(*arrow.FixedSizeBinaryType).ByteWidth {
 				builder.Append(v)
 				return true
 			}
@@ -591,9 +653,8 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 			if a.IsNull(i) {
 				return nil, true
 			}
-			if arr, ok := a.(*array.FixedSizeBinary); ok && i < arr.Len() {
+			if bytes, ok := fixedSizeVectorBytes(a, i); ok {
 				// convert to []int8
-				bytes := arr.Value(i)
 				int8s := make([]int8, len(bytes))
 				for i, b := range bytes {
 					int8s[i] = int8(b)
@@ -627,8 +688,11 @@ var serdeMap = func() map[schemapb.DataType]serdeEntry {
 			if a.IsNull(i) {
 				return nil, true
 			}
-			if arr, ok := a.(*array.FixedSizeBinary); ok && i < arr.Len() {
-				vector := arrow.Float32Traits.CastFromBytes(arr.Value(i))
+			if list, ok := a.(*array.FixedSizeList); ok && list.ListValues().DataType().ID() != arrow.FLOAT32 {
+				return nil, false
+			}
+			if bytes, ok := fixedSizeVectorBytes(a, i); ok {
+				vector := arrow.Float32Traits.CastFromBytes(bytes)
 				if shouldCopy {
 					vectorCopy := make([]float32, len(vector))
 					copy(vectorCopy, vector)
@@ -691,19 +755,32 @@ type DeserializeReaderImpl[T any] struct {
 	rec          Record
 	values       []T
 	pos          int
+	// reuse passes the values of the last batch to the deserializer again, see
+	// NewDeserializeReaderReusingValues.
+	reuse bool
+	// tail returns the values following those of the records, once these are all read,
+	// nil for none.
+	tail func() ([]T, error)
 }
 
 // Iterate to next value, return error or EOF if no more value.
 func (deser *DeserializeReaderImpl[T]) NextValue() (*T, error) {
 	if deser.pos == 0 || deser.pos >= len(deser.values) {
 		r, err := deser.rr.Next()
+		if err == io.EOF && deser.tail != nil {
+			return deser.nextTailValue()
+		}
 		if err != nil {
 			return nil, err
 		}
 		deser.pos = 0
 		deser.rec = r
 
-		deser.values = make([]T, deser.rec.Len())
+		if deser.reuse && cap(deser.values) >= deser.rec.Len() {
+			deser.values = deser.values[:deser.rec.Len()]
+		} else {
+			deser.values = make([]T, deser.rec.Len())
+		}
 
 		if err := deser.deserializer(deser.rec, deser.values); err != nil {
 			return nil, err
@@ -714,6 +791,23 @@ func (deser *DeserializeReaderImpl[T]) NextValue() (*T, error) {
 	return ret, nil
 }
 
+// nextTailValue returns the first of the values of tail, once the records are all read.
+func (deser *DeserializeReaderImpl[T]) nextTailValue() (*T, error) {
+	tail := deser.tail
+	deser.tail = nil
+	values, err := tail()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, io.EOF
+	}
+	deser.rec = nil
+	deser.values = values
+	deser.pos = 1
+	return &deser.values[0], nil
+}
+
 func (deser *DeserializeReaderImpl[T]) Close() error {
 	return deser.rr.Close()
 }
@@ -725,6 +819,61 @@ func NewDeserializeReader[T any](rr RecordReader, deserializer Deserializer[T])
 	}
 }
 
+// NewDeserializeReaderReusingValues is NewDeserializeReader handing the values of the
+// last batch back to the deserializer to refill in place, rather than a new slice of
+// zero values per batch, for the deserializers reusing the values they are passed such as
+// ValueDeserializerWithSchema. A value returned is therefore only valid until the next
+// batch is read: the caller must be done with all values of a batch, and keep none of
+// them, before reading past its last one, e.g. ReadAllValues must not be used.
+func NewDeserializeReaderReusingValues[T any](rr RecordReader, deserializer Deserializer[T]) *DeserializeReaderImpl[T] {
+	return &DeserializeReaderImpl[T]{
+		rr:           rr,
+		deserializer: deserializer,
+		reuse:        true,
+	}
+}
+
+// TimeBudgetReader stops reading a DeserializeReader once a wall-clock budget is spent,
+// for previews and sampling preferring a prompt partial result to a complete one.
+type TimeBudgetReader[T any] struct {
+	reader   DeserializeReader[T]
+	budget   time.Duration
+	deadline time.Time
+	exceeded bool
+}
+
+var _ DeserializeReader[any] = (*TimeBudgetReader[any])(nil)
+
+// NewTimeBudgetReader wraps reader to return io.EOF, instead of the next value, once
+// budget has passed since the first NextValue. The clock is checked before every value,
+// but a batch read or deserialized by reader is not interrupted, so the budget can be
+// overrun by the time of one batch.
+func NewTimeBudgetReader[T any](reader DeserializeReader[T], budget time.Duration) *TimeBudgetReader[T] {
+	return &TimeBudgetReader[T]{reader: reader, budget: budget}
+}
+
+func (br *TimeBudgetReader[T]) NextValue() (*T, error) {
+	now := time.Now()
+	if br.deadline.IsZero() {
+		br.deadline = now.Add(br.budget)
+	}
+	if !now.Before(br.deadline) {
+		br.exceeded = true
+		return nil, io.EOF
+	}
+	return br.reader.NextValue()
+}
+
+// Exceeded tells whether reading stopped because the budget was spent, rather than
+// reaching the end of reader.
+func (br *TimeBudgetReader[T]) Exceeded() bool {
+	return br.exceeded
+}
+
+func (br *TimeBudgetReader[T]) Close() error {
+	return br.reader.Close()
+}
+
 var _ Record = (*selectiveRecord)(nil)
 
 // selectiveRecord is a Record that only contains a single field, reusing existing Record.
@@ -1082,11 +1231,30 @@ type SerializeWriterImpl[T any] struct {
 	rw         RecordWriter
 	serializer Serializer[T]
 	batchSize  int
+	// batchBytes is the size of the batches flushed, 0 for batches of batchSize values,
+	// rowBytes the estimate of the size of a value it is divided by, see
+	// NewSerializeRecordWriterWithBatchBytes.
+	batchBytes int64
+	rowBytes   float64
 
 	buffer []T
 	pos    int
 }
 
+// maxTunedBatchSize caps the batch size derived from the batch bytes, for values
+// estimated to be tiny.
+const maxTunedBatchSize = 1 << 20
+
+// tuneBatchSize derives the batch size from the batch bytes and the size measured of the
+// rows of the last batch, rows written of written bytes. The estimate moves half way to
+// the measured size, so that a single batch of outliers does not swing the batch size.
+func (sw *SerializeWriterImpl[T]) tuneBatchSize(rows int, written uint64) {
+	if rows > 0 && written > 0 {
+		sw.rowBytes = (sw.rowBytes + float64(written)/float64(rows)) / 2
+	}
+	sw.batchSize = int(min(max(float64(sw.batchBytes)/max(sw.rowBytes, 1), 1), maxTunedBatchSize))
+}
+
 func (sw *SerializeWriterImpl[T]) Flush() error {
 	if sw.pos == 0 {
 		return nil
@@ -1097,15 +1265,25 @@ func (sw *SerializeWriterImpl[T]) Flush() error {
 		return err
 	}
 	defer r.Release()
-	if err := sw.rw.Write(r); err != nil {
+	written := sw.rw.GetWrittenUncompressed()
+	// the record is released here, writers releasing the records written to them
+	// must not take over its reference
+	write := sw.rw.Write
+	if bw, ok := sw.rw.(interface{ WriteBorrowed(Record) error }); ok {
+		write = bw.WriteBorrowed
+	}
+	if err := write(r); err != nil {
 		return err
 	}
+	if sw.batchBytes > 0 {
+		sw.tuneBatchSize(sw.pos, sw.rw.GetWrittenUncompressed()-written)
+	}
 	sw.pos = 0
 	return nil
 }
 
 func (sw *SerializeWriterImpl[T]) WriteValue(value T) error {
-	if sw.buffer == nil {
+	if len(sw.buffer) < sw.batchSize {
 		sw.buffer = make([]T, sw.batchSize)
 	}
 	sw.buffer[sw.pos] = value
@@ -1125,6 +1303,34 @@ func (sw *SerializeWriterImpl[T]) Close() error {
 	return sw.rw.Close()
 }
 
+// Abort drops the buffered values and aborts the underlying record writer if it
+// supports cleaning up its partially written files, see packedRecordWriter.Abort.
+func (sw *SerializeWriterImpl[T]) Abort() error {
+	sw.pos = 0
+	if aw, ok := sw.rw.(interface{ Abort() error }); ok {
+		return aw.Abort()
+	}
+	return nil
+}
+
+// AssignedRowIDs returns the range [start, end) of the row ids assigned by the
+// underlying record writer, see WithAutoRowIDs, or an empty range if it assigns none.
+func (sw *SerializeWriterImpl[T]) AssignedRowIDs() (start, end int64) {
+	if aw, ok := sw.rw.(interface{ AssignedRowIDs() (int64, int64) }); ok {
+		return aw.AssignedRowIDs()
+	}
+	return 0, 0
+}
+
+// GetPKBloomFilter returns the pk stats built by the underlying record writer once it is
+// closed, see packedRecordWriter.GetPKBloomFilter, or nil if it builds none.
+func (sw *SerializeWriterImpl[T]) GetPKBloomFilter() *PrimaryKeyStats {
+	if bw, ok := sw.rw.(interface{ GetPKBloomFilter() *PrimaryKeyStats }); ok {
+		return bw.GetPKBloomFilter()
+	}
+	return nil
+}
+
 func NewSerializeRecordWriter[T any](rw RecordWriter, serializer Serializer[T], batchSize int) *SerializeWriterImpl[T] {
 	return &SerializeWriterImpl[T]{
 		rw:         rw,
@@ -1133,10 +1339,50 @@ func NewSerializeRecordWriter[T any](rw RecordWriter, serializer Serializer[T],
 	}
 }
 
+// NewSerializeRecordWriterWithBatchBytes is NewSerializeRecordWriter flushing batches of
+// about batchBytes bytes rather than of a fixed count of values. The batch size is
+// derived from rowBytes, the estimated size of a value, until the first batch is written,
+// then from the sizes of the batches written, as counted by GetWrittenUncompressed of rw.
+// The sizes counted are those of the records serialized, so the batches are only tuned
+// with record writers counting them as they are written.
+func NewSerializeRecordWriterWithBatchBytes[T any](rw RecordWriter, serializer Serializer[T], batchBytes int64, rowBytes int64) *SerializeWriterImpl[T] {
+	sw := &SerializeWriterImpl[T]{
+		rw:         rw,
+		serializer: serializer,
+		batchBytes: batchBytes,
+		rowBytes:   float64(rowBytes),
+	}
+	sw.tuneBatchSize(0, 0)
+	return sw
+}
+
 type simpleArrowRecord struct {
 	r arrow.Record
 
 	field2Col map[FieldID]int
+	// hook is told of the references of the record retained and released, nil if the
+	// record is not tracked.
+	hook *releaseHook
+}
+
+// releaseHook runs free once all references of a record are released, counting the
+// references retained by the consumers of the reader returning the record and the one
+// of the reader itself, dropped by the reader on its next read.
+type releaseHook struct {
+	refs atomic.Int64
+	free func()
+}
+
+func newReleaseHook(free func()) *releaseHook {
+	h := &releaseHook{free: free}
+	h.refs.Store(1)
+	return h
+}
+
+func (h *releaseHook) release() {
+	if h.refs.Dec() == 0 {
+		h.free()
+	}
 }
 
 var _ Record = (*simpleArrowRecord)(nil)
@@ -1155,10 +1401,16 @@ func (sr *simpleArrowRecord) Len() int {
 
 func (sr *simpleArrowRecord) Release() {
 	sr.r.Release()
+	if sr.hook != nil {
+		sr.hook.release()
+	}
 }
 
 func (sr *simpleArrowRecord) Retain() {
 	sr.r.Retain()
+	if sr.hook != nil {
+		sr.hook.refs.Inc()
+	}
 }
 
 func (sr *simpleArrowRecord) ArrowSchema() *arrow.Schema {
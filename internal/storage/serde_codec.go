@@ -0,0 +1,116 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sync"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/util/funcutil"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// FieldCodecKey is the type param a field sets to the name of a codec registered by
+// RegisterNamedFieldCodec, to be encoded with it instead of the codec of its data type.
+const FieldCodecKey = "serde_codec"
+
+// FieldCodec is a custom (de)serialization of a field between go values and arrow arrays,
+// with the same contract as the built-in codecs of serdeMap.
+type FieldCodec struct {
+	ArrowType   func(dim int, elementType schemapb.DataType) arrow.DataType
+	Deserialize func(a arrow.Array, i int, elementType schemapb.DataType, dim int, shouldCopy bool) (any, bool)
+	Serialize   func(b array.Builder, v any, elementType schemapb.DataType) bool
+}
+
+func (c FieldCodec) validate() error {
+	if c.ArrowType == nil || c.Deserialize == nil || c.Serialize == nil {
+		return merr.WrapErrParameterInvalidMsg("field codec must define arrow type, serialize and deserialize")
+	}
+	return nil
+}
+
+func (c FieldCodec) entry() serdeEntry {
+	return serdeEntry{
+		arrowType:   c.ArrowType,
+		deserialize: c.Deserialize,
+		serialize:   c.Serialize,
+	}
+}
+
+var fieldCodecRegistry = struct {
+	sync.RWMutex
+	byType map[schemapb.DataType]serdeEntry
+	byName map[string]serdeEntry
+}{
+	byType: make(map[schemapb.DataType]serdeEntry),
+	byName: make(map[string]serdeEntry),
+}
+
+// RegisterFieldCodec overrides the codec of all fields of dataType.
+func RegisterFieldCodec(dataType schemapb.DataType, codec FieldCodec) error {
+	if err := codec.validate(); err != nil {
+		return err
+	}
+	fieldCodecRegistry.Lock()
+	defer fieldCodecRegistry.Unlock()
+	fieldCodecRegistry.byType[dataType] = codec.entry()
+	return nil
+}
+
+// RegisterNamedFieldCodec registers a codec for the fields setting FieldCodecKey to name.
+func RegisterNamedFieldCodec(name string, codec FieldCodec) error {
+	if err := codec.validate(); err != nil {
+		return err
+	}
+	fieldCodecRegistry.Lock()
+	defer fieldCodecRegistry.Unlock()
+	fieldCodecRegistry.byName[name] = codec.entry()
+	return nil
+}
+
+// UnregisterFieldCodec restores the built-in codec of dataType.
+func UnregisterFieldCodec(dataType schemapb.DataType) {
+	fieldCodecRegistry.Lock()
+	defer fieldCodecRegistry.Unlock()
+	delete(fieldCodecRegistry.byType, dataType)
+}
+
+// UnregisterNamedFieldCodec removes the codec registered under name.
+func UnregisterNamedFieldCodec(name string) {
+	fieldCodecRegistry.Lock()
+	defer fieldCodecRegistry.Unlock()
+	delete(fieldCodecRegistry.byName, name)
+}
+
+// lookupSerdeEntry returns the codec of field, consulting the named codec the field
+// opts in to, then the data type override, then the built-in serdeMap.
+func lookupSerdeEntry(field *schemapb.FieldSchema) (serdeEntry, bool) {
+	fieldCodecRegistry.RLock()
+	defer fieldCodecRegistry.RUnlock()
+	if name, err := funcutil.GetAttrByKeyFromRepeatedKV(FieldCodecKey, field.GetTypeParams()); err == nil {
+		entry, ok := fieldCodecRegistry.byName[name]
+		return entry, ok
+	}
+	if entry, ok := fieldCodecRegistry.byType[field.GetDataType()]; ok {
+		return entry, true
+	}
+	entry, ok := serdeMap[field.GetDataType()]
+	return entry, ok
+}
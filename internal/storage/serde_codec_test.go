@@ -0,0 +1,156 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+)
+
+// scaledInt64Codec stores int64 values multiplied by 10.
+var scaledInt64Codec = FieldCodec{
+	ArrowType: func(_ int, _ schemapb.DataType) arrow.DataType {
+		return arrow.PrimitiveTypes.Int64
+	},
+	Deserialize: func(a arrow.Array, i int, _ schemapb.DataType, _ int, _ bool) (any, bool) {
+		if a.IsNull(i) {
+			return nil, true
+		}
+		arr, ok := a.(*array.Int64)
+		if !ok {
+			return nil, false
+		}
+		return arr.Value(i) / 10, true
+	},
+	Serialize: func(b array.Builder, v any, _ schemapb.DataType) bool {
+		if v == nil {
+			b.AppendNull()
+			return true
+		}
+		builder, ok := b.(*array.Int64Builder)
+		val, vok := v.(int64)
+		if !ok || !vok {
+			return false
+		}
+		builder.Append(val * 10)
+		return true
+	},
+}
+
+func TestFieldCodecRegistry(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: common.RowIDField, Name: "rowid", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: 100, Name: "scaled", DataType: schemapb.DataType_Int64, TypeParams: []*commonpb.KeyValuePair{
+			{Key: FieldCodecKey, Value: "scaled"},
+		}},
+		{FieldID: 101, Name: "int8", DataType: schemapb.DataType_Int8},
+	}}
+	newValue := func(i int64) *Value {
+		return &Value{
+			ID:        i,
+			PK:        NewInt64PrimaryKey(i),
+			Timestamp: i,
+			Value: map[FieldID]any{
+				common.TimeStampField: i,
+				common.RowIDField:     i,
+				100:                   i,
+				101:                   int8(i),
+			},
+		}
+	}
+
+	t.Run("named codec", func(t *testing.T) {
+		require.NoError(t, RegisterNamedFieldCodec("scaled", scaledInt64Codec))
+		defer UnregisterNamedFieldCodec("scaled")
+
+		rec, err := ValueSerializer([]*Value{newValue(1), newValue(2)}, schema)
+		require.NoError(t, err)
+		defer rec.Release()
+		assert.Equal(t, int64(20), rec.Column(100).(*array.Int64).Value(1))
+		assert.Equal(t, int64(2), rec.Column(common.RowIDField).(*array.Int64).Value(1))
+
+		values := make([]*Value, rec.Len())
+		require.NoError(t, ValueDeserializerWithSchema(rec, values, schema, true))
+		assert.Equal(t, newValue(1).Value, values[0].Value)
+		assert.Equal(t, newValue(2).Value, values[1].Value)
+	})
+
+	t.Run("unregistered named codec", func(t *testing.T) {
+		_, err := ConvertToArrowSchema(schema, false)
+		assert.Error(t, err)
+	})
+
+	t.Run("data type codec", func(t *testing.T) {
+		require.NoError(t, RegisterNamedFieldCodec("scaled", scaledInt64Codec))
+		defer UnregisterNamedFieldCodec("scaled")
+		int8Codec := FieldCodec{
+			ArrowType: func(_ int, _ schemapb.DataType) arrow.DataType {
+				return arrow.PrimitiveTypes.Int32
+			},
+			Deserialize: func(a arrow.Array, i int, _ schemapb.DataType, _ int, _ bool) (any, bool) {
+				return int8(a.(*array.Int32).Value(i)), true
+			},
+			Serialize: func(b array.Builder, v any, _ schemapb.DataType) bool {
+				b.(*array.Int32Builder).Append(int32(v.(int8)))
+				return true
+			},
+		}
+		require.NoError(t, RegisterFieldCodec(schemapb.DataType_Int8, int8Codec))
+		defer UnregisterFieldCodec(schemapb.DataType_Int8)
+
+		arrowSchema, err := ConvertToArrowSchema(schema, false)
+		require.NoError(t, err)
+		assert.Equal(t, arrow.PrimitiveTypes.Int32, arrowSchema.Field(3).Type)
+
+		rec, err := ValueSerializer([]*Value{newValue(3)}, schema)
+		require.NoError(t, err)
+		defer rec.Release()
+		values := make([]*Value, rec.Len())
+		require.NoError(t, ValueDeserializerWithSchema(rec, values, schema, true))
+		assert.Equal(t, int8(3), values[0].Value.(map[FieldID]any)[101])
+	})
+
+	t.Run("incomplete codec", func(t *testing.T) {
+		assert.Error(t, RegisterFieldCodec(schemapb.DataType_Int8, FieldCodec{}))
+		assert.Error(t, RegisterNamedFieldCodec("incomplete", FieldCodec{ArrowType: scaledInt64Codec.ArrowType}))
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, RegisterNamedFieldCodec("scaled", scaledInt64Codec))
+				_, err := ConvertToArrowSchema(schema, false)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		UnregisterNamedFieldCodec("scaled")
+	})
+}
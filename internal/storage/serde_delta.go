@@ -31,7 +31,10 @@ import (
 	"github.com/cockroachdb/errors"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
 	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
 	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
@@ -384,53 +387,57 @@ func newDeltalogMultiFieldWriter(eventWriter *MultiFieldDeltalogStreamWriter, ba
 	if err != nil {
 		return nil, err
 	}
-	return NewSerializeRecordWriter[*DeleteLog](rw, func(v []*DeleteLog) (Record, error) {
-		fields := []arrow.Field{
-			{
-				Name:     "pk",
-				Type:     serdeMap[schemapb.DataType(v[0].PkType)].arrowType(0, schemapb.DataType_None),
-				Nullable: false,
-			},
-			{
-				Name:     "ts",
-				Type:     arrow.PrimitiveTypes.Int64,
-				Nullable: false,
-			},
-		}
-		arrowSchema := arrow.NewSchema(fields, nil)
-		builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
-		defer builder.Release()
+	return NewSerializeRecordWriter[*DeleteLog](rw, serializeDeleteLogs, batchSize), nil
+}
 
-		pkType := schemapb.DataType(v[0].PkType)
-		switch pkType {
-		case schemapb.DataType_Int64:
-			pb := builder.Field(0).(*array.Int64Builder)
-			for _, vv := range v {
-				pk := vv.Pk.GetValue().(int64)
-				pb.Append(pk)
-			}
-		case schemapb.DataType_VarChar:
-			pb := builder.Field(0).(*array.StringBuilder)
-			for _, vv := range v {
-				pk := vv.Pk.GetValue().(string)
-				pb.Append(pk)
-			}
-		default:
-			return nil, fmt.Errorf("unexpected pk type %v", v[0].PkType)
-		}
+// serializeDeleteLogs converts delete logs into a (pk, ts) record, the pk column is
+// keyed by common.RowIDField and the ts column by common.TimeStampField.
+func serializeDeleteLogs(v []*DeleteLog) (Record, error) {
+	fields := []arrow.Field{
+		{
+			Name:     "pk",
+			Type:     serdeMap[schemapb.DataType(v[0].PkType)].arrowType(0, schemapb.DataType_None),
+			Nullable: false,
+		},
+		{
+			Name:     "ts",
+			Type:     arrow.PrimitiveTypes.Int64,
+			Nullable: false,
+		},
+	}
+	arrowSchema := arrow.NewSchema(fields, nil)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
+	defer builder.Release()
 
+	pkType := schemapb.DataType(v[0].PkType)
+	switch pkType {
+	case schemapb.DataType_Int64:
+		pb := builder.Field(0).(*array.Int64Builder)
+		for _, vv := range v {
+			pk := vv.Pk.GetValue().(int64)
+			pb.Append(pk)
+		}
+	case schemapb.DataType_VarChar:
+		pb := builder.Field(0).(*array.StringBuilder)
 		for _, vv := range v {
-			builder.Field(1).(*array.Int64Builder).Append(int64(vv.Ts))
+			pk := vv.Pk.GetValue().(string)
+			pb.Append(pk)
 		}
+	default:
+		return nil, fmt.Errorf("unexpected pk type %v", v[0].PkType)
+	}
 
-		arr := []arrow.Array{builder.Field(0).NewArray(), builder.Field(1).NewArray()}
+	for _, vv := range v {
+		builder.Field(1).(*array.Int64Builder).Append(int64(vv.Ts))
+	}
 
-		field2Col := map[FieldID]int{
-			common.RowIDField:     0,
-			common.TimeStampField: 1,
-		}
-		return NewSimpleArrowRecord(array.NewRecord(arrowSchema, arr, int64(len(v))), field2Col), nil
-	}, batchSize), nil
+	arr := []arrow.Array{builder.Field(0).NewArray(), builder.Field(1).NewArray()}
+
+	field2Col := map[FieldID]int{
+		common.RowIDField:     0,
+		common.TimeStampField: 1,
+	}
+	return NewSimpleArrowRecord(array.NewRecord(arrowSchema, arr, int64(len(v))), field2Col), nil
 }
 
 func newDeltalogMultiFieldReader(blobs []*Blob) (*DeserializeReaderImpl[*DeleteLog], error) {
@@ -625,3 +632,88 @@ func NewLegacyDeltalogReader(pkField *schemapb.FieldSchema, downloader downloade
 		nil,
 	), nil
 }
+
+// packedDeleteSchema is the fixed (pk, ts) schema of tombstones stored in packed files.
+func packedDeleteSchema(pkType schemapb.DataType) *schemapb.CollectionSchema {
+	return &schemapb.CollectionSchema{
+		Fields: []*schemapb.FieldSchema{
+			{
+				FieldID:      common.RowIDField,
+				Name:         "pk",
+				DataType:     pkType,
+				IsPrimaryKey: true,
+			},
+			{
+				FieldID:  common.TimeStampField,
+				Name:     "ts",
+				DataType: schemapb.DataType_Int64,
+			},
+		},
+	}
+}
+
+// NewPackedDeleteWriter creates a writer storing delete tombstones into a single packed file at path.
+func NewPackedDeleteWriter(
+	bucketName string,
+	path string,
+	pkType schemapb.DataType,
+	bufferSize int64,
+	batchSize int,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+) (*SerializeWriterImpl[*DeleteLog], error) {
+	if pkType != schemapb.DataType_Int64 && pkType != schemapb.DataType_VarChar {
+		return nil, merr.WrapErrParameterInvalidMsg("unexpected pk type %v for packed delete writer", pkType)
+	}
+	columnGroups := []storagecommon.ColumnGroup{{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: []int{0, 1}}}
+	rw, err := NewPackedRecordWriter(bucketName, []string{path}, packedDeleteSchema(pkType), bufferSize, 0, columnGroups, storageConfig, storagePluginContext)
+	if err != nil {
+		return nil, err
+	}
+	return NewSerializeRecordWriter[*DeleteLog](rw, func(v []*DeleteLog) (Record, error) {
+		for _, vv := range v {
+			if schemapb.DataType(vv.PkType) != pkType {
+				return nil, merr.WrapErrParameterInvalid(pkType, schemapb.DataType(vv.PkType), "pk type mismatch in packed delete writer")
+			}
+		}
+		return serializeDeleteLogs(v)
+	}, batchSize), nil
+}
+
+// NewPackedDeleteReader creates a reader yielding the tombstones written by NewPackedDeleteWriter.
+func NewPackedDeleteReader(
+	path string,
+	pkType schemapb.DataType,
+	bufferSize int64,
+	storageConfig *indexpb.StorageConfig,
+	storagePluginContext *indexcgopb.StoragePluginContext,
+) (*DeserializeReaderImpl[*DeleteLog], error) {
+	reader, err := newPackedRecordReader([]string{path}, packedDeleteSchema(pkType), bufferSize, storageConfig, storagePluginContext)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeserializeReader(reader, func(r Record, v []*DeleteLog) error {
+		pkCol := r.Column(common.RowIDField)
+		tsCol, ok := r.Column(common.TimeStampField).(*array.Int64)
+		if !ok {
+			return merr.WrapErrServiceInternal("unexpected ts column type in packed delete file")
+		}
+		for j := 0; j < r.Len(); j++ {
+			d, ok := serdeMap[pkType].deserialize(pkCol, j, schemapb.DataType_None, 0, false)
+			if !ok {
+				return merr.WrapErrServiceInternal(fmt.Sprintf("unexpected pk type %s", pkType))
+			}
+			pk, err := GenPrimaryKeyByRawData(d, pkType)
+			if err != nil {
+				return err
+			}
+			if v[j] == nil {
+				v[j] = &DeleteLog{}
+			}
+			v[j].Pk = pk
+			v[j].Ts = uint64(tsCol.Value(j))
+			v[j].PkType = int64(pkType)
+		}
+		return nil
+	}), nil
+}
@@ -17,12 +17,15 @@
 package storage
 
 import (
+	"fmt"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/util/initcore"
 	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
 )
 
@@ -153,3 +156,62 @@ func TestDeltalogStreamWriter_NoRecordWriter(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, blob)
 }
+
+func TestPackedDeleteReaderWriter(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	bufferSize := int64(10 * 1024 * 1024)
+
+	tests := []struct {
+		name   string
+		pkType schemapb.DataType
+		newPK  func(i int) PrimaryKey
+	}{
+		{
+			name:   "int64 pk",
+			pkType: schemapb.DataType_Int64,
+			newPK:  func(i int) PrimaryKey { return NewInt64PrimaryKey(int64(i)) },
+		},
+		{
+			name:   "varchar pk",
+			pkType: schemapb.DataType_VarChar,
+			newPK:  func(i int) PrimaryKey { return NewVarCharPrimaryKey(fmt.Sprintf("pk_%d", i)) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/tmp/packed_delete/%s", tt.pkType)
+			size := 20
+			writer, err := NewPackedDeleteWriter("", path, tt.pkType, bufferSize, 7, nil, nil)
+			require.NoError(t, err)
+			for i := 0; i < size; i++ {
+				require.NoError(t, writer.WriteValue(NewDeleteLog(tt.newPK(i), uint64(i+1))))
+			}
+			require.NoError(t, writer.Close())
+
+			reader, err := NewPackedDeleteReader(path, tt.pkType, bufferSize, nil, nil)
+			require.NoError(t, err)
+			defer reader.Close()
+			for i := 0; i < size; i++ {
+				value, err := reader.NextValue()
+				require.NoError(t, err)
+				assert.True(t, (*value).Pk.EQ(tt.newPK(i)))
+				assert.Equal(t, uint64(i+1), (*value).Ts)
+			}
+			_, err = reader.NextValue()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("pk type mismatch", func(t *testing.T) {
+		writer, err := NewPackedDeleteWriter("", "/tmp/packed_delete/mismatch", schemapb.DataType_Int64, bufferSize, 1, nil, nil)
+		require.NoError(t, err)
+		assert.Error(t, writer.WriteValue(NewDeleteLog(NewVarCharPrimaryKey("a"), 1)))
+	})
+
+	t.Run("unsupported pk type", func(t *testing.T) {
+		_, err := NewPackedDeleteWriter("", "/tmp/packed_delete/float", schemapb.DataType_Float, bufferSize, 1, nil, nil)
+		assert.Error(t, err)
+	})
+}
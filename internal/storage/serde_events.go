@@ -18,27 +18,37 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"iter"
 	"math"
+	"math/bits"
+	"reflect"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
 	"github.com/apache/arrow/go/v17/arrow/memory"
 	"github.com/samber/lo"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/hook"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
 	"github.com/milvus-io/milvus/internal/allocator"
+	"github.com/milvus-io/milvus/internal/json"
 	"github.com/milvus-io/milvus/pkg/v2/common"
 	"github.com/milvus-io/milvus/pkg/v2/log"
 	"github.com/milvus-io/milvus/pkg/v2/proto/datapb"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/metautil"
+	"github.com/milvus-io/milvus/pkg/v2/util/parameterutil"
 	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
 )
 
@@ -152,16 +162,744 @@ func newIterativeCompositeBinlogRecordReader(
 	}
 }
 
-func ValueDeserializerWithSelectedFields(r Record, v []*Value, fieldSchema []*schemapb.FieldSchema, shouldCopy bool) error {
-	return valueDeserializer(r, v, fieldSchema, shouldCopy)
+type valueDeserializerOptions struct {
+	// nullSentinels maps field id to the raw value that legacy files used to encode null.
+	nullSentinels map[FieldID]any
+	// swapVectorBytes is set when the vectors were written in the other byte order than
+	// the one of this host.
+	swapVectorBytes bool
+	// nextRowID is the row id synthesized for the next row lacking one, nil to fail on
+	// such rows.
+	nextRowID *int64
+	// fieldTransforms rewrite the non-null deserialized values of their fields.
+	fieldTransforms map[FieldID]func(any) any
+	// skipPK leaves the value PK nil.
+	skipPK bool
+	// fieldErrors collects the values failing to deserialize instead of failing, nil to
+	// fail on them.
+	fieldErrors *FieldDecodeErrors
+	// nonFinite is how NaN and Inf values of float fields are handled, nil to pass them
+	// through unseen.
+	nonFinite *nonFiniteOptions
+	// rejectRequiredNulls fails on the nulls of the fields that are not nullable.
+	rejectRequiredNulls bool
+	// rawJSON returns the values of JSON fields as json.RawMessage, decodeJSON as the
+	// values the documents decode into.
+	rawJSON    bool
+	decodeJSON bool
+	// normCheck flags the vectors of low norm of a FloatVector field, nil to not check.
+	normCheck *normCheckOptions
+	// interner interns the values of its fields, nil to not intern.
+	interner *StringInterner
+	// missingFields are the fields absent from the records, read as their default value
+	// or null.
+	missingFields typeutil.Set[FieldID]
+	// deletes flags the values deleted, nil to not look them up. dropDeleted drops them
+	// from the records read instead, see WithDeletes.
+	deletes     *DeleteSet
+	dropDeleted bool
+	// partials are overlaid onto the values of their primary keys, nil to not merge
+	// any. incompletePartials returns those without a base row instead of failing, see
+	// WithPartialUpdates.
+	partials           *PartialUpdates
+	incompletePartials bool
+	// tsRange drops the rows of NewPackedDeserializeReader of a timestamp out of it, nil to
+	// read all, see WithReadTimestampRange.
+	tsRange *timestampRange
+	// ctx fails the reads of NewPackedDeserializeReader once done, nil to never fail
+	// them, see WithDeserializeContext.
+	ctx context.Context
+	// reuse refills the values of the last batch of NewPackedDeserializeReader, see
+	// WithReusedValues.
+	reuse bool
 }
 
-func ValueDeserializerWithSchema(r Record, v []*Value, schema *schemapb.CollectionSchema, shouldCopy bool) error {
+type ValueDeserializerOption func(*valueDeserializerOptions)
+
+// withMissingFields reads the fields, absent from the records, as their default value, or
+// as null without one.
+func withMissingFields(fields []*schemapb.FieldSchema) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.missingFields = typeutil.NewSet(lo.Map(fields, func(f *schemapb.FieldSchema, _ int) FieldID {
+			return f.GetFieldID()
+		})...)
+	}
+}
+
+// WithNullSentinel treats the raw value sentinel of field fieldID as null, for legacy
+// files which encoded nulls as a sentinel value (e.g. math.MinInt64) rather than in the
+// arrow null bitmap. The sentinel must be a comparable value of the field's go type.
+func WithNullSentinel(fieldID FieldID, sentinel any) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		if opts.nullSentinels == nil {
+			opts.nullSentinels = make(map[FieldID]any)
+		}
+		opts.nullSentinels[fieldID] = sentinel
+	}
+}
+
+// WithSourceByteOrder tells the byte order the vectors were written in. Dense and sparse
+// vectors are stored as raw bytes, read as is they decode wrong on a host of the other
+// byte order, so they are byte-swapped when order differs from the one of the host.
+// Scalars are typed arrow columns, whose byte order is handled by the file format. By
+// default the vectors are taken in the byte order of the host.
+func WithSourceByteOrder(order binary.ByteOrder) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.swapVectorBytes = isLittleEndian(order) != isLittleEndian(binary.NativeEndian)
+	}
+}
+
+// WithSynthesizedRowIDs numbers the rows lacking a row id column sequentially from start
+// instead of failing, for externally produced files that carry no Milvus system columns.
+// The synthesized id is set as the value ID only, and a missing timestamp reads as 0. The
+// numbering continues across the batches deserialized with the same option, so create
+// one option per segment read.
+func WithSynthesizedRowIDs(start int64) ValueDeserializerOption {
+	next := start
+	return func(opts *valueDeserializerOptions) {
+		opts.nextRowID = &next
+	}
+}
+
+// WithFieldTransforms rewrites the deserialized values of the fields in transforms with
+// their transform before storing them into the value, e.g. to hash a VarChar or zero a
+// vector for redacted exports. Nulls, and the default values they read as, bypass the
+// transforms. A transform must return a value of the go type of its field.
+func WithFieldTransforms(transforms map[FieldID]func(any) any) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.fieldTransforms = transforms
+	}
+}
+
+// WithSkipPK leaves the PK of the deserialized values nil instead of building a primary
+// key per row, for scans that never look at it such as columnar exports or statistics.
+// The schema passed with it, e.g. a projection, does not need to hold the primary key.
+func WithSkipPK() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.skipPK = true
+	}
+}
+
+// WithDeletes sets IsDeleted on the values deleted in deletes, by the primary key and
+// timestamp of their row as DeleteSet.IsDeleted looks them up, so that consumers apply
+// the deletes as they read instead of merging the deltalogs in a pass of their own. The
+// keys of VarChar and Int64 primary keys are both looked up by their raw value. It cannot
+// be combined with WithSkipPK. See WithDropDeleted to drop the values deleted instead.
+func WithDeletes(deletes *DeleteSet) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.deletes = deletes
+	}
+}
+
+// WithDropDeleted drops the rows deleted in the deletes of WithDeletes from the records
+// read by NewPackedDeserializeReader, before the values are built, rather than flagging
+// them. Without WithDeletes it fails the reader.
+func WithDropDeleted() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.dropDeleted = true
+	}
+}
+
+// WithPartialUpdates overlays the partial rows of partials newer than a value, in
+// timestamp order, onto the value of their primary key, setting its timestamp to the one
+// of the newest, so that upserts writing only the fields they change read as whole rows.
+// The fields a partial row leaves unchanged keep the values of the value, and deletes are
+// looked up by the timestamp merged. Once the rows of NewPackedDeserializeReader are all
+// read, it fails with the primary keys updated no row was read of, see
+// WithIncompletePartials, so the reader must read all rows the updates may apply to: the
+// other readers, which filter rows or do not report these, reject it, as they do
+// WithIncompletePartials. It cannot be combined with WithSkipPK nor WithDropDeleted. The
+// fields merged share the slices and messages of the partial rows, e.g. of vectors, so
+// the values read must not be modified in place.
+func WithPartialUpdates(partials *PartialUpdates) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.partials = partials
+	}
+}
+
+// WithIncompletePartials returns the partial rows of WithPartialUpdates without a base row
+// after the rows read, merged per primary key and flagged Incomplete, instead of failing
+// the reader.
+func WithIncompletePartials() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.incompletePartials = true
+	}
+}
+
+// WithReadTimestampRange returns only the rows of NewPackedDeserializeReader of a
+// timestamp within [minTs, maxTs], dropping the others from the records read before the
+// values are built for them, see WithTimestampRange for cm. It cannot be combined with
+// WithPartialUpdates, the rows dropped may be those updated.
+func WithReadTimestampRange(cm ChunkManager, minTs, maxTs Timestamp) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.tsRange = &timestampRange{cm: cm, min: minTs, max: maxTs}
+	}
+}
+
+// WithDeserializeContext fails the reads of NewPackedDeserializeReader once ctx is done
+// with the error of ctx, see WithReadContext.
+func WithDeserializeContext(ctx context.Context) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.ctx = ctx
+	}
+}
+
+// WithReusedValues refills the values of the last batch of NewPackedDeserializeReader,
+// and their maps, for the next one instead of allocating them per row, see
+// NewDeserializeReaderReusingValues: every value returned is overwritten once the reader
+// reads past the last value of its batch.
+func WithReusedValues() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.reuse = true
+	}
+}
+
+// FieldDecodeError is a value that failed to deserialize with WithLenientDecode.
+type FieldDecodeError struct {
+	// Row is the index of the row among the rows deserialized with the same collector.
+	Row     int64
+	FieldID FieldID
+	Err     error
+}
+
+// FieldDecodeErrors collects the field decode errors of a lenient scan, see
+// WithLenientDecode.
+type FieldDecodeErrors struct {
+	rows   int64
+	errors []FieldDecodeError
+}
+
+// Errors returns the field decode errors collected so far, in row order.
+func (e *FieldDecodeErrors) Errors() []FieldDecodeError {
+	return e.errors
+}
+
+// WithLenientDecode isolates the values that fail to deserialize, e.g. corrupt arrays of
+// a partially damaged file, to their field: the value of the field reads as nil, the error
+// is added to collector and the row is returned with its other fields. The row id, the
+// timestamp and the primary key cannot be isolated and still fail the read. The rows are
+// counted across the batches deserialized with the same collector, so use one collector
+// per segment read and look at its errors after the scan.
+func WithLenientDecode(collector *FieldDecodeErrors) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.fieldErrors = collector
+	}
+}
+
+// NonFiniteMode is how WithNonFiniteFloats handles the NaN and Inf values it detects.
+type NonFiniteMode int
+
+const (
+	// NonFinitePassThrough returns the values as read, only counting them.
+	NonFinitePassThrough NonFiniteMode = iota
+	// NonFiniteError fails the read on the first value detected.
+	NonFiniteError
+	// NonFiniteReplace replaces the values with the configured replacement.
+	NonFiniteReplace
+)
+
+type nonFiniteOptions struct {
+	mode        NonFiniteMode
+	replacement float64
+	stats       *NonFiniteStats
+}
+
+// NonFiniteStats counts the NaN and Inf values detected per field by WithNonFiniteFloats,
+// a vector counting once per non finite element.
+type NonFiniteStats struct {
+	counts map[FieldID]int64
+}
+
+// Counts returns the number of non finite values detected so far per field.
+func (s *NonFiniteStats) Counts() map[FieldID]int64 {
+	return s.counts
+}
+
+// Total returns the number of non finite values detected so far across fields.
+func (s *NonFiniteStats) Total() int64 {
+	var total int64
+	for _, count := range s.counts {
+		total += count
+	}
+	return total
+}
+
+// WithNonFiniteFloats detects the NaN and Inf values of Float, Double and FloatVector
+// fields, e.g. for exports to JSON or index builders rejecting NaN, handling them as mode
+// tells, with replacement as the value replacing them for NonFiniteReplace. The vectors
+// replaced are copies, the values read are never modified in place. The values detected are
+// added to stats if it is not nil, across the batches deserialized with the same stats.
+// Without the option the values are passed through unseen.
+func WithNonFiniteFloats(mode NonFiniteMode, replacement float64, stats *NonFiniteStats) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.nonFinite = &nonFiniteOptions{mode: mode, replacement: replacement, stats: stats}
+	}
+}
+
+// NormCheckAction is what WithVectorNormCheck does on a vector of low norm.
+type NormCheckAction int
+
+const (
+	// NormCheckCount only counts the vectors in the stats.
+	NormCheckCount NormCheckAction = iota
+	// NormCheckWarn also logs a warning per batch holding such vectors.
+	NormCheckWarn
+	// NormCheckError fails the read on the first vector detected.
+	NormCheckError
+)
+
+// maxNormCheckExamples caps the row ids of the vectors of low norm kept as examples.
+const maxNormCheckExamples = 10
+
+type normCheckOptions struct {
+	fieldID FieldID
+	minNorm float64
+	action  NormCheckAction
+	stats   *NormCheckStats
+}
+
+// NormCheckStats counts the vectors of low norm detected by WithVectorNormCheck.
+type NormCheckStats struct {
+	// Count is the number of vectors detected, ExampleRowIDs the row ids of the first of
+	// them, at most 10.
+	Count         int64
+	ExampleRowIDs []int64
+}
+
+// WithVectorNormCheck checks the L2 norm of the vectors of the FloatVector field fieldID
+// as they are deserialized, flagging the ones of a norm of at most minNorm, 0 to flag
+// only zero vectors, which cosine and IP metrics cannot rank, as a data quality check
+// reusing the decoded vectors. The vectors detected are counted in stats if it is not nil,
+// across the batches deserialized with the same stats, and handled as action tells. Null
+// vectors are not checked.
+func WithVectorNormCheck(fieldID FieldID, minNorm float64, action NormCheckAction, stats *NormCheckStats) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.normCheck = &normCheckOptions{fieldID: fieldID, minNorm: minNorm, action: action, stats: stats}
+	}
+}
+
+// record adds the row ids of the vectors of low norm of a batch to the stats.
+func (o *normCheckOptions) record(rowIDs []int64) {
+	if o.stats == nil {
+		return
+	}
+	o.stats.Count += int64(len(rowIDs))
+	if room := maxNormCheckExamples - len(o.stats.ExampleRowIDs); room > 0 {
+		o.stats.ExampleRowIDs = append(o.stats.ExampleRowIDs, rowIDs[:min(room, len(rowIDs))]...)
+	}
+}
+
+// lowNorm tells whether vector v is of a norm of at most minNorm.
+func lowNorm(v []float32, minNorm float64) bool {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	return math.Sqrt(sum) <= minNorm
+}
+
+// sanitizeNonFinite handles the non finite values of d, the value of field fieldID of row
+// row, as configured by opts.
+func sanitizeNonFinite(d any, fieldID FieldID, row int, opts *nonFiniteOptions) (any, error) {
+	nonFinite := func(f float64) bool { return math.IsNaN(f) || math.IsInf(f, 0) }
+	var count int64
+	switch v := d.(type) {
+	case float32:
+		if nonFinite(float64(v)) {
+			count = 1
+			if opts.mode == NonFiniteReplace {
+				d = float32(opts.replacement)
+			}
+		}
+	case float64:
+		if nonFinite(v) {
+			count = 1
+			if opts.mode == NonFiniteReplace {
+				d = opts.replacement
+			}
+		}
+	case []float32:
+		var replaced []float32
+		for k, f := range v {
+			if !nonFinite(float64(f)) {
+				continue
+			}
+			count++
+			if opts.mode == NonFiniteReplace {
+				if replaced == nil {
+					replaced = slices.Clone(v)
+				}
+				replaced[k] = float32(opts.replacement)
+			}
+		}
+		if replaced != nil {
+			d = replaced
+		}
+	}
+	if count == 0 {
+		return d, nil
+	}
+	if opts.stats != nil {
+		if opts.stats.counts == nil {
+			opts.stats.counts = make(map[FieldID]int64)
+		}
+		opts.stats.counts[fieldID] += count
+	}
+	if opts.mode == NonFiniteError {
+		return nil, merr.WrapErrParameterInvalidMsg("non finite float in field %d at row %d of the batch", fieldID, row)
+	}
+	return d, nil
+}
+
+// NullInRequiredFieldError is the null found by WithRequiredFieldCheck in a field that is
+// not nullable.
+type NullInRequiredFieldError struct {
+	// RowID is the row id of the row, -1 if the row lacks one.
+	RowID   int64
+	FieldID FieldID
+}
+
+func (e *NullInRequiredFieldError) Error() string {
+	return fmt.Sprintf("null in required field %d of row %d: %s", e.FieldID, e.RowID, merr.ErrParameterInvalid.Error())
+}
+
+// Unwrap makes the error match merr.ErrParameterInvalid.
+func (e *NullInRequiredFieldError) Unwrap() error {
+	return merr.ErrParameterInvalid
+}
+
+// WithRequiredFieldCheck fails the read on the first null of a field that is not
+// nullable with a *NullInRequiredFieldError, finding the segments that break the
+// nullability of their schema, e.g. when verifying the output of a compaction. Only the
+// fields with a default value are exempt, their nulls reading as the default value, the
+// system fields are checked as any other. The fields added to the collection after the
+// segment was written, whose columns NewPackedDeserializeReader reads as missing, are not
+// checked as they have no column.
+func WithRequiredFieldCheck() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.rejectRequiredNulls = true
+	}
+}
+
+// WithRawJSON returns the values of JSON fields, the dynamic field included, as
+// json.RawMessage of the bytes stored rather than as []byte, so that consumers passing
+// them on untouched embed them into the JSON they encode as is, where []byte would be
+// encoded as base64, and without parsing them into generic values to encode them again. A
+// null value is still nil, while the JSON literal null is the json.RawMessage "null".
+// Without shouldCopy the messages alias the record as the []byte values do. The last of
+// WithRawJSON and WithDecodedJSON applies.
+func WithRawJSON() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.rawJSON = true
+		opts.decodeJSON = false
+	}
+}
+
+// WithDecodedJSON returns the values of JSON fields, the dynamic field included, decoded
+// as by json.Unmarshal into an any, an object such as the extra attributes of the dynamic
+// field as a map[string]any, for consumers looking into the documents. A null value is
+// nil, as is the JSON literal null. A document failing to decode fails the read, or is
+// collected with WithLenientDecode. The values are parsed copies whether shouldCopy
+// is set or not. The last of WithRawJSON and WithDecodedJSON applies.
+func WithDecodedJSON() ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.decodeJSON = true
+		opts.rawJSON = false
+	}
+}
+
+// decodeJSON decodes the JSON document of field fieldID of row i for WithDecodedJSON.
+func decodeJSON(doc []byte, fieldID FieldID, i int) (any, error) {
+	var decoded any
+	if err := json.Unmarshal(doc, &decoded); err != nil {
+		return nil, merr.WrapErrParameterInvalidMsg("JSON value of field %d of row %d fails to decode: %s", fieldID, i, err.Error())
+	}
+	return decoded, nil
+}
+
+// StringInterner is the intern table of a scan set with WithStringInterning, sharing
+// one backing string between the equal VarChar values of a field. It is not safe for
+// concurrent use.
+type StringInterner struct {
+	fields      map[FieldID]*internTable
+	maxDistinct int
+}
+
+// internTable holds the distinct values of a field, nil once interning is disabled for
+// the field.
+type internTable struct {
+	values map[string]string
+}
+
+// NewStringInterner returns an intern table interning up to maxDistinct distinct values
+// per field. Interning is disabled for a field once it holds more, the values interned
+// until then staying shared, so that fields of high cardinality do not grow the table
+// without bound.
+func NewStringInterner(maxDistinct int) *StringInterner {
+	return &StringInterner{fields: make(map[FieldID]*internTable), maxDistinct: maxDistinct}
+}
+
+// Distinct returns the number of distinct values interned for field fieldID, and whether
+// interning is still enabled for the field.
+func (s *StringInterner) Distinct(fieldID FieldID) (int, bool) {
+	table, ok := s.fields[fieldID]
+	if !ok {
+		return 0, false
+	}
+	if table.values == nil {
+		return s.maxDistinct, false
+	}
+	return len(table.values), true
+}
+
+// intern returns the shared string equal to value for field fieldID. The strings stored
+// are copies, value may alias the record. shouldCopy tells whether value must be copied
+// when interning is disabled for the field.
+func (s *StringInterner) intern(fieldID FieldID, value string, shouldCopy bool) string {
+	table := s.fields[fieldID]
+	if table.values != nil {
+		if shared, ok := table.values[value]; ok {
+			return shared
+		}
+		if len(table.values) < s.maxDistinct {
+			shared := strings.Clone(value)
+			table.values[shared] = shared
+			return shared
+		}
+		table.values = nil
+	}
+	if shouldCopy {
+		return strings.Clone(value)
+	}
+	return value
+}
+
+// WithStringInterning interns the values of the VarChar fields fieldIDs into interner, the
+// equal values of a field sharing one backing string rather than a string per row, e.g.
+// for query nodes holding many rows of fields of low cardinality such as tags or
+// categories in memory. The interned values are copies, valid past the release of the
+// record even without shouldCopy. Use one interner per scan, it is shared across the
+// batches deserialized with it.
+func WithStringInterning(interner *StringInterner, fieldIDs ...FieldID) ValueDeserializerOption {
+	return func(opts *valueDeserializerOptions) {
+		opts.interner = interner
+		for _, fieldID := range fieldIDs {
+			if _, ok := interner.fields[fieldID]; !ok {
+				interner.fields[fieldID] = &internTable{values: make(map[string]string)}
+			}
+		}
+	}
+}
+
+// numericColumnTypes are the schema types of the numeric arrow column types.
+var numericColumnTypes = map[arrow.Type]schemapb.DataType{
+	arrow.INT8:    schemapb.DataType_Int8,
+	arrow.INT16:   schemapb.DataType_Int16,
+	arrow.INT32:   schemapb.DataType_Int32,
+	arrow.INT64:   schemapb.DataType_Int64,
+	arrow.FLOAT32: schemapb.DataType_Float,
+	arrow.FLOAT64: schemapb.DataType_Double,
+}
+
+// upcastFields returns the stored types of the fields whose numeric columns in r are of
+// another type than their schema type, after the type of the field was widened by a
+// schema change, and points their entries to the stored types. It fails unless the
+// change is a lossless widening: to a wider integer, Float to Double, or an integer of up
+// to 32 bits to Double.
+func upcastFields(r Record, fields []*schemapb.FieldSchema, entries map[FieldID]serdeEntry) (map[FieldID]schemapb.DataType, error) {
+	var upcasts map[FieldID]schemapb.DataType
+	for _, f := range fields {
+		col := r.Column(f.FieldID)
+		if col == nil {
+			continue
+		}
+		stored, ok := numericColumnTypes[col.DataType().ID()]
+		if !ok || stored == f.GetDataType() {
+			continue
+		}
+		// other schema types may be stored as numeric columns, e.g. Timestamptz
+		dim, _ := typeutil.GetDim(f)
+		if arrow.TypeEqual(col.DataType(), entries[f.FieldID].arrowType(int(dim), f.GetElementType())) {
+			continue
+		}
+		if !isLosslessWidening(stored, f.GetDataType()) {
+			return nil, merr.WrapErrParameterInvalidMsg("field %d stored as %s cannot be read as %s",
+				f.FieldID, stored, f.GetDataType())
+		}
+		if upcasts == nil {
+			upcasts = make(map[FieldID]schemapb.DataType)
+		}
+		upcasts[f.FieldID] = stored
+		entries[f.FieldID] = serdeMap[stored]
+	}
+	return upcasts, nil
+}
+
+func isLosslessWidening(from, to schemapb.DataType) bool {
+	intWidth := map[schemapb.DataType]int{
+		schemapb.DataType_Int8:  8,
+		schemapb.DataType_Int16: 16,
+		schemapb.DataType_Int32: 32,
+		schemapb.DataType_Int64: 64,
+	}
+	fromWidth, fromInt := intWidth[from]
+	switch to {
+	case schemapb.DataType_Int16, schemapb.DataType_Int32, schemapb.DataType_Int64:
+		return fromInt && fromWidth < intWidth[to]
+	case schemapb.DataType_Double:
+		return from == schemapb.DataType_Float || fromInt && fromWidth <= 32
+	}
+	return false
+}
+
+// upcastValue converts d, a value of a numeric field, to the go type of data type to.
+func upcastValue(d any, to schemapb.DataType) any {
+	var i int64
+	var f float64
+	isFloat := false
+	switch v := d.(type) {
+	case int8:
+		i = int64(v)
+	case int16:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case float32:
+		f, isFloat = float64(v), true
+	default:
+		return d
+	}
+	switch to {
+	case schemapb.DataType_Int16:
+		return int16(i)
+	case schemapb.DataType_Int32:
+		return int32(i)
+	case schemapb.DataType_Int64:
+		return i
+	case schemapb.DataType_Double:
+		if isFloat {
+			return f
+		}
+		return float64(i)
+	}
+	return d
+}
+
+// deserializeValue deserializes the i-th value of a with entry. For lenient decodes it
+// recovers from the panics corrupt values cause in the arrow accessors.
+func deserializeValue(entry serdeEntry, a arrow.Array, i int, dt, elementType schemapb.DataType, dim int,
+	shouldCopy bool, lenient bool,
+) (d any, err error) {
+	if lenient {
+		defer func() {
+			if r := recover(); r != nil {
+				d, err = nil, merr.WrapErrServiceInternal(fmt.Sprintf("deserialize %s value: %v", dt, r))
+			}
+		}()
+	}
+	d, ok := entry.deserialize(a, i, elementType, dim, shouldCopy)
+	if !ok {
+		return nil, merr.WrapErrServiceInternal(fmt.Sprintf("unexpected type %s", dt))
+	}
+	return d, nil
+}
+
+func isLittleEndian(order binary.ByteOrder) bool {
+	return order.Uint16([]byte{1, 0}) == 1
+}
+
+// swapVectorByteOrder returns a byte-swapped copy of vector v of type dt, holding elements
+// of elementType for vector arrays. Vectors of byte-sized elements are returned as is.
+func swapVectorByteOrder(v any, dt, elementType schemapb.DataType) any {
+	swapWords := func(data []byte, width int) []byte {
+		swapped := make([]byte, len(data))
+		for i := 0; i+width <= len(data); i += width {
+			for j := 0; j < width; j++ {
+				swapped[i+j] = data[i+width-1-j]
+			}
+		}
+		return swapped
+	}
+	swapFloats := func(data []float32) []float32 {
+		swapped := make([]float32, len(data))
+		for i, f := range data {
+			swapped[i] = math.Float32frombits(bits.ReverseBytes32(math.Float32bits(f)))
+		}
+		return swapped
+	}
+	switch dt {
+	case schemapb.DataType_FloatVector:
+		return swapFloats(v.([]float32))
+	case schemapb.DataType_Float16Vector, schemapb.DataType_BFloat16Vector:
+		return swapWords(v.([]byte), 2)
+	case schemapb.DataType_SparseFloatVector:
+		// pairs of uint32 index and float32 value
+		return swapWords(v.([]byte), 4)
+	case schemapb.DataType_ArrayOfVector:
+		vf, ok := v.(*schemapb.VectorField)
+		if !ok || vf == nil {
+			return v
+		}
+		switch elementType {
+		case schemapb.DataType_FloatVector:
+			swapped := proto.Clone(vf).(*schemapb.VectorField)
+			swapped.GetFloatVector().Data = swapFloats(vf.GetFloatVector().GetData())
+			return swapped
+		case schemapb.DataType_Float16Vector:
+			swapped := proto.Clone(vf).(*schemapb.VectorField)
+			swapped.Data = &schemapb.VectorField_Float16Vector{Float16Vector: swapWords(vf.GetFloat16Vector(), 2)}
+			return swapped
+		case schemapb.DataType_BFloat16Vector:
+			swapped := proto.Clone(vf).(*schemapb.VectorField)
+			swapped.Data = &schemapb.VectorField_Bfloat16Vector{Bfloat16Vector: swapWords(vf.GetBfloat16Vector(), 2)}
+			return swapped
+		}
+	}
+	return v
+}
+
+func ValueDeserializerWithSelectedFields(r Record, v []*Value, fieldSchema []*schemapb.FieldSchema, shouldCopy bool, opts ...ValueDeserializerOption) error {
+	return valueDeserializer(r, v, fieldSchema, shouldCopy, opts...)
+}
+
+func ValueDeserializerWithSchema(r Record, v []*Value, schema *schemapb.CollectionSchema, shouldCopy bool, opts ...ValueDeserializerOption) error {
 	allFields := typeutil.GetAllFieldSchemas(schema)
-	return valueDeserializer(r, v, allFields, shouldCopy)
+	return valueDeserializer(r, v, allFields, shouldCopy, opts...)
 }
 
-func valueDeserializer(r Record, v []*Value, fields []*schemapb.FieldSchema, shouldCopy bool) error {
+// RecordToValues deserializes the rows of rec, a record of the fields of schema, into
+// values, the reverse of ValueSerializer for records built or read outside of the
+// deserialize readers. The row id, the timestamp and the primary key of pkFieldID, which
+// must be the primary key of schema, are set on the values as by the readers. The values
+// copy the data of rec and stay valid once it is released.
+func RecordToValues(rec Record, schema *schemapb.CollectionSchema, pkFieldID FieldID, opts ...ValueDeserializerOption) ([]*Value, error) {
+	pkField := typeutil.GetField(schema, pkFieldID)
+	if pkField == nil {
+		return nil, merr.WrapErrFieldNotFound(pkFieldID)
+	}
+	if !pkField.GetIsPrimaryKey() {
+		return nil, merr.WrapErrParameterInvalidMsg("field %d of record to values is not the primary key", pkFieldID)
+	}
+	values := make([]*Value, rec.Len())
+	if err := ValueDeserializerWithSchema(rec, values, schema, true, opts...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func valueDeserializer(r Record, v []*Value, fields []*schemapb.FieldSchema, shouldCopy bool, opts ...ValueDeserializerOption) error {
+	options := &valueDeserializerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	for fieldID, sentinel := range options.nullSentinels {
+		if sentinel == nil || !reflect.TypeOf(sentinel).Comparable() {
+			return merr.WrapErrParameterInvalidMsg("null sentinel of field %d must be a comparable value", fieldID)
+		}
+	}
+
 	pkField := func() *schemapb.FieldSchema {
 		for _, field := range fields {
 			if field.GetIsPrimaryKey() {
@@ -170,9 +908,59 @@ func valueDeserializer(r Record, v []*Value, fields []*schemapb.FieldSchema, sho
 		}
 		return nil
 	}()
-	if pkField == nil {
+	if pkField == nil && !options.skipPK {
 		return merr.WrapErrServiceInternal("no primary key field found")
 	}
+	if options.deletes != nil && options.skipPK {
+		return merr.WrapErrParameterInvalidMsg("deletes are looked up by the primary key skipped")
+	}
+	if options.partials != nil && options.skipPK {
+		return merr.WrapErrParameterInvalidMsg("partial updates are merged by the primary key skipped")
+	}
+
+	entries := make(map[FieldID]serdeEntry, len(fields))
+	for _, f := range fields {
+		entry, ok := lookupSerdeEntry(f)
+		if !ok {
+			return merr.WrapErrServiceInternal(fmt.Sprintf("unexpected type %s", f.DataType))
+		}
+		entries[f.FieldID] = entry
+	}
+	// the values of fields widened since the batch was written are read as stored
+	upcasts, err := upcastFields(r, fields, entries)
+	if err != nil {
+		return err
+	}
+
+	if check := options.normCheck; check != nil {
+		field, ok := lo.Find(fields, func(f *schemapb.FieldSchema) bool { return f.GetFieldID() == check.fieldID })
+		if !ok || field.GetDataType() != schemapb.DataType_FloatVector {
+			return merr.WrapErrParameterInvalidMsg("norm check field %d is not a float vector field read", check.fieldID)
+		}
+	}
+	// internTables are the intern tables of the fields interned
+	var internTables map[FieldID]*internTable
+	if options.interner != nil {
+		internTables = options.interner.fields
+		for fieldID := range internTables {
+			field, ok := lo.Find(fields, func(f *schemapb.FieldSchema) bool { return f.GetFieldID() == fieldID })
+			if !ok || (field.GetDataType() != schemapb.DataType_VarChar && field.GetDataType() != schemapb.DataType_String) {
+				return merr.WrapErrParameterInvalidMsg("interned field %d is not a VarChar field read", fieldID)
+			}
+		}
+	}
+	// lowNormRows are the row ids of the vectors of low norm of the batch
+	var lowNormRows []int64
+
+	// the primary keys of the batch are built at once, or per row for other column types
+	var pks []PrimaryKey
+	var batched bool
+	if !options.skipPK {
+		pks, batched, err = GenPrimaryKeysFromArrow(r.Column(pkField.FieldID), shouldCopy)
+		if err != nil {
+			return err
+		}
+	}
 
 	for i := 0; i < r.Len(); i++ {
 		value := v[i]
@@ -180,15 +968,43 @@ func valueDeserializer(r Record, v []*Value, fields []*schemapb.FieldSchema, sho
 			value = &Value{}
 			value.Value = make(map[FieldID]interface{}, len(fields))
 			v[i] = value
+		} else {
+			// a value reused keeps nothing of the row it held
+			m := value.Value.(map[FieldID]interface{})
+			clear(m)
+			*value = Value{Value: m}
 		}
 
 		m := value.Value.(map[FieldID]interface{})
 		for _, f := range fields {
 			j := f.FieldID
 			dt := f.DataType
+			if options.missingFields.Contain(j) {
+				if f.GetDefaultValue() != nil {
+					m[j] = GetDefaultValue(f)
+				} else {
+					m[j] = nil
+				}
+				continue
+			}
 			if r.Column(j).IsNull(i) {
+				if options.rejectRequiredNulls && !f.GetNullable() && f.GetDefaultValue() == nil {
+					rowID := int64(-1)
+					if ids, ok := r.Column(common.RowIDField).(*array.Int64); ok && ids.IsValid(i) {
+						rowID = ids.Value(i)
+					}
+					return &NullInRequiredFieldError{RowID: rowID, FieldID: j}
+				}
 				if f.GetDefaultValue() != nil {
 					m[j] = GetDefaultValue(f)
+					if options.rawJSON && dt == schemapb.DataType_JSON {
+						m[j] = json.RawMessage(m[j].([]byte))
+					}
+					if options.decodeJSON && dt == schemapb.DataType_JSON {
+						if m[j], err = decodeJSON(m[j].([]byte), j, i); err != nil {
+							return err
+						}
+					}
 				} else {
 					m[j] = nil
 				}
@@ -204,42 +1020,230 @@ func valueDeserializer(r Record, v []*Value, fields []*schemapb.FieldSchema, sho
 					elementType = f.GetElementType()
 				}
 
-				d, ok := serdeMap[dt].deserialize(r.Column(j), i, elementType, dim, shouldCopy)
-				if ok {
-					m[j] = d // TODO: avoid memory copy here.
-				} else {
-					return merr.WrapErrServiceInternal(fmt.Sprintf("unexpected type %s", dt))
+				isolated := options.fieldErrors != nil && j != common.RowIDField && j != common.TimeStampField &&
+					(pkField == nil || j != pkField.FieldID)
+				storedType, widened := upcasts[j]
+				if !widened {
+					storedType = dt
+				}
+				// the interned values are copied by the interner, only when new
+				_, interned := internTables[j]
+				d, err := deserializeValue(entries[j], r.Column(j), i, storedType, elementType, dim, shouldCopy && !interned, isolated)
+				if err == nil && options.decodeJSON && dt == schemapb.DataType_JSON && d != nil {
+					d, err = decodeJSON(d.([]byte), j, i)
+				}
+				if err != nil {
+					if !isolated {
+						return err
+					}
+					options.fieldErrors.errors = append(options.fieldErrors.errors, FieldDecodeError{
+						Row:     options.fieldErrors.rows + int64(i),
+						FieldID: j,
+						Err:     err,
+					})
+					m[j] = nil
+					continue
+				}
+				if widened {
+					d = upcastValue(d, dt)
 				}
+				if sentinel, ok := options.nullSentinels[j]; ok && d == sentinel {
+					d = nil
+				}
+				if interned && d != nil {
+					d = options.interner.intern(j, d.(string), shouldCopy)
+				}
+				if options.rawJSON && dt == schemapb.DataType_JSON && d != nil {
+					d = json.RawMessage(d.([]byte))
+				}
+				if options.swapVectorBytes && d != nil {
+					d = swapVectorByteOrder(d, dt, elementType)
+				}
+				if options.nonFinite != nil && (dt == schemapb.DataType_Float || dt == schemapb.DataType_Double ||
+					dt == schemapb.DataType_FloatVector) {
+					if d, err = sanitizeNonFinite(d, j, i, options.nonFinite); err != nil {
+						return err
+					}
+				}
+				if check := options.normCheck; check != nil && j == check.fieldID && d != nil && lowNorm(d.([]float32), check.minNorm) {
+					rowID := int64(-1)
+					if ids, ok := r.Column(common.RowIDField).(*array.Int64); ok && ids.IsValid(i) {
+						rowID = ids.Value(i)
+					}
+					lowNormRows = append(lowNormRows, rowID)
+					if check.action == NormCheckError {
+						check.record(lowNormRows)
+						return merr.WrapErrParameterInvalidMsg("vector of field %d of row %d has a norm of at most %g", j, rowID, check.minNorm)
+					}
+				}
+				if transform, ok := options.fieldTransforms[j]; ok && d != nil {
+					d = transform(d)
+				}
+				m[j] = d // TODO: avoid memory copy here.
 			}
 		}
 
 		rowID, ok := m[common.RowIDField].(int64)
 		if !ok {
-			return merr.WrapErrIoKeyNotFound("no row id column found")
+			if options.nextRowID == nil {
+				return merr.WrapErrIoKeyNotFound("no row id column found")
+			}
+			rowID = *options.nextRowID
+			*options.nextRowID++
 		}
 		value.ID = rowID
-		value.Timestamp = m[common.TimeStampField].(int64)
-
-		pk, err := GenPrimaryKeyByRawData(m[pkField.FieldID], pkField.DataType)
-		if err != nil {
-			return err
+		if options.nextRowID != nil {
+			value.Timestamp, _ = m[common.TimeStampField].(int64)
+		} else {
+			value.Timestamp = m[common.TimeStampField].(int64)
 		}
 
-		value.PK = pk
-		value.IsDeleted = false
+		switch {
+		case options.skipPK:
+			value.PK = nil
+		case batched:
+			value.PK = pks[i]
+		default:
+			pk, err := GenPrimaryKeyByRawData(m[pkField.FieldID], pkField.DataType)
+			if err != nil {
+				return err
+			}
+			value.PK = pk
+		}
 		value.Value = m
+		if options.partials != nil {
+			options.partials.overlay(value)
+		}
+		value.IsDeleted = options.deletes != nil && options.deletes.IsDeleted(value.PK.GetValue(), Timestamp(value.Timestamp))
+	}
+	if options.fieldErrors != nil {
+		options.fieldErrors.rows += int64(r.Len())
+	}
+	if check := options.normCheck; check != nil && len(lowNormRows) > 0 {
+		check.record(lowNormRows)
+		if check.action == NormCheckWarn {
+			log.Warn("vectors of low norm deserialized", zap.Int64("fieldID", check.fieldID),
+				zap.Float64("minNorm", check.minNorm), zap.Int("count", len(lowNormRows)),
+				zap.Int64s("rowIDs", lowNormRows[:min(len(lowNormRows), maxNormCheckExamples)]))
+		}
 	}
 	return nil
 }
 
 func NewBinlogDeserializeReader(schema *schemapb.CollectionSchema, blobsReader ChunkedBlobsReader, shouldCopy bool,
+	opts ...ValueDeserializerOption,
 ) (*DeserializeReaderImpl[*Value], error) {
+	if err := rejectPartialUpdates(opts); err != nil {
+		return nil, err
+	}
 	reader := newIterativeCompositeBinlogRecordReader(schema, nil, blobsReader)
 	return NewDeserializeReader(reader, func(r Record, v []*Value) error {
-		return ValueDeserializerWithSchema(r, v, schema, shouldCopy)
+		return ValueDeserializerWithSchema(r, v, schema, shouldCopy, opts...)
 	}), nil
 }
 
+// DefaultReadAllMaxValues is the default cap of values drained by ReadAllValues.
+const DefaultReadAllMaxValues = 1 << 20
+
+type readAllOptions struct {
+	maxValues int
+}
+
+type ReadAllOption func(*readAllOptions)
+
+// WithReadAllMaxValues overrides DefaultReadAllMaxValues.
+func WithReadAllMaxValues(maxValues int) ReadAllOption {
+	return func(o *readAllOptions) {
+		o.maxValues = maxValues
+	}
+}
+
+// ReadAllValues drains reader into a slice and closes it. It fails instead of loading
+// more than the max values, to guard against draining a huge segment by accident.
+// The reader must be created with shouldCopy set, otherwise the values reference
+// records released by the following batches.
+func ReadAllValues(reader *DeserializeReaderImpl[*Value], opts ...ReadAllOption) ([]*Value, error) {
+	defer reader.Close()
+	options := &readAllOptions{maxValues: DefaultReadAllMaxValues}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	values := make([]*Value, 0)
+	for {
+		v, err := reader.NextValue()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(values) >= options.maxValues {
+			return nil, merr.WrapErrParameterInvalidMsg("read all values exceeds the max %d values", options.maxValues)
+		}
+		values = append(values, *v)
+	}
+}
+
+// ReadAllValid drains reader into a slice and closes it like ReadAllValues, but returns
+// the values read before a read failed along with the error, so that the caller may
+// salvage the rows preceding e.g. a corrupt last batch of the files. The error is nil
+// once reader reached io.EOF.
+func ReadAllValid(reader *DeserializeReaderImpl[*Value], opts ...ReadAllOption) ([]*Value, error) {
+	defer reader.Close()
+	options := &readAllOptions{maxValues: DefaultReadAllMaxValues}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	values := make([]*Value, 0)
+	for {
+		v, err := reader.NextValue()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		if len(values) >= options.maxValues {
+			return values, merr.WrapErrParameterInvalidMsg("read all values exceeds the max %d values", options.maxValues)
+		}
+		values = append(values, *v)
+	}
+}
+
+// Values returns an iterator over the values of reader, for callers ranging over it with
+// `for v, err := range Values(reader)`. A read error is yielded once and ends the
+// iteration. The reader is closed when the iteration ends, also when the loop breaks
+// early, and an error closing a drained reader is yielded as the last element.
+func Values(reader *DeserializeReaderImpl[*Value]) iter.Seq2[*Value, error] {
+	return func(yield func(*Value, error) bool) {
+		closed := false
+		defer func() {
+			if !closed {
+				reader.Close()
+			}
+		}()
+		for {
+			v, err := reader.NextValue()
+			if err == io.EOF {
+				closed = true
+				if err := reader.Close(); err != nil {
+					yield(nil, err)
+				}
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(*v, nil) {
+				return
+			}
+		}
+	}
+}
+
 type HeaderExtraWriterOption func(header *descriptorEvent)
 
 func WithEncryptionKey(ezID int64, edek []byte) HeaderExtraWriterOption {
@@ -421,14 +1425,151 @@ func NewBinlogStreamWriters(collectionID, partitionID, segmentID UniqueID,
 	return bws
 }
 
-func ValueSerializer(v []*Value, schema *schemapb.CollectionSchema) (Record, error) {
-	allFieldsSchema := schema.Fields
-	for _, structField := range schema.StructArrayFields {
-		allFieldsSchema = append(allFieldsSchema, structField.Fields...)
+// stringOffsetLimit is the size of the string values a string array addresses with its
+// 32-bit offsets.
+var stringOffsetLimit int64 = math.MaxInt32
+
+// stringBytes returns the total length of the string values of field fieldID in v.
+func stringBytes(v []*Value, fieldID FieldID) int64 {
+	var size int64
+	for _, vv := range v {
+		if s, ok := vv.Value.(map[FieldID]any)[fieldID].(string); ok {
+			size += int64(len(s))
+		}
+	}
+	return size
+}
+
+// WithMaxLengthCheck fails the serialization of VarChar values longer than the max_length
+// of their field, in bytes as the proxy validates them. Without it the values are written
+// whatever their length.
+func WithMaxLengthCheck() ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.checkMaxLength = true
+	}
+}
+
+// WithMaxLengthTruncation truncates VarChar values longer than the max_length of their
+// field to their longest prefix of whole UTF-8 characters within max_length bytes, and
+// adds the number of truncated values to truncations. truncations must not be shared by
+// serializations running concurrently.
+func WithMaxLengthTruncation(truncations *int64) ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.checkMaxLength = true
+		opts.truncations = truncations
+	}
+}
+
+// WithZeroNullVectors writes a zero vector of the dimension of vector field fieldID for
+// its nils, for index builders which cannot handle null vectors, and appends the row ids
+// of the values substituted to rowIDs, so that the nulls can be reconstructed. rowIDs
+// must not be shared by serializations running concurrently.
+func WithZeroNullVectors(fieldID FieldID, rowIDs *[]int64) ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.zeroVectorField = fieldID
+		opts.zeroVectorRows = rowIDs
+	}
+}
+
+// truncateUTF8 returns the longest prefix of s of at most n bytes that does not split a
+// UTF-8 character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
 	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// valueSerializerOptions configure ValueSerializer. By default the nils of nullable fields
+// and of fields having a default value are written as null, those of the other fields
+// fail; strictNulls fails on the defaulted ones too, and nullTypeDefaults writes the type
+// default for the others instead of failing.
+type valueSerializerOptions struct {
+	// nullTypeDefaults writes the type default for nils of non-nullable fields.
+	nullTypeDefaults bool
+	// strictNulls fails on the nils of all non-nullable fields, defaulted ones included.
+	strictNulls bool
+	// mem allocates the columns built.
+	mem memory.Allocator
+	// checkMaxLength checks the VarChar values against their max_length, truncating
+	// them if truncations is set, which counts the truncated values.
+	checkMaxLength bool
+	truncations    *int64
+	// zeroVectorRows collects the row ids of the nils of vector field zeroVectorField
+	// written as zero vectors, nil to write them as other nils.
+	zeroVectorField FieldID
+	zeroVectorRows  *[]int64
+	// partial writes the fields missing from the values as null, whatever their
+	// nullability, see WithPartialValues.
+	partial bool
+}
+
+type ValueSerializerOption func(*valueSerializerOptions)
+
+// WithNullTypeDefaults writes the zero value of the type, e.g. 0, "" or a zero vector, for
+// nils of fields that are neither nullable nor have a default value, for bulk loads of
+// sloppy sources. Without it such nils fail the serialization.
+func WithNullTypeDefaults() ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.nullTypeDefaults = true
+	}
+}
+
+// WithBuilderAllocator builds the columns of the record with mem instead of the Go
+// allocator, the buffers returning to mem once the record is released.
+func WithBuilderAllocator(mem memory.Allocator) ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.mem = mem
+	}
+}
+
+// WithStrictNulls fails the serialization on the nils of every field that is not nullable,
+// also of the fields having a default value, which would otherwise be written as null and
+// read back as the default, masking the producers dropping values of required fields. It
+// takes precedence over WithNullTypeDefaults.
+func WithStrictNulls() ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.strictNulls = true
+	}
+}
+
+// WithPartialValues serializes the values of upserts writing only the fields they change:
+// the fields missing from a value are left unchanged, written as null to the files of
+// PartialSchema and overlaid onto the rows of the primary key on read, see
+// WithPartialUpdates. A value must carry its row id, timestamp and primary key, and a nil
+// in its map fails, it would read back as unchanged, so a partial value cannot set a
+// field to null.
+func WithPartialValues() ValueSerializerOption {
+	return func(opts *valueSerializerOptions) {
+		opts.partial = true
+	}
+}
+
+// ValueSerializer serializes v into a record of the fields of schema. Fields missing from
+// a value or nil are written as null, which reads back as the default value of fields
+// having one. Nils of the other non-nullable fields fail, see WithNullTypeDefaults and
+// WithStrictNulls. String columns whose values exceed the 2GB addressable with 32-bit
+// offsets are built as large strings.
+func ValueSerializer(v []*Value, schema *schemapb.CollectionSchema, opts ...ValueSerializerOption) (Record, error) {
+	options := &valueSerializerOptions{mem: memory.DefaultAllocator}
+	for _, opt := range opts {
+		opt(options)
+	}
+	// collect into a new slice, appending struct sub-fields to schema.Fields could
+	// write into its spare capacity shared with other callers.
+	allFieldsSchema := typeutil.GetAllFieldSchemas(schema)
 
 	builders := make(map[FieldID]array.Builder, len(allFieldsSchema))
+	releaseBuilders := func() {
+		for _, builder := range builders {
+			builder.Release()
+		}
+	}
 	types := make(map[FieldID]schemapb.DataType, len(allFieldsSchema))
+	entries := make(map[FieldID]serdeEntry, len(allFieldsSchema))
 	elementTypes := make(map[FieldID]schemapb.DataType, len(allFieldsSchema)) // For ArrayOfVector
 	for _, f := range allFieldsSchema {
 		dim, _ := typeutil.GetDim(f)
@@ -439,19 +1580,60 @@ func ValueSerializer(v []*Value, schema *schemapb.CollectionSchema) (Record, err
 			elementTypes[f.FieldID] = elementType
 		}
 
-		arrowType := serdeMap[f.DataType].arrowType(int(dim), elementType)
-		builders[f.FieldID] = array.NewBuilder(memory.DefaultAllocator, arrowType)
+		entry, ok := lookupSerdeEntry(f)
+		if !ok {
+			releaseBuilders()
+			return nil, merr.WrapErrParameterInvalidMsg("no codec of field %d [%s] of data type %s", f.GetFieldID(), f.GetName(), f.GetDataType())
+		}
+		arrowType := entry.arrowType(int(dim), elementType)
+		if arrow.TypeEqual(arrowType, arrow.BinaryTypes.String) && stringBytes(v, f.FieldID) > stringOffsetLimit {
+			// 32-bit offsets cannot address the values of the batch
+			arrowType = arrow.BinaryTypes.LargeString
+		}
+		builders[f.FieldID] = array.NewBuilder(options.mem, arrowType)
 		builders[f.FieldID].Reserve(len(v)) // reserve space to avoid copy
 		types[f.FieldID] = f.DataType
+		entries[f.FieldID] = entry
 	}
 
-	for _, vv := range v {
+	maxLengths := make(map[FieldID]int64)
+	if options.checkMaxLength {
+		for _, f := range allFieldsSchema {
+			if f.GetDataType() != schemapb.DataType_VarChar {
+				continue
+			}
+			// fields without max_length are not checked
+			if maxLength, err := parameterutil.GetMaxLength(f); err == nil {
+				maxLengths[f.FieldID] = maxLength
+			}
+		}
+	}
+	for row, vv := range v {
 		m := vv.Value.(map[FieldID]any)
 
-		for fid, e := range m {
-			typeEntry, ok := serdeMap[types[fid]]
-			if !ok {
-				panic("unknown type")
+		// iterate over the schema rather than the value map, a field missing from the
+		// map is serialized as null so that every column keeps one entry per row.
+		found := 0
+		for _, f := range allFieldsSchema {
+			fid := f.FieldID
+			e, ok := m[fid]
+			if ok {
+				found++
+			}
+			if options.partial {
+				if !ok && isPartialKeyField(f) {
+					releaseBuilders()
+					return nil, merr.WrapErrParameterInvalidMsg("row %d: partial value carries no field %d [%s]", row, fid, f.GetName())
+				}
+				if ok && e == nil {
+					releaseBuilders()
+					return nil, merr.WrapErrParameterInvalidMsg("row %d: partial value sets field %d [%s] to nil, read back as unchanged",
+						row, fid, f.GetName())
+				}
+				if !ok {
+					builders[fid].AppendNull()
+					continue
+				}
 			}
 
 			// Get element type for ArrayOfVector, otherwise use None
@@ -460,11 +1642,49 @@ func ValueSerializer(v []*Value, schema *schemapb.CollectionSchema) (Record, err
 				elementType = elementTypes[fid]
 			}
 
-			ok = typeEntry.serialize(builders[fid], e, elementType)
+			if e == nil && options.zeroVectorRows != nil && fid == options.zeroVectorField {
+				// the empty value of a fixed size binary is zeroed
+				builders[fid].AppendEmptyValue()
+				*options.zeroVectorRows = append(*options.zeroVectorRows, vv.ID)
+				continue
+			}
+			if e == nil && !f.GetNullable() && options.strictNulls {
+				releaseBuilders()
+				rowID, _ := m[common.RowIDField].(int64)
+				return nil, merr.WrapErrParameterInvalid("value of required field", "nil",
+					fmt.Sprintf("row %d (row id %d): field %d [%s] is not nullable but is nil", row, rowID, fid, f.GetName()))
+			}
+			if e == nil && !f.GetNullable() && f.GetDefaultValue() == nil {
+				if !options.nullTypeDefaults {
+					releaseBuilders()
+					return nil, merr.WrapErrParameterInvalidMsg("row %d: field %d [%s] is not nullable but has no value", row, fid, f.GetName())
+				}
+				builders[fid].AppendEmptyValue()
+				continue
+			}
+			if maxLength, ok := maxLengths[fid]; ok {
+				if s, ok := e.(string); ok && int64(len(s)) > maxLength {
+					if options.truncations == nil {
+						releaseBuilders()
+						return nil, merr.WrapErrParameterInvalidMsg("row %d: value of %d bytes of field %d [%s] exceeds max_length %d",
+							row, len(s), fid, f.GetName(), maxLength)
+					}
+					e = truncateUTF8(s, int(maxLength))
+					*options.truncations++
+				}
+			}
+
+			ok = entries[fid].serialize(builders[fid], e, elementType)
 			if !ok {
+				releaseBuilders()
 				return nil, merr.WrapErrServiceInternal(fmt.Sprintf("serialize error on type %s", types[fid]))
 			}
 		}
+		if found != len(m) {
+			releaseBuilders()
+			return nil, merr.WrapErrParameterInvalidMsg("row %d: value carries %d fields not in the schema of collection [%s]",
+				row, len(m)-found, schema.GetName())
+		}
 	}
 	arrays := make([]arrow.Array, len(allFieldsSchema))
 	fields := make([]arrow.Field, len(allFieldsSchema))
@@ -19,28 +19,36 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"sort"
 	"strconv"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
 	"github.com/apache/arrow/go/v17/arrow/memory"
 	"github.com/apache/arrow/go/v17/parquet/file"
 	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+	"github.com/cockroachdb/errors"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
 	"github.com/milvus-io/milvus/internal/allocator"
 	"github.com/milvus-io/milvus/pkg/v2/common"
 	"github.com/milvus-io/milvus/pkg/v2/log"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 )
 
 func TestBinlogDeserializeReader(t *testing.T) {
@@ -455,6 +463,229 @@ func TestNull(t *testing.T) {
 	})
 }
 
+func TestReadAllValues(t *testing.T) {
+	t.Run("read all", func(t *testing.T) {
+		size := 10
+		blobs, err := generateTestData(size)
+		assert.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(generateTestSchema(), MakeBlobsReader(blobs), true)
+		assert.NoError(t, err)
+
+		values, err := ReadAllValues(reader)
+		assert.NoError(t, err)
+		assert.Len(t, values, size)
+		for i, v := range values {
+			assertTestData(t, i+1, v)
+		}
+	})
+
+	t.Run("exceeds max values", func(t *testing.T) {
+		blobs, err := generateTestData(10)
+		assert.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(generateTestSchema(), MakeBlobsReader(blobs), true)
+		assert.NoError(t, err)
+
+		_, err = ReadAllValues(reader, WithReadAllMaxValues(9))
+		assert.Error(t, err)
+	})
+}
+
+// truncatedRecordReader fails with err once its records are read.
+type truncatedRecordReader struct {
+	RecordReader
+	err error
+}
+
+func (r *truncatedRecordReader) Next() (Record, error) {
+	rec, err := r.RecordReader.Next()
+	if err == io.EOF {
+		return nil, r.err
+	}
+	return rec, err
+}
+
+func TestReadAllValid(t *testing.T) {
+	values := []*Value{newTestValue(1, 1), newTestValue(2, 1), newTestValue(3, 1)}
+
+	t.Run("salvage", func(t *testing.T) {
+		rr := &truncatedRecordReader{
+			RecordReader: &valueBatchRecordReader{values: values, batchSize: 2},
+			err:          merr.WrapErrIoFailedReason("corrupt batch"),
+		}
+		read, err := ReadAllValid(NewDeserializeReader(rr, copyValueBatch))
+		assert.ErrorIs(t, err, merr.ErrIoFailed)
+		assert.Equal(t, values, read)
+	})
+
+	t.Run("clean eof", func(t *testing.T) {
+		read, err := ReadAllValid(newValueSliceReader(values, 2))
+		assert.NoError(t, err)
+		assert.Equal(t, values, read)
+	})
+}
+
+// closeCountingRecordReader counts the closes of a record reader.
+type closeCountingRecordReader struct {
+	RecordReader
+	closed int
+}
+
+func (r *closeCountingRecordReader) Close() error {
+	r.closed++
+	return r.RecordReader.Close()
+}
+
+func TestValues(t *testing.T) {
+	values := []*Value{newTestValue(1, 1), newTestValue(2, 1), newTestValue(3, 1)}
+
+	t.Run("range all", func(t *testing.T) {
+		rr := &closeCountingRecordReader{RecordReader: &valueBatchRecordReader{values: values, batchSize: 2}}
+		var pks []int64
+		for v, err := range Values(NewDeserializeReader(rr, copyValueBatch)) {
+			require.NoError(t, err)
+			pks = append(pks, v.ID)
+		}
+		assert.Equal(t, []int64{1, 2, 3}, pks)
+		assert.Equal(t, 1, rr.closed)
+	})
+
+	t.Run("break early", func(t *testing.T) {
+		rr := &closeCountingRecordReader{RecordReader: &valueBatchRecordReader{values: values, batchSize: 2}}
+		for v, err := range Values(NewDeserializeReader(rr, copyValueBatch)) {
+			require.NoError(t, err)
+			if v.ID == 2 {
+				break
+			}
+		}
+		assert.Equal(t, 1, rr.closed)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		rr := &closeCountingRecordReader{RecordReader: &valueBatchRecordReader{values: values, batchSize: 2}}
+		failing := NewDeserializeReader(rr, func(r Record, v []*Value) error {
+			return errors.New("mock error")
+		})
+		var errs []error
+		for v, err := range Values(failing) {
+			assert.Nil(t, v)
+			errs = append(errs, err)
+		}
+		assert.Len(t, errs, 1)
+		assert.Equal(t, 1, rr.closed)
+	})
+}
+
+func TestSourceByteOrder(t *testing.T) {
+	fields := []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "float_vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+		{FieldID: 101, Name: "f16_vec", DataType: schemapb.DataType_Float16Vector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+		{FieldID: 102, Name: "sparse_vec", DataType: schemapb.DataType_SparseFloatVector},
+	}
+	schema := &schemapb.CollectionSchema{Fields: fields}
+	arrowSchema, err := ConvertToArrowSchema(schema, false)
+	require.NoError(t, err)
+
+	floats := []float32{1.5, -2.25}
+	sparse := make([]byte, 8)
+	binary.LittleEndian.PutUint32(sparse, 7)
+	binary.LittleEndian.PutUint32(sparse[4:], math.Float32bits(0.5))
+	f16 := []byte{0x01, 0x02, 0x03, 0x04}
+
+	// the vectors as written on a host of the other byte order
+	foreign := binary.ByteOrder(binary.BigEndian)
+	if !isLittleEndian(binary.NativeEndian) {
+		foreign = binary.LittleEndian
+	}
+	floatBytes := make([]byte, 8)
+	for i, f := range floats {
+		foreign.PutUint32(floatBytes[i*4:], math.Float32bits(f))
+	}
+	swapped := func(data []byte, width int) []byte {
+		out := make([]byte, len(data))
+		for i := 0; i < len(data); i += width {
+			for j := 0; j < width; j++ {
+				out[i+j] = data[i+width-1-j]
+			}
+		}
+		return out
+	}
+	nativeSparse := sparse
+	if !isLittleEndian(binary.NativeEndian) {
+		nativeSparse = swapped(sparse, 4)
+	}
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
+	defer builder.Release()
+	builder.Field(0).(*array.Int64Builder).Append(1)
+	builder.Field(1).(*array.Int64Builder).Append(1)
+	builder.Field(2).(*array.FixedSizeBinaryBuilder).Append(floatBytes)
+	builder.Field(3).(*array.FixedSizeBinaryBuilder).Append(swapped(f16, 2))
+	builder.Field(4).(*array.BinaryBuilder).Append(swapped(nativeSparse, 4))
+	rec := NewSimpleArrowRecord(builder.NewRecord(), map[FieldID]int{common.RowIDField: 0, common.TimeStampField: 1, 100: 2, 101: 3, 102: 4})
+	defer rec.Release()
+
+	deserialize := func(opts ...ValueDeserializerOption) map[FieldID]any {
+		v := make([]*Value, 1)
+		require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, false, opts...))
+		return v[0].Value.(map[FieldID]any)
+	}
+
+	m := deserialize(WithSourceByteOrder(foreign))
+	assert.Equal(t, floats, m[100])
+	assert.Equal(t, f16, m[101])
+	assert.Equal(t, nativeSparse, m[102])
+
+	// the record is left untouched
+	m = deserialize()
+	assert.NotEqual(t, floats, m[100])
+	assert.Equal(t, swapped(f16, 2), m[101])
+
+	m = deserialize(WithSourceByteOrder(binary.NativeEndian))
+	assert.Equal(t, swapped(f16, 2), m[101])
+}
+
+func TestNullSentinel(t *testing.T) {
+	t.Run("sentinel read as null", func(t *testing.T) {
+		size := 3
+		blobs, err := generateTestData(size)
+		assert.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(generateTestSchema(), MakeBlobsReader(blobs), false,
+			WithNullSentinel(13, int64(2)), WithNullSentinel(16, "3"))
+		assert.NoError(t, err)
+		defer reader.Close()
+
+		for i := 1; i <= size; i++ {
+			v, err := reader.NextValue()
+			assert.NoError(t, err)
+			m := (*v).Value.(map[FieldID]any)
+			if i == 2 {
+				assert.Nil(t, m[13])
+			} else {
+				assert.Equal(t, int64(i), m[13])
+			}
+			if i == 3 {
+				assert.Nil(t, m[16])
+			} else {
+				assert.Equal(t, fmt.Sprint(i), m[16])
+			}
+			assert.Equal(t, int64(i), m[common.RowIDField])
+		}
+	})
+
+	t.Run("non comparable sentinel", func(t *testing.T) {
+		blobs, err := generateTestData(1)
+		assert.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(generateTestSchema(), MakeBlobsReader(blobs), false,
+			WithNullSentinel(19, []byte("{}")))
+		assert.NoError(t, err)
+		defer reader.Close()
+		_, err = reader.NextValue()
+		assert.Error(t, err)
+	})
+}
+
 func generateTestDeltalogData(size int) (*Blob, error) {
 	codec := NewDeleteCodec()
 	pks := make([]int64, size)
@@ -814,3 +1045,623 @@ func TestMakeBlobsReader(t *testing.T) {
 		})
 	}
 }
+
+func TestSynthesizedRowIDs(t *testing.T) {
+	// external data without system columns
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: 100, Name: "pk", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: 101, Name: "name", DataType: schemapb.DataType_VarChar},
+	}}
+	arrowSchema, err := ConvertToArrowSchema(schema, false)
+	require.NoError(t, err)
+	batch := func(pks ...int64) Record {
+		builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
+		defer builder.Release()
+		for _, pk := range pks {
+			builder.Field(0).(*array.Int64Builder).Append(pk)
+			builder.Field(1).(*array.StringBuilder).Append(fmt.Sprint(pk))
+		}
+		return NewSimpleArrowRecord(builder.NewRecord(), map[FieldID]int{100: 0, 101: 1})
+	}
+	deserialize := func(rec Record, opts ...ValueDeserializerOption) ([]*Value, error) {
+		defer rec.Release()
+		v := make([]*Value, rec.Len())
+		return v, ValueDeserializerWithSchema(rec, v, schema, true, opts...)
+	}
+
+	_, err = deserialize(batch(7))
+	assert.ErrorIs(t, err, merr.ErrIoKeyNotFound)
+
+	opt := WithSynthesizedRowIDs(10)
+	var ids []int64
+	for _, rec := range []Record{batch(7, 8, 9), batch(1, 2)} {
+		values, err := deserialize(rec, opt)
+		require.NoError(t, err)
+		for _, v := range values {
+			ids = append(ids, v.ID)
+			assert.Equal(t, int64(0), v.Timestamp)
+			assert.Equal(t, fmt.Sprint(v.PK.GetValue()), v.Value.(map[FieldID]any)[101])
+		}
+	}
+	assert.Equal(t, []int64{10, 11, 12, 13, 14}, ids)
+}
+
+func TestFieldTransforms(t *testing.T) {
+	fields := []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "name", DataType: schemapb.DataType_VarChar, Nullable: true},
+		{FieldID: 101, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+	}
+	schema := &schemapb.CollectionSchema{Fields: fields}
+	arrowSchema, err := ConvertToArrowSchema(schema, false)
+	require.NoError(t, err)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
+	defer builder.Release()
+	vec := make([]byte, 8)
+	binary.NativeEndian.PutUint32(vec, math.Float32bits(1.5))
+	binary.NativeEndian.PutUint32(vec[4:], math.Float32bits(-2))
+	for i := 0; i < 2; i++ {
+		builder.Field(0).(*array.Int64Builder).Append(int64(i))
+		builder.Field(1).(*array.Int64Builder).Append(1)
+		builder.Field(3).(*array.FixedSizeBinaryBuilder).Append(vec)
+	}
+	builder.Field(2).(*array.StringBuilder).Append("alice")
+	builder.Field(2).(*array.StringBuilder).AppendNull()
+	rec := NewSimpleArrowRecord(builder.NewRecord(), map[FieldID]int{common.RowIDField: 0, common.TimeStampField: 1, 100: 2, 101: 3})
+	defer rec.Release()
+
+	calls := 0
+	transforms := map[FieldID]func(any) any{
+		100: func(v any) any {
+			calls++
+			return fmt.Sprintf("redacted-%d", len(v.(string)))
+		},
+		101: func(v any) any { return make([]float32, len(v.([]float32))) },
+	}
+	v := make([]*Value, 2)
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, true, WithFieldTransforms(transforms)))
+	assert.Equal(t, "redacted-5", v[0].Value.(map[FieldID]any)[100])
+	assert.Nil(t, v[1].Value.(map[FieldID]any)[100])
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []float32{0, 0}, v[0].Value.(map[FieldID]any)[101])
+	assert.Equal(t, int64(1), v[1].PK.GetValue())
+}
+
+func TestSkipPK(t *testing.T) {
+	fields := []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "pk", DataType: schemapb.DataType_VarChar, IsPrimaryKey: true},
+	}
+	schema := &schemapb.CollectionSchema{Fields: fields}
+	arrowSchema, err := ConvertToArrowSchema(schema, false)
+	require.NoError(t, err)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
+	defer builder.Release()
+	for i := 0; i < 3; i++ {
+		builder.Field(0).(*array.Int64Builder).Append(int64(i))
+		builder.Field(1).(*array.Int64Builder).Append(1)
+		builder.Field(2).(*array.StringBuilder).Append(fmt.Sprint(i))
+	}
+	rec := NewSimpleArrowRecord(builder.NewRecord(), map[FieldID]int{common.RowIDField: 0, common.TimeStampField: 1, 100: 2})
+	defer rec.Release()
+
+	v := make([]*Value, 3)
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, true))
+	assert.Equal(t, "2", v[2].PK.GetValue())
+
+	// the values are reused, their primary keys are reset
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, true, WithSkipPK()))
+	for i, value := range v {
+		assert.Nil(t, value.PK)
+		assert.Equal(t, int64(i), value.ID)
+		assert.Equal(t, fmt.Sprint(i), value.Value.(map[FieldID]any)[100])
+	}
+
+	t.Run("projection without primary key", func(t *testing.T) {
+		projected := &schemapb.CollectionSchema{Fields: fields[:2]}
+		v := make([]*Value, 3)
+		assert.Error(t, ValueDeserializerWithSchema(rec, v, projected, true))
+		require.NoError(t, ValueDeserializerWithSchema(rec, v, projected, true, WithSkipPK()))
+		assert.Nil(t, v[0].PK)
+		assert.NotContains(t, v[0].Value.(map[FieldID]any), FieldID(100))
+	})
+}
+
+func TestLenientDecode(t *testing.T) {
+	fields := []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "tags", DataType: schemapb.DataType_Array, ElementType: schemapb.DataType_Int64},
+		{FieldID: 101, Name: "name", DataType: schemapb.DataType_VarChar},
+	}
+	schema := &schemapb.CollectionSchema{Fields: fields}
+	arrowSchema, err := ConvertToArrowSchema(schema, false)
+	require.NoError(t, err)
+	tags, err := proto.Marshal(&schemapb.ScalarField{Data: &schemapb.ScalarField_LongData{LongData: &schemapb.LongArray{Data: []int64{1}}}})
+	require.NoError(t, err)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)
+	defer builder.Release()
+	for i := 0; i < 3; i++ {
+		builder.Field(0).(*array.Int64Builder).Append(int64(i))
+		builder.Field(1).(*array.Int64Builder).Append(1)
+		builder.Field(3).(*array.StringBuilder).Append(fmt.Sprint(i))
+		if i == 1 {
+			// a truncated varint
+			builder.Field(2).(*array.BinaryBuilder).Append([]byte{0xff, 0xff})
+		} else {
+			builder.Field(2).(*array.BinaryBuilder).Append(tags)
+		}
+	}
+	rec := NewSimpleArrowRecord(builder.NewRecord(), map[FieldID]int{common.RowIDField: 0, common.TimeStampField: 1, 100: 2, 101: 3})
+	defer rec.Release()
+
+	v := make([]*Value, 3)
+	assert.ErrorIs(t, ValueDeserializerWithSchema(rec, v, schema, true), merr.ErrServiceInternal)
+
+	collector := &FieldDecodeErrors{}
+	for batch := 0; batch < 2; batch++ {
+		v := make([]*Value, 3)
+		require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, true, WithLenientDecode(collector)))
+		assert.NotNil(t, v[0].Value.(map[FieldID]any)[100])
+		assert.Nil(t, v[1].Value.(map[FieldID]any)[100])
+		assert.Equal(t, "1", v[1].Value.(map[FieldID]any)[101])
+		assert.Equal(t, int64(1), v[1].PK.GetValue())
+	}
+	errs := collector.Errors()
+	require.Len(t, errs, 2)
+	assert.Equal(t, []int64{1, 4}, lo.Map(errs, func(e FieldDecodeError, _ int) int64 { return e.Row }))
+	for _, e := range errs {
+		assert.Equal(t, FieldID(100), e.FieldID)
+		assert.ErrorIs(t, e.Err, merr.ErrServiceInternal)
+	}
+}
+
+func TestValueSerializerNullability(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "name", DataType: schemapb.DataType_VarChar},
+		{FieldID: 101, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+		{FieldID: 102, Name: "nullable", DataType: schemapb.DataType_Int32, Nullable: true},
+		{FieldID: 103, Name: "defaulted", DataType: schemapb.DataType_Int64, DefaultValue: &schemapb.ValueField{
+			Data: &schemapb.ValueField_LongData{LongData: 7},
+		}},
+	}}
+	values := []*Value{
+		{Value: map[FieldID]any{common.RowIDField: int64(1), common.TimeStampField: int64(1), 100: "a", 101: []float32{1, 2}, 102: int32(1), 103: int64(1)}},
+		{Value: map[FieldID]any{common.RowIDField: int64(2), common.TimeStampField: int64(1), 100: "b", 101: []float32{3, 4}, 102: nil, 103: nil}},
+	}
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	defer rec.Release()
+	assert.True(t, rec.Column(102).IsNull(1))
+	assert.True(t, rec.Column(103).IsNull(1))
+
+	values = append(values, &Value{Value: map[FieldID]any{common.RowIDField: int64(3), common.TimeStampField: int64(1), 100: nil, 101: []float32{5, 6}}})
+	_, err = ValueSerializer(values, schema)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	assert.ErrorContains(t, err, "row 2: field 100 [name]")
+
+	delete(values[2].Value.(map[FieldID]any), 100)
+	values[2].Value.(map[FieldID]any)[101] = nil
+	_, err = ValueSerializer(values, schema)
+	assert.ErrorContains(t, err, "row 2: field 100 [name]")
+
+	t.Run("type defaults", func(t *testing.T) {
+		rec, err := ValueSerializer(values, schema, WithNullTypeDefaults())
+		require.NoError(t, err)
+		defer rec.Release()
+		assert.False(t, rec.Column(100).IsNull(2))
+		assert.Equal(t, "", rec.Column(100).(*array.String).Value(2))
+		assert.False(t, rec.Column(101).IsNull(2))
+		assert.Equal(t, make([]byte, 8), rec.Column(101).(*array.FixedSizeBinary).Value(2))
+		// nullable and defaulted fields keep their nulls
+		assert.True(t, rec.Column(102).IsNull(2))
+		assert.True(t, rec.Column(103).IsNull(2))
+	})
+
+	t.Run("strict nulls", func(t *testing.T) {
+		// the nil of the defaulted field 103 fails too
+		_, err := ValueSerializer(values[:2], schema, WithStrictNulls(), WithNullTypeDefaults())
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		assert.ErrorContains(t, err, "row 1 (row id 2): field 103")
+
+		values[1].Value.(map[FieldID]any)[103] = int64(3)
+		rec, err := ValueSerializer(values[:2], schema, WithStrictNulls())
+		require.NoError(t, err)
+		defer rec.Release()
+		// nullable fields keep their nulls
+		assert.True(t, rec.Column(102).IsNull(1))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		extra := []*Value{{Value: map[FieldID]any{common.RowIDField: int64(1), common.TimeStampField: int64(1), 100: "a",
+			101: []float32{1, 2}, 999: int64(1)}}}
+		_, err := ValueSerializer(extra, schema)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		assert.ErrorContains(t, err, "row 0: value carries 1 fields not in the schema")
+
+		unknown := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{{FieldID: 100, Name: "none", DataType: schemapb.DataType_None}}}
+		_, err = ValueSerializer(values, unknown)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		unknown.Fields[0].DataType = schemapb.DataType_Int64
+		unknown.Fields[0].TypeParams = []*commonpb.KeyValuePair{{Key: FieldCodecKey, Value: "unregistered"}}
+		_, err = ValueSerializer(values, unknown)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestValueSerializerMaxLength(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "name", DataType: schemapb.DataType_VarChar, Nullable: true, TypeParams: []*commonpb.KeyValuePair{{Key: common.MaxLengthKey, Value: "5"}}},
+		{FieldID: 101, Name: "unbounded", DataType: schemapb.DataType_VarChar},
+	}}
+	newValues := func(names ...any) []*Value {
+		return lo.Map(names, func(name any, i int) *Value {
+			return &Value{Value: map[FieldID]any{common.RowIDField: int64(i), common.TimeStampField: int64(1), 100: name, 101: "unbounded value"}}
+		})
+	}
+	// 2 bytes, 5 bytes, 6 bytes, 3 three-byte characters
+	values := newValues("ab", "abcde", "abcdef", "日本語", nil)
+
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", rec.Column(100).(*array.String).Value(2))
+	rec.Release()
+
+	_, err = ValueSerializer(values, schema, WithMaxLengthCheck())
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	assert.ErrorContains(t, err, "row 2: value of 6 bytes of field 100 [name] exceeds max_length 5")
+	_, err = ValueSerializer(newValues("日本語"), schema, WithMaxLengthCheck())
+	assert.ErrorContains(t, err, "row 0: value of 9 bytes")
+
+	var truncations int64
+	rec, err = ValueSerializer(values, schema, WithMaxLengthTruncation(&truncations))
+	require.NoError(t, err)
+	defer rec.Release()
+	col := rec.Column(100).(*array.String)
+	assert.Equal(t, "ab", col.Value(0))
+	assert.Equal(t, "abcde", col.Value(1))
+	assert.Equal(t, "abcde", col.Value(2))
+	// the characters are not split
+	assert.Equal(t, "日", col.Value(3))
+	assert.True(t, col.IsNull(4))
+	assert.Equal(t, "unbounded value", rec.Column(101).(*array.String).Value(0))
+	assert.Equal(t, int64(2), truncations)
+
+	assert.Equal(t, "", truncateUTF8("日本", 2))
+	assert.Equal(t, "日本", truncateUTF8("日本", 6))
+}
+
+func TestNonFiniteFloats(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "float", DataType: schemapb.DataType_Float},
+		{FieldID: 101, Name: "double", DataType: schemapb.DataType_Double},
+		{FieldID: 102, Name: "vec", DataType: schemapb.DataType_FloatVector, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+	}}
+	nan, inf := math.NaN(), math.Inf(1)
+	values := []*Value{
+		{Value: map[FieldID]any{common.RowIDField: int64(1), common.TimeStampField: int64(1), 100: float32(1), 101: 1.0, 102: []float32{1, 2}}},
+		{Value: map[FieldID]any{common.RowIDField: int64(2), common.TimeStampField: int64(1), 100: float32(nan), 101: inf, 102: []float32{float32(nan), float32(-inf)}}},
+	}
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	defer rec.Release()
+	deserialize := func(opts ...ValueDeserializerOption) ([]*Value, error) {
+		v := make([]*Value, rec.Len())
+		return v, ValueDeserializerWithSchema(rec, v, schema, false, opts...)
+	}
+
+	t.Run("pass through", func(t *testing.T) {
+		stats := &NonFiniteStats{}
+		v, err := deserialize(WithNonFiniteFloats(NonFinitePassThrough, 0, stats))
+		require.NoError(t, err)
+		m := v[1].Value.(map[FieldID]any)
+		assert.True(t, math.IsNaN(float64(m[100].(float32))))
+		assert.True(t, math.IsInf(m[101].(float64), 1))
+		assert.Equal(t, map[FieldID]int64{100: 1, 101: 1, 102: 2}, stats.Counts())
+		assert.Equal(t, int64(4), stats.Total())
+
+		v, err = deserialize()
+		require.NoError(t, err)
+		assert.True(t, math.IsNaN(float64(v[1].Value.(map[FieldID]any)[100].(float32))))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := deserialize(WithNonFiniteFloats(NonFiniteError, 0, nil))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		stats := &NonFiniteStats{}
+		for batch := 0; batch < 2; batch++ {
+			v, err := deserialize(WithNonFiniteFloats(NonFiniteReplace, -1, stats))
+			require.NoError(t, err)
+			assert.Equal(t, values[0].Value.(map[FieldID]any)[102], v[0].Value.(map[FieldID]any)[102])
+			m := v[1].Value.(map[FieldID]any)
+			assert.Equal(t, float32(-1), m[100])
+			assert.Equal(t, -1.0, m[101])
+			assert.Equal(t, []float32{-1, -1}, m[102])
+		}
+		assert.Equal(t, int64(8), stats.Total())
+
+		// the record read is left as is
+		v, err := deserialize()
+		require.NoError(t, err)
+		assert.True(t, math.IsNaN(float64(v[1].Value.(map[FieldID]any)[102].([]float32)[0])))
+	})
+}
+
+func TestValueDeserializerUpcast(t *testing.T) {
+	fieldsOf := func(intType, floatType schemapb.DataType) *schemapb.CollectionSchema {
+		return &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "int", DataType: intType, Nullable: true},
+			{FieldID: 101, Name: "float", DataType: floatType},
+		}}
+	}
+	written := fieldsOf(schemapb.DataType_Int32, schemapb.DataType_Float)
+	rec, err := ValueSerializer([]*Value{
+		{Value: map[FieldID]any{common.RowIDField: int64(1), common.TimeStampField: int64(1), 100: int32(-7), 101: float32(1.5)}},
+		{Value: map[FieldID]any{common.RowIDField: int64(2), common.TimeStampField: int64(1), 100: nil, 101: float32(0.1)}},
+	}, written)
+	require.NoError(t, err)
+	defer rec.Release()
+
+	v := make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, fieldsOf(schemapb.DataType_Int64, schemapb.DataType_Double), false))
+	assert.Equal(t, int64(-7), v[0].Value.(map[FieldID]any)[100])
+	assert.Equal(t, 1.5, v[0].Value.(map[FieldID]any)[101])
+	assert.Nil(t, v[1].Value.(map[FieldID]any)[100])
+	assert.Equal(t, float64(float32(0.1)), v[1].Value.(map[FieldID]any)[101])
+
+	// reading as written needs no upcast
+	v = make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, written, false))
+	assert.Equal(t, int32(-7), v[0].Value.(map[FieldID]any)[100])
+
+	for _, schema := range []*schemapb.CollectionSchema{
+		fieldsOf(schemapb.DataType_Int16, schemapb.DataType_Float),
+		fieldsOf(schemapb.DataType_Int32, schemapb.DataType_Int64),
+		fieldsOf(schemapb.DataType_Float, schemapb.DataType_Double),
+	} {
+		err := ValueDeserializerWithSchema(rec, make([]*Value, rec.Len()), schema, false)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	}
+}
+
+func TestRequiredFieldCheck(t *testing.T) {
+	schemaOf := func(nullable bool) *schemapb.CollectionSchema {
+		return &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "int", DataType: schemapb.DataType_Int64, Nullable: nullable},
+		}}
+	}
+	// written while the field was nullable
+	rec, err := ValueSerializer([]*Value{
+		{Value: map[FieldID]any{common.RowIDField: int64(11), common.TimeStampField: int64(1), 100: int64(1)}},
+		{Value: map[FieldID]any{common.RowIDField: int64(12), common.TimeStampField: int64(1), 100: nil}},
+	}, schemaOf(true))
+	require.NoError(t, err)
+	defer rec.Release()
+
+	// nulls are accepted by default
+	v := make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, schemaOf(false), false))
+	assert.Nil(t, v[1].Value.(map[FieldID]any)[100])
+
+	err = ValueDeserializerWithSchema(rec, make([]*Value, rec.Len()), schemaOf(false), false, WithRequiredFieldCheck())
+	var nullErr *NullInRequiredFieldError
+	require.ErrorAs(t, err, &nullErr)
+	assert.Equal(t, int64(12), nullErr.RowID)
+	assert.Equal(t, FieldID(100), nullErr.FieldID)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	require.NoError(t, ValueDeserializerWithSchema(rec, make([]*Value, rec.Len()), schemaOf(true), false, WithRequiredFieldCheck()))
+}
+
+func TestVectorNormCheck(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "int", DataType: schemapb.DataType_Int64},
+		{FieldID: 101, Name: "vec", DataType: schemapb.DataType_FloatVector, Nullable: true, TypeParams: []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "2"}}},
+	}}
+	vectors := [][]float32{{1, 0}, {0, 0}, nil, {1e-4, 0}, {0, 0}, {3, 4}}
+	values := make([]*Value, len(vectors))
+	for i, vec := range vectors {
+		var v any
+		if vec != nil {
+			v = vec
+		}
+		values[i] = &Value{Value: map[FieldID]any{common.RowIDField: int64(10 + i), common.TimeStampField: int64(1), 100: int64(i), 101: v}}
+	}
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	defer rec.Release()
+	deserialize := func(opts ...ValueDeserializerOption) error {
+		return ValueDeserializerWithSchema(rec, make([]*Value, rec.Len()), schema, false, opts...)
+	}
+
+	for _, action := range []NormCheckAction{NormCheckCount, NormCheckWarn} {
+		stats := &NormCheckStats{}
+		require.NoError(t, deserialize(WithVectorNormCheck(101, 0, action, stats)))
+		assert.Equal(t, NormCheckStats{Count: 2, ExampleRowIDs: []int64{11, 14}}, *stats)
+	}
+
+	// a threshold flags the denormalized vectors too, across batches
+	stats := &NormCheckStats{}
+	require.NoError(t, deserialize(WithVectorNormCheck(101, 1e-3, NormCheckCount, stats)))
+	require.NoError(t, deserialize(WithVectorNormCheck(101, 1e-3, NormCheckCount, stats)))
+	assert.Equal(t, NormCheckStats{Count: 6, ExampleRowIDs: []int64{11, 13, 14, 11, 13, 14}}, *stats)
+
+	stats = &NormCheckStats{}
+	err = deserialize(WithVectorNormCheck(101, 0, NormCheckError, stats))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	assert.ErrorContains(t, err, "row 11")
+	assert.Equal(t, NormCheckStats{Count: 1, ExampleRowIDs: []int64{11}}, *stats)
+
+	assert.ErrorIs(t, deserialize(WithVectorNormCheck(100, 0, NormCheckCount, nil)), merr.ErrParameterInvalid)
+}
+
+func TestRawJSON(t *testing.T) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "json", DataType: schemapb.DataType_JSON, Nullable: true},
+	}}
+	newValue := func(id int64, doc any) *Value {
+		return &Value{Value: map[FieldID]any{common.RowIDField: id, common.TimeStampField: int64(1), 100: doc}}
+	}
+	rec, err := ValueSerializer([]*Value{
+		newValue(1, []byte(`{"a":[1,2]}`)),
+		newValue(2, []byte(`null`)),
+		newValue(3, nil),
+	}, schema)
+	require.NoError(t, err)
+	defer rec.Release()
+
+	v := make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, true))
+	assert.Equal(t, []byte(`{"a":[1,2]}`), v[0].Value.(map[FieldID]any)[100])
+
+	v = make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, true, WithRawJSON()))
+	docs := lo.Map(v, func(v *Value, _ int) any { return v.Value.(map[FieldID]any)[100] })
+	assert.Equal(t, []any{json.RawMessage(`{"a":[1,2]}`), json.RawMessage(`null`), nil}, docs)
+	// the documents are embedded as is
+	encoded, err := json.Marshal(docs)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"a":[1,2]},null,null]`, string(encoded))
+
+	// the raw messages serialize back
+	again, err := ValueSerializer(v, schema)
+	require.NoError(t, err)
+	defer again.Release()
+	assert.Equal(t, 2, again.Column(100).Len()-again.Column(100).NullN())
+}
+
+// newInternTestRecord returns a record of n rows of a VarChar tag field of distinct
+// values and a VarChar name field of a distinct value per row.
+func newInternTestRecord(n, distinct int) (*schemapb.CollectionSchema, Record, error) {
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "tag", DataType: schemapb.DataType_VarChar, Nullable: true},
+		{FieldID: 101, Name: "name", DataType: schemapb.DataType_VarChar},
+	}}
+	values := make([]*Value, n)
+	for i := range values {
+		var tag any = fmt.Sprintf("tag-%d", i%distinct)
+		if i%7 == 6 {
+			tag = nil
+		}
+		values[i] = &Value{Value: map[FieldID]any{
+			common.RowIDField: int64(i), common.TimeStampField: int64(1), 100: tag, 101: fmt.Sprintf("name-%d", i),
+		}}
+	}
+	rec, err := ValueSerializer(values, schema)
+	return schema, rec, err
+}
+
+func TestStringInterning(t *testing.T) {
+	schema, rec, err := newInternTestRecord(20, 3)
+	require.NoError(t, err)
+	defer rec.Release()
+	column := func(v []*Value, fieldID FieldID) []any {
+		return lo.Map(v, func(v *Value, _ int) any { return v.Value.(map[FieldID]any)[fieldID] })
+	}
+	plain := make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, plain, schema, true))
+
+	for _, shouldCopy := range []bool{true, false} {
+		interner := NewStringInterner(4)
+		v := make([]*Value, rec.Len())
+		require.NoError(t, ValueDeserializerWithSchema(rec, v, schema, shouldCopy, WithStringInterning(interner, 100, 101)))
+		assert.Equal(t, column(plain, 100), column(v, 100))
+		assert.Equal(t, column(plain, 101), column(v, 101))
+		// the equal tags share their backing string
+		tags := column(v, 100)
+		assert.Equal(t, unsafe.StringData(tags[0].(string)), unsafe.StringData(tags[3].(string)))
+		distinct, enabled := interner.Distinct(100)
+		assert.Equal(t, 3, distinct)
+		assert.True(t, enabled)
+		// interning is disabled for the names past the cap
+		distinct, enabled = interner.Distinct(101)
+		assert.Equal(t, 4, distinct)
+		assert.False(t, enabled)
+	}
+
+	// the table is shared across the batches
+	interner := NewStringInterner(4)
+	first := make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, first, schema, true, WithStringInterning(interner, 100)))
+	second := make([]*Value, rec.Len())
+	require.NoError(t, ValueDeserializerWithSchema(rec, second, schema, true, WithStringInterning(interner, 100)))
+	assert.Equal(t, unsafe.StringData(column(first, 100)[0].(string)), unsafe.StringData(column(second, 100)[0].(string)))
+
+	err = ValueDeserializerWithSchema(rec, make([]*Value, rec.Len()), schema, true, WithStringInterning(NewStringInterner(4), common.RowIDField))
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func BenchmarkStringInterning(b *testing.B) {
+	schema, rec, err := newInternTestRecord(4096, 8)
+	require.NoError(b, err)
+	defer rec.Release()
+	for _, interning := range []bool{false, true} {
+		b.Run(fmt.Sprintf("interning=%t", interning), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var opts []ValueDeserializerOption
+				if interning {
+					opts = append(opts, WithStringInterning(NewStringInterner(64), 100))
+				}
+				v := make([]*Value, rec.Len())
+				if err := ValueDeserializerWithSchema(rec, v, schema, true, opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordToValues(t *testing.T) {
+	schema := generateTestSchema()
+	blobs, err := generateTestData(5)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+
+	rec, err := ValueSerializer(values, schema)
+	require.NoError(t, err)
+	got, err := RecordToValues(rec, schema, common.RowIDField)
+	rec.Release()
+	require.NoError(t, err)
+	require.Len(t, got, len(values))
+	for i, v := range got {
+		assert.Equal(t, values[i].ID, v.ID)
+		assert.Equal(t, values[i].Timestamp, v.Timestamp)
+		assert.True(t, values[i].PK.EQ(v.PK))
+		for _, fieldID := range []FieldID{13, 16, 101, 102} {
+			assert.Equal(t, values[i].Value.(map[FieldID]any)[fieldID], v.Value.(map[FieldID]any)[fieldID])
+		}
+	}
+
+	rec, err = ValueSerializer(values, schema)
+	require.NoError(t, err)
+	defer rec.Release()
+	_, err = RecordToValues(rec, schema, 13)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = RecordToValues(rec, schema, 999)
+	assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+}
@@ -15,3 +15,988 @@
 // limitations under the License.
 
 package storage
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"math/rand"
+	"reflect"
+	"sort"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
+)
+
+// NewPackedDeserializeReader reads the values written by NewPackedSerializeWriter,
+// paths holds the column group files of each chunk in order.
+//
+// The files may have been written with an older schema of the collection: the fields of
+// schema the files do not hold are read as their default value, or as null without one.
+// A field missing from the files that is neither nullable nor has a default value fails,
+// and so do chunks holding other fields than the first chunk. The fields the files store
+// dictionary-encoded, see WithDictionaryEncoding, are read as such.
+func NewPackedDeserializeReader(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	readSchema := schema
+	var readOpts []PackedReaderOption
+	if len(paths) > 0 {
+		dictionary, missing, err := packedChunkFields(paths, schema, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(dictionary) > 0 {
+			readOpts = append(readOpts, WithDictionaryReads(dictionary...))
+		}
+		if len(missing) > 0 {
+			stored := typeutil.NewSet[int64]()
+			for _, field := range typeutil.GetAllFieldSchemas(schema) {
+				stored.Insert(field.GetFieldID())
+			}
+			for _, field := range missing {
+				stored.Remove(field.GetFieldID())
+			}
+			readSchema = projectSchema(schema, stored)
+			opts = append(opts[:len(opts):len(opts)], withMissingFields(missing))
+		}
+	}
+	options := &valueDeserializerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.partials != nil && options.dropDeleted {
+		return nil, merr.WrapErrParameterInvalidMsg("rows deleted are dropped by the timestamp before the partial updates are merged")
+	}
+	if r := options.tsRange; r != nil {
+		if options.partials != nil {
+			return nil, merr.WrapErrParameterInvalidMsg("rows out of the timestamp range are dropped before the partial updates are merged")
+		}
+		if r.min > r.max {
+			return nil, merr.WrapErrParameterInvalidMsg("invalid timestamp range [%d, %d] of packed reader", r.min, r.max)
+		}
+		readOpts = append(readOpts, WithTimestampRange(r.cm, r.min, r.max))
+	}
+	if options.ctx != nil {
+		readOpts = append(readOpts, WithReadContext(options.ctx))
+	}
+	var reader RecordReader = newIterativePackedRecordReader(paths, readSchema, bufferSize, nil, nil, readOpts...)
+	if options.dropDeleted {
+		pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+		if options.deletes == nil || err != nil {
+			reader.Close()
+			return nil, merr.WrapErrParameterInvalidMsg("rows deleted are dropped by the primary key with the deletes of WithDeletes")
+		}
+		reader = newFilterRecordReader(reader, typeutil.GetAllFieldSchemas(readSchema), &deleteFilter{
+			pkFieldID: pkField.GetFieldID(),
+			deletes:   options.deletes,
+		})
+	}
+	deser := NewDeserializeReader(reader, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, shouldCopy, opts...)
+	})
+	deser.reuse = options.reuse
+	if options.partials != nil {
+		deser.tail = func() ([]*Value, error) {
+			return options.partials.orphans(options.incompletePartials)
+		}
+	}
+	return deser, nil
+}
+
+// NewPackedDeserializeReaderAuto is NewPackedDeserializeReader for segments whose
+// collection schema is unavailable, the schema is inferred with ReadPackedFields from the
+// files of the first chunk, the primary key from the field flagged as such by
+// ConvertToArrowSchema. Files without the field metadata or without a primary key fail.
+func NewPackedDeserializeReaderAuto(paths [][]string, bufferSize int64, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	if len(paths) == 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("no packed files to infer the schema from")
+	}
+	fields, err := ReadPackedFields(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	schema := &schemapb.CollectionSchema{Fields: fields}
+	if _, err := typeutil.GetPrimaryFieldSchema(schema); err != nil {
+		return nil, merr.WrapErrParameterInvalidMsg("no primary key recorded in packed files %v", paths[0])
+	}
+	return NewPackedDeserializeReader(paths, schema, bufferSize, shouldCopy, opts...)
+}
+
+// NewPackedDeserializeReaderWithDeletes is NewPackedDeserializeReader with
+// WithDeletes(deletes) and WithDropDeleted, omitting the rows deleted in deletes. The
+// primary key of schema must be pkFieldID.
+func NewPackedDeserializeReaderWithDeletes(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, pkFieldID FieldID, deletes *DeleteSet, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+	if err != nil || pkField.GetFieldID() != pkFieldID {
+		return nil, merr.WrapErrParameterInvalidMsg("field %d is not the primary key of collection schema [%s]", pkFieldID, schema.GetName())
+	}
+	opts = append(opts[:len(opts):len(opts)], WithDeletes(deletes), WithDropDeleted())
+	return NewPackedDeserializeReader(paths, schema, bufferSize, shouldCopy, opts...)
+}
+
+// NewPackedPKLookupReader is NewPackedDeserializeReader returning only the rows whose
+// primary key in pkFieldID is one of pks, for multi-gets of a set of keys. The primary
+// key column of every batch is matched against a hash set of pks, int64 keys straight on
+// the arrow buffer, and only the matching rows are materialized into values. The read
+// stops at the end of the batch in which the last of pks was found, so for segments
+// holding several versions of a key the versions in later batches are not returned.
+func NewPackedPKLookupReader(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, pkFieldID FieldID, pks []PrimaryKey, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	if err := rejectPartialUpdates(opts); err != nil {
+		return nil, err
+	}
+	filter := &pkLookupFilter{
+		pkFieldID: pkFieldID,
+		int64PKs:  make(map[int64]struct{}),
+		stringPKs: make(map[string]struct{}),
+	}
+	for _, pk := range pks {
+		switch pk.Type() {
+		case schemapb.DataType_Int64:
+			filter.int64PKs[pk.GetValue().(int64)] = struct{}{}
+		case schemapb.DataType_VarChar:
+			filter.stringPKs[pk.GetValue().(string)] = struct{}{}
+		default:
+			return nil, merr.WrapErrParameterInvalidMsg("unsupported primary key type %s", pk.Type())
+		}
+	}
+	filter.remaining = len(filter.int64PKs) + len(filter.stringPKs)
+	reader := newFilterRecordReader(newIterativePackedRecordReader(paths, schema, bufferSize, nil, nil),
+		typeutil.GetAllFieldSchemas(schema), filter)
+	return NewDeserializeReader(reader, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, shouldCopy, opts...)
+	}), nil
+}
+
+// pkLookupFilter keeps the rows whose primary key is one of the looked up keys, and is
+// done once all were found.
+type pkLookupFilter struct {
+	pkFieldID FieldID
+	int64PKs  map[int64]struct{}
+	stringPKs map[string]struct{}
+	// found are the keys found so far, remaining the number of keys not found yet.
+	foundInt64  map[int64]struct{}
+	foundString map[string]struct{}
+	remaining   int
+}
+
+func (lr *pkLookupFilter) done() bool {
+	return lr.remaining == 0
+}
+
+func (lr *pkLookupFilter) keepRows(rec Record) ([]bool, int, error) {
+	keep := make([]bool, rec.Len())
+	kept := 0
+	switch pkCol := rec.Column(lr.pkFieldID).(type) {
+	case *array.Int64:
+		if lr.foundInt64 == nil {
+			lr.foundInt64 = make(map[int64]struct{})
+		}
+		for i, pk := range pkCol.Int64Values() {
+			if _, ok := lr.int64PKs[pk]; !ok {
+				continue
+			}
+			keep[i] = true
+			kept++
+			if _, ok := lr.foundInt64[pk]; !ok {
+				lr.foundInt64[pk] = struct{}{}
+				lr.remaining--
+			}
+		}
+	case *array.String:
+		if lr.foundString == nil {
+			lr.foundString = make(map[string]struct{})
+		}
+		for i := 0; i < pkCol.Len(); i++ {
+			pk := pkCol.Value(i)
+			if _, ok := lr.stringPKs[pk]; !ok {
+				continue
+			}
+			keep[i] = true
+			kept++
+			if _, ok := lr.foundString[pk]; !ok {
+				lr.foundString[pk] = struct{}{}
+				lr.remaining--
+			}
+		}
+	default:
+		return nil, 0, merr.WrapErrServiceInternal(fmt.Sprintf("unsupported pk column type %s", pkCol.DataType()))
+	}
+	return keep, kept, nil
+}
+
+// NewPackedDeserializeReaderPaged is NewPackedDeserializeReader skipping the first offset
+// rows and returning at most limit rows after them, for paginated scans of raw segments.
+// pkFieldID must be the primary key of schema. The chunks wholly within the offset are
+// skipped by the row counts of their footers, without reading them. The chunk the page
+// starts in is read from the row group holding its first row on, seeking to it by the
+// footer, if stored in a single column group file, else the rows of its row groups before
+// the page are decoded and skipped. Only the rows of the page are materialized into
+// values. The read returns io.EOF once limit rows were returned.
+func NewPackedDeserializeReaderPaged(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, pkFieldID FieldID, offset, limit int64, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	if err := rejectPartialUpdates(opts); err != nil {
+		return nil, err
+	}
+	if offset < 0 || limit < 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("invalid page of packed reader with offset %d and limit %d", offset, limit)
+	}
+	pkField := typeutil.GetField(schema, pkFieldID)
+	if pkField == nil {
+		return nil, merr.WrapErrFieldNotFound(pkFieldID)
+	}
+	if !pkField.GetIsPrimaryKey() {
+		return nil, merr.WrapErrParameterInvalidMsg("field %d of paged packed reader is not the primary key", pkFieldID)
+	}
+	arrowSchema, err := ConvertToArrowSchema(schema, true)
+	if err != nil {
+		return nil, merr.WrapErrParameterInvalid("convert collection schema [%s] to arrow schema error: %s", schema.Name, err.Error())
+	}
+	reader := &pagedRecordReader{
+		paths:       paths,
+		schema:      schema,
+		arrowSchema: arrowSchema,
+		bufferSize:  bufferSize,
+		offset:      offset,
+		limit:       limit,
+	}
+	return NewDeserializeReader(reader, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, shouldCopy, opts...)
+	}), nil
+}
+
+// NewPackedDeserializeReaderWithRange is NewPackedDeserializeReaderPaged over the primary
+// key of schema, returning the rows in [offset, offset+limit) of the segment, for previews
+// and samples of its first rows. It returns io.EOF once limit rows were returned, Close
+// closes the files read then still.
+func NewPackedDeserializeReaderWithRange(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, offset, limit int64, shouldCopy bool, opts ...ValueDeserializerOption,
+) (*DeserializeReaderImpl[*Value], error) {
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return NewPackedDeserializeReaderPaged(paths, schema, bufferSize, pkField.GetFieldID(), offset, limit, shouldCopy, opts...)
+}
+
+// pagedRecordReader returns the rows of the chunks at paths after the first offset rows,
+// limit rows at most.
+type pagedRecordReader struct {
+	paths  [][]string
+	schema *schemapb.CollectionSchema
+	// arrowSchema opens the footers of the row groups to seek to.
+	arrowSchema *arrow.Schema
+	bufferSize  int64
+	// offset is the number of rows left to skip, limit the number of rows left to return.
+	offset int64
+	limit  int64
+	// chunk is the next chunk to open, cur the reader of the chunk read.
+	chunk int
+	cur   RecordReader
+	// sliced is the slice of a record returned last, released on the next read.
+	sliced Record
+}
+
+var _ RecordReader = (*pagedRecordReader)(nil)
+
+func (pr *pagedRecordReader) Next() (Record, error) {
+	pr.releaseSliced()
+	for pr.limit > 0 {
+		if pr.cur == nil {
+			if pr.chunk >= len(pr.paths) {
+				return nil, io.EOF
+			}
+			paths := pr.paths[pr.chunk]
+			pr.chunk++
+			var opts []PackedReaderOption
+			if pr.offset > 0 {
+				// the column group files of a chunk hold the same rows
+				rows, err := packed.GetFileRowCount(paths[0], nil)
+				if err != nil {
+					return nil, merr.WrapErrIoFailed(paths[0], err)
+				}
+				if rows <= pr.offset {
+					pr.offset -= rows
+					continue
+				}
+				if len(paths) == 1 {
+					first, skipped, count, err := pr.seekRowGroup(paths[0])
+					if err != nil {
+						return nil, err
+					}
+					pr.offset -= skipped
+					opts = append(opts, WithRowGroupRange(first, count))
+				}
+			}
+			reader, err := newPackedRecordReader(paths, pr.schema, pr.bufferSize, nil, nil, opts...)
+			if err != nil {
+				return nil, err
+			}
+			pr.cur = reader
+		}
+		rec, err := pr.cur.Next()
+		if err == io.EOF {
+			err = pr.cur.Close()
+			pr.cur = nil
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows := int64(rec.Len())
+		if pr.offset >= rows {
+			pr.offset -= rows
+			continue
+		}
+		start := pr.offset
+		end := min(rows, start+pr.limit)
+		pr.offset = 0
+		pr.limit -= end - start
+		if start == 0 && end == rows {
+			return rec, nil
+		}
+		sar := rec.(*simpleArrowRecord)
+		pr.sliced = NewSimpleArrowRecord(sar.r.NewSlice(start, end), sar.field2Col)
+		return pr.sliced, nil
+	}
+	return nil, io.EOF
+}
+
+// seekRowGroup returns the row group of the single column group file path holding the row
+// at the offset left to skip, the rows of the row groups before it and the number of row
+// groups from it on.
+func (pr *pagedRecordReader) seekRowGroup(path string) (int, int64, int, error) {
+	groupRows, err := rowGroupNumRows(path, pr.arrowSchema, pr.bufferSize, nil, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var skipped int64
+	for g, rows := range groupRows {
+		if skipped+rows > pr.offset {
+			return g, skipped, len(groupRows) - g, nil
+		}
+		skipped += rows
+	}
+	return len(groupRows), skipped, 0, nil
+}
+
+func (pr *pagedRecordReader) releaseSliced() {
+	if pr.sliced != nil {
+		pr.sliced.Release()
+		pr.sliced = nil
+	}
+}
+
+func (pr *pagedRecordReader) Close() error {
+	pr.releaseSliced()
+	if pr.cur != nil {
+		err := pr.cur.Close()
+		pr.cur = nil
+		return err
+	}
+	return nil
+}
+
+// SampleReaderOption configures NewPackedSampleReader.
+type SampleReaderOption func(*sampleReaderOptions)
+
+type sampleReaderOptions struct {
+	seed      int64
+	seeded    bool
+	deserOpts []ValueDeserializerOption
+}
+
+// WithSampleSeed seeds the random source of the sample, the same seed drawing the same
+// sample of the same segment. Without it the seed is random.
+func WithSampleSeed(seed int64) SampleReaderOption {
+	return func(o *sampleReaderOptions) {
+		o.seed = seed
+		o.seeded = true
+	}
+}
+
+// WithSampleDeserializerOptions passes opts to the deserialization of the sampled rows.
+func WithSampleDeserializerOptions(opts ...ValueDeserializerOption) SampleReaderOption {
+	return func(o *sampleReaderOptions) {
+		o.deserOpts = append(o.deserOpts, opts...)
+	}
+}
+
+// NewPackedSampleReader returns a uniformly random sample of sampleSize values of the
+// segment at paths, or all of its values if it holds fewer rows, sorted by pkFieldID.
+// The segment is read once on the first NextValue with reservoir sampling: only the rows
+// entering the sample are materialized into values, so the memory held is sampleSize
+// values and a single record of the segment.
+func NewPackedSampleReader(paths [][]string, schema *schemapb.CollectionSchema, bufferSize int64,
+	pkFieldID FieldID, sampleSize int, opts ...SampleReaderOption,
+) (DeserializeReader[*Value], error) {
+	if sampleSize <= 0 {
+		return nil, merr.WrapErrParameterInvalidMsg("sample size of packed reader must be positive, got %d", sampleSize)
+	}
+	pkField := typeutil.GetField(schema, pkFieldID)
+	if pkField == nil {
+		return nil, merr.WrapErrFieldNotFound(pkFieldID)
+	}
+	if !pkField.GetIsPrimaryKey() {
+		return nil, merr.WrapErrParameterInvalidMsg("field %d of sample packed reader is not the primary key", pkFieldID)
+	}
+	options := &sampleReaderOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if err := rejectPartialUpdates(options.deserOpts); err != nil {
+		return nil, err
+	}
+	if !options.seeded {
+		options.seed = rand.Int63()
+	}
+	return &packedSampleReader{
+		inner:      newIterativePackedRecordReader(paths, schema, bufferSize, nil, nil),
+		schema:     schema,
+		fields:     typeutil.GetAllFieldSchemas(schema),
+		sampleSize: sampleSize,
+		rng:        rand.New(rand.NewSource(options.seed)),
+		deserOpts:  options.deserOpts,
+	}, nil
+}
+
+// packedSampleReader draws a sample of the records of inner with Algorithm R.
+type packedSampleReader struct {
+	inner      RecordReader
+	schema     *schemapb.CollectionSchema
+	fields     []*schemapb.FieldSchema
+	sampleSize int
+	rng        *rand.Rand
+	deserOpts  []ValueDeserializerOption
+
+	// seen is the number of rows read so far, sample the values drawn from them.
+	seen   int64
+	sample []*Value
+	loaded bool
+}
+
+var _ DeserializeReader[*Value] = (*packedSampleReader)(nil)
+
+func (sr *packedSampleReader) NextValue() (**Value, error) {
+	if !sr.loaded {
+		if err := sr.load(); err != nil {
+			return nil, err
+		}
+	}
+	if len(sr.sample) == 0 {
+		return nil, io.EOF
+	}
+	v := sr.sample[0]
+	sr.sample = sr.sample[1:]
+	return &v, nil
+}
+
+func (sr *packedSampleReader) load() error {
+	sr.sample = make([]*Value, 0, sr.sampleSize)
+	for {
+		rec, err := sr.inner.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := sr.sampleRecord(rec); err != nil {
+			return err
+		}
+	}
+	sort.Slice(sr.sample, func(i, j int) bool {
+		return sr.sample[i].PK.LT(sr.sample[j].PK)
+	})
+	sr.loaded = true
+	return nil
+}
+
+// sampleRecord draws the rows of rec into the sample, a row replacing the value of a
+// slot drawn uniformly once the sample is full. The rows drawn are filtered out of rec and
+// deserialized at once, a slot drawn twice within rec holds the later row.
+func (sr *packedSampleReader) sampleRecord(rec Record) error {
+	// slots are the sample slots drawn by the rows of rec, -1 for rows not drawn
+	// or drawn but overwritten within rec.
+	slots := make([]int, rec.Len())
+	rowOfSlot := make(map[int]int)
+	filled := len(sr.sample)
+	for i := range slots {
+		slots[i] = -1
+		slot := int64(filled)
+		if sr.seen < int64(sr.sampleSize) {
+			filled++
+		} else {
+			slot = sr.rng.Int63n(sr.seen + 1)
+		}
+		sr.seen++
+		if slot >= int64(sr.sampleSize) {
+			continue
+		}
+		if prev, ok := rowOfSlot[int(slot)]; ok {
+			slots[prev] = -1
+		}
+		rowOfSlot[int(slot)] = i
+		slots[i] = int(slot)
+	}
+	if len(rowOfSlot) == 0 {
+		return nil
+	}
+	keep := make([]bool, rec.Len())
+	for _, row := range rowOfSlot {
+		keep[row] = true
+	}
+	filtered, err := filterRecordRows(rec, sr.fields, keep, len(rowOfSlot))
+	if err != nil {
+		return err
+	}
+	defer filtered.Release()
+	values := make([]*Value, filtered.Len())
+	if err := ValueDeserializerWithSchema(filtered, values, sr.schema, true, sr.deserOpts...); err != nil {
+		return err
+	}
+	sr.sample = sr.sample[:filled]
+	next := 0
+	for _, slot := range slots {
+		if slot < 0 {
+			continue
+		}
+		sr.sample[slot] = values[next]
+		next++
+	}
+	return nil
+}
+
+func (sr *packedSampleReader) Close() error {
+	sr.sample = nil
+	return sr.inner.Close()
+}
+
+// DiffPackedSegments compares two versions of a segment, both sorted by pkFieldID, and
+// yields the values of the new version whose primary key is missing in the old version
+// or whose payload differs, for incremental re-indexing. Rows only in the old version are
+// not reported. The system fields other than the primary key are not compared, so a row
+// rewritten with the same payload at a newer timestamp is not a change.
+func DiffPackedSegments(oldPaths, newPaths [][]string, schema *schemapb.CollectionSchema,
+	pkFieldID FieldID, opts ...ValueDeserializerOption,
+) iter.Seq2[*Value, error] {
+	return func(yield func(*Value, error) bool) {
+		pkField := typeutil.GetField(schema, pkFieldID)
+		if pkField == nil {
+			yield(nil, merr.WrapErrFieldNotFound(pkFieldID))
+			return
+		}
+		pkOf := func(v *Value) (PrimaryKey, error) {
+			return GenPrimaryKeyByRawData(v.Value.(map[FieldID]any)[pkFieldID], pkField.GetDataType())
+		}
+
+		oldReader, err := NewPackedDeserializeReader(oldPaths, schema, packed.DefaultReadBufferSize, true, opts...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer oldReader.Close()
+		newReader, err := NewPackedDeserializeReader(newPaths, schema, packed.DefaultReadBufferSize, true, opts...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer newReader.Close()
+
+		var oldValue *Value
+		var oldPK PrimaryKey
+		nextOld := func() error {
+			v, err := oldReader.NextValue()
+			if err == io.EOF {
+				oldValue, oldPK = nil, nil
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			oldValue = *v
+			oldPK, err = pkOf(oldValue)
+			return err
+		}
+		if err := nextOld(); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		for {
+			v, err := newReader.NextValue()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			newValue := *v
+			newPK, err := pkOf(newValue)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for oldValue != nil && oldPK.LT(newPK) {
+				if err := nextOld(); err != nil {
+					yield(nil, err)
+					return
+				}
+			}
+			if oldValue != nil && oldPK.EQ(newPK) && payloadEqual(oldValue, newValue, pkFieldID) {
+				continue
+			}
+			if !yield(newValue, nil) {
+				return
+			}
+		}
+	}
+}
+
+// payloadEqual tells whether two values hold the same user fields.
+func payloadEqual(a, b *Value, pkFieldID FieldID) bool {
+	am, bm := a.Value.(map[FieldID]any), b.Value.(map[FieldID]any)
+	for fieldID, av := range am {
+		if fieldID != pkFieldID && common.IsSystemField(fieldID) {
+			continue
+		}
+		bv, ok := bm[fieldID]
+		if !ok {
+			return false
+		}
+		ap, aok := av.(proto.Message)
+		bp, bok := bv.(proto.Message)
+		if aok && bok {
+			if !proto.Equal(ap, bp) {
+				return false
+			}
+		} else if !reflect.DeepEqual(av, bv) {
+			return false
+		}
+	}
+	return len(am) == len(bm)
+}
+
+// NewPackedLatestPerPKReader reads the values written by NewPackedSerializeWriter keeping
+// only the newest version, by timestamp, of every primary key in pkFieldID, i.e. resolving
+// upserts at read time. Versions of equal timestamps resolve to the one read last.
+//
+// If sorted is set the files must be sorted by primary key and then timestamp, the values
+// are streamed holding one value ahead. Otherwise the whole scan is drained into memory on
+// the first NextValue, holding one value per distinct primary key, and the values are
+// returned in the order their primary key was first read.
+func NewPackedLatestPerPKReader(paths [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, pkFieldID FieldID, sorted bool, opts ...ValueDeserializerOption,
+) (DeserializeReader[*Value], error) {
+	// the values are held across batches
+	inner, err := NewPackedDeserializeReader(paths, schema, bufferSize, true, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pkOf := func(v *Value) any {
+		return v.Value.(map[FieldID]any)[pkFieldID]
+	}
+	return &latestPerPKReader{inner: inner, pkOf: pkOf, sorted: sorted}, nil
+}
+
+// DedupReader removes the duplicate primary keys of the values of a segment, keeping the
+// newest version of each, see NewDedupReader.
+type DedupReader struct {
+	*latestPerPKReader
+}
+
+// NewDedupReader removes the duplicate primary keys of the values of reader, keeping the
+// value of the newest timestamp per primary key, for compaction to drop the duplicates
+// written to a segment before it. Values of equal timestamps resolve to the one read last.
+// The values are keyed by Value.PK, so reader may be any reader of a segment, but its
+// values must stay valid across batches, e.g. deserialized with shouldCopy set.
+//
+// If sorted is set the values must be sorted by primary key, as the binlogs of a sorted
+// segment are, and are streamed holding one value ahead. Otherwise every value is
+// buffered on the first NextValue, since any later value may duplicate it: the memory
+// cost is one value per distinct primary key, i.e. the deduplicated segment.
+func NewDedupReader(reader DeserializeReader[*Value], sorted bool) *DedupReader {
+	pkOf := func(v *Value) any {
+		return v.PK.GetValue()
+	}
+	return &DedupReader{&latestPerPKReader{inner: reader, pkOf: pkOf, sorted: sorted}}
+}
+
+// Duplicates returns the number of duplicate values removed so far.
+func (dr *DedupReader) Duplicates() int64 {
+	return dr.duplicates
+}
+
+type latestPerPKReader struct {
+	inner  DeserializeReader[*Value]
+	pkOf   func(v *Value) any
+	sorted bool
+	// duplicates counts the values superseded by a newer version.
+	duplicates int64
+
+	// next is the value read ahead in the sorted case.
+	next *Value
+	done bool
+
+	// values are the resolved values of the unsorted case.
+	values []*Value
+	loaded bool
+}
+
+var _ DeserializeReader[*Value] = (*latestPerPKReader)(nil)
+
+func (lr *latestPerPKReader) read() (*Value, error) {
+	v, err := lr.inner.NextValue()
+	if err != nil {
+		return nil, err
+	}
+	return *v, nil
+}
+
+func (lr *latestPerPKReader) NextValue() (**Value, error) {
+	if lr.sorted {
+		return lr.nextSorted()
+	}
+	if !lr.loaded {
+		if err := lr.load(); err != nil {
+			return nil, err
+		}
+	}
+	if len(lr.values) == 0 {
+		return nil, io.EOF
+	}
+	v := lr.values[0]
+	lr.values = lr.values[1:]
+	return &v, nil
+}
+
+func (lr *latestPerPKReader) nextSorted() (**Value, error) {
+	if lr.done {
+		return nil, io.EOF
+	}
+	latest := lr.next
+	if latest == nil {
+		v, err := lr.read()
+		if err != nil {
+			return nil, err
+		}
+		latest = v
+	}
+	pk := lr.pkOf(latest)
+	for {
+		v, err := lr.read()
+		if err == io.EOF {
+			lr.next, lr.done = nil, true
+			return &latest, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if lr.pkOf(v) != pk {
+			lr.next = v
+			return &latest, nil
+		}
+		lr.duplicates++
+		if v.Timestamp >= latest.Timestamp {
+			latest = v
+		}
+	}
+}
+
+func (lr *latestPerPKReader) load() error {
+	index := make(map[any]int)
+	for {
+		v, err := lr.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pk := lr.pkOf(v)
+		if i, ok := index[pk]; ok {
+			lr.duplicates++
+			if v.Timestamp >= lr.values[i].Timestamp {
+				lr.values[i] = v
+			}
+			continue
+		}
+		index[pk] = len(lr.values)
+		lr.values = append(lr.values, v)
+	}
+	lr.loaded = true
+	return nil
+}
+
+func (lr *latestPerPKReader) Close() error {
+	lr.values = nil
+	return lr.inner.Close()
+}
+
+// rowFilter selects the rows of the records read by a filterRecordReader.
+type rowFilter interface {
+	// keepRows returns the rows of rec to keep and their number.
+	keepRows(rec Record) (keep []bool, kept int, err error)
+	// done tells the reader to stop before reading the next record, once no record left
+	// can hold a row to keep.
+	done() bool
+}
+
+// filterRecordReader keeps the rows of the records of inner selected by filter, the
+// records without a kept row are skipped.
+type filterRecordReader struct {
+	inner  RecordReader
+	fields []*schemapb.FieldSchema
+	filter rowFilter
+	// cur is the last filtered record built by the reader.
+	cur Record
+}
+
+var _ RecordReader = (*filterRecordReader)(nil)
+
+func newFilterRecordReader(inner RecordReader, fields []*schemapb.FieldSchema, filter rowFilter) *filterRecordReader {
+	return &filterRecordReader{inner: inner, fields: fields, filter: filter}
+}
+
+func (fr *filterRecordReader) Next() (Record, error) {
+	if fr.cur != nil {
+		fr.cur.Release()
+		fr.cur = nil
+	}
+	for {
+		if fr.filter.done() {
+			return nil, io.EOF
+		}
+		rec, err := fr.inner.Next()
+		if err != nil {
+			return nil, err
+		}
+		keep, kept, err := fr.filter.keepRows(rec)
+		if err != nil {
+			return nil, err
+		}
+		if kept == rec.Len() {
+			return rec, nil
+		}
+		if kept == 0 {
+			continue
+		}
+		filtered, err := filterRecordRows(rec, fr.fields, keep, kept)
+		if err != nil {
+			return nil, err
+		}
+		fr.cur = filtered
+		return filtered, nil
+	}
+}
+
+func (fr *filterRecordReader) Close() error {
+	if fr.cur != nil {
+		fr.cur.Release()
+		fr.cur = nil
+	}
+	return fr.inner.Close()
+}
+
+// deleteFilter drops the deleted rows.
+type deleteFilter struct {
+	pkFieldID FieldID
+	deletes   *DeleteSet
+}
+
+func (dr *deleteFilter) done() bool {
+	return false
+}
+
+func (dr *deleteFilter) keepRows(rec Record) ([]bool, int, error) {
+	tsCol, ok := rec.Column(common.TimeStampField).(*array.Int64)
+	if !ok {
+		return nil, 0, merr.WrapErrServiceInternal("timestamp column is not int64")
+	}
+	var pkAt func(i int) any
+	switch pkCol := rec.Column(dr.pkFieldID).(type) {
+	case *array.Int64:
+		pkAt = func(i int) any { return pkCol.Value(i) }
+	case *array.String:
+		pkAt = func(i int) any { return pkCol.Value(i) }
+	default:
+		return nil, 0, merr.WrapErrServiceInternal(fmt.Sprintf("unsupported pk column type %s", pkCol.DataType()))
+	}
+	keep := make([]bool, rec.Len())
+	kept := 0
+	for i := range keep {
+		keep[i] = !dr.deletes.IsDeleted(pkAt(i), Timestamp(tsCol.Value(i)))
+		if keep[i] {
+			kept++
+		}
+	}
+	return keep, kept, nil
+}
+
+// filterRecordRows builds a record of the kept rows of rec, the kept runs are sliced
+// and concatenated per column.
+func filterRecordRows(rec Record, fields []*schemapb.FieldSchema, keep []bool, kept int) (Record, error) {
+	return filterRecordRowsWith(memory.DefaultAllocator, rec, fields, keep, kept)
+}
+
+// filterRecordRowsWith is filterRecordRows allocating the concatenated columns with mem.
+func filterRecordRowsWith(mem memory.Allocator, rec Record, fields []*schemapb.FieldSchema, keep []bool, kept int) (Record, error) {
+	type run struct{ start, end int }
+	var runs []run
+	for i := 0; i < len(keep); i++ {
+		if !keep[i] {
+			continue
+		}
+		start := i
+		for i < len(keep) && keep[i] {
+			i++
+		}
+		runs = append(runs, run{start, i})
+	}
+
+	arrays := make([]arrow.Array, 0, len(fields))
+	release := func() {
+		for _, arr := range arrays {
+			arr.Release()
+		}
+	}
+	for _, field := range fields {
+		col := rec.Column(field.FieldID)
+		pieces := make([]arrow.Array, len(runs))
+		for i, r := range runs {
+			pieces[i] = array.NewSlice(col, int64(r.start), int64(r.end))
+		}
+		if len(pieces) == 1 {
+			arrays = append(arrays, pieces[0])
+			continue
+		}
+		arr, err := array.Concatenate(pieces, mem)
+		for _, piece := range pieces {
+			piece.Release()
+		}
+		if err != nil {
+			release()
+			return nil, merr.WrapErrServiceInternal(fmt.Sprintf("concatenate column of field %d failed: %s", field.FieldID, err.Error()))
+		}
+		arrays = append(arrays, arr)
+	}
+	return newRecordFromArrays(fields, arrays, kept), nil
+}
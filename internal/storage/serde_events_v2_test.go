@@ -17,14 +17,32 @@
 package storage
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
 	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
 	"github.com/milvus-io/milvus/internal/util/initcore"
+	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
 )
 
 func TestPackedSerde(t *testing.T) {
@@ -86,3 +104,1292 @@ func TestPackedSerde(t *testing.T) {
 		assert.Equal(t, size*len(paths), nRows)
 	})
 }
+
+func TestPackedSerdeEmptySegment(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1}}, {GroupID: 1}}
+	for i := 2; i < len(schema.Fields); i++ {
+		groups[1].Columns = append(groups[1].Columns, i)
+	}
+	paths := []string{"/tmp/empty_segment/0", "/tmp/empty_segment/1"}
+	bufferSize := int64(10 * 1024 * 1024)
+
+	writer, err := NewPackedSerializeWriter("", paths, schema, bufferSize, 0, groups, 7)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	for _, p := range paths {
+		size, err := packed.GetFileSize(p, nil)
+		require.NoError(t, err)
+		assert.Greater(t, size, int64(0))
+	}
+
+	rows, err := CountRows(paths, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rows)
+
+	reader, err := newPackedRecordReader(paths, schema, bufferSize, nil, nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestPackedLargeStrings(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	size := 64
+	blobs, err := generateTestData(size)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	// 1MB varchar values
+	for i, v := range values {
+		v.Value.(map[FieldID]any)[16] = strings.Repeat(strconv.Itoa(i%10), 1<<20)
+	}
+	write := func(path string, opts ...PackedRecordWriterOption) error {
+		writer, err := NewPackedSerializeWriter("", []string{path}, schema, 256*1024*1024, 0, []storagecommon.ColumnGroup{group}, size, opts...)
+		require.NoError(t, err)
+		for _, v := range values {
+			if err := writer.WriteValue(v); err != nil {
+				return err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			writer.Abort()
+			return err
+		}
+		return nil
+	}
+	// batches of more than 32MB of varchar exceed the string offsets
+	stringOffsetLimit = 32 << 20
+	defer func() { stringOffsetLimit = math.MaxInt32 }()
+
+	path := "/tmp/large_strings/0"
+	require.NoError(t, write(path, WithLargeStringColumns()))
+	rr, err := newPackedRecordReader([]string{path}, schema, 256*1024*1024, nil, nil, WithLargeStringReads())
+	require.NoError(t, err)
+	deserializer := NewDeserializeReader(rr, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, true)
+	})
+	read, err := ReadAllValues(deserializer)
+	require.NoError(t, err)
+	require.Len(t, read, size)
+	for i, v := range read {
+		assert.Equal(t, values[i].Value.(map[FieldID]any)[16], v.Value.(map[FieldID]any)[16])
+		assert.Equal(t, values[i].Value.(map[FieldID]any)[17], v.Value.(map[FieldID]any)[17])
+	}
+
+	t.Run("without large string columns", func(t *testing.T) {
+		assert.ErrorIs(t, write("/tmp/large_strings/1"), merr.ErrParameterInvalid)
+	})
+}
+
+func TestPackedDeserializeReaderUpcast(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schemaOf := func(intType, floatType schemapb.DataType) *schemapb.CollectionSchema {
+		return &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+			{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "int", DataType: intType},
+			{FieldID: 101, Name: "float", DataType: floatType},
+		}}
+	}
+	written := schemaOf(schemapb.DataType_Int32, schemapb.DataType_Float)
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: []int{0, 1, 2, 3}}
+	paths := []string{"/tmp/packed_upcast/0"}
+	writer, err := NewPackedSerializeWriter("", paths, written, 1024*1024, 0, []storagecommon.ColumnGroup{group}, 7)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, writer.WriteValue(&Value{
+			ID: int64(i), PK: NewInt64PrimaryKey(int64(i)), Timestamp: 1,
+			Value: map[FieldID]any{common.RowIDField: int64(i), common.TimeStampField: int64(1), 100: int32(-i), 101: float32(i) + 0.5},
+		}))
+	}
+	require.NoError(t, writer.Close())
+
+	// the files written before the fields were widened read as the widened types
+	reader, err := NewPackedDeserializeReader([][]string{paths}, schemaOf(schemapb.DataType_Int64, schemapb.DataType_Double), 1024, true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	for i, v := range values {
+		assert.Equal(t, int64(-i), v.Value.(map[FieldID]any)[100])
+		assert.Equal(t, float64(i)+0.5, v.Value.(map[FieldID]any)[101])
+	}
+
+	// narrowing fails
+	reader, err = NewPackedDeserializeReader([][]string{paths}, schemaOf(schemapb.DataType_Int16, schemapb.DataType_Float), 1024, true)
+	if err == nil {
+		_, err = ReadAllValues(reader)
+	}
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedDictionaryEncoding(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	size := 20
+	blobs, err := generateTestData(size)
+	require.NoError(t, err)
+	reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	// a few labels repeating across the rows
+	for i, v := range values {
+		v.Value.(map[FieldID]any)[16] = []string{"tenant_a", "tenant_b", "tenant_c"}[i%3]
+	}
+
+	path := "/tmp/dictionary_encoding/0"
+	writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, 7,
+		WithDictionaryEncoding(16, 17))
+	require.NoError(t, err)
+	for _, v := range values {
+		require.NoError(t, writer.WriteValue(v))
+	}
+	require.NoError(t, writer.Close())
+
+	rr, err := newPackedRecordReader([]string{path}, schema, 10*1024*1024, nil, nil, WithDictionaryReads(16, 17))
+	require.NoError(t, err)
+	rec, err := rr.Next()
+	require.NoError(t, err)
+	assert.IsType(t, &array.Dictionary{}, rec.Column(16))
+	require.NoError(t, rr.Close())
+
+	rr, err = newPackedRecordReader([]string{path}, schema, 10*1024*1024, nil, nil, WithDictionaryReads(16, 17))
+	require.NoError(t, err)
+	deserializer := NewDeserializeReader(rr, func(r Record, v []*Value) error {
+		return ValueDeserializerWithSchema(r, v, schema, true)
+	})
+	read, err := ReadAllValues(deserializer)
+	require.NoError(t, err)
+	require.Len(t, read, size)
+	for i, v := range read {
+		assert.Equal(t, values[i].Value.(map[FieldID]any)[16], v.Value.(map[FieldID]any)[16], i)
+		assert.Equal(t, values[i].Value.(map[FieldID]any)[17], v.Value.(map[FieldID]any)[17], i)
+	}
+
+	// the dictionary columns are detected from the files
+	deser, err := NewPackedDeserializeReader([][]string{{path}}, schema, 10*1024*1024, true)
+	require.NoError(t, err)
+	detected, err := ReadAllValues(deser)
+	require.NoError(t, err)
+	require.Len(t, detected, size)
+	for i, v := range detected {
+		assert.Equal(t, values[i].Value.(map[FieldID]any)[16], v.Value.(map[FieldID]any)[16], i)
+	}
+	// the chunks of a segment are read with the encoding of the same fields
+	plain := "/tmp/dictionary_encoding/plain"
+	writePackedTestSegment(t, []string{plain}, size)
+	_, err = NewPackedDeserializeReader([][]string{{path}, {plain}}, schema, 10*1024*1024, true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+	// only string fields other than the primary key can be encoded
+	for _, fieldID := range []FieldID{10, common.RowIDField} {
+		_, err = NewPackedSerializeWriter("", []string{"/tmp/dictionary_encoding/1"}, schema, 1024, 0, []storagecommon.ColumnGroup{group}, 7,
+			WithDictionaryEncoding(fieldID))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid, fieldID)
+		_, err = newPackedRecordReader([]string{path}, schema, 1024, nil, nil, WithDictionaryReads(fieldID))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid, fieldID)
+	}
+}
+
+func TestPackedDynamicFieldRoundTrip(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := &schemapb.CollectionSchema{EnableDynamicField: true, Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: common.MetaFieldName, DataType: schemapb.DataType_JSON, IsDynamic: true, Nullable: true},
+	}}
+	docs := [][]byte{[]byte(`{"color":"red","n":1}`), nil, []byte(`{"tags":["a","b"]}`)}
+	path := "/tmp/dynamic_field/0"
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: lo.Range(len(schema.Fields))}
+	writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, 2)
+	require.NoError(t, err)
+	for i, doc := range docs {
+		value := &Value{ID: int64(i), PK: NewInt64PrimaryKey(int64(i)), Timestamp: 1, Value: map[FieldID]any{
+			common.RowIDField: int64(i), common.TimeStampField: int64(1), 100: doc,
+		}}
+		if doc == nil {
+			value.Value.(map[FieldID]any)[100] = nil
+		}
+		require.NoError(t, writer.WriteValue(value))
+	}
+	require.NoError(t, writer.Close())
+
+	read := func(opts ...ValueDeserializerOption) []any {
+		reader, err := NewPackedDeserializeReader([][]string{{path}}, schema, 10*1024*1024, true, opts...)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return lo.Map(values, func(v *Value, _ int) any { return v.Value.(map[FieldID]any)[100] })
+	}
+	assert.Equal(t, []any{docs[0], nil, docs[2]}, read())
+	assert.Equal(t, []any{
+		map[string]any{"color": "red", "n": float64(1)},
+		nil,
+		map[string]any{"tags": []any{"a", "b"}},
+	}, read(WithDecodedJSON()))
+}
+
+func TestPackedHalfAndSparseVectorRoundTrip(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	dim := []*commonpb.KeyValuePair{{Key: common.DimKey, Value: "4"}}
+	schema := &schemapb.CollectionSchema{Fields: []*schemapb.FieldSchema{
+		{FieldID: common.RowIDField, Name: "row_id", DataType: schemapb.DataType_Int64, IsPrimaryKey: true},
+		{FieldID: common.TimeStampField, Name: "ts", DataType: schemapb.DataType_Int64},
+		{FieldID: 100, Name: "f16", DataType: schemapb.DataType_Float16Vector, TypeParams: dim},
+		{FieldID: 101, Name: "bf16", DataType: schemapb.DataType_BFloat16Vector, TypeParams: dim},
+		{FieldID: 102, Name: "sparse", DataType: schemapb.DataType_SparseFloatVector},
+	}}
+	sparse := [][]byte{
+		typeutil.CreateSparseFloatRow([]uint32{1, 7, 1000}, []float32{0.5, -1, 3}),
+		typeutil.CreateSparseFloatRow(nil, nil),
+		typeutil.CreateSparseFloatRow([]uint32{math.MaxUint32 - 1}, []float32{2}),
+	}
+	values := lo.Map(sparse, func(row []byte, i int) *Value {
+		half := func(seed byte) []byte {
+			return []byte{seed, 1, seed, 2, seed, 3, seed, 4}
+		}
+		return &Value{ID: int64(i), PK: NewInt64PrimaryKey(int64(i)), Timestamp: 1, Value: map[FieldID]any{
+			common.RowIDField: int64(i), common.TimeStampField: int64(1),
+			100: half(byte(i)), 101: half(byte(i + 10)), 102: row,
+		}}
+	})
+	require.Empty(t, values[1].Value.(map[FieldID]any)[102])
+
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: lo.Range(len(schema.Fields))}
+	for _, batchSize := range []int{1, 3} {
+		path := fmt.Sprintf("/tmp/half_sparse_vectors/%d", batchSize)
+		writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, batchSize)
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+
+		for _, shouldCopy := range []bool{true, false} {
+			reader, err := NewPackedDeserializeReader([][]string{{path}}, schema, 10*1024*1024, shouldCopy)
+			require.NoError(t, err)
+			for i := range values {
+				v, err := reader.NextValue()
+				require.NoError(t, err)
+				for _, fieldID := range []FieldID{100, 101, 102} {
+					got := (*v).Value.(map[FieldID]any)[fieldID]
+					// byte-identical, the empty sparse vector read as empty rather than null
+					assert.Equal(t, values[i].Value.(map[FieldID]any)[fieldID], got, "row %d field %d", i, fieldID)
+					assert.NotNil(t, got)
+				}
+			}
+			_, err = reader.NextValue()
+			assert.Equal(t, io.EOF, err)
+			require.NoError(t, reader.Close())
+		}
+	}
+
+	t.Run("wrong width", func(t *testing.T) {
+		wrong := &Value{ID: 0, PK: NewInt64PrimaryKey(0), Value: map[FieldID]any{
+			common.RowIDField: int64(0), common.TimeStampField: int64(1), 100: []byte{1, 2}, 101: make([]byte, 8), 102: sparse[0],
+		}}
+		_, err := ValueSerializer([]*Value{wrong}, schema)
+		assert.Error(t, err)
+	})
+}
+
+func TestPackedDeserializeReaderAuto(t *testing.T) {
+	size := 10
+	paths := [][]string{{"/tmp/deserialize_auto/0"}}
+	writePackedTestSegment(t, paths[0], size)
+
+	expected, err := NewPackedDeserializeReader(paths, generateTestSchema(), 10*1024*1024, true)
+	require.NoError(t, err)
+	want, err := ReadAllValues(expected)
+	require.NoError(t, err)
+	reader, err := NewPackedDeserializeReaderAuto(paths, 10*1024*1024, true)
+	require.NoError(t, err)
+	got, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	require.Len(t, got, size)
+	for i := range want {
+		assert.Equal(t, want[i].PK, got[i].PK)
+		assert.Equal(t, want[i].Timestamp, got[i].Timestamp)
+		assert.True(t, payloadEqual(want[i], got[i], common.RowIDField), i)
+	}
+
+	_, err = NewPackedDeserializeReaderAuto(nil, 1024, true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = NewPackedDeserializeReaderAuto([][]string{{"/tmp/deserialize_auto/missing"}}, 1024, true)
+	assert.Error(t, err)
+}
+
+func TestPackedDeserializeReaderAddedFields(t *testing.T) {
+	size := 10
+	paths := [][]string{{"/tmp/deserialize_added_fields/0"}}
+	writePackedTestSegment(t, paths[0], size)
+
+	// the fields added to the collection after the segment was written
+	schema := generateTestSchema()
+	schema.Fields = append(schema.Fields,
+		&schemapb.FieldSchema{FieldID: 200, Name: "added_nullable", DataType: schemapb.DataType_Int64, Nullable: true},
+		&schemapb.FieldSchema{
+			FieldID: 201, Name: "added_default", DataType: schemapb.DataType_VarChar,
+			TypeParams:   []*commonpb.KeyValuePair{{Key: common.MaxLengthKey, Value: "16"}},
+			DefaultValue: &schemapb.ValueField{Data: &schemapb.ValueField_StringData{StringData: "none"}},
+		},
+	)
+	reader, err := NewPackedDeserializeReader(paths, schema, 10*1024*1024, true)
+	require.NoError(t, err)
+	values, err := ReadAllValues(reader)
+	require.NoError(t, err)
+	require.Len(t, values, size)
+	for i, v := range values {
+		m := v.Value.(map[FieldID]interface{})
+		assert.Nil(t, m[200], i)
+		assert.Equal(t, "none", m[201], i)
+		assert.EqualValues(t, i+1, m[common.RowIDField], i)
+	}
+
+	// the fields are missing from every chunk
+	paths = append(paths, []string{"/tmp/deserialize_added_fields/1"})
+	writePackedTestSegment(t, paths[1], size)
+	reader, err = NewPackedDeserializeReader(paths, schema, 10*1024*1024, true)
+	require.NoError(t, err)
+	values, err = ReadAllValues(reader)
+	require.NoError(t, err)
+	assert.Len(t, values, 2*size)
+
+	// the files that cannot be read fail
+	_, err = NewPackedDeserializeReader([][]string{paths[0], {"/tmp/deserialize_added_fields/absent"}}, schema, 10*1024*1024, true)
+	assert.ErrorIs(t, err, merr.ErrIoFailed)
+
+	schema.Fields = append(schema.Fields,
+		&schemapb.FieldSchema{FieldID: 202, Name: "added_required", DataType: schemapb.DataType_Int64})
+	_, err = NewPackedDeserializeReader(paths, schema, 10*1024*1024, true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
+
+func TestPackedDeserializeReaderReusingValues(t *testing.T) {
+	paths := []string{"/tmp/reusing_values/0"}
+	writePackedTestSegment(t, paths, 50, WithRowGroupSize(7))
+	schema := generateTestSchema()
+	deletes := NewDeleteSet()
+	deletes.Add(NewInt64PrimaryKey(2), 100)
+
+	reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDeletes(deletes))
+	require.NoError(t, err)
+	expected, err := ReadAllValues(reader)
+	require.NoError(t, err)
+
+	reader, err = NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDeletes(deletes), WithReusedValues())
+	require.NoError(t, err)
+	defer reader.Close()
+	seen := typeutil.NewSet[*Value]()
+	for i := 0; ; i++ {
+		v, err := reader.NextValue()
+		if err == io.EOF {
+			assert.Equal(t, len(expected), i)
+			break
+		}
+		require.NoError(t, err)
+		// compared before the next batch overwrites it
+		assert.Equal(t, expected[i], *v)
+		seen.Insert(*v)
+	}
+	assert.Less(t, seen.Len(), len(expected))
+}
+
+func BenchmarkPackedDeserializeReader(b *testing.B) {
+	paths := []string{"/tmp/bench_deserialize_reader/0"}
+	writePackedTestSegment(b, paths, 1000, WithRowGroupSize(100))
+	schema := generateTestSchema()
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reuse=%t", reuse), func(b *testing.B) {
+			var opts []ValueDeserializerOption
+			if reuse {
+				opts = append(opts, WithReusedValues())
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024*1024, false, opts...)
+				require.NoError(b, err)
+				for {
+					_, err := reader.NextValue()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(b, err)
+				}
+				require.NoError(b, reader.Close())
+			}
+		})
+	}
+}
+
+func TestPackedDeserializeReaderWithDeletes(t *testing.T) {
+	size := 10
+	paths := []string{"/tmp/with_deletes/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	readPKs := func(deletes *DeleteSet) []int64 {
+		reader, err := NewPackedDeserializeReaderWithDeletes([][]string{paths}, schema, 10*1024*1024, common.RowIDField, deletes, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return lo.Map(values, func(v *Value, _ int) int64 {
+			assert.Equal(t, v.PK.GetValue(), v.Value.(map[FieldID]any)[13])
+			return v.PK.GetValue().(int64)
+		})
+	}
+
+	t.Run("skip deleted", func(t *testing.T) {
+		// rows are written with pk i at ts i
+		deletes := NewDeleteSet()
+		deletes.Add(NewInt64PrimaryKey(2), 5)
+		deletes.Add(NewInt64PrimaryKey(3), 3) // at the ts of the insert
+		deletes.Add(NewInt64PrimaryKey(4), 100)
+		deletes.Add(NewInt64PrimaryKey(5), 100)
+		deletes.Add(NewInt64PrimaryKey(7), 1) // before the insert
+		deletes.Add(NewInt64PrimaryKey(10), 100)
+		deletes.Add(NewInt64PrimaryKey(100), 100)
+		assert.Equal(t, []int64{1, 6, 7, 8, 9}, readPKs(deletes))
+	})
+
+	t.Run("not the primary key", func(t *testing.T) {
+		_, err := NewPackedDeserializeReaderWithDeletes([][]string{paths}, schema, 1024, 13, NewDeleteSet(), true)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("no deletes", func(t *testing.T) {
+		assert.Len(t, readPKs(NewDeleteSet()), size)
+	})
+
+	t.Run("all deleted", func(t *testing.T) {
+		deletes := NewDeleteSet()
+		for i := 1; i <= size; i++ {
+			deletes.Add(NewInt64PrimaryKey(int64(i)), 100)
+		}
+		assert.Empty(t, readPKs(deletes))
+	})
+
+	t.Run("inline", func(t *testing.T) {
+		// pk i deleted at ts i+1
+		blob, err := generateTestDeltalogData(3)
+		require.NoError(t, err)
+		deltaReader, err := CreateDeltalogReader([]*Blob{blob})
+		require.NoError(t, err)
+		defer deltaReader.Close()
+		deletes, err := NewDeleteSetFromReader(deltaReader)
+		require.NoError(t, err)
+		assert.Equal(t, 3, deletes.Len())
+
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDeletes(deletes))
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		require.Len(t, values, size)
+		deleted := lo.FilterMap(values, func(v *Value, _ int) (int64, bool) { return v.PK.GetValue().(int64), v.IsDeleted })
+		assert.Equal(t, []int64{1, 2}, deleted)
+
+		reader, err = NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDeletes(deletes), WithDropDeleted())
+		require.NoError(t, err)
+		values, err = ReadAllValues(reader)
+		require.NoError(t, err)
+		assert.Equal(t, lo.RangeFrom(int64(3), size-2), lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }))
+		assert.True(t, lo.NoneBy(values, func(v *Value) bool { return v.IsDeleted }))
+
+		_, err = NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDropDeleted())
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		reader, err = NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithDeletes(deletes), WithSkipPK())
+		require.NoError(t, err)
+		_, err = ReadAllValues(reader)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("varchar", func(t *testing.T) {
+		deletes := NewDeleteSet()
+		pk, err := GenPrimaryKeyByRawData("a", schemapb.DataType_VarChar)
+		require.NoError(t, err)
+		deletes.Add(pk, 10)
+		assert.True(t, deletes.IsDeleted(NewVarCharPrimaryKey("a").GetValue(), 9))
+		assert.False(t, deletes.IsDeleted(NewVarCharPrimaryKey("b").GetValue(), 9))
+	})
+}
+
+func TestPackedDeserializeReaderWithPartialUpdates(t *testing.T) {
+	size := 5
+	paths := []string{"/tmp/partial_updates/base/0"}
+	partialPaths := []string{"/tmp/partial_updates/partial/0"}
+	// rows are written with pk i at ts i
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := range schema.GetFields() {
+		group.Columns = append(group.Columns, i)
+	}
+	writer, err := NewPackedPartialSerializeWriter("", partialPaths, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, 7)
+	require.NoError(t, err)
+	partial := func(pk, ts int64, fields map[FieldID]any) *Value {
+		fields[common.RowIDField] = pk
+		fields[common.TimeStampField] = ts
+		return &Value{ID: pk, PK: NewInt64PrimaryKey(pk), Timestamp: ts, Value: fields}
+	}
+	for _, v := range []*Value{
+		partial(2, 20, map[FieldID]any{101: int32(222)}),
+		partial(2, 10, map[FieldID]any{13: int64(200)}),
+		partial(2, 1, map[FieldID]any{13: int64(-1)}), // older than the base row
+		partial(4, 30, map[FieldID]any{16: "four"}),
+		partial(9, 40, map[FieldID]any{13: int64(900)}), // no base row
+	} {
+		require.NoError(t, writer.WriteValue(v))
+	}
+	require.NoError(t, writer.Close())
+
+	readPartials := func() *PartialUpdates {
+		reader, err := NewPackedDeserializeReader([][]string{partialPaths}, PartialSchema(schema), 1024, true)
+		require.NoError(t, err)
+		defer reader.Close()
+		partials, err := NewPartialUpdatesFromReader(reader)
+		require.NoError(t, err)
+		assert.Equal(t, 3, partials.Len())
+		return partials
+	}
+
+	t.Run("orphan fails", func(t *testing.T) {
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithPartialUpdates(readPartials()))
+		require.NoError(t, err)
+		_, err = ReadAllValues(reader)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		assert.ErrorContains(t, err, "[9]")
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true,
+			WithPartialUpdates(readPartials()), WithIncompletePartials())
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		require.Len(t, values, size+1)
+		assert.Equal(t, []int64{1, 2, 3, 4, 5, 9}, lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }))
+		assert.Equal(t, []int64{1, 20, 3, 30, 5, 40}, lo.Map(values, func(v *Value, _ int) int64 { return v.Timestamp }))
+		assert.Equal(t, []bool{false, false, false, false, false, true}, lo.Map(values, func(v *Value, _ int) bool { return v.Incomplete }))
+
+		updated := values[1].Value.(map[FieldID]any)
+		assert.Equal(t, int64(200), updated[13])
+		assert.Equal(t, int32(222), updated[101])
+		assert.Equal(t, "2", updated[16])
+		assert.Equal(t, int64(20), updated[common.TimeStampField])
+		assert.Equal(t, int64(2), updated[common.RowIDField])
+		assert.Equal(t, "four", values[3].Value.(map[FieldID]any)[16])
+		assert.Equal(t, int64(4), values[3].Value.(map[FieldID]any)[13])
+		assert.Equal(t, int64(1), values[0].Value.(map[FieldID]any)[13])
+
+		orphan := values[5].Value.(map[FieldID]any)
+		assert.Equal(t, int64(900), orphan[13])
+		assert.NotContains(t, orphan, FieldID(16))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true,
+			WithPartialUpdates(readPartials()), WithDeletes(NewDeleteSet()), WithDropDeleted())
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, 1024, true, WithPartialUpdates(readPartials()), WithSkipPK())
+		require.NoError(t, err)
+		_, err = ReadAllValues(reader)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		// the rows out of the timestamp range may be those updated
+		_, err = NewPackedDeserializeReader([][]string{paths}, schema, 1024, true,
+			WithPartialUpdates(readPartials()), WithReadTimestampRange(nil, 0, 10))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		// the other readers do not report the partial rows without a base row
+		_, err = NewPackedDeserializeReaderExpr([][]string{paths}, schema, 1024, nil, true, WithIncompletePartials())
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = NewPackedSampleReader([][]string{paths}, schema, 1024, common.RowIDField, 2,
+			WithSampleDeserializerOptions(WithPartialUpdates(readPartials())))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+
+		partialSchema := PartialSchema(schema)
+		assert.True(t, partialSchema.GetFields()[2].GetNullable())
+		assert.False(t, partialSchema.GetFields()[1].GetNullable())
+		_, err = ValueSerializer([]*Value{partial(1, 1, map[FieldID]any{13: nil})}, partialSchema, WithPartialValues())
+		assert.ErrorContains(t, err, "read back as unchanged")
+		noTs := partial(1, 1, map[FieldID]any{})
+		delete(noTs.Value.(map[FieldID]any), common.TimeStampField)
+		_, err = ValueSerializer([]*Value{noTs}, partialSchema, WithPartialValues())
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestDiffPackedSegments(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	readValues := func(seed, size int) []*Value {
+		blobs, err := generateTestDataWithSeed(seed, size)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return values
+	}
+	write := func(path string, values []*Value) [][]string {
+		writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, 3)
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+		return [][]string{{path}}
+	}
+	diffPKs := func(oldPaths, newPaths [][]string) []int64 {
+		var pks []int64
+		for v, err := range DiffPackedSegments(oldPaths, newPaths, schema, common.RowIDField) {
+			require.NoError(t, err)
+			pks = append(pks, v.PK.GetValue().(int64))
+		}
+		return pks
+	}
+
+	oldPaths := write("/tmp/diff_segments/old", readValues(1, 10))
+
+	// pk 3 changed, pk 5 removed, pk 7 rewritten at a newer ts, pks 11 and 12 added
+	values := readValues(1, 10)
+	values[2].Value.(map[FieldID]any)[13] = int64(-3)
+	values[6].Value.(map[FieldID]any)[common.TimeStampField] = int64(70)
+	values = append(values[:4], values[5:]...)
+	values = append(values, readValues(11, 2)...)
+	newPaths := write("/tmp/diff_segments/new", values)
+
+	assert.Equal(t, []int64{3, 11, 12}, diffPKs(oldPaths, newPaths))
+	assert.Empty(t, diffPKs(oldPaths, oldPaths))
+	assert.Len(t, diffPKs(write("/tmp/diff_segments/empty", nil), newPaths), len(values))
+
+	t.Run("break early", func(t *testing.T) {
+		for v, err := range DiffPackedSegments(oldPaths, newPaths, schema, common.RowIDField) {
+			require.NoError(t, err)
+			assert.True(t, v.PK.EQ(NewInt64PrimaryKey(3)))
+			break
+		}
+	})
+
+	t.Run("unknown pk field", func(t *testing.T) {
+		for _, err := range DiffPackedSegments(oldPaths, newPaths, schema, 999) {
+			assert.Error(t, err)
+		}
+	})
+}
+
+// serdeFuzzTypes are the field types generated by randomSerdeSchema besides the system fields.
+var serdeFuzzTypes = []schemapb.DataType{
+	schemapb.DataType_Bool,
+	schemapb.DataType_Int8,
+	schemapb.DataType_Int16,
+	schemapb.DataType_Int32,
+	schemapb.DataType_Int64,
+	schemapb.DataType_Float,
+	schemapb.DataType_Double,
+	schemapb.DataType_VarChar,
+	schemapb.DataType_JSON,
+	schemapb.DataType_Array,
+	schemapb.DataType_FloatVector,
+	schemapb.DataType_BinaryVector,
+	schemapb.DataType_Float16Vector,
+	schemapb.DataType_BFloat16Vector,
+	schemapb.DataType_Int8Vector,
+	schemapb.DataType_SparseFloatVector,
+}
+
+func TestPackedLatestPerPKReader(t *testing.T) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+	// versions returns a value per pk of 1..n at ts, tagged with ts in field 13
+	versions := func(n int, ts int64) []*Value {
+		blobs, err := generateTestDataWithSeed(1, n)
+		require.NoError(t, err)
+		reader, err := NewBinlogDeserializeReader(schema, MakeBlobsReader(blobs), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		for _, v := range values {
+			v.Value.(map[FieldID]any)[common.TimeStampField] = ts
+			v.Value.(map[FieldID]any)[13] = ts
+			v.Timestamp = ts
+		}
+		return values
+	}
+	write := func(path string, values []*Value) [][]string {
+		writer, err := NewPackedSerializeWriter("", []string{path}, schema, 10*1024*1024, 0, []storagecommon.ColumnGroup{group}, 3)
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+		return [][]string{{path}}
+	}
+	// readLatest returns the ts read per pk, in read order
+	readLatest := func(paths [][]string, sorted bool) ([]int64, []int64) {
+		reader, err := NewPackedLatestPerPKReader(paths, schema, 1024, common.RowIDField, sorted)
+		require.NoError(t, err)
+		defer reader.Close()
+		var pks, tss []int64
+		for {
+			v, err := reader.NextValue()
+			if err == io.EOF {
+				return pks, tss
+			}
+			require.NoError(t, err)
+			m := (*v).Value.(map[FieldID]any)
+			assert.Equal(t, (*v).Timestamp, m[13])
+			pks = append(pks, m[common.RowIDField].(int64))
+			tss = append(tss, (*v).Timestamp)
+		}
+	}
+
+	t.Run("unsorted", func(t *testing.T) {
+		// pks 1..3 upserted at ts 30, pks 1..2 at ts 20 written last
+		values := append(versions(4, 10), versions(3, 30)...)
+		values = append(values, versions(2, 20)...)
+		pks, tss := readLatest(write("/tmp/latest_per_pk/unsorted", values), false)
+		assert.Equal(t, []int64{1, 2, 3, 4}, pks)
+		assert.Equal(t, []int64{30, 30, 30, 10}, tss)
+	})
+
+	t.Run("sorted", func(t *testing.T) {
+		v10, v20, v30 := versions(4, 10), versions(3, 20), versions(1, 30)
+		values := []*Value{v10[0], v20[0], v30[0], v10[1], v10[2], v20[2], v10[3]}
+		pks, tss := readLatest(write("/tmp/latest_per_pk/sorted", values), true)
+		assert.Equal(t, []int64{1, 2, 3, 4}, pks)
+		assert.Equal(t, []int64{30, 10, 20, 10}, tss)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		paths := write("/tmp/latest_per_pk/empty", nil)
+		for _, sorted := range []bool{false, true} {
+			pks, _ := readLatest(paths, sorted)
+			assert.Empty(t, pks)
+		}
+	})
+
+	t.Run("dedup", func(t *testing.T) {
+		v10, v20, v30 := versions(4, 10), versions(3, 20), versions(1, 30)
+		for _, tc := range []struct {
+			name   string
+			values []*Value
+			sorted bool
+			tss    []int64
+		}{
+			{"unsorted", append(append(v10, v30...), v20...), false, []int64{30, 20, 20, 10}},
+			{"sorted", []*Value{v10[0], v20[0], v30[0], v10[1], v10[2], v20[2], v10[3]}, true, []int64{30, 10, 20, 10}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				paths := write("/tmp/latest_per_pk/dedup_"+tc.name, tc.values)
+				inner, err := NewPackedDeserializeReader(paths, schema, 1024, true)
+				require.NoError(t, err)
+				reader := NewDedupReader(inner, tc.sorted)
+				defer reader.Close()
+				var pks, tss []int64
+				for {
+					v, err := reader.NextValue()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(t, err)
+					pks = append(pks, (*v).PK.GetValue().(int64))
+					tss = append(tss, (*v).Timestamp)
+				}
+				assert.Equal(t, []int64{1, 2, 3, 4}, pks)
+				assert.Equal(t, tc.tss, tss)
+				assert.Equal(t, int64(len(tc.values)-4), reader.Duplicates())
+			})
+		}
+	})
+}
+
+// randomSerdeSchema generates a schema with row id, timestamp, an int64 or varchar
+// primary key and a few random fields.
+func randomSerdeSchema(r *rand.Rand) *schemapb.CollectionSchema {
+	pkType := schemapb.DataType_Int64
+	if r.Intn(2) == 0 {
+		pkType = schemapb.DataType_VarChar
+	}
+	schema := &schemapb.CollectionSchema{
+		Name: "fuzz",
+		Fields: []*schemapb.FieldSchema{
+			{FieldID: common.RowIDField, Name: common.RowIDFieldName, DataType: schemapb.DataType_Int64},
+			{FieldID: common.TimeStampField, Name: common.TimeStampFieldName, DataType: schemapb.DataType_Int64},
+			{FieldID: 100, Name: "pk", DataType: pkType, IsPrimaryKey: true, TypeParams: []*commonpb.KeyValuePair{
+				{Key: common.MaxLengthKey, Value: "65535"},
+			}},
+		},
+	}
+	numFields := 1 + r.Intn(8)
+	for i := 0; i < numFields; i++ {
+		dataType := serdeFuzzTypes[r.Intn(len(serdeFuzzTypes))]
+		field := &schemapb.FieldSchema{
+			FieldID:  int64(101 + i),
+			Name:     fmt.Sprintf("field_%d", 101+i),
+			DataType: dataType,
+		}
+		switch dataType {
+		case schemapb.DataType_FloatVector, schemapb.DataType_Float16Vector, schemapb.DataType_BFloat16Vector, schemapb.DataType_Int8Vector:
+			dims := []int{1, 2, 7, 128, 32768}
+			field.TypeParams = []*commonpb.KeyValuePair{{Key: common.DimKey, Value: strconv.Itoa(dims[r.Intn(len(dims))])}}
+		case schemapb.DataType_BinaryVector:
+			dims := []int{8, 16, 1024, 32768}
+			field.TypeParams = []*commonpb.KeyValuePair{{Key: common.DimKey, Value: strconv.Itoa(dims[r.Intn(len(dims))])}}
+		case schemapb.DataType_Array:
+			elementTypes := []schemapb.DataType{schemapb.DataType_Int32, schemapb.DataType_Int64, schemapb.DataType_Double, schemapb.DataType_VarChar}
+			field.ElementType = elementTypes[r.Intn(len(elementTypes))]
+			field.Nullable = r.Intn(2) == 0
+		case schemapb.DataType_SparseFloatVector:
+		default:
+			field.Nullable = r.Intn(2) == 0
+		}
+		schema.Fields = append(schema.Fields, field)
+	}
+	return schema
+}
+
+func randomSerdeFloat32(r *rand.Rand) float32 {
+	special := []float32{0, float32(math.Copysign(0, -1)), float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1)), math.MaxFloat32, math.SmallestNonzeroFloat32}
+	if r.Intn(4) == 0 {
+		return special[r.Intn(len(special))]
+	}
+	return r.Float32()*2 - 1
+}
+
+func randomSerdeFloat64(r *rand.Rand) float64 {
+	special := []float64{0, math.Copysign(0, -1), math.NaN(), math.Inf(1), math.Inf(-1), math.MaxFloat64, math.SmallestNonzeroFloat64}
+	if r.Intn(4) == 0 {
+		return special[r.Intn(len(special))]
+	}
+	return r.NormFloat64()
+}
+
+func randomSerdeString(r *rand.Rand) string {
+	special := []string{"", " ", "\x00", "多字节", "\U0001F600"}
+	if r.Intn(3) == 0 {
+		return special[r.Intn(len(special))]
+	}
+	b := make([]byte, r.Intn(64))
+	for i := range b {
+		b[i] = byte('a' + r.Intn(26))
+	}
+	return string(b)
+}
+
+func randomSerdeBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+// randomSerdeFieldValue generates a value of field in the form ValueSerializer accepts
+// and valueDeserializer returns.
+func randomSerdeFieldValue(r *rand.Rand, field *schemapb.FieldSchema) any {
+	if field.GetNullable() && r.Intn(4) == 0 {
+		return nil
+	}
+	dim := 0
+	if d, err := GetDimFromParams(field.GetTypeParams()); err == nil {
+		dim = d
+	}
+	switch field.GetDataType() {
+	case schemapb.DataType_Bool:
+		return r.Intn(2) == 0
+	case schemapb.DataType_Int8:
+		return int8(r.Intn(math.MaxUint8 + 1))
+	case schemapb.DataType_Int16:
+		return int16(r.Intn(math.MaxUint16 + 1))
+	case schemapb.DataType_Int32:
+		return r.Int31() - r.Int31()
+	case schemapb.DataType_Int64:
+		values := []int64{math.MinInt64, math.MaxInt64, 0, r.Int63() - r.Int63()}
+		return values[r.Intn(len(values))]
+	case schemapb.DataType_Float:
+		return randomSerdeFloat32(r)
+	case schemapb.DataType_Double:
+		return randomSerdeFloat64(r)
+	case schemapb.DataType_VarChar:
+		return randomSerdeString(r)
+	case schemapb.DataType_JSON:
+		values := [][]byte{[]byte("{}"), []byte(`{"key":"value"}`), []byte(`{"a":[1,2.5,null]}`), []byte(`""`)}
+		return values[r.Intn(len(values))]
+	case schemapb.DataType_Array:
+		n := r.Intn(5)
+		switch field.GetElementType() {
+		case schemapb.DataType_Int32:
+			data := make([]int32, n)
+			for i := range data {
+				data[i] = r.Int31()
+			}
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_IntData{IntData: &schemapb.IntArray{Data: data}}}
+		case schemapb.DataType_Int64:
+			data := make([]int64, n)
+			for i := range data {
+				data[i] = r.Int63()
+			}
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_LongData{LongData: &schemapb.LongArray{Data: data}}}
+		case schemapb.DataType_Double:
+			data := make([]float64, n)
+			for i := range data {
+				data[i] = randomSerdeFloat64(r)
+			}
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_DoubleData{DoubleData: &schemapb.DoubleArray{Data: data}}}
+		default:
+			data := make([]string, n)
+			for i := range data {
+				data[i] = randomSerdeString(r)
+			}
+			return &schemapb.ScalarField{Data: &schemapb.ScalarField_StringData{StringData: &schemapb.StringArray{Data: data}}}
+		}
+	case schemapb.DataType_FloatVector:
+		vector := make([]float32, dim)
+		for i := range vector {
+			vector[i] = randomSerdeFloat32(r)
+		}
+		return vector
+	case schemapb.DataType_BinaryVector:
+		return randomSerdeBytes(r, (dim+7)/8)
+	case schemapb.DataType_Float16Vector, schemapb.DataType_BFloat16Vector:
+		return randomSerdeBytes(r, dim*2)
+	case schemapb.DataType_Int8Vector:
+		vector := make([]int8, dim)
+		for i := range vector {
+			vector[i] = int8(r.Intn(math.MaxUint8 + 1))
+		}
+		return vector
+	case schemapb.DataType_SparseFloatVector:
+		// sparse rows are pairs of uint32 index and float32 value
+		return randomSerdeBytes(r, 8*r.Intn(8))
+	default:
+		panic(fmt.Sprintf("unexpected fuzz type %s", field.GetDataType()))
+	}
+}
+
+// randomSerdeValues generates n values conforming to schema. A nullable field that is
+// null is sometimes left out of the value map.
+func randomSerdeValues(r *rand.Rand, schema *schemapb.CollectionSchema, n int) []*Value {
+	values := make([]*Value, 0, n)
+	for i := 0; i < n; i++ {
+		m := make(map[FieldID]any, len(schema.Fields))
+		for _, field := range schema.Fields {
+			switch {
+			case field.GetFieldID() == common.RowIDField:
+				m[field.GetFieldID()] = int64(i)
+			case field.GetFieldID() == common.TimeStampField:
+				m[field.GetFieldID()] = r.Int63()
+			case field.GetIsPrimaryKey() && field.GetDataType() == schemapb.DataType_Int64:
+				m[field.GetFieldID()] = int64(i) - int64(n/2)
+			case field.GetIsPrimaryKey():
+				m[field.GetFieldID()] = fmt.Sprintf("%s_%d", randomSerdeString(r), i)
+			default:
+				v := randomSerdeFieldValue(r, field)
+				if v == nil && r.Intn(2) == 0 {
+					continue
+				}
+				m[field.GetFieldID()] = v
+			}
+		}
+		pkField, _ := lo.Find(schema.Fields, func(f *schemapb.FieldSchema) bool { return f.GetIsPrimaryKey() })
+		pk, err := GenPrimaryKeyByRawData(m[pkField.GetFieldID()], pkField.GetDataType())
+		if err != nil {
+			panic(err)
+		}
+		values = append(values, &Value{
+			ID:        m[common.RowIDField].(int64),
+			PK:        pk,
+			Timestamp: m[common.TimeStampField].(int64),
+			Value:     m,
+		})
+	}
+	return values
+}
+
+// serdeFieldValueEqual compares field values bitwise for floats, so that NaN and -0 must
+// survive the round trip, and treats nil and empty byte slices as equal.
+func serdeFieldValueEqual(expected, actual any) bool {
+	switch e := expected.(type) {
+	case float32:
+		a, ok := actual.(float32)
+		return ok && math.Float32bits(e) == math.Float32bits(a)
+	case float64:
+		a, ok := actual.(float64)
+		return ok && math.Float64bits(e) == math.Float64bits(a)
+	case []float32:
+		a, ok := actual.([]float32)
+		return ok && bytes.Equal(arrowFloat32Bytes(e), arrowFloat32Bytes(a))
+	case []byte:
+		a, ok := actual.([]byte)
+		return ok && bytes.Equal(e, a)
+	case *schemapb.ScalarField:
+		a, ok := actual.(*schemapb.ScalarField)
+		return ok && proto.Equal(e, a)
+	default:
+		return reflect.DeepEqual(expected, actual)
+	}
+}
+
+func arrowFloat32Bytes(v []float32) []byte {
+	b := make([]byte, 0, len(v)*4)
+	for _, f := range v {
+		b = common.Endian.AppendUint32(b, math.Float32bits(f))
+	}
+	return b
+}
+
+func FuzzPackedSerdeRoundTrip(f *testing.F) {
+	paramtable.Get().Save(paramtable.Get().CommonCfg.StorageType.Key, "local")
+	initcore.InitLocalArrowFileSystem("/tmp")
+	for _, seed := range []int64{0, 1, 2, 3, 42, 20240101} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		r := rand.New(rand.NewSource(seed))
+		schema := randomSerdeSchema(r)
+		allFields := typeutil.GetAllFieldSchemas(schema)
+		numRows := 1 + r.Intn(32)
+		values := randomSerdeValues(r, schema, numRows)
+
+		// system fields and pk in one column group, the rest in another one if any
+		groups := []storagecommon.ColumnGroup{{GroupID: 0, Columns: []int{0, 1, 2}}}
+		if len(allFields) > 3 {
+			group := storagecommon.ColumnGroup{GroupID: 1}
+			for i := 3; i < len(allFields); i++ {
+				group.Columns = append(group.Columns, i)
+			}
+			groups = append(groups, group)
+		}
+		paths := make([]string, 0, len(groups))
+		for _, group := range groups {
+			paths = append(paths, fmt.Sprintf("/tmp/packed_serde_fuzz/%d/%d", seed, group.GroupID))
+		}
+
+		bufferSize := int64(64 * 1024 * 1024)
+		writer, err := NewPackedSerializeWriter("", paths, schema, bufferSize, 0, groups, 1+r.Intn(numRows))
+		require.NoError(t, err)
+		for _, v := range values {
+			require.NoError(t, writer.WriteValue(v))
+		}
+		require.NoError(t, writer.Close())
+
+		reader, err := NewPackedDeserializeReader([][]string{paths}, schema, bufferSize, true)
+		require.NoError(t, err)
+		actual, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		require.Len(t, actual, numRows)
+
+		for i, expected := range values {
+			require.Equal(t, expected.ID, actual[i].ID)
+			require.True(t, expected.PK.EQ(actual[i].PK), "row %d pk mismatch", i)
+			require.Equal(t, expected.Timestamp, actual[i].Timestamp)
+			expectedMap := expected.Value.(map[FieldID]any)
+			actualMap := actual[i].Value.(map[FieldID]any)
+			for _, field := range allFields {
+				e := expectedMap[field.GetFieldID()]
+				a := actualMap[field.GetFieldID()]
+				require.True(t, serdeFieldValueEqual(e, a), "row %d field %d (%s): expected %v, got %v", i, field.GetFieldID(), field.GetDataType(), e, a)
+			}
+		}
+	})
+}
+
+func TestPackedPKLookupReader(t *testing.T) {
+	size := 20
+	paths := []string{"/tmp/pk_lookup/0"}
+	writePackedTestSegment(t, paths, size)
+	schema := generateTestSchema()
+
+	lookup := func(pks ...int64) []int64 {
+		reader, err := NewPackedPKLookupReader([][]string{paths}, schema, 10*1024*1024, common.RowIDField,
+			lo.Map(pks, func(pk int64, _ int) PrimaryKey { return NewInt64PrimaryKey(pk) }), true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		return lo.Map(values, func(v *Value, _ int) int64 {
+			assert.Equal(t, v.PK.GetValue(), v.Value.(map[FieldID]any)[13])
+			return v.PK.GetValue().(int64)
+		})
+	}
+
+	assert.Equal(t, []int64{2, 9, 17}, lookup(17, 2, 9, 9))
+	assert.Equal(t, []int64{5}, lookup(5, 100))
+	assert.Empty(t, lookup(100, -1))
+	assert.Empty(t, lookup())
+	assert.Len(t, lookup(lo.RangeFrom(int64(1), size)...), size)
+
+	t.Run("stops once all found", func(t *testing.T) {
+		reader := newFilterRecordReader(newChunkedTestReader(t, 3, 4, 3), typeutil.GetAllFieldSchemas(schema), &pkLookupFilter{
+			pkFieldID: common.RowIDField,
+			int64PKs:  map[int64]struct{}{2: {}},
+			remaining: 1,
+		})
+		defer reader.Close()
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, 1, rec.Len())
+		_, err = reader.Next()
+		assert.Equal(t, io.EOF, err)
+	})
+}
+
+func TestPackedDeserializeReaderPaged(t *testing.T) {
+	schema := generateTestSchema()
+	var paths [][]string
+	var expected []int64
+	for i, size := range []int{5, 12, 8} {
+		chunk := []string{fmt.Sprintf("/tmp/paged_reader/%d", i)}
+		writePackedTestSegment(t, chunk, size)
+		paths = append(paths, chunk)
+		expected = append(expected, lo.RangeFrom(int64(1), size)...)
+	}
+
+	for _, page := range [][2]int64{{0, 3}, {0, 25}, {3, 10}, {5, 12}, {6, 100}, {17, 8}, {24, 1}, {25, 5}, {40, 5}, {2, 0}} {
+		offset, limit := page[0], page[1]
+		reader, err := NewPackedDeserializeReaderPaged(paths, schema, 1024, common.RowIDField, offset, limit, true)
+		require.NoError(t, err)
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		start := min(offset, int64(len(expected)))
+		end := min(offset+limit, int64(len(expected)))
+		assert.Equal(t, expected[start:end], lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }),
+			"offset %d limit %d", offset, limit)
+	}
+
+	_, err := NewPackedDeserializeReaderPaged(paths, schema, 1024, common.RowIDField, -1, 10, true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = NewPackedDeserializeReaderPaged(paths, schema, 1024, 13, 0, 10, true)
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	_, err = NewPackedDeserializeReaderPaged(paths, schema, 1024, 999, 0, 10, true)
+	assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+
+	t.Run("row groups", func(t *testing.T) {
+		chunk := []string{"/tmp/paged_reader/row_groups"}
+		writePackedTestSegment(t, chunk, 20, WithRowGroupSize(4))
+		reader, err := NewPackedDeserializeReaderPaged([][]string{chunk}, schema, 1024, common.RowIDField, 9, 5, true)
+		require.NoError(t, err)
+		defer reader.Close()
+		v, err := reader.NextValue()
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), (*v).PK.GetValue())
+		// read from the third row group on, the two before are not read
+		cur := reader.rr.(*pagedRecordReader).cur.(*packedRecordReader)
+		assert.Equal(t, int64(4), cur.Position())
+		values, err := ReadAllValues(reader)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{11, 12, 13, 14}, lo.Map(values, func(v *Value, _ int) int64 { return v.PK.GetValue().(int64) }))
+	})
+
+	t.Run("range", func(t *testing.T) {
+		reader, err := NewPackedDeserializeReaderWithRange(paths, schema, 1024, 7, 4, true)
+		require.NoError(t, err)
+		var pks []int64
+		for {
+			v, err := reader.NextValue()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			pks = append(pks, (*v).PK.GetValue().(int64))
+		}
+		assert.Equal(t, expected[7:11], pks)
+		// the limit is hit before the end of the chunk, whose reader is closed by Close
+		paged := reader.rr.(*pagedRecordReader)
+		assert.NotNil(t, paged.cur)
+		require.NoError(t, reader.Close())
+		assert.Nil(t, paged.cur)
+
+		_, err = NewPackedDeserializeReaderWithRange(paths, schema, 1024, 0, -1, true)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+}
+
+func TestPackedSampleReader(t *testing.T) {
+	schema := generateTestSchema()
+	paths := [][]string{{"/tmp/sample_reader/0"}, {"/tmp/sample_reader/1"}}
+	writePackedTestSegment(t, paths[0], 30)
+	writePackedTestSegment(t, paths[1], 20)
+
+	sample := func(size int, opts ...SampleReaderOption) []int64 {
+		reader, err := NewPackedSampleReader(paths, schema, 1024, common.RowIDField, size, opts...)
+		require.NoError(t, err)
+		defer reader.Close()
+		var pks []int64
+		for {
+			v, err := reader.NextValue()
+			if err == io.EOF {
+				return pks
+			}
+			require.NoError(t, err)
+			assert.Equal(t, (*v).PK.GetValue(), (*v).Value.(map[FieldID]any)[13])
+			pks = append(pks, (*v).PK.GetValue().(int64))
+		}
+	}
+
+	t.Run("seeded", func(t *testing.T) {
+		first := sample(10, WithSampleSeed(7))
+		assert.Len(t, first, 10)
+		assert.True(t, slices.IsSorted(first))
+		assert.Equal(t, first, sample(10, WithSampleSeed(7)))
+		for _, pk := range first {
+			assert.True(t, pk >= 1 && pk <= 30, "pk %d", pk)
+		}
+	})
+
+	t.Run("smaller segment", func(t *testing.T) {
+		expected := append(lo.RangeFrom(int64(1), 30), lo.RangeFrom(int64(1), 20)...)
+		slices.Sort(expected)
+		assert.Equal(t, expected, sample(100))
+		assert.Equal(t, expected, sample(50))
+	})
+
+	t.Run("uniform", func(t *testing.T) {
+		hits := 0
+		for seed := int64(0); seed < 200; seed++ {
+			pks := sample(10, WithSampleSeed(seed))
+			hits += lo.Count(pks, int64(1))
+		}
+		// every row is drawn a fifth of the time, pk 1 is held by a row of each chunk
+		assert.InDelta(t, 80, hits, 30)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewPackedSampleReader(paths, schema, 1024, common.RowIDField, 0)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = NewPackedSampleReader(paths, schema, 1024, 13, 10)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = NewPackedSampleReader(paths, schema, 1024, 999, 10)
+		assert.ErrorIs(t, err, merr.ErrFieldNotFound)
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"io"
 	"reflect"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/apache/arrow/go/v17/arrow"
@@ -27,6 +28,7 @@ import (
 	"github.com/apache/arrow/go/v17/arrow/bitutil"
 	"github.com/apache/arrow/go/v17/arrow/memory"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
@@ -856,3 +858,119 @@ func TestActualSizeInBytesCompareWithDataSizeInBytes(t *testing.T) {
 		assert.Less(t, actualSize, uint64(totalRows*byteWidth))
 	})
 }
+
+func TestDeserializeFixedSizeListVector(t *testing.T) {
+	vectors := [][]float32{{1, 2, 3, 4}, {-1, 0.5, 0, 8}, {9, 10, 11, 12}}
+	dim := len(vectors[0])
+
+	listBuilder := array.NewFixedSizeListBuilder(memory.DefaultAllocator, int32(dim), arrow.PrimitiveTypes.Float32)
+	defer listBuilder.Release()
+	valueBuilder := listBuilder.ValueBuilder().(*array.Float32Builder)
+	binaryBuilder := array.NewFixedSizeBinaryBuilder(memory.DefaultAllocator, &arrow.FixedSizeBinaryType{ByteWidth: dim * 4})
+	defer binaryBuilder.Release()
+	for _, vector := range vectors {
+		listBuilder.Append(true)
+		valueBuilder.AppendValues(vector, nil)
+		binaryBuilder.Append(arrow.Float32Traits.CastToBytes(vector))
+	}
+	list := listBuilder.NewArray()
+	defer list.Release()
+	binary := binaryBuilder.NewArray()
+	defer binary.Release()
+	// sliced arrays exercise the offsets of the list and its values
+	slicedList := array.NewSlice(list, 1, 3)
+	defer slicedList.Release()
+
+	t.Run("float vector", func(t *testing.T) {
+		entry := serdeMap[schemapb.DataType_FloatVector]
+		for _, shouldCopy := range []bool{false, true} {
+			for i, vector := range vectors {
+				fromList, ok := entry.deserialize(list, i, schemapb.DataType_None, dim, shouldCopy)
+				assert.True(t, ok)
+				fromBinary, ok := entry.deserialize(binary, i, schemapb.DataType_None, dim, shouldCopy)
+				assert.True(t, ok)
+				assert.Equal(t, vector, fromList)
+				assert.Equal(t, fromBinary, fromList)
+			}
+			for i := 0; i < slicedList.Len(); i++ {
+				v, ok := entry.deserialize(slicedList, i, schemapb.DataType_None, dim, shouldCopy)
+				assert.True(t, ok)
+				assert.Equal(t, vectors[i+1], v)
+			}
+		}
+	})
+
+	t.Run("byte vectors", func(t *testing.T) {
+		for _, dataType := range []schemapb.DataType{schemapb.DataType_Float16Vector, schemapb.DataType_BFloat16Vector, schemapb.DataType_BinaryVector} {
+			entry := serdeMap[dataType]
+			for i := range vectors {
+				fromList, ok := entry.deserialize(list, i, schemapb.DataType_None, dim, true)
+				assert.True(t, ok)
+				fromBinary, ok := entry.deserialize(binary, i, schemapb.DataType_None, dim, true)
+				assert.True(t, ok)
+				assert.Equal(t, fromBinary, fromList)
+			}
+		}
+	})
+
+	t.Run("int8 vector", func(t *testing.T) {
+		int8Builder := array.NewFixedSizeListBuilder(memory.DefaultAllocator, 2, arrow.PrimitiveTypes.Int8)
+		defer int8Builder.Release()
+		int8Builder.Append(true)
+		int8Builder.ValueBuilder().(*array.Int8Builder).AppendValues([]int8{-1, 7}, nil)
+		arr := int8Builder.NewArray()
+		defer arr.Release()
+		v, ok := serdeMap[schemapb.DataType_Int8Vector].deserialize(arr, 0, schemapb.DataType_None, 2, false)
+		assert.True(t, ok)
+		assert.Equal(t, []int8{-1, 7}, v)
+	})
+
+	t.Run("unsupported element type", func(t *testing.T) {
+		_, ok := serdeMap[schemapb.DataType_FloatVector].deserialize(slicedList, 5, schemapb.DataType_None, dim, false)
+		assert.False(t, ok)
+
+		stringBuilder := array.NewFixedSizeListBuilder(memory.DefaultAllocator, 1, arrow.BinaryTypes.String)
+		defer stringBuilder.Release()
+		stringBuilder.Append(true)
+		stringBuilder.ValueBuilder().(*array.StringBuilder).Append("a")
+		arr := stringBuilder.NewArray()
+		defer arr.Release()
+		_, ok = serdeMap[schemapb.DataType_FloatVector].deserialize(arr, 0, schemapb.DataType_None, 1, false)
+		assert.False(t, ok)
+		_, ok = serdeMap[schemapb.DataType_BinaryVector].deserialize(arr, 0, schemapb.DataType_None, 8, false)
+		assert.False(t, ok)
+	})
+}
+
+func TestTimeBudgetReader(t *testing.T) {
+	schema := generateTestSchema()
+	newReader := func(delay time.Duration) DeserializeReader[*Value] {
+		return NewDeserializeReader(newChunkedTestReader(t, 3, 3, 3, 3), func(r Record, v []*Value) error {
+			time.Sleep(delay)
+			return ValueDeserializerWithSchema(r, v, schema, true)
+		})
+	}
+	readAll := func(reader *TimeBudgetReader[*Value]) int {
+		defer reader.Close()
+		n := 0
+		for {
+			_, err := reader.NextValue()
+			if err == io.EOF {
+				return n
+			}
+			require.NoError(t, err)
+			n++
+		}
+	}
+
+	reader := NewTimeBudgetReader(newReader(50*time.Millisecond), 75*time.Millisecond)
+	n := readAll(reader)
+	// the batch started within the budget is returned whole
+	assert.GreaterOrEqual(t, n, 3)
+	assert.Less(t, n, 12)
+	assert.True(t, reader.Exceeded())
+
+	reader = NewTimeBudgetReader(newReader(0), time.Minute)
+	assert.Equal(t, 12, readAll(reader))
+	assert.False(t, reader.Exceeded())
+}
@@ -17,14 +17,25 @@
 package storage
 
 import (
+	"cmp"
 	"container/heap"
+	"fmt"
 	"io"
+	"path"
 	"sort"
 
+	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
 
 	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
+	"github.com/milvus-io/milvus/pkg/v2/log"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"github.com/milvus-io/milvus/pkg/v2/util/typeutil"
 )
 
 func Sort(batchSize uint64, schema *schemapb.CollectionSchema, rr []RecordReader,
@@ -152,6 +163,148 @@ func Sort(batchSize uint64, schema *schemapb.CollectionSchema, rr []RecordReader
 	return len(indices), nil
 }
 
+// SortKey is a field to order rows by, ascending unless Descending. Nulls order before
+// all values ascending and after them descending.
+type SortKey struct {
+	FieldID    FieldID
+	Descending bool
+}
+
+// rowRef is row i of record ri.
+type rowRef struct {
+	ri int
+	i  int
+}
+
+// sortRows returns the rows of records stably ordered by keys.
+func sortRows(records []Record, keys []SortKey) ([]rowRef, error) {
+	compare, err := rowComparator(records, keys)
+	if err != nil {
+		return nil, err
+	}
+	var rows []rowRef
+	for ri, rec := range records {
+		for i := 0; i < rec.Len(); i++ {
+			rows = append(rows, rowRef{ri, i})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compare(rows[i], rows[j]) < 0
+	})
+	return rows, nil
+}
+
+// rowComparator compares rows of records by keys. Nil records, e.g. of drained inputs,
+// are skipped and their rows must not be compared.
+func rowComparator(records []Record, keys []SortKey) (func(x, y rowRef) int, error) {
+	comparators := make([]func(x, y rowRef) int, 0, len(keys))
+	for _, key := range keys {
+		c, err := columnComparator(records, key.FieldID)
+		if err != nil {
+			return nil, err
+		}
+		if key.Descending {
+			asc := c
+			c = func(x, y rowRef) int { return asc(y, x) }
+		}
+		comparators = append(comparators, c)
+	}
+	return func(x, y rowRef) int {
+		for _, c := range comparators {
+			if r := c(x, y); r != 0 {
+				return r
+			}
+		}
+		return 0
+	}, nil
+}
+
+// columnComparator compares the values of field fieldID of rows of records, skipping
+// nil records.
+func columnComparator(records []Record, fieldID FieldID) (func(x, y rowRef) int, error) {
+	firstRec, ok := lo.Find(records, func(rec Record) bool { return rec != nil })
+	if !ok {
+		return func(x, y rowRef) int { return 0 }, nil
+	}
+	first := firstRec.Column(fieldID)
+	if first == nil {
+		return nil, merr.WrapErrFieldNotFound(fieldID)
+	}
+	switch first.(type) {
+	case *array.Int8:
+		return orderedColumnComparator[int8](records, fieldID)
+	case *array.Int16:
+		return orderedColumnComparator[int16](records, fieldID)
+	case *array.Int32:
+		return orderedColumnComparator[int32](records, fieldID)
+	case *array.Int64:
+		return orderedColumnComparator[int64](records, fieldID)
+	case *array.Float32:
+		return orderedColumnComparator[float32](records, fieldID)
+	case *array.Float64:
+		return orderedColumnComparator[float64](records, fieldID)
+	case *array.String, *array.LargeString:
+		return orderedColumnComparator[string](records, fieldID)
+	case *array.Boolean:
+		cols := make([]*array.Boolean, len(records))
+		for i, rec := range records {
+			if rec == nil {
+				continue
+			}
+			col, ok := rec.Column(fieldID).(*array.Boolean)
+			if !ok {
+				return nil, merr.WrapErrParameterInvalidMsg("inconsistent column type of sorting key %d", fieldID)
+			}
+			cols[i] = col
+		}
+		return func(x, y rowRef) int {
+			return compareNullable(cols[x.ri], x.i, cols[y.ri], y.i, func() int {
+				return cmp.Compare(lo.Ternary(cols[x.ri].Value(x.i), 1, 0), lo.Ternary(cols[y.ri].Value(y.i), 1, 0))
+			})
+		}, nil
+	default:
+		return nil, merr.WrapErrParameterInvalidMsg("unsupported type %s for sorting key %d", first.DataType(), fieldID)
+	}
+}
+
+type orderedColumn[T cmp.Ordered] interface {
+	arrow.Array
+	Value(int) T
+}
+
+func orderedColumnComparator[T cmp.Ordered](records []Record, fieldID FieldID) (func(x, y rowRef) int, error) {
+	cols := make([]orderedColumn[T], len(records))
+	for i, rec := range records {
+		if rec == nil {
+			continue
+		}
+		col, ok := rec.Column(fieldID).(orderedColumn[T])
+		if !ok {
+			return nil, merr.WrapErrParameterInvalidMsg("inconsistent column type of sorting key %d", fieldID)
+		}
+		cols[i] = col
+	}
+	return func(x, y rowRef) int {
+		return compareNullable(cols[x.ri], x.i, cols[y.ri], y.i, func() int {
+			return cmp.Compare(cols[x.ri].Value(x.i), cols[y.ri].Value(y.i))
+		})
+	}, nil
+}
+
+// compareNullable orders nulls first and compares the values with compare otherwise.
+func compareNullable(x arrow.Array, xi int, y arrow.Array, yi int, compare func() int) int {
+	xNull, yNull := x.IsNull(xi), y.IsNull(yi)
+	switch {
+	case xNull && yNull:
+		return 0
+	case xNull:
+		return -1
+	case yNull:
+		return 1
+	}
+	return compare()
+}
+
 // A PriorityQueue implements heap.Interface and holds Items.
 type PriorityQueue[T any] struct {
 	items []*T
@@ -363,3 +516,491 @@ func MergeSort(batchSize uint64, schema *schemapb.CollectionSchema, rr []RecordR
 
 	return numRows, nil
 }
+
+// TournamentMergeReader merges the values of PK-sorted readers in PK order with a loser
+// tree, which takes about log2(k) comparisons per value against about 2*log2(k) for a
+// binary heap, paying off for merges over many segments. Values sharing a PK are
+// resolved to the one with the newest timestamp. Values sharing the timestamp too are
+// resolved to the reader of the lowest tie-break key of WithTieBreakKeys, or of the lowest
+// index without it, and to the value read first within a reader, so that merging the same
+// inputs always yields the same values. The readers are closed once they are drained.
+type TournamentMergeReader struct {
+	readers []*DeserializeReaderImpl[*Value]
+	compare PKComparator
+	// tieBreakKeys rank the readers for values of equal PK and timestamp, nil to rank
+	// them by index.
+	tieBreakKeys []int64
+	// allVersions returns every value instead of the winner of each PK.
+	allVersions bool
+	// heads holds the current value of each reader, nil once drained.
+	heads []*Value
+	// tree[0] is the index of the winning reader, tree[1:] the losers of the internal
+	// nodes. Leaf i sits at node len(readers)+i.
+	tree []int
+}
+
+type mergeReaderOptions struct {
+	compare      PKComparator
+	tieBreakKeys []int64
+	allVersions  bool
+}
+
+// MergeReaderOption configures the readers merging PK-sorted inputs.
+type MergeReaderOption func(*mergeReaderOptions)
+
+// WithPKComparator merges the inputs in the order of compare, which they must be sorted
+// by, instead of the natural order of the PK type.
+func WithPKComparator(compare PKComparator) MergeReaderOption {
+	return func(o *mergeReaderOptions) {
+		o.compare = compare
+	}
+}
+
+// WithTieBreakKeys resolves values of equal PK and timestamp to the reader of the lowest
+// key, keys holding a key per reader, e.g. the IDs of the segments read, so that the result
+// does not depend on the order the readers are listed in. Readers of equal keys are ranked
+// by index.
+func WithTieBreakKeys(keys []int64) MergeReaderOption {
+	return func(o *mergeReaderOptions) {
+		o.tieBreakKeys = keys
+	}
+}
+
+// withAllVersions returns all values in PK order, the values of equal PK ranked as the
+// winners are, for MergeSortPackedReader.
+func withAllVersions() MergeReaderOption {
+	return func(o *mergeReaderOptions) {
+		o.allVersions = true
+	}
+}
+
+// NewTournamentMergeReader reads the first value of each reader and builds the tree.
+// Values are only valid as long as the readers keep them, so readers should copy.
+func NewTournamentMergeReader(readers []*DeserializeReaderImpl[*Value], opts ...MergeReaderOption) (*TournamentMergeReader, error) {
+	options := &mergeReaderOptions{compare: DefaultPKComparator}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.tieBreakKeys != nil && len(options.tieBreakKeys) != len(readers) {
+		return nil, merr.WrapErrParameterInvalidMsg("merge of %d readers got %d tie-break keys",
+			len(readers), len(options.tieBreakKeys))
+	}
+	mr := &TournamentMergeReader{
+		readers:      readers,
+		compare:      options.compare,
+		tieBreakKeys: options.tieBreakKeys,
+		allVersions:  options.allVersions,
+		heads:        make([]*Value, len(readers)),
+		tree:         make([]int, max(len(readers), 1)),
+	}
+	for i := range readers {
+		if err := mr.advance(i); err != nil {
+			return nil, err
+		}
+	}
+	if len(readers) > 0 {
+		mr.tree[0] = mr.build(1)
+	}
+	return mr, nil
+}
+
+// less orders drained readers last and equal PKs newest first.
+func (mr *TournamentMergeReader) less(a, b int) bool {
+	x, y := mr.heads[a], mr.heads[b]
+	if x == nil || y == nil {
+		return y == nil && x != nil
+	}
+	if c := mr.compare.Compare(x.PK, y.PK); c != 0 {
+		return c < 0
+	}
+	return mr.wins(x, a, y, b)
+}
+
+// wins tells whether value x of reader a wins over value y of equal PK of reader b, by
+// the newest timestamp and then the tie-break rank of the readers.
+func (mr *TournamentMergeReader) wins(x *Value, a int, y *Value, b int) bool {
+	if x.Timestamp != y.Timestamp {
+		return x.Timestamp > y.Timestamp
+	}
+	if mr.tieBreakKeys != nil && mr.tieBreakKeys[a] != mr.tieBreakKeys[b] {
+		return mr.tieBreakKeys[a] < mr.tieBreakKeys[b]
+	}
+	return a < b
+}
+
+// build plays the matches of the subtree at node, recording the losers, and returns
+// the winner.
+func (mr *TournamentMergeReader) build(node int) int {
+	k := len(mr.readers)
+	if node >= k {
+		return node - k
+	}
+	left, right := mr.build(2*node), mr.build(2*node+1)
+	if mr.less(left, right) {
+		mr.tree[node] = right
+		return left
+	}
+	mr.tree[node] = left
+	return right
+}
+
+// replay replays the matches on the path of reader i to the root after its head changed.
+func (mr *TournamentMergeReader) replay(i int) {
+	winner := i
+	for node := (i + len(mr.readers)) / 2; node > 0; node /= 2 {
+		if mr.less(mr.tree[node], winner) {
+			mr.tree[node], winner = winner, mr.tree[node]
+		}
+	}
+	mr.tree[0] = winner
+}
+
+// advance reads the next value of reader i, or closes it once drained.
+func (mr *TournamentMergeReader) advance(i int) error {
+	v, err := mr.readers[i].NextValue()
+	if err == io.EOF {
+		mr.heads[i] = nil
+		err = mr.readers[i].Close()
+		mr.readers[i] = nil
+		return errors.Wrapf(err, "close input %d of merge", i)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read input %d of merge", i)
+	}
+	mr.heads[i] = *v
+	return nil
+}
+
+// pop returns the winning value and its reader, and moves the reader on.
+func (mr *TournamentMergeReader) pop() (*Value, int, error) {
+	i := mr.tree[0]
+	v := mr.heads[i]
+	if err := mr.advance(i); err != nil {
+		return nil, 0, err
+	}
+	mr.replay(i)
+	return v, i, nil
+}
+
+// NextValue returns the next value in PK order, or io.EOF once all readers are drained.
+func (mr *TournamentMergeReader) NextValue() (*Value, error) {
+	if len(mr.readers) == 0 || mr.heads[mr.tree[0]] == nil {
+		return nil, io.EOF
+	}
+	best, bestReader, err := mr.pop()
+	if err != nil {
+		return nil, err
+	}
+	if mr.allVersions {
+		return best, nil
+	}
+	// a reader may hold several versions of a PK in any timestamp order, the version
+	// read first wins the ties within a reader
+	for next := mr.heads[mr.tree[0]]; next != nil && mr.compare.Compare(next.PK, best.PK) == 0; next = mr.heads[mr.tree[0]] {
+		v, i, err := mr.pop()
+		if err != nil {
+			return nil, err
+		}
+		if i != bestReader && mr.wins(v, i, best, bestReader) || i == bestReader && v.Timestamp > best.Timestamp {
+			best, bestReader = v, i
+		}
+	}
+	return best, nil
+}
+
+// Close closes the readers not drained yet.
+func (mr *TournamentMergeReader) Close() error {
+	var errs error
+	for i, reader := range mr.readers {
+		if reader != nil {
+			errs = merr.Combine(errs, reader.Close())
+			mr.readers[i] = nil
+		}
+	}
+	return errs
+}
+
+// MergeSortPackedReader merges the values of PK-sorted packed segments in PK order with
+// a TournamentMergeReader over the readers of the segments. Unlike TournamentMergeReader
+// alone it returns every version of a PK, deleted values included, leaving the dedup to
+// the caller.
+type MergeSortPackedReader struct {
+	merge *TournamentMergeReader
+}
+
+// NewMergeSortPackedReader reads the segments of pathsPerSegment, each holding the column
+// group files of a segment sorted by its primary key pkFieldID, as a single stream of
+// values ordered by PK, for compactions merging sorted segments without sorting them
+// again. Values of equal PK of different segments are returned newest timestamp first,
+// and values of equal timestamp too as TournamentMergeReader ranks their readers, see
+// WithPKComparator and WithTieBreakKeys. The versions of a PK within a segment are
+// returned in the order read. The values are copied out of the records read, so they stay
+// valid past the next read.
+//
+// The readers of the segments are closed once they are drained. A segment failing to be
+// read fails the merge with its error, so that its rows are not dropped silently.
+func NewMergeSortPackedReader(pathsPerSegment [][]string, schema *schemapb.CollectionSchema,
+	bufferSize int64, pkFieldID FieldID, opts ...MergeReaderOption,
+) (*MergeSortPackedReader, error) {
+	pkField, err := typeutil.GetPrimaryFieldSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	if pkField.GetFieldID() != pkFieldID {
+		return nil, merr.WrapErrParameterInvalidMsg("merge sort by field %d which is not the primary key %d",
+			pkFieldID, pkField.GetFieldID())
+	}
+	readers := make([]*DeserializeReaderImpl[*Value], len(pathsPerSegment))
+	closeReaders := func() {
+		for _, reader := range readers {
+			if reader != nil {
+				reader.Close()
+			}
+		}
+	}
+	for i, paths := range pathsPerSegment {
+		// a segment stored in a single chunk
+		readers[i], err = NewPackedDeserializeReader([][]string{paths}, schema, bufferSize, true)
+		if err != nil {
+			closeReaders()
+			return nil, errors.Wrapf(err, "open input %d of merge", i)
+		}
+	}
+	merge, err := NewTournamentMergeReader(readers, append(opts[:len(opts):len(opts)], withAllVersions())...)
+	if err != nil {
+		// the readers drained are closed already
+		closeReaders()
+		return nil, err
+	}
+	return &MergeSortPackedReader{merge: merge}, nil
+}
+
+// NextValue returns the next value in PK order, or io.EOF once all segments are drained.
+func (mr *MergeSortPackedReader) NextValue() (*Value, error) {
+	return mr.merge.NextValue()
+}
+
+// Close closes the readers of the segments not drained yet.
+func (mr *MergeSortPackedReader) Close() error {
+	return mr.merge.Close()
+}
+
+// SortPackedSegment writes the rows of the packed segment at srcPaths to dstPaths, laid out
+// in columnGroups, ordered by sortKeys, for producing sorted segments of unsorted input too
+// large to sort in memory. It is an external merge sort: the rows are read in runs of about
+// bufferSize bytes, each run is sorted in memory and spilled to a packed file under
+// tempDir, and the runs are merged into dstPaths in a single pass, their read buffers
+// splitting bufferSize. A segment fitting in a single run is sorted straight into dstPaths.
+// Sorting a run holds it twice, so the memory used peaks at about twice bufferSize. Rows of
+// equal keys keep their order in srcPaths. The spilled runs are deleted on return.
+func SortPackedSegment(srcPaths, dstPaths []string, schema *schemapb.CollectionSchema,
+	columnGroups []storagecommon.ColumnGroup, sortKeys []SortKey, bufferSize int64, tempDir string,
+) (int64, error) {
+	if len(sortKeys) == 0 {
+		return 0, merr.WrapErrParameterInvalidMsg("no sort keys to sort packed segment by")
+	}
+	reader, err := newPackedRecordReader(srcPaths, schema, bufferSize, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	allFields := typeutil.GetAllFieldSchemas(schema)
+	runGroups := []storagecommon.ColumnGroup{{GroupID: storagecommon.DefaultShortColumnGroupID, Columns: lo.Range(len(allFields))}}
+	var runs []string
+	defer func() {
+		for _, run := range runs {
+			if err := packed.DeleteFile(run, nil); err != nil {
+				log.Warn("failed to delete sorted run of packed segment", zap.String("path", run), zap.Error(err))
+			}
+		}
+	}()
+
+	// buffered are the records of the current run, retained past the next read
+	var buffered []Record
+	var bufferedSize uint64
+	releaseBuffered := func() {
+		for _, rec := range buffered {
+			rec.Release()
+		}
+		buffered, bufferedSize = nil, 0
+	}
+	defer releaseBuffered()
+	writeRun := func(paths []string, groups []storagecommon.ColumnGroup) (int64, error) {
+		writer, err := NewPackedRecordWriter("", paths, schema, bufferSize, packed.DefaultMultiPartUploadSize, groups, nil, nil,
+			WithSortKeys(sortKeys, true))
+		if err != nil {
+			return 0, err
+		}
+		for _, rec := range buffered {
+			if err := writer.WriteBorrowed(rec); err != nil {
+				return 0, merr.Combine(err, writer.Abort())
+			}
+		}
+		releaseBuffered()
+		if err := writer.Close(); err != nil {
+			return 0, err
+		}
+		return writer.GetWrittenRowNum(), nil
+	}
+	spill := func() error {
+		run := path.Join(tempDir, fmt.Sprintf("sort_run_%d", len(runs)))
+		runs = append(runs, run)
+		_, err := writeRun([]string{run}, runGroups)
+		return err
+	}
+
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		rec.Retain()
+		buffered = append(buffered, rec)
+		for _, field := range allFields {
+			bufferedSize += calculateActualDataSize(rec.Column(field.GetFieldID()))
+		}
+		if bufferedSize >= uint64(bufferSize) {
+			if err := spill(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if len(runs) == 0 {
+		return writeRun(dstPaths, columnGroups)
+	}
+	if len(buffered) > 0 {
+		if err := spill(); err != nil {
+			return 0, err
+		}
+	}
+	return mergeSortedRuns(runs, dstPaths, schema, columnGroups, sortKeys, bufferSize)
+}
+
+// mergeSortedRuns merges the packed files of runs, each sorted by sortKeys, into dstPaths.
+// Rows of equal keys are taken from the earlier run first.
+func mergeSortedRuns(runs, dstPaths []string, schema *schemapb.CollectionSchema,
+	columnGroups []storagecommon.ColumnGroup, sortKeys []SortKey, bufferSize int64,
+) (int64, error) {
+	readBufferSize := max(bufferSize/int64(len(runs)), 1)
+	readers := make([]*packedRecordReader, len(runs))
+	// heads are the current records of the runs, retained as the comparator indexes them
+	// until the end of the merge, positions the next rows of heads to merge.
+	heads := make([]Record, len(runs))
+	positions := make([]int, len(runs))
+	defer func() {
+		for i := range runs {
+			if heads[i] != nil {
+				heads[i].Release()
+			}
+			if readers[i] != nil {
+				readers[i].Close()
+			}
+		}
+	}()
+	batchRows := 0
+	// advance moves run ri to its next non-empty record, it returns false once drained
+	advance := func(ri int) (bool, error) {
+		for {
+			rec, err := readers[ri].Next()
+			if err == io.EOF {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			if rec.Len() == 0 {
+				continue
+			}
+			rec.Retain()
+			if heads[ri] != nil {
+				heads[ri].Release()
+			}
+			heads[ri], positions[ri] = rec, 0
+			batchRows = max(batchRows, rec.Len())
+			return true, nil
+		}
+	}
+
+	var compare func(x, y rowRef) int
+	pq := NewPriorityQueue(func(x, y *int) bool {
+		if c := compare(rowRef{*x, positions[*x]}, rowRef{*y, positions[*y]}); c != 0 {
+			return c < 0
+		}
+		return *x < *y
+	})
+	var active []int
+	for ri, run := range runs {
+		var err error
+		readers[ri], err = newPackedRecordReader([]string{run}, schema, readBufferSize, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		ok, err := advance(ri)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			active = append(active, ri)
+		}
+	}
+	var err error
+	if compare, err = rowComparator(heads, sortKeys); err != nil {
+		return 0, err
+	}
+	for _, ri := range active {
+		pq.Enqueue(&ri)
+	}
+
+	writer, err := NewPackedRecordWriter("", dstPaths, schema, bufferSize, packed.DefaultMultiPartUploadSize, columnGroups, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	rb := NewRecordBuilder(schema)
+	flush := func() error {
+		rec := rb.Build()
+		defer rec.Release()
+		return writer.WriteBorrowed(rec)
+	}
+	merge := func() error {
+		for pq.Len() > 0 {
+			ri := *pq.Dequeue()
+			if err := rb.Append(heads[ri], positions[ri], positions[ri]+1); err != nil {
+				return err
+			}
+			if rb.GetRowNum() >= batchRows {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			positions[ri]++
+			if positions[ri] == heads[ri].Len() {
+				ok, err := advance(ri)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+				if compare, err = rowComparator(heads, sortKeys); err != nil {
+					return err
+				}
+			}
+			pq.Enqueue(&ri)
+		}
+		if rb.GetRowNum() > 0 {
+			return flush()
+		}
+		return nil
+	}
+	if err := merge(); err != nil {
+		return 0, merr.Combine(err, writer.Abort())
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return writer.GetWrittenRowNum(), nil
+}
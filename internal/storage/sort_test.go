@@ -17,12 +17,22 @@
 package storage
 
 import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
 	"testing"
 
+	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/milvus-io/milvus/internal/storagecommon"
+	"github.com/milvus-io/milvus/internal/storagev2/packed"
 	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 )
 
 func TestSort(t *testing.T) {
@@ -197,3 +207,388 @@ func TestSortByMoreThanOneField(t *testing.T) {
 	assert.Equal(t, batchSize*2, gotNumRows)
 	assert.NoError(t, rw.Close())
 }
+
+// valueBatchRecord is a record carrying prebuilt values instead of arrow columns.
+type valueBatchRecord struct {
+	values []*Value
+}
+
+func (r *valueBatchRecord) Column(i FieldID) arrow.Array { return nil }
+func (r *valueBatchRecord) Len() int                     { return len(r.values) }
+func (r *valueBatchRecord) Release()                     {}
+func (r *valueBatchRecord) Retain()                      {}
+
+type valueBatchRecordReader struct {
+	values    []*Value
+	batchSize int
+}
+
+func (r *valueBatchRecordReader) Next() (Record, error) {
+	if len(r.values) == 0 {
+		return nil, io.EOF
+	}
+	n := min(r.batchSize, len(r.values))
+	rec := &valueBatchRecord{values: r.values[:n]}
+	r.values = r.values[n:]
+	return rec, nil
+}
+
+func (r *valueBatchRecordReader) Close() error { return nil }
+
+// newValueSliceReader returns a reader over values in batches of batchSize.
+func newValueSliceReader(values []*Value, batchSize int) *DeserializeReaderImpl[*Value] {
+	rr := &valueBatchRecordReader{values: values, batchSize: batchSize}
+	return NewDeserializeReader(rr, copyValueBatch)
+}
+
+// copyValueBatch is the deserializer of valueBatchRecord.
+func copyValueBatch(r Record, v []*Value) error {
+	copy(v, r.(*valueBatchRecord).values)
+	return nil
+}
+
+func newTestValue(pk int64, ts int64) *Value {
+	return &Value{ID: pk, PK: NewInt64PrimaryKey(pk), Timestamp: ts}
+}
+
+func readAllMerged(t *testing.T, mr *TournamentMergeReader) []*Value {
+	var values []*Value
+	for {
+		v, err := mr.NextValue()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		values = append(values, v)
+	}
+	require.NoError(t, mr.Close())
+	return values
+}
+
+func TestTournamentMergeReader(t *testing.T) {
+	t.Run("interleaved with duplicates", func(t *testing.T) {
+		sources := [][]*Value{
+			{newTestValue(1, 10), newTestValue(4, 10), newTestValue(7, 10)},
+			{newTestValue(2, 20), newTestValue(4, 30), newTestValue(8, 20)},
+			{},
+			// versions of the same PK within one source in any order
+			{newTestValue(3, 5), newTestValue(7, 1), newTestValue(7, 40), newTestValue(7, 2)},
+		}
+		readers := make([]*DeserializeReaderImpl[*Value], len(sources))
+		for i, values := range sources {
+			readers[i] = newValueSliceReader(values, 2)
+		}
+		mr, err := NewTournamentMergeReader(readers)
+		require.NoError(t, err)
+
+		values := readAllMerged(t, mr)
+		type pkTs struct{ pk, ts int64 }
+		got := make([]pkTs, 0, len(values))
+		for _, v := range values {
+			got = append(got, pkTs{v.PK.GetValue().(int64), v.Timestamp})
+		}
+		assert.Equal(t, []pkTs{{1, 10}, {2, 20}, {3, 5}, {4, 30}, {7, 40}, {8, 20}}, got)
+	})
+
+	t.Run("custom comparator", func(t *testing.T) {
+		reversed := PKComparatorFunc(func(a, b PrimaryKey) int {
+			return -Int64PKComparator.Compare(a, b)
+		})
+		sources := [][]*Value{
+			{newTestValue(9, 1), newTestValue(5, 1), newTestValue(2, 1)},
+			{newTestValue(8, 1), newTestValue(5, 7), newTestValue(1, 1)},
+		}
+		readers := make([]*DeserializeReaderImpl[*Value], len(sources))
+		for i, values := range sources {
+			readers[i] = newValueSliceReader(values, 2)
+		}
+		mr, err := NewTournamentMergeReader(readers, WithPKComparator(reversed))
+		require.NoError(t, err)
+		values := readAllMerged(t, mr)
+		assert.Equal(t, []int64{9, 8, 5, 2, 1}, lo.Map(values, func(v *Value, _ int) int64 { return v.ID }))
+		assert.Equal(t, int64(7), values[2].Timestamp)
+	})
+
+	t.Run("tie break", func(t *testing.T) {
+		// both segments hold PK 4 at the same timestamp
+		segments := map[int64][]*Value{
+			10: {newTestValue(1, 1), newTestValue(4, 5)},
+			20: {newTestValue(4, 5), newTestValue(6, 1)},
+		}
+		for _, v := range segments[10] {
+			v.Value = "segment 10"
+		}
+		for _, v := range segments[20] {
+			v.Value = "segment 20"
+		}
+		merge := func(order []int64, opts ...MergeReaderOption) *Value {
+			readers := lo.Map(order, func(id int64, _ int) *DeserializeReaderImpl[*Value] {
+				return newValueSliceReader(segments[id], 1)
+			})
+			mr, err := NewTournamentMergeReader(readers, opts...)
+			require.NoError(t, err)
+			values := readAllMerged(t, mr)
+			require.Len(t, values, 3)
+			assert.True(t, values[1].PK.EQ(NewInt64PrimaryKey(4)))
+			return values[1]
+		}
+		// the first reader wins by default
+		assert.Equal(t, "segment 10", merge([]int64{10, 20}).Value)
+		assert.Equal(t, "segment 20", merge([]int64{20, 10}).Value)
+		// the lowest segment ID wins whatever the order of the readers
+		for _, order := range [][]int64{{10, 20}, {20, 10}} {
+			assert.Equal(t, "segment 10", merge(order, WithTieBreakKeys(order)).Value)
+		}
+
+		_, err := NewTournamentMergeReader([]*DeserializeReaderImpl[*Value]{newValueSliceReader(nil, 1)}, WithTieBreakKeys([]int64{1, 2}))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("no readers", func(t *testing.T) {
+		mr, err := NewTournamentMergeReader(nil)
+		require.NoError(t, err)
+		assert.Empty(t, readAllMerged(t, mr))
+	})
+
+	t.Run("single reader", func(t *testing.T) {
+		mr, err := NewTournamentMergeReader([]*DeserializeReaderImpl[*Value]{
+			newValueSliceReader([]*Value{newTestValue(1, 1), newTestValue(1, 3), newTestValue(2, 1)}, 10),
+		})
+		require.NoError(t, err)
+		values := readAllMerged(t, mr)
+		require.Len(t, values, 2)
+		assert.Equal(t, int64(3), values[0].Timestamp)
+		assert.True(t, values[1].PK.EQ(NewInt64PrimaryKey(2)))
+	})
+
+	t.Run("all empty", func(t *testing.T) {
+		readers := make([]*DeserializeReaderImpl[*Value], 5)
+		for i := range readers {
+			readers[i] = newValueSliceReader(nil, 1)
+		}
+		mr, err := NewTournamentMergeReader(readers)
+		require.NoError(t, err)
+		assert.Empty(t, readAllMerged(t, mr))
+	})
+
+	t.Run("random", func(t *testing.T) {
+		r := rand.New(rand.NewSource(0))
+		for k := 1; k <= 33; k++ {
+			expected := map[int64]int64{}
+			readers := make([]*DeserializeReaderImpl[*Value], k)
+			for i := range readers {
+				values := make([]*Value, r.Intn(20))
+				for j := range values {
+					values[j] = newTestValue(r.Int63n(100), r.Int63n(1000))
+					if ts, ok := expected[values[j].ID]; !ok || values[j].Timestamp > ts {
+						expected[values[j].ID] = values[j].Timestamp
+					}
+				}
+				sort.SliceStable(values, func(a, b int) bool { return values[a].ID < values[b].ID })
+				readers[i] = newValueSliceReader(values, 1+r.Intn(4))
+			}
+			mr, err := NewTournamentMergeReader(readers)
+			require.NoError(t, err)
+
+			values := readAllMerged(t, mr)
+			require.Len(t, values, len(expected), fmt.Sprint("k=", k))
+			for i, v := range values {
+				if i > 0 {
+					assert.True(t, values[i-1].PK.LT(v.PK))
+				}
+				assert.Equal(t, expected[v.ID], v.Timestamp)
+			}
+		}
+	})
+}
+
+func BenchmarkTournamentMerge(b *testing.B) {
+	const k, n = 64, 1000
+	sources := make([][]*Value, k)
+	for i := range sources {
+		sources[i] = make([]*Value, n)
+		for j := range sources[i] {
+			sources[i][j] = newTestValue(int64(j*k+i), 1)
+		}
+	}
+	newReaders := func() []*DeserializeReaderImpl[*Value] {
+		readers := make([]*DeserializeReaderImpl[*Value], k)
+		for i, values := range sources {
+			readers[i] = newValueSliceReader(values, 128)
+		}
+		return readers
+	}
+
+	b.Run("loser tree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mr, _ := NewTournamentMergeReader(newReaders())
+			for {
+				if _, err := mr.NextValue(); err != nil {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("heap", func(b *testing.B) {
+		type head struct {
+			v  *Value
+			ri int
+		}
+		for i := 0; i < b.N; i++ {
+			readers := newReaders()
+			pq := NewPriorityQueue(func(x, y *head) bool {
+				return x.v.PK.LT(y.v.PK)
+			})
+			for ri, reader := range readers {
+				if v, err := reader.NextValue(); err == nil {
+					pq.Enqueue(&head{*v, ri})
+				}
+			}
+			for pq.Len() > 0 {
+				h := pq.Dequeue()
+				if v, err := readers[h.ri].NextValue(); err == nil {
+					pq.Enqueue(&head{*v, h.ri})
+				}
+			}
+		}
+	})
+}
+
+func TestMergeSortPackedReader(t *testing.T) {
+	segments := [][]string{{"/tmp/merge_sort_packed/0"}, {"/tmp/merge_sort_packed/1"}}
+	writePackedTestSegment(t, segments[0], 5)
+	writePackedTestSegment(t, segments[1], 8)
+	schema := generateTestSchema()
+
+	t.Run("pk order", func(t *testing.T) {
+		mr, err := NewMergeSortPackedReader(segments, schema, 10*1024*1024, common.RowIDField)
+		require.NoError(t, err)
+		var pks []int64
+		for {
+			v, err := mr.NextValue()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			pks = append(pks, v.PK.GetValue().(int64))
+		}
+		// both versions of the PKs in both segments come through
+		assert.Equal(t, []int64{1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8}, pks)
+		// the drained readers are closed already
+		assert.Equal(t, []*DeserializeReaderImpl[*Value]{nil, nil}, mr.merge.readers)
+		require.NoError(t, mr.Close())
+	})
+
+	t.Run("newest first", func(t *testing.T) {
+		mr, err := NewMergeSortPackedReader(nil, schema, 1024, common.RowIDField)
+		require.NoError(t, err)
+		_, err = mr.NextValue()
+		assert.Equal(t, io.EOF, err)
+
+		sources := [][]*Value{
+			{newTestValue(1, 5), newTestValue(2, 1)},
+			{newTestValue(1, 5)},
+			{newTestValue(1, 9)},
+		}
+		for i, values := range sources {
+			for _, v := range values {
+				v.Value = i
+			}
+		}
+		merge := func(opts ...MergeReaderOption) []*Value {
+			readers := lo.Map(sources, func(values []*Value, _ int) *DeserializeReaderImpl[*Value] {
+				return newValueSliceReader(values, 1)
+			})
+			merge, err := NewTournamentMergeReader(readers, append(opts, withAllVersions())...)
+			require.NoError(t, err)
+			return readAllMerged(t, merge)
+		}
+		assert.Equal(t, []*Value{sources[2][0], sources[0][0], sources[1][0], sources[0][1]}, merge())
+		assert.Equal(t, []*Value{sources[2][0], sources[1][0], sources[0][0], sources[0][1]},
+			merge(WithTieBreakKeys([]int64{20, 10, 30})))
+	})
+
+	t.Run("not the primary key", func(t *testing.T) {
+		_, err := NewMergeSortPackedReader(segments, schema, 1024, common.TimeStampField)
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+		_, err = NewMergeSortPackedReader(segments, schema, 1024, common.RowIDField, WithTieBreakKeys([]int64{1}))
+		assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+	})
+
+	t.Run("malformed segment", func(t *testing.T) {
+		_, err := NewMergeSortPackedReader([][]string{segments[0], {"/tmp/merge_sort_packed/missing"}},
+			schema, 1024, common.RowIDField)
+		assert.ErrorContains(t, err, "input 1 of merge")
+	})
+}
+
+func TestSortPackedSegment(t *testing.T) {
+	size := 30
+	srcPaths := []string{"/tmp/sort_packed_segment/src"}
+	writePackedTestSegment(t, srcPaths, size)
+	schema := generateTestSchema()
+	group := storagecommon.ColumnGroup{GroupID: storagecommon.DefaultShortColumnGroupID}
+	for i := 0; i < len(schema.Fields); i++ {
+		group.Columns = append(group.Columns, i)
+	}
+
+	readPKs := func(paths []string) []int64 {
+		reader, err := newPackedRecordReader(paths, schema, 10*1024*1024, nil, nil)
+		require.NoError(t, err)
+		defer reader.Close()
+		var pks []int64
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				return pks
+			}
+			require.NoError(t, err)
+			pks = append(pks, rec.Column(common.RowIDField).(*array.Int64).Int64Values()...)
+		}
+	}
+	ascending := make([]int64, size)
+	descending := make([]int64, size)
+	for i := range ascending {
+		ascending[i] = int64(i + 1)
+		descending[i] = int64(size - i)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		bufferSize int64
+	}{
+		{"in memory", 10 * 1024 * 1024},
+		// every batch of 7 rows is a run of its own
+		{"external", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := fmt.Sprintf("/tmp/sort_packed_segment/%s_runs", tc.name)
+			dstPaths := []string{fmt.Sprintf("/tmp/sort_packed_segment/%s_desc", tc.name)}
+			rows, err := SortPackedSegment(srcPaths, dstPaths, schema, []storagecommon.ColumnGroup{group},
+				[]SortKey{{FieldID: common.RowIDField, Descending: true}}, tc.bufferSize, tempDir)
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), rows)
+			assert.Equal(t, descending, readPKs(dstPaths))
+
+			// all rows hold the same bool, so the rows keep their order
+			dstPaths = []string{fmt.Sprintf("/tmp/sort_packed_segment/%s_stable", tc.name)}
+			_, err = SortPackedSegment(srcPaths, dstPaths, schema, []storagecommon.ColumnGroup{group},
+				[]SortKey{{FieldID: 10}}, tc.bufferSize, tempDir)
+			require.NoError(t, err)
+			assert.Equal(t, ascending, readPKs(dstPaths))
+
+			// the runs are deleted
+			for i := 0; i < 5; i++ {
+				size, err := packed.GetFileSize(fmt.Sprintf("%s/sort_run_%d", tempDir, i), nil)
+				if err == nil {
+					assert.Negative(t, size)
+				}
+			}
+		})
+	}
+
+	_, err := SortPackedSegment(srcPaths, []string{"/tmp/sort_packed_segment/none"}, schema,
+		[]storagecommon.ColumnGroup{group}, nil, 1024, "/tmp/sort_packed_segment/runs")
+	assert.ErrorIs(t, err, merr.ErrParameterInvalid)
+}
@@ -18,6 +18,7 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
 	"maps"
@@ -533,3 +534,45 @@ func DeserializeStatsList(blob *Blob) ([]*PrimaryKeyStats, error) {
 	}
 	return stats, nil
 }
+
+// ContainsAnyPK reports whether the segment described by the pk stats log at bloomPath
+// may contain any of pks, checking the pk range and the bloom filter without opening
+// the data files. It returns true when no stats log exists, as nothing can be ruled out.
+func ContainsAnyPK(ctx context.Context, cm ChunkManager, bloomPath string, pks []PrimaryKey) (bool, error) {
+	exist, err := cm.Exist(ctx, bloomPath)
+	if err != nil {
+		return false, err
+	}
+	if !exist {
+		return true, nil
+	}
+	value, err := cm.Read(ctx, bloomPath)
+	if err != nil {
+		return false, err
+	}
+
+	// compound stats are stored as a json list, a single stats as a json object
+	var statsList []*PrimaryKeyStats
+	if bytes.HasPrefix(bytes.TrimSpace(value), []byte("[")) {
+		statsList, err = DeserializeStatsList(&Blob{Key: bloomPath, Value: value})
+	} else {
+		statsList, err = DeserializeStats([]*Blob{{Key: bloomPath, Value: value}})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, stats := range statsList {
+		st := &PkStatistics{
+			PkFilter: stats.BF,
+			MinPK:    stats.MinPk,
+			MaxPK:    stats.MaxPk,
+		}
+		for _, pk := range pks {
+			if st.PkExist(pk) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -17,6 +17,8 @@
 package storage
 
 import (
+	"context"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,6 +27,7 @@ import (
 	"github.com/milvus-io/milvus/internal/json"
 	"github.com/milvus-io/milvus/internal/util/bloomfilter"
 	"github.com/milvus-io/milvus/pkg/v2/common"
+	"github.com/milvus-io/milvus/pkg/v2/objectstorage"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 	"github.com/milvus-io/milvus/pkg/v2/util/paramtable"
 )
@@ -204,3 +207,51 @@ func TestMarshalStats(t *testing.T) {
 		assert.True(t, stat1[0].BF.Test(b))
 	}
 }
+
+func TestContainsAnyPK(t *testing.T) {
+	ctx := context.Background()
+	rootPath := t.TempDir()
+	cm := NewLocalChunkManager(objectstorage.RootPath(rootPath))
+
+	sw := &StatsWriter{}
+	err := sw.GenerateByData(common.RowIDField, schemapb.DataType_Int64, &Int64FieldData{Data: []int64{10, 20, 30}})
+	assert.NoError(t, err)
+	statsPath := path.Join(rootPath, "stats")
+	assert.NoError(t, cm.Write(ctx, statsPath, sw.GetBuffer()))
+
+	stat, err := NewPrimaryKeyStats(common.RowIDField, int64(schemapb.DataType_Int64), 10)
+	assert.NoError(t, err)
+	stat.Update(NewInt64PrimaryKey(100))
+	stat.Update(NewInt64PrimaryKey(200))
+	listWriter := &StatsWriter{}
+	assert.NoError(t, listWriter.GenerateList([]*PrimaryKeyStats{stat}))
+	listPath := path.Join(rootPath, "compound_stats")
+	assert.NoError(t, cm.Write(ctx, listPath, listWriter.GetBuffer()))
+
+	tests := []struct {
+		name     string
+		path     string
+		pks      []PrimaryKey
+		expected bool
+	}{
+		{"hit", statsPath, []PrimaryKey{NewInt64PrimaryKey(1), NewInt64PrimaryKey(20)}, true},
+		{"out of range", statsPath, []PrimaryKey{NewInt64PrimaryKey(1), NewInt64PrimaryKey(40)}, false},
+		{"compound hit", listPath, []PrimaryKey{NewInt64PrimaryKey(200)}, true},
+		{"compound out of range", listPath, []PrimaryKey{NewInt64PrimaryKey(1)}, false},
+		{"no stats log", path.Join(rootPath, "not_exist"), []PrimaryKey{NewInt64PrimaryKey(1)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contains, err := ContainsAnyPK(ctx, cm, tt.path, tt.pks)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, contains)
+		})
+	}
+
+	t.Run("corrupted stats log", func(t *testing.T) {
+		corruptedPath := path.Join(rootPath, "corrupted")
+		assert.NoError(t, cm.Write(ctx, corruptedPath, []byte("{corrupted")))
+		_, err := ContainsAnyPK(ctx, cm, corruptedPath, []PrimaryKey{NewInt64PrimaryKey(1)})
+		assert.Error(t, err)
+	})
+}
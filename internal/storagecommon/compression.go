@@ -0,0 +1,69 @@
+// Licensed to the LF AI & Data foundation under one
+// or more contributor license agreements. See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership. The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storagecommon
+
+import "fmt"
+
+// CompressionCodec is the codec the columns of a column group are compressed with.
+// The values match CPackedCompressionCodec of the packed writer.
+type CompressionCodec int32
+
+const (
+	// CompressionDefault keeps the codec of the packed writer.
+	CompressionDefault CompressionCodec = iota
+	CompressionNone
+	CompressionSnappy
+	CompressionZstd
+	CompressionLZ4
+)
+
+func (c CompressionCodec) String() string {
+	switch c {
+	case CompressionDefault:
+		return "default"
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionLZ4:
+		return "lz4"
+	}
+	return fmt.Sprintf("CompressionCodec(%d)", int32(c))
+}
+
+// CompressionSpec is the compression of a column group. Level 0 keeps the default
+// level of the codec, other levels are only taken by zstd and lz4.
+type CompressionSpec struct {
+	Codec CompressionCodec
+	Level int
+}
+
+// Validate checks that the codec is known and takes the level.
+func (s CompressionSpec) Validate() error {
+	switch s.Codec {
+	case CompressionDefault, CompressionNone, CompressionSnappy:
+		if s.Level != 0 {
+			return fmt.Errorf("compression %s takes no level, got %d", s.Codec, s.Level)
+		}
+	case CompressionZstd, CompressionLZ4:
+	default:
+		return fmt.Errorf("unknown compression codec %d", int32(s.Codec))
+	}
+	return nil
+}
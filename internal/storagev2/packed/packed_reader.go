@@ -36,7 +36,109 @@ import (
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 )
 
-func NewPackedReader(filePaths []string, schema *arrow.Schema, bufferSize int64, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext) (*PackedReader, error) {
+type readerOptions struct {
+	readPolicy *C.CReadPolicy
+	fileSystem *FileSystem
+}
+
+// ReaderOption tunes the reads of PackedReader.
+type ReaderOption func(*readerOptions)
+
+// WithReadPolicy coalesces the column chunk reads of the files, planned from their
+// footers: chunks closer than maxGap bytes are read by one request, unless it would span
+// more than maxSpan bytes, 0 for no cap. The reads are counted, see ReadStats.
+func WithReadPolicy(maxSpan, maxGap int64) ReaderOption {
+	return func(o *readerOptions) {
+		o.readPolicy = &C.CReadPolicy{max_span: C.int64_t(maxSpan), max_gap: C.int64_t(maxGap)}
+	}
+}
+
+// WithFileSystem opens the files on fs instead of the filesystem of the storage config,
+// sharing the filesystem and its connections with the other readers opened on fs.
+func WithFileSystem(fs *FileSystem) ReaderOption {
+	return func(o *readerOptions) {
+		o.fileSystem = fs
+	}
+}
+
+// NewFileSystem holds the native filesystem of storageConfig, or of the configured
+// storage if nil, for the readers opened WithFileSystem, until closed.
+func NewFileSystem(storageConfig *indexpb.StorageConfig) (*FileSystem, error) {
+	var cFs C.CPackedFileSystem
+	var status C.CStatus
+	if storageConfig != nil {
+		cStorageConfig, free := newCStorageConfig(storageConfig)
+		defer free()
+		status = C.NewPackedFileSystem(&cStorageConfig, &cFs)
+	} else {
+		status = C.NewPackedFileSystem(nil, &cFs)
+	}
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return nil, err
+	}
+	return &FileSystem{cFs: cFs}, nil
+}
+
+// Close releases the filesystem, the readers opened on it keep it until they are closed.
+func (fs *FileSystem) Close() error {
+	if fs.cFs == nil {
+		return nil
+	}
+	status := C.ClosePackedFileSystem(fs.cFs)
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return err
+	}
+	fs.cFs = nil
+	return nil
+}
+
+// newCStorageConfig returns the C storage config of storageConfig, and the func freeing
+// its strings.
+func newCStorageConfig(storageConfig *indexpb.StorageConfig) (C.CStorageConfig, func()) {
+	cStorageConfig := C.CStorageConfig{
+		address:                C.CString(storageConfig.GetAddress()),
+		bucket_name:            C.CString(storageConfig.GetBucketName()),
+		access_key_id:          C.CString(storageConfig.GetAccessKeyID()),
+		access_key_value:       C.CString(storageConfig.GetSecretAccessKey()),
+		root_path:              C.CString(storageConfig.GetRootPath()),
+		storage_type:           C.CString(storageConfig.GetStorageType()),
+		cloud_provider:         C.CString(storageConfig.GetCloudProvider()),
+		iam_endpoint:           C.CString(storageConfig.GetIAMEndpoint()),
+		log_level:              C.CString("warn"),
+		useSSL:                 C.bool(storageConfig.GetUseSSL()),
+		sslCACert:              C.CString(storageConfig.GetSslCACert()),
+		useIAM:                 C.bool(storageConfig.GetUseIAM()),
+		region:                 C.CString(storageConfig.GetRegion()),
+		useVirtualHost:         C.bool(storageConfig.GetUseVirtualHost()),
+		requestTimeoutMs:       C.int64_t(storageConfig.GetRequestTimeoutMs()),
+		gcp_credential_json:    C.CString(storageConfig.GetGcpCredentialJSON()),
+		use_custom_part_upload: true,
+		max_connections:        C.uint32_t(storageConfig.GetMaxConnections()),
+	}
+	return cStorageConfig, func() {
+		C.free(unsafe.Pointer(cStorageConfig.address))
+		C.free(unsafe.Pointer(cStorageConfig.bucket_name))
+		C.free(unsafe.Pointer(cStorageConfig.access_key_id))
+		C.free(unsafe.Pointer(cStorageConfig.access_key_value))
+		C.free(unsafe.Pointer(cStorageConfig.root_path))
+		C.free(unsafe.Pointer(cStorageConfig.storage_type))
+		C.free(unsafe.Pointer(cStorageConfig.cloud_provider))
+		C.free(unsafe.Pointer(cStorageConfig.iam_endpoint))
+		C.free(unsafe.Pointer(cStorageConfig.log_level))
+		C.free(unsafe.Pointer(cStorageConfig.sslCACert))
+		C.free(unsafe.Pointer(cStorageConfig.region))
+		C.free(unsafe.Pointer(cStorageConfig.gcp_credential_json))
+	}
+}
+
+func NewPackedReader(filePaths []string, schema *arrow.Schema, bufferSize int64, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext, opts ...ReaderOption) (*PackedReader, error) {
+	options := &readerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.fileSystem != nil && options.fileSystem.cFs == nil {
+		return nil, fmt.Errorf("open packed reader on a closed file system")
+	}
 	cFilePaths := make([]*C.char, len(filePaths))
 	for i, path := range filePaths {
 		cFilePaths[i] = C.CString(path)
@@ -66,43 +168,14 @@ func NewPackedReader(filePaths []string, schema *arrow.Schema, bufferSize int64,
 		pluginContextPtr = &pluginContext
 	}
 
-	if storageConfig != nil {
-		cStorageConfig := C.CStorageConfig{
-			address:                C.CString(storageConfig.GetAddress()),
-			bucket_name:            C.CString(storageConfig.GetBucketName()),
-			access_key_id:          C.CString(storageConfig.GetAccessKeyID()),
-			access_key_value:       C.CString(storageConfig.GetSecretAccessKey()),
-			root_path:              C.CString(storageConfig.GetRootPath()),
-			storage_type:           C.CString(storageConfig.GetStorageType()),
-			cloud_provider:         C.CString(storageConfig.GetCloudProvider()),
-			iam_endpoint:           C.CString(storageConfig.GetIAMEndpoint()),
-			log_level:              C.CString("warn"),
-			useSSL:                 C.bool(storageConfig.GetUseSSL()),
-			sslCACert:              C.CString(storageConfig.GetSslCACert()),
-			useIAM:                 C.bool(storageConfig.GetUseIAM()),
-			region:                 C.CString(storageConfig.GetRegion()),
-			useVirtualHost:         C.bool(storageConfig.GetUseVirtualHost()),
-			requestTimeoutMs:       C.int64_t(storageConfig.GetRequestTimeoutMs()),
-			gcp_credential_json:    C.CString(storageConfig.GetGcpCredentialJSON()),
-			use_custom_part_upload: true,
-			max_connections:        C.uint32_t(storageConfig.GetMaxConnections()),
-		}
-		defer C.free(unsafe.Pointer(cStorageConfig.address))
-		defer C.free(unsafe.Pointer(cStorageConfig.bucket_name))
-		defer C.free(unsafe.Pointer(cStorageConfig.access_key_id))
-		defer C.free(unsafe.Pointer(cStorageConfig.access_key_value))
-		defer C.free(unsafe.Pointer(cStorageConfig.root_path))
-		defer C.free(unsafe.Pointer(cStorageConfig.storage_type))
-		defer C.free(unsafe.Pointer(cStorageConfig.cloud_provider))
-		defer C.free(unsafe.Pointer(cStorageConfig.iam_endpoint))
-		defer C.free(unsafe.Pointer(cStorageConfig.log_level))
-		defer C.free(unsafe.Pointer(cStorageConfig.sslCACert))
-		defer C.free(unsafe.Pointer(cStorageConfig.region))
-		defer C.free(unsafe.Pointer(cStorageConfig.gcp_credential_json))
-
-		status = C.NewPackedReaderWithStorageConfig(cFilePathsArray, cNumPaths, cSchema, cBufferSize, cStorageConfig, &cPackedReader, pluginContextPtr)
+	if options.fileSystem != nil {
+		status = C.NewPackedReaderWithFileSystem(cFilePathsArray, cNumPaths, cSchema, cBufferSize, options.fileSystem.cFs, &cPackedReader, pluginContextPtr, options.readPolicy)
+	} else if storageConfig != nil {
+		cStorageConfig, free := newCStorageConfig(storageConfig)
+		defer free()
+		status = C.NewPackedReaderWithStorageConfig(cFilePathsArray, cNumPaths, cSchema, cBufferSize, cStorageConfig, &cPackedReader, pluginContextPtr, options.readPolicy)
 	} else {
-		status = C.NewPackedReader(cFilePathsArray, cNumPaths, cSchema, cBufferSize, &cPackedReader, pluginContextPtr)
+		status = C.NewPackedReader(cFilePathsArray, cNumPaths, cSchema, cBufferSize, &cPackedReader, pluginContextPtr, options.readPolicy)
 	}
 	if err := ConsumeCStatusIntoError(&status); err != nil {
 		return nil, err
@@ -148,6 +221,51 @@ func (pr *PackedReader) ReadNext() (arrow.Record, error) {
 	return recordBatch, nil
 }
 
+// ScratchStats returns the number of page and decompression buffers the native reader
+// allocated so far, and how many of them reused a buffer it freed before, see
+// ScratchBufferPool.
+func (pr *PackedReader) ScratchStats() (allocations int64, reused int64, err error) {
+	if pr.cPackedReader == nil {
+		return 0, 0, nil
+	}
+	var cAllocations, cReused C.int64_t
+	status := C.GetPackedReaderScratchStats(pr.cPackedReader, &cAllocations, &cReused)
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return 0, 0, err
+	}
+	return int64(cAllocations), int64(cReused), nil
+}
+
+// ReadStats counts the reads of a PackedReader opened WithReadPolicy: Ranges are the reads
+// asked by the parquet reader, Requests those issued to storage for them, the GETs of an
+// object store, and BytesRead the bytes these read, of which WastedBytes only to
+// coalesce the reads around them.
+type ReadStats struct {
+	Ranges      int64
+	Requests    int64
+	BytesRead   int64
+	WastedBytes int64
+}
+
+// ReadStats returns the reads of the native reader so far, all 0 unless opened
+// WithReadPolicy.
+func (pr *PackedReader) ReadStats() (ReadStats, error) {
+	if pr.cPackedReader == nil {
+		return ReadStats{}, nil
+	}
+	var ranges, requests, bytesRead, wastedBytes C.int64_t
+	status := C.GetPackedReaderReadStats(pr.cPackedReader, &ranges, &requests, &bytesRead, &wastedBytes)
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return ReadStats{}, err
+	}
+	return ReadStats{
+		Ranges:      int64(ranges),
+		Requests:    int64(requests),
+		BytesRead:   int64(bytesRead),
+		WastedBytes: int64(wastedBytes),
+	}, nil
+}
+
 func (pr *PackedReader) Close() error {
 	if pr.cPackedReader == nil {
 		return nil
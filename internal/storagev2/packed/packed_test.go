@@ -16,11 +16,13 @@ package packed
 
 import (
 	"io"
+	"os"
 	"testing"
 
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/array"
 	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/exp/rand"
 
@@ -99,6 +101,30 @@ func (suite *PackedTestSuite) TestPackedOneFile() {
 	suite.Equal(int64(3*batches), rr.NumRows())
 }
 
+func (suite *PackedTestSuite) TestPackedReaderWithFileSystem() {
+	paths := []string{"/tmp/file_system"}
+	columnGroups := []storagecommon.ColumnGroup{{Columns: []int{0, 1, 2}, GroupID: storagecommon.DefaultShortColumnGroupID}}
+	bufferSize := int64(10 * 1024 * 1024) // 10MB
+	pw, err := NewPackedWriter(paths, suite.schema, bufferSize, 0, columnGroups, nil, nil)
+	suite.NoError(err)
+	suite.NoError(pw.WriteRecordBatch(suite.rec))
+	suite.NoError(pw.Close())
+
+	fs, err := NewFileSystem(nil)
+	suite.Require().NoError(err)
+	reader, err := NewPackedReader(paths, suite.schema, bufferSize, nil, nil, WithFileSystem(fs))
+	suite.Require().NoError(err)
+	// the reader keeps the filesystem past its close
+	suite.NoError(fs.Close())
+	rr, err := reader.ReadNext()
+	suite.NoError(err)
+	suite.Equal(int64(3), rr.NumRows())
+	suite.NoError(reader.Close())
+
+	_, err = NewPackedReader(paths, suite.schema, bufferSize, nil, nil, WithFileSystem(fs))
+	suite.Error(err)
+}
+
 func (suite *PackedTestSuite) TestPackedMultiFiles() {
 	batches := 1000
 
@@ -163,6 +189,46 @@ func (suite *PackedTestSuite) TestPackedMultiFiles() {
 	suite.Equal(int64(arrLen*batches), rows)
 }
 
+func (suite *PackedTestSuite) TestPackedGroupBufferSizes() {
+	paths := []string{"/tmp/group_buffer_sizes/0", "/tmp/group_buffer_sizes/1"}
+	columnGroups := []storagecommon.ColumnGroup{{Columns: []int{2}, GroupID: 2}, {Columns: []int{0, 1}, GroupID: storagecommon.DefaultShortColumnGroupID}}
+	bufferSize := int64(10 * 1024 * 1024) // 10MB
+	pw, err := NewPackedWriter(paths, suite.schema, bufferSize, 0, columnGroups, nil, nil, WithGroupBufferSizes([]int64{1024, 0}))
+	suite.Require().NoError(err)
+	suite.NoError(pw.WriteRecordBatch(suite.rec))
+	suite.Require().NoError(pw.Close())
+
+	// every file holds the columns of its group only
+	fileSchema, err := GetFileSchema(paths[0], nil)
+	suite.Require().NoError(err)
+	suite.Equal([]string{"c"}, lo.Map(fileSchema.Fields(), func(f arrow.Field, _ int) string { return f.Name }))
+	reader, err := NewPackedReader(paths, suite.schema, bufferSize, nil, nil)
+	suite.Require().NoError(err)
+	rr, err := reader.ReadNext()
+	suite.Require().NoError(err)
+	suite.Equal(int64(3), rr.NumRows())
+	suite.NoError(reader.Close())
+
+	// aborting removes the files of all groups
+	pw, err = NewPackedWriter(paths, suite.schema, bufferSize, 0, columnGroups, nil, nil, WithGroupBufferSizes([]int64{1024, 0}))
+	suite.Require().NoError(err)
+	suite.NoError(pw.WriteRecordBatch(suite.rec))
+	suite.NoError(pw.Abort())
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		suite.True(os.IsNotExist(err), path)
+	}
+
+	// the files of the groups created before one failing to be created are removed
+	blocker := "/tmp/group_buffer_sizes/blocker"
+	suite.Require().NoError(os.WriteFile(blocker, nil, 0o644))
+	defer os.Remove(blocker)
+	_, err = NewPackedWriter([]string{paths[0], blocker + "/1"}, suite.schema, bufferSize, 0, columnGroups, nil, nil, WithGroupBufferSizes([]int64{1024, 0}))
+	suite.Error(err)
+	_, err = os.Stat(paths[0])
+	suite.True(os.IsNotExist(err))
+}
+
 func randomString(length int) string {
 	const charset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 	result := make([]byte, length)
@@ -29,15 +29,211 @@ import (
 	"unsafe"
 
 	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
 	"github.com/apache/arrow/go/v17/arrow/cdata"
 	"github.com/cockroachdb/errors"
+	"github.com/samber/lo"
 
 	"github.com/milvus-io/milvus/internal/storagecommon"
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 )
 
-func NewPackedWriter(filePaths []string, schema *arrow.Schema, bufferSize int64, multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext) (*PackedWriter, error) {
+type writerOptions struct {
+	rowGroupSize     int64
+	groupBufferSizes []int64
+	compressions     []storagecommon.CompressionSpec
+}
+
+// WriterOption tunes the parquet files written by PackedWriter.
+type WriterOption func(*writerOptions)
+
+// WithRowGroupSize caps the number of rows per row group. Smaller row groups allow
+// more selective and parallel reads at the cost of more footer metadata and worse
+// compression. Non-positive values keep the parquet default.
+func WithRowGroupSize(rowGroupSize int64) WriterOption {
+	return func(o *writerOptions) {
+		o.rowGroupSize = rowGroupSize
+	}
+}
+
+// WithGroupBufferSizes gives every column group a buffer of its own, flushed once it
+// holds groupBufferSizes[i] bytes, aligned to the column groups of the writer.
+// Non-positive sizes take the buffer size of the writer. Each group is then written by
+// a native writer of its own, so a group of small columns is not flushed every time the
+// buffer shared with a large group fills up: the memory held is the sum of the group
+// sizes rather than the buffer size of the writer. A batch failing to be written to a
+// group after being written to the ones before poisons the writer, whose files are
+// removed by Close.
+func WithGroupBufferSizes(groupBufferSizes []int64) WriterOption {
+	return func(o *writerOptions) {
+		o.groupBufferSizes = groupBufferSizes
+	}
+}
+
+// WithGroupCompressions compresses the columns of the i-th column group with
+// compressions[i], aligned to the column groups of the writer. Nil keeps the default
+// compression of the writer for all groups.
+func WithGroupCompressions(compressions []storagecommon.CompressionSpec) WriterOption {
+	return func(o *writerOptions) {
+		o.compressions = compressions
+	}
+}
+
+func NewPackedWriter(filePaths []string, schema *arrow.Schema, bufferSize int64, multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext, opts ...WriterOption) (*PackedWriter, error) {
+	options := &writerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	cWriterProperties := C.CPackedWriterProperties{
+		row_group_size: C.int64_t(options.rowGroupSize),
+	}
+	if len(options.compressions) > 0 {
+		if len(options.compressions) != len(columnGroups) {
+			return nil, errors.Newf("expect a compression per column group, got %d for %d groups",
+				len(options.compressions), len(columnGroups))
+		}
+		free, err := setColumnCompressions(&cWriterProperties, schema, columnGroups, options.compressions)
+		if err != nil {
+			return nil, err
+		}
+		defer free()
+	}
+
+	if len(options.groupBufferSizes) == 0 {
+		cPackedWriter, err := newCPackedWriter(filePaths, schema, bufferSize, multiPartUploadSize, columnGroups, storageConfig, storagePluginContext, &cWriterProperties)
+		if err != nil {
+			return nil, err
+		}
+		return &PackedWriter{cPackedWriters: []C.CPackedWriter{cPackedWriter}, filePaths: filePaths, storageConfig: storageConfig}, nil
+	}
+	if len(options.groupBufferSizes) != len(columnGroups) || len(filePaths) != len(columnGroups) {
+		return nil, errors.Newf("expect a group buffer size and a path per column group, got %d and %d for %d groups",
+			len(options.groupBufferSizes), len(filePaths), len(columnGroups))
+	}
+	pw := &PackedWriter{
+		cPackedWriters: make([]C.CPackedWriter, 0, len(columnGroups)),
+		storageConfig:  storageConfig,
+	}
+	for i, group := range columnGroups {
+		groupBufferSize := options.groupBufferSizes[i]
+		if groupBufferSize <= 0 {
+			groupBufferSize = bufferSize
+		}
+		// the writer of a group takes the columns of the group only
+		fields := make([]arrow.Field, len(group.Columns))
+		for j, col := range group.Columns {
+			fields[j] = schema.Field(col)
+		}
+		metadata := schema.Metadata()
+		groupSchema := arrow.NewSchema(fields, &metadata)
+		groupColumns := []storagecommon.ColumnGroup{{GroupID: group.GroupID, Columns: lo.Range(len(fields))}}
+		var compressions []storagecommon.CompressionSpec
+		if len(options.compressions) > 0 {
+			compressions = options.compressions[i : i+1]
+		}
+		cPackedWriter, err := newGroupCPackedWriter(filePaths[i], groupSchema, groupBufferSize, multiPartUploadSize, groupColumns, storageConfig, storagePluginContext,
+			options.rowGroupSize, compressions)
+		if err != nil {
+			// the files of the groups before hold no rows yet
+			return nil, errors.CombineErrors(err, pw.Abort())
+		}
+		pw.cPackedWriters = append(pw.cPackedWriters, cPackedWriter)
+		pw.groupColumns = append(pw.groupColumns, group.Columns)
+		pw.groupSchemas = append(pw.groupSchemas, groupSchema)
+		pw.filePaths = append(pw.filePaths, filePaths[i])
+	}
+	return pw, nil
+}
+
+// newGroupCPackedWriter creates the native writer of the single column group of
+// columnGroups to filePath, compressed with the single spec of compressions, if any.
+func newGroupCPackedWriter(filePath string, schema *arrow.Schema, bufferSize int64, multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext, rowGroupSize int64, compressions []storagecommon.CompressionSpec) (C.CPackedWriter, error) {
+	cWriterProperties := C.CPackedWriterProperties{
+		row_group_size: C.int64_t(rowGroupSize),
+	}
+	if len(compressions) > 0 {
+		free, err := setColumnCompressions(&cWriterProperties, schema, columnGroups, compressions)
+		if err != nil {
+			return nil, err
+		}
+		defer free()
+	}
+	return newCPackedWriter([]string{filePath}, schema, bufferSize, multiPartUploadSize, columnGroups, storageConfig, storagePluginContext, &cWriterProperties)
+}
+
+// setColumnCompressions sets the compression of every parquet column of the column
+// groups in props, returning the func freeing the arrays it allocated.
+func setColumnCompressions(props *C.CPackedWriterProperties, schema *arrow.Schema, columnGroups []storagecommon.ColumnGroup, compressions []storagecommon.CompressionSpec) (func(), error) {
+	var paths []string
+	var specs []storagecommon.CompressionSpec
+	for i, group := range columnGroups {
+		if err := compressions[i].Validate(); err != nil {
+			return nil, errors.Wrapf(err, "column group %d", group.GroupID)
+		}
+		if compressions[i].Codec == storagecommon.CompressionDefault {
+			continue
+		}
+		for _, col := range group.Columns {
+			for _, path := range columnPaths(schema.Field(col)) {
+				paths = append(paths, path)
+				specs = append(specs, compressions[i])
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return func() {}, nil
+	}
+	n := C.size_t(len(paths))
+	cPaths := (**C.char)(C.malloc(n * C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+	cCodecs := (*C.int32_t)(C.malloc(n * C.size_t(unsafe.Sizeof(C.int32_t(0)))))
+	cLevels := (*C.int32_t)(C.malloc(n * C.size_t(unsafe.Sizeof(C.int32_t(0)))))
+	pathSlice := unsafe.Slice(cPaths, len(paths))
+	codecSlice := unsafe.Slice(cCodecs, len(paths))
+	levelSlice := unsafe.Slice(cLevels, len(paths))
+	for i, path := range paths {
+		pathSlice[i] = C.CString(path)
+		codecSlice[i] = C.int32_t(specs[i].Codec)
+		levelSlice[i] = C.int32_t(specs[i].Level)
+	}
+	props.num_compressed_columns = C.int64_t(len(paths))
+	props.compressed_columns = cPaths
+	props.compression_codecs = cCodecs
+	props.compression_levels = cLevels
+	return func() {
+		for _, path := range pathSlice {
+			C.free(unsafe.Pointer(path))
+		}
+		C.free(unsafe.Pointer(cPaths))
+		C.free(unsafe.Pointer(cCodecs))
+		C.free(unsafe.Pointer(cLevels))
+	}, nil
+}
+
+// columnPaths returns the dotted paths of the parquet leaf columns of field, the
+// compression of parquet being set per leaf.
+func columnPaths(field arrow.Field) []string {
+	switch dt := field.Type.(type) {
+	case *arrow.ListType, *arrow.LargeListType, *arrow.FixedSizeListType:
+		var paths []string
+		for _, path := range columnPaths(dt.(arrow.ListLikeType).ElemField()) {
+			paths = append(paths, field.Name+".list."+path)
+		}
+		return paths
+	case *arrow.StructType:
+		var paths []string
+		for _, child := range dt.Fields() {
+			for _, path := range columnPaths(child) {
+				paths = append(paths, field.Name+"."+path)
+			}
+		}
+		return paths
+	}
+	return []string{field.Name}
+}
+
+// newCPackedWriter creates a native writer of columnGroups to filePaths.
+func newCPackedWriter(filePaths []string, schema *arrow.Schema, bufferSize int64, multiPartUploadSize int64, columnGroups []storagecommon.ColumnGroup, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext, cWriterProperties *C.CPackedWriterProperties) (C.CPackedWriter, error) {
 	cFilePaths := make([]*C.char, len(filePaths))
 	for i, path := range filePaths {
 		cFilePaths[i] = C.CString(path)
@@ -117,17 +313,42 @@ func NewPackedWriter(filePaths []string, schema *arrow.Schema, bufferSize int64,
 		defer C.free(unsafe.Pointer(cStorageConfig.sslCACert))
 		defer C.free(unsafe.Pointer(cStorageConfig.region))
 		defer C.free(unsafe.Pointer(cStorageConfig.gcp_credential_json))
-		status = C.NewPackedWriterWithStorageConfig(cSchema, cBufferSize, cFilePathsArray, cNumPaths, cMultiPartUploadSize, cColumnGroups, cStorageConfig, &cPackedWriter, pluginContextPtr)
+		status = C.NewPackedWriterWithStorageConfig(cSchema, cBufferSize, cFilePathsArray, cNumPaths, cMultiPartUploadSize, cColumnGroups, cStorageConfig, &cPackedWriter, pluginContextPtr, cWriterProperties)
 	} else {
-		status = C.NewPackedWriter(cSchema, cBufferSize, cFilePathsArray, cNumPaths, cMultiPartUploadSize, cColumnGroups, &cPackedWriter, pluginContextPtr)
+		status = C.NewPackedWriter(cSchema, cBufferSize, cFilePathsArray, cNumPaths, cMultiPartUploadSize, cColumnGroups, &cPackedWriter, pluginContextPtr, cWriterProperties)
 	}
 	if err := ConsumeCStatusIntoError(&status); err != nil {
 		return nil, err
 	}
-	return &PackedWriter{cPackedWriter: cPackedWriter}, nil
+	return cPackedWriter, nil
 }
 
 func (pw *PackedWriter) WriteRecordBatch(recordBatch arrow.Record) error {
+	if pw.poisoned {
+		return errors.New("packed writer is poisoned by a batch written to some column groups only")
+	}
+	if pw.groupColumns == nil {
+		return writeCRecordBatch(pw.cPackedWriters[0], recordBatch)
+	}
+	// every native writer imports, and so releases, the arrays exported to it
+	for i, cPackedWriter := range pw.cPackedWriters {
+		cols := make([]arrow.Array, len(pw.groupColumns[i]))
+		for j, col := range pw.groupColumns[i] {
+			cols[j] = recordBatch.Column(col)
+		}
+		groupBatch := array.NewRecord(pw.groupSchemas[i], cols, recordBatch.NumRows())
+		err := writeCRecordBatch(cPackedWriter, groupBatch)
+		groupBatch.Release()
+		if err != nil {
+			// the groups before hold rows the groups after lack
+			pw.poisoned = i > 0
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCRecordBatch(cPackedWriter C.CPackedWriter, recordBatch arrow.Record) error {
 	cArrays := make([]CArrowArray, recordBatch.NumCols())
 	cSchemas := make([]CArrowSchema, recordBatch.NumCols())
 
@@ -143,7 +364,7 @@ func (pw *PackedWriter) WriteRecordBatch(recordBatch arrow.Record) error {
 	cdata.ExportArrowSchema(recordBatch.Schema(), &cas)
 	cSchema := (*C.struct_ArrowSchema)(unsafe.Pointer(&cas))
 
-	status := C.WriteRecordBatch(pw.cPackedWriter, &cArrays[0], &cSchemas[0], cSchema)
+	status := C.WriteRecordBatch(cPackedWriter, &cArrays[0], &cSchemas[0], cSchema)
 	if err := ConsumeCStatusIntoError(&status); err != nil {
 		return err
 	}
@@ -151,10 +372,40 @@ func (pw *PackedWriter) WriteRecordBatch(recordBatch arrow.Record) error {
 	return nil
 }
 
+// Close closes the native writers of all groups, returning the first error. The writers
+// are freed by the first Close, later ones do nothing. A poisoned writer removes its files
+// and fails.
 func (pw *PackedWriter) Close() error {
-	status := C.CloseWriter(pw.cPackedWriter)
-	if err := ConsumeCStatusIntoError(&status); err != nil {
-		return err
+	if pw.poisoned {
+		return errors.CombineErrors(errors.New("packed writer is poisoned by a batch written to some column groups only, its files are removed"),
+			pw.Abort())
 	}
-	return nil
+	return pw.closeWriters()
+}
+
+// Abort closes the native writers and removes the files of all groups, written or not.
+func (pw *PackedWriter) Abort() error {
+	errs := pw.closeWriters()
+	if pw.removed {
+		return errs
+	}
+	pw.removed = true
+	for _, path := range pw.filePaths {
+		if err := DeleteFile(path, pw.storageConfig); err != nil {
+			errs = errors.CombineErrors(errs, errors.Wrapf(err, "remove packed file %s", path))
+		}
+	}
+	return errs
+}
+
+func (pw *PackedWriter) closeWriters() error {
+	var firstErr error
+	for _, cPackedWriter := range pw.cPackedWriters {
+		status := C.CloseWriter(cPackedWriter)
+		if err := ConsumeCStatusIntoError(&status); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	pw.cPackedWriters = nil
+	return firstErr
 }
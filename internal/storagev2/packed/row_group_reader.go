@@ -0,0 +1,148 @@
+// Copyright 2023 Zilliz
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packed
+
+/*
+#cgo pkg-config: milvus_core
+
+#include <stdlib.h>
+#include "segcore/packed_reader_c.h"
+#include "arrow/c/abi.h"
+#include "arrow/c/helpers.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/cdata"
+
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexcgopb"
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
+)
+
+// NewPackedRowGroupReader opens the reader of the row groups of the single column group
+// file at path, reading the columns of schema of all row groups until SetRange narrows
+// them. Only the footer is read on open.
+func NewPackedRowGroupReader(path string, schema *arrow.Schema, bufferSize int64, storageConfig *indexpb.StorageConfig, storagePluginContext *indexcgopb.StoragePluginContext) (*PackedRowGroupReader, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var cas cdata.CArrowSchema
+	cdata.ExportArrowSchema(schema, &cas)
+	cSchema := (*C.struct_ArrowSchema)(unsafe.Pointer(&cas))
+	defer cdata.ReleaseCArrowSchema(&cas)
+
+	var pluginContextPtr *C.CPluginContext
+	if storagePluginContext != nil {
+		ckey := C.CString(storagePluginContext.EncryptionKey)
+		defer C.free(unsafe.Pointer(ckey))
+		var pluginContext C.CPluginContext
+		pluginContext.ez_id = C.int64_t(storagePluginContext.EncryptionZoneId)
+		pluginContext.collection_id = C.int64_t(storagePluginContext.CollectionId)
+		pluginContext.key = ckey
+		pluginContextPtr = &pluginContext
+	}
+
+	var cReader C.CPackedRowGroupReader
+	var status C.CStatus
+	if storageConfig == nil {
+		status = C.NewPackedRowGroupReader(cPath, cSchema, C.int64_t(bufferSize), &cReader, pluginContextPtr)
+	} else {
+		cStorageConfig := GetCStorageConfig(storageConfig)
+		defer DeleteCStorageConfig(cStorageConfig)
+		status = C.NewPackedRowGroupReaderWithStorageConfig(cPath, cSchema, C.int64_t(bufferSize), cStorageConfig, &cReader, pluginContextPtr)
+	}
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return nil, err
+	}
+	return &PackedRowGroupReader{cReader: cReader, schema: schema}, nil
+}
+
+// NumRowGroups returns the number of row groups of the file.
+func (r *PackedRowGroupReader) NumRowGroups() (int, error) {
+	var num C.int64_t
+	status := C.GetPackedRowGroupCount(r.cReader, &num)
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return 0, err
+	}
+	return int(num), nil
+}
+
+// RowGroupNumRows returns the number of rows of the row group i of the file.
+func (r *PackedRowGroupReader) RowGroupNumRows(i int) (int64, error) {
+	var numRows C.int64_t
+	status := C.GetPackedRowGroupNumRows(r.cReader, C.int64_t(i), &numRows)
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return 0, err
+	}
+	return int64(numRows), nil
+}
+
+// SetRange restricts the reads to the count row groups from offset on, seeking to the
+// first of them without reading the row groups before it.
+func (r *PackedRowGroupReader) SetRange(offset, count int) error {
+	status := C.SetPackedRowGroupRange(r.cReader, C.int64_t(offset), C.int64_t(count))
+	return ConsumeCStatusIntoError(&status)
+}
+
+// ReadNext reads the next row group of the range as a record, valid until the next read,
+// and io.EOF at the end of the range.
+func (r *PackedRowGroupReader) ReadNext() (arrow.Record, error) {
+	if r.cReader == nil {
+		return nil, io.EOF
+	}
+	if r.currentBatch != nil {
+		r.currentBatch.Release()
+		r.currentBatch = nil
+	}
+	var cArr C.CArrowArray
+	var cSchema C.CArrowSchema
+	status := C.ReadNextPackedRowGroup(r.cReader, &cArr, &cSchema)
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return nil, err
+	}
+	if cArr == nil {
+		return nil, io.EOF
+	}
+	goCArr := (*cdata.CArrowArray)(unsafe.Pointer(cArr))
+	goCSchema := (*cdata.CArrowSchema)(unsafe.Pointer(cSchema))
+	defer func() {
+		cdata.ReleaseCArrowArray(goCArr)
+		cdata.ReleaseCArrowSchema(goCSchema)
+	}()
+	recordBatch, err := cdata.ImportCRecordBatch(goCArr, goCSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert ArrowArray to Record: %w", err)
+	}
+	r.currentBatch = recordBatch
+	return recordBatch, nil
+}
+
+func (r *PackedRowGroupReader) Close() error {
+	if r.cReader == nil {
+		return nil
+	}
+	if r.currentBatch != nil {
+		r.currentBatch.Release()
+		r.currentBatch = nil
+	}
+	status := C.ClosePackedRowGroupReader(r.cReader)
+	r.cReader = nil
+	return ConsumeCStatusIntoError(&status)
+}
@@ -28,10 +28,23 @@ import (
 	"github.com/apache/arrow/go/v17/arrow"
 	"github.com/apache/arrow/go/v17/arrow/arrio"
 	"github.com/apache/arrow/go/v17/arrow/cdata"
+
+	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 )
 
 type PackedWriter struct {
-	cPackedWriter C.CPackedWriter
+	// cPackedWriters holds a single writer of all column groups, or a writer per group
+	// with WithGroupBufferSizes, which writes the columns groupColumns[i] of the batches
+	// as of schema groupSchemas[i].
+	cPackedWriters []C.CPackedWriter
+	groupColumns   [][]int
+	groupSchemas   []*arrow.Schema
+	// filePaths are removed with storageConfig by Abort, and by Close once poisoned by a
+	// batch written to some of the groups only.
+	filePaths     []string
+	storageConfig *indexpb.StorageConfig
+	poisoned      bool
+	removed       bool
 }
 
 type FFIPackedWriter struct {
@@ -47,6 +60,19 @@ type PackedReader struct {
 	currentBatch  arrow.Record
 }
 
+// FileSystem is a native filesystem handle shared by the readers opened on it, see
+// NewFileSystem.
+type FileSystem struct {
+	cFs C.CPackedFileSystem
+}
+
+// PackedRowGroupReader reads a range of the row groups of a single column group file.
+type PackedRowGroupReader struct {
+	cReader      C.CPackedRowGroupReader
+	schema       *arrow.Schema
+	currentBatch arrow.Record
+}
+
 type FFIPackedReader struct {
 	cPackedReader C.CFFIPackedReader
 	recordReader  arrio.Reader
@@ -30,6 +30,9 @@ import "C"
 import (
 	"unsafe"
 
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/cdata"
+
 	"github.com/milvus-io/milvus/pkg/v2/proto/indexpb"
 	"github.com/milvus-io/milvus/pkg/v2/util/merr"
 )
@@ -60,6 +63,80 @@ func GetFileSize(path string, storageConfig *indexpb.StorageConfig) (int64, erro
 	}
 }
 
+// DeleteFile deletes the file at path, a missing file is not an error.
+func DeleteFile(path string, storageConfig *indexpb.StorageConfig) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	if storageConfig == nil {
+		status := C.DeleteFile(cPath)
+		return ConsumeCStatusIntoError(&status)
+	}
+	cStorageConfig := GetCStorageConfig(storageConfig)
+	defer DeleteCStorageConfig(cStorageConfig)
+	status := C.DeleteFileWithStorageConfig(cPath, cStorageConfig)
+	return ConsumeCStatusIntoError(&status)
+}
+
+// GetFileSchema returns the arrow schema stored in the footer of the packed file at path,
+// with all the columns of the file and their field ids.
+func GetFileSchema(path string, storageConfig *indexpb.StorageConfig) (*arrow.Schema, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var cas cdata.CArrowSchema
+	cSchema := (*C.struct_ArrowSchema)(unsafe.Pointer(&cas))
+	var status C.CStatus
+	if storageConfig == nil {
+		status = C.GetFileSchema(cPath, cSchema)
+	} else {
+		cStorageConfig := GetCStorageConfig(storageConfig)
+		defer DeleteCStorageConfig(cStorageConfig)
+		status = C.GetFileSchemaWithStorageConfig(cPath, cStorageConfig, cSchema)
+	}
+	if err := ConsumeCStatusIntoError(&status); err != nil {
+		return nil, err
+	}
+	return cdata.ImportCArrowSchema(&cas)
+}
+
+// GetFileRowCount returns the number of rows stored in the footer of the packed file at
+// path, without reading its row groups.
+func GetFileRowCount(path string, storageConfig *indexpb.StorageConfig) (int64, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var numRows int64
+	var status C.CStatus
+	if storageConfig == nil {
+		status = C.GetFileRowCount(cPath, (*C.int64_t)(unsafe.Pointer(&numRows)))
+	} else {
+		cStorageConfig := GetCStorageConfig(storageConfig)
+		defer DeleteCStorageConfig(cStorageConfig)
+		status = C.GetFileRowCountWithStorageConfig(cPath, cStorageConfig, (*C.int64_t)(unsafe.Pointer(&numRows)))
+	}
+	return numRows, ConsumeCStatusIntoError(&status)
+}
+
+// GetFileStats returns the number of rows and the uncompressed bytes of the row groups
+// stored in the footer of the packed file at path, without reading its row groups.
+func GetFileStats(path string, storageConfig *indexpb.StorageConfig) (int64, int64, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var numRows, uncompressedSize int64
+	var status C.CStatus
+	if storageConfig == nil {
+		status = C.GetFileStats(cPath, (*C.int64_t)(unsafe.Pointer(&numRows)), (*C.int64_t)(unsafe.Pointer(&uncompressedSize)))
+	} else {
+		cStorageConfig := GetCStorageConfig(storageConfig)
+		defer DeleteCStorageConfig(cStorageConfig)
+		status = C.GetFileStatsWithStorageConfig(cPath, cStorageConfig,
+			(*C.int64_t)(unsafe.Pointer(&numRows)), (*C.int64_t)(unsafe.Pointer(&uncompressedSize)))
+	}
+	return numRows, uncompressedSize, ConsumeCStatusIntoError(&status)
+}
+
 func GetCStorageConfig(storageConfig *indexpb.StorageConfig) C.CStorageConfig {
 	cStorageConfig := C.CStorageConfig{
 		address:                C.CString(storageConfig.GetAddress()),
@@ -134,6 +134,8 @@ func (s *ErrSuite) TestWrap() {
 	s.ErrorIs(WrapErrIoKeyNotFound("test_key", "failed to read"), ErrIoKeyNotFound)
 	s.ErrorIs(WrapErrIoFailed("test_key", os.ErrClosed), ErrIoFailed)
 	s.ErrorIs(WrapErrIoUnexpectEOF("test_key", os.ErrClosed), ErrIoUnexpectEOF)
+	s.ErrorIs(WrapErrIoDecodeFailed("test_key", os.ErrClosed), ErrIoDecodeFailed)
+	s.NotErrorIs(WrapErrIoDecodeFailed("test_key", os.ErrClosed), ErrIoFailed)
 
 	// Parameter related
 	s.ErrorIs(WrapErrParameterInvalid(8, 1, "failed to create"), ErrParameterInvalid)
@@ -944,6 +944,15 @@ func WrapErrIoUnexpectEOF(key string, err error) error {
 	return wrapFieldsWithDesc(ErrIoUnexpectEOF, err.Error(), value("key", key))
 }
 
+// WrapErrIoDecodeFailed wraps the failure to decode the data read of key, e.g. a corrupt
+// or truncated file, which reading it again does not get past.
+func WrapErrIoDecodeFailed(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return wrapFieldsWithDesc(ErrIoDecodeFailed, err.Error(), value("key", key))
+}
+
 // Parameter related
 func WrapErrParameterInvalid[T any](expected, actual T, msg ...string) error {
 	err := wrapFields(ErrParameterInvalid,